@@ -5,8 +5,10 @@ import (
 	"flag"
 	"fmt"
 	"github.com/TeaOSLab/EdgeNode/internal/apps"
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
 	"github.com/TeaOSLab/EdgeNode/internal/configs"
 	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
+	"github.com/TeaOSLab/EdgeNode/internal/firewalls"
 	"github.com/TeaOSLab/EdgeNode/internal/nodes"
 	"github.com/TeaOSLab/EdgeNode/internal/utils"
 	fsutils "github.com/TeaOSLab/EdgeNode/internal/utils/fs"
@@ -24,6 +26,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 )
 
@@ -32,8 +35,12 @@ func main() {
 		Version(teaconst.Version).
 		Product(teaconst.ProductName).
 		Usage(teaconst.ProcessName + " [-v|start|stop|restart|status|quit|test|reload|service|daemon|config|pprof|accesslog|uninstall]").
-		Usage(teaconst.ProcessName + " [trackers|goman|conns|gc|bandwidth|disk|cache.garbage]").
-		Usage(teaconst.ProcessName + " [ip.drop|ip.reject|ip.remove|ip.close] IP")
+		Usage(teaconst.ProcessName + " upgrade [--graceful] [--timeout=SECONDS]").
+		Usage(teaconst.ProcessName + " [trackers|goman|conns|gc|bandwidth|disk|cache.garbage|cache.stat]").
+		Usage(teaconst.ProcessName + " [cache.get|cache.delete] URL|KEY").
+		Usage(teaconst.ProcessName + " cache.list [--prefix=PREFIX] [--server=SERVER_ID] [--size=SIZE]").
+		Usage(teaconst.ProcessName + " [ip.drop|ip.reject|ip.remove|ip.close] IP").
+		Usage(teaconst.ProcessName + " [firewall.export|firewall.restore] FILE")
 
 	app.On("start:before", func() {
 		// validate config
@@ -145,6 +152,27 @@ func main() {
 		}
 		fmt.Println("done")
 	})
+	app.On("upgrade", func() {
+		var options = app.ParseOptions(os.Args[2:])
+		_, isGraceful := options["graceful"]
+		var commandParams = map[string]any{
+			"graceful": isGraceful,
+		}
+		timeout, ok := options["timeout"]
+		if ok {
+			commandParams["timeout"] = types.Int(timeout[0])
+		}
+
+		_, ok = sendSockCommand("upgrade", commandParams)
+		if !ok {
+			return
+		}
+		if isGraceful {
+			fmt.Println("restarting in background, see logs for details")
+		} else {
+			fmt.Println("upgrading in background, see logs for details")
+		}
+	})
 	app.On("pprof", func() {
 		var flagSet = flag.NewFlagSet("pprof", flag.ExitOnError)
 		var addr string
@@ -525,6 +553,215 @@ func main() {
 			fmt.Println("[ERROR]" + params.GetString("error"))
 		}
 	})
+	app.On("cache.get", func() {
+		var args = os.Args[2:]
+		if len(args) == 0 {
+			fmt.Println("Usage: edge-node cache.get URL|KEY [--json]")
+			return
+		}
+		var options = app.ParseOptions(args[1:])
+		_, isJSON := options["json"]
+
+		params, ok := sendSockCommand("cache.get", map[string]any{"key": args[0]})
+		if !ok {
+			return
+		}
+		if isJSON {
+			printCacheJSON(params.Get("items"))
+			return
+		}
+
+		items, err := decodeCacheItems(params.Get("items"))
+		if err != nil {
+			fmt.Println("[ERROR]" + err.Error())
+			return
+		}
+		if len(items) == 0 {
+			fmt.Println("not cached")
+			return
+		}
+		for index, item := range items {
+			if index > 0 {
+				fmt.Println("======")
+			}
+			var variant = item.Variant
+			if len(variant) == 0 {
+				variant = "-"
+			}
+			fmt.Println("policy:", item.PolicyId, "storage:", item.Storage, "variant:", variant)
+			fmt.Println("key:", item.Key)
+			fmt.Println("hash:", item.Hash)
+			if len(item.Path) > 0 {
+				fmt.Println("path:", item.Path)
+			}
+			if item.Status > 0 {
+				fmt.Println("status:", item.Status)
+			}
+			fmt.Println("size:", item.BodySize, "bytes, header:", item.HeaderSize, "bytes")
+			fmt.Println("expires:", formatCacheTime(item.ExpiresAt))
+			if item.StaleAt > item.ExpiresAt {
+				fmt.Println("stale until:", formatCacheTime(item.StaleAt))
+			}
+			if item.CreatedAt > 0 {
+				fmt.Println("created:", formatCacheTime(item.CreatedAt))
+			}
+			if item.ServerId > 0 {
+				fmt.Println("server:", item.ServerId)
+			}
+			fmt.Println("hits:", item.Hits)
+			if len(item.Headers) > 0 {
+				fmt.Println("headers:")
+				for _, header := range item.Headers {
+					fmt.Println("  " + header)
+				}
+			}
+		}
+	})
+	app.On("cache.list", func() {
+		var options = app.ParseOptions(os.Args[2:])
+		_, isJSON := options["json"]
+		var commandParams = map[string]any{}
+		prefix, ok := options["prefix"]
+		if ok {
+			commandParams["prefix"] = prefix[0]
+		}
+		serverId, ok := options["server"]
+		if ok {
+			commandParams["serverId"] = types.Int64(serverId[0])
+		}
+		size, ok := options["size"]
+		if ok {
+			commandParams["size"] = types.Int(size[0])
+		}
+
+		params, ok := sendSockCommand("cache.list", commandParams)
+		if !ok {
+			return
+		}
+		if isJSON {
+			printCacheJSON(params.Get("items"))
+			return
+		}
+
+		items, err := decodeCacheItems(params.Get("items"))
+		if err != nil {
+			fmt.Println("[ERROR]" + err.Error())
+			return
+		}
+		var writer = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(writer, "POLICY\tSTORAGE\tSERVER\tSIZE\tEXPIRES\tKEY")
+		for _, item := range items {
+			_, _ = fmt.Fprintf(writer, "%d\t%s\t%d\t%d\t%s\t%s\n", item.PolicyId, item.Storage, item.ServerId, item.BodySize, formatCacheTime(item.ExpiresAt), item.Key)
+		}
+		_ = writer.Flush()
+		fmt.Println(len(items), "items")
+	})
+	app.On("cache.delete", func() {
+		var args = os.Args[2:]
+		if len(args) == 0 {
+			fmt.Println("Usage: edge-node cache.delete URL|KEY")
+			return
+		}
+
+		params, ok := sendSockCommand("cache.delete", map[string]any{"key": args[0]})
+		if !ok {
+			return
+		}
+		fmt.Println("deleted", params.GetInt("count"), "caches")
+	})
+	app.On("cache.stat", func() {
+		var options = app.ParseOptions(os.Args[2:])
+		_, isJSON := options["json"]
+
+		params, ok := sendSockCommand("cache.stat", nil)
+		if !ok {
+			return
+		}
+		if isJSON {
+			delete(params, "isOk")
+			printCacheJSON(params)
+			return
+		}
+
+		var writer = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(writer, "POLICY\tNAME\tTYPE\tCOUNT\tSIZE\tDISK\tMEMORY\tADMISSION")
+		for _, stat := range params.GetSlice("stats") {
+			var statMap = maps.NewMap(stat)
+			var admission = "-"
+			if statMap.Get("admission") != nil {
+				var admissionMap = statMap.GetMap("admission")
+				admission = admissionMap.GetString("type") + " " + admissionMap.GetString("admitted") + "/" + admissionMap.GetString("rejected")
+			}
+			_, _ = fmt.Fprintf(writer, "%d\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n", statMap.GetInt64("policyId"), statMap.GetString("name"), statMap.GetString("type"), statMap.GetInt64("count"), statMap.GetInt64("size"), statMap.GetInt64("diskSize"), statMap.GetInt64("memorySize"), admission)
+		}
+		_ = writer.Flush()
+
+		// 缓存目录
+		var hasDisks = false
+		writer = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, stat := range params.GetSlice("stats") {
+			var statMap = maps.NewMap(stat)
+			for _, disk := range statMap.GetSlice("disks") {
+				if !hasDisks {
+					hasDisks = true
+					fmt.Println()
+					_, _ = fmt.Fprintln(writer, "POLICY\tDIR\tUSED\tTOTAL\tFULL\tHEALTHY\tERRORS")
+				}
+				var diskMap = maps.NewMap(disk)
+				_, _ = fmt.Fprintf(writer, "%d\t%s\t%d\t%d\t%t\t%t\t%d\n", statMap.GetInt64("policyId"), diskMap.GetString("path"), diskMap.GetInt64("usedSize"), diskMap.GetInt64("totalSize"), diskMap.GetBool("isFull"), diskMap.GetBool("isHealthy"), diskMap.GetInt64("countErrors"))
+			}
+		}
+		if hasDisks {
+			_ = writer.Flush()
+			fmt.Println()
+		}
+
+		fmt.Println("total disk:", params.GetInt64("totalDiskSize"), "bytes, total memory:", params.GetInt64("totalMemorySize"), "bytes")
+	})
+	app.On("firewall.export", func() {
+		var args = os.Args[2:]
+		if len(args) == 0 {
+			fmt.Println("Usage: edge-node firewall.export FILE")
+			return
+		}
+		var path = args[0]
+
+		params, ok := sendSockCommand("firewall.export", nil)
+		if !ok {
+			return
+		}
+		state, err := firewalls.DecodeFirewallState(params.Get("state"))
+		if err != nil {
+			fmt.Println("[ERROR]decode state failed: " + err.Error())
+			return
+		}
+		err = state.WriteFile(path)
+		if err != nil {
+			fmt.Println("[ERROR]write file failed: " + err.Error())
+			return
+		}
+		fmt.Println("exported", len(state.DenyIPs), "denied ips,", len(state.AllowIPs), "allowed ips,", len(state.DDoSRules), "DDoS rules to '"+path+"'")
+	})
+	app.On("firewall.restore", func() {
+		var args = os.Args[2:]
+		if len(args) == 0 {
+			fmt.Println("Usage: edge-node firewall.restore FILE")
+			return
+		}
+		var path = args[0]
+
+		state, err := firewalls.ReadFirewallStateFile(path)
+		if err != nil {
+			fmt.Println("[ERROR]read file failed: " + err.Error())
+			return
+		}
+
+		params, ok := sendSockCommand("firewall.restore", map[string]any{"state": state})
+		if !ok {
+			return
+		}
+		fmt.Println("restored", params.GetInt("countIPs"), "denied ips from '"+path+"'")
+	})
 	app.On("config", func() {
 		var configString = os.Args[len(os.Args)-1]
 		if configString == "config" {
@@ -565,3 +802,52 @@ func main() {
 		node.Start()
 	})
 }
+
+// 发送命令到节点进程
+func sendSockCommand(code string, params map[string]any) (reply maps.Map, ok bool) {
+	var sock = gosock.NewTmpSock(teaconst.ProcessName)
+	replyCmd, err := sock.Send(&gosock.Command{
+		Code:   code,
+		Params: params,
+	})
+	if err != nil {
+		fmt.Println("[ERROR]" + err.Error())
+		return nil, false
+	}
+	reply = maps.NewMap(replyCmd.Params)
+	if !reply.GetBool("isOk") {
+		fmt.Println("[ERROR]" + reply.GetString("error"))
+		return nil, false
+	}
+	return reply, true
+}
+
+// 从命令返回的数据中解析缓存条目
+func decodeCacheItems(data any) ([]*caches.ItemInfo, error) {
+	var items = []*caches.ItemInfo{}
+	if data == nil {
+		return items, nil
+	}
+	itemsJSON, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(itemsJSON, &items)
+	return items, err
+}
+
+func printCacheJSON(data any) {
+	dataJSON, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		fmt.Println("[ERROR]" + err.Error())
+		return
+	}
+	fmt.Println(string(dataJSON))
+}
+
+func formatCacheTime(timestamp int64) string {
+	if timestamp <= 0 {
+		return "-"
+	}
+	return time.Unix(timestamp, 0).Format("2006-01-02 15:04:05")
+}
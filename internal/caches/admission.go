@@ -0,0 +1,337 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/utils/fasttime"
+	"github.com/cespare/xxhash/v2"
+	"github.com/iwind/TeaGo/types"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	AdmissionTypeTinyLFU = "tinyLFU" // 基于Count-Min Sketch的TinyLFU，访问频率会随着采样逐步衰减
+	AdmissionTypeNthHit  = "nthHit"  // 在一个统计周期内第N次访问时才写入缓存
+)
+
+const (
+	DefaultAdmissionHits     = 2
+	DefaultAdmissionCapacity = 1_000_000
+	DefaultAdmissionWindow   = 1 * time.Hour
+)
+
+// AdmissionFilter 缓存准入过滤器，用来阻止只访问一次的内容写入缓存
+type AdmissionFilter interface {
+	// Admit 记录一次访问，并检查是否允许写入缓存
+	Admit(key string) bool
+
+	// Force 让下一次检查强制通过，比如预热缓存时
+	Force(key string)
+
+	// Stat 准入统计
+	Stat() *AdmissionStat
+}
+
+// AdmissionStat 准入统计
+type AdmissionStat struct {
+	Type     string `json:"type"`
+	Admitted int64  `json:"admitted"` // 允许写入的次数
+	Rejected int64  `json:"rejected"` // 拒绝写入的次数
+}
+
+// Rate 准入比例，范围为0-1
+func (this *AdmissionStat) Rate() float64 {
+	var total = this.Admitted + this.Rejected
+	if total <= 0 {
+		return 1
+	}
+	return float64(this.Admitted) / float64(total)
+}
+
+// NewAdmissionFilterWithOptions 从缓存策略选项中构造准入过滤器，未启用时返回nil
+//
+//	admission 过滤器类型：tinyLFU、nthHit
+//	admissionHits 第几次访问时允许写入缓存，默认为2
+//	admissionCapacity 预计统计的Key数量，默认为100万
+//	admissionWindow nthHit的统计周期，单位为秒，默认为3600
+func NewAdmissionFilterWithOptions(options map[string]any) AdmissionFilter {
+	if options == nil {
+		return nil
+	}
+
+	var admissionType = types.String(options["admission"])
+	if admissionType != AdmissionTypeTinyLFU && admissionType != AdmissionTypeNthHit {
+		return nil
+	}
+
+	var hits = DefaultAdmissionHits
+	if options["admissionHits"] != nil {
+		hits = types.Int(options["admissionHits"])
+		if hits <= 1 {
+			return nil
+		}
+	}
+
+	var capacity = types.Int(options["admissionCapacity"])
+	if capacity <= 0 {
+		capacity = DefaultAdmissionCapacity
+	}
+
+	if admissionType == AdmissionTypeNthHit {
+		var window = time.Duration(types.Int64(options["admissionWindow"])) * time.Second
+		if window <= 0 {
+			window = DefaultAdmissionWindow
+		}
+		return NewNthHitAdmission(capacity, hits, window)
+	}
+	return NewTinyLFUAdmission(capacity, hits)
+}
+
+// 准入相关选项组合成的字符串，用来判断选项是否有变化
+func admissionOptionsKey(options map[string]any) string {
+	if options == nil {
+		return ""
+	}
+	return types.String(options["admission"]) + "$" +
+		types.String(options["admissionHits"]) + "$" +
+		types.String(options["admissionCapacity"]) + "$" +
+		types.String(options["admissionWindow"])
+}
+
+// 两种过滤器共用的实现：
+// 第一次访问只记录在doorkeeper中，再次访问时才进入Count-Min Sketch计数
+type admissionFilter struct {
+	admissionType string
+	hits          int
+
+	doorkeeper *bloomFilter
+	sketch     *countMinSketch
+
+	// TinyLFU衰减
+	sampleSize int
+	samples    int
+
+	// NthHit统计周期
+	window  int64
+	resetAt int64
+
+	locker sync.Mutex
+
+	countAdmitted int64
+	countRejected int64
+}
+
+// NewTinyLFUAdmission 获取TinyLFU准入过滤器
+// 每记录 capacity*10 次访问后所有计数减半，以淘汰过时的访问频率
+func NewTinyLFUAdmission(capacity int, hits int) AdmissionFilter {
+	var filter = newAdmissionFilter(AdmissionTypeTinyLFU, capacity, hits)
+	filter.sampleSize = filter.sketch.width * 10
+	return filter
+}
+
+// NewNthHitAdmission 获取第N次访问时准入的过滤器
+// 每个统计周期结束后清空所有计数
+func NewNthHitAdmission(capacity int, hits int, window time.Duration) AdmissionFilter {
+	var filter = newAdmissionFilter(AdmissionTypeNthHit, capacity, hits)
+	filter.window = int64(window.Seconds())
+	if filter.window <= 0 {
+		filter.window = int64(DefaultAdmissionWindow.Seconds())
+	}
+	filter.resetAt = fasttime.Now().Unix() + filter.window
+	return filter
+}
+
+func newAdmissionFilter(admissionType string, capacity int, hits int) *admissionFilter {
+	if capacity <= 0 {
+		capacity = DefaultAdmissionCapacity
+	}
+	if hits < 2 {
+		hits = 2
+	}
+	return &admissionFilter{
+		admissionType: admissionType,
+		hits:          hits,
+		doorkeeper:    newBloomFilter(capacity),
+		sketch:        newCountMinSketch(capacity),
+	}
+}
+
+func (this *admissionFilter) Admit(key string) bool {
+	var hash = xxhash.Sum64String(key)
+
+	this.locker.Lock()
+	this.age()
+	var frequency = 1
+	if this.doorkeeper.Has(hash) {
+		frequency += this.sketch.Increase(hash)
+	} else {
+		this.doorkeeper.Add(hash)
+	}
+	this.locker.Unlock()
+
+	if frequency >= this.hits {
+		atomic.AddInt64(&this.countAdmitted, 1)
+		return true
+	}
+	atomic.AddInt64(&this.countRejected, 1)
+	return false
+}
+
+func (this *admissionFilter) Force(key string) {
+	var hash = xxhash.Sum64String(key)
+
+	this.locker.Lock()
+	this.doorkeeper.Add(hash)
+	for i := this.sketch.Estimate(hash); i < this.hits-1; i++ {
+		this.sketch.Increase(hash)
+	}
+	this.locker.Unlock()
+}
+
+func (this *admissionFilter) Stat() *AdmissionStat {
+	return &AdmissionStat{
+		Type:     this.admissionType,
+		Admitted: atomic.LoadInt64(&this.countAdmitted),
+		Rejected: atomic.LoadInt64(&this.countRejected),
+	}
+}
+
+// 衰减或清空计数，需要在加锁后调用
+func (this *admissionFilter) age() {
+	switch this.admissionType {
+	case AdmissionTypeTinyLFU:
+		this.samples++
+		if this.samples >= this.sampleSize {
+			this.sketch.Halve()
+			this.doorkeeper.Reset()
+			this.samples /= 2
+		}
+	case AdmissionTypeNthHit:
+		var now = fasttime.Now().Unix()
+		if now >= this.resetAt {
+			this.sketch.Reset()
+			this.doorkeeper.Reset()
+			this.resetAt = now + this.window
+		}
+	}
+}
+
+const countMinSketchDepth = 4
+
+// Count-Min Sketch 频率估算，每个计数器占用一个字节
+type countMinSketch struct {
+	width int
+	mask  uint64
+	rows  [countMinSketchDepth][]uint8
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	var width = nextPowerOfTwo(capacity)
+	var sketch = &countMinSketch{
+		width: width,
+		mask:  uint64(width - 1),
+	}
+	for i := 0; i < countMinSketchDepth; i++ {
+		sketch.rows[i] = make([]uint8, width)
+	}
+	return sketch
+}
+
+// Increase 增加计数，并返回增加后的估算值
+// 只增加最小的计数器（conservative update），以减少误差
+func (this *countMinSketch) Increase(hash uint64) int {
+	var minValue = this.Estimate(hash)
+	if minValue == 0xFF {
+		return minValue
+	}
+	var h1, h2 = hash, hash>>32 | 1
+	for i := 0; i < countMinSketchDepth; i++ {
+		var index = (h1 + uint64(i)*h2) & this.mask
+		if int(this.rows[i][index]) == minValue {
+			this.rows[i][index]++
+		}
+	}
+	return minValue + 1
+}
+
+// Estimate 估算计数
+func (this *countMinSketch) Estimate(hash uint64) int {
+	var minValue = 0xFF
+	var h1, h2 = hash, hash>>32 | 1
+	for i := 0; i < countMinSketchDepth; i++ {
+		var value = int(this.rows[i][(h1+uint64(i)*h2)&this.mask])
+		if value < minValue {
+			minValue = value
+		}
+	}
+	return minValue
+}
+
+// Halve 所有计数减半
+func (this *countMinSketch) Halve() {
+	for i := 0; i < countMinSketchDepth; i++ {
+		var row = this.rows[i]
+		for j := range row {
+			row[j] >>= 1
+		}
+	}
+}
+
+// Reset 清空计数
+func (this *countMinSketch) Reset() {
+	for i := 0; i < countMinSketchDepth; i++ {
+		clear(this.rows[i])
+	}
+}
+
+const bloomFilterHashes = 4
+
+// 简单的布隆过滤器，每个Key大约占用10个比特
+type bloomFilter struct {
+	bits []uint64
+	mask uint64
+}
+
+func newBloomFilter(capacity int) *bloomFilter {
+	var countBits = nextPowerOfTwo(capacity * 10)
+	if countBits < 64 {
+		countBits = 64
+	}
+	return &bloomFilter{
+		bits: make([]uint64, countBits/64),
+		mask: uint64(countBits - 1),
+	}
+}
+
+func (this *bloomFilter) Add(hash uint64) {
+	var h1, h2 = hash, hash>>32 | 1
+	for i := 0; i < bloomFilterHashes; i++ {
+		var index = (h1 + uint64(i)*h2) & this.mask
+		this.bits[index>>6] |= 1 << (index & 63)
+	}
+}
+
+func (this *bloomFilter) Has(hash uint64) bool {
+	var h1, h2 = hash, hash>>32 | 1
+	for i := 0; i < bloomFilterHashes; i++ {
+		var index = (h1 + uint64(i)*h2) & this.mask
+		if this.bits[index>>6]&(1<<(index&63)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (this *bloomFilter) Reset() {
+	clear(this.bits)
+}
+
+func nextPowerOfTwo(n int) int {
+	var result = 1
+	for result < n {
+		result <<= 1
+	}
+	return result
+}
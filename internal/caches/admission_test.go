@@ -0,0 +1,87 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"github.com/iwind/TeaGo/assert"
+	"github.com/iwind/TeaGo/types"
+	"testing"
+	"time"
+)
+
+func TestNewAdmissionFilterWithOptions(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	a.IsNil(caches.NewAdmissionFilterWithOptions(nil))
+	a.IsNil(caches.NewAdmissionFilterWithOptions(map[string]any{"dir": "/cache"}))
+	a.IsNil(caches.NewAdmissionFilterWithOptions(map[string]any{"admission": "tinyLFU", "admissionHits": 1}))
+	a.IsNotNil(caches.NewAdmissionFilterWithOptions(map[string]any{"admission": "tinyLFU"}))
+	a.IsNotNil(caches.NewAdmissionFilterWithOptions(map[string]any{"admission": "nthHit", "admissionHits": 3, "admissionWindow": 60}))
+}
+
+func TestTinyLFUAdmission_Admit(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var filter = caches.NewTinyLFUAdmission(1000, 2)
+	a.IsFalse(filter.Admit("a"))
+	a.IsTrue(filter.Admit("a"))
+	a.IsTrue(filter.Admit("a"))
+	a.IsFalse(filter.Admit("b"))
+
+	// 预热
+	filter.Force("c")
+	a.IsTrue(filter.Admit("c"))
+
+	var stat = filter.Stat()
+	t.Logf("%+v, rate: %.2f", stat, stat.Rate())
+	a.IsTrue(stat.Admitted == 3)
+	a.IsTrue(stat.Rejected == 2)
+}
+
+func TestTinyLFUAdmission_Aging(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var filter = caches.NewTinyLFUAdmission(128, 3)
+	for i := 0; i < 3; i++ {
+		filter.Admit("a")
+	}
+	a.IsTrue(filter.Admit("a"))
+
+	// 大量一次性访问之后，频率会衰减
+	for i := 0; i < 128*10*2; i++ {
+		filter.Admit("tail-" + types.String(i))
+	}
+	a.IsFalse(filter.Admit("a"))
+}
+
+func TestNthHitAdmission_Admit(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var filter = caches.NewNthHitAdmission(1000, 3, 1*time.Minute)
+	a.IsFalse(filter.Admit("a"))
+	a.IsFalse(filter.Admit("a"))
+	a.IsTrue(filter.Admit("a"))
+	a.IsTrue(filter.Admit("a"))
+
+	var countAdmitted = 0
+	for i := 0; i < 1000; i++ {
+		if filter.Admit("b" + types.String(i)) {
+			countAdmitted++
+		}
+	}
+	t.Log("false positives:", countAdmitted)
+	a.IsTrue(countAdmitted < 10)
+}
+
+func BenchmarkTinyLFUAdmission_Admit(b *testing.B) {
+	var filter = caches.NewTinyLFUAdmission(1_000_000, 2)
+
+	b.RunParallel(func(pb *testing.PB) {
+		var i = 0
+		for pb.Next() {
+			i++
+			filter.Admit("https://example.com/" + types.String(i%100_000))
+		}
+	})
+}
@@ -8,4 +8,5 @@ const (
 	SuffixCompression = "@GOEDGE_"        // 压缩后缀 SuffixCompression + Encoding
 	SuffixMethod      = "@GOEDGE_"        // 请求方法后缀 SuffixMethod + RequestMethod
 	SuffixPartial     = "@GOEDGE_partial" // 分区缓存后缀
+	SuffixSlice       = "@GOEDGE_slice_"  // 切片缓存后缀 SuffixSlice + Index
 )
@@ -14,6 +14,7 @@ var (
 	ErrWritingQueueFull        = errors.New("writing queue full")
 	ErrServerIsBusy            = errors.New("server is busy")
 	ErrUnexpectedContentLength = errors.New("unexpected content length")
+	ErrNotAdmitted             = errors.New("not admitted")
 )
 
 // CapacityError 容量错误
@@ -39,7 +40,8 @@ func CanIgnoreErr(err error) bool {
 		errors.Is(err, ErrEntityTooLarge) ||
 		errors.Is(err, ErrWritingUnavailable) ||
 		errors.Is(err, ErrWritingQueueFull) ||
-		errors.Is(err, ErrServerIsBusy) {
+		errors.Is(err, ErrServerIsBusy) ||
+		errors.Is(err, ErrNotAdmitted) {
 		return true
 	}
 
@@ -0,0 +1,131 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"encoding/binary"
+	"github.com/iwind/TeaGo/types"
+	"hash/crc32"
+	"io"
+)
+
+// 启用校验值的未加密缓存文件结构：
+//
+//	[meta] | [checksum 4 bytes] | [header] | [body]
+//	meta中的URL长度字段为 URLLengthFlagChecksum | SizeChecksum，checksum为Body的CRC32（IEEE）
+//	加密的文件使用数据块的认证标签校验，区间缓存文件因为内容可能不完整，不带校验值
+//	旧版本的节点会把带标记的URL长度当做普通长度读取，所以校验值需要在缓存策略中单独开启，
+//	开启后不能再回退到不支持校验值的版本，否则需要清空缓存
+
+const (
+	URLLengthFlagChecksum uint32 = 1 << 30 // 文件中带有Body校验值
+
+	SizeChecksum = 4
+)
+
+// 从缓存策略选项中读取是否为未加密的缓存文件写入Body校验值，默认不写入
+//
+//	checksum 是否写入Body校验值；开启后读取到损坏的文件时会中断响应并删除文件
+func checksumEnabledWithOptions(options map[string]any) bool {
+	return options != nil && types.Bool(options["checksum"])
+}
+
+// 开始计算Body校验值
+func (this *FileWriter) initChecksum() {
+	this.checksum = crc32.NewIEEE()
+}
+
+// 将Body校验值写入到meta之后的位置
+func (this *FileWriter) finishChecksum() error {
+	var checksumBytes = make([]byte, SizeChecksum)
+	binary.BigEndian.PutUint32(checksumBytes, this.checksum.Sum32())
+	_, err := this.rawWriter.Seek(SizeMeta, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = this.rawWriter.Write(checksumBytes)
+	return err
+}
+
+// 读取文件中保存的Body校验值
+func (this *FileReader) readChecksum() (uint32, error) {
+	var checksumBytes = make([]byte, SizeChecksum)
+	_, err := this.fp.Seek(SizeMeta, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	ok, err := this.readToBuff(this.fp, checksumBytes)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrCacheCorrupted
+	}
+	return binary.BigEndian.Uint32(checksumBytes), nil
+}
+
+// 校验Body内容
+func (this *FileReader) verifyChecksum() error {
+	if !this.hasChecksum {
+		return nil
+	}
+
+	expected, err := this.readChecksum()
+	if err != nil {
+		return err
+	}
+
+	_, err = this.fp.Seek(this.bodyOffset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	var hash = crc32.NewIEEE()
+	n, err := io.Copy(hash, io.LimitReader(this.fp, this.bodySize))
+	if err != nil {
+		return err
+	}
+	if n != this.bodySize || hash.Sum32() != expected {
+		return ErrCacheCorrupted
+	}
+	return nil
+}
+
+// 开始校验从Body开头依次读取的内容
+func (this *FileReader) beginBodyChecksum() error {
+	this.bodyHash = nil
+	this.bodyHashSize = 0
+	if !this.hasChecksum {
+		return nil
+	}
+
+	checksum, err := this.readChecksum()
+	if err != nil {
+		return err
+	}
+	this.expectedChecksum = checksum
+	this.bodyHash = crc32.NewIEEE()
+	return nil
+}
+
+// 累加读取到的Body内容，在读到Body末尾时、交付最后一段数据之前进行校验，
+// 这样较小的Body在发送之前就能完成校验，较大的Body不会完整发送损坏的内容
+func (this *FileReader) updateBodyChecksum(data []byte, isEOF bool) error {
+	if this.bodyHash == nil {
+		return nil
+	}
+
+	if len(data) > 0 {
+		_, _ = this.bodyHash.Write(data)
+		this.bodyHashSize += int64(len(data))
+	}
+	if this.bodyHashSize < this.bodySize && !isEOF {
+		return nil
+	}
+
+	var checksum = this.bodyHash.Sum32()
+	this.bodyHash = nil
+	if this.bodyHashSize != this.bodySize || checksum != this.expectedChecksum {
+		return ErrCacheCorrupted
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	fsutils "github.com/TeaOSLab/EdgeNode/internal/utils/fs"
+	"github.com/iwind/TeaGo/assert"
+	"io"
+	"os"
+	"testing"
+)
+
+func testWriteChecksumFile(t *testing.T, path string, header []byte, body []byte) {
+	fp, err := os.OpenFile(path+FileTmpSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var metaBytes = make([]byte, SizeMeta)
+	copy(metaBytes[OffsetStatus:], "200")
+	binary.BigEndian.PutUint32(metaBytes[OffsetURLLength:], URLLengthFlagChecksum|SizeChecksum)
+	_, err = fp.Write(append(metaBytes, make([]byte, SizeChecksum)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var writer = NewFileWriter(nil, fsutils.NewFile(fp, fsutils.FlagWrite), "my-key", 0, -1, -1, -1, func() {})
+	writer.initChecksum()
+	_, err = writer.WriteHeader(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testOpenChecksumFile(t *testing.T, path string) *FileReader {
+	fp, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reader = NewFileReader(fsutils.NewFile(fp, fsutils.FlagRead))
+	err = reader.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader
+}
+
+func TestFileChecksum_ReadWrite(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var header = []byte("Content-Type: text/html\r\n")
+	var body = make([]byte, 100<<10)
+	_, _ = rand.Read(body)
+
+	var path = t.TempDir() + "/test.cache"
+	testWriteChecksumFile(t, path, header, body)
+
+	var reader = testOpenChecksumFile(t, path)
+	defer func() {
+		_ = reader.Close()
+	}()
+	a.IsTrue(reader.hasChecksum)
+	a.IsTrue(reader.HeaderSize() == int64(len(header)))
+	a.IsTrue(reader.BodySize() == int64(len(body)))
+	a.IsNil(reader.verifyChecksum())
+
+	var buf = make([]byte, 4096)
+	var result = []byte{}
+	err := reader.ReadHeader(buf, func(n int) (goNext bool, err error) {
+		result = append(result, buf[:n]...)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(bytes.Equal(result, header))
+
+	result = nil
+	err = reader.ReadBody(buf, func(n int) (goNext bool, err error) {
+		result = append(result, buf[:n]...)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(bytes.Equal(result, body))
+}
+
+func TestFileChecksum_Corrupted(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var body = make([]byte, 100<<10)
+	_, _ = rand.Read(body)
+
+	var path = t.TempDir() + "/test.cache"
+	testWriteChecksumFile(t, path, []byte("header"), body)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-100] ^= 1
+	err = os.WriteFile(path, data, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	{
+		var reader = testOpenChecksumFile(t, path)
+		a.IsTrue(reader.verifyChecksum() == ErrCacheCorrupted)
+		_ = reader.Close()
+	}
+
+	// 完整读取Body时发现内容已损坏，文件会被删除
+	{
+		var reader = testOpenChecksumFile(t, path)
+		var buf = make([]byte, 4096)
+		var sentSize = 0
+		err = reader.ReadBody(buf, func(n int) (goNext bool, err error) {
+			sentSize += n
+			return true, nil
+		})
+		a.IsTrue(err == ErrCacheCorrupted)
+		a.IsTrue(sentSize < len(body)) // 最后一段数据不会被交付
+		_, err = os.Stat(path)
+		a.IsTrue(os.IsNotExist(err))
+	}
+}
+
+func TestFileChecksum_CorruptedSmallBody(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var path = t.TempDir() + "/test.cache"
+	testWriteChecksumFile(t, path, []byte("header"), []byte("Hello, World"))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 1
+	err = os.WriteFile(path, data, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Body可以一次读完时，在发送之前完成校验
+	var reader = testOpenChecksumFile(t, path)
+	var buf = make([]byte, 4096)
+	var sentSize = 0
+	err = reader.ReadBody(buf, func(n int) (goNext bool, err error) {
+		sentSize += n
+		return true, nil
+	})
+	a.IsTrue(err == ErrCacheCorrupted)
+	a.IsTrue(sentSize == 0)
+}
+
+func TestFileChecksum_Read(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var body = make([]byte, 100<<10)
+	_, _ = rand.Read(body)
+
+	var path = t.TempDir() + "/test.cache"
+	testWriteChecksumFile(t, path, []byte("header"), body)
+
+	var readAll = func() ([]byte, error) {
+		var reader = testOpenChecksumFile(t, path)
+		defer func() {
+			_ = reader.Close()
+		}()
+		var buf = make([]byte, 4096)
+		err := reader.ReadHeader(buf, func(n int) (goNext bool, err error) {
+			return true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		var result = &bytes.Buffer{}
+		_, err = io.CopyBuffer(result, reader, buf)
+		return result.Bytes(), err
+	}
+
+	{
+		result, err := readAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(bytes.Equal(result, body))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-100] ^= 1
+	err = os.WriteFile(path, data, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	{
+		result, err := readAll()
+		a.IsTrue(err == ErrCacheCorrupted)
+		a.IsTrue(len(result) < len(body))
+		_, err = os.Stat(path)
+		a.IsTrue(os.IsNotExist(err))
+	}
+}
+
+func TestFileChecksum_Options(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	a.IsFalse(checksumEnabledWithOptions(nil))
+	a.IsFalse(checksumEnabledWithOptions(map[string]any{}))
+	a.IsFalse(checksumEnabledWithOptions(map[string]any{"checksum": false}))
+	a.IsTrue(checksumEnabledWithOptions(map[string]any{"checksum": true}))
+}
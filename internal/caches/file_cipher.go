@@ -0,0 +1,210 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/bytepool"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/types"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// 加密的缓存文件结构：
+//
+//	[meta] | [encryption header] | [sealed header] | [sealed chunk 0] | [sealed chunk 1] ...
+//	meta中的URL长度字段会加上 URLLengthFlagEncrypted 标记，Header和Body长度字段仍然为明文长度
+//	encryption header: [nonce prefix 8 bytes] | [chunk size uint32]
+//	每个数据块单独加密，并带有认证标签，可以用来校验数据是否被损坏
+
+const (
+	URLLengthFlagEncrypted uint32 = 1 << 31 // 文件内容已加密
+
+	SizeEncryptionNoncePrefix = 8
+	SizeEncryptionHeader      = SizeEncryptionNoncePrefix + 4
+
+	DefaultEncryptedChunkSize = 64 << 10 // 加密数据块尺寸
+	FileCipherKeySize         = 32
+)
+
+const fileCipherHeaderCounter uint32 = 0 // Header使用的计数器，Body中的数据块从1开始
+
+var ErrCacheCorrupted = errors.New("cache file corrupted")
+
+// FileCipher 缓存文件加密器，使用AES-256-GCM分块加密
+type FileCipher struct {
+	key       []byte
+	aead      cipher.AEAD
+	chunkSize int
+	bufPool   *bytepool.Pool
+}
+
+// NewFileCipher 获取新的加密器
+func NewFileCipher(key []byte) (*FileCipher, error) {
+	if len(key) != FileCipherKeySize {
+		return nil, errors.New("invalid cache encryption key size")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileCipher = &FileCipher{
+		key:       append([]byte{}, key...),
+		aead:      aead,
+		chunkSize: DefaultEncryptedChunkSize,
+	}
+	fileCipher.bufPool = bytepool.NewPool(fileCipher.chunkSize + aead.Overhead())
+	return fileCipher, nil
+}
+
+// NewFileCipherWithOptions 从缓存策略选项中构造加密器，未启用时返回nil
+//
+//	encryption 是否加密存储缓存文件，使用节点本地的密钥；启用后不再支持区间缓存（分区缓存）
+func NewFileCipherWithOptions(options map[string]any) (*FileCipher, error) {
+	if options == nil || !types.Bool(options["encryption"]) {
+		return nil, nil
+	}
+	key, err := LoadFileCipherKey(FileCipherKeyPath())
+	if err != nil {
+		return nil, err
+	}
+	return NewFileCipher(key)
+}
+
+// FileCipherKeyPath 节点本地密钥文件路径
+func FileCipherKeyPath() string {
+	return Tea.Root + "/data/cache-encryption.key"
+}
+
+// LoadFileCipherKey 读取节点本地密钥，如果不存在则自动生成
+func LoadFileCipherKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) != FileCipherKeySize {
+			return nil, errors.New("invalid cache encryption key file '" + path + "'")
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key = make([]byte, FileCipherKeySize)
+	_, err = io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = os.MkdirAll(filepath.Dir(path), 0700)
+
+	// 使用O_EXCL防止多个进程同时生成不同的密钥
+	fp, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return LoadFileCipherKey(path)
+		}
+		return nil, err
+	}
+	_, err = fp.Write(key)
+	if err == nil {
+		err = fp.Sync()
+	}
+	closeErr := fp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+	return key, nil
+}
+
+// Equal 判断两个加密器是否使用同一个密钥
+func (this *FileCipher) Equal(other *FileCipher) bool {
+	if this == nil || other == nil {
+		return this == other
+	}
+	return subtle.ConstantTimeCompare(this.key, other.key) == 1
+}
+
+// Overhead 每个数据块增加的长度
+func (this *FileCipher) Overhead() int {
+	return this.aead.Overhead()
+}
+
+// ChunkSize 数据块尺寸
+func (this *FileCipher) ChunkSize() int {
+	return this.chunkSize
+}
+
+// SealedSize 计算加密后的Body尺寸
+func (this *FileCipher) SealedSize(bodySize int64, chunkSize int) int64 {
+	if bodySize <= 0 || chunkSize <= 0 {
+		return 0
+	}
+	var countChunks = (bodySize + int64(chunkSize) - 1) / int64(chunkSize)
+	return bodySize + countChunks*int64(this.aead.Overhead())
+}
+
+// 生成新的加密头部
+func (this *FileCipher) newEncryptionHeader() ([]byte, error) {
+	var header = make([]byte, SizeEncryptionHeader)
+	_, err := io.ReadFull(rand.Reader, header[:SizeEncryptionNoncePrefix])
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint32(header[SizeEncryptionNoncePrefix:], uint32(this.chunkSize))
+	return header, nil
+}
+
+// 加密数据，结果写回到buf中，buf的容量需要至少比数据多 Overhead() 个字节
+func (this *FileCipher) seal(buf []byte, noncePrefix []byte, counter uint32, aad []byte) []byte {
+	var nonce = this.nonce(noncePrefix, counter)
+	return this.aead.Seal(buf[:0], nonce[:], buf, aad)
+}
+
+// 解密数据，结果写回到buf中
+func (this *FileCipher) open(buf []byte, noncePrefix []byte, counter uint32, aad []byte) ([]byte, error) {
+	var nonce = this.nonce(noncePrefix, counter)
+	result, err := this.aead.Open(buf[:0], nonce[:], buf, aad)
+	if err != nil {
+		return nil, ErrCacheCorrupted
+	}
+	return result, nil
+}
+
+func (this *FileCipher) nonce(noncePrefix []byte, counter uint32) [12]byte {
+	var nonce [12]byte
+	copy(nonce[:], noncePrefix)
+	binary.BigEndian.PutUint32(nonce[SizeEncryptionNoncePrefix:], counter)
+	return nonce
+}
+
+func (this *FileCipher) getBuf() *bytepool.Buf {
+	return this.bufPool.Get()
+}
+
+func (this *FileCipher) putBuf(buf *bytepool.Buf) {
+	this.bufPool.Put(buf)
+}
+
+// 数据块的附加认证数据，用来防止数据块被截断或者交换
+func fileCipherChunkAAD(isLast bool) []byte {
+	if isLast {
+		return []byte{1}
+	}
+	return []byte{0}
+}
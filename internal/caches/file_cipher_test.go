@@ -0,0 +1,270 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	fsutils "github.com/TeaOSLab/EdgeNode/internal/utils/fs"
+	"github.com/iwind/TeaGo/assert"
+	"io"
+	"os"
+	"testing"
+)
+
+func testWriteEncryptedFile(t *testing.T, fileCipher *FileCipher, path string, header []byte, body []byte) {
+	fp, err := os.OpenFile(path+FileTmpSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var metaBytes = make([]byte, SizeMeta)
+	copy(metaBytes[OffsetStatus:], "200")
+	binary.BigEndian.PutUint32(metaBytes[OffsetURLLength:], URLLengthFlagEncrypted)
+	encryptionHeader, err := fileCipher.newEncryptionHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fp.Write(append(metaBytes, encryptionHeader...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var writer = NewFileWriter(nil, fsutils.NewFile(fp, fsutils.FlagWrite), "my-key", 0, -1, -1, -1, func() {})
+	writer.initCipher(fileCipher, encryptionHeader[:SizeEncryptionNoncePrefix])
+	_, err = writer.WriteHeader(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 分多次写入，测试跨越数据块
+	for len(body) > 0 {
+		var size = 10000
+		if size > len(body) {
+			size = len(body)
+		}
+		_, err = writer.Write(body[:size])
+		if err != nil {
+			t.Fatal(err)
+		}
+		body = body[size:]
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testOpenEncryptedFile(t *testing.T, fileCipher *FileCipher, path string) (*FileReader, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reader = NewFileReader(fsutils.NewFile(fp, fsutils.FlagRead))
+	reader.cipher = fileCipher
+	err = reader.Init()
+	return reader, err
+}
+
+func TestFileCipher_ReadWrite(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var key = make([]byte, FileCipherKeySize)
+	_, _ = rand.Read(key)
+	fileCipher, err := NewFileCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var header = []byte("Content-Type: text/html\r\n")
+	var body = make([]byte, DefaultEncryptedChunkSize*3+123)
+	_, _ = rand.Read(body)
+
+	var path = t.TempDir() + "/test.cache"
+	testWriteEncryptedFile(t, fileCipher, path, header, body)
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("plain:", len(body), "sealed:", stat.Size())
+
+	reader, err := testOpenEncryptedFile(t, fileCipher, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	a.IsTrue(reader.Status() == 200)
+	a.IsTrue(reader.HeaderSize() == int64(len(header)))
+	a.IsTrue(reader.BodySize() == int64(len(body)))
+
+	var buf = make([]byte, 1000)
+	var result = []byte{}
+	err = reader.ReadHeader(buf, func(n int) (goNext bool, err error) {
+		result = append(result, buf[:n]...)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(bytes.Equal(result, header))
+
+	result = nil
+	err = reader.ReadBody(buf, func(n int) (goNext bool, err error) {
+		result = append(result, buf[:n]...)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(bytes.Equal(result, body))
+
+	// 作为io.Reader读取
+	err = reader.ReadHeader(buf, func(n int) (goNext bool, err error) {
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(bytes.Equal(result, body))
+
+	// 跨越数据块的区间
+	for _, r := range [][2]int64{{0, 0}, {100, DefaultEncryptedChunkSize + 100}, {DefaultEncryptedChunkSize*2 - 1, -1}, {-1, -500}} {
+		result = nil
+		err = reader.ReadBodyRange(buf, r[0], r[1], func(n int) (goNext bool, err error) {
+			result = append(result, buf[:n]...)
+			return true, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var expected []byte
+		if r[0] < 0 {
+			expected = body[int64(len(body))+r[1]:]
+		} else if r[1] < 0 {
+			expected = body[r[0]:]
+		} else {
+			expected = body[r[0] : r[1]+1]
+		}
+		a.IsTrue(bytes.Equal(result, expected))
+	}
+}
+
+func TestFileCipher_Corrupted(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var key = make([]byte, FileCipherKeySize)
+	_, _ = rand.Read(key)
+	fileCipher, err := NewFileCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body = make([]byte, DefaultEncryptedChunkSize*2)
+	_, _ = rand.Read(body)
+
+	var dir = t.TempDir()
+
+	// 第一个数据块损坏，在初始化时就可以发现
+	{
+		var path = dir + "/first.cache"
+		testWriteEncryptedFile(t, fileCipher, path, []byte("header"), body)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)-DefaultEncryptedChunkSize-100] ^= 1
+		err = os.WriteFile(path, data, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = testOpenEncryptedFile(t, fileCipher, path)
+		a.IsTrue(err == ErrCacheCorrupted)
+		_, err = os.Stat(path)
+		a.IsTrue(os.IsNotExist(err))
+	}
+
+	// 最后一个数据块损坏，在读取时发现
+	{
+		var path = dir + "/last.cache"
+		testWriteEncryptedFile(t, fileCipher, path, []byte("header"), body)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)-1] ^= 1
+		err = os.WriteFile(path, data, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reader, err := testOpenEncryptedFile(t, fileCipher, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf = make([]byte, 4096)
+		err = reader.ReadBody(buf, func(n int) (goNext bool, err error) {
+			return true, nil
+		})
+		a.IsTrue(err == ErrCacheCorrupted)
+		_, err = os.Stat(path)
+		a.IsTrue(os.IsNotExist(err))
+	}
+
+	// 文件被截断
+	{
+		var path = dir + "/truncated.cache"
+		testWriteEncryptedFile(t, fileCipher, path, []byte("header"), body)
+		err = os.Truncate(path, int64(len(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = testOpenEncryptedFile(t, fileCipher, path)
+		a.IsTrue(err == ErrCacheCorrupted)
+	}
+
+	// 未加密的读取器不能读取加密的文件
+	{
+		var path = dir + "/plain.cache"
+		testWriteEncryptedFile(t, fileCipher, path, []byte("header"), body)
+		_, err = testOpenEncryptedFile(t, nil, path)
+		a.IsTrue(err == ErrNotFound)
+	}
+}
+
+func TestFileCipher_Equal(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var key1 = make([]byte, FileCipherKeySize)
+	_, _ = rand.Read(key1)
+	var key2 = make([]byte, FileCipherKeySize)
+	_, _ = rand.Read(key2)
+
+	cipher1, err := NewFileCipher(key1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher2, err := NewFileCipher(key1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher3, err := NewFileCipher(key2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nilCipher *FileCipher
+	a.IsTrue(cipher1.Equal(cipher2))
+	a.IsFalse(cipher1.Equal(cipher3))
+	a.IsFalse(cipher1.Equal(nil))
+	a.IsFalse(nilCipher.Equal(cipher1))
+	a.IsTrue(nilCipher.Equal(nil))
+}
@@ -2,10 +2,92 @@
 
 package caches
 
-import "github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/shared"
+import (
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/shared"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/fasttime"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	FileDirMaxErrors       = 3  // 在统计周期内最多允许的I/O错误次数，超出后暂时停用
+	FileDirErrorsPeriod    = 10 // I/O错误统计周期，单位：秒
+	FileDirDisabledSeconds = 60 // 出错后暂时停用的时间，单位：秒
+	FileDirProbeInterval   = 30 // 检查目录是否可以读写的间隔，单位：秒
+	FileDirProbeTimeout    = 5  // 检查目录的超时时间，单位：秒
+)
 
 type FileDir struct {
 	Path     string
 	Capacity *shared.SizeCapacity
 	IsFull   bool
+
+	weight uint64 // 在一致性Hash中的权重
+
+	countErrors   int64 // 累计I/O错误次数
+	periodErrors  int   // 当前统计周期内的I/O错误次数
+	periodStartAt int64 // 当前统计周期开始时间
+	disabledUntil int64 // 停用截止时间
+	errorLocker   sync.Mutex
+}
+
+// IsHealthy 是否健康，即没有因为I/O错误而被停用
+func (this *FileDir) IsHealthy() bool {
+	return atomic.LoadInt64(&this.disabledUntil) <= fasttime.Now().Unix()
+}
+
+// IsAvailable 是否可以写入新的缓存
+func (this *FileDir) IsAvailable() bool {
+	return !this.IsFull && this.IsHealthy()
+}
+
+// MarkError 记录一次I/O错误，返回是否因此被停用
+func (this *FileDir) MarkError() (disabled bool) {
+	atomic.AddInt64(&this.countErrors, 1)
+
+	var now = fasttime.Now().Unix()
+
+	this.errorLocker.Lock()
+	defer this.errorLocker.Unlock()
+
+	if now-this.periodStartAt >= FileDirErrorsPeriod {
+		this.periodStartAt = now
+		this.periodErrors = 0
+	}
+	this.periodErrors++
+	if this.periodErrors >= FileDirMaxErrors && atomic.LoadInt64(&this.disabledUntil) <= now {
+		atomic.StoreInt64(&this.disabledUntil, now+FileDirDisabledSeconds)
+		this.periodErrors = 0
+		return true
+	}
+	return false
+}
+
+// Disable 停用目录，返回是否由可用变为停用
+func (this *FileDir) Disable() bool {
+	var now = fasttime.Now().Unix()
+	var oldDisabledUntil = atomic.SwapInt64(&this.disabledUntil, now+FileDirDisabledSeconds)
+	return oldDisabledUntil <= now
+}
+
+// Enable 重新启用目录，返回是否由停用变为可用
+func (this *FileDir) Enable() bool {
+	var oldDisabledUntil = atomic.SwapInt64(&this.disabledUntil, 0)
+	return oldDisabledUntil > fasttime.Now().Unix()
+}
+
+// CountErrors 累计I/O错误次数
+func (this *FileDir) CountErrors() int64 {
+	return atomic.LoadInt64(&this.countErrors)
+}
+
+// FileDirStat 缓存目录统计
+type FileDirStat struct {
+	Path        string `json:"path"`
+	Weight      uint64 `json:"weight"`
+	IsFull      bool   `json:"isFull"`
+	IsHealthy   bool   `json:"isHealthy"`
+	CountErrors int64  `json:"countErrors"`
+	UsedSize    int64  `json:"usedSize"`
+	TotalSize   int64  `json:"totalSize"`
 }
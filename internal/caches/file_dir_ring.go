@@ -0,0 +1,132 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"github.com/cespare/xxhash/v2"
+	"sort"
+	"strconv"
+)
+
+const (
+	fileDirRingPoints    = 160  // 每个目录在平均权重下的虚拟节点数
+	fileDirRingMinPoints = 16   // 每个目录最少的虚拟节点数
+	fileDirRingMaxPoints = 2048 // 每个目录最多的虚拟节点数
+)
+
+type fileDirRingPoint struct {
+	hash     uint64
+	dirIndex int
+}
+
+// FileDirRing 使用带权重的一致性Hash在多个缓存目录中分配缓存文件
+// 增加或者删除目录时只会影响少部分缓存文件的位置
+type FileDirRing struct {
+	dirs   []*FileDir
+	points []fileDirRingPoint
+}
+
+// NewFileDirRing 获取新对象，目录的权重需要事先设置好，为0时使用其他目录的平均权重
+func NewFileDirRing(dirs []*FileDir) *FileDirRing {
+	var ring = &FileDirRing{
+		dirs: dirs,
+	}
+	if len(dirs) == 0 {
+		return ring
+	}
+
+	// 计算平均权重
+	var totalWeight uint64
+	var countWeights uint64
+	for _, dir := range dirs {
+		if dir.weight > 0 {
+			totalWeight += dir.weight
+			countWeights++
+		}
+	}
+	var avgWeight uint64 = 1
+	if countWeights > 0 {
+		avgWeight = totalWeight / countWeights
+	}
+
+	for dirIndex, dir := range dirs {
+		var weight = dir.weight
+		if weight == 0 {
+			weight = avgWeight
+		}
+		var countPoints = int(float64(fileDirRingPoints) * float64(weight) / float64(avgWeight))
+		if countPoints < fileDirRingMinPoints {
+			countPoints = fileDirRingMinPoints
+		} else if countPoints > fileDirRingMaxPoints {
+			countPoints = fileDirRingMaxPoints
+		}
+
+		for i := 0; i < countPoints; i++ {
+			ring.points = append(ring.points, fileDirRingPoint{
+				hash:     xxhash.Sum64String(dir.Path + "#" + strconv.Itoa(i)),
+				dirIndex: dirIndex,
+			})
+		}
+	}
+
+	sort.Slice(ring.points, func(i, j int) bool {
+		return ring.points[i].hash < ring.points[j].hash
+	})
+
+	return ring
+}
+
+// Lookup 查找Hash对应的可用目录，如果没有可用的目录则返回nil
+func (this *FileDirRing) Lookup(hash string) *FileDir {
+	var result *FileDir
+	this.walk(hash, func(dir *FileDir) bool {
+		if dir.IsAvailable() {
+			result = dir
+			return false
+		}
+		return true
+	})
+	return result
+}
+
+// Candidates 按照优先级列出Hash对应的所有目录
+func (this *FileDirRing) Candidates(hash string) []*FileDir {
+	var result = make([]*FileDir, 0, len(this.dirs))
+	this.walk(hash, func(dir *FileDir) bool {
+		result = append(result, dir)
+		return true
+	})
+	return result
+}
+
+// Dirs 所有目录
+func (this *FileDirRing) Dirs() []*FileDir {
+	return this.dirs
+}
+
+// 从Hash所在位置开始顺时针遍历不重复的目录
+func (this *FileDirRing) walk(hash string, callback func(dir *FileDir) (goNext bool)) {
+	var countPoints = len(this.points)
+	if countPoints == 0 {
+		return
+	}
+
+	var hashValue = xxhash.Sum64String(hash)
+	var start = sort.Search(countPoints, func(i int) bool {
+		return this.points[i].hash >= hashValue
+	})
+
+	var visited = make([]bool, len(this.dirs))
+	var countVisited = 0
+	for i := 0; i < countPoints && countVisited < len(this.dirs); i++ {
+		var point = this.points[(start+i)%countPoints]
+		if visited[point.dirIndex] {
+			continue
+		}
+		visited[point.dirIndex] = true
+		countVisited++
+		if !callback(this.dirs[point.dirIndex]) {
+			return
+		}
+	}
+}
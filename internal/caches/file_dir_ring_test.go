@@ -0,0 +1,81 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"github.com/iwind/TeaGo/assert"
+	"github.com/iwind/TeaGo/types"
+	stringutil "github.com/iwind/TeaGo/utils/string"
+	"testing"
+)
+
+func TestFileDirRing_Lookup(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var dirs = []*FileDir{
+		{Path: "/data1", weight: 100},
+		{Path: "/data2", weight: 100},
+		{Path: "/data3", weight: 200},
+	}
+	var ring = NewFileDirRing(dirs)
+
+	var countMap = map[string]int{}
+	for i := 0; i < 100_000; i++ {
+		var dir = ring.Lookup(stringutil.Md5(types.String(i)))
+		countMap[dir.Path]++
+	}
+	t.Log(countMap)
+	a.IsTrue(countMap["/data3"] > countMap["/data1"])
+	a.IsTrue(countMap["/data3"] > countMap["/data2"])
+
+	// 已满的目录不能写入
+	dirs[2].IsFull = true
+	for i := 0; i < 1000; i++ {
+		var dir = ring.Lookup(stringutil.Md5(types.String(i)))
+		a.IsTrue(dir.Path != "/data3")
+	}
+
+	// 出错的目录会被暂时停用
+	for i := 0; i < FileDirMaxErrors; i++ {
+		dirs[1].MarkError()
+	}
+	a.IsFalse(dirs[1].IsHealthy())
+	for i := 0; i < 1000; i++ {
+		var dir = ring.Lookup(stringutil.Md5(types.String(i)))
+		a.IsTrue(dir.Path == "/data1")
+	}
+
+	dirs[0].IsFull = true
+	a.IsNil(ring.Lookup(stringutil.Md5("a")))
+	a.IsTrue(len(ring.Candidates(stringutil.Md5("a"))) == 3)
+}
+
+func TestFileDirRing_AddDir(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var ring1 = NewFileDirRing([]*FileDir{
+		{Path: "/data1"},
+		{Path: "/data2"},
+	})
+	var ring2 = NewFileDirRing([]*FileDir{
+		{Path: "/data1"},
+		{Path: "/data2"},
+		{Path: "/data3"},
+	})
+
+	var count = 100_000
+	var countMoved = 0
+	for i := 0; i < count; i++ {
+		var hash = stringutil.Md5(types.String(i))
+		var dir1 = ring1.Lookup(hash)
+		var dir2 = ring2.Lookup(hash)
+		if dir1.Path != dir2.Path {
+			countMoved++
+
+			// 只会迁移到新的目录
+			a.IsTrue(dir2.Path == "/data3")
+		}
+	}
+	t.Log("moved:", countMoved, "/", count)
+	a.IsTrue(countMoved < count/2)
+}
@@ -0,0 +1,281 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	fsutils "github.com/TeaOSLab/EdgeNode/internal/utils/fs"
+	"github.com/iwind/TeaGo/types"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	ItemStorageMemory = "memory"
+	ItemStorageFile   = "file"
+)
+
+// 检查缓存时读取的Header最大尺寸
+const maxInspectHeaderSize = 64 << 10
+
+// ItemInfo 缓存条目详情，用于命令行等查看缓存
+type ItemInfo struct {
+	PolicyId   int64    `json:"policyId"`
+	Storage    string   `json:"storage"` // memory|file
+	Key        string   `json:"key"`
+	Variant    string   `json:"variant,omitempty"` // 变体：HEAD、webp、partial、压缩编码等
+	Hash       string   `json:"hash"`
+	Path       string   `json:"path,omitempty"` // 文件路径，只有文件缓存才有
+	Status     int      `json:"status,omitempty"`
+	HeaderSize int64    `json:"headerSize"`
+	BodySize   int64    `json:"bodySize"`
+	ExpiresAt  int64    `json:"expiresAt"`
+	StaleAt    int64    `json:"staleAt"`
+	CreatedAt  int64    `json:"createdAt,omitempty"`
+	ServerId   int64    `json:"serverId,omitempty"`
+	Hits       int64    `json:"hits"`
+	Headers    []string `json:"headers,omitempty"`
+}
+
+func newItemInfo(policyId int64, storage string, hash string, item *Item) *ItemInfo {
+	return &ItemInfo{
+		PolicyId:   policyId,
+		Storage:    storage,
+		Key:        item.Key,
+		Hash:       hash,
+		HeaderSize: item.HeaderSize,
+		BodySize:   item.BodySize,
+		ExpiresAt:  item.ExpiresAt,
+		StaleAt:    item.StaleAt,
+		CreatedAt:  item.CreatedAt,
+		ServerId:   item.ServerId,
+	}
+}
+
+// Inspect 查看某个Key对应的缓存，不存在时返回nil
+// 和OpenReader不同，此方法不会增加点击量，也不会删除过期的内容
+func (this *MemoryStorage) Inspect(key string, withHeaders bool) (*ItemInfo, error) {
+	var uint64Hash = this.hash(key)
+	var hash = types.String(uint64Hash)
+	list, ok := this.list.(InspectableList)
+	if !ok {
+		return nil, nil
+	}
+	item, err := list.FindItem(hash)
+	if err != nil || item == nil {
+		return nil, err
+	}
+
+	var info = newItemInfo(this.policy.Id, ItemStorageMemory, hash, item)
+
+	this.locker.RLock()
+	memoryItem, ok := this.valuesMap[uint64Hash]
+	if ok {
+		info.Status = memoryItem.Status
+		info.Hits = atomic.LoadInt64(&memoryItem.hits)
+		if withHeaders {
+			info.Headers = splitCachedHeader(memoryItem.HeaderValue)
+		}
+	}
+	this.locker.RUnlock()
+
+	return info, nil
+}
+
+// ListItems 列出符合条件的缓存
+func (this *MemoryStorage) ListItems(query *ItemQuery) ([]*ItemInfo, error) {
+	list, ok := this.list.(InspectableList)
+	if !ok {
+		return nil, nil
+	}
+
+	var result = []*ItemInfo{}
+	err := list.ListItems(query, func(hash string, item *Item) (goNext bool) {
+		result = append(result, newItemInfo(this.policy.Id, ItemStorageMemory, hash, item))
+		return true
+	})
+	return result, err
+}
+
+// Inspect 查看某个Key对应的文件缓存，不存在时返回nil
+// 不包括内存中的缓存，内存中的缓存需要通过 MemoryStorage.Inspect 查看
+func (this *FileStorage) Inspect(key string, withHeaders bool) (*ItemInfo, error) {
+	hash, path, _ := this.keyPath(key)
+	list, ok := this.list.(InspectableList)
+	if !ok {
+		return nil, nil
+	}
+	item, err := list.FindItem(hash)
+	if err != nil || item == nil {
+		return nil, err
+	}
+
+	var info = newItemInfo(this.policy.Id, ItemStorageFile, hash, item)
+	info.Path = path
+
+	this.hotMapLocker.Lock()
+	hotItem, ok := this.hotMap[key]
+	if ok {
+		info.Hits = int64(hotItem.Hits)
+	}
+	this.hotMapLocker.Unlock()
+
+	// 从文件中读取状态码和Header
+	fp, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return info, nil
+		}
+		return nil, err
+	}
+	var reader = NewFileReader(fsutils.NewFile(fp, fsutils.FlagRead))
+	reader.cipher = this.cipher.Load()
+	defer func() {
+		_ = reader.Close()
+	}()
+	err = reader.InitAutoDiscard(false)
+	if err != nil {
+		// 不影响查看列表中的信息
+		return info, nil
+	}
+	info.Status = reader.Status()
+
+	if withHeaders && reader.headerSize > 0 && reader.headerSize <= maxInspectHeaderSize {
+		var header = make([]byte, 0, reader.headerSize)
+		var buf = make([]byte, 4096)
+		err = reader.ReadHeader(buf, func(n int) (goNext bool, err error) {
+			header = append(header, buf[:n]...)
+			return true, nil
+		})
+		if err == nil {
+			info.Headers = splitCachedHeader(header)
+		}
+	}
+
+	return info, nil
+}
+
+// ListItems 列出符合条件的文件缓存
+func (this *FileStorage) ListItems(query *ItemQuery) ([]*ItemInfo, error) {
+	list, ok := this.list.(InspectableList)
+	if !ok {
+		return nil, nil
+	}
+
+	var result = []*ItemInfo{}
+	err := list.ListItems(query, func(hash string, item *Item) (goNext bool) {
+		var info = newItemInfo(this.policy.Id, ItemStorageFile, hash, item)
+		_, info.Path, _ = this.keyPath(item.Key)
+		result = append(result, info)
+		return true
+	})
+	return result, err
+}
+
+// InspectKeys 在所有缓存策略中查看一组Key对应的缓存
+func (this *Manager) InspectKeys(keys []string, withHeaders bool) ([]*ItemInfo, error) {
+	var result = []*ItemInfo{}
+	for _, storage := range this.sortedStorages() {
+		var policyId = storage.Policy().Id
+		for _, key := range keys {
+			var infos []*ItemInfo
+			switch s := storage.(type) {
+			case *MemoryStorage:
+				info, err := s.Inspect(key, withHeaders)
+				if err != nil {
+					return nil, err
+				}
+				infos = append(infos, info)
+			case *FileStorage:
+				var memoryStorage = s.memoryStorage
+				if memoryStorage != nil {
+					info, err := memoryStorage.Inspect(key, withHeaders)
+					if err != nil {
+						return nil, err
+					}
+					infos = append(infos, info)
+				}
+				info, err := s.Inspect(key, withHeaders)
+				if err != nil {
+					return nil, err
+				}
+				infos = append(infos, info)
+			}
+
+			for _, info := range infos {
+				if info != nil {
+					info.PolicyId = policyId
+					result = append(result, info)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// ListItems 在所有缓存策略中列出符合条件的缓存
+func (this *Manager) ListItems(query *ItemQuery) ([]*ItemInfo, error) {
+	var result = []*ItemInfo{}
+	for _, storage := range this.sortedStorages() {
+		if query.Size > 0 && len(result) >= query.Size {
+			break
+		}
+
+		var storageQuery = *query
+		if query.Size > 0 {
+			storageQuery.Size = query.Size - len(result)
+		}
+
+		var infos []*ItemInfo
+		var err error
+		switch s := storage.(type) {
+		case *MemoryStorage:
+			infos, err = s.ListItems(&storageQuery)
+		case *FileStorage:
+			var memoryStorage = s.memoryStorage
+			if memoryStorage != nil {
+				infos, err = memoryStorage.ListItems(&storageQuery)
+				if err == nil && query.Size > 0 {
+					storageQuery.Size -= len(infos)
+				}
+			}
+			if err == nil && (query.Size <= 0 || storageQuery.Size > 0) {
+				var fileInfos []*ItemInfo
+				fileInfos, err = s.ListItems(&storageQuery)
+				infos = append(infos, fileInfos...)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var policyId = storage.Policy().Id
+		for _, info := range infos {
+			info.PolicyId = policyId
+		}
+		result = append(result, infos...)
+	}
+	return result, nil
+}
+
+// 按照策略ID排序的所有存储
+func (this *Manager) sortedStorages() []StorageInterface {
+	var storages = this.FindAllStorages()
+	sort.Slice(storages, func(i, j int) bool {
+		return storages[i].Policy().Id < storages[j].Policy().Id
+	})
+	return storages
+}
+
+// 将缓存中的Header分割为多行
+func splitCachedHeader(header []byte) []string {
+	var result = []string{}
+	for _, line := range strings.Split(string(header), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) > 0 {
+			result = append(result, line)
+		}
+	}
+	return result
+}
@@ -3,6 +3,7 @@
 package caches
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
@@ -141,7 +142,7 @@ func (this *SQLiteFileListDB) Init() error {
 		return err
 	}
 
-	this.selectByHashStmt, err = this.readDB.Prepare(`SELECT "key", "headerSize", "bodySize", "metaSize", "expiredAt" FROM "` + this.itemsTableName + `" WHERE "hash"=? LIMIT 1`)
+	this.selectByHashStmt, err = this.readDB.Prepare(`SELECT "key", "headerSize", "bodySize", "metaSize", "expiredAt", "staleAt", IFNULL("host", ''), IFNULL("serverId", 0), "createdAt" FROM "` + this.itemsTableName + `" WHERE "hash"=? LIMIT 1`)
 	if err != nil {
 		return err
 	}
@@ -302,6 +303,63 @@ func (this *SQLiteFileListDB) ListHashes(lastId int64) (hashList []string, maxId
 	return
 }
 
+// FindItem 根据Hash查找条目
+func (this *SQLiteFileListDB) FindItem(hash string) (*Item, error) {
+	if !this.isReady {
+		return nil, nil
+	}
+
+	var item = &Item{Type: ItemTypeFile}
+	err := this.selectByHashStmt.QueryRow(hash).Scan(&item.Key, &item.HeaderSize, &item.BodySize, &item.MetaSize, &item.ExpiresAt, &item.StaleAt, &item.Host, &item.ServerId, &item.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, this.WrapError(err)
+	}
+	return item, nil
+}
+
+// ListItems 列出符合条件的条目
+// Key上没有索引，所以只适合在命令行等不频繁的场合下使用
+func (this *SQLiteFileListDB) ListItems(query *ItemQuery, callback func(hash string, item *Item) (goNext bool)) error {
+	if !this.isReady {
+		return nil
+	}
+
+	var sqlString = `SELECT "hash", "key", "headerSize", "bodySize", "metaSize", "expiredAt", "staleAt", IFNULL("host", ''), IFNULL("serverId", 0), "createdAt" FROM "` + this.itemsTableName + `" WHERE expiredAt>0 AND INSTR("key", ?)=1`
+	var args = []any{query.Prefix}
+	if query.ServerId > 0 {
+		sqlString += ` AND serverId=?`
+		args = append(args, query.ServerId)
+	}
+	sqlString += ` ORDER BY "id" DESC`
+	if query.Size > 0 {
+		sqlString += ` LIMIT ` + types.String(query.Size)
+	}
+
+	rows, err := this.readDB.Query(sqlString, args...)
+	if err != nil {
+		return this.WrapError(err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var hash string
+		var item = &Item{Type: ItemTypeFile}
+		err = rows.Scan(&hash, &item.Key, &item.HeaderSize, &item.BodySize, &item.MetaSize, &item.ExpiresAt, &item.StaleAt, &item.Host, &item.ServerId, &item.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if !callback(hash, item) {
+			break
+		}
+	}
+	return rows.Err()
+}
+
 func (this *SQLiteFileListDB) IncreaseHitAsync(hash string) error {
 	// do nothing
 	return nil
@@ -296,6 +296,31 @@ func (this *KVFileList) IncreaseHit(hash string) error {
 	return nil
 }
 
+// FindItem 根据Hash查找条目
+func (this *KVFileList) FindItem(hash string) (*Item, error) {
+	return this.getStore(hash).FindItem(hash)
+}
+
+// ListItems 列出符合条件的条目
+func (this *KVFileList) ListItems(query *ItemQuery, callback func(hash string, item *Item) (goNext bool)) error {
+	var count = 0
+	for _, store := range this.stores {
+		var goNext = true
+		err := store.ListItems(query, func(hash string, item *Item) bool {
+			count++
+			goNext = callback(hash, item) && (query.Size <= 0 || count < query.Size)
+			return goNext
+		})
+		if err != nil {
+			return err
+		}
+		if !goNext {
+			break
+		}
+	}
+	return nil
+}
+
 func (this *KVFileList) TestInspect(t *testing.T) error {
 	for _, store := range this.stores {
 		err := store.TestInspect(t)
@@ -445,6 +445,63 @@ func (this *KVListFileStore) StatItems() (*Stat, error) {
 	return stat, err
 }
 
+func (this *KVListFileStore) FindItem(hash string) (*Item, error) {
+	if !this.isReady() {
+		return nil, nil
+	}
+
+	item, err := this.itemsTable.Get(hash)
+	if err != nil {
+		if kvstore.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if item != nil {
+		item.Type = ItemTypeFile
+	}
+	return item, nil
+}
+
+func (this *KVListFileStore) ListItems(query *ItemQuery, callback func(hash string, item *Item) (goNext bool)) error {
+	if !this.isReady() {
+		return nil
+	}
+
+	var fieldOffset []byte
+	const size = 1000
+	for {
+		var count int
+		var goNext = true
+		err := this.itemsTable.
+			Query().
+			FieldPrefix("key", query.Prefix).
+			FieldOffset(fieldOffset).
+			Limit(size).
+			FindAll(func(tx *kvstore.Tx[*Item], item kvstore.Item[*Item]) (bool, error) {
+				count++
+				fieldOffset = item.FieldKey
+
+				if item.Value == nil || item.Value.ExpiresAt <= 0 || !query.Match(item.Value) {
+					return true, nil
+				}
+
+				item.Value.Type = ItemTypeFile
+				goNext = callback(item.Key, item.Value)
+				return goNext, nil
+			})
+		if err != nil {
+			return err
+		}
+
+		if !goNext || count < size {
+			break
+		}
+	}
+
+	return nil
+}
+
 func (this *KVListFileStore) TestInspect(t *testing.T) error {
 	if !this.isReady() {
 		return nil
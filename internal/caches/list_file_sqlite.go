@@ -421,6 +421,40 @@ func (this *SQLiteFileList) Close() error {
 	return nil
 }
 
+// FindItem 根据Hash查找条目
+func (this *SQLiteFileList) FindItem(hash string) (*Item, error) {
+	var db = this.GetDB(hash)
+	if !db.IsReady() || !db.hashMap.Exist(hash) {
+		return nil, nil
+	}
+	return db.FindItem(hash)
+}
+
+// ListItems 列出符合条件的条目
+func (this *SQLiteFileList) ListItems(query *ItemQuery, callback func(hash string, item *Item) (goNext bool)) error {
+	var count = 0
+	for _, db := range this.dbList {
+		var dbQuery = *query
+		if query.Size > 0 {
+			dbQuery.Size = query.Size - count
+		}
+
+		var goNext = true
+		err := db.ListItems(&dbQuery, func(hash string, item *Item) bool {
+			count++
+			goNext = callback(hash, item) && (query.Size <= 0 || count < query.Size)
+			return goNext
+		})
+		if err != nil {
+			return err
+		}
+		if !goNext {
+			break
+		}
+	}
+	return nil
+}
+
 func (this *SQLiteFileList) GetDBIndex(hash string) uint64 {
 	return fnv.HashString(hash) % CountFileDB
 }
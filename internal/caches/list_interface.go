@@ -2,6 +2,8 @@
 
 package caches
 
+import "strings"
+
 type ListInterface interface {
 	// Init 初始化
 	Init() error
@@ -54,3 +56,30 @@ type ListInterface interface {
 	// IncreaseHit 增加点击量
 	IncreaseHit(hash string) error
 }
+
+// ItemQuery 列出缓存条目的查询条件
+type ItemQuery struct {
+	Prefix   string // Key前缀，为空时表示不限制
+	ServerId int64  // 服务ID，为0时表示不限制
+	Size     int    // 最多返回的数量
+}
+
+// Match 检查条目是否符合查询条件
+func (this *ItemQuery) Match(item *Item) bool {
+	if item == nil {
+		return false
+	}
+	if this.ServerId > 0 && item.ServerId != this.ServerId {
+		return false
+	}
+	return len(this.Prefix) == 0 || strings.HasPrefix(item.Key, this.Prefix)
+}
+
+// InspectableList 可以查询单个缓存条目详情的列表
+type InspectableList interface {
+	// FindItem 根据Hash查找条目，不存在时返回nil
+	FindItem(hash string) (*Item, error)
+
+	// ListItems 列出符合条件的条目，callback返回false时停止
+	ListItems(query *ItemQuery, callback func(hash string, item *Item) (goNext bool)) error
+}
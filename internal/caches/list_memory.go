@@ -400,6 +400,47 @@ func (this *MemoryList) IncreaseHit(hash string) error {
 	return nil
 }
 
+// Range 遍历所有条目，callback返回false时停止遍历
+func (this *MemoryList) Range(callback func(hash string, item *Item) (goNext bool)) {
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+
+	for _, itemMap := range this.itemMaps {
+		for hash, item := range itemMap {
+			if !callback(hash, item) {
+				return
+			}
+		}
+	}
+}
+
+// FindItem 根据Hash查找条目
+func (this *MemoryList) FindItem(hash string) (*Item, error) {
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+
+	item, ok := this.itemMaps[this.prefix(hash)][hash]
+	if !ok {
+		return nil, nil
+	}
+	var itemCopy = *item
+	return &itemCopy, nil
+}
+
+// ListItems 列出符合条件的条目
+func (this *MemoryList) ListItems(query *ItemQuery, callback func(hash string, item *Item) (goNext bool)) error {
+	var count = 0
+	this.Range(func(hash string, item *Item) (goNext bool) {
+		if !query.Match(item) {
+			return true
+		}
+		count++
+		var itemCopy = *item
+		return callback(hash, &itemCopy) && (query.Size <= 0 || count < query.Size)
+	})
+	return nil
+}
+
 func (this *MemoryList) Prefixes() []string {
 	return this.prefixes
 }
@@ -57,6 +57,47 @@ func TestMemoryList_Remove(t *testing.T) {
 	t.Log(list.Count())
 }
 
+func TestMemoryList_ListItems(t *testing.T) {
+	list := caches.NewMemoryList().(*caches.MemoryList)
+	_ = list.Init()
+	for i := 0; i < 10; i++ {
+		_ = list.Add("hash"+types.String(i), &caches.Item{
+			Key:       "https://example.com/" + types.String(i%2) + "/" + types.String(i),
+			ExpiresAt: time.Now().Unix() + 3600,
+			ServerId:  int64(i%3) + 1,
+		})
+	}
+
+	item, err := list.FindItem("hash1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item == nil || item.Key != "https://example.com/1/1" {
+		t.Fatal("item should be found")
+	}
+
+	var count = 0
+	err = list.ListItems(&caches.ItemQuery{Prefix: "https://example.com/0/", ServerId: 1}, func(hash string, item *caches.Item) (goNext bool) {
+		count++
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 { // 0, 6
+		t.Fatal("expect 2 items, but got", count)
+	}
+
+	count = 0
+	_ = list.ListItems(&caches.ItemQuery{Size: 3}, func(hash string, item *caches.Item) (goNext bool) {
+		count++
+		return true
+	})
+	if count != 3 {
+		t.Fatal("expect 3 items, but got", count)
+	}
+}
+
 func TestMemoryList_Purge(t *testing.T) {
 	list := caches.NewMemoryList().(*caches.MemoryList)
 	_ = list.Init()
@@ -24,6 +24,7 @@ func init() {
 
 	events.OnClose(func() {
 		remotelogs.Println("CACHE", "quiting cache manager")
+		SharedManager.SaveMemorySnapshots()
 		SharedManager.UpdatePolicies([]*serverconfigs.HTTPCachePolicy{})
 	})
 }
@@ -42,6 +43,8 @@ type Manager struct {
 	policyMap  map[int64]*serverconfigs.HTTPCachePolicy // policyId => []*Policy
 	storageMap map[int64]StorageInterface               // policyId => *Storage
 	locker     sync.RWMutex
+
+	snapshotOnce sync.Once
 }
 
 // NewManager 获取管理器对象
@@ -202,14 +205,10 @@ func (this *Manager) TotalDiskSize() int64 {
 		// 这里不能直接用 storage.TotalDiskSize() 相加，因为多个缓存策略缓存目录可能处在同一个分区目录下
 		fileStorage, ok := storage.(*FileStorage)
 		if ok {
-			var options = fileStorage.options // copy
-			if options != nil {
-				var dir = options.Dir // copy
-				if len(dir) == 0 {
-					continue
-				}
+			// 包括所有的缓存目录
+			for _, diskStat := range fileStorage.DiskStats() {
 				var stat = &unix.Statfs_t{}
-				err := unix.Statfs(dir, stat)
+				err := unix.Statfs(diskStat.Path, stat)
 				if err != nil {
 					continue
 				}
@@ -230,6 +229,53 @@ func (this *Manager) TotalDiskSize() int64 {
 	return total
 }
 
+// DiskStats 所有文件缓存目录的统计信息，policyId => stats
+func (this *Manager) DiskStats() map[int64][]*FileDirStat {
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+
+	var result = map[int64][]*FileDirStat{}
+	for policyId, storage := range this.storageMap {
+		fileStorage, ok := storage.(*FileStorage)
+		if ok {
+			result[policyId] = fileStorage.DiskStats()
+		}
+	}
+	return result
+}
+
+// SaveMemorySnapshots 保存所有启用了快照的内存缓存，在退出和升级前调用，每个进程只保存一次
+func (this *Manager) SaveMemorySnapshots() {
+	this.snapshotOnce.Do(func() {
+		this.locker.RLock()
+		var memoryStorages = []*MemoryStorage{}
+		for _, storage := range this.storageMap {
+			switch s := storage.(type) {
+			case *MemoryStorage:
+				memoryStorages = append(memoryStorages, s)
+			case *FileStorage:
+				// 加密存储的策略不能将内容以明文保存到快照中
+				if s.memoryStorage != nil && s.cipher.Load() == nil {
+					memoryStorages = append(memoryStorages, s.memoryStorage)
+				}
+			}
+		}
+		this.locker.RUnlock()
+
+		for _, memoryStorage := range memoryStorages {
+			if !memoryStorage.SnapshotIsOn() {
+				continue
+			}
+			count, err := memoryStorage.SaveSnapshot()
+			if err != nil {
+				remotelogs.Error("CACHE", "save memory snapshot of policy '"+types.String(memoryStorage.policy.Id)+"' failed: "+err.Error())
+				continue
+			}
+			remotelogs.Println("CACHE", "saved "+types.String(count)+" items to memory snapshot of policy '"+types.String(memoryStorage.policy.Id)+"'")
+		}
+	})
+}
+
 // TotalMemorySize 消耗的内存尺寸
 func (this *Manager) TotalMemorySize() int64 {
 	this.locker.RLock()
@@ -6,6 +6,7 @@ import (
 	fsutils "github.com/TeaOSLab/EdgeNode/internal/utils/fs"
 	rangeutils "github.com/TeaOSLab/EdgeNode/internal/utils/ranges"
 	"github.com/iwind/TeaGo/types"
+	"hash"
 	"io"
 	"os"
 )
@@ -27,6 +28,15 @@ type FileReader struct {
 	bodyOffset   int64
 
 	isClosed bool
+
+	cipher     *FileCipher       // 解密器，为nil时表示读取未加密的文件
+	decryption *fileReaderCipher // 解密状态
+
+	hasChecksum      bool        // 文件中是否带有Body校验值
+	expectedChecksum uint32      // 文件中保存的Body校验值
+	bodyHash         hash.Hash32 // 正在计算的Body校验值，为nil时表示不校验
+	bodyHashSize     int64       // 已经计算校验值的Body长度
+	readStarted      bool        // 是否已经开始通过Read()读取Body
 }
 
 func NewFileReader(fp *fsutils.File) *FileReader {
@@ -77,6 +87,14 @@ func (this *FileReader) InitAutoDiscard(autoDiscard bool) error {
 	// URL
 	var urlLength = binary.BigEndian.Uint32(buf[OffsetURLLength : OffsetURLLength+SizeURLLength])
 
+	// 文件是否加密需要和当前策略一致，否则作为不存在的缓存
+	var isEncrypted = urlLength&URLLengthFlagEncrypted > 0
+	if isEncrypted != (this.cipher != nil) {
+		return ErrNotFound
+	}
+	this.hasChecksum = urlLength&URLLengthFlagChecksum > 0 && !isEncrypted
+	urlLength &^= URLLengthFlagEncrypted | URLLengthFlagChecksum
+
 	// header
 	var headerSize = int(binary.BigEndian.Uint32(buf[OffsetHeaderLength : OffsetHeaderLength+SizeHeaderLength]))
 	if headerSize == 0 {
@@ -85,6 +103,15 @@ func (this *FileReader) InitAutoDiscard(autoDiscard bool) error {
 	this.headerSize = headerSize
 	this.headerOffset = int64(SizeMeta) + int64(urlLength)
 
+	if this.cipher != nil {
+		err := this.initEncrypted(this.headerOffset)
+		if err != nil {
+			return err
+		}
+		isOk = true
+		return nil
+	}
+
 	// body
 	this.bodyOffset = this.headerOffset + int64(headerSize)
 	var bodySize = int(binary.BigEndian.Uint64(buf[OffsetBodyLength : OffsetBodyLength+SizeBodyLength]))
@@ -143,6 +170,10 @@ func (this *FileReader) BodySize() int64 {
 }
 
 func (this *FileReader) ReadHeader(buf []byte, callback ReaderFunc) error {
+	if this.decryption != nil {
+		return this.readEncryptedHeader(buf, callback)
+	}
+
 	// 使用缓存
 	if len(this.header) > 0 && len(buf) >= len(this.header) {
 		copy(buf, this.header)
@@ -220,6 +251,10 @@ func (this *FileReader) ReadBody(buf []byte, callback ReaderFunc) error {
 		return nil
 	}
 
+	if this.decryption != nil {
+		return this.readEncryptedBody(buf, callback)
+	}
+
 	var isOk = false
 
 	defer func() {
@@ -228,16 +263,26 @@ func (this *FileReader) ReadBody(buf []byte, callback ReaderFunc) error {
 		}
 	}()
 
+	// 完整读取Body时同时校验内容，损坏的文件会被删除
+	err := this.beginBodyChecksum()
+	if err != nil {
+		return err
+	}
+
 	var offset = this.bodyOffset
 
 	// 开始读Body部分
-	_, err := this.fp.Seek(offset, io.SeekStart)
+	_, err = this.fp.Seek(offset, io.SeekStart)
 	if err != nil {
 		return err
 	}
 
 	for {
 		n, err := this.fp.Read(buf)
+		e := this.updateBodyChecksum(buf[:n], err == io.EOF)
+		if e != nil {
+			return e
+		}
 		if n > 0 {
 			goNext, e := callback(n)
 			if e != nil {
@@ -245,6 +290,7 @@ func (this *FileReader) ReadBody(buf []byte, callback ReaderFunc) error {
 				return e
 			}
 			if !goNext {
+				this.bodyHash = nil
 				break
 			}
 		}
@@ -268,15 +314,68 @@ func (this *FileReader) Read(buf []byte) (n int, err error) {
 		return
 	}
 
+	if this.decryption != nil {
+		return this.readEncrypted(buf)
+	}
+
+	// 从Body开头读取时同时校验内容
+	if this.hasChecksum && !this.readStarted {
+		this.readStarted = true
+		err = this.beginReadChecksum()
+		if err != nil {
+			_ = this.discard()
+			return
+		}
+	}
+
 	n, err = this.fp.Read(buf)
 	if err != nil && err != io.EOF {
 		_ = this.discard()
+		return
+	}
+
+	checksumErr := this.updateBodyChecksum(buf[:n], err == io.EOF)
+	if checksumErr != nil {
+		_ = this.discard()
+		return 0, checksumErr
 	}
 
 	return
 }
 
+// 在当前位置为Body开头时开始校验，读取校验值之后恢复读取位置
+func (this *FileReader) beginReadChecksum() error {
+	offset, err := this.fp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if offset != this.bodyOffset {
+		return nil
+	}
+
+	err = this.beginBodyChecksum()
+	if err != nil {
+		return err
+	}
+	_, err = this.fp.Seek(offset, io.SeekStart)
+	return err
+}
+
 func (this *FileReader) ReadBodyRange(buf []byte, start int64, end int64, callback ReaderFunc) error {
+	if this.decryption != nil {
+		var offset = start
+		if start < 0 {
+			offset = this.bodySize + end
+			end = this.bodySize - 1
+		} else if end < 0 || end >= this.bodySize {
+			end = this.bodySize - 1
+		}
+		if offset < 0 || end < 0 || offset > end {
+			return ErrInvalidRange
+		}
+		return this.readEncryptedRange(buf, offset, end, callback)
+	}
+
 	var isOk = false
 
 	defer func() {
@@ -361,6 +460,7 @@ func (this *FileReader) Close() error {
 		return nil
 	}
 	this.isClosed = true
+	this.releaseDecryption()
 
 	if this.openFileCache != nil {
 		if this.openFile != nil {
@@ -388,6 +488,7 @@ func (this *FileReader) readToBuff(fp *fsutils.File, buf []byte) (ok bool, err e
 func (this *FileReader) discard() error {
 	_ = this.fp.Close()
 	this.isClosed = true
+	this.releaseDecryption()
 
 	// close open file cache
 	if this.openFileCache != nil {
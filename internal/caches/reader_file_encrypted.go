@@ -0,0 +1,248 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"encoding/binary"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/bytepool"
+	"io"
+)
+
+const maxEncryptedChunkSize = 16 << 20
+
+// 解密读取相关状态
+type fileReaderCipher struct {
+	noncePrefix []byte
+	chunkSize   int64
+	countChunks int64
+
+	chunkBuf   *bytepool.Buf
+	chunkIndex int64  // 当前已解密的数据块
+	chunkData  []byte // 当前已解密的数据块内容
+
+	readOffset int64 // Read()读取到的Body位置
+}
+
+// 初始化加密文件，offset为加密头部所在位置
+// 会同时校验文件尺寸、Header和第一个数据块，以便于尽早发现损坏的文件
+func (this *FileReader) initEncrypted(offset int64) error {
+	var encryptionHeader = make([]byte, SizeEncryptionHeader)
+	_, err := this.fp.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = io.ReadFull(this.fp, encryptionHeader)
+	if err != nil {
+		return ErrCacheCorrupted
+	}
+
+	var chunkSize = int64(binary.BigEndian.Uint32(encryptionHeader[SizeEncryptionNoncePrefix:]))
+	if chunkSize <= 0 || chunkSize > maxEncryptedChunkSize {
+		return ErrCacheCorrupted
+	}
+
+	var overhead = int64(this.cipher.Overhead())
+	var bodySize = int64(binary.BigEndian.Uint64(this.meta[OffsetBodyLength : OffsetBodyLength+SizeBodyLength]))
+	if bodySize < 0 {
+		return ErrCacheCorrupted
+	}
+
+	this.headerOffset = offset + SizeEncryptionHeader
+	this.bodyOffset = this.headerOffset + int64(this.headerSize) + overhead
+	this.bodySize = bodySize
+	this.decryption = &fileReaderCipher{
+		noncePrefix: encryptionHeader[:SizeEncryptionNoncePrefix],
+		chunkSize:   chunkSize,
+		countChunks: (bodySize + chunkSize - 1) / chunkSize,
+		chunkIndex:  -1,
+	}
+
+	// 检查文件尺寸，防止文件被截断
+	stat, err := this.fp.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() != this.bodyOffset+this.cipher.SealedSize(bodySize, int(chunkSize)) {
+		return ErrCacheCorrupted
+	}
+
+	// 解密Header
+	var header = make([]byte, int64(this.headerSize)+overhead)
+	_, err = this.fp.Seek(this.headerOffset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = io.ReadFull(this.fp, header)
+	if err != nil {
+		return ErrCacheCorrupted
+	}
+	this.header, err = this.cipher.open(header, this.decryption.noncePrefix, fileCipherHeaderCounter, nil)
+	if err != nil {
+		return err
+	}
+
+	// 解密第一个数据块
+	if bodySize > 0 {
+		_, err = this.readChunk(0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 读取并解密某个数据块
+func (this *FileReader) readChunk(index int64) ([]byte, error) {
+	var d = this.decryption
+	if d.chunkData != nil && d.chunkIndex == index {
+		return d.chunkData, nil
+	}
+	if index < 0 || index >= d.countChunks {
+		return nil, ErrInvalidRange
+	}
+
+	var overhead = int64(this.cipher.Overhead())
+	var plainSize = d.chunkSize
+	var isLast = index == d.countChunks-1
+	if isLast {
+		plainSize = this.bodySize - index*d.chunkSize
+	}
+
+	if d.chunkBuf == nil {
+		d.chunkBuf = this.cipher.getBuf()
+	}
+	var buf = d.chunkBuf.Bytes
+	if int64(len(buf)) < plainSize+overhead {
+		// 数据块尺寸和当前加密器不同
+		this.cipher.putBuf(d.chunkBuf)
+		d.chunkBuf = &bytepool.Buf{Bytes: make([]byte, plainSize+overhead)}
+		buf = d.chunkBuf.Bytes
+	}
+	var sealed = buf[:plainSize+overhead]
+
+	d.chunkData = nil
+	_, err := this.fp.Seek(this.bodyOffset+index*(d.chunkSize+overhead), io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.ReadFull(this.fp, sealed)
+	if err != nil {
+		return nil, ErrCacheCorrupted
+	}
+
+	data, err := this.cipher.open(sealed, d.noncePrefix, uint32(index+1), fileCipherChunkAAD(isLast))
+	if err != nil {
+		return nil, err
+	}
+	d.chunkIndex = index
+	d.chunkData = data
+	return data, nil
+}
+
+func (this *FileReader) readEncryptedHeader(buf []byte, callback ReaderFunc) error {
+	this.decryption.readOffset = 0
+
+	var header = this.header
+	for len(header) > 0 {
+		var n = copy(buf, header)
+		header = header[n:]
+		goNext, err := callback(n)
+		if err != nil {
+			return err
+		}
+		if !goNext {
+			break
+		}
+	}
+	return nil
+}
+
+func (this *FileReader) readEncryptedBody(buf []byte, callback ReaderFunc) error {
+	return this.readEncryptedRange(buf, 0, this.bodySize-1, callback)
+}
+
+// 读取某个范围内的内容，start和end都是Body中的明文位置
+func (this *FileReader) readEncryptedRange(buf []byte, start int64, end int64, callback ReaderFunc) error {
+	var isOk = false
+
+	defer func() {
+		if !isOk {
+			_ = this.discard()
+		}
+	}()
+
+	var d = this.decryption
+	var offset = start
+	for offset <= end {
+		var index = offset / d.chunkSize
+		data, err := this.readChunk(index)
+		if err != nil {
+			return err
+		}
+
+		data = data[offset-index*d.chunkSize:]
+		if int64(len(data)) > end-offset+1 {
+			data = data[:end-offset+1]
+		}
+		offset += int64(len(data))
+
+		for len(data) > 0 {
+			var n = copy(buf, data)
+			data = data[n:]
+			goNext, e := callback(n)
+			if e != nil {
+				isOk = true
+				return e
+			}
+			if !goNext {
+				isOk = true
+				return nil
+			}
+		}
+	}
+
+	isOk = true
+	return nil
+}
+
+func (this *FileReader) readEncrypted(buf []byte) (n int, err error) {
+	var d = this.decryption
+	if d.readOffset >= this.bodySize {
+		return 0, io.EOF
+	}
+
+	var index = d.readOffset / d.chunkSize
+	data, err := this.readChunk(index)
+	if err != nil {
+		_ = this.discard()
+		return 0, err
+	}
+
+	n = copy(buf, data[d.readOffset-index*d.chunkSize:])
+	d.readOffset += int64(n)
+	return n, nil
+}
+
+// 校验所有数据块
+func (this *FileReader) verifyEncrypted() error {
+	for i := int64(0); i < this.decryption.countChunks; i++ {
+		_, err := this.readChunk(i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *FileReader) releaseDecryption() {
+	var d = this.decryption
+	if d != nil && d.chunkBuf != nil {
+		// 只放回从缓冲池中获取的数据
+		if len(d.chunkBuf.Bytes) == this.cipher.bufPool.Length() {
+			this.cipher.putBuf(d.chunkBuf)
+		}
+		d.chunkBuf = nil
+		d.chunkData = nil
+	}
+}
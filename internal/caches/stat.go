@@ -4,4 +4,6 @@ type Stat struct {
 	Count     int   // 数量
 	ValueSize int64 // 值占用的空间
 	Size      int64 // 占用的空间尺寸
+
+	Admission *AdmissionStat // 准入统计，没有启用准入过滤器时为nil
 }
@@ -35,6 +35,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -102,12 +103,17 @@ type FileStorage struct {
 
 	ignoreKeys *setutils.FixedSet
 
+	admissionFilter atomic.Pointer[AdmissionFilter] // 准入过滤器，可能在修改策略时被替换
+	cipher          atomic.Pointer[FileCipher]      // 缓存文件加密器，为nil时表示不加密
+	checksumEnabled atomic.Bool                     // 是否为未加密的缓存文件写入Body校验值
+
 	openFileCache *OpenFileCache
 
 	mainDiskIsFull    bool
 	mainDiskTotalSize uint64
 
-	subDirs []*FileDir
+	dirState    atomic.Pointer[fileDirState] // 缓存目录，修改策略时整体替换
+	probeTicker *utils.Ticker
 }
 
 func NewFileStorage(policy *serverconfigs.HTTPCachePolicy) *FileStorage {
@@ -166,6 +172,7 @@ func (this *FileStorage) CanUpdatePolicy(newPolicy *serverconfigs.HTTPCachePolic
 // UpdatePolicy 修改策略
 func (this *FileStorage) UpdatePolicy(newPolicy *serverconfigs.HTTPCachePolicy) {
 	var oldOpenFileCache = this.options.OpenFileCache
+	var oldPolicyOptions = this.policy.Options
 
 	this.policy = newPolicy
 
@@ -188,7 +195,7 @@ func (this *FileStorage) UpdatePolicy(newPolicy *serverconfigs.HTTPCachePolicy)
 			IsFull:   false,
 		})
 	}
-	this.subDirs = subDirs
+	this.initDirs(subDirs)
 	this.checkDiskSpace()
 
 	err = newOptions.Init()
@@ -228,6 +235,24 @@ func (this *FileStorage) UpdatePolicy(newPolicy *serverconfigs.HTTPCachePolicy)
 
 	// reset ignored keys
 	this.ignoreKeys.Reset()
+
+	// 准入过滤器
+	if admissionOptionsKey(oldPolicyOptions) != admissionOptionsKey(newPolicy.Options) {
+		this.storeAdmissionFilter(NewAdmissionFilterWithOptions(newPolicy.Options))
+	}
+
+	// 加密
+	// 开关或者密钥变化之后，原有的缓存文件在读取时会被当做不存在的缓存
+	fileCipher, cipherErr := NewFileCipherWithOptions(newPolicy.Options)
+	if cipherErr != nil {
+		remotelogs.Error("CACHE", "update policy '"+types.String(this.policy.Id)+"' failed: init encryption failed: "+cipherErr.Error())
+	} else if !fileCipher.Equal(this.cipher.Load()) {
+		this.cipher.Store(fileCipher)
+		this.logEncryption(fileCipher)
+	}
+
+	// Body校验值，只影响之后写入的文件
+	this.checksumEnabled.Store(checksumEnabledWithOptions(newPolicy.Options))
 }
 
 // Init 初始化
@@ -248,6 +273,14 @@ func (this *FileStorage) Init() error {
 		return err
 	}
 	this.options = options
+	this.storeAdmissionFilter(NewAdmissionFilterWithOptions(this.policy.Options))
+	fileCipher, err := NewFileCipherWithOptions(this.policy.Options)
+	if err != nil {
+		return fmt.Errorf("init encryption failed: %w", err)
+	}
+	this.cipher.Store(fileCipher)
+	this.logEncryption(fileCipher)
+	this.checksumEnabled.Store(checksumEnabledWithOptions(this.policy.Options))
 
 	if !filepath.IsAbs(this.options.Dir) {
 		this.options.Dir = Tea.Root + Tea.DS + this.options.Dir
@@ -264,7 +297,7 @@ func (this *FileStorage) Init() error {
 			IsFull:   false,
 		})
 	}
-	this.subDirs = subDirs
+	this.initDirs(subDirs)
 	if len(subDirs) > 0 {
 		this.checkDiskSpace()
 	}
@@ -368,6 +401,12 @@ func (this *FileStorage) openReader(key string, allowMemory bool, useStale bool,
 		allowMemory = false
 	}
 
+	// 加密存储时不支持区间缓存
+	var fileCipher = this.cipher.Load()
+	if fileCipher != nil && isPartial {
+		return nil, ErrNotFound
+	}
+
 	// 先尝试内存缓存
 	var memoryStorage = this.memoryStorage
 	if allowMemory && memoryStorage != nil {
@@ -377,7 +416,8 @@ func (this *FileStorage) openReader(key string, allowMemory bool, useStale bool,
 		}
 	}
 
-	hash, path, _ := this.keyPath(key)
+	var hash = stringutil.Md5(key)
+	var path = this.readHashPath(hash)
 
 	// 检查文件记录是否已过期
 	var estimatedSize int64
@@ -395,7 +435,7 @@ func (this *FileStorage) openReader(key string, allowMemory bool, useStale bool,
 	}
 
 	// 尝试通过MMAP读取
-	if estimatedSize > 0 {
+	if estimatedSize > 0 && fileCipher == nil {
 		reader, err := this.tryMMAPReader(isPartial, estimatedSize, path)
 		if err != nil {
 			return nil, err
@@ -408,10 +448,15 @@ func (this *FileStorage) openReader(key string, allowMemory bool, useStale bool,
 	var isOk = false
 	var openFile *OpenFile
 	var openFileCache = this.openFileCache // 因为中间可能有修改，所以先赋值再获取
+	if fileCipher != nil {
+		// 缓存的文件句柄中包含未解密的Header，所以不使用
+		openFileCache = nil
+	}
 	if openFileCache != nil {
 		openFile = openFileCache.Get(path)
 	}
 	var fp *os.File
+	var movedFromPath string // 需要迁移的文件
 
 	var err error
 	if openFile == nil {
@@ -419,12 +464,28 @@ func (this *FileStorage) openReader(key string, allowMemory bool, useStale bool,
 			fsutils.ReaderLimiter.Ack()
 		}
 		fp, err = os.OpenFile(path, os.O_RDONLY, 0444)
+		if err != nil && os.IsNotExist(err) {
+			// 在其他目录中查找尚未迁移的文件
+			var movedPath = this.findMovedHashPath(hash, path)
+			if len(movedPath) > 0 {
+				path = movedPath
+				fp, err = os.OpenFile(path, os.O_RDONLY, 0444)
+				if err == nil && !isPartial {
+					movedFromPath = path
+				}
+			}
+		}
 		if existInList {
 			fsutils.ReaderLimiter.Release()
 		}
 		if err != nil {
 			if !os.IsNotExist(err) {
-				return nil, err
+				if this.loadDirState().ring == nil {
+					return nil, err
+				}
+
+				// 有多个目录时跳过出错的目录
+				this.markDirError(path, err)
 			}
 			return nil, ErrNotFound
 		}
@@ -448,11 +509,17 @@ func (this *FileStorage) openReader(key string, allowMemory bool, useStale bool,
 		var fileReader = NewFileReader(fsutils.NewFile(fp, fsutils.FlagRead))
 		fileReader.openFile = openFile
 		fileReader.openFileCache = openFileCache
+		fileReader.cipher = fileCipher
 		reader = fileReader
 	}
 
 	err = reader.Init()
 	if err != nil {
+		// 损坏的文件作为不存在的缓存，文件会被删除
+		if errors.Is(err, ErrCacheCorrupted) {
+			remotelogs.Warn("CACHE", "cache file '"+path+"' of policy '"+types.String(this.policy.Id)+"' is corrupted, removed")
+			return nil, ErrNotFound
+		}
 		return nil, err
 	}
 
@@ -462,12 +529,24 @@ func (this *FileStorage) openReader(key string, allowMemory bool, useStale bool,
 		this.increaseHit(key, hash, reader)
 	}
 
+	// 迁移到当前应该存放的目录
+	if len(movedFromPath) > 0 {
+		this.moveCacheFileAsync(key, hash, movedFromPath)
+	}
+
 	isOk = true
 	return reader, nil
 }
 
 // OpenWriter 打开缓存文件等待写入
 func (this *FileStorage) OpenWriter(key string, expiresAt int64, status int, headerSize int, bodySize int64, maxSize int64, isPartial bool) (Writer, error) {
+	// 准入检查
+	// 分区内容会为同一个Key多次打开写入器，所以不做检查
+	var admissionFilter = this.loadAdmissionFilter()
+	if admissionFilter != nil && !isPartial && !admissionFilter.Admit(key) {
+		return nil, ErrNotAdmitted
+	}
+
 	return this.openWriter(key, expiresAt, status, headerSize, bodySize, maxSize, isPartial, false)
 }
 
@@ -487,6 +566,12 @@ func (this *FileStorage) openWriter(key string, expiredAt int64, status int, hea
 		return nil, ErrEntityTooLarge
 	}
 
+	// 加密存储时不支持区间缓存
+	var fileCipher = this.cipher.Load()
+	if fileCipher != nil && isPartial {
+		return nil, ErrWritingUnavailable
+	}
+
 	// 检查磁盘是否超出容量
 	// 需要在内存缓存之前执行，避免成功写进到了内存缓存，但无法刷到磁盘
 	var capacityBytes = this.diskCapacityBytes()
@@ -644,6 +729,7 @@ func (this *FileStorage) openWriter(key string, expiredAt int64, status int, hea
 			fsutils.WriterLimiter.Release()
 		}
 		if err != nil {
+			this.markDirError(tmpPath, err)
 			return nil, err
 		}
 	}
@@ -681,6 +767,8 @@ func (this *FileStorage) openWriter(key string, expiredAt int64, status int, hea
 
 	var metaBodySize int64 = -1
 	var metaHeaderSize = -1
+	var encryptionHeader []byte
+	var hasChecksum = false
 	if isNewCreated {
 		// 写入meta
 		// 从v0.5.8开始不再在meta中写入Key
@@ -705,6 +793,20 @@ func (this *FileStorage) openWriter(key string, expiredAt int64, status int, hea
 			metaBodySize = bodySize
 		}
 
+		// 加密标记和加密头部，启用校验值的未加密文件预留Body校验值的位置
+		if fileCipher != nil {
+			binary.BigEndian.PutUint32(metaBytes[OffsetURLLength:], URLLengthFlagEncrypted)
+			encryptionHeader, err = fileCipher.newEncryptionHeader()
+			if err != nil {
+				return nil, err
+			}
+			metaBytes = append(metaBytes, encryptionHeader...)
+		} else if !isPartial && this.checksumEnabled.Load() {
+			binary.BigEndian.PutUint32(metaBytes[OffsetURLLength:], URLLengthFlagChecksum|SizeChecksum)
+			metaBytes = append(metaBytes, make([]byte, SizeChecksum)...)
+			hasChecksum = true
+		}
+
 		_, err = writer.Write(metaBytes)
 		if err != nil {
 			return nil, err
@@ -719,11 +821,17 @@ func (this *FileStorage) openWriter(key string, expiredAt int64, status int, hea
 			sharedWritingFileKeyLocker.Unlock()
 		}), nil
 	} else {
-		return NewFileWriter(this, writer, key, expiredAt, metaHeaderSize, metaBodySize, maxSize, func() {
+		var fileWriter = NewFileWriter(this, writer, key, expiredAt, metaHeaderSize, metaBodySize, maxSize, func() {
 			sharedWritingFileKeyLocker.Lock()
 			delete(sharedWritingFileKeyMap, key)
 			sharedWritingFileKeyLocker.Unlock()
-		}), nil
+		})
+		if fileCipher != nil {
+			fileWriter.initCipher(fileCipher, encryptionHeader[:SizeEncryptionNoncePrefix])
+		} else if hasChecksum {
+			fileWriter.initChecksum()
+		}
+		return fileWriter, nil
 	}
 }
 
@@ -762,12 +870,12 @@ func (this *FileStorage) Delete(key string) error {
 		_ = memoryStorage.Delete(key)
 	})
 
-	hash, path, _ := this.keyPath(key)
+	var hash = stringutil.Md5(key)
 	err := this.list.Remove(hash)
 	if err != nil {
 		return err
 	}
-	err = this.removeCacheFile(path)
+	err = this.removeHashFiles(hash)
 	if err == nil || os.IsNotExist(err) {
 		return nil
 	}
@@ -777,9 +885,40 @@ func (this *FileStorage) Delete(key string) error {
 
 // Stat 统计
 func (this *FileStorage) Stat() (*Stat, error) {
-	return this.list.Stat(func(hash string) bool {
+	stat, err := this.list.Stat(func(hash string) bool {
 		return true
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	var admissionFilter = this.loadAdmissionFilter()
+	if admissionFilter != nil && stat != nil {
+		stat.Admission = admissionFilter.Stat()
+	}
+	return stat, nil
+}
+
+// ForceAdmission 让某个Key下一次写入时跳过准入检查，用于预热等主动写入缓存的场合
+func (this *FileStorage) ForceAdmission(key string) {
+	var admissionFilter = this.loadAdmissionFilter()
+	if admissionFilter != nil {
+		admissionFilter.Force(key)
+	}
+}
+
+// 设置准入过滤器
+func (this *FileStorage) storeAdmissionFilter(admissionFilter AdmissionFilter) {
+	this.admissionFilter.Store(&admissionFilter)
+}
+
+// 读取当前的准入过滤器
+func (this *FileStorage) loadAdmissionFilter() AdmissionFilter {
+	var ptr = this.admissionFilter.Load()
+	if ptr == nil {
+		return nil
+	}
+	return *ptr
 }
 
 // CleanAll 清除所有的缓存
@@ -801,7 +940,7 @@ func (this *FileStorage) CleanAll() error {
 	// 不能直接删除子目录，比较危险
 
 	var rootDirs = []string{this.options.Dir}
-	var subDirs = this.subDirs // copy slice
+	var subDirs = this.loadDirState().subDirs
 	if len(subDirs) > 0 {
 		for _, subDir := range subDirs {
 			rootDirs = append(rootDirs, subDir.Path)
@@ -924,8 +1063,8 @@ func (this *FileStorage) Purge(keys []string, urlType string) error {
 		}
 
 		// 普通的Key
-		hash, path, _ := this.keyPath(key)
-		err := this.removeCacheFile(path)
+		var hash = stringutil.Md5(key)
+		err := this.removeHashFiles(hash)
 		if err != nil && !os.IsNotExist(err) {
 			return err
 		}
@@ -960,6 +1099,9 @@ func (this *FileStorage) Stop() {
 	if this.hotTicker != nil {
 		this.hotTicker.Stop()
 	}
+	if this.probeTicker != nil {
+		this.probeTicker.Stop()
+	}
 
 	if this.list != nil {
 		_ = this.list.Close()
@@ -1001,6 +1143,11 @@ func (this *FileStorage) CanSendfile() bool {
 	if this.options == nil {
 		return false
 	}
+
+	// 加密的文件需要解密后才能发送，带校验值的文件需要读取时校验
+	if this.cipher.Load() != nil || this.checksumEnabled.Load() {
+		return false
+	}
 	return this.options.EnableSendfile
 }
 
@@ -1055,6 +1202,14 @@ func (this *FileStorage) initList() error {
 		}
 	})
 
+	// 检查缓存目录是否可以读写
+	this.probeTicker = utils.NewTicker(FileDirProbeInterval * time.Second)
+	goman.New(func() {
+		for this.probeTicker.Next() {
+			this.probeDirs()
+		}
+	})
+
 	// 退出时停止
 	events.OnKey(events.EventQuit, this, func() {
 		remotelogs.Println("CACHE", "quit clean timer")
@@ -1071,6 +1226,12 @@ func (this *FileStorage) initList() error {
 				ticker.Stop()
 			}
 		}
+		{
+			var ticker = this.probeTicker
+			if ticker != nil {
+				ticker.Stop()
+			}
+		}
 	})
 
 	return nil
@@ -1157,10 +1318,9 @@ func (this *FileStorage) purgeLoop() {
 
 		for i := 0; i < times; i++ {
 			countFound, err := this.list.Purge(purgeCount, func(hash string) error {
-				path, _ := this.hashPath(hash)
-				err := this.removeCacheFile(path)
+				err := this.removeHashFiles(hash)
 				if err != nil && !os.IsNotExist(err) {
-					remotelogs.Error("CACHE", "purge '"+path+"' error: "+err.Error())
+					remotelogs.Error("CACHE", "purge '"+hash+"' error: "+err.Error())
 				}
 
 				return nil
@@ -1214,10 +1374,9 @@ func (this *FileStorage) purgeLoop() {
 
 				var before = time.Now()
 				err := this.list.PurgeLFU(count, func(hash string) error {
-					path, _ := this.hashPath(hash)
-					err := this.removeCacheFile(path)
+					err := this.removeHashFiles(hash)
 					if err != nil && !os.IsNotExist(err) {
-						remotelogs.Error("CACHE", "purge '"+path+"' error: "+err.Error())
+						remotelogs.Error("CACHE", "purge '"+hash+"' error: "+err.Error())
 					}
 
 					return nil
@@ -1393,7 +1552,7 @@ func (this *FileStorage) diskCapacityBytes() int64 {
 // remove all *.trash directories under policy directory
 func (this *FileStorage) cleanAllDeletedDirs() {
 	var rootDirs = []string{this.options.Dir}
-	var subDirs = this.subDirs // copy slice
+	var subDirs = this.loadDirState().subDirs
 	if len(subDirs) > 0 {
 		for _, subDir := range subDirs {
 			rootDirs = append(rootDirs, subDir.Path)
@@ -1616,7 +1775,12 @@ func (this *FileStorage) checkDiskSpace() {
 			}
 		}
 	}
-	var subDirs = this.subDirs // copy slice
+	var mainDir = this.loadDirState().mainDir
+	if mainDir != nil {
+		mainDir.IsFull = this.mainDiskIsFull
+	}
+
+	var subDirs = this.loadDirState().subDirs
 	for _, subDir := range subDirs {
 		stat, err := fsutils.StatDevice(subDir.Path)
 		if err == nil {
@@ -1631,7 +1795,7 @@ func (this *FileStorage) hasFullDisk() bool {
 
 	var hasFullDisk = this.mainDiskIsFull
 	if !hasFullDisk {
-		var subDirs = this.subDirs // copy slice
+		var subDirs = this.loadDirState().subDirs
 		for _, subDir := range subDirs {
 			if subDir.IsFull {
 				hasFullDisk = true
@@ -1646,33 +1810,21 @@ func (this *FileStorage) hasFullDisk() bool {
 func (this *FileStorage) subDir(hash string) (dirPath string, dirIsFull bool) {
 	var suffix = "/p" + types.String(this.policy.Id) + "/" + hash[:2] + "/" + hash[2:4]
 
-	if len(hash) < 4 {
-		return this.options.Dir + suffix, this.mainDiskIsFull
-	}
-
-	var subDirs = this.subDirs // copy slice
-	var countSubDirs = len(subDirs)
-	if countSubDirs == 0 {
+	var dirRing = this.loadDirState().ring
+	if len(hash) < 4 || dirRing == nil {
 		return this.options.Dir + suffix, this.mainDiskIsFull
 	}
 
-	countSubDirs++ // add main dir
-
-	// 最多只支持16个目录
-	if countSubDirs > 16 {
-		countSubDirs = 16
+	// 使用一致性Hash查找可用的目录，已满或者出错的目录会被跳过
+	var dir = dirRing.Lookup(hash)
+	if dir == nil {
+		return this.options.Dir + suffix, true
 	}
-
-	var dirIndex = this.charCode(hash[0]) % uint8(countSubDirs)
-	if dirIndex == 0 {
-		return this.options.Dir + suffix, this.mainDiskIsFull
-	}
-	var subDir = subDirs[dirIndex-1]
-	return subDir.Path + suffix, subDir.IsFull
+	return dir.Path + suffix, false
 }
 
 // ScanGarbageCaches 清理目录中“失联”的缓存文件
-// “失联”为不在HashMap中的文件
+// “失联”为不在HashMap中的文件，另外已损坏的缓存文件也会被找出
 func (this *FileStorage) ScanGarbageCaches(fileCallback func(path string) error) error {
 	_, isSQLite := this.list.(*SQLiteFileList)
 	if isSQLite && !this.list.(*SQLiteFileList).HashMapIsLoaded() {
@@ -1681,7 +1833,7 @@ func (this *FileStorage) ScanGarbageCaches(fileCallback func(path string) error)
 
 	var mainDir = this.options.Dir
 	var allDirs = []string{mainDir}
-	var subDirs = this.subDirs // copy
+	var subDirs = this.loadDirState().subDirs
 	for _, subDir := range subDirs {
 		allDirs = append(allDirs, subDir.Path)
 	}
@@ -1763,16 +1915,19 @@ func (this *FileStorage) ScanGarbageCaches(fileCallback func(path string) error)
 					}
 
 					if found {
-						continue
-					}
-
-					// 检查文件正在被写入
-					stat, statErr := os.Stat(file)
-					if statErr != nil {
-						continue
-					}
-					if fasttime.Now().Unix()-stat.ModTime().Unix() < 300 /** 5 minutes **/ {
-						continue
+						// 检查文件是否已损坏
+						if !this.isCorruptedFile(file) {
+							continue
+						}
+					} else {
+						// 检查文件正在被写入
+						stat, statErr := os.Stat(file)
+						if statErr != nil {
+							continue
+						}
+						if fasttime.Now().Unix()-stat.ModTime().Unix() < 300 /** 5 minutes **/ {
+							continue
+						}
 					}
 
 					if fileCallback != nil {
@@ -1798,13 +1953,51 @@ func (this *FileStorage) ScanGarbageCaches(fileCallback func(path string) error)
 	return nil
 }
 
-// 计算字节数字代号
-func (this *FileStorage) charCode(r byte) uint8 {
-	if r >= '0' && r <= '9' {
-		return r - '0'
+// 记录加密状态
+func (this *FileStorage) logEncryption(fileCipher *FileCipher) {
+	if fileCipher != nil {
+		remotelogs.Println("CACHE", "policy '"+types.String(this.policy.Id)+"' encrypts cache files, partial (range) caching is disabled")
 	}
-	if r >= 'a' && r <= 'z' {
-		return r - 'a' + 10
+}
+
+// 检查缓存文件是否已损坏
+// 加密的文件会校验所有数据块，未加密的文件检查文件尺寸是否和meta中的一致，并校验Body的CRC32
+func (this *FileStorage) isCorruptedFile(path string) bool {
+	// 区间缓存文件中的内容可能不完整
+	_, err := os.Stat(PartialRangesFilePath(path))
+	if err == nil {
+		return false
 	}
-	return 0
+
+	fp, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+
+	var reader = NewFileReader(fsutils.NewFile(fp, fsutils.FlagRead))
+	reader.cipher = this.cipher.Load()
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	err = reader.InitAutoDiscard(false)
+	if err != nil {
+		return true
+	}
+
+	if reader.decryption != nil {
+		return reader.verifyEncrypted() != nil
+	}
+
+	if reader.bodyOffset > 0 {
+		stat, statErr := fp.Stat()
+		if statErr != nil {
+			return false
+		}
+		if stat.Size() != reader.bodyOffset+reader.bodySize {
+			return true
+		}
+		return errors.Is(reader.verifyChecksum(), ErrCacheCorrupted)
+	}
+	return false
 }
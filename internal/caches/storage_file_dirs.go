@@ -0,0 +1,390 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"bytes"
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/goman"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	fsutils "github.com/TeaOSLab/EdgeNode/internal/utils/fs"
+	"github.com/TeaOSLab/EdgeNode/internal/zero"
+	"github.com/iwind/TeaGo/types"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 同时迁移缓存文件的最大数量
+var fileDirMigratingChan = make(chan zero.Zero, 4)
+
+// 缓存目录状态
+type fileDirState struct {
+	subDirs []*FileDir
+	mainDir *FileDir     // 有多个目录时的主目录
+	ring    *FileDirRing // 有多个目录时用来分配缓存文件
+}
+
+// 读取当前的缓存目录状态
+func (this *FileStorage) loadDirState() *fileDirState {
+	var state = this.dirState.Load()
+	if state == nil {
+		return &fileDirState{}
+	}
+	return state
+}
+
+// 初始化缓存目录，有多个目录时使用一致性Hash分配缓存文件
+// 新的目录状态构造完成后再整体替换，正在读写的请求仍然可以使用原有的状态
+func (this *FileStorage) initDirs(subDirs []*FileDir) {
+	if len(subDirs) == 0 {
+		this.dirState.Store(&fileDirState{})
+		return
+	}
+
+	// 保留原有目录的状态，容量发生变化的目录使用新的对象重新计算权重
+	var oldDirMap = map[string]*FileDir{}
+	var oldDirRing = this.loadDirState().ring
+	if oldDirRing != nil {
+		for _, dir := range oldDirRing.Dirs() {
+			oldDirMap[dir.Path] = dir
+		}
+	}
+
+	var mainDir = oldDirMap[this.options.Dir]
+	if mainDir == nil {
+		mainDir = &FileDir{
+			Path:   this.options.Dir,
+			IsFull: this.mainDiskIsFull,
+		}
+		mainDir.weight = this.fileDirWeight(mainDir)
+	}
+	var dirs = []*FileDir{mainDir}
+	for index, subDir := range subDirs {
+		var oldDir = oldDirMap[subDir.Path]
+		if oldDir != nil && fileDirCapacityBytes(oldDir) == fileDirCapacityBytes(subDir) {
+			subDirs[index] = oldDir
+			subDir = oldDir
+		} else {
+			subDir.weight = this.fileDirWeight(subDir)
+		}
+		dirs = append(dirs, subDir)
+	}
+
+	this.dirState.Store(&fileDirState{
+		subDirs: subDirs,
+		mainDir: mainDir,
+		ring:    NewFileDirRing(dirs),
+	})
+}
+
+// 读取目录设置的容量
+func fileDirCapacityBytes(dir *FileDir) int64 {
+	if dir.Capacity == nil {
+		return 0
+	}
+	return dir.Capacity.Bytes()
+}
+
+// 计算目录的权重，优先使用设置的容量，其次使用分区的尺寸
+func (this *FileStorage) fileDirWeight(dir *FileDir) uint64 {
+	if dir.Capacity != nil && dir.Capacity.Bytes() > 0 {
+		return uint64(dir.Capacity.Bytes())
+	}
+	stat, err := fsutils.StatDevice(dir.Path)
+	if err == nil {
+		return stat.TotalSize()
+	}
+	return 0
+}
+
+// 获取某个目录中Hash对应的文件路径
+func (this *FileStorage) dirHashPath(dirPath string, hash string) string {
+	return dirPath + "/p" + types.String(this.policy.Id) + "/" + hash[:2] + "/" + hash[2:4] + "/" + hash + ".cache"
+}
+
+// 获取读取Hash对应的文件时优先使用的路径
+// 和写入时不同，读取时不跳过已满的目录
+func (this *FileStorage) readHashPath(hash string) string {
+	var dirRing = this.loadDirState().ring
+	if dirRing == nil || len(hash) < 4 {
+		path, _ := this.hashPath(hash)
+		return path
+	}
+	for _, dir := range dirRing.Candidates(hash) {
+		if dir.IsHealthy() {
+			return this.dirHashPath(dir.Path, hash)
+		}
+	}
+	path, _ := this.hashPath(hash)
+	return path
+}
+
+// 在其他目录中查找Hash对应的文件，用于目录发生变化后找到尚未迁移的文件
+func (this *FileStorage) findMovedHashPath(hash string, excludingPath string) string {
+	var dirRing = this.loadDirState().ring
+	if dirRing == nil || len(hash) < 4 {
+		return ""
+	}
+	for _, candidateDir := range dirRing.Candidates(hash) {
+		if !candidateDir.IsHealthy() {
+			continue
+		}
+		var candidatePath = this.dirHashPath(candidateDir.Path, hash)
+		if candidatePath == excludingPath {
+			continue
+		}
+		_, err := os.Stat(candidatePath)
+		if err == nil {
+			return candidatePath
+		}
+	}
+	return ""
+}
+
+// 查找文件所在的目录
+func (this *FileStorage) findPathDir(path string) *FileDir {
+	var dirRing = this.loadDirState().ring
+	if dirRing == nil {
+		return nil
+	}
+	for _, dir := range dirRing.Dirs() {
+		if strings.HasPrefix(path, dir.Path+"/") {
+			return dir
+		}
+	}
+	return nil
+}
+
+// 检查各个缓存目录是否可以读写
+// 失效的目录会被停用，恢复之后重新启用
+func (this *FileStorage) probeDirs() {
+	var dirRing = this.loadDirState().ring
+	if dirRing == nil {
+		return
+	}
+
+	for _, dir := range dirRing.Dirs() {
+		var dir = dir
+		var resultChan = make(chan error, 1)
+		goman.New(func() {
+			resultChan <- this.probeDir(dir)
+		})
+
+		// 磁盘失效时读写可能会一直阻塞
+		var err error
+		select {
+		case err = <-resultChan:
+		case <-time.After(FileDirProbeTimeout * time.Second):
+			err = errors.New("probe timeout")
+		}
+
+		if err != nil {
+			if dir.Disable() {
+				remotelogs.Warn("CACHE", "cache dir '"+dir.Path+"' of policy '"+types.String(this.policy.Id)+"' is disabled because it is not writable: "+err.Error())
+			}
+		} else if dir.Enable() {
+			remotelogs.Println("CACHE", "cache dir '"+dir.Path+"' of policy '"+types.String(this.policy.Id)+"' is enabled again")
+		}
+	}
+}
+
+// 在目录中写入并读取一个临时文件
+func (this *FileStorage) probeDir(dir *FileDir) error {
+	var probeDir = dir.Path + "/p" + types.String(this.policy.Id)
+	err := os.MkdirAll(probeDir, 0777)
+	if err != nil {
+		return err
+	}
+
+	var path = probeDir + "/.probe"
+	var data = []byte(types.String(time.Now().UnixNano()))
+	err = os.WriteFile(path, data, 0666)
+	if err != nil {
+		return err
+	}
+	readData, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(readData, data) {
+		return errors.New("probe file content mismatch")
+	}
+	return os.Remove(path)
+}
+
+// 记录目录的I/O错误，错误过多时暂时停用该目录
+func (this *FileStorage) markDirError(path string, err error) {
+	var dir = this.findPathDir(path)
+	if dir == nil {
+		return
+	}
+	if dir.MarkError() {
+		remotelogs.Warn("CACHE", "cache dir '"+dir.Path+"' of policy '"+types.String(this.policy.Id)+"' is disabled for "+types.String(FileDirDisabledSeconds)+" seconds because of I/O errors: "+err.Error())
+	}
+}
+
+// 删除Hash对应的缓存文件，包括在其他目录中尚未迁移的文件
+func (this *FileStorage) removeHashFiles(hash string) error {
+	var dirRing = this.loadDirState().ring
+	if dirRing == nil || len(hash) < 4 {
+		path, _ := this.hashPath(hash)
+		return this.removeCacheFile(path)
+	}
+
+	var lastErr error
+	for _, dir := range dirRing.Dirs() {
+		// 跳过停用的目录，防止阻塞
+		if !dir.IsHealthy() {
+			continue
+		}
+		var path = this.dirHashPath(dir.Path, hash)
+		err := this.removeCacheFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// 在后台将缓存文件迁移到当前应该存放的目录
+func (this *FileStorage) moveCacheFileAsync(key string, hash string, fromPath string) {
+	select {
+	case fileDirMigratingChan <- zero.New():
+	default:
+		// 正在迁移的文件太多，等下次读取时再迁移
+		return
+	}
+
+	goman.New(func() {
+		defer func() {
+			<-fileDirMigratingChan
+		}()
+
+		err := this.moveCacheFile(key, hash, fromPath)
+		if err != nil {
+			remotelogs.Warn("CACHE", "move cache file '"+fromPath+"' failed: "+err.Error())
+		}
+	})
+}
+
+// 将缓存文件迁移到当前应该存放的目录
+func (this *FileStorage) moveCacheFile(key string, hash string, fromPath string) error {
+	// 防止和写入冲突
+	sharedWritingFileKeyLocker.Lock()
+	_, isWriting := sharedWritingFileKeyMap[key]
+	if isWriting {
+		sharedWritingFileKeyLocker.Unlock()
+		return nil
+	}
+	sharedWritingFileKeyMap[key] = zero.New()
+	sharedWritingFileKeyLocker.Unlock()
+	defer func() {
+		sharedWritingFileKeyLocker.Lock()
+		delete(sharedWritingFileKeyMap, key)
+		sharedWritingFileKeyLocker.Unlock()
+	}()
+
+	toPath, diskIsFull := this.hashPath(hash)
+	if diskIsFull || len(toPath) == 0 || toPath == fromPath {
+		return nil
+	}
+
+	// 目标文件已经存在，则删除旧的文件
+	_, err := os.Stat(toPath)
+	if err == nil {
+		return this.removeCacheFile(fromPath)
+	}
+
+	err = os.MkdirAll(filepath.Dir(toPath), 0777)
+	if err != nil {
+		this.markDirError(toPath, err)
+		return err
+	}
+
+	// 先写入临时文件，防止读取到不完整的文件
+	var tmpPath = toPath + FileTmpSuffix
+	err = this.copyCacheFile(fromPath, tmpPath)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	err = os.Rename(tmpPath, toPath)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	return this.removeCacheFile(fromPath)
+}
+
+func (this *FileStorage) copyCacheFile(fromPath string, toPath string) error {
+	fsutils.ReaderLimiter.Ack()
+	defer fsutils.ReaderLimiter.Release()
+
+	srcFp, err := os.Open(fromPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			this.markDirError(fromPath, err)
+		}
+		return err
+	}
+	defer func() {
+		_ = srcFp.Close()
+	}()
+
+	fsutils.WriterLimiter.Ack()
+	defer fsutils.WriterLimiter.Release()
+
+	dstFp, err := os.OpenFile(toPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		this.markDirError(toPath, err)
+		return err
+	}
+
+	_, err = io.Copy(dstFp, srcFp)
+	if err != nil {
+		_ = dstFp.Close()
+		return err
+	}
+	return dstFp.Close()
+}
+
+// DiskStats 所有缓存目录的统计信息
+func (this *FileStorage) DiskStats() []*FileDirStat {
+	var dirs []*FileDir
+	var dirRing = this.loadDirState().ring
+	if dirRing != nil {
+		dirs = dirRing.Dirs()
+	} else {
+		var options = this.options // copy
+		if options == nil || len(options.Dir) == 0 {
+			return nil
+		}
+		dirs = []*FileDir{{
+			Path:   options.Dir,
+			IsFull: this.mainDiskIsFull,
+		}}
+	}
+
+	var result = []*FileDirStat{}
+	for _, dir := range dirs {
+		var stat = &FileDirStat{
+			Path:        dir.Path,
+			Weight:      dir.weight,
+			IsFull:      dir.IsFull,
+			IsHealthy:   dir.IsHealthy(),
+			CountErrors: dir.CountErrors(),
+		}
+		deviceStat, err := fsutils.StatDeviceCache(dir.Path)
+		if err == nil {
+			stat.UsedSize = int64(deviceStat.UsedSize())
+			stat.TotalSize = int64(deviceStat.TotalSize())
+		}
+		result = append(result, stat)
+	}
+	return result
+}
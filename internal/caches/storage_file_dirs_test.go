@@ -0,0 +1,75 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/iwind/TeaGo/assert"
+	"os"
+	"testing"
+)
+
+func testNewDirsStorage(t *testing.T) *FileStorage {
+	var storage = NewFileStorage(&serverconfigs.HTTPCachePolicy{
+		Id:   1,
+		IsOn: true,
+	})
+	storage.options = serverconfigs.NewHTTPFileCacheStorage()
+	storage.options.Dir = t.TempDir()
+	return storage
+}
+
+func TestFileStorage_initDirs(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var storage = testNewDirsStorage(t)
+	a.IsNil(storage.loadDirState().ring)
+
+	var dir1 = t.TempDir()
+	var dir2 = t.TempDir()
+	storage.initDirs([]*FileDir{{Path: dir1}})
+	var oldState = storage.loadDirState()
+	a.IsTrue(len(oldState.ring.Dirs()) == 2)
+
+	// 已有目录的状态会被保留，原有的状态不会被修改
+	oldState.subDirs[0].MarkError()
+	storage.initDirs([]*FileDir{{Path: dir1}, {Path: dir2}})
+	var newState = storage.loadDirState()
+	a.IsTrue(len(newState.ring.Dirs()) == 3)
+	a.IsTrue(newState.subDirs[0] == oldState.subDirs[0])
+	a.IsTrue(newState.subDirs[0].CountErrors() == 1)
+	a.IsTrue(len(oldState.ring.Dirs()) == 2)
+
+	storage.initDirs(nil)
+	a.IsNil(storage.loadDirState().ring)
+}
+
+func TestFileStorage_probeDirs(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var storage = testNewDirsStorage(t)
+
+	// 使用普通文件模拟无法写入的目录
+	var badDir = t.TempDir() + "/bad"
+	err := os.WriteFile(badDir, []byte("bad"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.initDirs([]*FileDir{{Path: badDir}})
+	var subDir = storage.loadDirState().subDirs[0]
+	a.IsTrue(subDir.IsHealthy())
+
+	storage.probeDirs()
+	a.IsFalse(subDir.IsHealthy())
+	a.IsTrue(storage.loadDirState().mainDir.IsHealthy())
+
+	// 恢复之后重新启用
+	err = os.Remove(badDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.probeDirs()
+	a.IsTrue(subDir.IsHealthy())
+	_, err = os.Stat(badDir + "/p1/.probe")
+	a.IsTrue(os.IsNotExist(err))
+}
@@ -34,7 +34,8 @@ type MemoryItem struct {
 	IsPrepared  bool
 	WriteOffset int64
 
-	isReferring bool // if it is referring by other objects
+	isReferring bool  // if it is referring by other objects
+	hits        int64 // 读取次数，用来在保存快照时挑选热门内容
 }
 
 func (this *MemoryItem) IsExpired() bool {
@@ -100,6 +101,11 @@ func (this *MemoryStorage) Init() error {
 
 	this.initPurgeTicker()
 
+	// 从快照中恢复
+	goman.New(func() {
+		this.loadSnapshotIfOn()
+	})
+
 	// 启动定时Flush memory to disk任务
 	if this.parentStorage != nil {
 		var threads = 2
@@ -141,6 +147,7 @@ func (this *MemoryStorage) OpenReader(key string, useStale bool, isPartial bool)
 
 	if item != nil {
 		item.isReferring = true
+		atomic.AddInt64(&item.hits, 1)
 	}
 
 	if item == nil || !item.IsDone {
@@ -0,0 +1,383 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/fasttime"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/types"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+// 内存缓存快照
+//
+//	文件结构：
+//	[magic] | [record] ... | [0]
+//	record: [payload length uint32] | [payload] | [crc32 of payload uint32]
+//	payload: [expires at] | [stale at] | [modified at] | [server id] | [status] | [key length] | [header length] | [body length] | [key] [header] [body]
+
+const (
+	memorySnapshotMagic          = "GOEDGE_MEMORY_SNAPSHOT_1\n"
+	memorySnapshotPayloadMetaLen = 8*4 + 4 + 4 + 4 + 8
+
+	DefaultMemorySnapshotMaxSize int64 = 1 << 30 // 快照文件默认最大尺寸
+)
+
+var errInvalidMemorySnapshot = errors.New("invalid memory snapshot")
+
+// SnapshotIsOn 是否启用了快照
+// 通过缓存策略选项 memorySnapshot 启用，memorySnapshotMaxSize 可以设置快照中内容的最大尺寸
+func (this *MemoryStorage) SnapshotIsOn() bool {
+	var policy = this.policy // copy
+	return policy != nil && policy.Options != nil && types.Bool(policy.Options["memorySnapshot"])
+}
+
+// SnapshotPath 快照文件路径
+// 快照中包含完整的响应内容，所以放在单独的目录中，目录和文件只允许当前用户访问
+func (this *MemoryStorage) SnapshotPath() string {
+	return Tea.Root + "/data/cache-memory-snapshots/p" + types.String(this.policy.Id) + ".snapshot"
+}
+
+// SaveSnapshot 将最热门的内容保存到快照文件中
+func (this *MemoryStorage) SaveSnapshot() (count int, err error) {
+	var maxSize = types.Int64(this.policy.Options["memorySnapshotMaxSize"])
+	if maxSize <= 0 {
+		maxSize = DefaultMemorySnapshotMaxSize
+	}
+
+	type snapshotItem struct {
+		item       *Item
+		memoryItem *MemoryItem
+		hits       int64
+	}
+
+	var memoryList, ok = this.list.(*MemoryList)
+	if !ok {
+		return 0, errors.New("unsupported list type")
+	}
+
+	// 挑选没有过期的内容
+	var now = fasttime.Now().Unix()
+	var snapshotItems = []*snapshotItem{}
+	this.locker.RLock()
+	memoryList.Range(func(hash string, item *Item) (goNext bool) {
+		if item.ExpiresAt <= now {
+			return true
+		}
+		uintHash, parseErr := strconv.ParseUint(hash, 10, 64)
+		if parseErr != nil {
+			return true
+		}
+		memoryItem, exists := this.valuesMap[uintHash]
+		if !exists || !memoryItem.IsDone || memoryItem.IsExpired() {
+			return true
+		}
+		snapshotItems = append(snapshotItems, &snapshotItem{
+			item:       item,
+			memoryItem: memoryItem,
+			hits:       atomic.LoadInt64(&memoryItem.hits),
+		})
+		return true
+	})
+	this.locker.RUnlock()
+
+	// 按读取次数从高到低排序
+	sort.Slice(snapshotItems, func(i, j int) bool {
+		return snapshotItems[i].hits > snapshotItems[j].hits
+	})
+
+	var path = this.SnapshotPath()
+	var dir = filepath.Dir(path)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return 0, err
+	}
+	err = os.Chmod(dir, 0700)
+	if err != nil {
+		return 0, err
+	}
+
+	var tmpPath = path + ".tmp"
+	fp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+	var isOk = false
+	defer func() {
+		if !isOk {
+			_ = fp.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	// 已经存在的临时文件不会因为 O_TRUNC 而修改权限
+	err = fp.Chmod(0600)
+	if err != nil {
+		return 0, err
+	}
+
+	var writer = bufio.NewWriterSize(fp, 256<<10)
+	_, err = writer.WriteString(memorySnapshotMagic)
+	if err != nil {
+		return 0, err
+	}
+
+	var totalSize int64
+	var payload []byte
+	for _, snapshotItem := range snapshotItems {
+		var item = snapshotItem.item
+		var memoryItem = snapshotItem.memoryItem
+		var size = int64(len(item.Key) + len(memoryItem.HeaderValue) + len(memoryItem.BodyValue))
+		if totalSize+size > maxSize {
+			continue
+		}
+		totalSize += size
+
+		payload = encodeMemorySnapshotPayload(payload[:0], item, memoryItem)
+		err = writeMemorySnapshotRecord(writer, payload)
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	// 结束标记
+	_, err = writer.Write([]byte{0, 0, 0, 0})
+	if err != nil {
+		return 0, err
+	}
+	err = writer.Flush()
+	if err != nil {
+		return 0, err
+	}
+	err = fp.Sync()
+	if err != nil {
+		return 0, err
+	}
+	err = fp.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return 0, err
+	}
+
+	isOk = true
+	return count, nil
+}
+
+// LoadSnapshot 从快照文件中恢复内容，已经过期的内容会被丢弃
+// 恢复之后会删除快照文件，防止异常退出后重复读取旧的内容
+func (this *MemoryStorage) LoadSnapshot() (count int, err error) {
+	// 旧版本的快照文件放在data目录中并且所有用户可读，直接删除
+	_ = os.Remove(Tea.Root + "/data/cache-memory-p" + types.String(this.policy.Id) + ".snapshot")
+
+	var path = this.SnapshotPath()
+	fp, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer func() {
+		_ = fp.Close()
+		_ = os.Remove(path)
+	}()
+
+	var reader = bufio.NewReaderSize(fp, 256<<10)
+	var magic = make([]byte, len(memorySnapshotMagic))
+	_, err = io.ReadFull(reader, magic)
+	if err != nil || string(magic) != memorySnapshotMagic {
+		return 0, errInvalidMemorySnapshot
+	}
+
+	var payload []byte
+	for {
+		payload, err = readMemorySnapshotRecord(reader, payload)
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+
+		var item = &Item{Type: ItemTypeMemory}
+		var memoryItem = &MemoryItem{}
+		err = decodeMemorySnapshotPayload(payload, item, memoryItem)
+		if err != nil {
+			return
+		}
+		if item.IsExpired() {
+			continue
+		}
+
+		err = this.restoreItem(item, memoryItem)
+		if err != nil {
+			if IsCapacityError(err) {
+				return count, nil
+			}
+			if CanIgnoreErr(err) {
+				err = nil
+				continue
+			}
+			return
+		}
+		count++
+	}
+}
+
+// 恢复单个条目
+func (this *MemoryStorage) restoreItem(item *Item, memoryItem *MemoryItem) error {
+	writer, err := this.openWriter(item.Key, item.ExpiresAt, memoryItem.Status, len(memoryItem.HeaderValue), int64(len(memoryItem.BodyValue)), -1, false)
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.WriteHeader(memoryItem.HeaderValue)
+	if err == nil {
+		_, err = writer.Write(memoryItem.BodyValue)
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		_ = writer.Discard()
+		return err
+	}
+
+	// 保持原有的修改时间，以便于正确计算Last-Modified和Age
+	var hash = this.hash(item.Key)
+	this.locker.Lock()
+	restoredItem, ok := this.valuesMap[hash]
+	if ok && memoryItem.ModifiedAt > 0 {
+		restoredItem.ModifiedAt = memoryItem.ModifiedAt
+	}
+	this.locker.Unlock()
+
+	item.HeaderSize = writer.HeaderSize()
+	item.BodySize = writer.BodySize()
+	item.Host = ParseHost(item.Key)
+	this.AddToList(item)
+	return nil
+}
+
+// 加载快照，在初始化时调用
+func (this *MemoryStorage) loadSnapshotIfOn() {
+	if !this.SnapshotIsOn() {
+		return
+	}
+
+	count, err := this.LoadSnapshot()
+	if err != nil {
+		remotelogs.Warn("CACHE", "load memory snapshot of policy '"+types.String(this.policy.Id)+"' failed: "+err.Error())
+	}
+	if count > 0 {
+		remotelogs.Println("CACHE", "restored "+types.String(count)+" items from memory snapshot of policy '"+types.String(this.policy.Id)+"'")
+	}
+}
+
+func encodeMemorySnapshotPayload(buf []byte, item *Item, memoryItem *MemoryItem) []byte {
+	buf = binary.BigEndian.AppendUint64(buf, uint64(item.ExpiresAt))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(item.StaleAt))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(memoryItem.ModifiedAt))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(item.ServerId))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(memoryItem.Status))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(item.Key)))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(memoryItem.HeaderValue)))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(len(memoryItem.BodyValue)))
+	buf = append(buf, item.Key...)
+	buf = append(buf, memoryItem.HeaderValue...)
+	buf = append(buf, memoryItem.BodyValue...)
+	return buf
+}
+
+func decodeMemorySnapshotPayload(payload []byte, item *Item, memoryItem *MemoryItem) error {
+	if len(payload) < memorySnapshotPayloadMetaLen {
+		return errInvalidMemorySnapshot
+	}
+
+	item.ExpiresAt = int64(binary.BigEndian.Uint64(payload))
+	item.StaleAt = int64(binary.BigEndian.Uint64(payload[8:]))
+	memoryItem.ModifiedAt = int64(binary.BigEndian.Uint64(payload[16:]))
+	item.ServerId = int64(binary.BigEndian.Uint64(payload[24:]))
+	memoryItem.Status = int(binary.BigEndian.Uint32(payload[32:]))
+	var keyLen = int64(binary.BigEndian.Uint32(payload[36:]))
+	var headerLen = int64(binary.BigEndian.Uint32(payload[40:]))
+	var bodyLen = int64(binary.BigEndian.Uint64(payload[44:]))
+
+	var data = payload[memorySnapshotPayloadMetaLen:]
+	if keyLen <= 0 || headerLen < 0 || bodyLen < 0 || keyLen+headerLen+bodyLen != int64(len(data)) {
+		return errInvalidMemorySnapshot
+	}
+
+	item.Key = string(data[:keyLen])
+
+	// 复制数据，防止payload被重用
+	memoryItem.HeaderValue = append([]byte{}, data[keyLen:keyLen+headerLen]...)
+	memoryItem.BodyValue = append([]byte{}, data[keyLen+headerLen:]...)
+	return nil
+}
+
+func writeMemorySnapshotRecord(writer io.Writer, payload []byte) error {
+	var lengthBytes = binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	_, err := writer.Write(lengthBytes)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(payload)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(payload)))
+	return err
+}
+
+// 读取单条记录，读到结束标记时返回io.EOF
+func readMemorySnapshotRecord(reader io.Reader, buf []byte) ([]byte, error) {
+	var lengthBytes = make([]byte, 4)
+	_, err := io.ReadFull(reader, lengthBytes)
+	if err != nil {
+		if err == io.EOF {
+			return nil, errInvalidMemorySnapshot
+		}
+		return nil, err
+	}
+	var length = int(binary.BigEndian.Uint32(lengthBytes))
+	if length == 0 {
+		return nil, io.EOF
+	}
+	if length < memorySnapshotPayloadMetaLen {
+		return nil, errInvalidMemorySnapshot
+	}
+
+	if cap(buf) < length {
+		buf = make([]byte, length)
+	}
+	buf = buf[:length]
+	_, err = io.ReadFull(reader, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.ReadFull(reader, lengthBytes)
+	if err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(lengthBytes) != crc32.ChecksumIEEE(buf) {
+		return nil, errInvalidMemorySnapshot
+	}
+	return buf, nil
+}
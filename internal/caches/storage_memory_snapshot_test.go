@@ -0,0 +1,100 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/iwind/TeaGo/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStorage_Snapshot(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var policy = &serverconfigs.HTTPCachePolicy{
+		Id: 10001,
+		Options: map[string]any{
+			"memorySnapshot": true,
+		},
+	}
+
+	var storage = NewMemoryStorage(policy, nil)
+	err := storage.list.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(storage.SnapshotIsOn())
+
+	defer func() {
+		_ = os.Remove(storage.SnapshotPath())
+	}()
+
+	for _, key := range []string{"https://example.com/a", "https://example.com/b"} {
+		writer, writerErr := storage.OpenWriter(key, time.Now().Unix()+3600, 200, -1, -1, -1, false)
+		if writerErr != nil {
+			t.Fatal(writerErr)
+		}
+		_, _ = writer.WriteHeader([]byte("Content-Type:text/plain\n"))
+		_, _ = writer.Write([]byte("Hello, " + key))
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		storage.AddToList(&Item{
+			Type:       writer.ItemType(),
+			Key:        key,
+			ExpiresAt:  writer.ExpiredAt(),
+			HeaderSize: writer.HeaderSize(),
+			BodySize:   writer.BodySize(),
+		})
+	}
+
+	count, err := storage.SaveSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(count == 2)
+
+	// 快照文件只允许当前用户访问
+	stat, err := os.Stat(storage.SnapshotPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(stat.Mode().Perm() == 0600)
+	dirStat, err := os.Stat(filepath.Dir(storage.SnapshotPath()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(dirStat.Mode().Perm() == 0700)
+
+	// 在新的存储中恢复
+	var newStorage = NewMemoryStorage(policy, nil)
+	_ = newStorage.list.Init()
+	count, err = newStorage.LoadSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(count == 2)
+
+	reader, err := newStorage.OpenReader("https://example.com/b", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf = make([]byte, 1024)
+	var body = []byte{}
+	err = reader.ReadBody(buf, func(n int) (goNext bool, err error) {
+		body = append(body, buf[:n]...)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(string(body) == "Hello, https://example.com/b")
+
+	// 快照文件在恢复后被删除
+	_, err = os.Stat(storage.SnapshotPath())
+	a.IsTrue(os.IsNotExist(err))
+}
@@ -0,0 +1,90 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"github.com/iwind/TeaGo/types"
+	"strconv"
+	"strings"
+)
+
+const (
+	MinSliceSize = 256 << 10 // 最小切片尺寸
+	MaxSliceSize = 64 << 20  // 最大切片尺寸
+)
+
+// SliceKey 获取某个切片的缓存Key
+func SliceKey(key string, index int64) string {
+	return key + SuffixSlice + strconv.FormatInt(index, 10)
+}
+
+// SlicePrefix 获取所有切片缓存Key的共同前缀，用来一次性清除所有切片
+func SlicePrefix(key string) string {
+	return key + SuffixSlice
+}
+
+// SliceIndexRange 计算 [start, end] 区间覆盖的切片序号
+func SliceIndexRange(start int64, end int64, sliceSize int64) (firstIndex int64, lastIndex int64) {
+	if sliceSize <= 0 || start < 0 || end < start {
+		return 0, -1
+	}
+	return start / sliceSize, end / sliceSize
+}
+
+// ParseSliceSize 从缓存策略选项中读取切片尺寸
+// 选项名为 sliceSize，可以是字节数，也可以是带单位的字符串，比如 512k、4m；为0时表示不启用切片
+func ParseSliceSize(options map[string]any) int64 {
+	if options == nil {
+		return 0
+	}
+	value, ok := options["sliceSize"]
+	if !ok || value == nil {
+		return 0
+	}
+
+	var size int64
+	switch v := value.(type) {
+	case string:
+		size = parseSizeString(v)
+	default:
+		size = types.Int64(v)
+	}
+
+	if size <= 0 {
+		return 0
+	}
+	if size < MinSliceSize {
+		size = MinSliceSize
+	} else if size > MaxSliceSize {
+		size = MaxSliceSize
+	}
+	return size
+}
+
+// 分析带单位的尺寸字符串
+func parseSizeString(s string) int64 {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.TrimSuffix(s, "b")
+	if len(s) == 0 {
+		return 0
+	}
+
+	var unit int64 = 1
+	switch s[len(s)-1] {
+	case 'k':
+		unit = 1 << 10
+	case 'm':
+		unit = 1 << 20
+	case 'g':
+		unit = 1 << 30
+	}
+	if unit > 1 {
+		s = strings.TrimSpace(s[:len(s)-1])
+	}
+
+	size, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || size <= 0 {
+		return 0
+	}
+	return size * unit
+}
@@ -0,0 +1,48 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"github.com/iwind/TeaGo/assert"
+	"testing"
+)
+
+func TestParseSliceSize(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	a.IsTrue(caches.ParseSliceSize(nil) == 0)
+	a.IsTrue(caches.ParseSliceSize(map[string]any{}) == 0)
+	a.IsTrue(caches.ParseSliceSize(map[string]any{"sliceSize": 0}) == 0)
+	a.IsTrue(caches.ParseSliceSize(map[string]any{"sliceSize": "abc"}) == 0)
+	a.IsTrue(caches.ParseSliceSize(map[string]any{"sliceSize": 1 << 20}) == 1<<20)
+	a.IsTrue(caches.ParseSliceSize(map[string]any{"sliceSize": float64(2 << 20)}) == 2<<20)
+	a.IsTrue(caches.ParseSliceSize(map[string]any{"sliceSize": "4m"}) == 4<<20)
+	a.IsTrue(caches.ParseSliceSize(map[string]any{"sliceSize": "512KB"}) == 512<<10)
+	a.IsTrue(caches.ParseSliceSize(map[string]any{"sliceSize": "1k"}) == caches.MinSliceSize)
+	a.IsTrue(caches.ParseSliceSize(map[string]any{"sliceSize": "1g"}) == caches.MaxSliceSize)
+}
+
+func TestSliceIndexRange(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		first, last := caches.SliceIndexRange(0, 99, 100)
+		a.IsTrue(first == 0 && last == 0)
+	}
+	{
+		first, last := caches.SliceIndexRange(99, 100, 100)
+		a.IsTrue(first == 0 && last == 1)
+	}
+	{
+		first, last := caches.SliceIndexRange(250, 1000, 100)
+		a.IsTrue(first == 2 && last == 10)
+	}
+	{
+		first, last := caches.SliceIndexRange(10, 5, 100)
+		a.IsTrue(first > last)
+	}
+
+	a.IsTrue(caches.SliceKey("https://example.com/a.mp4", 3) == "https://example.com/a.mp4"+caches.SuffixSlice+"3")
+	a.IsTrue(caches.SlicePrefix("https://example.com/a.mp4") == "https://example.com/a.mp4"+caches.SuffixSlice)
+}
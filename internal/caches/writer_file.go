@@ -5,6 +5,7 @@ import (
 	"errors"
 	fsutils "github.com/TeaOSLab/EdgeNode/internal/utils/fs"
 	"github.com/iwind/TeaGo/types"
+	"hash"
 	"io"
 	"strings"
 	"sync"
@@ -27,6 +28,9 @@ type FileWriter struct {
 	once      sync.Once
 
 	modifiedBytes int
+
+	cipher   *fileWriterCipher // 加密写入，为nil时表示不加密
+	checksum hash.Hash32       // 未加密文件的Body校验值，为nil时表示不计算
 }
 
 func NewFileWriter(storage StorageInterface, rawWriter *fsutils.File, key string, expiredAt int64, metaHeaderSize int, metaBodySize int64, maxSize int64, endFunc func()) *FileWriter {
@@ -44,6 +48,10 @@ func NewFileWriter(storage StorageInterface, rawWriter *fsutils.File, key string
 
 // WriteHeader 写入数据
 func (this *FileWriter) WriteHeader(data []byte) (n int, err error) {
+	if this.cipher != nil {
+		return this.writeEncryptedHeader(data)
+	}
+
 	n, err = this.rawWriter.Write(data)
 	this.headerSize += int64(n)
 	if err != nil {
@@ -135,6 +143,16 @@ func (this *FileWriter) Close() error {
 
 	var path = this.rawWriter.Name()
 
+	// 写入剩余的加密数据
+	if this.cipher != nil {
+		err := this.finishEncrypted()
+		if err != nil {
+			_ = this.rawWriter.Close()
+			_ = fsutils.Remove(path)
+			return err
+		}
+	}
+
 	// check content length
 	if this.metaBodySize > 0 && this.bodySize != this.metaBodySize {
 		_ = this.rawWriter.Close()
@@ -142,6 +160,16 @@ func (this *FileWriter) Close() error {
 		return ErrUnexpectedContentLength
 	}
 
+	// 写入Body校验值
+	if this.checksum != nil {
+		err := this.finishChecksum()
+		if err != nil {
+			_ = this.rawWriter.Close()
+			_ = fsutils.Remove(path)
+			return err
+		}
+	}
+
 	err := this.WriteHeaderLength(types.Int(this.headerSize))
 	if err != nil {
 		_ = this.rawWriter.Close()
@@ -174,6 +202,7 @@ func (this *FileWriter) Discard() error {
 		this.endFunc()
 	})
 
+	this.releaseCipher()
 	_ = this.rawWriter.Close()
 
 	err := fsutils.Remove(this.rawWriter.Name())
@@ -202,7 +231,14 @@ func (this *FileWriter) ItemType() ItemType {
 }
 
 func (this *FileWriter) write(data []byte) (n int, err error) {
-	n, err = this.rawWriter.Write(data)
+	if this.cipher != nil {
+		n, err = this.writeEncryptedBody(data)
+	} else {
+		n, err = this.rawWriter.Write(data)
+		if this.checksum != nil && n > 0 {
+			_, _ = this.checksum.Write(data[:n])
+		}
+	}
 	this.bodySize += int64(n)
 
 	if this.maxSize > 0 && this.bodySize > this.maxSize {
@@ -0,0 +1,113 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/utils/bytepool"
+)
+
+// 加密写入相关状态
+type fileWriterCipher struct {
+	cipher      *FileCipher
+	noncePrefix []byte
+
+	header       []byte // 未加密的Header，在写入Body之前统一加密
+	headerSealed bool
+
+	chunkBuf *bytepool.Buf
+	chunkLen int
+	counter  uint32
+}
+
+// 启用加密，需要在写入meta和加密头部之后调用
+func (this *FileWriter) initCipher(fileCipher *FileCipher, noncePrefix []byte) {
+	this.cipher = &fileWriterCipher{
+		cipher:      fileCipher,
+		noncePrefix: noncePrefix,
+		counter:     fileCipherHeaderCounter,
+	}
+}
+
+// 缓存Header，等待加密
+func (this *FileWriter) writeEncryptedHeader(data []byte) (n int, err error) {
+	this.cipher.header = append(this.cipher.header, data...)
+	this.headerSize += int64(len(data))
+	return len(data), nil
+}
+
+// 加密写入Body
+func (this *FileWriter) writeEncryptedBody(data []byte) (n int, err error) {
+	err = this.sealHeader()
+	if err != nil {
+		return 0, err
+	}
+
+	var c = this.cipher
+	if c.chunkBuf == nil {
+		c.chunkBuf = c.cipher.getBuf()
+	}
+	var chunkSize = c.cipher.ChunkSize()
+	for len(data) > 0 {
+		// 数据块已满并且还有更多数据时才写入，以便于在关闭时标记最后一个数据块
+		if c.chunkLen == chunkSize {
+			err = this.sealChunk(false)
+			if err != nil {
+				return
+			}
+		}
+
+		var copied = copy(c.chunkBuf.Bytes[c.chunkLen:chunkSize], data)
+		c.chunkLen += copied
+		n += copied
+		data = data[copied:]
+	}
+	return
+}
+
+// 结束加密写入
+func (this *FileWriter) finishEncrypted() error {
+	defer this.releaseCipher()
+
+	var err = this.sealHeader()
+	if err != nil {
+		return err
+	}
+	if this.cipher.chunkLen > 0 {
+		err = this.sealChunk(true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *FileWriter) sealHeader() error {
+	var c = this.cipher
+	if c.headerSealed {
+		return nil
+	}
+	c.headerSealed = true
+
+	var buf = make([]byte, len(c.header), len(c.header)+c.cipher.Overhead())
+	copy(buf, c.header)
+	c.header = nil
+	_, err := this.rawWriter.Write(c.cipher.seal(buf, c.noncePrefix, c.counter, nil))
+	return err
+}
+
+func (this *FileWriter) sealChunk(isLast bool) error {
+	var c = this.cipher
+	c.counter++
+	var sealed = c.cipher.seal(c.chunkBuf.Bytes[:c.chunkLen], c.noncePrefix, c.counter, fileCipherChunkAAD(isLast))
+	c.chunkLen = 0
+	_, err := this.rawWriter.Write(sealed)
+	return err
+}
+
+func (this *FileWriter) releaseCipher() {
+	var c = this.cipher
+	if c != nil && c.chunkBuf != nil {
+		c.cipher.putBuf(c.chunkBuf)
+		c.chunkBuf = nil
+	}
+}
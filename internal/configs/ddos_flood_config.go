@@ -0,0 +1,93 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+const DDoSFloodConfigFileName = "ddos_flood.yaml"
+
+const (
+	DefaultUDPPacketsSecondlyRate       = 10000 // 单个IP每秒最多的UDP包数
+	DefaultICMPPacketsSecondlyRatePerIP = 10    // 单个IP每秒最多的ICMP Echo包数
+	DefaultICMPPacketsSecondlyRate      = 1000  // 所有IP每秒最多的ICMP Echo包数
+	DefaultSYNSecondlyRate              = 20000 // 单个端口每秒最多的SYN包数
+	DefaultSYNSecondlyRatePerIP         = 100   // 单个IP在单个端口上每秒最多的SYN包数
+)
+
+// DDoSFloodConfig 节点本地的洪水攻击防护配置
+// 和集群中的TCP防护设置一起使用，只在使用nftables的Linux系统上生效
+type DDoSFloodConfig struct {
+	UDP  *UDPFloodConfig  `yaml:"udp" json:"udp"`
+	ICMP *ICMPFloodConfig `yaml:"icmp" json:"icmp"`
+	SYN  *SYNFloodConfig  `yaml:"syn" json:"syn"`
+}
+
+// UDPFloodConfig UDP洪水防护
+// 只限制新的会话，已经有回应的会话中的包不受限制
+type UDPFloodConfig struct {
+	IsOn                bool    `yaml:"isOn" json:"isOn"`
+	Ports               []int32 `yaml:"ports,flow" json:"ports"`                        // 端口，为空表示所有端口
+	PacketsSecondlyRate int32   `yaml:"packetsSecondlyRate" json:"packetsSecondlyRate"` // 单个IP每秒最多的包数
+	BlockTimeout        int32   `yaml:"blockTimeout" json:"blockTimeout"`               // 超出限制后加入黑名单的时长，单位：秒，为0表示只丢弃超出的包
+}
+
+// ICMPFloodConfig ICMP洪水防护
+// 只限制Echo请求（ping），防止影响IPv6邻居发现等功能
+type ICMPFloodConfig struct {
+	IsOn                     bool  `yaml:"isOn" json:"isOn"`
+	PacketsSecondlyRatePerIP int32 `yaml:"packetsSecondlyRatePerIP" json:"packetsSecondlyRatePerIP"` // 单个IP每秒最多的包数
+	PacketsSecondlyRate      int32 `yaml:"packetsSecondlyRate" json:"packetsSecondlyRate"`           // 所有IP每秒最多的包数
+}
+
+// SYNFloodConfig SYN洪水防护
+type SYNFloodConfig struct {
+	IsOn              bool    `yaml:"isOn" json:"isOn"`
+	Ports             []int32 `yaml:"ports,flow" json:"ports"`                    // 端口，为空表示使用TCP防护中的端口
+	SecondlyRate      int32   `yaml:"secondlyRate" json:"secondlyRate"`           // 单个端口每秒最多的SYN包数
+	SecondlyRatePerIP int32   `yaml:"secondlyRatePerIP" json:"secondlyRatePerIP"` // 单个IP在单个端口上每秒最多的SYN包数
+	BlockTimeout      int32   `yaml:"blockTimeout" json:"blockTimeout"`           // 单个IP超出限制后加入黑名单的时长，单位：秒，为0表示只丢弃超出的包
+}
+
+func (this *DDoSFloodConfig) Init() error {
+	if this.UDP != nil {
+		if this.UDP.PacketsSecondlyRate <= 0 {
+			this.UDP.PacketsSecondlyRate = DefaultUDPPacketsSecondlyRate
+		}
+		if this.UDP.BlockTimeout < 0 {
+			this.UDP.BlockTimeout = 0
+		}
+	}
+
+	if this.ICMP != nil {
+		if this.ICMP.PacketsSecondlyRatePerIP <= 0 {
+			this.ICMP.PacketsSecondlyRatePerIP = DefaultICMPPacketsSecondlyRatePerIP
+		}
+		if this.ICMP.PacketsSecondlyRate <= 0 {
+			this.ICMP.PacketsSecondlyRate = DefaultICMPPacketsSecondlyRate
+		}
+	}
+
+	if this.SYN != nil {
+		if this.SYN.SecondlyRate <= 0 {
+			this.SYN.SecondlyRate = DefaultSYNSecondlyRate
+		}
+		if this.SYN.SecondlyRatePerIP <= 0 {
+			this.SYN.SecondlyRatePerIP = DefaultSYNSecondlyRatePerIP
+		}
+		if this.SYN.BlockTimeout < 0 {
+			this.SYN.BlockTimeout = 0
+		}
+	}
+
+	return nil
+}
+
+// IsOn 是否启用了任一防护
+func (this *DDoSFloodConfig) IsOn() bool {
+	return (this.UDP != nil && this.UDP.IsOn) ||
+		(this.ICMP != nil && this.ICMP.IsOn) ||
+		(this.SYN != nil && this.SYN.IsOn)
+}
+
+// LoadDDoSFloodConfig 从本地文件中加载洪水攻击防护配置
+func LoadDDoSFloodConfig() (*DDoSFloodConfig, error) {
+	return LoadLocalConfig[DDoSFloodConfig](DDoSFloodConfigFileName)
+}
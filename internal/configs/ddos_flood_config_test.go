@@ -0,0 +1,41 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"gopkg.in/yaml.v3"
+	"testing"
+)
+
+func TestDDoSFloodConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = &configs.DDoSFloodConfig{}
+	err := yaml.Unmarshal([]byte(`
+udp:
+  isOn: true
+  ports: [ 53 ]
+icmp:
+  isOn: false
+syn:
+  isOn: true
+  secondlyRatePerIP: 50
+  blockTimeout: -1
+`), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(config.IsOn())
+	a.IsTrue(config.UDP.PacketsSecondlyRate == configs.DefaultUDPPacketsSecondlyRate)
+	a.IsTrue(len(config.UDP.Ports) == 1)
+	a.IsTrue(config.ICMP.PacketsSecondlyRate == configs.DefaultICMPPacketsSecondlyRate)
+	a.IsTrue(config.SYN.SecondlyRate == configs.DefaultSYNSecondlyRate)
+	a.IsTrue(config.SYN.SecondlyRatePerIP == 50)
+	a.IsTrue(config.SYN.BlockTimeout == 0)
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+const IPFeedsConfigFileName = "ip_feeds.yaml"
+
+const (
+	DefaultIPFeedInterval   = 3600       // 秒
+	DefaultIPFeedEventLevel = "critical" // 触发防火墙动作的事件级别
+	DefaultIPFeedMaxItems   = 1_000_000  // 单个订阅最多的条目数
+
+	IPFeedListTypeBlack = "black"
+	IPFeedListTypeGrey  = "grey"
+)
+
+var ipFeedNameReg = regexp.MustCompile(`^[\w.-]+$`)
+
+// IPFeedsConfig IP信誉订阅配置
+type IPFeedsConfig struct {
+	Feeds []*IPFeedConfig `yaml:"feeds" json:"feeds"`
+}
+
+// IPFeedConfig 单个IP信誉订阅
+// 支持每行一个IP/CIDR/IP范围的文本文件，包括Spamhaus DROP和FireHOL netset格式
+type IPFeedConfig struct {
+	IsOn       bool   `yaml:"isOn" json:"isOn"`
+	Name       string `yaml:"name" json:"name"`             // 名称，只能包含字母、数字、下划线、点和中划线
+	URL        string `yaml:"url" json:"url"`               // 下载地址
+	ListType   string `yaml:"listType" json:"listType"`     // 名单类型：black、grey
+	ListId     int64  `yaml:"listId" json:"listId"`         // 加入的IP名单ID，为0表示使用节点专用的订阅黑名单
+	EventLevel string `yaml:"eventLevel" json:"eventLevel"` // 触发防火墙动作的事件级别
+	Interval   int    `yaml:"interval" json:"interval"`     // 更新间隔，单位：秒
+	Life       int    `yaml:"life" json:"life"`             // 条目有效期，单位：秒，默认为更新间隔的3倍，订阅地址无法访问时条目会在有效期之后失效
+	MaxItems   int    `yaml:"maxItems" json:"maxItems"`     // 最多的条目数
+}
+
+func (this *IPFeedConfig) Init() error {
+	if !ipFeedNameReg.MatchString(this.Name) {
+		return errors.New("invalid feed name '" + this.Name + "'")
+	}
+
+	u, err := url.Parse(this.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return errors.New("feed '" + this.Name + "': invalid url '" + this.URL + "'")
+	}
+
+	switch this.ListType {
+	case "":
+		this.ListType = IPFeedListTypeBlack
+	case IPFeedListTypeBlack:
+	case IPFeedListTypeGrey:
+		// 灰名单只能通过WAF策略中的名单ID来使用
+		if this.ListId <= 0 {
+			return errors.New("feed '" + this.Name + "': 'listId' is required for grey list")
+		}
+	default:
+		return errors.New("feed '" + this.Name + "': invalid list type '" + this.ListType + "'")
+	}
+
+	if len(this.EventLevel) == 0 {
+		this.EventLevel = DefaultIPFeedEventLevel
+	}
+	if this.Interval <= 0 {
+		this.Interval = DefaultIPFeedInterval
+	}
+	if this.Life < this.Interval {
+		this.Life = this.Interval * 3
+	}
+	if this.MaxItems <= 0 {
+		this.MaxItems = DefaultIPFeedMaxItems
+	}
+	return nil
+}
+
+// IntervalDuration 更新间隔
+func (this *IPFeedConfig) IntervalDuration() time.Duration {
+	return time.Duration(this.Interval) * time.Second
+}
+
+func (this *IPFeedsConfig) Init() error {
+	var nameMap = map[string]bool{}
+	for _, feed := range this.Feeds {
+		err := feed.Init()
+		if err != nil {
+			return err
+		}
+		if nameMap[feed.Name] {
+			return errors.New("duplicate feed name '" + feed.Name + "'")
+		}
+		nameMap[feed.Name] = true
+	}
+	return nil
+}
+
+// LoadIPFeedsConfig 从本地文件中加载IP信誉订阅配置
+func LoadIPFeedsConfig() (*IPFeedsConfig, error) {
+	return LoadLocalConfig[IPFeedsConfig](IPFeedsConfigFileName)
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"gopkg.in/yaml.v3"
+	"testing"
+)
+
+func TestIPFeedsConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		var config = &configs.IPFeedsConfig{}
+		err := yaml.Unmarshal([]byte(`
+feeds:
+  - isOn: true
+    name: spamhaus-drop
+    url: https://www.spamhaus.org/drop/drop.txt
+  - isOn: true
+    name: firehol_level1
+    url: https://iplists.firehol.org/files/firehol_level1.netset
+    listType: grey
+    listId: 10
+    interval: 600
+    life: 60
+`), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = config.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var feed1 = config.Feeds[0]
+		a.IsTrue(feed1.ListType == configs.IPFeedListTypeBlack)
+		a.IsTrue(feed1.Interval == configs.DefaultIPFeedInterval)
+		a.IsTrue(feed1.Life == configs.DefaultIPFeedInterval*3)
+		a.IsTrue(feed1.EventLevel == configs.DefaultIPFeedEventLevel)
+
+		var feed2 = config.Feeds[1]
+		a.IsTrue(feed2.ListId == 10)
+		a.IsTrue(feed2.Life == 1800)
+	}
+
+	for _, feed := range []*configs.IPFeedConfig{
+		{Name: "a b", URL: "https://example.com/a.txt"},
+		{Name: "a", URL: "ftp://example.com/a.txt"},
+		{Name: "a", URL: "https://example.com/a.txt", ListType: "white"},
+		{Name: "a", URL: "https://example.com/a.txt", ListType: configs.IPFeedListTypeGrey},
+	} {
+		a.IsNotNil(feed.Init())
+	}
+
+	{
+		var config = &configs.IPFeedsConfig{
+			Feeds: []*configs.IPFeedConfig{
+				{Name: "a", URL: "https://example.com/a.txt"},
+				{Name: "a", URL: "https://example.com/b.txt"},
+			},
+		}
+		a.IsNotNil(config.Init())
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+import (
+	"errors"
+	"github.com/iwind/TeaGo/Tea"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// LocalConfigPtr 节点本地配置对象
+type LocalConfigPtr[T any] interface {
+	*T
+	Init() error
+}
+
+// LocalConfigPath 获取本地配置文件路径，相对路径的文件位于配置目录中
+func LocalConfigPath(filename string) string {
+	if filepath.IsAbs(filename) {
+		return filename
+	}
+	return Tea.ConfigFile(filename)
+}
+
+// LoadLocalConfig 加载YAML格式的节点本地配置文件，加载后调用配置的Init()
+func LoadLocalConfig[T any, PT LocalConfigPtr[T]](filename string) (PT, error) {
+	data, err := os.ReadFile(LocalConfigPath(filename))
+	if err != nil {
+		return nil, err
+	}
+
+	var config PT = new(T)
+	err = yaml.Unmarshal(data, config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Init()
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// LocalConfigFile 可以重新加载的节点本地配置文件
+// 文件修改后重新加载，文件删除后配置为nil，加载失败时继续使用旧的配置
+type LocalConfigFile[T any, PT LocalConfigPtr[T]] struct {
+	filename   string
+	config     PT
+	modifiedAt time.Time
+
+	watchDone chan struct{} // 用来停止检查文件变化
+
+	locker sync.RWMutex
+}
+
+// NewLocalConfigFile 获取新对象
+func NewLocalConfigFile[T any, PT LocalConfigPtr[T]](filename string) *LocalConfigFile[T, PT] {
+	return &LocalConfigFile[T, PT]{
+		filename: filename,
+	}
+}
+
+// Filename 文件名
+func (this *LocalConfigFile[T, PT]) Filename() string {
+	return this.filename
+}
+
+// Config 当前的配置，没有配置文件时返回nil
+func (this *LocalConfigFile[T, PT]) Config() PT {
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+	return this.config
+}
+
+// Update 直接修改配置，下次检查时如果文件有变化仍然会重新加载
+func (this *LocalConfigFile[T, PT]) Update(config PT) {
+	this.locker.Lock()
+	this.config = config
+	this.modifiedAt = time.Time{}
+	this.locker.Unlock()
+}
+
+// Reload 检查文件变化并重新加载，返回配置是否有变化
+func (this *LocalConfigFile[T, PT]) Reload() (changed bool, err error) {
+	stat, err := os.Stat(LocalConfigPath(this.filename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			this.locker.Lock()
+			changed = this.config != nil
+			this.config = nil
+			this.modifiedAt = time.Time{}
+			this.locker.Unlock()
+			return changed, nil
+		}
+		return false, err
+	}
+
+	this.locker.RLock()
+	var isChanged = !this.modifiedAt.Equal(stat.ModTime())
+	this.locker.RUnlock()
+	if !isChanged {
+		return false, nil
+	}
+
+	config, err := LoadLocalConfig[T, PT](this.filename)
+	if err != nil {
+		return false, errors.New("load config file '" + this.filename + "' failed: " + err.Error())
+	}
+
+	this.locker.Lock()
+	this.config = config
+	this.modifiedAt = stat.ModTime()
+	this.locker.Unlock()
+
+	return true, nil
+}
+
+// Watch 加载配置文件，然后每隔一段时间检查文件变化并重新加载，直到调用Stop()为止
+// 配置有变化时调用onChange，文件删除后config为nil；加载失败时继续使用旧的配置，并调用onError
+func (this *LocalConfigFile[T, PT]) Watch(interval time.Duration, onChange func(config PT), onError func(err error)) {
+	var reload = func() {
+		changed, err := this.Reload()
+		if err != nil {
+			if onError != nil {
+				onError(err)
+			}
+			return
+		}
+		if changed && onChange != nil {
+			onChange(this.Config())
+		}
+	}
+
+	// 首次加载在当前goroutine中完成，以便调用者可以立即使用配置
+	reload()
+
+	var done = make(chan struct{})
+	this.locker.Lock()
+	if this.watchDone != nil {
+		close(this.watchDone)
+	}
+	this.watchDone = done
+	this.locker.Unlock()
+
+	go func() {
+		var ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				reload()
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止检查文件变化
+func (this *LocalConfigFile[T, PT]) Stop() {
+	this.locker.Lock()
+	if this.watchDone != nil {
+		close(this.watchDone)
+		this.watchDone = nil
+	}
+	this.locker.Unlock()
+}
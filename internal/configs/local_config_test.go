@@ -0,0 +1,134 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLocalConfigFile_Reload(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var path = t.TempDir() + "/ddos_flood.yaml"
+	var configFile = configs.NewLocalConfigFile[configs.DDoSFloodConfig](path)
+
+	// 文件不存在
+	changed, err := configFile.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsFalse(changed)
+	a.IsNil(configFile.Config())
+
+	err = os.WriteFile(path, []byte("udp:\n  isOn: true\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err = configFile.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(changed)
+	a.IsTrue(configFile.Config().UDP.IsOn)
+	a.IsTrue(configFile.Config().UDP.PacketsSecondlyRate == configs.DefaultUDPPacketsSecondlyRate)
+
+	// 文件没有变化
+	changed, err = configFile.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsFalse(changed)
+
+	// 加载失败时继续使用旧的配置
+	err = os.WriteFile(path, []byte("udp: [\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var modifiedAt = time.Now().Add(1 * time.Second)
+	_ = os.Chtimes(path, modifiedAt, modifiedAt)
+	_, err = configFile.Reload()
+	a.IsTrue(err != nil)
+	a.IsTrue(configFile.Config().UDP.IsOn)
+
+	// 文件被删除
+	err = os.Remove(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err = configFile.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(changed)
+	a.IsNil(configFile.Config())
+}
+
+func TestLocalConfigFile_Watch(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var path = t.TempDir() + "/ddos_flood.yaml"
+	err := os.WriteFile(path, []byte("udp:\n  isOn: true\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var configFile = configs.NewLocalConfigFile[configs.DDoSFloodConfig](path)
+	var changes = make(chan *configs.DDoSFloodConfig, 8)
+	var errs = make(chan error, 8)
+	configFile.Watch(10*time.Millisecond, func(config *configs.DDoSFloodConfig) {
+		select {
+		case changes <- config:
+		default:
+		}
+	}, func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	defer configFile.Stop()
+
+	// 首次加载
+	a.IsTrue(configFile.Config() != nil && configFile.Config().UDP.IsOn)
+	a.IsTrue((<-changes).UDP.IsOn)
+
+	// 加载失败时继续使用旧的配置
+	err = os.WriteFile(path, []byte("udp: [\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var modifiedAt = time.Now().Add(1 * time.Second)
+	_ = os.Chtimes(path, modifiedAt, modifiedAt)
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload error not reported")
+	}
+	a.IsTrue(configFile.Config().UDP.IsOn)
+
+	// 文件被删除
+	err = os.Remove(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case config := <-changes:
+		a.IsNil(config)
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not reported")
+	}
+	a.IsNil(configFile.Config())
+
+	// 停止之后不再检查
+	configFile.Stop()
+	err = os.WriteFile(path, []byte("udp:\n  isOn: true\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	a.IsNil(configFile.Config())
+}
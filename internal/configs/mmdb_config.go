@@ -0,0 +1,59 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+import (
+	"github.com/iwind/TeaGo/Tea"
+	"path/filepath"
+	"time"
+)
+
+const MMDBConfigFileName = "mmdb.yaml"
+
+const (
+	DefaultMMDBLanguage      = "zh-CN"
+	DefaultMMDBCheckInterval = 60 // 秒
+)
+
+// MMDBConfig 本地MaxMind MMDB IP库配置
+// 没有此配置文件时也会加载 data/mmdb/ 目录下的MMDB文件，仅在IP库中找不到数据时使用
+type MMDBConfig struct {
+	Dir           string `yaml:"dir" json:"dir"`                     // MMDB文件所在目录，默认为 data/mmdb
+	Override      bool   `yaml:"override" json:"override"`           // 是否优先使用MMDB中的数据，覆盖默认IP库的查询结果
+	Language      string `yaml:"language" json:"language"`           // 名称使用的语言，找不到时使用英文
+	CheckInterval int    `yaml:"checkInterval" json:"checkInterval"` // 检查文件变化的间隔，单位：秒
+}
+
+// DefaultMMDBConfig 默认配置
+func DefaultMMDBConfig() *MMDBConfig {
+	var config = &MMDBConfig{}
+	_ = config.Init()
+	return config
+}
+
+func (this *MMDBConfig) Init() error {
+	if len(this.Dir) == 0 {
+		this.Dir = Tea.Root + "/data/mmdb"
+	} else if !filepath.IsAbs(this.Dir) {
+		this.Dir = Tea.Root + "/" + this.Dir
+	}
+	this.Dir = filepath.Clean(this.Dir)
+
+	if len(this.Language) == 0 {
+		this.Language = DefaultMMDBLanguage
+	}
+	if this.CheckInterval <= 0 {
+		this.CheckInterval = DefaultMMDBCheckInterval
+	}
+	return nil
+}
+
+// CheckDuration 检查文件变化的间隔
+func (this *MMDBConfig) CheckDuration() time.Duration {
+	return time.Duration(this.CheckInterval) * time.Second
+}
+
+// LoadMMDBConfig 从本地文件中加载MMDB配置
+func LoadMMDBConfig() (*MMDBConfig, error) {
+	return LoadLocalConfig[MMDBConfig](MMDBConfigFileName)
+}
@@ -0,0 +1,45 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/assert"
+	"gopkg.in/yaml.v3"
+	"testing"
+	"time"
+)
+
+func TestMMDBConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		var config = configs.DefaultMMDBConfig()
+		a.IsTrue(config.Dir == Tea.Root+"/data/mmdb")
+		a.IsTrue(config.Language == configs.DefaultMMDBLanguage)
+		a.IsFalse(config.Override)
+		a.IsTrue(config.CheckDuration() == time.Minute)
+	}
+
+	{
+		var config = &configs.MMDBConfig{}
+		err := yaml.Unmarshal([]byte(`
+dir: /opt/geoip
+override: true
+language: en
+checkInterval: 10
+`), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = config.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(config.Dir == "/opt/geoip")
+		a.IsTrue(config.Override)
+		a.IsTrue(config.Language == "en")
+		a.IsTrue(config.CheckDuration() == 10*time.Second)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+import (
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/fnv"
+	"github.com/iwind/TeaGo/types"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const OriginEgressConfigFileName = "origin_egress.yaml"
+
+// OriginEgressMode 出口IP选择方式
+type OriginEgressMode = string
+
+const (
+	OriginEgressModeFixed      OriginEgressMode = "fixed"      // 固定使用第一个地址
+	OriginEgressModeRoundRobin OriginEgressMode = "roundRobin" // 每个新连接轮流使用
+	OriginEgressModeHash       OriginEgressMode = "hash"       // 根据客户端IP选择，同一个客户端总是使用同一个地址
+)
+
+// OriginEgressIPVersion 优先使用的IP版本
+type OriginEgressIPVersion = string
+
+const (
+	OriginEgressIPVersionAuto OriginEgressIPVersion = ""     // 按照域名解析的顺序
+	OriginEgressIPVersionIPv4 OriginEgressIPVersion = "ipv4" // 优先使用IPv4
+	OriginEgressIPVersionIPv6 OriginEgressIPVersion = "ipv6" // 优先使用IPv6
+)
+
+const DefaultOriginEgressFallbackDelay = 300 // 毫秒
+
+// OriginEgressConfig 连接源站的出口IP配置
+type OriginEgressConfig struct {
+	Pools []*OriginEgressPoolConfig `yaml:"pools" json:"pools"`
+}
+
+// OriginEgressPoolConfig 单组出口IP配置
+type OriginEgressPoolConfig struct {
+	IsOn          bool     `yaml:"isOn" json:"isOn"`                   // 是否启用
+	OriginIds     []int64  `yaml:"originIds" json:"originIds"`         // 源站ID
+	ServerIds     []int64  `yaml:"serverIds" json:"serverIds"`         // 服务ID，对服务下的所有源站生效
+	LocalAddrs    []string `yaml:"localAddrs" json:"localAddrs"`       // 本地出口IP，可以同时包含IPv4和IPv6地址
+	Mode          string   `yaml:"mode" json:"mode"`                   // 选择方式：fixed、roundRobin、hash
+	IPVersion     string   `yaml:"ipVersion" json:"ipVersion"`         // 源站同时有IPv4和IPv6地址时优先使用的版本：ipv4、ipv6
+	FallbackDelay int      `yaml:"fallbackDelay" json:"fallbackDelay"` // 优先的IP版本连接没有完成时，尝试另外一个版本之前等待的时间（毫秒）
+
+	ipv4Addrs []net.IP
+	ipv6Addrs []net.IP
+	index     uint64
+}
+
+func (this *OriginEgressPoolConfig) Init() error {
+	if len(this.OriginIds) == 0 && len(this.ServerIds) == 0 {
+		return errors.New("'originIds' and 'serverIds' should not be both empty")
+	}
+
+	this.ipv4Addrs = nil
+	this.ipv6Addrs = nil
+	for _, addr := range this.LocalAddrs {
+		var ip = net.ParseIP(strings.TrimSpace(addr))
+		if ip == nil {
+			return errors.New("invalid local address '" + addr + "'")
+		}
+		if ip.To4() != nil {
+			this.ipv4Addrs = append(this.ipv4Addrs, ip.To4())
+		} else {
+			this.ipv6Addrs = append(this.ipv6Addrs, ip)
+		}
+	}
+
+	this.IPVersion = strings.ToLower(strings.TrimSpace(this.IPVersion))
+	switch this.IPVersion {
+	case OriginEgressIPVersionAuto, OriginEgressIPVersionIPv4, OriginEgressIPVersionIPv6:
+	default:
+		return errors.New("invalid ipVersion '" + this.IPVersion + "', only 'ipv4' and 'ipv6' are allowed")
+	}
+
+	if len(this.LocalAddrs) == 0 && len(this.IPVersion) == 0 {
+		return errors.New("'localAddrs' and 'ipVersion' should not be both empty")
+	}
+
+	switch this.Mode {
+	case "":
+		this.Mode = OriginEgressModeRoundRobin
+	case OriginEgressModeFixed, OriginEgressModeRoundRobin, OriginEgressModeHash:
+	default:
+		return errors.New("invalid mode '" + this.Mode + "', only 'fixed', 'roundRobin' and 'hash' are allowed")
+	}
+
+	if this.FallbackDelay < 0 {
+		return errors.New("'fallbackDelay' should not be less than 0")
+	}
+	if this.FallbackDelay == 0 {
+		this.FallbackDelay = DefaultOriginEgressFallbackDelay
+	}
+
+	return nil
+}
+
+// MatchOrigin 检查源站是否匹配
+func (this *OriginEgressPoolConfig) MatchOrigin(originId int64) bool {
+	if originId <= 0 {
+		return false
+	}
+	for _, id := range this.OriginIds {
+		if id == originId {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchServer 检查服务是否匹配
+func (this *OriginEgressPoolConfig) MatchServer(serverId int64) bool {
+	if serverId <= 0 {
+		return false
+	}
+	for _, id := range this.ServerIds {
+		if id == serverId {
+			return true
+		}
+	}
+	return false
+}
+
+// Key 配置的唯一标识，用来区分使用不同出口配置的客户端
+func (this *OriginEgressPoolConfig) Key() string {
+	return strings.Join(this.LocalAddrs, ",") + "@" + this.Mode + "@" + this.IPVersion + "@" + types.String(this.FallbackDelay)
+}
+
+// IsHash 是否根据客户端IP选择出口IP
+func (this *OriginEgressPoolConfig) IsHash() bool {
+	return this.Mode == OriginEgressModeHash && len(this.LocalAddrs) > 0
+}
+
+// FallbackDelayDuration 尝试另外一个IP版本之前等待的时间
+func (this *OriginEgressPoolConfig) FallbackDelayDuration() time.Duration {
+	if this.FallbackDelay <= 0 {
+		return DefaultOriginEgressFallbackDelay * time.Millisecond
+	}
+	return time.Duration(this.FallbackDelay) * time.Millisecond
+}
+
+// PickLocalAddrs 选择本次连接使用的IPv4和IPv6出口地址，没有对应版本的地址时返回nil
+func (this *OriginEgressPoolConfig) PickLocalAddrs(clientIP string) (ipv4 net.IP, ipv6 net.IP) {
+	switch this.Mode {
+	case OriginEgressModeFixed:
+		return this.pick(this.ipv4Addrs, 0), this.pick(this.ipv6Addrs, 0)
+	case OriginEgressModeHash:
+		var hash = fnv.HashString(clientIP)
+		return this.pick(this.ipv4Addrs, hash), this.pick(this.ipv6Addrs, hash)
+	default:
+		var index = atomic.AddUint64(&this.index, 1) - 1
+		return this.pick(this.ipv4Addrs, index), this.pick(this.ipv6Addrs, index)
+	}
+}
+
+func (this *OriginEgressPoolConfig) pick(addrs []net.IP, index uint64) net.IP {
+	if len(addrs) == 0 {
+		return nil
+	}
+	return addrs[index%uint64(len(addrs))]
+}
+
+func (this *OriginEgressConfig) Init() error {
+	for index, pool := range this.Pools {
+		if !pool.IsOn {
+			continue
+		}
+		err := pool.Init()
+		if err != nil {
+			return errors.New("pools[" + types.String(index) + "]: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// FindPool 查找源站使用的出口配置，按源站ID设置的优先于按服务ID设置的，没有找到则返回nil
+func (this *OriginEgressConfig) FindPool(originId int64, serverId int64) *OriginEgressPoolConfig {
+	for _, pool := range this.Pools {
+		if pool.IsOn && pool.MatchOrigin(originId) {
+			return pool
+		}
+	}
+	for _, pool := range this.Pools {
+		if pool.IsOn && pool.MatchServer(serverId) {
+			return pool
+		}
+	}
+	return nil
+}
+
+// LoadOriginEgressConfig 从本地文件中加载源站出口IP配置
+func LoadOriginEgressConfig() (*OriginEgressConfig, error) {
+	return LoadLocalConfig[OriginEgressConfig](OriginEgressConfigFileName)
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"gopkg.in/yaml.v3"
+	"testing"
+	"time"
+)
+
+func TestOriginEgressConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = &configs.OriginEgressConfig{}
+	err := yaml.Unmarshal([]byte(`
+pools:
+  - isOn: true
+    originIds: [1]
+    localAddrs: ["192.168.1.10", "192.168.1.11", "2001:db8::10"]
+    ipVersion: IPv6
+  - isOn: true
+    serverIds: [100]
+    localAddrs: ["192.168.1.20", "192.168.1.21"]
+    mode: hash
+  - isOn: false
+    serverIds: [200]
+    localAddrs: ["192.168.1.30"]
+`), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 源站优先于服务
+	var pool = config.FindPool(1, 100)
+	a.IsNotNil(pool)
+	a.IsTrue(pool.Mode == configs.OriginEgressModeRoundRobin)
+	a.IsTrue(pool.IPVersion == configs.OriginEgressIPVersionIPv6)
+	a.IsTrue(pool.FallbackDelayDuration() == 300*time.Millisecond)
+	a.IsFalse(pool.IsHash())
+	a.IsTrue(pool.Key() == "192.168.1.10,192.168.1.11,2001:db8::10@roundRobin@ipv6@300")
+
+	ipv4, ipv6 := pool.PickLocalAddrs("")
+	a.IsTrue(ipv4.String() == "192.168.1.10")
+	a.IsTrue(ipv6.String() == "2001:db8::10")
+	ipv4, ipv6 = pool.PickLocalAddrs("")
+	a.IsTrue(ipv4.String() == "192.168.1.11")
+	a.IsTrue(ipv6.String() == "2001:db8::10")
+	ipv4, _ = pool.PickLocalAddrs("")
+	a.IsTrue(ipv4.String() == "192.168.1.10")
+
+	// 按客户端IP选择
+	var hashPool = config.FindPool(2, 100)
+	a.IsNotNil(hashPool)
+	a.IsTrue(hashPool.IsHash())
+	var clientIPs = map[string]bool{}
+	for _, clientIP := range []string{"1.1.1.1", "1.1.1.2", "1.1.1.3", "1.1.1.4", "1.1.1.5"} {
+		ipv4, ipv6 = hashPool.PickLocalAddrs(clientIP)
+		a.IsNotNil(ipv4)
+		a.IsTrue(ipv6 == nil)
+		for i := 0; i < 3; i++ {
+			ipv4Again, _ := hashPool.PickLocalAddrs(clientIP)
+			a.IsTrue(ipv4.Equal(ipv4Again))
+		}
+		clientIPs[ipv4.String()] = true
+	}
+	t.Log(clientIPs)
+
+	a.IsNil(config.FindPool(2, 200))
+	a.IsNil(config.FindPool(0, 0))
+
+	for _, pool := range []*configs.OriginEgressPoolConfig{
+		{LocalAddrs: []string{"192.168.1.10"}},
+		{OriginIds: []int64{1}},
+		{OriginIds: []int64{1}, LocalAddrs: []string{"a.b.c.d"}},
+		{OriginIds: []int64{1}, LocalAddrs: []string{"192.168.1.10"}, Mode: "random"},
+		{OriginIds: []int64{1}, IPVersion: "ipv5"},
+		{OriginIds: []int64{1}, IPVersion: "ipv4", FallbackDelay: -1},
+	} {
+		a.IsNotNil(pool.Init())
+	}
+}
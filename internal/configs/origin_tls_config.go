@@ -0,0 +1,167 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/types"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const OriginTLSConfigFileName = "origin_tls.yaml"
+
+// OriginTLSVerifyMode 源站证书校验方式
+type OriginTLSVerifyMode = string
+
+const (
+	OriginTLSVerifyModeInsecure OriginTLSVerifyMode = "insecure" // 不校验
+	OriginTLSVerifyModeSystem   OriginTLSVerifyMode = "system"   // 使用系统根证书校验
+	OriginTLSVerifyModeCA       OriginTLSVerifyMode = "ca"       // 使用自定义CA证书校验
+	OriginTLSVerifyModePin      OriginTLSVerifyMode = "pin"      // 只校验证书公钥指纹
+)
+
+const originTLSPinPrefix = "sha256/"
+
+// OriginTLSConfig 源站TLS证书校验配置
+type OriginTLSConfig struct {
+	Default  *OriginTLSPolicy   `yaml:"default" json:"default"`   // 默认策略，为空时使用系统根证书校验
+	Policies []*OriginTLSPolicy `yaml:"policies" json:"policies"` // 针对单个源站的策略
+}
+
+// OriginTLSPolicy 源站TLS证书校验策略
+type OriginTLSPolicy struct {
+	OriginIds         []int64             `yaml:"originIds" json:"originIds"`                 // 源站ID
+	Mode              OriginTLSVerifyMode `yaml:"mode" json:"mode"`                           // 校验方式
+	CAFile            string              `yaml:"caFile" json:"caFile"`                       // CA证书文件，PEM格式，可以包含多个证书
+	Pins              []string            `yaml:"pins" json:"pins"`                           // 证书公钥（SPKI）指纹：sha256/BASE64，证书链中任一证书匹配即可
+	ServerName        string              `yaml:"serverName" json:"serverName"`               // SNI和校验使用的主机名
+	VerifyRequestHost bool                `yaml:"verifyRequestHost" json:"verifyRequestHost"` // 是否使用客户端请求的Host校验证书
+
+	caPool    *x509.CertPool
+	pinHashes [][]byte
+	key       string
+}
+
+func (this *OriginTLSPolicy) Init() error {
+	switch this.Mode {
+	case "":
+		this.Mode = OriginTLSVerifyModeSystem
+	case OriginTLSVerifyModeInsecure, OriginTLSVerifyModeSystem, OriginTLSVerifyModeCA, OriginTLSVerifyModePin:
+	default:
+		return errors.New("invalid verify mode '" + this.Mode + "'")
+	}
+
+	// CA
+	this.caPool = nil
+	if this.Mode == OriginTLSVerifyModeCA {
+		if len(this.CAFile) == 0 {
+			return errors.New("'caFile' is required in '" + this.Mode + "' mode")
+		}
+		var caFile = this.CAFile
+		if !filepath.IsAbs(caFile) {
+			caFile = Tea.Root + "/" + caFile
+		}
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return errors.New("read ca file failed: " + err.Error())
+		}
+		var pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return errors.New("no valid certificates found in ca file '" + this.CAFile + "'")
+		}
+		this.caPool = pool
+	}
+
+	// 指纹
+	this.pinHashes = nil
+	for _, pin := range this.Pins {
+		if !strings.HasPrefix(pin, originTLSPinPrefix) {
+			return errors.New("invalid pin '" + pin + "': should start with '" + originTLSPinPrefix + "'")
+		}
+		hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, originTLSPinPrefix))
+		if err != nil || len(hash) != sha256.Size {
+			return errors.New("invalid pin '" + pin + "'")
+		}
+		this.pinHashes = append(this.pinHashes, hash)
+	}
+	if this.Mode == OriginTLSVerifyModePin && len(this.pinHashes) == 0 {
+		return errors.New("'pins' is required in '" + this.Mode + "' mode")
+	}
+
+	// 用来区分不同策略的Key
+	keyJSON, err := json.Marshal(this)
+	if err != nil {
+		return err
+	}
+	this.key = string(keyJSON)
+
+	return nil
+}
+
+// CAPool 自定义CA证书
+func (this *OriginTLSPolicy) CAPool() *x509.CertPool {
+	return this.caPool
+}
+
+// PinHashes 证书公钥指纹
+func (this *OriginTLSPolicy) PinHashes() [][]byte {
+	return this.pinHashes
+}
+
+// Key 策略唯一标识
+func (this *OriginTLSPolicy) Key() string {
+	return this.key
+}
+
+// IsInsecure 是否不校验证书
+func (this *OriginTLSPolicy) IsInsecure() bool {
+	return this.Mode == OriginTLSVerifyModeInsecure
+}
+
+func (this *OriginTLSConfig) Init() error {
+	if this.Default != nil {
+		if len(this.Default.OriginIds) > 0 {
+			return errors.New("'originIds' should be empty in default policy")
+		}
+		err := this.Default.Init()
+		if err != nil {
+			return errors.New("default policy: " + err.Error())
+		}
+	}
+	for index, policy := range this.Policies {
+		if len(policy.OriginIds) == 0 {
+			return errors.New("policies[" + types.String(index) + "]: 'originIds' should not be empty")
+		}
+		err := policy.Init()
+		if err != nil {
+			return errors.New("policies[" + types.String(index) + "]: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// FindPolicy 查找源站对应的策略，如果没有找到则返回默认策略
+func (this *OriginTLSConfig) FindPolicy(originId int64) *OriginTLSPolicy {
+	if originId > 0 {
+		for _, policy := range this.Policies {
+			for _, policyOriginId := range policy.OriginIds {
+				if policyOriginId == originId {
+					return policy
+				}
+			}
+		}
+	}
+	return this.Default
+}
+
+// LoadOriginTLSConfig 从本地文件中加载源站TLS证书校验配置
+func LoadOriginTLSConfig() (*OriginTLSConfig, error) {
+	return LoadLocalConfig[OriginTLSConfig](OriginTLSConfigFileName)
+}
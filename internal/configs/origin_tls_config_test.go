@@ -0,0 +1,63 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"gopkg.in/yaml.v3"
+	"testing"
+)
+
+func TestOriginTLSConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = &configs.OriginTLSConfig{}
+	err := yaml.Unmarshal([]byte(`
+default:
+  mode: system
+policies:
+  - originIds: [ 1, 2 ]
+    mode: pin
+    pins: [ "sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=" ]
+    serverName: origin.example.com
+  - originIds: [ 3 ]
+    mode: insecure
+`), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.IsTrue(config.FindPolicy(0) == config.Default)
+	a.IsTrue(config.FindPolicy(100) == config.Default)
+	a.IsTrue(config.FindPolicy(2).Mode == configs.OriginTLSVerifyModePin)
+	a.IsTrue(len(config.FindPolicy(2).PinHashes()) == 1)
+	a.IsTrue(config.FindPolicy(3).IsInsecure())
+	a.IsTrue(config.FindPolicy(1).Key() != config.FindPolicy(3).Key())
+}
+
+func TestOriginTLSPolicy_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		var policy = &configs.OriginTLSPolicy{}
+		a.IsNil(policy.Init())
+		a.IsTrue(policy.Mode == configs.OriginTLSVerifyModeSystem)
+		a.IsNil(policy.CAPool())
+	}
+
+	for _, policy := range []*configs.OriginTLSPolicy{
+		{Mode: "unknown"},
+		{Mode: configs.OriginTLSVerifyModeCA},
+		{Mode: configs.OriginTLSVerifyModeCA, CAFile: "/not/exists/ca.pem"},
+		{Mode: configs.OriginTLSVerifyModePin},
+		{Mode: configs.OriginTLSVerifyModePin, Pins: []string{"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}},
+		{Mode: configs.OriginTLSVerifyModeSystem, Pins: []string{"sha256/abc"}},
+	} {
+		a.IsNotNil(policy.Init())
+	}
+}
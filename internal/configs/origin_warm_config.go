@@ -0,0 +1,135 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+import (
+	"errors"
+	"github.com/iwind/TeaGo/types"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const OriginWarmConfigFileName = "origin_warm.yaml"
+
+const (
+	DefaultOriginWarmInterval = 30 // 秒
+	DefaultOriginWarmMethod   = http.MethodHead
+	DefaultOriginWarmPath     = "/"
+	MaxOriginWarmMinIdleConns = 256
+	DefaultOriginWarmTimeout  = 10 // 秒
+)
+
+// OriginWarmConfig 源站连接预热配置
+type OriginWarmConfig struct {
+	Origins []*OriginWarmPoolConfig `yaml:"origins" json:"origins"`
+}
+
+// OriginWarmPoolConfig 单组源站的预热配置
+type OriginWarmPoolConfig struct {
+	IsOn         bool     `yaml:"isOn" json:"isOn"`                 // 是否启用
+	OriginIds    []int64  `yaml:"originIds" json:"originIds"`       // 源站ID
+	Addrs        []string `yaml:"addrs" json:"addrs"`               // 源站地址，比如 192.168.1.100:443
+	MinIdleConns int      `yaml:"minIdleConns" json:"minIdleConns"` // 保持的最少空闲连接数
+	Interval     int      `yaml:"interval" json:"interval"`         // 检查间隔（秒）
+	Method       string   `yaml:"method" json:"method"`             // 预热请求方法
+	Path         string   `yaml:"path" json:"path"`                 // 预热请求路径
+	Timeout      int      `yaml:"timeout" json:"timeout"`           // 预热请求超时时间（秒）
+}
+
+func (this *OriginWarmPoolConfig) Init() error {
+	if len(this.OriginIds) == 0 && len(this.Addrs) == 0 {
+		return errors.New("'originIds' and 'addrs' should not be both empty")
+	}
+	if this.MinIdleConns <= 0 {
+		return errors.New("'minIdleConns' should be greater than 0")
+	}
+	if this.MinIdleConns > MaxOriginWarmMinIdleConns {
+		return errors.New("'minIdleConns' should not be greater than " + types.String(MaxOriginWarmMinIdleConns))
+	}
+	if this.Interval <= 0 {
+		this.Interval = DefaultOriginWarmInterval
+	}
+
+	this.Method = strings.ToUpper(strings.TrimSpace(this.Method))
+	switch this.Method {
+	case "":
+		this.Method = DefaultOriginWarmMethod
+	case http.MethodHead, http.MethodGet, http.MethodOptions:
+	default:
+		return errors.New("invalid method '" + this.Method + "', only HEAD, GET and OPTIONS are allowed")
+	}
+
+	if len(this.Path) == 0 {
+		this.Path = DefaultOriginWarmPath
+	} else if !strings.HasPrefix(this.Path, "/") {
+		return errors.New("'path' should start with '/'")
+	}
+
+	if this.Timeout <= 0 {
+		this.Timeout = DefaultOriginWarmTimeout
+	}
+
+	return nil
+}
+
+// Match 检查源站是否匹配
+func (this *OriginWarmPoolConfig) Match(originId int64, addr string) bool {
+	if originId > 0 {
+		for _, id := range this.OriginIds {
+			if id == originId {
+				return true
+			}
+		}
+	}
+	for _, configAddr := range this.Addrs {
+		if configAddr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// IntervalDuration 检查间隔
+func (this *OriginWarmPoolConfig) IntervalDuration() time.Duration {
+	if this.Interval <= 0 {
+		return DefaultOriginWarmInterval * time.Second
+	}
+	return time.Duration(this.Interval) * time.Second
+}
+
+// TimeoutDuration 预热请求超时时间
+func (this *OriginWarmPoolConfig) TimeoutDuration() time.Duration {
+	if this.Timeout <= 0 {
+		return DefaultOriginWarmTimeout * time.Second
+	}
+	return time.Duration(this.Timeout) * time.Second
+}
+
+func (this *OriginWarmConfig) Init() error {
+	for index, pool := range this.Origins {
+		if !pool.IsOn {
+			continue
+		}
+		err := pool.Init()
+		if err != nil {
+			return errors.New("origins[" + types.String(index) + "]: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// FindPool 查找源站对应的预热配置，没有找到则返回nil
+func (this *OriginWarmConfig) FindPool(originId int64, addr string) *OriginWarmPoolConfig {
+	for _, pool := range this.Origins {
+		if pool.IsOn && pool.Match(originId, addr) {
+			return pool
+		}
+	}
+	return nil
+}
+
+// LoadOriginWarmConfig 从本地文件中加载源站连接预热配置
+func LoadOriginWarmConfig() (*OriginWarmConfig, error) {
+	return LoadLocalConfig[OriginWarmConfig](OriginWarmConfigFileName)
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestOriginWarmConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = &configs.OriginWarmConfig{}
+	err := yaml.Unmarshal([]byte(`
+origins:
+  - isOn: true
+    originIds: [1, 2]
+    minIdleConns: 4
+  - isOn: true
+    addrs: [ "192.168.1.100:443" ]
+    minIdleConns: 2
+    interval: 10
+    method: get
+    path: /health
+  - isOn: false
+    addrs: [ "192.168.1.101:443" ]
+`), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pool1 = config.FindPool(2, "127.0.0.1:80")
+	a.IsNotNil(pool1)
+	a.IsTrue(pool1.Method == http.MethodHead)
+	a.IsTrue(pool1.Path == "/")
+	a.IsTrue(pool1.IntervalDuration() == configs.DefaultOriginWarmInterval*time.Second)
+
+	var pool2 = config.FindPool(3, "192.168.1.100:443")
+	a.IsNotNil(pool2)
+	a.IsTrue(pool2.Method == http.MethodGet)
+	a.IsTrue(pool2.IntervalDuration() == 10*time.Second)
+
+	a.IsNil(config.FindPool(3, "192.168.1.101:443"))
+	a.IsNil(config.FindPool(0, "127.0.0.1:80"))
+
+	for _, pool := range []*configs.OriginWarmPoolConfig{
+		{MinIdleConns: 1},
+		{OriginIds: []int64{1}},
+		{OriginIds: []int64{1}, MinIdleConns: configs.MaxOriginWarmMinIdleConns + 1},
+		{OriginIds: []int64{1}, MinIdleConns: 1, Method: "POST"},
+		{OriginIds: []int64{1}, MinIdleConns: 1, Path: "health"},
+	} {
+		a.IsNotNil(pool.Init())
+	}
+}
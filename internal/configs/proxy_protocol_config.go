@@ -0,0 +1,149 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+import (
+	"errors"
+	"github.com/iwind/TeaGo/types"
+	"net"
+	"strings"
+	"time"
+)
+
+const ProxyProtocolConfigFileName = "proxy_protocol.yaml"
+
+// ProxyProtocolMode 接收PROXY Protocol的方式
+type ProxyProtocolMode = string
+
+const (
+	ProxyProtocolModeStrict   ProxyProtocolMode = "strict"   // 受信任的来源必须发送PROXY Header，否则关闭连接
+	ProxyProtocolModeOptional ProxyProtocolMode = "optional" // 受信任的来源可以发送PROXY Header，也可以不发送
+)
+
+const DefaultProxyProtocolReadHeaderTimeout = 5 // 秒
+
+// ProxyProtocolConfig 监听端口接收PROXY Protocol配置
+type ProxyProtocolConfig struct {
+	Listeners []*ProxyProtocolListenerConfig `yaml:"listeners" json:"listeners"`
+}
+
+// ProxyProtocolListenerConfig 单组监听端口的PROXY Protocol配置
+type ProxyProtocolListenerConfig struct {
+	IsOn              bool              `yaml:"isOn" json:"isOn"`                           // 是否启用
+	Addrs             []string          `yaml:"addrs" json:"addrs"`                         // 监听地址，比如 :80、http://:80、https://192.168.1.100:443
+	Mode              ProxyProtocolMode `yaml:"mode" json:"mode"`                           // 接收方式
+	TrustedCIDRs      []string          `yaml:"trustedCIDRs" json:"trustedCIDRs"`           // 受信任的来源IP或IP段，只有这些来源发送的PROXY Header才会被解析
+	ReadHeaderTimeout int               `yaml:"readHeaderTimeout" json:"readHeaderTimeout"` // 读取PROXY Header超时时间（秒）
+
+	trustedNets []*net.IPNet
+}
+
+func (this *ProxyProtocolListenerConfig) Init() error {
+	switch this.Mode {
+	case "":
+		this.Mode = ProxyProtocolModeStrict
+	case ProxyProtocolModeStrict, ProxyProtocolModeOptional:
+	default:
+		return errors.New("invalid mode '" + this.Mode + "'")
+	}
+
+	if len(this.Addrs) == 0 {
+		return errors.New("'addrs' should not be empty")
+	}
+
+	// 没有受信任来源时任何人都可以伪造客户端IP，所以这里必须设置
+	if len(this.TrustedCIDRs) == 0 {
+		return errors.New("'trustedCIDRs' should not be empty")
+	}
+	this.trustedNets = nil
+	for _, cidr := range this.TrustedCIDRs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			var ip = net.ParseIP(cidr)
+			if ip == nil {
+				return errors.New("invalid trusted ip '" + cidr + "'")
+			}
+			if ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return errors.New("invalid trusted cidr '" + cidr + "'")
+		}
+		this.trustedNets = append(this.trustedNets, ipNet)
+	}
+
+	if this.ReadHeaderTimeout <= 0 {
+		this.ReadHeaderTimeout = DefaultProxyProtocolReadHeaderTimeout
+	}
+
+	return nil
+}
+
+// IsStrict 是否必须发送PROXY Header
+func (this *ProxyProtocolListenerConfig) IsStrict() bool {
+	return this.Mode == ProxyProtocolModeStrict
+}
+
+// IsTrusted 检查来源IP是否受信任
+func (this *ProxyProtocolListenerConfig) IsTrusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range this.trustedNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadHeaderTimeoutDuration 读取PROXY Header超时时间
+func (this *ProxyProtocolListenerConfig) ReadHeaderTimeoutDuration() time.Duration {
+	if this.ReadHeaderTimeout <= 0 {
+		return DefaultProxyProtocolReadHeaderTimeout * time.Second
+	}
+	return time.Duration(this.ReadHeaderTimeout) * time.Second
+}
+
+// MatchAddr 检查是否匹配监听地址
+// fullAddr 为带协议的地址，比如 https://:443；addr 为不带协议的地址，比如 :443
+func (this *ProxyProtocolListenerConfig) MatchAddr(fullAddr string, addr string) bool {
+	for _, configAddr := range this.Addrs {
+		if configAddr == fullAddr || configAddr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *ProxyProtocolConfig) Init() error {
+	for index, listener := range this.Listeners {
+		if !listener.IsOn {
+			continue
+		}
+		err := listener.Init()
+		if err != nil {
+			return errors.New("listeners[" + types.String(index) + "]: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// FindListener 查找监听地址对应的配置，没有找到则返回nil
+func (this *ProxyProtocolConfig) FindListener(fullAddr string, addr string) *ProxyProtocolListenerConfig {
+	for _, listener := range this.Listeners {
+		if listener.IsOn && listener.MatchAddr(fullAddr, addr) {
+			return listener
+		}
+	}
+	return nil
+}
+
+// LoadProxyProtocolConfig 从本地文件中加载PROXY Protocol配置
+func LoadProxyProtocolConfig() (*ProxyProtocolConfig, error) {
+	return LoadLocalConfig[ProxyProtocolConfig](ProxyProtocolConfigFileName)
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"gopkg.in/yaml.v3"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProxyProtocolConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = &configs.ProxyProtocolConfig{}
+	err := yaml.Unmarshal([]byte(`
+listeners:
+  - isOn: true
+    addrs: [ "http://:80", ":443" ]
+    trustedCIDRs: [ "10.0.0.0/8", "192.168.1.100", "fd00::/8" ]
+  - isOn: true
+    addrs: [ "tcp://:8000" ]
+    mode: optional
+    trustedCIDRs: [ "127.0.0.1" ]
+    readHeaderTimeout: 2
+  - isOn: false
+    addrs: [ ":8080" ]
+`), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var listener = config.FindListener("http://:80", ":80")
+	a.IsNotNil(listener)
+	a.IsTrue(listener.IsStrict())
+	a.IsTrue(listener.ReadHeaderTimeoutDuration() == configs.DefaultProxyProtocolReadHeaderTimeout*time.Second)
+	a.IsTrue(listener.IsTrusted(net.ParseIP("10.1.2.3")))
+	a.IsTrue(listener.IsTrusted(net.ParseIP("192.168.1.100")))
+	a.IsTrue(listener.IsTrusted(net.ParseIP("fd00::1")))
+	a.IsFalse(listener.IsTrusted(net.ParseIP("192.168.1.101")))
+	a.IsFalse(listener.IsTrusted(nil))
+
+	a.IsTrue(config.FindListener("https://:443", ":443") == listener)
+	a.IsNil(config.FindListener("http://:81", ":81"))
+	a.IsNil(config.FindListener("http://:8080", ":8080"))
+
+	var tcpListener = config.FindListener("tcp://:8000", ":8000")
+	a.IsNotNil(tcpListener)
+	a.IsFalse(tcpListener.IsStrict())
+	a.IsTrue(tcpListener.ReadHeaderTimeoutDuration() == 2*time.Second)
+}
+
+func TestProxyProtocolListenerConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		var listener = &configs.ProxyProtocolListenerConfig{
+			IsOn:  true,
+			Addrs: []string{":80"},
+		}
+		a.IsNotNil(listener.Init()) // no trusted cidrs
+	}
+
+	{
+		var listener = &configs.ProxyProtocolListenerConfig{
+			IsOn:         true,
+			Addrs:        []string{":80"},
+			Mode:         "always",
+			TrustedCIDRs: []string{"10.0.0.0/8"},
+		}
+		a.IsNotNil(listener.Init())
+	}
+
+	{
+		var listener = &configs.ProxyProtocolListenerConfig{
+			IsOn:         true,
+			Addrs:        []string{":80"},
+			TrustedCIDRs: []string{"10.0.0.300"},
+		}
+		a.IsNotNil(listener.Init())
+	}
+}
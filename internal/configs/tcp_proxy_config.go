@@ -0,0 +1,84 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+import (
+	"errors"
+	"github.com/iwind/TeaGo/types"
+	"time"
+)
+
+const TCPProxyConfigFileName = "tcp_proxy.yaml"
+
+// TCPProxyConfig TCP/TLS四层转发配置
+type TCPProxyConfig struct {
+	DisableSplice bool `yaml:"disableSplice" json:"disableSplice"` // 是否禁用Linux上的splice零拷贝转发
+
+	TCPProxyServerConfig `yaml:",inline"` // 所有服务的默认配置
+
+	Servers []*TCPProxyServerConfig `yaml:"servers" json:"servers"` // 单独为某些服务设置
+}
+
+// TCPProxyServerConfig 单组服务的转发配置
+type TCPProxyServerConfig struct {
+	ServerIds      []int64 `yaml:"serverIds" json:"serverIds"`           // 服务ID，只在 servers 中有效
+	AccessLog      bool    `yaml:"accessLog" json:"accessLog"`           // 是否为每个连接记录访问日志
+	IdleTimeout    int     `yaml:"idleTimeout" json:"idleTimeout"`       // 空闲超时时间（秒），两个方向都没有数据时关闭连接，0表示不限制
+	MaxLifetime    int     `yaml:"maxLifetime" json:"maxLifetime"`       // 连接最长存活时间（秒），0表示不限制
+	TLSPassthrough bool    `yaml:"tlsPassthrough" json:"tlsPassthrough"` // TLS服务是否透传，节点只读取ClientHello中的SNI，不解密数据，由源站完成TLS握手
+}
+
+func (this *TCPProxyServerConfig) Init() error {
+	if this.IdleTimeout < 0 {
+		return errors.New("'idleTimeout' should not be less than 0")
+	}
+	if this.MaxLifetime < 0 {
+		return errors.New("'maxLifetime' should not be less than 0")
+	}
+	return nil
+}
+
+// IdleTimeoutDuration 空闲超时时间
+func (this *TCPProxyServerConfig) IdleTimeoutDuration() time.Duration {
+	return time.Duration(this.IdleTimeout) * time.Second
+}
+
+// MaxLifetimeDuration 连接最长存活时间
+func (this *TCPProxyServerConfig) MaxLifetimeDuration() time.Duration {
+	return time.Duration(this.MaxLifetime) * time.Second
+}
+
+func (this *TCPProxyConfig) Init() error {
+	err := this.TCPProxyServerConfig.Init()
+	if err != nil {
+		return err
+	}
+
+	for index, server := range this.Servers {
+		if len(server.ServerIds) == 0 {
+			return errors.New("servers[" + types.String(index) + "]: 'serverIds' should not be empty")
+		}
+		err = server.Init()
+		if err != nil {
+			return errors.New("servers[" + types.String(index) + "]: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// FindServer 查找服务对应的配置，没有单独设置时返回默认配置
+func (this *TCPProxyConfig) FindServer(serverId int64) *TCPProxyServerConfig {
+	for _, server := range this.Servers {
+		for _, id := range server.ServerIds {
+			if id == serverId {
+				return server
+			}
+		}
+	}
+	return &this.TCPProxyServerConfig
+}
+
+// LoadTCPProxyConfig 从本地文件中加载TCP/TLS四层转发配置
+func LoadTCPProxyConfig() (*TCPProxyConfig, error) {
+	return LoadLocalConfig[TCPProxyConfig](TCPProxyConfigFileName)
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"gopkg.in/yaml.v3"
+	"testing"
+	"time"
+)
+
+func TestTCPProxyConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = &configs.TCPProxyConfig{}
+	err := yaml.Unmarshal([]byte(`
+accessLog: true
+idleTimeout: 300
+servers:
+  - serverIds: [1, 2]
+    accessLog: false
+    maxLifetime: 3600
+    tlsPassthrough: true
+`), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsFalse(config.DisableSplice)
+
+	var server1 = config.FindServer(1)
+	a.IsFalse(server1.AccessLog)
+	a.IsTrue(server1.IdleTimeoutDuration() == 0)
+	a.IsTrue(server1.MaxLifetimeDuration() == 1*time.Hour)
+	a.IsTrue(server1.TLSPassthrough)
+
+	var server3 = config.FindServer(3)
+	a.IsTrue(server3.AccessLog)
+	a.IsTrue(server3.IdleTimeoutDuration() == 5*time.Minute)
+	a.IsTrue(server3.MaxLifetimeDuration() == 0)
+	a.IsFalse(server3.TLSPassthrough)
+
+	for _, config := range []*configs.TCPProxyConfig{
+		{TCPProxyServerConfig: configs.TCPProxyServerConfig{IdleTimeout: -1}},
+		{Servers: []*configs.TCPProxyServerConfig{{AccessLog: true}}},
+		{Servers: []*configs.TCPProxyServerConfig{{ServerIds: []int64{1}, MaxLifetime: -1}}},
+	} {
+		a.IsNotNil(config.Init())
+	}
+}
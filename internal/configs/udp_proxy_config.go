@@ -0,0 +1,114 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+import (
+	"errors"
+	"github.com/iwind/TeaGo/types"
+	"time"
+)
+
+const UDPProxyConfigFileName = "udp_proxy.yaml"
+
+const DefaultUDPProxyIdleTimeout = 30 // 秒
+
+// UDPProxyConfig UDP四层转发配置
+type UDPProxyConfig struct {
+	UDPProxyServerConfig `yaml:",inline"` // 所有服务的默认配置
+
+	Servers []*UDPProxyServerConfig `yaml:"servers" json:"servers"` // 单独为某些服务设置
+}
+
+// UDPProxyServerConfig 单组服务的UDP转发配置
+type UDPProxyServerConfig struct {
+	ServerIds     []int64 `yaml:"serverIds" json:"serverIds"`         // 服务ID，只在 servers 中有效
+	PacketRate    int     `yaml:"packetRate" json:"packetRate"`       // 单个来源IP每秒最多发送的数据包数，0表示不限制
+	PacketBurst   int     `yaml:"packetBurst" json:"packetBurst"`     // 允许突发的数据包数，默认和 packetRate 相同
+	Bandwidth     int64   `yaml:"bandwidth" json:"bandwidth"`         // 单个来源IP每秒最多发送的字节数，0表示不限制
+	MaxSessions   int     `yaml:"maxSessions" json:"maxSessions"`     // 单个服务最多同时存在的会话数，0表示不限制
+	IdleTimeout   int     `yaml:"idleTimeout" json:"idleTimeout"`     // 会话空闲超时时间（秒）
+	OriginTimeout int     `yaml:"originTimeout" json:"originTimeout"` // 源站响应超时时间（秒），发送数据后超过这个时间源站没有返回任何数据时切换源站，0表示不检查
+}
+
+// DefaultUDPProxyServerConfig 默认的UDP转发配置
+func DefaultUDPProxyServerConfig() *UDPProxyServerConfig {
+	return &UDPProxyServerConfig{
+		IdleTimeout: DefaultUDPProxyIdleTimeout,
+	}
+}
+
+func (this *UDPProxyServerConfig) Init() error {
+	if this.PacketRate < 0 {
+		return errors.New("'packetRate' should not be less than 0")
+	}
+	if this.PacketBurst < 0 {
+		return errors.New("'packetBurst' should not be less than 0")
+	}
+	if this.PacketBurst == 0 {
+		this.PacketBurst = this.PacketRate
+	}
+	if this.Bandwidth < 0 {
+		return errors.New("'bandwidth' should not be less than 0")
+	}
+	if this.MaxSessions < 0 {
+		return errors.New("'maxSessions' should not be less than 0")
+	}
+	if this.IdleTimeout < 0 {
+		return errors.New("'idleTimeout' should not be less than 0")
+	}
+	if this.IdleTimeout == 0 {
+		this.IdleTimeout = DefaultUDPProxyIdleTimeout
+	}
+	if this.OriginTimeout < 0 {
+		return errors.New("'originTimeout' should not be less than 0")
+	}
+	return nil
+}
+
+// IdleTimeoutDuration 会话空闲超时时间
+func (this *UDPProxyServerConfig) IdleTimeoutDuration() time.Duration {
+	if this.IdleTimeout <= 0 {
+		return DefaultUDPProxyIdleTimeout * time.Second
+	}
+	return time.Duration(this.IdleTimeout) * time.Second
+}
+
+// OriginTimeoutDuration 源站响应超时时间
+func (this *UDPProxyServerConfig) OriginTimeoutDuration() time.Duration {
+	return time.Duration(this.OriginTimeout) * time.Second
+}
+
+func (this *UDPProxyConfig) Init() error {
+	err := this.UDPProxyServerConfig.Init()
+	if err != nil {
+		return err
+	}
+
+	for index, server := range this.Servers {
+		if len(server.ServerIds) == 0 {
+			return errors.New("servers[" + types.String(index) + "]: 'serverIds' should not be empty")
+		}
+		err = server.Init()
+		if err != nil {
+			return errors.New("servers[" + types.String(index) + "]: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// FindServer 查找服务对应的配置，没有单独设置时返回默认配置
+func (this *UDPProxyConfig) FindServer(serverId int64) *UDPProxyServerConfig {
+	for _, server := range this.Servers {
+		for _, id := range server.ServerIds {
+			if id == serverId {
+				return server
+			}
+		}
+	}
+	return &this.UDPProxyServerConfig
+}
+
+// LoadUDPProxyConfig 从本地文件中加载UDP四层转发配置
+func LoadUDPProxyConfig() (*UDPProxyConfig, error) {
+	return LoadLocalConfig[UDPProxyConfig](UDPProxyConfigFileName)
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"gopkg.in/yaml.v3"
+	"testing"
+	"time"
+)
+
+func TestUDPProxyConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = &configs.UDPProxyConfig{}
+	err := yaml.Unmarshal([]byte(`
+packetRate: 1000
+bandwidth: 1048576
+servers:
+  - serverIds: [1, 2]
+    packetRate: 50
+    packetBurst: 100
+    maxSessions: 10000
+    idleTimeout: 10
+    originTimeout: 3
+`), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var server1 = config.FindServer(1)
+	a.IsTrue(server1.PacketRate == 50)
+	a.IsTrue(server1.PacketBurst == 100)
+	a.IsTrue(server1.Bandwidth == 0)
+	a.IsTrue(server1.MaxSessions == 10000)
+	a.IsTrue(server1.IdleTimeoutDuration() == 10*time.Second)
+	a.IsTrue(server1.OriginTimeoutDuration() == 3*time.Second)
+
+	var server3 = config.FindServer(3)
+	a.IsTrue(server3.PacketRate == 1000)
+	a.IsTrue(server3.PacketBurst == 1000)
+	a.IsTrue(server3.Bandwidth == 1<<20)
+	a.IsTrue(server3.MaxSessions == 0)
+	a.IsTrue(server3.IdleTimeoutDuration() == configs.DefaultUDPProxyIdleTimeout*time.Second)
+	a.IsTrue(server3.OriginTimeoutDuration() == 0)
+
+	a.IsTrue(configs.DefaultUDPProxyServerConfig().IdleTimeoutDuration() == 30*time.Second)
+
+	for _, config := range []*configs.UDPProxyConfig{
+		{UDPProxyServerConfig: configs.UDPProxyServerConfig{PacketRate: -1}},
+		{UDPProxyServerConfig: configs.UDPProxyServerConfig{Bandwidth: -1}},
+		{Servers: []*configs.UDPProxyServerConfig{{PacketRate: 1}}},
+		{Servers: []*configs.UDPProxyServerConfig{{ServerIds: []int64{1}, MaxSessions: -1}}},
+	} {
+		a.IsNotNil(config.Init())
+	}
+}
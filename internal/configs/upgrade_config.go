@@ -0,0 +1,129 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const UpgradeConfigFileName = "upgrade.yaml"
+
+const (
+	DefaultUpgradeHealthTimeout = 60 // 秒
+	DefaultUpgradeKeepVersions  = 2
+)
+
+// UpgradeConfig 节点自动升级配置
+type UpgradeConfig struct {
+	PublicKey     string `yaml:"publicKey" json:"publicKey"`         // 用来校验升级包签名的Ed25519公钥，Base64或HEX格式，没有设置时不会自动升级
+	SignatureURL  string `yaml:"signatureURL" json:"signatureURL"`   // 升级包签名下载地址，支持 ${filename}、${version}、${os}、${arch} 变量；签名的内容包含版本号、系统、架构和升级包的SHA256
+	HealthTimeout int    `yaml:"healthTimeout" json:"healthTimeout"` // 升级后新进程需要在此时间（秒）内完成启动监听和连接API，否则自动回滚
+	KeepVersions  int    `yaml:"keepVersions" json:"keepVersions"`   // 保留的历史版本数量
+
+	publicKey ed25519.PublicKey
+}
+
+// DefaultUpgradeConfig 默认配置
+func DefaultUpgradeConfig() *UpgradeConfig {
+	var config = &UpgradeConfig{}
+	_ = config.Init()
+	return config
+}
+
+func (this *UpgradeConfig) Init() error {
+	this.publicKey = nil
+	if len(this.PublicKey) > 0 {
+		publicKey, err := DecodeUpgradeKey(this.PublicKey)
+		if err != nil {
+			return errors.New("invalid 'publicKey': " + err.Error())
+		}
+		if len(publicKey) != ed25519.PublicKeySize {
+			return errors.New("invalid 'publicKey': the size of ed25519 public key should be 32 bytes")
+		}
+		this.publicKey = publicKey
+
+		// 设置公钥后必须能够下载到签名
+		if len(this.SignatureURL) == 0 {
+			return errors.New("'signatureURL' should not be empty when 'publicKey' is set")
+		}
+	}
+
+	if len(this.SignatureURL) > 0 {
+		u, err := url.Parse(this.SignatureURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return errors.New("invalid 'signatureURL': should be a http or https url")
+		}
+	}
+
+	if this.HealthTimeout <= 0 {
+		this.HealthTimeout = DefaultUpgradeHealthTimeout
+	}
+	if this.KeepVersions <= 0 {
+		this.KeepVersions = DefaultUpgradeKeepVersions
+	}
+
+	return nil
+}
+
+// RequireSignature 是否需要校验升级包签名
+func (this *UpgradeConfig) RequireSignature() bool {
+	return len(this.publicKey) > 0
+}
+
+// Ed25519PublicKey 获取校验签名用的公钥
+func (this *UpgradeConfig) Ed25519PublicKey() ed25519.PublicKey {
+	return this.publicKey
+}
+
+// ComposeSignatureURL 获取某个升级包对应的签名下载地址
+func (this *UpgradeConfig) ComposeSignatureURL(filename string, version string, goos string, goarch string) string {
+	return strings.NewReplacer(
+		"${filename}", url.PathEscape(filename),
+		"${version}", url.PathEscape(version),
+		"${os}", goos,
+		"${arch}", goarch,
+	).Replace(this.SignatureURL)
+}
+
+// HealthTimeoutDuration 升级后健康检查超时时间
+func (this *UpgradeConfig) HealthTimeoutDuration() time.Duration {
+	if this.HealthTimeout <= 0 {
+		return DefaultUpgradeHealthTimeout * time.Second
+	}
+	return time.Duration(this.HealthTimeout) * time.Second
+}
+
+// DecodeUpgradeKey 解析Base64或HEX格式的公钥或签名
+func DecodeUpgradeKey(data string) ([]byte, error) {
+	data = strings.TrimSpace(data)
+	if len(data) == ed25519.PublicKeySize*2 || len(data) == ed25519.SignatureSize*2 {
+		result, err := hex.DecodeString(data)
+		if err == nil {
+			return result, nil
+		}
+	}
+	result, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, errors.New("should be in base64 or hex format")
+	}
+	return result, nil
+}
+
+// LoadUpgradeConfig 从本地文件中加载升级配置，文件不存在时返回默认配置
+func LoadUpgradeConfig() (*UpgradeConfig, error) {
+	config, err := LoadLocalConfig[UpgradeConfig](UpgradeConfigFileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return DefaultUpgradeConfig(), nil
+		}
+		return nil, err
+	}
+	return config, nil
+}
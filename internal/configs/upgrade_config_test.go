@@ -0,0 +1,61 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs_test
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"testing"
+	"time"
+)
+
+func TestUpgradeConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	{
+		var config = configs.DefaultUpgradeConfig()
+		a.IsFalse(config.RequireSignature())
+		a.IsTrue(config.HealthTimeoutDuration() == configs.DefaultUpgradeHealthTimeout*time.Second)
+		a.IsTrue(config.KeepVersions == configs.DefaultUpgradeKeepVersions)
+	}
+
+	for _, key := range []string{base64.StdEncoding.EncodeToString(publicKey), hex.EncodeToString(publicKey)} {
+		var config = &configs.UpgradeConfig{
+			PublicKey:    key,
+			SignatureURL: "https://example.com/${version}/${filename}.sig",
+		}
+		err = config.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(config.RequireSignature())
+		a.IsTrue(config.Ed25519PublicKey().Equal(publicKey))
+	}
+
+	for _, config := range []*configs.UpgradeConfig{
+		{PublicKey: base64.StdEncoding.EncodeToString(publicKey)},
+		{PublicKey: "abc", SignatureURL: "https://example.com/a.sig"},
+		{PublicKey: base64.StdEncoding.EncodeToString(publicKey[:16]), SignatureURL: "https://example.com/a.sig"},
+		{SignatureURL: "ftp://example.com/a.sig"},
+	} {
+		a.IsNotNil(config.Init())
+	}
+}
+
+func TestUpgradeConfig_ComposeSignatureURL(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = &configs.UpgradeConfig{
+		SignatureURL: "https://example.com/${version}/${os}-${arch}/${filename}.sig",
+	}
+	a.IsNil(config.Init())
+	a.IsTrue(config.ComposeSignatureURL("edge-node-linux-amd64-v1.3.0.zip", "1.3.0", "linux", "amd64") == "https://example.com/1.3.0/linux-amd64/edge-node-linux-amd64-v1.3.0.zip.sig")
+}
@@ -10,20 +10,18 @@ import (
 	"fmt"
 	"github.com/TeaOSLab/EdgeCommon/pkg/nodeconfigs"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/ddosconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
 	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
 	"github.com/TeaOSLab/EdgeNode/internal/events"
 	"github.com/TeaOSLab/EdgeNode/internal/firewalls/nftables"
 	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
 	"github.com/TeaOSLab/EdgeNode/internal/utils"
-	executils "github.com/TeaOSLab/EdgeNode/internal/utils/exec"
 	"github.com/TeaOSLab/EdgeNode/internal/zero"
 	"github.com/iwind/TeaGo/lists"
-	"github.com/iwind/TeaGo/types"
-	stringutil "github.com/iwind/TeaGo/utils/string"
 	"net"
+	"os"
 	"strings"
 	"sync"
-	"time"
 )
 
 var SharedDDoSProtectionManager = NewDDoSProtectionManager()
@@ -63,6 +61,12 @@ type DDoSProtectionManager struct {
 	lastAllowIPList []string
 	lastConfig      []byte
 
+	// 最近一次应用的配置，用来修复被外部修改的规则
+	isApplied          bool
+	lastTCPConfig      *ddosconfigs.TCPConfig
+	lastFloodConfig    *configs.DDoSFloodConfig
+	lastAllAllowIPList []string // 为nil表示不管理白名单
+
 	locker sync.Mutex
 }
 
@@ -90,8 +94,17 @@ func (this *DDoSProtectionManager) Apply(config *ddosconfigs.ProtectionConfig) e
 		}
 	}
 
+	// 本地的洪水攻击防护配置
+	floodConfig, err := configs.LoadDDoSFloodConfig()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("load '%s' failed: %w", configs.DDoSFloodConfigFileName, err)
+		}
+		floodConfig = nil
+	}
+
 	// 对比配置
-	configJSON, err := json.Marshal(config)
+	configJSON, err := json.Marshal([]any{config, floodConfig})
 	if err != nil {
 		return fmt.Errorf("encode config to json failed: %w", err)
 	}
@@ -100,36 +113,16 @@ func (this *DDoSProtectionManager) Apply(config *ddosconfigs.ProtectionConfig) e
 	}
 	remotelogs.Println("FIREWALL", "change DDoS protection config")
 
-	if len(nftables.NftExePath()) == 0 {
-		return errors.New("can not find nft command")
-	}
-
 	if nftablesInstance == nil {
-		if config == nil || !config.IsOn() {
+		if (config == nil || !config.IsOn()) && (floodConfig == nil || !floodConfig.IsOn()) {
 			return nil
 		}
 		return errors.New("nftables instance should not be nil")
 	}
 
-	if config == nil {
-		// TCP
-		err := this.removeTCPRules()
-		if err != nil {
-			return err
-		}
-
-		// TODO other protocols
-
-		return nil
-	}
-
-	// TCP
-	if config.TCP == nil {
-		err := this.removeTCPRules()
-		if err != nil {
-			return err
-		}
-	} else {
+	var tcpConfig *ddosconfigs.TCPConfig
+	var allAllowIPList []string
+	if config != nil && config.TCP != nil {
 		// allow ip list
 		var allowIPList = []string{}
 		for _, ipConfig := range config.TCP.AllowIPList {
@@ -140,222 +133,176 @@ func (this *DDoSProtectionManager) Apply(config *ddosconfigs.ProtectionConfig) e
 				allowIPList = append(allowIPList, ip)
 			}
 		}
-		err = this.updateAllowIPList(allowIPList)
+		_, err = this.updateAllowIPList(allowIPList)
 		if err != nil {
 			return err
 		}
+		allAllowIPList = allowIPList
 
-		// tcp
 		if config.TCP.IsOn {
-			err := this.addTCPRules(config.TCP)
-			if err != nil {
-				return err
-			}
-		} else {
-			err := this.removeTCPRules()
-			if err != nil {
-				return err
-			}
+			tcpConfig = config.TCP
 		}
 	}
 
+	_, err = this.applyRules(tcpConfig, floodConfig)
+	if err != nil {
+		return err
+	}
+
 	this.lastConfig = configJSON
+	this.isApplied = true
+	this.lastTCPConfig = tcpConfig
+	this.lastFloodConfig = floodConfig
+	this.lastAllAllowIPList = allAllowIPList
 
 	return nil
 }
 
-// 添加TCP规则
-func (this *DDoSProtectionManager) addTCPRules(tcpConfig *ddosconfigs.TCPConfig) error {
-	var nftExe = nftables.NftExePath()
-	if len(nftExe) == 0 {
-		return nil
-	}
+// Reconcile 重新对比最近一次应用的配置和内核中的规则，修复不一致的地方
+func (this *DDoSProtectionManager) Reconcile() (repaired []string, err error) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
 
-	// 检查nft版本不能小于0.9
-	if len(nftablesInstance.version) > 0 && stringutil.VersionCompare("0.9", nftablesInstance.version) > 0 {
-		return nil
+	if !this.isApplied || nftablesInstance == nil {
+		return nil, nil
 	}
 
-	var ports = []int32{}
-	for _, portConfig := range tcpConfig.Ports {
-		if !lists.ContainsInt32(ports, portConfig.Port) {
-			ports = append(ports, portConfig.Port)
+	if this.lastAllAllowIPList != nil {
+		changes, err := this.updateAllowIPList(this.lastAllAllowIPList)
+		if err != nil {
+			return nil, err
 		}
+		repaired = append(repaired, changes...)
+	}
+
+	changes, err := this.applyRules(this.lastTCPConfig, this.lastFloodConfig)
+	if err != nil {
+		return nil, err
 	}
-	if len(ports) == 0 {
-		ports = []int32{80, 443}
+	repaired = append(repaired, changes...)
+	return
+}
+
+// 对比现有规则，在一次批量操作中添加、删除规则和集合
+// changes 中为发生变化的规则和集合
+func (this *DDoSProtectionManager) applyRules(tcpConfig *ddosconfigs.TCPConfig, floodConfig *configs.DDoSFloodConfig) (changes []string, err error) {
+	// 使用单独的连接，防止和其他的nftables操作混在一起提交
+	conn, err := nftables.NewConn()
+	if err != nil {
+		return nil, fmt.Errorf("create nftables connection failed: %w", err)
 	}
+	var batch = nftables.NewBatch(conn)
 
 	for _, filter := range nftablesFilters {
-		chain, oldRules, err := this.getRules(filter)
+		table, err := this.getTable(filter)
 		if err != nil {
-			return fmt.Errorf("get old rules failed: %w", err)
+			return nil, fmt.Errorf("get table failed: %w", err)
 		}
-
-		var protocol = filter.protocol()
-
-		// max connections
-		var maxConnections = tcpConfig.MaxConnections
-		if maxConnections <= 0 {
-			maxConnections = nodeconfigs.DefaultTCPMaxConnections
-			if maxConnections <= 0 {
-				maxConnections = 100000
-			}
+		chain, err := table.GetChain(nftablesChainName)
+		if err != nil {
+			return nil, fmt.Errorf("get chain failed: %w", err)
 		}
-
-		// max connections per ip
-		var maxConnectionsPerIP = tcpConfig.MaxConnectionsPerIP
-		if maxConnectionsPerIP <= 0 {
-			maxConnectionsPerIP = nodeconfigs.DefaultTCPMaxConnectionsPerIP
-			if maxConnectionsPerIP <= 0 {
-				maxConnectionsPerIP = 100000
-			}
+		oldRules, err := chain.GetRules()
+		if err != nil {
+			return nil, fmt.Errorf("get old rules failed: %w", err)
 		}
-
-		// new connections rate (minutely)
-		var newConnectionsMinutelyRate = tcpConfig.NewConnectionsMinutelyRate
-		if newConnectionsMinutelyRate <= 0 {
-			newConnectionsMinutelyRate = nodeconfigs.DefaultTCPNewConnectionsMinutelyRate
-			if newConnectionsMinutelyRate <= 0 {
-				newConnectionsMinutelyRate = 100000
-			}
+		oldSetNames, err := table.GetSetNames()
+		if err != nil {
+			return nil, fmt.Errorf("get old sets failed: %w", err)
 		}
-		var newConnectionsMinutelyRateBlockTimeout = tcpConfig.NewConnectionsMinutelyRateBlockTimeout
-		if newConnectionsMinutelyRateBlockTimeout < 0 {
-			newConnectionsMinutelyRateBlockTimeout = 0
+
+		var newRules, meterSets = this.buildRules(filter, tcpConfig, floodConfig)
+		var newRuleMap = map[string]*ddosRule{}
+		for _, rule := range newRules {
+			newRuleMap[this.encodeUserData(rule.attrs)] = rule
 		}
 
-		// new connections rate (secondly)
-		var newConnectionsSecondlyRate = tcpConfig.NewConnectionsSecondlyRate
-		if newConnectionsSecondlyRate <= 0 {
-			newConnectionsSecondlyRate = nodeconfigs.DefaultTCPNewConnectionsSecondlyRate
-			if newConnectionsSecondlyRate <= 0 {
-				newConnectionsSecondlyRate = 10000
+		// 删除多余的和有变化的规则
+		var existRuleKeys = map[string]zero.Zero{}
+		for _, oldRule := range oldRules {
+			var pieces = this.decodeUserData(oldRule.UserData())
+			if !this.isDDoSRule(pieces) {
+				continue
 			}
-		}
-		var newConnectionsSecondlyRateBlockTimeout = tcpConfig.NewConnectionsSecondlyRateBlockTimeout
-		if newConnectionsSecondlyRateBlockTimeout < 0 {
-			newConnectionsSecondlyRateBlockTimeout = 0
+			var key = this.encodeUserData(pieces)
+			newRule, ok := newRuleMap[key]
+			if ok && utils.EqualStrings(newRule.setNames(), oldRule.DynsetSetNames()) {
+				_, isDuplicated := existRuleKeys[key]
+				if !isDuplicated {
+					existRuleKeys[key] = zero.New()
+					continue
+				}
+			}
+			err = batch.DeleteRule(oldRule)
+			if err != nil {
+				return nil, fmt.Errorf("delete rule '%s' failed: %w", key, err)
+			}
+			changes = append(changes, "delete rule '"+filter.Name+"/"+strings.Join(pieces, "_")+"'")
 		}
 
-		// 检查是否有变化
-		var hasChanges = false
-		for _, port := range ports {
-			if !this.existsRule(oldRules, []string{"tcp", types.String(port), "maxConnections", types.String(maxConnections)}) {
-				hasChanges = true
-				break
+		// 添加新的集合
+		var meterSetMap = map[string]zero.Zero{}
+		for _, meterSet := range meterSets {
+			meterSetMap[meterSet.name] = zero.New()
+			if lists.ContainsString(oldSetNames, meterSet.name) {
+				continue
 			}
-			if !this.existsRule(oldRules, []string{"tcp", types.String(port), "maxConnectionsPerIP", types.String(maxConnectionsPerIP)}) {
-				hasChanges = true
-				break
+			var keyType = nftables.TypeIPAddr
+			if filter.IsIPv6 {
+				keyType = nftables.TypeIP6Addr
 			}
-			if !this.existsRule(oldRules, []string{"tcp", types.String(port), "newConnectionsRate", types.String(newConnectionsMinutelyRate), types.String(newConnectionsMinutelyRateBlockTimeout)}) {
-				hasChanges = true
-				break
+			var options = &nftables.SetOptions{
+				KeyType: keyType,
+				Dynamic: true,
 			}
-			if !this.existsRule(oldRules, []string{"tcp", types.String(port), "newConnectionsSecondlyRate", types.String(newConnectionsSecondlyRate), types.String(newConnectionsSecondlyRateBlockTimeout)}) {
-				hasChanges = true
-				break
+			if meterSet.hasTimeout {
+				options.HasTimeout = true
+				options.Timeout = ddosMeterTimeout
 			}
-		}
-
-		if !hasChanges {
-			// 检查是否有多余的端口
-			var oldPorts = this.getTCPPorts(oldRules)
-			if !this.eqPorts(ports, oldPorts) {
-				hasChanges = true
+			err = batch.AddSet(table, meterSet.name, options)
+			if err != nil {
+				return nil, fmt.Errorf("add set '%s' failed: %w", meterSet.name, err)
 			}
+			changes = append(changes, "add set '"+filter.Name+"/"+meterSet.name+"'")
 		}
 
-		if !hasChanges {
-			return nil
-		}
-
-		// 先清空所有相关规则
-		err = this.removeOldTCPRules(chain, oldRules)
-		if err != nil {
-			return fmt.Errorf("delete old rules failed: %w", err)
-		}
-
-		// 添加新规则
-		for _, port := range ports {
-			if maxConnections > 0 {
-				var cmd = executils.NewTimeoutCmd(10*time.Second, nftExe, "add", "rule", protocol, filter.Name, nftablesChainName, "tcp", "dport", types.String(port), "ct", "count", "over", types.String(maxConnections), "counter", "drop", "comment", this.encodeUserData([]string{"tcp", types.String(port), "maxConnections", types.String(maxConnections)}))
-				cmd.WithStderr()
-				err = cmd.Run()
-				if err != nil {
-					return fmt.Errorf("add nftables rule '%s' failed: %w (%s)", cmd.String(), err, cmd.Stderr())
-				}
-			}
-
-			// TODO 让用户选择是drop还是reject
-			if maxConnectionsPerIP > 0 {
-				var cmd = executils.NewTimeoutCmd(10*time.Second, nftExe, "add", "rule", protocol, filter.Name, nftablesChainName, "tcp", "dport", types.String(port), "meter", "meter-"+protocol+"-"+types.String(port)+"-max-connections", "{ "+protocol+" saddr ct count over "+types.String(maxConnectionsPerIP)+" }", "counter", "drop", "comment", this.encodeUserData([]string{"tcp", types.String(port), "maxConnectionsPerIP", types.String(maxConnectionsPerIP)}))
-				cmd.WithStderr()
-				err := cmd.Run()
-				if err != nil {
-					return fmt.Errorf("add nftables rule '%s' failed: %w (%s)", cmd.String(), err, cmd.Stderr())
-				}
+		// 添加新的规则
+		for _, newRule := range newRules {
+			var key = this.encodeUserData(newRule.attrs)
+			_, ok := existRuleKeys[key]
+			if ok {
+				continue
 			}
+			batch.AddRule(chain, &nftables.RuleOptions{
+				Exprs:    newRule.exprs,
+				UserData: []byte(key),
+			})
+			changes = append(changes, "add rule '"+filter.Name+"/"+strings.Join(newRule.attrs, "_")+"'")
+		}
 
-			// 超过一定速率就drop或者加入黑名单（分钟）
-			// TODO 让用户选择是drop还是reject
-			if newConnectionsMinutelyRate > 0 {
-				if newConnectionsMinutelyRateBlockTimeout > 0 {
-					var cmd = executils.NewTimeoutCmd(10*time.Second, nftExe, "add", "rule", protocol, filter.Name, nftablesChainName, "tcp", "dport", types.String(port), "ct", "state", "new", "meter", "meter-"+protocol+"-"+types.String(port)+"-new-connections-rate", "{ "+protocol+" saddr limit rate over "+types.String(newConnectionsMinutelyRate)+"/minute burst "+types.String(newConnectionsMinutelyRate+3)+" packets }", "add", "@deny_set", "{"+protocol+" saddr timeout "+types.String(newConnectionsMinutelyRateBlockTimeout)+"s}", "comment", this.encodeUserData([]string{"tcp", types.String(port), "newConnectionsRate", types.String(newConnectionsMinutelyRate), types.String(newConnectionsMinutelyRateBlockTimeout)}))
-					cmd.WithStderr()
-					err := cmd.Run()
-					if err != nil {
-						return fmt.Errorf("add nftables rule '%s' failed: %w (%s)", cmd.String(), err, cmd.Stderr())
-					}
-				} else {
-					var cmd = executils.NewTimeoutCmd(10*time.Second, nftExe, "add", "rule", protocol, filter.Name, nftablesChainName, "tcp", "dport", types.String(port), "ct", "state", "new", "meter", "meter-"+protocol+"-"+types.String(port)+"-new-connections-rate", "{ "+protocol+" saddr limit rate over "+types.String(newConnectionsMinutelyRate)+"/minute burst "+types.String(newConnectionsMinutelyRate+3)+" packets }" /**"add", "@deny_set", "{"+protocol+" saddr}",**/, "counter", "drop", "comment", this.encodeUserData([]string{"tcp", types.String(port), "newConnectionsRate", "0"}))
-					cmd.WithStderr()
-					err := cmd.Run()
-					if err != nil {
-						return fmt.Errorf("add nftables rule '%s' failed: %w (%s)", cmd.String(), err, cmd.Stderr())
-					}
-				}
+		// 删除不再使用的集合，包括以前通过nft命令创建的meter
+		for _, setName := range oldSetNames {
+			if !strings.HasPrefix(setName, ddosSetPrefix) && !strings.HasPrefix(setName, "meter-") {
+				continue
 			}
-
-			// 超过一定速率就drop或者加入黑名单（秒）
-			// TODO 让用户选择是drop还是reject
-			if newConnectionsSecondlyRate > 0 {
-				if newConnectionsSecondlyRateBlockTimeout > 0 {
-					var cmd = executils.NewTimeoutCmd(10*time.Second, nftExe, "add", "rule", protocol, filter.Name, nftablesChainName, "tcp", "dport", types.String(port), "ct", "state", "new", "meter", "meter-"+protocol+"-"+types.String(port)+"-new-connections-secondly-rate", "{ "+protocol+" saddr limit rate over "+types.String(newConnectionsSecondlyRate)+"/second burst "+types.String(newConnectionsSecondlyRate+3)+" packets }", "add", "@deny_set", "{"+protocol+" saddr timeout "+types.String(newConnectionsSecondlyRateBlockTimeout)+"s}", "comment", this.encodeUserData([]string{"tcp", types.String(port), "newConnectionsSecondlyRate", types.String(newConnectionsSecondlyRate), types.String(newConnectionsSecondlyRateBlockTimeout)}))
-					cmd.WithStderr()
-					err := cmd.Run()
-					if err != nil {
-						return fmt.Errorf("add nftables rule '%s' failed: %w (%s)", cmd.String(), err, cmd.Stderr())
-					}
-				} else {
-					var cmd = executils.NewTimeoutCmd(10*time.Second, nftExe, "add", "rule", protocol, filter.Name, nftablesChainName, "tcp", "dport", types.String(port), "ct", "state", "new", "meter", "meter-"+protocol+"-"+types.String(port)+"-new-connections-secondly-rate", "{ "+protocol+" saddr limit rate over "+types.String(newConnectionsSecondlyRate)+"/second burst "+types.String(newConnectionsSecondlyRate+3)+" packets }" /**"add", "@deny_set", "{"+protocol+" saddr}",**/, "counter", "drop", "comment", this.encodeUserData([]string{"tcp", types.String(port), "newConnectionsSecondlyRate", "0"}))
-					cmd.WithStderr()
-					err := cmd.Run()
-					if err != nil {
-						return fmt.Errorf("add nftables rule '%s' failed: %w (%s)", cmd.String(), err, cmd.Stderr())
-					}
-				}
+			_, ok := meterSetMap[setName]
+			if ok {
+				continue
 			}
+			batch.DeleteSet(table, setName)
+			changes = append(changes, "delete set '"+filter.Name+"/"+setName+"'")
 		}
 	}
 
-	return nil
-}
-
-// 删除TCP规则
-func (this *DDoSProtectionManager) removeTCPRules() error {
-	for _, filter := range nftablesFilters {
-		chain, rules, err := this.getRules(filter)
-
-		// TCP
-		err = this.removeOldTCPRules(chain, rules)
-		if err != nil {
-			return err
-		}
+	if len(changes) == 0 {
+		return nil, nil
 	}
 
-	return nil
+	err = batch.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("commit nftables changes failed: %w", err)
+	}
+	return changes, nil
 }
 
 // 组合user data
@@ -397,91 +344,6 @@ func (this *DDoSProtectionManager) decodeUserData(data []byte) []string {
 	return pieces
 }
 
-// 清除规则
-func (this *DDoSProtectionManager) removeOldTCPRules(chain *nftables.Chain, rules []*nftables.Rule) error {
-	for _, rule := range rules {
-		var pieces = this.decodeUserData(rule.UserData())
-		if len(pieces) < 4 {
-			continue
-		}
-		if pieces[0] != "tcp" {
-			continue
-		}
-		switch pieces[2] {
-		case "maxConnections", "maxConnectionsPerIP", "newConnectionsRate", "newConnectionsSecondlyRate":
-			err := chain.DeleteRule(rule)
-			if err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
-}
-
-// 根据参数检查规则是否存在
-func (this *DDoSProtectionManager) existsRule(rules []*nftables.Rule, attrs []string) (exists bool) {
-	if len(attrs) == 0 {
-		return false
-	}
-	for _, oldRule := range rules {
-		var pieces = this.decodeUserData(oldRule.UserData())
-		if len(attrs) != len(pieces) {
-			continue
-		}
-		var isSame = true
-		for index, piece := range pieces {
-			if strings.TrimSpace(piece) != attrs[index] {
-				isSame = false
-				break
-			}
-		}
-		if isSame {
-			return true
-		}
-	}
-	return false
-}
-
-// 获取规则中的端口号
-func (this *DDoSProtectionManager) getTCPPorts(rules []*nftables.Rule) []int32 {
-	var ports = []int32{}
-	for _, rule := range rules {
-		var pieces = this.decodeUserData(rule.UserData())
-		if len(pieces) != 4 {
-			continue
-		}
-		if pieces[0] != "tcp" {
-			continue
-		}
-		var port = types.Int32(pieces[1])
-		if port > 0 && !lists.ContainsInt32(ports, port) {
-			ports = append(ports, port)
-		}
-	}
-	return ports
-}
-
-// 检查端口是否一样
-func (this *DDoSProtectionManager) eqPorts(ports1 []int32, ports2 []int32) bool {
-	if len(ports1) != len(ports2) {
-		return false
-	}
-
-	var portMap = map[int32]bool{}
-	for _, port := range ports2 {
-		portMap[port] = true
-	}
-
-	for _, port := range ports1 {
-		_, ok := portMap[port]
-		if !ok {
-			return false
-		}
-	}
-	return true
-}
-
 // 查找Table
 func (this *DDoSProtectionManager) getTable(filter *nftablesTableDefinition) (*nftables.Table, error) {
 	var family nftables.TableFamily
@@ -495,24 +357,11 @@ func (this *DDoSProtectionManager) getTable(filter *nftablesTableDefinition) (*n
 	return nftablesInstance.conn.GetTable(filter.Name, family)
 }
 
-// 查找所有规则
-func (this *DDoSProtectionManager) getRules(filter *nftablesTableDefinition) (*nftables.Chain, []*nftables.Rule, error) {
-	table, err := this.getTable(filter)
-	if err != nil {
-		return nil, nil, fmt.Errorf("get table failed: %w", err)
-	}
-	chain, err := table.GetChain(nftablesChainName)
-	if err != nil {
-		return nil, nil, fmt.Errorf("get chain failed: %w", err)
-	}
-	rules, err := chain.GetRules()
-	return chain, rules, err
-}
-
 // 更新白名单
-func (this *DDoSProtectionManager) updateAllowIPList(allIPList []string) error {
+// changes 中为发生变化的IP
+func (this *DDoSProtectionManager) updateAllowIPList(allIPList []string) (changes []string, err error) {
 	if nftablesInstance == nil {
-		return nil
+		return nil, nil
 	}
 
 	var allMap = map[string]zero.Zero{}
@@ -527,7 +376,7 @@ func (this *DDoSProtectionManager) updateAllowIPList(allIPList []string) error {
 		// 现有的
 		oldList, err := set.GetIPElements()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		var oldMap = map[string]zero.Zero{} // ip=> zero
 		for _, ip := range oldList {
@@ -539,8 +388,9 @@ func (this *DDoSProtectionManager) updateAllowIPList(allIPList []string) error {
 					// 不存在则删除
 					err = set.DeleteIPElement(ip)
 					if err != nil {
-						return fmt.Errorf("delete ip element '%s' failed: %w", ip, err)
+						return nil, fmt.Errorf("delete ip element '%s' failed: %w", ip, err)
 					}
+					changes = append(changes, "delete allowed ip '"+ip+"'")
 				}
 			}
 		}
@@ -557,12 +407,13 @@ func (this *DDoSProtectionManager) updateAllowIPList(allIPList []string) error {
 					// 不存在则添加
 					err = set.AddIPElement(ip, nil, false)
 					if err != nil {
-						return fmt.Errorf("add ip '%s' failed: %w", ip, err)
+						return nil, fmt.Errorf("add ip '%s' failed: %w", ip, err)
 					}
+					changes = append(changes, "add allowed ip '"+ip+"'")
 				}
 			}
 		}
 	}
 
-	return nil
+	return
 }
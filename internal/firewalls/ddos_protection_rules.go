@@ -0,0 +1,270 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+//go:build linux
+
+package firewalls
+
+import (
+	"github.com/TeaOSLab/EdgeCommon/pkg/nodeconfigs"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/ddosconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/TeaOSLab/EdgeNode/internal/firewalls/nftables"
+	"github.com/google/nftables/expr"
+	"github.com/iwind/TeaGo/lists"
+	"github.com/iwind/TeaGo/types"
+	"golang.org/x/sys/unix"
+	"time"
+)
+
+const (
+	ddosSetPrefix    = "ddos_"         // DDoS防护使用的集合名称前缀
+	ddosDenySetName  = "deny_set"      // 超出限制后加入的黑名单集合
+	ddosMeterTimeout = 2 * time.Minute // 限速集合中元素的过期时间
+)
+
+// DDoS防护规则
+type ddosRule struct {
+	attrs    []string // 保存在user data中，用来对比规则
+	exprs    []expr.Any
+	meterSet string // 用来计数的集合
+	denySet  string // 超出限制后加入的集合
+}
+
+func (this *ddosRule) setNames() []string {
+	var result = []string{}
+	if len(this.meterSet) > 0 {
+		result = append(result, this.meterSet)
+	}
+	if len(this.denySet) > 0 {
+		result = append(result, this.denySet)
+	}
+	return result
+}
+
+// DDoS防护规则使用的计数集合
+type ddosMeterSet struct {
+	name       string
+	hasTimeout bool
+}
+
+// 判断是否为DDoS防护规则
+func (this *DDoSProtectionManager) isDDoSRule(attrs []string) bool {
+	if len(attrs) < 3 {
+		return false
+	}
+	switch attrs[0] {
+	case "tcp", "udp", "icmp", "syn":
+		return true
+	}
+	return false
+}
+
+// 根据配置生成某个Table中所有的DDoS防护规则
+func (this *DDoSProtectionManager) buildRules(filter *nftablesTableDefinition, tcpConfig *ddosconfigs.TCPConfig, floodConfig *configs.DDoSFloodConfig) (rules []*ddosRule, meterSets []*ddosMeterSet) {
+	var tcpPorts = []int32{}
+	if tcpConfig != nil {
+		for _, portConfig := range tcpConfig.Ports {
+			if !lists.ContainsInt32(tcpPorts, portConfig.Port) {
+				tcpPorts = append(tcpPorts, portConfig.Port)
+			}
+		}
+	}
+	if len(tcpPorts) == 0 {
+		tcpPorts = []int32{80, 443}
+	}
+
+	var addMeterSet = func(name string, hasTimeout bool) {
+		meterSets = append(meterSets, &ddosMeterSet{
+			name:       name,
+			hasTimeout: hasTimeout,
+		})
+	}
+
+	// TCP
+	if tcpConfig != nil {
+		for _, port := range tcpPorts {
+			rules = append(rules, this.buildTCPRules(filter, tcpConfig, port)...)
+			addMeterSet(ddosSetPrefix+"c_"+types.String(port), false)
+			addMeterSet(ddosSetPrefix+"n_"+types.String(port), true)
+			addMeterSet(ddosSetPrefix+"s_"+types.String(port), true)
+		}
+	}
+
+	if floodConfig == nil {
+		return
+	}
+
+	// SYN
+	if floodConfig.SYN != nil && floodConfig.SYN.IsOn {
+		var synPorts = floodConfig.SYN.Ports
+		if len(synPorts) == 0 {
+			synPorts = tcpPorts
+		}
+		for _, port := range synPorts {
+			var meterSetName = ddosSetPrefix + "syn_" + types.String(port)
+			var matchExprs = this.joinExprs(
+				nftables.MatchL4ProtoExprs(unix.IPPROTO_TCP),
+				nftables.MatchDestPortExprs(uint16(port)),
+				nftables.MatchTCPSYNExprs(),
+			)
+
+			// 先按IP限制，防止单个IP占用所有的配额
+			rules = append(rules, this.buildMeterRule(filter, []string{"syn", types.String(port), "ratePerIP", types.String(floodConfig.SYN.SecondlyRatePerIP), types.String(floodConfig.SYN.BlockTimeout)}, matchExprs, meterSetName, nftables.RateLimitOverExprs(uint64(floodConfig.SYN.SecondlyRatePerIP), expr.LimitTimeSecond, uint32(floodConfig.SYN.SecondlyRatePerIP)), int(floodConfig.SYN.BlockTimeout)))
+			addMeterSet(meterSetName, true)
+
+			rules = append(rules, &ddosRule{
+				attrs: []string{"syn", types.String(port), "rate", types.String(floodConfig.SYN.SecondlyRate)},
+				exprs: this.joinExprs(
+					matchExprs,
+					nftables.RateLimitOverExprs(uint64(floodConfig.SYN.SecondlyRate), expr.LimitTimeSecond, uint32(floodConfig.SYN.SecondlyRate)),
+					nftables.CounterDropExprs(),
+				),
+			})
+		}
+	}
+
+	// UDP
+	if floodConfig.UDP != nil && floodConfig.UDP.IsOn {
+		var udpPorts = floodConfig.UDP.Ports
+		if len(udpPorts) == 0 {
+			udpPorts = []int32{0} // 0 表示所有端口
+		}
+		for _, port := range udpPorts {
+			var meterSetName = ddosSetPrefix + "udp"
+			var matchExprs = nftables.MatchL4ProtoExprs(unix.IPPROTO_UDP)
+			if port > 0 {
+				meterSetName += "_" + types.String(port)
+				matchExprs = this.joinExprs(matchExprs, nftables.MatchDestPortExprs(uint16(port)))
+			}
+
+			// 只限制新的会话，防止影响本机发起的请求的回应
+			matchExprs = this.joinExprs(matchExprs, nftables.MatchCtStateNewExprs())
+
+			rules = append(rules, this.buildMeterRule(filter, []string{"udp", types.String(port), "ratePerIP", types.String(floodConfig.UDP.PacketsSecondlyRate), types.String(floodConfig.UDP.BlockTimeout)}, matchExprs, meterSetName, nftables.RateLimitOverExprs(uint64(floodConfig.UDP.PacketsSecondlyRate), expr.LimitTimeSecond, uint32(floodConfig.UDP.PacketsSecondlyRate)), int(floodConfig.UDP.BlockTimeout)))
+			addMeterSet(meterSetName, true)
+		}
+	}
+
+	// ICMP
+	if floodConfig.ICMP != nil && floodConfig.ICMP.IsOn {
+		var matchExprs []expr.Any
+		if filter.IsIPv6 {
+			matchExprs = this.joinExprs(nftables.MatchL4ProtoExprs(unix.IPPROTO_ICMPV6), nftables.MatchICMPTypeExprs(128 /** echo request **/))
+		} else {
+			matchExprs = this.joinExprs(nftables.MatchL4ProtoExprs(unix.IPPROTO_ICMP), nftables.MatchICMPTypeExprs(8 /** echo request **/))
+		}
+
+		var meterSetName = ddosSetPrefix + "icmp"
+		rules = append(rules, this.buildMeterRule(filter, []string{"icmp", "0", "ratePerIP", types.String(floodConfig.ICMP.PacketsSecondlyRatePerIP)}, matchExprs, meterSetName, nftables.RateLimitOverExprs(uint64(floodConfig.ICMP.PacketsSecondlyRatePerIP), expr.LimitTimeSecond, uint32(floodConfig.ICMP.PacketsSecondlyRatePerIP)), 0))
+		addMeterSet(meterSetName, true)
+
+		rules = append(rules, &ddosRule{
+			attrs: []string{"icmp", "0", "rate", types.String(floodConfig.ICMP.PacketsSecondlyRate)},
+			exprs: this.joinExprs(
+				matchExprs,
+				nftables.RateLimitOverExprs(uint64(floodConfig.ICMP.PacketsSecondlyRate), expr.LimitTimeSecond, uint32(floodConfig.ICMP.PacketsSecondlyRate)),
+				nftables.CounterDropExprs(),
+			),
+		})
+	}
+
+	return
+}
+
+// 生成某个TCP端口的防护规则
+// TODO 让用户选择是drop还是reject
+func (this *DDoSProtectionManager) buildTCPRules(filter *nftablesTableDefinition, tcpConfig *ddosconfigs.TCPConfig, port int32) []*ddosRule {
+	// max connections
+	var maxConnections = tcpConfig.MaxConnections
+	if maxConnections <= 0 {
+		maxConnections = nodeconfigs.DefaultTCPMaxConnections
+		if maxConnections <= 0 {
+			maxConnections = 100000
+		}
+	}
+
+	// max connections per ip
+	var maxConnectionsPerIP = tcpConfig.MaxConnectionsPerIP
+	if maxConnectionsPerIP <= 0 {
+		maxConnectionsPerIP = nodeconfigs.DefaultTCPMaxConnectionsPerIP
+		if maxConnectionsPerIP <= 0 {
+			maxConnectionsPerIP = 100000
+		}
+	}
+
+	// new connections rate (minutely)
+	var newConnectionsMinutelyRate = tcpConfig.NewConnectionsMinutelyRate
+	if newConnectionsMinutelyRate <= 0 {
+		newConnectionsMinutelyRate = nodeconfigs.DefaultTCPNewConnectionsMinutelyRate
+		if newConnectionsMinutelyRate <= 0 {
+			newConnectionsMinutelyRate = 100000
+		}
+	}
+	var newConnectionsMinutelyRateBlockTimeout = tcpConfig.NewConnectionsMinutelyRateBlockTimeout
+	if newConnectionsMinutelyRateBlockTimeout < 0 {
+		newConnectionsMinutelyRateBlockTimeout = 0
+	}
+
+	// new connections rate (secondly)
+	var newConnectionsSecondlyRate = tcpConfig.NewConnectionsSecondlyRate
+	if newConnectionsSecondlyRate <= 0 {
+		newConnectionsSecondlyRate = nodeconfigs.DefaultTCPNewConnectionsSecondlyRate
+		if newConnectionsSecondlyRate <= 0 {
+			newConnectionsSecondlyRate = 10000
+		}
+	}
+	var newConnectionsSecondlyRateBlockTimeout = tcpConfig.NewConnectionsSecondlyRateBlockTimeout
+	if newConnectionsSecondlyRateBlockTimeout < 0 {
+		newConnectionsSecondlyRateBlockTimeout = 0
+	}
+
+	var portString = types.String(port)
+	var matchExprs = this.joinExprs(
+		nftables.MatchL4ProtoExprs(unix.IPPROTO_TCP),
+		nftables.MatchDestPortExprs(uint16(port)),
+	)
+	var matchNewExprs = this.joinExprs(matchExprs, nftables.MatchCtStateNewExprs())
+
+	return []*ddosRule{
+		{
+			attrs: []string{"tcp", portString, "maxConnections", types.String(maxConnections)},
+			exprs: this.joinExprs(
+				matchExprs,
+				nftables.ConnLimitOverExprs(uint32(maxConnections)),
+				nftables.CounterDropExprs(),
+			),
+		},
+		this.buildMeterRule(filter, []string{"tcp", portString, "maxConnectionsPerIP", types.String(maxConnectionsPerIP)}, matchExprs, ddosSetPrefix+"c_"+portString, nftables.ConnLimitOverExprs(uint32(maxConnectionsPerIP)), 0),
+		this.buildMeterRule(filter, []string{"tcp", portString, "newConnectionsRate", types.String(newConnectionsMinutelyRate), types.String(newConnectionsMinutelyRateBlockTimeout)}, matchNewExprs, ddosSetPrefix+"n_"+portString, nftables.RateLimitOverExprs(uint64(newConnectionsMinutelyRate), expr.LimitTimeMinute, uint32(newConnectionsMinutelyRate+3)), int(newConnectionsMinutelyRateBlockTimeout)),
+		this.buildMeterRule(filter, []string{"tcp", portString, "newConnectionsSecondlyRate", types.String(newConnectionsSecondlyRate), types.String(newConnectionsSecondlyRateBlockTimeout)}, matchNewExprs, ddosSetPrefix+"s_"+portString, nftables.RateLimitOverExprs(uint64(newConnectionsSecondlyRate), expr.LimitTimeSecond, uint32(newConnectionsSecondlyRate+3)), int(newConnectionsSecondlyRateBlockTimeout)),
+	}
+}
+
+// 生成按来源IP计数的规则，超出限制后加入黑名单或者丢弃
+func (this *DDoSProtectionManager) buildMeterRule(filter *nftablesTableDefinition, attrs []string, matchExprs []expr.Any, meterSetName string, limitExprs []expr.Any, blockTimeoutSeconds int) *ddosRule {
+	var rule = &ddosRule{
+		attrs:    attrs,
+		meterSet: meterSetName,
+	}
+
+	var exprs = this.joinExprs(
+		matchExprs,
+		nftables.LoadSourceIPExprs(filter.IsIPv6),
+		nftables.MeterExprs(meterSetName, limitExprs),
+	)
+	if blockTimeoutSeconds > 0 {
+		rule.denySet = ddosDenySetName
+		exprs = this.joinExprs(exprs, nftables.AddToSetExprs(ddosDenySetName, time.Duration(blockTimeoutSeconds)*time.Second))
+	} else {
+		exprs = this.joinExprs(exprs, nftables.CounterDropExprs())
+	}
+	rule.exprs = exprs
+	return rule
+}
+
+func (this *DDoSProtectionManager) joinExprs(exprsList ...[]expr.Any) []expr.Any {
+	var result = []expr.Any{}
+	for _, exprs := range exprsList {
+		result = append(result, exprs...)
+	}
+	return result
+}
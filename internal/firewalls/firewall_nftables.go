@@ -133,168 +133,195 @@ func (this *NFTablesFirewall) init() error {
 
 	// table
 	for _, tableDef := range nftablesFilters {
-		var family nftables.TableFamily
-		if tableDef.IsIPv4 {
-			family = nftables.TableFamilyIPv4
-		} else if tableDef.IsIPv6 {
-			family = nftables.TableFamilyIPv6
-		} else {
-			return errors.New("invalid table family: " + types.String(tableDef))
-		}
-		table, err := this.conn.GetTable(tableDef.Name, family)
+		allowSet, denySets, _, err := this.ensureTable(tableDef)
 		if err != nil {
-			if nftables.IsNotFound(err) {
-				if tableDef.IsIPv4 {
-					table, err = this.conn.AddIPv4Table(tableDef.Name)
-				} else if tableDef.IsIPv6 {
-					table, err = this.conn.AddIPv6Table(tableDef.Name)
-				}
-				if err != nil {
-					return fmt.Errorf("create table '%s' failed: %w", tableDef.Name, err)
-				}
-			} else {
-				return fmt.Errorf("get table '%s' failed: %w", tableDef.Name, err)
-			}
-		}
-		if table == nil {
-			return errors.New("can not create table '" + tableDef.Name + "'")
+			return err
 		}
+		this.updateSets(tableDef, allowSet, denySets)
+	}
 
-		// chain
-		var chainName = nftablesChainName
-		chain, err := table.GetChain(chainName)
-		if err != nil {
-			if nftables.IsNotFound(err) {
-				chain, err = table.AddAcceptChain(chainName)
+	this.isReady = true
+	nftablesIsReady = true
+	nftablesInstance = this
+
+	goman.New(func() {
+		for ipItem := range this.dropIPQueue {
+			switch ipItem.action {
+			case "drop":
+				err := this.DropSourceIP(ipItem.ip, ipItem.timeoutSeconds, false)
 				if err != nil {
-					return fmt.Errorf("create chain '%s' failed: %w", chainName, err)
+					remotelogs.Warn("NFTABLES", "drop ip '"+ipItem.ip+"' failed: "+err.Error())
 				}
-			} else {
-				return fmt.Errorf("get chain '%s' failed: %w", chainName, err)
 			}
 		}
-		if chain == nil {
-			return errors.New("can not create chain '" + chainName + "'")
-		}
+	})
 
-		// allow lo
-		var loRuleName = []byte("lo")
-		_, err = chain.GetRuleWithUserData(loRuleName)
-		if err != nil {
-			if nftables.IsNotFound(err) {
-				_, err = chain.AddAcceptInterfaceRule("lo", loRuleName)
+	// load firewalld
+	var firewalld = NewFirewalld()
+	if firewalld.IsReady() {
+		this.firewalld = firewalld
+	}
+
+	return nil
+}
+
+// 使用表中的集合
+func (this *NFTablesFirewall) updateSets(tableDef *nftablesTableDefinition, allowSet *nftables.Set, denySets []*nftables.Set) {
+	if tableDef.IsIPv4 {
+		this.allowIPv4Set = allowSet
+		this.denyIPv4Sets = denySets
+	} else if tableDef.IsIPv6 {
+		this.allowIPv6Set = allowSet
+		this.denyIPv6Sets = denySets
+	}
+}
+
+// 检查Table、Chain、集合和基础规则，不存在则创建
+// repaired 中为重新创建的对象
+func (this *NFTablesFirewall) ensureTable(tableDef *nftablesTableDefinition) (allowSet *nftables.Set, denySets []*nftables.Set, repaired []string, err error) {
+	var family nftables.TableFamily
+	if tableDef.IsIPv4 {
+		family = nftables.TableFamilyIPv4
+	} else if tableDef.IsIPv6 {
+		family = nftables.TableFamilyIPv6
+	} else {
+		return nil, nil, nil, errors.New("invalid table family: " + types.String(tableDef))
+	}
+	table, err := this.conn.GetTable(tableDef.Name, family)
+	if err != nil {
+		if nftables.IsNotFound(err) {
+			if tableDef.IsIPv4 {
+				table, err = this.conn.AddIPv4Table(tableDef.Name)
+			} else if tableDef.IsIPv6 {
+				table, err = this.conn.AddIPv6Table(tableDef.Name)
 			}
 			if err != nil {
-				return fmt.Errorf("add 'lo' rule failed: %w", err)
+				return nil, nil, nil, fmt.Errorf("create table '%s' failed: %w", tableDef.Name, err)
 			}
+			repaired = append(repaired, "table '"+tableDef.Name+"'")
+		} else {
+			return nil, nil, nil, fmt.Errorf("get table '%s' failed: %w", tableDef.Name, err)
 		}
+	}
+	if table == nil {
+		return nil, nil, nil, errors.New("can not create table '" + tableDef.Name + "'")
+	}
 
-		// allow set
-		// "allow" should be always first
-		for _, setAction := range []string{"allow", "deny", "deny1", "deny2", "deny3", "deny4"} {
-			var setName = setAction + "_set"
-
-			set, err := table.GetSet(setName)
+	// chain
+	var chainName = nftablesChainName
+	chain, err := table.GetChain(chainName)
+	if err != nil {
+		if nftables.IsNotFound(err) {
+			chain, err = table.AddAcceptChain(chainName)
 			if err != nil {
-				if nftables.IsNotFound(err) {
-					var keyType nftables.SetDataType
-					if tableDef.IsIPv4 {
-						keyType = nftables.TypeIPAddr
-					} else if tableDef.IsIPv6 {
-						keyType = nftables.TypeIP6Addr
-					}
-					set, err = table.AddSet(setName, &nftables.SetOptions{
-						KeyType:    keyType,
-						HasTimeout: true,
-					})
-					if err != nil {
-						return fmt.Errorf("create set '%s' failed: %w", setName, err)
-					}
-				} else {
-					return fmt.Errorf("get set '%s' failed: %w", setName, err)
-				}
+				return nil, nil, nil, fmt.Errorf("create chain '%s' failed: %w", chainName, err)
 			}
-			if set == nil {
-				return errors.New("can not create set '" + setName + "'")
-			}
-			if tableDef.IsIPv4 {
-				if setAction == "allow" {
-					this.allowIPv4Set = set
-				} else {
-					this.denyIPv4Sets = append(this.denyIPv4Sets, set)
+			repaired = append(repaired, "chain '"+tableDef.Name+"/"+chainName+"'")
+		} else {
+			return nil, nil, nil, fmt.Errorf("get chain '%s' failed: %w", chainName, err)
+		}
+	}
+	if chain == nil {
+		return nil, nil, nil, errors.New("can not create chain '" + chainName + "'")
+	}
+
+	// sets
+	var setActions = []string{"allow", "deny", "deny1", "deny2", "deny3", "deny4"}
+	for _, setAction := range setActions {
+		var setName = setAction + "_set"
+
+		set, err := table.GetSet(setName)
+		if err != nil {
+			if nftables.IsNotFound(err) {
+				var keyType nftables.SetDataType
+				if tableDef.IsIPv4 {
+					keyType = nftables.TypeIPAddr
+				} else if tableDef.IsIPv6 {
+					keyType = nftables.TypeIP6Addr
 				}
-			} else if tableDef.IsIPv6 {
-				if setAction == "allow" {
-					this.allowIPv6Set = set
-				} else {
-					this.denyIPv6Sets = append(this.denyIPv6Sets, set)
+				set, err = table.AddSet(setName, &nftables.SetOptions{
+					KeyType:    keyType,
+					HasTimeout: true,
+				})
+				if err != nil {
+					return nil, nil, nil, fmt.Errorf("create set '%s' failed: %w", setName, err)
 				}
+				repaired = append(repaired, "set '"+tableDef.Name+"/"+setName+"'")
+			} else {
+				return nil, nil, nil, fmt.Errorf("get set '%s' failed: %w", setName, err)
 			}
+		}
+		if set == nil {
+			return nil, nil, nil, errors.New("can not create set '" + setName + "'")
+		}
+		if setAction == "allow" {
+			allowSet = set
+		} else {
+			denySets = append(denySets, set)
+		}
+	}
 
-			// rule
-			var ruleName = []byte(setAction)
-			rule, err := chain.GetRuleWithUserData(ruleName)
-
-			// 将以前的drop规则删掉，替换成后面的reject
-			if err == nil && setAction != "allow" && rule != nil && rule.VerDict() == expr.VerdictDrop {
-				deleteErr := chain.DeleteRule(rule)
-				if deleteErr == nil {
-					err = nftables.ErrRuleNotFound
-					rule = nil
-				}
+	// rules
+	// "lo" and "allow" should be always first, so we add the missing rules right after the previous base rule
+	var ruleNames = append([]string{"lo"}, setActions...)
+	var prevRule *nftables.Rule
+	for _, ruleName := range ruleNames {
+		var userData = []byte(ruleName)
+		rule, err := chain.GetRuleWithUserData(userData)
+		if err != nil {
+			if !nftables.IsNotFound(err) {
+				return nil, nil, nil, fmt.Errorf("get rule failed: %w", err)
 			}
+			rule = nil
+		}
 
+		// 将以前的drop规则删掉，替换成后面的reject
+		if rule != nil && ruleName != "lo" && ruleName != "allow" && rule.VerDict() == expr.VerdictDrop {
+			err = chain.DeleteRule(rule)
 			if err != nil {
-				if nftables.IsNotFound(err) {
-					if tableDef.IsIPv4 {
-						if setAction == "allow" {
-							rule, err = chain.AddAcceptIPv4SetRule(setName, ruleName)
-						} else {
-							rule, err = chain.AddRejectIPv4SetRule(setName, ruleName)
-						}
-					} else if tableDef.IsIPv6 {
-						if setAction == "allow" {
-							rule, err = chain.AddAcceptIPv6SetRule(setName, ruleName)
-						} else {
-							rule, err = chain.AddRejectIPv6SetRule(setName, ruleName)
-						}
-					}
-					if err != nil {
-						return fmt.Errorf("add rule failed: %w", err)
-					}
-				} else {
-					return fmt.Errorf("get rule failed: %w", err)
-				}
-			}
-			if rule == nil {
-				return errors.New("can not create rule '" + string(ruleName) + "'")
+				return nil, nil, nil, fmt.Errorf("delete '%s' rule failed: %w", ruleName, err)
 			}
+			rule = nil
 		}
-	}
 
-	this.isReady = true
-	nftablesIsReady = true
-	nftablesInstance = this
+		if rule != nil {
+			prevRule = rule
+			continue
+		}
 
-	goman.New(func() {
-		for ipItem := range this.dropIPQueue {
-			switch ipItem.action {
-			case "drop":
-				err := this.DropSourceIP(ipItem.ip, ipItem.timeoutSeconds, false)
-				if err != nil {
-					remotelogs.Warn("NFTABLES", "drop ip '"+ipItem.ip+"' failed: "+err.Error())
-				}
+		var setName = ruleName + "_set"
+		var positionChain = chain.At(prevRule)
+		if ruleName == "lo" {
+			rule, err = positionChain.AddAcceptInterfaceRule("lo", userData)
+		} else if tableDef.IsIPv4 {
+			if ruleName == "allow" {
+				rule, err = positionChain.AddAcceptIPv4SetRule(setName, userData)
+			} else {
+				rule, err = positionChain.AddRejectIPv4SetRule(setName, userData)
+			}
+		} else if tableDef.IsIPv6 {
+			if ruleName == "allow" {
+				rule, err = positionChain.AddAcceptIPv6SetRule(setName, userData)
+			} else {
+				rule, err = positionChain.AddRejectIPv6SetRule(setName, userData)
 			}
 		}
-	})
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("add '%s' rule failed: %w", ruleName, err)
+		}
+		if rule == nil {
+			return nil, nil, nil, errors.New("can not create rule '" + ruleName + "'")
+		}
+		repaired = append(repaired, "rule '"+tableDef.Name+"/"+chainName+"/"+ruleName+"'")
 
-	// load firewalld
-	var firewalld = NewFirewalld()
-	if firewalld.IsReady() {
-		this.firewalld = firewalld
+		// 重新读取规则以获得规则的Handle，用来确定下一个规则的位置
+		prevRule, err = chain.GetRuleWithUserData(userData)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("get rule failed: %w", err)
+		}
 	}
 
-	return nil
+	return
 }
 
 // Name 名称
@@ -386,22 +413,11 @@ func (this *NFTablesFirewall) DropSourceIP(ip string, timeoutSeconds int, async
 	// 再次尝试关闭连接
 	defer conns.SharedMap.CloseIPConns(ip)
 
-	if strings.Contains(ip, ":") { // ipv6
-		if len(this.denyIPv6Sets) == 0 {
-			return errors.New("ipv6 ip set not found")
-		}
-		var setIndex = iputils.ParseIP(ip).Mod(len(this.denyIPv6Sets))
-		return this.denyIPv6Sets[setIndex].AddElement(data.To16(), &nftables.ElementOptions{
-			Timeout: time.Duration(timeoutSeconds) * time.Second,
-		}, false)
-	}
-
-	// ipv4
-	if len(this.denyIPv4Sets) == 0 {
-		return errors.New("ipv4 ip set not found")
+	set, key, err := this.denySetForIP(ip)
+	if err != nil {
+		return err
 	}
-	var setIndex = iputils.ParseIP(ip).Mod(len(this.denyIPv4Sets))
-	return this.denyIPv4Sets[setIndex].AddElement(data.To4(), &nftables.ElementOptions{
+	return set.AddElement(key, &nftables.ElementOptions{
 		Timeout: time.Duration(timeoutSeconds) * time.Second,
 	}, false)
 }
@@ -0,0 +1,295 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+//go:build linux
+
+package firewalls
+
+import (
+	"errors"
+	"github.com/TeaOSLab/EdgeCommon/pkg/iputils"
+	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
+	"github.com/TeaOSLab/EdgeNode/internal/events"
+	"github.com/TeaOSLab/EdgeNode/internal/firewalls/nftables"
+	"github.com/TeaOSLab/EdgeNode/internal/goman"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeNode/internal/zero"
+	"github.com/iwind/TeaGo/types"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	nftablesReconcileInterval = 5 * time.Minute // 检查内核中状态的间隔
+	nftablesMaxLoggedDrifts   = 10              // 日志中最多显示的不一致项
+)
+
+var nftablesReconcileOnce = sync.Once{}
+
+func init() {
+	if !teaconst.IsMain {
+		return
+	}
+
+	// 定期检查内核中的状态，防止被其他工具或者 'nft flush ruleset' 清除
+	events.On(events.EventNFTablesReady, func() {
+		nftablesReconcileOnce.Do(func() {
+			goman.New(func() {
+				var ticker = time.NewTicker(nftablesReconcileInterval)
+				for range ticker.C {
+					var firewall = nftablesInstance
+					if firewall == nil {
+						continue
+					}
+					repaired, err := firewall.Reconcile()
+					if err != nil {
+						remotelogs.Warn("FIREWALL", "reconcile nftables failed: "+err.Error())
+						continue
+					}
+					if len(repaired) > 0 {
+						remotelogs.Warn("FIREWALL", "nftables state drifted from node, repaired: "+firewall.summarizeDrifts(repaired))
+					}
+				}
+			})
+		})
+	})
+}
+
+// Reconcile 对比节点中的状态和内核中的状态，修复不一致的地方
+func (this *NFTablesFirewall) Reconcile() (repaired []string, err error) {
+	// 表、链、集合和基础规则
+	for _, tableDef := range nftablesFilters {
+		allowSet, denySets, tableRepaired, err := this.ensureTable(tableDef)
+		if err != nil {
+			return nil, err
+		}
+		this.updateSets(tableDef, allowSet, denySets)
+		repaired = append(repaired, tableRepaired...)
+	}
+
+	// 黑名单
+	deniedRepaired, err := this.reconcileDeniedIPs()
+	if err != nil {
+		return nil, err
+	}
+	repaired = append(repaired, deniedRepaired...)
+
+	// 白名单和DDoS防护规则
+	ddosRepaired, err := SharedDDoSProtectionManager.Reconcile()
+	if err != nil {
+		return nil, err
+	}
+	repaired = append(repaired, ddosRepaired...)
+
+	return
+}
+
+// ExportState 导出当前内核中的状态
+func (this *NFTablesFirewall) ExportState() (*FirewallState, error) {
+	var now = time.Now()
+	var state = &FirewallState{
+		Firewall:  this.Name(),
+		CreatedAt: now.Unix(),
+		DenyIPs:   []*FirewallStateIP{},
+		AllowIPs:  []string{},
+		DDoSRules: []string{},
+	}
+
+	// 黑名单
+	var denyIPMap = map[string]zero.Zero{}
+	for _, sets := range [][]*nftables.Set{this.denyIPv4Sets, this.denyIPv6Sets} {
+		for _, set := range sets {
+			elements, err := set.ListIPElements()
+			if err != nil {
+				return nil, err
+			}
+			for _, element := range elements {
+				_, ok := denyIPMap[element.IP]
+				if ok {
+					continue
+				}
+				denyIPMap[element.IP] = zero.New()
+
+				var expiresAt int64
+				if element.Expires > 0 {
+					expiresAt = now.Add(element.Expires).Unix() + 1
+				}
+				state.DenyIPs = append(state.DenyIPs, &FirewallStateIP{
+					IP:        element.IP,
+					ExpiresAt: expiresAt,
+				})
+			}
+		}
+	}
+
+	// 白名单
+	for _, set := range []*nftables.Set{this.allowIPv4Set, this.allowIPv6Set} {
+		if set == nil {
+			continue
+		}
+		ips, err := set.GetIPElements()
+		if err != nil {
+			return nil, err
+		}
+		state.AllowIPs = append(state.AllowIPs, ips...)
+	}
+
+	// DDoS防护规则
+	for _, filter := range nftablesFilters {
+		table, err := SharedDDoSProtectionManager.getTable(filter)
+		if err != nil {
+			return nil, err
+		}
+		chain, err := table.GetChain(nftablesChainName)
+		if err != nil {
+			return nil, err
+		}
+		rules, err := chain.GetRules()
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range rules {
+			var pieces = SharedDDoSProtectionManager.decodeUserData(rule.UserData())
+			if SharedDDoSProtectionManager.isDDoSRule(pieces) {
+				state.DDoSRules = append(state.DDoSRules, filter.Name+"/"+strings.Join(pieces, "_"))
+			}
+		}
+	}
+
+	return state, nil
+}
+
+// RestoreState 恢复状态，返回恢复的IP数量
+// 只恢复黑名单，白名单和DDoS防护规则以当前的DDoS防护配置为准
+func (this *NFTablesFirewall) RestoreState(state *FirewallState) (countIPs int, err error) {
+	// 先恢复表、链和规则
+	_, err = this.Reconcile()
+	if err != nil {
+		return 0, err
+	}
+
+	var now = time.Now().Unix()
+	for _, ipItem := range state.DenyIPs {
+		var timeoutSeconds int64
+		if ipItem.ExpiresAt > 0 {
+			timeoutSeconds = ipItem.ExpiresAt - now
+			if timeoutSeconds <= 0 {
+				continue
+			}
+		}
+		err = this.DropSourceIP(ipItem.IP, types.Int(timeoutSeconds), false)
+		if err != nil {
+			return countIPs, err
+		}
+		countIPs++
+	}
+
+	return countIPs, nil
+}
+
+// 重新添加在内核中丢失的黑名单IP
+func (this *NFTablesFirewall) reconcileDeniedIPs() (repaired []string, err error) {
+	if deniedIPsFunc == nil {
+		return nil, nil
+	}
+	var deniedIPs = deniedIPsFunc()
+	if len(deniedIPs) == 0 {
+		return nil, nil
+	}
+
+	// 内核中现有的IP
+	var existIPMap = map[string]zero.Zero{}
+	for _, sets := range [][]*nftables.Set{this.denyIPv4Sets, this.denyIPv6Sets} {
+		for _, set := range sets {
+			ips, err := set.GetIPElements()
+			if err != nil {
+				return nil, err
+			}
+			for _, ip := range ips {
+				existIPMap[ip] = zero.New()
+			}
+		}
+	}
+
+	var missingIPMap = findMissingDeniedIPs(deniedIPs, existIPMap, time.Now().Unix())
+	if len(missingIPMap) == 0 {
+		return nil, nil
+	}
+
+	// 使用单独的连接，防止和其他的nftables操作混在一起提交
+	conn, err := nftables.NewConn()
+	if err != nil {
+		return nil, err
+	}
+	var batch = nftables.NewBatch(conn)
+
+	type missingIP struct {
+		set     *nftables.Set
+		key     []byte
+		options *nftables.ElementOptions
+	}
+	var missingIPs = []*missingIP{}
+	for ip, timeoutSeconds := range missingIPMap {
+		var options = &nftables.ElementOptions{
+			Timeout: time.Duration(timeoutSeconds) * time.Second,
+		}
+		set, key, err := this.denySetForIP(ip)
+		if err != nil {
+			continue
+		}
+		err = batch.AddSetElement(set, key, options)
+		if err != nil {
+			return nil, err
+		}
+		missingIPs = append(missingIPs, &missingIP{
+			set:     set,
+			key:     key,
+			options: options,
+		})
+		repaired = append(repaired, "add denied ip '"+ip+"'")
+	}
+	if len(missingIPs) == 0 {
+		return nil, nil
+	}
+
+	err = batch.Commit()
+	if err != nil {
+		// 可能有IP在此期间已经被加入，逐个重试
+		for _, ipItem := range missingIPs {
+			err = ipItem.set.AddElement(ipItem.key, ipItem.options, false)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return repaired, nil
+}
+
+// 查找IP对应的黑名单集合
+func (this *NFTablesFirewall) denySetForIP(ip string) (set *nftables.Set, key []byte, err error) {
+	var data = net.ParseIP(ip)
+	if data == nil {
+		return nil, nil, errors.New("invalid ip '" + ip + "'")
+	}
+
+	if strings.Contains(ip, ":") { // ipv6
+		if len(this.denyIPv6Sets) == 0 {
+			return nil, nil, errors.New("ipv6 ip set not found")
+		}
+		return this.denyIPv6Sets[iputils.ParseIP(ip).Mod(len(this.denyIPv6Sets))], data.To16(), nil
+	}
+
+	if len(this.denyIPv4Sets) == 0 {
+		return nil, nil, errors.New("ipv4 ip set not found")
+	}
+	return this.denyIPv4Sets[iputils.ParseIP(ip).Mod(len(this.denyIPv4Sets))], data.To4(), nil
+}
+
+// 合并不一致项用于日志
+func (this *NFTablesFirewall) summarizeDrifts(drifts []string) string {
+	if len(drifts) <= nftablesMaxLoggedDrifts {
+		return strings.Join(drifts, ", ")
+	}
+	return strings.Join(drifts[:nftablesMaxLoggedDrifts], ", ") + " ... (" + types.String(len(drifts)-nftablesMaxLoggedDrifts) + " more)"
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package firewalls
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/zero"
+	"net"
+	"os"
+)
+
+// FirewallState 本地防火墙中由节点管理的状态
+type FirewallState struct {
+	Firewall  string             `json:"firewall"`  // 防火墙名称
+	CreatedAt int64              `json:"createdAt"` // 导出时间
+	DenyIPs   []*FirewallStateIP `json:"denyIPs"`   // 黑名单中的IP
+	AllowIPs  []string           `json:"allowIPs"`  // 白名单中的IP，只用来查看，白名单以DDoS防护配置中的为准
+	DDoSRules []string           `json:"ddosRules"` // DDoS防护规则，只用来查看，恢复时会根据当前的DDoS防护配置重新生成
+}
+
+// FirewallStateIP 黑名单中的IP
+type FirewallStateIP struct {
+	IP        string `json:"ip"`
+	ExpiresAt int64  `json:"expiresAt"` // 过期时间，为0表示不过期
+}
+
+// WriteFile 保存到文件
+func (this *FirewallState) WriteFile(path string) error {
+	data, err := json.MarshalIndent(this, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// ReadFirewallStateFile 从文件中读取防火墙状态
+func ReadFirewallStateFile(path string) (*FirewallState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state = &FirewallState{}
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// DecodeFirewallState 从命令参数中解析防火墙状态
+func DecodeFirewallState(data any) (*FirewallState, error) {
+	if data == nil {
+		return nil, errors.New("'state' required")
+	}
+	stateJSON, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var state = &FirewallState{}
+	err = json.Unmarshal(stateJSON, state)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// DeniedIPsFunc 获取应该在本地防火墙中拦截的IP：ip => 在本地防火墙中的过期时间
+type DeniedIPsFunc func() map[string]int64
+
+var deniedIPsFunc DeniedIPsFunc
+
+// SetDeniedIPsFunc 设置获取拦截IP的函数，用来检查内核中的黑名单是否完整
+func SetDeniedIPsFunc(f DeniedIPsFunc) {
+	deniedIPsFunc = f
+}
+
+// 查找在内核中丢失的黑名单IP，返回 ip => 剩余秒数
+func findMissingDeniedIPs(deniedIPs map[string]int64, existIPMap map[string]zero.Zero, now int64) map[string]int64 {
+	var result = map[string]int64{}
+	for ip, expiresAt := range deniedIPs {
+		if expiresAt <= now {
+			continue
+		}
+
+		// 和内核中返回的IP格式保持一致
+		var data = net.ParseIP(ip)
+		if data == nil {
+			continue
+		}
+		ip = data.String()
+
+		_, ok := existIPMap[ip]
+		if ok {
+			continue
+		}
+		result[ip] = expiresAt - now
+	}
+	return result
+}
+
+// StatefulFirewallInterface 可以导出、恢复和修复状态的防火墙
+type StatefulFirewallInterface interface {
+	// ExportState 导出当前内核中的状态
+	ExportState() (*FirewallState, error)
+
+	// RestoreState 恢复状态，返回恢复的IP数量
+	RestoreState(state *FirewallState) (countIPs int, err error)
+
+	// Reconcile 对比节点中的状态和内核中的状态，修复不一致的地方
+	Reconcile() (repaired []string, err error)
+}
+
+// ExportState 导出当前防火墙的状态
+func ExportState() (*FirewallState, error) {
+	statefulFirewall, ok := Firewall().(StatefulFirewallInterface)
+	if !ok {
+		return nil, errors.New("firewall '" + Firewall().Name() + "' does not support exporting state")
+	}
+	return statefulFirewall.ExportState()
+}
+
+// RestoreState 恢复当前防火墙的状态
+func RestoreState(state *FirewallState) (countIPs int, err error) {
+	if state == nil {
+		return 0, errors.New("invalid state")
+	}
+	statefulFirewall, ok := Firewall().(StatefulFirewallInterface)
+	if !ok {
+		return 0, errors.New("firewall '" + Firewall().Name() + "' does not support restoring state")
+	}
+	return statefulFirewall.RestoreState(state)
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package firewalls
+
+import (
+	"encoding/json"
+	"github.com/TeaOSLab/EdgeNode/internal/zero"
+	"github.com/iwind/TeaGo/assert"
+	"github.com/iwind/TeaGo/maps"
+	"testing"
+)
+
+func TestDecodeFirewallState(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var state = &FirewallState{
+		Firewall:  "nftables",
+		CreatedAt: 1700000000,
+		DenyIPs: []*FirewallStateIP{
+			{IP: "192.0.2.1", ExpiresAt: 1700003600},
+			{IP: "2001:db8::1"},
+		},
+		AllowIPs:  []string{"192.0.2.100"},
+		DDoSRules: []string{"edge_ipv4/tcp_80"},
+	}
+
+	// 模拟通过命令参数传递
+	stateJSON, err := json.Marshal(maps.Map{"state": state})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var params = maps.Map{}
+	err = json.Unmarshal(stateJSON, &params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decodedState, err := DecodeFirewallState(params["state"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(decodedState.Firewall == "nftables")
+	a.IsTrue(decodedState.CreatedAt == 1700000000)
+	a.IsTrue(len(decodedState.DenyIPs) == 2)
+	a.IsTrue(decodedState.DenyIPs[0].IP == "192.0.2.1")
+	a.IsTrue(decodedState.DenyIPs[0].ExpiresAt == 1700003600)
+	a.IsTrue(decodedState.DenyIPs[1].ExpiresAt == 0)
+	a.IsTrue(len(decodedState.AllowIPs) == 1)
+	a.IsTrue(len(decodedState.DDoSRules) == 1)
+
+	_, err = DecodeFirewallState(nil)
+	a.IsTrue(err != nil)
+
+	_, err = DecodeFirewallState("invalid")
+	a.IsTrue(err != nil)
+}
+
+func TestFirewallState_WriteFile(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var path = t.TempDir() + "/firewall.json"
+	var state = &FirewallState{
+		Firewall: "nftables",
+		DenyIPs: []*FirewallStateIP{
+			{IP: "192.0.2.1", ExpiresAt: 1700003600},
+		},
+	}
+	err := state.WriteFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newState, err := ReadFirewallStateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(newState.Firewall == "nftables")
+	a.IsTrue(len(newState.DenyIPs) == 1)
+	a.IsTrue(newState.DenyIPs[0].IP == "192.0.2.1")
+}
+
+func TestFindMissingDeniedIPs(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var now int64 = 1700000000
+	var missingIPs = findMissingDeniedIPs(map[string]int64{
+		"192.0.2.1":            now + 60,
+		"192.0.2.2":            now + 120,
+		"192.0.2.3":            now, // 已过期
+		"2001:0db8:0000::0001": now + 30,
+		"2001:db8::2":          now + 30,
+		"invalid":              now + 30,
+	}, map[string]zero.Zero{
+		"192.0.2.2":   zero.New(),
+		"2001:db8::2": zero.New(),
+	}, now)
+	a.IsTrue(len(missingIPs) == 2)
+	a.IsTrue(missingIPs["192.0.2.1"] == 60)
+	a.IsTrue(missingIPs["2001:db8::1"] == 30)
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+//go:build linux
+
+package nftables
+
+import (
+	"errors"
+	nft "github.com/google/nftables"
+	"github.com/iwind/TeaGo/types"
+)
+
+// Batch 批量修改集合和规则，所有修改在Commit时一次性原子提交
+// 为了防止和其他操作互相影响，建议使用单独的Conn
+type Batch struct {
+	conn *Conn
+}
+
+func NewBatch(conn *Conn) *Batch {
+	return &Batch{
+		conn: conn,
+	}
+}
+
+func (this *Batch) AddSet(table *Table, name string, options *SetOptions) error {
+	if len(name) > MaxSetNameLength {
+		return errors.New("set name too long (max " + types.String(MaxSetNameLength) + ")")
+	}
+	if options == nil {
+		options = &SetOptions{}
+	}
+	return this.conn.Raw().AddSet(&nft.Set{
+		Table:      table.Raw(),
+		Name:       name,
+		Interval:   options.Interval,
+		Dynamic:    options.Dynamic,
+		HasTimeout: options.HasTimeout,
+		Timeout:    options.Timeout,
+		KeyType:    options.KeyType,
+		DataType:   options.DataType,
+	}, nil)
+}
+
+func (this *Batch) DeleteSet(table *Table, name string) {
+	this.conn.Raw().DelSet(&nft.Set{
+		Table: table.Raw(),
+		Name:  name,
+	})
+}
+
+func (this *Batch) AddSetElement(set *Set, key []byte, options *ElementOptions) error {
+	var rawElement = nft.SetElement{
+		Key: key,
+	}
+	if options != nil {
+		rawElement.Timeout = options.Timeout
+	}
+	return this.conn.Raw().SetAddElements(set.Raw(), []nft.SetElement{
+		rawElement,
+	})
+}
+
+func (this *Batch) AddRule(chain *Chain, options *RuleOptions) {
+	this.conn.Raw().AddRule(&nft.Rule{
+		Table:    chain.rawTable,
+		Chain:    chain.rawChain,
+		Exprs:    options.Exprs,
+		UserData: options.UserData,
+	})
+}
+
+func (this *Batch) DeleteRule(rule *Rule) error {
+	return this.conn.Raw().DelRule(rule.Raw())
+}
+
+func (this *Batch) Commit() error {
+	return this.conn.Commit()
+}
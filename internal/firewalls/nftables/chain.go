@@ -22,6 +22,12 @@ type Chain struct {
 	conn     *Conn
 	rawTable *nft.Table
 	rawChain *nft.Chain
+
+	position *rulePosition // 添加规则的位置，为nil时添加到链的末尾
+}
+
+type rulePosition struct {
+	after *Rule
 }
 
 func NewChain(conn *Conn, rawTable *nft.Table, rawChain *nft.Chain) *Chain {
@@ -40,13 +46,33 @@ func (this *Chain) Name() string {
 	return this.rawChain.Name
 }
 
+// At 获取在某个规则之后添加规则的Chain，after为nil时添加到链的最前面
+func (this *Chain) At(after *Rule) *Chain {
+	return &Chain{
+		conn:     this.conn,
+		rawTable: this.rawTable,
+		rawChain: this.rawChain,
+		position: &rulePosition{
+			after: after,
+		},
+	}
+}
+
 func (this *Chain) AddRule(options *RuleOptions) (*Rule, error) {
-	var rawRule = this.conn.Raw().AddRule(&nft.Rule{
+	var rawRule = &nft.Rule{
 		Table:    this.rawTable,
 		Chain:    this.rawChain,
 		Exprs:    options.Exprs,
 		UserData: options.UserData,
-	})
+	}
+	if this.position == nil {
+		rawRule = this.conn.Raw().AddRule(rawRule)
+	} else if this.position.after == nil {
+		rawRule = this.conn.Raw().InsertRule(rawRule)
+	} else {
+		rawRule.Position = this.position.after.Handle()
+		rawRule = this.conn.Raw().AddRule(rawRule)
+	}
 	err := this.conn.Commit()
 	if err != nil {
 		return nil, err
@@ -32,6 +32,18 @@ func (this *Rule) LookupSetName() string {
 	return ""
 }
 
+// DynsetSetNames 规则中动态更新的集合名称
+func (this *Rule) DynsetSetNames() []string {
+	var result = []string{}
+	for _, e := range this.rawRule.Exprs {
+		exp, ok := e.(*expr.Dynset)
+		if ok {
+			result = append(result, exp.SetName)
+		}
+	}
+	return result
+}
+
 func (this *Rule) VerDict() expr.VerdictKind {
 	for _, e := range this.rawRule.Exprs {
 		exp, ok := e.(*expr.Verdict)
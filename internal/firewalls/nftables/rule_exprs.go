@@ -0,0 +1,188 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+//go:build linux
+
+package nftables
+
+import (
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+	"time"
+)
+
+// NFT_CONNLIMIT_F_INV
+const connLimitFlagInvert uint32 = 1
+
+// MatchL4ProtoExprs 匹配传输层协议，比如 unix.IPPROTO_TCP
+func MatchL4ProtoExprs(proto byte) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{
+			Key:      expr.MetaKeyL4PROTO,
+			Register: 1,
+		},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     []byte{proto},
+		},
+	}
+}
+
+// MatchDestPortExprs 匹配TCP或UDP的目标端口，需要先匹配传输层协议
+func MatchDestPortExprs(port uint16) []expr.Any {
+	return []expr.Any{
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseTransportHeader,
+			Offset:       2,
+			Len:          2,
+		},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     binaryutil.BigEndian.PutUint16(port),
+		},
+	}
+}
+
+// MatchTCPSYNExprs 匹配只有SYN标记的TCP包，需要先匹配TCP协议
+func MatchTCPSYNExprs() []expr.Any {
+	return []expr.Any{
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseTransportHeader,
+			Offset:       13,
+			Len:          1,
+		},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            1,
+			Mask:           []byte{0x12}, // SYN | ACK
+			Xor:            []byte{0x00},
+		},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     []byte{0x02}, // SYN
+		},
+	}
+}
+
+// MatchICMPTypeExprs 匹配ICMP类型，需要先匹配ICMP协议
+func MatchICMPTypeExprs(icmpType byte) []expr.Any {
+	return []expr.Any{
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseTransportHeader,
+			Offset:       0,
+			Len:          1,
+		},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     []byte{icmpType},
+		},
+	}
+}
+
+// MatchCtStateNewExprs 匹配新的连接
+func MatchCtStateNewExprs() []expr.Any {
+	return []expr.Any{
+		&expr.Ct{
+			Key:      expr.CtKeySTATE,
+			Register: 1,
+		},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            4,
+			Mask:           binaryutil.NativeEndian.PutUint32(expr.CtStateBitNEW),
+			Xor:            binaryutil.NativeEndian.PutUint32(0),
+		},
+		&expr.Cmp{
+			Op:       expr.CmpOpNeq,
+			Register: 1,
+			Data:     []byte{0, 0, 0, 0},
+		},
+	}
+}
+
+// LoadSourceIPExprs 将来源IP加载到寄存器1中
+func LoadSourceIPExprs(isIPv6 bool) []expr.Any {
+	if isIPv6 {
+		return []expr.Any{
+			&expr.Payload{
+				DestRegister: 1,
+				Base:         expr.PayloadBaseNetworkHeader,
+				Offset:       8,
+				Len:          16,
+			},
+		}
+	}
+	return []expr.Any{
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseNetworkHeader,
+			Offset:       12,
+			Len:          4,
+		},
+	}
+}
+
+// ConnLimitOverExprs 连接数超出限制，需要和 expr.Dynset 一起使用时才按来源IP计数
+func ConnLimitOverExprs(count uint32) []expr.Any {
+	return []expr.Any{
+		&expr.Connlimit{
+			Count: count,
+			Flags: connLimitFlagInvert,
+		},
+	}
+}
+
+// RateLimitOverExprs 包速率超出限制
+func RateLimitOverExprs(rate uint64, unit expr.LimitTime, burst uint32) []expr.Any {
+	return []expr.Any{
+		&expr.Limit{
+			Type:  expr.LimitTypePkts,
+			Rate:  rate,
+			Over:  true,
+			Unit:  unit,
+			Burst: burst,
+		},
+	}
+}
+
+// MeterExprs 以寄存器1中的值为Key在动态集合中执行表达式，表达式匹配时才继续
+func MeterExprs(setName string, exprs []expr.Any) []expr.Any {
+	return []expr.Any{
+		&expr.Dynset{
+			SrcRegKey: 1,
+			SetName:   setName,
+			Operation: unix.NFT_DYNSET_OP_UPDATE,
+			Exprs:     exprs,
+		},
+	}
+}
+
+// AddToSetExprs 将寄存器1中的值加入到集合中
+func AddToSetExprs(setName string, timeout time.Duration) []expr.Any {
+	return []expr.Any{
+		&expr.Dynset{
+			SrcRegKey: 1,
+			SetName:   setName,
+			Operation: unix.NFT_DYNSET_OP_ADD,
+			Timeout:   timeout,
+		},
+	}
+}
+
+// CounterDropExprs 计数并丢弃
+func CounterDropExprs() []expr.Any {
+	return []expr.Any{
+		&expr.Counter{},
+		&expr.Verdict{
+			Kind: expr.VerdictDrop,
+		},
+	}
+}
@@ -24,12 +24,19 @@ type SetOptions struct {
 	Interval   bool
 	Anonymous  bool
 	IsMap      bool
+	Dynamic    bool // 可以在规则中动态添加元素
 }
 
 type ElementOptions struct {
 	Timeout time.Duration
 }
 
+// IPElement IP元素信息
+type IPElement struct {
+	IP      string
+	Expires time.Duration // 剩余有效时间，为0表示不会过期
+}
+
 type Set struct {
 	conn   *Conn
 	rawSet *nft.Set
@@ -199,6 +206,23 @@ func (this *Set) GetIPElements() ([]string, error) {
 	return result, nil
 }
 
+// ListIPElements 列出所有IP元素及其剩余有效时间
+func (this *Set) ListIPElements() ([]*IPElement, error) {
+	elements, err := this.conn.Raw().GetSetElements(this.rawSet)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = []*IPElement{}
+	for _, element := range elements {
+		result = append(result, &IPElement{
+			IP:      net.IP(element.Key).String(),
+			Expires: element.Expires,
+		})
+	}
+	return result, nil
+}
+
 // not work current time
 /**func (this *Set) Flush() error {
 	this.conn.Raw().FlushSet(this.rawSet)
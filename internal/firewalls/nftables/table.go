@@ -103,6 +103,18 @@ func (this *Table) GetSet(name string) (*Set, error) {
 	return NewSet(this.conn, rawSet), nil
 }
 
+func (this *Table) GetSetNames() ([]string, error) {
+	rawSets, err := this.conn.Raw().GetSets(this.rawTable)
+	if err != nil {
+		return nil, err
+	}
+	var result = []string{}
+	for _, rawSet := range rawSets {
+		result = append(result, rawSet.Name)
+	}
+	return result, nil
+}
+
 func (this *Table) AddSet(name string, options *SetOptions) (*Set, error) {
 	if len(name) > MaxSetNameLength {
 		return nil, errors.New("set name too long (max " + types.String(MaxSetNameLength) + ")")
@@ -119,6 +131,7 @@ func (this *Table) AddSet(name string, options *SetOptions) (*Set, error) {
 		Constant:   options.Constant,
 		Interval:   options.Interval,
 		IsMap:      options.IsMap,
+		Dynamic:    options.Dynamic,
 		HasTimeout: options.HasTimeout,
 		Timeout:    options.Timeout,
 		KeyType:    options.KeyType,
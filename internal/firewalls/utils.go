@@ -6,20 +6,23 @@ import (
 	"time"
 )
 
-// DropTemporaryTo 使用本地防火墙临时拦截IP数据包
-func DropTemporaryTo(ip string, expiresAt int64) {
+// TemporaryExpiresAt 临时拦截的IP在本地防火墙中的过期时间，最长为一个小时
+func TemporaryExpiresAt(expiresAt int64) int64 {
+	var maxExpiresAt = time.Now().Unix() + 3600
+
 	// 如果为0，则表示是长期有效
-	if expiresAt <= 0 {
-		expiresAt = time.Now().Unix() + 3600
+	if expiresAt <= 0 || expiresAt > maxExpiresAt {
+		return maxExpiresAt
 	}
+	return expiresAt
+}
 
-	var timeout = expiresAt - time.Now().Unix()
+// DropTemporaryTo 使用本地防火墙临时拦截IP数据包
+func DropTemporaryTo(ip string, expiresAt int64) {
+	var timeout = TemporaryExpiresAt(expiresAt) - time.Now().Unix()
 	if timeout < 1 {
 		return
 	}
-	if timeout > 3600 {
-		timeout = 3600
-	}
 
 	// 使用本地防火墙延长封禁
 	var fw = Firewall()
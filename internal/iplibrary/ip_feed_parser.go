@@ -0,0 +1,150 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package iplibrary
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// IPFeedEntry IP信誉订阅中的条目
+type IPFeedEntry struct {
+	Type   IPItemType
+	IPFrom string
+	IPTo   string // 为空表示单个IP
+}
+
+// Key 条目唯一标识
+func (this *IPFeedEntry) Key() string {
+	if len(this.IPTo) == 0 {
+		return this.IPFrom
+	}
+	return this.IPFrom + "-" + this.IPTo
+}
+
+// ParseIPFeed 解析IP信誉订阅内容
+// 每行一个IP、CIDR或者IP范围（IP1-IP2），支持以下格式：
+//   - 普通文本，以 # 开头的行为注释
+//   - Spamhaus DROP：`1.10.16.0/20 ; SBL256894`，以 ; 开头的行为注释；以及每行一个JSON对象的新格式
+//   - FireHOL netset：和普通文本相同
+func ParseIPFeed(reader io.Reader, maxItems int) ([]*IPFeedEntry, error) {
+	var scanner = bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+
+	var result = []*IPFeedEntry{}
+	var keyMap = map[string]bool{}
+	var countLines = 0
+	var lineNo = 0
+	for scanner.Scan() {
+		lineNo++
+		var line = bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		countLines++
+
+		var token string
+		if line[0] == '{' {
+			// Spamhaus JSON格式，最后一行为元数据
+			var obj = struct {
+				CIDR string `json:"cidr"`
+			}{}
+			err := json.Unmarshal(line, &obj)
+			if err != nil || len(obj.CIDR) == 0 {
+				countLines--
+				continue
+			}
+			token = obj.CIDR
+		} else {
+			token = string(line)
+			var index = strings.IndexAny(token, " \t#;,")
+			if index > 0 {
+				token = token[:index]
+			}
+		}
+
+		entry, ok := parseIPFeedToken(token)
+		if !ok {
+			continue
+		}
+		var key = entry.Key()
+		if keyMap[key] {
+			continue
+		}
+		keyMap[key] = true
+
+		if maxItems > 0 && len(result) >= maxItems {
+			return nil, errors.New("too many items, max: " + strconv.Itoa(maxItems))
+		}
+		result = append(result, entry)
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	// 防止因为返回了错误页面而清空名单
+	if countLines > 0 && len(result) == 0 {
+		return nil, errors.New("no valid items found in " + strconv.Itoa(lineNo) + " lines")
+	}
+
+	return result, nil
+}
+
+// 解析单个IP、CIDR或者IP范围
+func parseIPFeedToken(token string) (entry *IPFeedEntry, ok bool) {
+	// CIDR
+	if strings.Contains(token, "/") {
+		_, ipNet, err := net.ParseCIDR(token)
+		if err != nil {
+			return nil, false
+		}
+		var ipFrom = ipNet.IP
+		var ipTo = make(net.IP, len(ipFrom))
+		for i := range ipFrom {
+			ipTo[i] = ipFrom[i] | ^ipNet.Mask[i]
+		}
+		return newIPFeedEntry(ipFrom, ipTo)
+	}
+
+	// IP范围
+	dashIndex := strings.Index(token, "-")
+	if dashIndex > 0 {
+		var ipFrom = net.ParseIP(token[:dashIndex])
+		var ipTo = net.ParseIP(token[dashIndex+1:])
+		if ipFrom == nil || ipTo == nil || (ipFrom.To4() == nil) != (ipTo.To4() == nil) {
+			return nil, false
+		}
+		if bytes.Compare(ipFrom.To16(), ipTo.To16()) > 0 {
+			ipFrom, ipTo = ipTo, ipFrom
+		}
+		return newIPFeedEntry(ipFrom, ipTo)
+	}
+
+	// 单个IP
+	var ip = net.ParseIP(token)
+	if ip == nil {
+		return nil, false
+	}
+	return newIPFeedEntry(ip, ip)
+}
+
+func newIPFeedEntry(ipFrom net.IP, ipTo net.IP) (*IPFeedEntry, bool) {
+	var entry = &IPFeedEntry{
+		Type:   IPItemTypeIPv6,
+		IPFrom: ipFrom.String(),
+	}
+	if ipFrom.To4() != nil {
+		entry.Type = IPItemTypeIPv4
+	}
+	if !ipFrom.Equal(ipTo) {
+		entry.IPTo = ipTo.String()
+	}
+	return entry, true
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package iplibrary_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/iplibrary"
+	"github.com/iwind/TeaGo/assert"
+	"strings"
+	"testing"
+)
+
+func TestParseIPFeed(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	entries, err := iplibrary.ParseIPFeed(strings.NewReader(`
+# FireHOL netset
+; Spamhaus DROP List 2024/01/01
+1.10.16.0/20 ; SBL256894
+2.56.192.0/22 ; SBL459831
+192.168.1.1
+192.168.1.1 # duplicate
+10.0.0.1-10.0.0.10
+10.0.0.20-10.0.0.11
+2001:db8::/32
+{"cidr":"5.134.128.0/19","sblid":"SBL270738","rir":"ripencc"}
+{"type":"metadata","timestamp":1700000000,"size":1}
+invalid line
+`), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Log(entry.Type, entry.Key())
+	}
+	a.IsTrue(len(entries) == 7)
+	a.IsTrue(entries[0].IPFrom == "1.10.16.0" && entries[0].IPTo == "1.10.31.255")
+	a.IsTrue(entries[0].Type == iplibrary.IPItemTypeIPv4)
+	a.IsTrue(entries[2].IPFrom == "192.168.1.1" && len(entries[2].IPTo) == 0)
+	a.IsTrue(entries[4].IPFrom == "10.0.0.11" && entries[4].IPTo == "10.0.0.20")
+	a.IsTrue(entries[5].Type == iplibrary.IPItemTypeIPv6)
+	a.IsTrue(entries[5].IPTo == "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff")
+	a.IsTrue(entries[6].IPFrom == "5.134.128.0")
+}
+
+func TestParseIPFeed_Invalid(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	// 错误页面
+	_, err := iplibrary.ParseIPFeed(strings.NewReader("<html>\n<body>Not Found</body>\n</html>"), 0)
+	a.IsNotNil(err)
+
+	// 空订阅
+	entries, err := iplibrary.ParseIPFeed(strings.NewReader("# empty\n"), 0)
+	a.IsNil(err)
+	a.IsTrue(len(entries) == 0)
+
+	// 超出最大条目数
+	_, err = iplibrary.ParseIPFeed(strings.NewReader("1.1.1.1\n2.2.2.2\n3.3.3.3\n"), 2)
+	a.IsNotNil(err)
+}
@@ -10,6 +10,7 @@ import (
 
 var GlobalBlackIPList = NewIPList()
 var GlobalWhiteIPList = NewIPList()
+var FeedBlackIPList = NewIPList() // 从IP信誉订阅中加载的黑名单
 
 // IPList IP名单
 // TODO 对ipMap进行分区
@@ -48,6 +48,11 @@ func AllowIP(ip string, serverId int64) (canGoNext bool, inAllowList bool, expir
 		return false, false, expiresAt
 	}
 
+	expiresAt, ok = FeedBlackIPList.ContainsExpires(ipBytes)
+	if ok {
+		return false, false, expiresAt
+	}
+
 	if serverId > 0 {
 		var list = SharedServerListManager.FindBlackList(serverId, false)
 		if list != nil {
@@ -0,0 +1,306 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package iplibrary
+
+import (
+	"errors"
+	"github.com/TeaOSLab/EdgeCommon/pkg/iputils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
+	"github.com/TeaOSLab/EdgeNode/internal/events"
+	"github.com/TeaOSLab/EdgeNode/internal/goman"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/fasttime"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/fnv"
+	"github.com/iwind/TeaGo/types"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var SharedIPFeedManager = NewIPFeedManager()
+
+func init() {
+	if !teaconst.IsMain {
+		return
+	}
+
+	events.On(events.EventLoaded, func() {
+		goman.New(func() {
+			SharedIPFeedManager.Start()
+		})
+	})
+	events.OnClose(func() {
+		SharedIPFeedManager.Stop()
+	})
+}
+
+// IPFeedManager IP信誉订阅管理
+// 订阅配置从本地的 configs/ip_feeds.yaml 中读取
+type IPFeedManager struct {
+	feeds []*IPFeed
+
+	locker sync.Mutex
+}
+
+func NewIPFeedManager() *IPFeedManager {
+	return &IPFeedManager{}
+}
+
+func (this *IPFeedManager) Start() {
+	config, err := configs.LoadIPFeedsConfig()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			remotelogs.Error("IP_FEED_MANAGER", "load config file '"+configs.IPFeedsConfigFileName+"' failed: "+err.Error())
+		}
+		return
+	}
+
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	for _, feedConfig := range config.Feeds {
+		if !feedConfig.IsOn {
+			continue
+		}
+
+		var list *IPList
+		if feedConfig.ListId > 0 {
+			list = SharedIPListManager.findOrCreateList(feedConfig.ListId)
+		} else {
+			list = FeedBlackIPList
+		}
+
+		var feed = NewIPFeed(feedConfig, list)
+		this.feeds = append(this.feeds, feed)
+		goman.New(func() {
+			feed.Start()
+		})
+	}
+}
+
+func (this *IPFeedManager) Stop() {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	for _, feed := range this.feeds {
+		feed.Stop()
+	}
+	this.feeds = nil
+}
+
+// 订阅中的条目
+type ipFeedItem struct {
+	entry     *IPFeedEntry
+	expiredAt int64
+}
+
+// IPFeed 单个IP信誉订阅
+type IPFeed struct {
+	config *configs.IPFeedConfig
+	list   *IPList
+	client *http.Client
+
+	itemMap map[uint64]*ipFeedItem // id => item
+
+	etag         string
+	lastModified string
+
+	ticker *time.Ticker
+	locker sync.Mutex
+}
+
+func NewIPFeed(config *configs.IPFeedConfig, list *IPList) *IPFeed {
+	return &IPFeed{
+		config: config,
+		list:   list,
+		client: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+		itemMap: map[uint64]*ipFeedItem{},
+	}
+}
+
+func (this *IPFeed) Start() {
+	this.refreshAndLog()
+
+	this.ticker = time.NewTicker(this.config.IntervalDuration())
+	for range this.ticker.C {
+		this.refreshAndLog()
+	}
+}
+
+func (this *IPFeed) Stop() {
+	if this.ticker != nil {
+		this.ticker.Stop()
+	}
+}
+
+// Refresh 下载订阅内容并更新名单
+// 订阅内容没有变化时只延长条目有效期
+func (this *IPFeed) Refresh() (added int, deleted int, err error) {
+	req, err := http.NewRequest(http.MethodGet, this.config.URL, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("User-Agent", teaconst.ProductName+"/"+teaconst.Version)
+
+	this.locker.Lock()
+	if len(this.etag) > 0 {
+		req.Header.Set("If-None-Match", this.etag)
+	}
+	if len(this.lastModified) > 0 {
+		req.Header.Set("If-Modified-Since", this.lastModified)
+	}
+	this.locker.Unlock()
+
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var entries []*IPFeedEntry
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		entries = this.Entries()
+	case http.StatusOK:
+		entries, err = ParseIPFeed(resp.Body, this.config.MaxItems)
+		if err != nil {
+			return 0, 0, err
+		}
+	default:
+		return 0, 0, errors.New("unexpected response status code '" + types.String(resp.StatusCode) + "'")
+	}
+
+	added, deleted = this.Apply(entries)
+
+	this.locker.Lock()
+	this.etag = resp.Header.Get("ETag")
+	this.lastModified = resp.Header.Get("Last-Modified")
+	this.locker.Unlock()
+
+	return
+}
+
+// Apply 使用新的条目更新名单，只增加和删除有变化的条目
+func (this *IPFeed) Apply(entries []*IPFeedEntry) (added int, deleted int) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	var now = fasttime.Now().Unix()
+	var expiredAt = now + int64(this.config.Life)
+
+	var newEntryMap = map[uint64]*IPFeedEntry{}
+	for _, entry := range entries {
+		newEntryMap[this.itemId(entry)] = entry
+	}
+
+	// 删除
+	for itemId, item := range this.itemMap {
+		_, ok := newEntryMap[itemId]
+		if ok {
+			continue
+		}
+		this.list.Delete(itemId)
+		if this.isBlackList() {
+			SharedActionManager.DeleteItem(IPListTypeBlack, this.toPBItem(itemId, item.entry, item.expiredAt))
+		}
+		delete(this.itemMap, itemId)
+		deleted++
+	}
+
+	// 添加或延长有效期
+	// 为了减少对防火墙的操作，只有在下次更新前会过期的条目才会延长有效期
+	var interval = int64(this.config.Interval)
+	var changed = false
+	for itemId, entry := range newEntryMap {
+		oldItem, ok := this.itemMap[itemId]
+		if ok && oldItem.expiredAt-now > interval {
+			continue
+		}
+
+		this.list.AddDelay(&IPItem{
+			Id:         itemId,
+			Type:       entry.Type,
+			IPFrom:     iputils.ToBytes(entry.IPFrom),
+			IPTo:       iputils.ToBytes(entry.IPTo),
+			ExpiredAt:  expiredAt,
+			EventLevel: this.config.EventLevel,
+		})
+		changed = true
+
+		if this.isBlackList() {
+			if ok {
+				SharedActionManager.DeleteItem(IPListTypeBlack, this.toPBItem(itemId, entry, oldItem.expiredAt))
+			}
+			SharedActionManager.AddItem(IPListTypeBlack, this.toPBItem(itemId, entry, expiredAt))
+		}
+
+		this.itemMap[itemId] = &ipFeedItem{
+			entry:     entry,
+			expiredAt: expiredAt,
+		}
+		if !ok {
+			added++
+		}
+	}
+
+	if changed || deleted > 0 {
+		this.list.Sort()
+	}
+
+	return
+}
+
+// Entries 当前的所有条目
+func (this *IPFeed) Entries() []*IPFeedEntry {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	var result = make([]*IPFeedEntry, 0, len(this.itemMap))
+	for _, item := range this.itemMap {
+		result = append(result, item.entry)
+	}
+	return result
+}
+
+func (this *IPFeed) refreshAndLog() {
+	added, deleted, err := this.Refresh()
+	if err != nil {
+		remotelogs.Error("IP_FEED_MANAGER", "refresh feed '"+this.config.Name+"' failed: "+err.Error())
+		return
+	}
+	if added > 0 || deleted > 0 {
+		remotelogs.Println("IP_FEED_MANAGER", "feed '"+this.config.Name+"': added "+types.String(added)+", deleted "+types.String(deleted)+", total "+types.String(len(this.Entries())))
+	}
+}
+
+func (this *IPFeed) isBlackList() bool {
+	return this.config.ListType == configs.IPFeedListTypeBlack
+}
+
+// 条目ID
+// 使用 [2^62, 2^63) 区间，避免和API中的IP条目ID冲突
+func (this *IPFeed) itemId(entry *IPFeedEntry) uint64 {
+	return fnv.HashString(this.config.Name+"@"+entry.Key())>>2 | 1<<62
+}
+
+// 转换为防火墙动作使用的条目，因为动作中可能会修改条目，所以每次都需要重新生成
+func (this *IPFeed) toPBItem(itemId uint64, entry *IPFeedEntry, expiredAt int64) *pb.IPItem {
+	return &pb.IPItem{
+		Id:         int64(itemId),
+		Type:       entry.Type,
+		IpFrom:     entry.IPFrom,
+		IpTo:       entry.IPTo,
+		ExpiredAt:  expiredAt,
+		ListId:     this.config.ListId,
+		ListType:   this.config.ListType,
+		IsGlobal:   this.config.ListId <= 0,
+		EventLevel: this.config.EventLevel,
+	}
+}
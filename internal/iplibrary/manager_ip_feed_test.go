@@ -0,0 +1,79 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package iplibrary_test
+
+import (
+	"github.com/TeaOSLab/EdgeCommon/pkg/iputils"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/TeaOSLab/EdgeNode/internal/iplibrary"
+	"github.com/iwind/TeaGo/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPFeed_Refresh(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var content = "# feed\n1.10.16.0/20 ; SBL256894\n192.168.1.1\n"
+	var etag = `"v1"`
+	var server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("If-None-Match") == etag {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writer.Header().Set("ETag", etag)
+		_, _ = writer.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	var config = &configs.IPFeedConfig{
+		Name: "test",
+		URL:  server.URL + "/drop.txt",
+	}
+	err := config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var list = iplibrary.NewIPList()
+	var feed = iplibrary.NewIPFeed(config, list)
+
+	added, deleted, err := feed.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(added == 2)
+	a.IsTrue(deleted == 0)
+	a.IsTrue(list.Contains(iputils.ToBytes("1.10.20.1")))
+	a.IsTrue(list.Contains(iputils.ToBytes("192.168.1.1")))
+	a.IsFalse(list.Contains(iputils.ToBytes("192.168.1.2")))
+
+	// 未变化
+	added, deleted, err = feed.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(added == 0 && deleted == 0)
+	a.IsTrue(len(feed.Entries()) == 2)
+
+	// 有变化
+	content = "192.168.1.2\n1.10.16.0/20\n"
+	etag = `"v2"`
+	added, deleted, err = feed.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(added == 1)
+	a.IsTrue(deleted == 1)
+	a.IsTrue(list.Contains(iputils.ToBytes("1.10.20.1")))
+	a.IsFalse(list.Contains(iputils.ToBytes("192.168.1.1")))
+	a.IsTrue(list.Contains(iputils.ToBytes("192.168.1.2")))
+
+	// 错误页面不会清空名单
+	content = "<html>error</html>"
+	etag = `"v3"`
+	_, _, err = feed.Refresh()
+	a.IsNotNil(err)
+	a.IsTrue(list.Contains(iputils.ToBytes("192.168.1.2")))
+}
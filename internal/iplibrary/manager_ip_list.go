@@ -253,6 +253,19 @@ func (this *IPListManager) FindList(listId int64) *IPList {
 	return list
 }
 
+// 查找名单，如果不存在则创建
+func (this *IPListManager) findOrCreateList(listId int64) *IPList {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	var list = this.listMap[listId]
+	if list == nil {
+		list = NewIPList()
+		this.listMap[listId] = list
+	}
+	return list
+}
+
 func (this *IPListManager) DeleteExpiredItems() {
 	if this.db != nil {
 		_ = this.db.DeleteExpiredItems()
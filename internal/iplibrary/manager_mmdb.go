@@ -0,0 +1,299 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package iplibrary
+
+import (
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
+	"github.com/TeaOSLab/EdgeNode/internal/events"
+	"github.com/TeaOSLab/EdgeNode/internal/goman"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/mmdb"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var SharedMMDBManager = NewMMDBManager()
+
+func init() {
+	if !teaconst.IsMain {
+		return
+	}
+
+	events.On(events.EventLoaded, func() {
+		goman.New(func() {
+			SharedMMDBManager.Start()
+		})
+	})
+	events.OnClose(func() {
+		SharedMMDBManager.Stop()
+	})
+}
+
+// MMDBResult MMDB查询结果
+type MMDBResult struct {
+	CountryCode  string // 国家/地区代码，比如CN、US
+	CountryName  string
+	ProvinceName string
+	CityName     string
+	ASN          uint64 // 自治系统编号
+	ASOrg        string // 自治系统所属组织
+}
+
+// IsOk 是否有数据
+func (this *MMDBResult) IsOk() bool {
+	return len(this.CountryCode) > 0 || len(this.CountryName) > 0 || this.ASN > 0
+}
+
+// 从MMDB记录中合并数据，已有的数据不会被覆盖
+// 支持GeoLite2-City、GeoLite2-Country和GeoLite2-ASN的数据结构
+func (this *MMDBResult) merge(record map[string]any, language string) {
+	country, ok := record["country"].(map[string]any)
+	if !ok {
+		country, _ = record["registered_country"].(map[string]any)
+	}
+	if country != nil {
+		if len(this.CountryCode) == 0 {
+			this.CountryCode, _ = country["iso_code"].(string)
+		}
+		if len(this.CountryName) == 0 {
+			this.CountryName = this.lookupName(country, language)
+		}
+	}
+
+	if len(this.ProvinceName) == 0 {
+		subdivisions, _ := record["subdivisions"].([]any)
+		if len(subdivisions) > 0 {
+			subdivision, ok := subdivisions[0].(map[string]any)
+			if ok {
+				this.ProvinceName = this.lookupName(subdivision, language)
+			}
+		}
+	}
+
+	if len(this.CityName) == 0 {
+		city, ok := record["city"].(map[string]any)
+		if ok {
+			this.CityName = this.lookupName(city, language)
+		}
+	}
+
+	if this.ASN == 0 {
+		this.ASN, _ = record["autonomous_system_number"].(uint64)
+	}
+	if len(this.ASOrg) == 0 {
+		this.ASOrg, _ = record["autonomous_system_organization"].(string)
+	}
+}
+
+func (this *MMDBResult) lookupName(m map[string]any, language string) string {
+	names, ok := m["names"].(map[string]any)
+	if !ok {
+		return ""
+	}
+	name, ok := names[language].(string)
+	if ok && len(name) > 0 {
+		return name
+	}
+	name, _ = names["en"].(string)
+	return name
+}
+
+// 已加载的MMDB文件
+type mmdbFile struct {
+	path       string
+	size       int64
+	modifiedAt time.Time
+	reader     *mmdb.Reader
+}
+
+// MMDBManager 本地MMDB文件管理
+// 文件变化后会自动重新加载
+type MMDBManager struct {
+	config *configs.MMDBConfig
+	files  []*mmdbFile
+
+	ticker *time.Ticker
+	locker sync.RWMutex
+}
+
+func NewMMDBManager() *MMDBManager {
+	return &MMDBManager{
+		config: configs.DefaultMMDBConfig(),
+	}
+}
+
+func (this *MMDBManager) Start() {
+	config, err := configs.LoadMMDBConfig()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			remotelogs.Error("MMDB_MANAGER", "load config file '"+configs.MMDBConfigFileName+"' failed: "+err.Error())
+		}
+	} else {
+		this.UpdateConfig(config)
+	}
+
+	// 第一次加载
+	err = this.Reload()
+	if err != nil {
+		remotelogs.Error("MMDB_MANAGER", err.Error())
+	}
+
+	this.ticker = time.NewTicker(this.Config().CheckDuration())
+	for range this.ticker.C {
+		err = this.Reload()
+		if err != nil {
+			remotelogs.Error("MMDB_MANAGER", err.Error())
+		}
+	}
+}
+
+func (this *MMDBManager) Stop() {
+	if this.ticker != nil {
+		this.ticker.Stop()
+	}
+}
+
+// UpdateConfig 修改配置
+func (this *MMDBManager) UpdateConfig(config *configs.MMDBConfig) {
+	this.locker.Lock()
+	this.config = config
+	this.locker.Unlock()
+}
+
+// Config 当前配置
+func (this *MMDBManager) Config() *configs.MMDBConfig {
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+	return this.config
+}
+
+// IsOverride 是否优先使用MMDB中的数据
+func (this *MMDBManager) IsOverride() bool {
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+	return this.config.Override && len(this.files) > 0
+}
+
+// Reload 检查目录中的文件变化并重新加载
+// 未变化的文件不会重复读取，加载失败的文件继续使用旧的数据
+func (this *MMDBManager) Reload() error {
+	var dir = this.Config().Dir
+	paths, err := filepath.Glob(filepath.Join(dir, "*.mmdb"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	this.locker.RLock()
+	var oldFiles = this.files
+	this.locker.RUnlock()
+
+	var oldFileMap = map[string]*mmdbFile{}
+	for _, file := range oldFiles {
+		oldFileMap[file.path] = file
+	}
+
+	var newFiles = []*mmdbFile{}
+	var isChanged = false
+	var errorStrings = []string{}
+	for _, path := range paths {
+		stat, statErr := os.Stat(path)
+		if statErr != nil || stat.IsDir() {
+			continue
+		}
+
+		oldFile, hasOldFile := oldFileMap[path]
+		if hasOldFile && oldFile.size == stat.Size() && oldFile.modifiedAt.Equal(stat.ModTime()) {
+			newFiles = append(newFiles, oldFile)
+			continue
+		}
+
+		reader, openErr := mmdb.Open(path)
+		if openErr != nil {
+			errorStrings = append(errorStrings, "load '"+path+"' failed: "+openErr.Error())
+			if hasOldFile {
+				newFiles = append(newFiles, oldFile)
+			}
+			continue
+		}
+
+		isChanged = true
+		newFiles = append(newFiles, &mmdbFile{
+			path:       path,
+			size:       stat.Size(),
+			modifiedAt: stat.ModTime(),
+			reader:     reader,
+		})
+		remotelogs.Println("MMDB_MANAGER", "loaded '"+path+"' ("+reader.Metadata().DatabaseType+")")
+	}
+
+	// 有文件被删除或者新增
+	if !isChanged && !isSameMMDBFilePaths(oldFiles, newFiles) {
+		isChanged = true
+	}
+
+	if isChanged {
+		this.locker.Lock()
+		this.files = newFiles
+		this.locker.Unlock()
+	}
+
+	if len(errorStrings) > 0 {
+		return errors.New(strings.Join(errorStrings, "; "))
+	}
+	return nil
+}
+
+// Lookup 查询IP信息，如果没有找到则返回nil
+func (this *MMDBManager) Lookup(ip string) *MMDBResult {
+	this.locker.RLock()
+	var files = this.files
+	var language = this.config.Language
+	this.locker.RUnlock()
+
+	if len(files) == 0 {
+		return nil
+	}
+
+	var netIP = net.ParseIP(ip)
+	if netIP == nil {
+		return nil
+	}
+
+	var result = &MMDBResult{}
+	for _, file := range files {
+		record, err := file.reader.Lookup(netIP)
+		if err != nil || record == nil {
+			continue
+		}
+		result.merge(record, language)
+	}
+	if !result.IsOk() {
+		return nil
+	}
+	return result
+}
+
+// 判断两组文件的路径是否一致
+func isSameMMDBFilePaths(files1 []*mmdbFile, files2 []*mmdbFile) bool {
+	if len(files1) != len(files2) {
+		return false
+	}
+	var pathMap = map[string]bool{}
+	for _, file := range files1 {
+		pathMap[file.path] = true
+	}
+	for _, file := range files2 {
+		if !pathMap[file.path] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package iplibrary_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/TeaOSLab/EdgeNode/internal/iplibrary"
+	"github.com/iwind/TeaGo/assert"
+	"github.com/iwind/TeaGo/logs"
+	"os"
+	"testing"
+)
+
+func TestMMDBManager_Reload(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var dir = t.TempDir()
+	var manager = iplibrary.NewMMDBManager()
+	manager.UpdateConfig(&configs.MMDBConfig{
+		Dir:      dir,
+		Language: configs.DefaultMMDBLanguage,
+	})
+
+	// 空目录
+	err := manager.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsNil(manager.Lookup("1.1.1.1"))
+	a.IsFalse(manager.IsOverride())
+
+	// 非法文件
+	err = os.WriteFile(dir+"/invalid.mmdb", []byte("hello, world"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = manager.Reload()
+	a.IsNotNil(err)
+	a.IsNil(manager.Lookup("1.1.1.1"))
+}
+
+func TestMMDBManager_Lookup(t *testing.T) {
+	var manager = iplibrary.NewMMDBManager()
+	err := manager.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ip := range []string{"1.1.1.1", "8.8.8.8", "2001:4860:4860::8888"} {
+		logs.PrintAsJSON(manager.Lookup(ip), t)
+	}
+}
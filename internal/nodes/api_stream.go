@@ -23,14 +23,18 @@ import (
 	"regexp"
 	"runtime"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
+var sharedAPIStream = NewAPIStream()
+
 type APIStream struct {
 	stream pb.NodeService_NodeStreamClient
 
-	isQuiting  bool
-	cancelFunc context.CancelFunc
+	isQuiting   bool
+	isConnected int32
+	cancelFunc  context.CancelFunc
 }
 
 func NewAPIStream() *APIStream {
@@ -62,6 +66,11 @@ func (this *APIStream) Start() {
 	}
 }
 
+// IsConnected 是否已经连接到API节点
+func (this *APIStream) IsConnected() bool {
+	return atomic.LoadInt32(&this.isConnected) == 1
+}
+
 func (this *APIStream) loop() error {
 	rpcClient, err := rpc.SharedRPC()
 	if err != nil {
@@ -73,6 +82,7 @@ func (this *APIStream) loop() error {
 
 	defer func() {
 		cancelFunc()
+		atomic.StoreInt32(&this.isConnected, 0)
 	}()
 
 	nodeStream, err := rpcClient.NodeRPC.NodeStream(ctx)
@@ -132,6 +142,8 @@ func (this *APIStream) loop() error {
 
 // 连接API节点成功
 func (this *APIStream) handleConnectedAPINode(message *pb.NodeStreamMessage) error {
+	atomic.StoreInt32(&this.isConnected, 1)
+
 	// 更改连接的APINode信息
 	if len(message.DataJSON) == 0 {
 		return nil
@@ -291,7 +303,11 @@ func (this *APIStream) handleStatCache(message *pb.NodeStreamMessage) error {
 	} else {
 		sizeFormat = fmt.Sprintf("%.2f GiB", float64(stat.Size)/(1<<30))
 	}
-	this.replyOk(message.RequestId, "size:"+sizeFormat+", count:"+strconv.Itoa(stat.Count))
+	var result = "size:" + sizeFormat + ", count:" + strconv.Itoa(stat.Count)
+	if stat.Admission != nil {
+		result += fmt.Sprintf(", admission:%.2f%% (admitted:%d, rejected:%d)", stat.Admission.Rate()*100, stat.Admission.Admitted, stat.Admission.Rejected)
+	}
+	this.replyOk(message.RequestId, result)
 
 	return nil
 }
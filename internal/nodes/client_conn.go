@@ -218,6 +218,37 @@ func (this *ClientConn) Write(b []byte) (n int, err error) {
 	return
 }
 
+// TCPConn 获取可以直接转发数据的原始TCP连接
+// 经过PROXY Protocol等包装的连接可能有缓冲数据，不能直接使用
+func (this *ClientConn) TCPConn() (tcpConn *net.TCPConn, ok bool) {
+	tcpConn, ok = this.rawConn.(*net.TCPConn)
+	return
+}
+
+// AddRelayTraffic 记录没有经过Read()和Write()的转发流量，比如通过splice转发的数据
+func (this *ClientConn) AddRelayTraffic(readBytes int64, writtenBytes int64, cost time.Duration) {
+	if readBytes > 0 {
+		atomic.AddUint64(&teaconst.InTrafficBytes, uint64(readBytes))
+		this.hasRead = true
+	}
+
+	if writtenBytes > 0 {
+		atomic.AddInt64(&this.totalSentBytes, writtenBytes)
+
+		// 统计当前服务带宽
+		if this.serverId > 0 && (!this.isNoStat || Tea.IsTesting()) {
+			atomic.AddUint64(&teaconst.OutTrafficBytes, uint64(writtenBytes))
+
+			var seconds = cost.Seconds()
+			if seconds > 1 {
+				stats.SharedBandwidthStatManager.AddBandwidth(this.userId, this.userPlanId, this.serverId, int64(float64(writtenBytes)/seconds), writtenBytes)
+			} else {
+				stats.SharedBandwidthStatManager.AddBandwidth(this.userId, this.userPlanId, this.serverId, writtenBytes, writtenBytes)
+			}
+		}
+	}
+}
+
 func (this *ClientConn) Close() error {
 	this.isClosed = true
 
@@ -154,12 +154,31 @@ func (this *BaseClientConn) TCPConn() (tcpConn *net.TCPConn, ok bool) {
 			return clientConn.TCPConn()
 		}
 		tcpConn, ok = internalConn.(*net.TCPConn)
+	case *ProxyProtocolConn:
+		tcpConn, ok = conn.TCPConn()
 	default:
 		tcpConn, ok = this.rawConn.(*net.TCPConn)
 	}
 	return
 }
 
+// ProxyProtocolConn 读取通过PROXY Protocol接收的原始连接
+func (this *BaseClientConn) ProxyProtocolConn() (proxyProtocolConn *ProxyProtocolConn, ok bool) {
+	switch conn := this.rawConn.(type) {
+	case *tls.Conn:
+		clientConn, isClientConn := conn.NetConn().(*ClientConn)
+		if isClientConn {
+			return clientConn.ProxyProtocolConn()
+		}
+		proxyProtocolConn, ok = conn.NetConn().(*ProxyProtocolConn)
+	case *ClientConn:
+		return conn.ProxyProtocolConn()
+	case *ProxyProtocolConn:
+		return conn, true
+	}
+	return
+}
+
 // SetLinger 设置Linger
 func (this *BaseClientConn) SetLinger(seconds int) error {
 	tcpConn, ok := this.TCPConn()
@@ -38,4 +38,7 @@ type ClientConnInterface interface {
 
 	// LastRequestBytes 读取上一次请求发送的字节数
 	LastRequestBytes() int64
+
+	// ProxyProtocolConn 读取通过PROXY Protocol接收的原始连接
+	ProxyProtocolConn() (proxyProtocolConn *ProxyProtocolConn, ok bool)
 }
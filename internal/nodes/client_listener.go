@@ -38,6 +38,9 @@ func (this *ClientListener) Accept() (net.Conn, error) {
 		return nil, err
 	}
 
+	// 通过PROXY Protocol接收的连接来自负载均衡，不能在防火墙中拦截
+	proxyProtocolConn, isProxyProtocol := conn.(*ProxyProtocolConn)
+
 	// 是否在WAF名单中
 	ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
 	var isInAllowList = false
@@ -45,20 +48,30 @@ func (this *ClientListener) Accept() (net.Conn, error) {
 		canGoNext, inAllowList, expiresAt := iplibrary.AllowIP(ip, 0)
 		isInAllowList = inAllowList
 		if !canGoNext {
-			firewalls.DropTemporaryTo(ip, expiresAt)
+			if !isProxyProtocol {
+				firewalls.DropTemporaryTo(ip, expiresAt)
+			}
 		} else {
 			if !waf.SharedIPWhiteList.Contains(waf.IPTypeAll, firewallconfigs.FirewallScopeGlobal, 0, ip) {
 				var ok bool
 				expiresAt, ok = waf.SharedIPBlackList.ContainsExpires(waf.IPTypeAll, firewallconfigs.FirewallScopeGlobal, 0, ip)
 				if ok {
 					canGoNext = false
-					firewalls.DropTemporaryTo(ip, expiresAt)
+					if !isProxyProtocol {
+						firewalls.DropTemporaryTo(ip, expiresAt)
+					}
 				}
 			}
 		}
 
 		if !canGoNext {
-			tcpConn, ok := conn.(*net.TCPConn)
+			var tcpConn *net.TCPConn
+			var ok bool
+			if isProxyProtocol {
+				tcpConn, ok = proxyProtocolConn.TCPConn()
+			} else {
+				tcpConn, ok = conn.(*net.TCPConn)
+			}
 			if ok {
 				_ = tcpConn.SetLinger(0)
 			}
@@ -4,13 +4,11 @@ package nodes
 
 import (
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
 	"github.com/TeaOSLab/EdgeNode/internal/caches"
-	"github.com/TeaOSLab/EdgeNode/internal/compressions"
 	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
 	"github.com/TeaOSLab/EdgeNode/internal/events"
 	"github.com/TeaOSLab/EdgeNode/internal/goman"
@@ -171,22 +169,19 @@ func (this *HTTPCacheTaskManager) processKey(key *pb.HTTPCacheTaskKey) error {
 
 				// TODO 提升效率
 				for _, cacheKey := range cacheKeys {
-					var subKeys = []string{
-						cacheKey,
-						cacheKey + caches.SuffixMethod + "HEAD",
-						cacheKey + caches.SuffixWebP,
-						cacheKey + caches.SuffixPartial,
-					}
 					// TODO 根据实际缓存的内容进行组合
-					for _, encoding := range compressions.AllEncodings() {
-						subKeys = append(subKeys, cacheKey+caches.SuffixCompression+encoding)
-						subKeys = append(subKeys, cacheKey+caches.SuffixWebP+caches.SuffixCompression+encoding)
-					}
+					subKeys, _ := cacheVariantKeys(cacheKey)
 
 					err := storage.Purge(subKeys, "file")
 					if err != nil {
 						return err
 					}
+
+					// 切片缓存
+					err = storage.Purge([]string{caches.SlicePrefix(cacheKey)}, "dir")
+					if err != nil {
+						return err
+					}
 				}
 			case "prefix":
 				var prefixes = []string{key.Key}
@@ -315,6 +310,7 @@ func (this *HTTPCacheTaskManager) httpClient() *http.Client {
 			IdleConnTimeout:       2 * time.Minute,
 			ExpectContinueTimeout: 1 * time.Second,
 			TLSHandshakeTimeout:   0,
+			// 预热请求发送到当前节点，源站证书由反向代理负责校验，这里无需再校验节点自身的证书
 			TLSClientConfig: &tls.Config{
 				InsecureSkipVerify: true,
 			},
@@ -1,15 +1,32 @@
 package nodes
 
 import (
+	"context"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
 	"github.com/TeaOSLab/EdgeNode/internal/utils/fasttime"
+	"io"
 	"net/http"
+	"sync"
+	"sync/atomic"
 )
 
+// 预热请求标记
+var httpClientWarmContextKey = &contextKey{key: "http-client-warm"}
+
+// 单次预热时读取的最大响应内容长度
+const maxHTTPClientWarmBodySize = 64 << 10
+
 // HTTPClient HTTP客户端
 type HTTPClient struct {
 	rawClient       *http.Client
 	accessAt        int64
 	isProxyProtocol bool
+
+	stat       *HTTPClientStat
+	warmURL    string // 预热请求使用的地址，比如 https://example.com
+	warmHost   string // 预热请求使用的Host
+	lastWarmAt int64
+	isWarming  int32
 }
 
 // NewHTTPClient 获取新客户端对象
@@ -29,6 +46,9 @@ func (this *HTTPClient) RawClient() *http.Client {
 // UpdateAccessTime 更新访问时间
 func (this *HTTPClient) UpdateAccessTime() {
 	this.accessAt = fasttime.Now().Unix()
+	if this.stat != nil {
+		this.stat.UpdateAccessTime()
+	}
 }
 
 // AccessTime 获取访问时间
@@ -41,6 +61,87 @@ func (this *HTTPClient) IsProxyProtocol() bool {
 	return this.isProxyProtocol
 }
 
+// SetStat 设置统计对象
+func (this *HTTPClient) SetStat(stat *HTTPClientStat) {
+	this.stat = stat
+}
+
+// Stat 获取统计对象
+func (this *HTTPClient) Stat() *HTTPClientStat {
+	return this.stat
+}
+
+// SetWarmTarget 设置预热请求的目标
+// 使用PROXY Protocol的客户端不能预热，因为每个连接都对应一个客户端IP
+func (this *HTTPClient) SetWarmTarget(warmURL string, warmHost string) {
+	this.warmURL = warmURL
+	this.warmHost = warmHost
+}
+
+// Warm 预热连接，使空闲连接数不少于配置中的数量
+func (this *HTTPClient) Warm(pool *configs.OriginWarmPoolConfig) {
+	if this.stat == nil || len(this.warmURL) == 0 || this.isProxyProtocol {
+		return
+	}
+
+	var now = fasttime.Now().Unix()
+	if now-atomic.LoadInt64(&this.lastWarmAt) < int64(pool.IntervalDuration().Seconds()) {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&this.isWarming, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&this.isWarming, 0)
+	atomic.StoreInt64(&this.lastWarmAt, now)
+
+	var count int64
+	if this.stat.IsHTTP2() {
+		// HTTP/2的一个连接可以同时处理多个请求，已经有连接时不需要再预热
+		if this.stat.Conns() > 0 {
+			return
+		}
+		count = 1
+	} else {
+		count = int64(pool.MinIdleConns) - this.stat.IdleConns()
+	}
+	if count <= 0 {
+		return
+	}
+
+	// 同时发送多个请求，以便建立多个连接
+	var wg = &sync.WaitGroup{}
+	for i := int64(0); i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			this.warmOnce(pool)
+		}()
+	}
+	wg.Wait()
+}
+
+func (this *HTTPClient) warmOnce(pool *configs.OriginWarmPoolConfig) {
+	ctx, cancelFunc := context.WithTimeout(context.WithValue(context.Background(), httpClientWarmContextKey, true), pool.TimeoutDuration())
+	defer cancelFunc()
+
+	req, err := http.NewRequestWithContext(ctx, pool.Method, this.warmURL+pool.Path, nil)
+	if err != nil {
+		return
+	}
+	if len(this.warmHost) > 0 {
+		req.Host = this.warmHost
+	}
+
+	resp, err := this.rawClient.Do(req)
+	if err != nil {
+		return
+	}
+
+	// 读取完响应内容后连接才能被复用
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxHTTPClientWarmBodySize))
+	_ = resp.Body.Close()
+}
+
 // Close 关闭
 func (this *HTTPClient) Close() {
 	this.rawClient.CloseIdleConnections()
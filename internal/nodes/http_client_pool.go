@@ -5,14 +5,19 @@ import (
 	"crypto/tls"
 	"errors"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
 	"github.com/TeaOSLab/EdgeNode/internal/goman"
+	"github.com/TeaOSLab/EdgeNode/internal/utils"
 	"github.com/TeaOSLab/EdgeNode/internal/utils/fasttime"
 	"github.com/cespare/xxhash/v2"
+	"github.com/iwind/TeaGo/maps"
 	"github.com/pires/go-proxyproto"
 	"golang.org/x/net/http2"
 	"net"
 	"net/http"
+	"net/url"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -25,9 +30,14 @@ var SharedHTTPClientPool = NewHTTPClientPool()
 const httpClientProxyProtocolTag = "@ProxyProtocol@"
 const maxHTTPRedirects = 8
 
+// 每个源站的TLS会话缓存数量
+const httpClientTLSSessionCacheSize = 64
+
 // HTTPClientPool 客户端池
 type HTTPClientPool struct {
-	clientsMap map[uint64]*HTTPClient // origin key => client
+	clientsMap       map[uint64]*HTTPClient            // origin key => client
+	statsMap         map[string]*HTTPClientStat        // originId@addr => stat
+	sessionCachesMap map[string]tls.ClientSessionCache // originId@addr@policy => cache
 
 	cleanTicker *time.Ticker
 
@@ -37,8 +47,10 @@ type HTTPClientPool struct {
 // NewHTTPClientPool 获取新对象
 func NewHTTPClientPool() *HTTPClientPool {
 	var pool = &HTTPClientPool{
-		cleanTicker: time.NewTicker(1 * time.Hour),
-		clientsMap:  map[uint64]*HTTPClient{},
+		cleanTicker:      time.NewTicker(1 * time.Hour),
+		clientsMap:       map[uint64]*HTTPClient{},
+		statsMap:         map[string]*HTTPClientStat{},
+		sessionCachesMap: map[string]tls.ClientSessionCache{},
 	}
 
 	goman.New(func() {
@@ -74,7 +86,14 @@ func (this *HTTPClientPool) Client(req *HTTPRequest,
 		originHost += ":" + urlPort
 	}
 
-	var rawKey = origin.UniqueKey() + "@" + originAddr + "@" + originHost
+	// 证书校验策略
+	var tlsPolicy = SharedOriginTLSManager.FindPolicy(origin)
+	var tlsVerifyHost string
+	if tlsPolicy.VerifyRequestHost {
+		tlsVerifyHost = utils.ParseAddrHost(req.ReqHost)
+	}
+
+	var rawKey = origin.UniqueKey() + "@" + originAddr + "@" + originHost + "@" + tlsPolicy.Key() + "@" + tlsVerifyHost
 
 	// if we are under available ProxyProtocol, we add client ip to key to make every client unique
 	var isProxyProtocol = false
@@ -88,6 +107,28 @@ func (this *HTTPClientPool) Client(req *HTTPRequest,
 		rawKey += "@follow"
 	}
 
+	// gRPC
+	var isGRPC = req.isGRPCRequest()
+	if isGRPC {
+		rawKey += "@grpc"
+	}
+
+	// 出口IP
+	// 按客户端IP选择时，每组出口IP使用单独的客户端
+	var egressServerId int64
+	if req.ReqServer != nil {
+		egressServerId = req.ReqServer.Id
+	}
+	var egressPool = SharedOriginEgressManager.FindPool(origin.Id, egressServerId)
+	var egressIPv4, egressIPv6 net.IP
+	if egressPool != nil {
+		rawKey += "@egress:" + egressPool.Key()
+		if egressPool.IsHash() {
+			egressIPv4, egressIPv6 = egressPool.PickLocalAddrs(req.requestRemoteAddr(true))
+			rawKey += "@" + egressIPv4.String() + "," + egressIPv6.String()
+		}
+	}
+
 	var key = xxhash.Sum64String(rawKey)
 
 	var isLnRequest = origin.Id == 0
@@ -150,48 +191,98 @@ func (this *HTTPClientPool) Client(req *HTTPRequest,
 		idleConns *= 2
 	}
 
+	// 统计
+	var statKey = strconv.FormatInt(origin.Id, 10) + "@" + originAddr
+	stat, found := this.statsMap[statKey]
+	if !found {
+		stat = NewHTTPClientStat(origin.Id, originAddr)
+		this.statsMap[statKey] = stat
+	}
+	var clientStat = stat.NewClientStat()
+
 	// TLS通讯
-	var tlsConfig = &tls.Config{
-		InsecureSkipVerify: true,
-	}
-	if origin.Cert != nil {
-		var obj = origin.Cert.CertObject()
-		if obj != nil {
-			tlsConfig.InsecureSkipVerify = false
-			tlsConfig.Certificates = []tls.Certificate{*obj}
-			if len(origin.Cert.ServerName) > 0 {
-				tlsConfig.ServerName = origin.Cert.ServerName
+	// 同一个源站共用TLS会话缓存，以便新连接可以恢复会话，减少握手时间
+	var tlsConfig = NewOriginTLSConfig(origin, tlsPolicy, "", tlsVerifyHost)
+	var sessionCacheKey = statKey + "@" + tlsPolicy.Key()
+	sessionCache, found := this.sessionCachesMap[sessionCacheKey]
+	if !found {
+		sessionCache = tls.NewLRUClientSessionCache(httpClientTLSSessionCacheSize)
+		this.sessionCachesMap[sessionCacheKey] = sessionCache
+	}
+	tlsConfig.ClientSessionCache = sessionCache
+
+	var dialContext = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		var realAddr = originAddr
+
+		// for redirections
+		if followRedirects && originHost != addr {
+			realAddr = addr
+		}
+
+		// connect
+		var dialer = &net.Dialer{
+			Timeout:   connectionTimeout,
+			KeepAlive: 1 * time.Minute,
+		}
+		var conn net.Conn
+		var dialErr error
+		if egressPool != nil {
+			var localIPv4, localIPv6 = egressIPv4, egressIPv6
+			if !egressPool.IsHash() {
+				localIPv4, localIPv6 = egressPool.PickLocalAddrs("")
 			}
+			conn, dialErr = dialOriginEgress(ctx, dialer, network, realAddr, egressPool, localIPv4, localIPv6)
+		} else {
+			conn, dialErr = dialer.DialContext(ctx, network, realAddr)
+		}
+		if dialErr != nil {
+			return nil, dialErr
 		}
-	}
 
-	var transport = &HTTPClientTransport{
-		Transport: &http.Transport{
-			DialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
-				var realAddr = originAddr
+		// handle PROXY protocol
+		proxyErr := this.handlePROXYProtocol(conn, req, proxyProtocol)
+		if proxyErr != nil {
+			return nil, proxyErr
+		}
 
-				// for redirections
-				if followRedirects && originHost != addr {
-					realAddr = addr
-				}
+		clientStat.addConn()
+		return NewOriginStatConn(conn, clientStat), nil
+	}
 
-				// connect
-				conn, dialErr := (&net.Dialer{
-					Timeout:   connectionTimeout,
-					KeepAlive: 1 * time.Minute,
-				}).DialContext(ctx, network, realAddr)
-				if dialErr != nil {
-					return nil, dialErr
-				}
+	var checkRedirect = func(targetReq *http.Request, via []*http.Request) error {
+		// follow redirects
+		if followRedirects && len(via) <= maxHTTPRedirects {
+			return nil
+		}
 
-				// handle PROXY protocol
-				proxyErr := this.handlePROXYProtocol(conn, req, proxyProtocol)
-				if proxyErr != nil {
-					return nil, proxyErr
-				}
+		return http.ErrUseLastResponse
+	}
 
-				return NewOriginConn(conn), nil
+	// gRPC over h2c：使用HTTP/2明文（prior knowledge）连接源站
+	if isGRPC && origin.Addr.Protocol.IsHTTPFamily() {
+		rawClient = &http.Client{
+			Transport: &httpClientStatTransport{
+				transport: &http2.Transport{
+					AllowHTTP: true,
+					DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+						return dialContext(ctx, network, addr)
+					},
+					ReadIdleTimeout: idleTimeout,
+					PingTimeout:     connectionTimeout,
+				},
+				stat: clientStat,
 			},
+			CheckRedirect: checkRedirect,
+		}
+		client = NewHTTPClient(rawClient, isProxyProtocol)
+		client.SetStat(clientStat)
+		this.clientsMap[key] = client
+		return rawClient, nil
+	}
+
+	var transport = &HTTPClientTransport{
+		Transport: &http.Transport{
+			DialContext:           dialContext,
 			MaxIdleConns:          0,
 			MaxIdleConnsPerHost:   idleConns,
 			MaxConnsPerHost:       maxConnections,
@@ -202,31 +293,209 @@ func (this *HTTPClientPool) Client(req *HTTPRequest,
 			ReadBufferSize:        8 * 1024,
 			Proxy:                 nil,
 		},
+		stat: clientStat,
 	}
 
 	// support http/2
-	if origin.HTTP2Enabled && origin.Addr != nil && origin.Addr.Protocol == serverconfigs.ProtocolHTTPS {
+	// gRPC必须使用HTTP/2
+	if (origin.HTTP2Enabled || isGRPC) && origin.Addr.Protocol == serverconfigs.ProtocolHTTPS {
 		_ = http2.ConfigureTransport(transport.Transport)
 	}
 
 	rawClient = &http.Client{
-		Timeout:   readTimeout,
-		Transport: transport,
-		CheckRedirect: func(targetReq *http.Request, via []*http.Request) error {
-			// follow redirects
-			if followRedirects && len(via) <= maxHTTPRedirects {
-				return nil
-			}
+		Timeout:       readTimeout,
+		Transport:     transport,
+		CheckRedirect: checkRedirect,
+	}
 
-			return http.ErrUseLastResponse
-		},
+	// gRPC可能为长时间的流式调用，所以只限制读取响应Header的时间
+	if isGRPC {
+		rawClient.Timeout = 0
+		transport.ResponseHeaderTimeout = readTimeout
 	}
 
-	this.clientsMap[key] = NewHTTPClient(rawClient, isProxyProtocol)
+	client = NewHTTPClient(rawClient, isProxyProtocol)
+	client.SetStat(clientStat)
+	if !isProxyProtocol {
+		// 使用客户端对应的主机名，而不是第一个请求的Host，因为同一个客户端可能被不同Host的请求使用
+		client.SetWarmTarget(req.RawReq.URL.Scheme+"://"+originHost, req.RawReq.URL.Host)
+	}
+	this.clientsMap[key] = client
+
+	// 新的客户端立即预热，以便接下来的请求可以使用已建立的连接
+	var warmPool = SharedOriginWarmManager.FindPool(origin.Id, originAddr)
+	if warmPool != nil {
+		goman.New(func() {
+			client.Warm(warmPool)
+		})
+	}
 
 	return rawClient, nil
 }
 
+// Prepare 为需要预热的源站预先创建客户端，以便在收到第一个请求之前就可以建立连接
+// 只处理地址和主机名中没有变量的源站，主机名默认使用服务的第一个域名
+func (this *HTTPClientPool) Prepare(servers []*serverconfigs.ServerConfig, findPool func(originId int64, addr string) *configs.OriginWarmPoolConfig) {
+	for _, server := range servers {
+		if server == nil ||
+			!server.IsOn ||
+			server.ReverseProxyRef == nil ||
+			!server.ReverseProxyRef.IsOn ||
+			server.ReverseProxy == nil ||
+			!server.ReverseProxy.IsOn {
+			continue
+		}
+
+		// 使用PROXY Protocol的客户端对应单个客户端IP，不能预先创建
+		var reverseProxy = server.ReverseProxy
+		if reverseProxy.ProxyProtocol != nil && reverseProxy.ProxyProtocol.IsOn {
+			continue
+		}
+
+		var serverName = this.preparingServerName(server)
+		if len(serverName) == 0 {
+			continue
+		}
+
+		var origins = append([]*serverconfigs.OriginConfig{}, reverseProxy.PrimaryOrigins...)
+		origins = append(origins, reverseProxy.BackupOrigins...)
+		for _, origin := range origins {
+			if origin == nil ||
+				!origin.IsOn ||
+				origin.OSS != nil ||
+				origin.Addr == nil ||
+				origin.Addr.HostHasVariables() ||
+				origin.FollowPort ||
+				!(origin.Addr.Protocol.IsHTTPFamily() || origin.Addr.Protocol.IsHTTPSFamily()) {
+				continue
+			}
+
+			var originAddr = origin.Addr.PickAddress()
+			if findPool(origin.Id, originAddr) == nil {
+				continue
+			}
+
+			// 按客户端IP选择出口IP时，每组出口IP使用单独的客户端，不能预先创建
+			var egressPool = SharedOriginEgressManager.FindPool(origin.Id, server.Id)
+			if egressPool != nil && egressPool.IsHash() {
+				continue
+			}
+
+			var host = this.preparingRequestHost(reverseProxy, origin, originAddr, serverName)
+			if len(host) == 0 {
+				continue
+			}
+
+			var req = &HTTPRequest{
+				RawReq: &http.Request{
+					URL: &url.URL{
+						Scheme: origin.Addr.Protocol.Primary().Scheme(),
+						Host:   host,
+					},
+					Host:   host,
+					Header: http.Header{},
+				},
+				ReqServer: server,
+				ReqHost:   serverName,
+			}
+			_, _ = this.Client(req, origin, originAddr, nil, reverseProxy.FollowRedirects)
+		}
+	}
+}
+
+// 服务的第一个普通域名，用作默认的回源主机名
+func (this *HTTPClientPool) preparingServerName(server *serverconfigs.ServerConfig) string {
+	for _, serverName := range server.ServerNames {
+		if serverName == nil {
+			continue
+		}
+		var name = serverName.Name
+		if len(name) > 0 && !strings.ContainsAny(name, "*~^$") {
+			return name
+		}
+	}
+	return ""
+}
+
+// 回源主机名，和反向代理中的规则保持一致，含有变量时返回空
+func (this *HTTPClientPool) preparingRequestHost(reverseProxy *serverconfigs.ReverseProxyConfig, origin *serverconfigs.OriginConfig, originAddr string, serverName string) string {
+	var requestHost = ""
+	var requestHostHasVariables = false
+	if reverseProxy.RequestHostType == serverconfigs.RequestHostTypeCustomized {
+		requestHost = reverseProxy.RequestHost
+		requestHostHasVariables = reverseProxy.RequestHostHasVariables()
+	}
+	if len(origin.RequestHost) > 0 {
+		requestHost = origin.RequestHost
+		requestHostHasVariables = origin.RequestHostHasVariables()
+	}
+
+	var host = serverName
+	if len(requestHost) > 0 {
+		if requestHostHasVariables {
+			return ""
+		}
+		host = requestHost
+	} else if reverseProxy.RequestHostType == serverconfigs.RequestHostTypeOrigin {
+		host = originAddr
+		if origin.Addr.Protocol.IsHTTPFamily() {
+			host = strings.TrimSuffix(host, ":80")
+		} else if origin.Addr.Protocol.IsHTTPSFamily() {
+			host = strings.TrimSuffix(host, ":443")
+		}
+	}
+
+	if reverseProxy.RequestHostExcludingPort {
+		host = utils.ParseAddrHost(host)
+	}
+	return host
+}
+
+// Warm 预热所有匹配配置的客户端
+func (this *HTTPClientPool) Warm(findPool func(originId int64, addr string) *configs.OriginWarmPoolConfig) {
+	this.locker.RLock()
+	var clients = []*HTTPClient{}
+	for _, client := range this.clientsMap {
+		clients = append(clients, client)
+	}
+	this.locker.RUnlock()
+
+	for _, client := range clients {
+		var stat = client.Stat()
+		if stat == nil {
+			continue
+		}
+		var pool = findPool(stat.OriginId(), stat.Addr())
+		if pool == nil {
+			continue
+		}
+		var warmClient = client
+		goman.New(func() {
+			warmClient.Warm(pool)
+		})
+	}
+}
+
+// Stats 获取所有源站的连接统计
+func (this *HTTPClientPool) Stats() []maps.Map {
+	this.locker.RLock()
+	var result = []maps.Map{}
+	for _, stat := range this.statsMap {
+		result = append(result, stat.AsMap())
+	}
+	this.locker.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		var originId1 = result[i].GetInt64("originId")
+		var originId2 = result[j].GetInt64("originId")
+		if originId1 == originId2 {
+			return result[i].GetString("addr") < result[j].GetString("addr")
+		}
+		return originId1 < originId2
+	})
+	return result
+}
+
 // 清理不使用的Client
 func (this *HTTPClientPool) cleanClients() {
 	for range this.cleanTicker.C {
@@ -255,6 +524,20 @@ func (this *HTTPClientPool) cleanClients() {
 			this.locker.Unlock()
 		}
 
+		// remove unused stats and session caches
+		this.locker.Lock()
+		for statKey, stat := range this.statsMap {
+			if stat.AccessTime() < nowTime-86400 && stat.Conns() <= 0 {
+				delete(this.statsMap, statKey)
+				for sessionCacheKey := range this.sessionCachesMap {
+					if strings.HasPrefix(sessionCacheKey, statKey+"@") {
+						delete(this.sessionCachesMap, sessionCacheKey)
+					}
+				}
+			}
+		}
+		this.locker.Unlock()
+
 		// close expired clients
 		if len(expiredClients) > 0 {
 			for _, client := range expiredClients {
@@ -0,0 +1,270 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"crypto/tls"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/fasttime"
+	"github.com/iwind/TeaGo/maps"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPClientStat 单个源站的连接统计
+// 同一个源站的多个客户端共用一个统计对象，每个客户端另有自己的统计对象用来计算空闲连接数
+type HTTPClientStat struct {
+	parent *HTTPClientStat // 客户端统计对象对应的源站统计对象
+
+	originId int64
+	addr     string
+
+	conns             int64 // 当前连接数
+	activeRequests    int64 // 正在处理的请求数
+	dials             int64 // 建立的连接总数
+	handshakes        int64 // TLS握手次数
+	resumedHandshakes int64 // 通过会话恢复完成的TLS握手次数
+	requests          int64 // 请求数，不包括预热请求
+	reusedRequests    int64 // 复用已有连接的请求数
+	http2Requests     int64 // 通过HTTP/2发送的请求数
+	ttfbNanoseconds   int64 // 首字节时间总和
+	ttfbCount         int64
+	warmRequests      int64 // 预热请求数
+	isHTTP2           int32 // 是否已经使用HTTP/2
+
+	accessAt int64
+}
+
+func NewHTTPClientStat(originId int64, addr string) *HTTPClientStat {
+	return &HTTPClientStat{
+		originId: originId,
+		addr:     addr,
+		accessAt: fasttime.Now().Unix(),
+	}
+}
+
+// NewClientStat 获取单个客户端使用的统计对象
+// 不同客户端之间不能共用连接，所以需要单独统计每个客户端的连接数，同时汇总到源站的统计中
+func (this *HTTPClientStat) NewClientStat() *HTTPClientStat {
+	return &HTTPClientStat{
+		parent:   this,
+		originId: this.originId,
+		addr:     this.addr,
+		accessAt: fasttime.Now().Unix(),
+	}
+}
+
+// OriginId 源站ID
+func (this *HTTPClientStat) OriginId() int64 {
+	return this.originId
+}
+
+// Addr 源站地址
+func (this *HTTPClientStat) Addr() string {
+	return this.addr
+}
+
+// Conns 当前连接数
+func (this *HTTPClientStat) Conns() int64 {
+	return atomic.LoadInt64(&this.conns)
+}
+
+// ActiveRequests 正在处理的请求数
+func (this *HTTPClientStat) ActiveRequests() int64 {
+	return atomic.LoadInt64(&this.activeRequests)
+}
+
+// IdleConns 估算的空闲连接数
+// HTTP/2中一个连接可以同时处理多个请求，所以这里只是一个大概的数值，需要配合IsHTTP2()使用
+func (this *HTTPClientStat) IdleConns() int64 {
+	var idleConns = this.Conns() - this.ActiveRequests()
+	if idleConns < 0 {
+		return 0
+	}
+	return idleConns
+}
+
+// IsHTTP2 是否已经使用HTTP/2连接
+func (this *HTTPClientStat) IsHTTP2() bool {
+	return atomic.LoadInt32(&this.isHTTP2) == 1
+}
+
+// AccessTime 最后使用时间
+func (this *HTTPClientStat) AccessTime() int64 {
+	return atomic.LoadInt64(&this.accessAt)
+}
+
+// UpdateAccessTime 更新最后使用时间
+func (this *HTTPClientStat) UpdateAccessTime() {
+	atomic.StoreInt64(&this.accessAt, fasttime.Now().Unix())
+	if this.parent != nil {
+		this.parent.UpdateAccessTime()
+	}
+}
+
+// 建立新连接
+func (this *HTTPClientStat) addConn() {
+	atomic.AddInt64(&this.conns, 1)
+	atomic.AddInt64(&this.dials, 1)
+	if this.parent != nil {
+		this.parent.addConn()
+	}
+}
+
+// 关闭连接
+func (this *HTTPClientStat) removeConn() {
+	atomic.AddInt64(&this.conns, -1)
+	if this.parent != nil {
+		this.parent.removeConn()
+	}
+}
+
+// 修改正在处理的请求数
+func (this *HTTPClientStat) addActiveRequests(delta int64) {
+	atomic.AddInt64(&this.activeRequests, delta)
+	if this.parent != nil {
+		this.parent.addActiveRequests(delta)
+	}
+}
+
+// 请求相关的统计数据只记录在源站统计对象中
+func (this *HTTPClientStat) originStat() *HTTPClientStat {
+	if this.parent != nil {
+		return this.parent
+	}
+	return this
+}
+
+// RoundTrip 发送请求并记录统计数据
+func (this *HTTPClientStat) RoundTrip(req *http.Request, roundTrip func(req *http.Request) (*http.Response, error)) (*http.Response, error) {
+	var isWarm = req.Context().Value(httpClientWarmContextKey) != nil
+	var stat = this.originStat()
+	var trace = &httptrace.ClientTrace{
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				return
+			}
+			atomic.AddInt64(&stat.handshakes, 1)
+			if state.DidResume {
+				atomic.AddInt64(&stat.resumedHandshakes, 1)
+			}
+		},
+	}
+
+	if isWarm {
+		atomic.AddInt64(&stat.warmRequests, 1)
+	} else {
+		var before = time.Now()
+		trace.GotConn = func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&stat.reusedRequests, 1)
+			}
+		}
+		trace.GotFirstResponseByte = func() {
+			atomic.AddInt64(&stat.ttfbNanoseconds, int64(time.Since(before)))
+			atomic.AddInt64(&stat.ttfbCount, 1)
+		}
+		atomic.AddInt64(&stat.requests, 1)
+	}
+
+	this.addActiveRequests(1)
+	resp, err := roundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil || resp == nil || resp.Body == nil || resp.StatusCode == http.StatusSwitchingProtocols {
+		this.addActiveRequests(-1)
+		return resp, err
+	}
+
+	if resp.ProtoMajor == 2 {
+		atomic.StoreInt32(&this.isHTTP2, 1)
+		if !isWarm {
+			atomic.AddInt64(&stat.http2Requests, 1)
+		}
+	}
+
+	// 读取完或关闭响应内容时结束请求
+	resp.Body = &httpClientStatBody{
+		ReadCloser: resp.Body,
+		stat:       this,
+	}
+
+	return resp, nil
+}
+
+// AsMap 转换为Map
+func (this *HTTPClientStat) AsMap() maps.Map {
+	var requests = atomic.LoadInt64(&this.requests)
+	var reuseRatio float64
+	if requests > 0 {
+		reuseRatio = float64(atomic.LoadInt64(&this.reusedRequests)) / float64(requests)
+	}
+
+	var ttfbCount = atomic.LoadInt64(&this.ttfbCount)
+	var avgTTFBMs float64
+	if ttfbCount > 0 {
+		avgTTFBMs = float64(atomic.LoadInt64(&this.ttfbNanoseconds)) / float64(ttfbCount) / float64(time.Millisecond)
+	}
+
+	return maps.Map{
+		"originId":          this.originId,
+		"addr":              this.addr,
+		"conns":             this.Conns(),
+		"activeRequests":    this.ActiveRequests(),
+		"idleConns":         this.IdleConns(),
+		"dials":             atomic.LoadInt64(&this.dials),
+		"handshakes":        atomic.LoadInt64(&this.handshakes),
+		"resumedHandshakes": atomic.LoadInt64(&this.resumedHandshakes),
+		"requests":          requests,
+		"reusedRequests":    atomic.LoadInt64(&this.reusedRequests),
+		"reuseRatio":        reuseRatio,
+		"http2Requests":     atomic.LoadInt64(&this.http2Requests),
+		"avgTTFBMs":         avgTTFBMs,
+		"warmRequests":      atomic.LoadInt64(&this.warmRequests),
+	}
+}
+
+// 响应内容
+type httpClientStatBody struct {
+	io.ReadCloser
+
+	stat *HTTPClientStat
+	once sync.Once
+}
+
+func (this *httpClientStatBody) Read(p []byte) (n int, err error) {
+	n, err = this.ReadCloser.Read(p)
+	if err != nil {
+		this.done()
+	}
+	return
+}
+
+func (this *httpClientStatBody) Close() error {
+	this.done()
+	return this.ReadCloser.Close()
+}
+
+func (this *httpClientStatBody) done() {
+	this.once.Do(func() {
+		this.stat.addActiveRequests(-1)
+	})
+}
+
+// 带有统计的Transport
+type httpClientStatTransport struct {
+	transport http.RoundTripper
+	stat      *HTTPClientStat
+}
+
+func (this *httpClientStatTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return this.stat.RoundTrip(req, this.transport.RoundTrip)
+}
+
+func (this *httpClientStatTransport) CloseIdleConnections() {
+	closer, ok := this.transport.(interface{ CloseIdleConnections() })
+	if ok {
+		closer.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"context"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestStatHTTPClient(stat *HTTPClientStat) *http.Client {
+	return &http.Client{
+		Transport: &HTTPClientTransport{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+					conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+					if err != nil {
+						return nil, err
+					}
+					stat.addConn()
+					return NewOriginStatConn(conn, stat), nil
+				},
+				MaxIdleConnsPerHost: 16,
+			},
+			stat: stat,
+		},
+	}
+}
+
+func TestHTTPClientStat_RoundTrip(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		_, _ = writer.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	var stat = NewHTTPClientStat(1, server.Listener.Addr().String())
+	var client = newTestStatHTTPClient(stat)
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(stat.ActiveRequests() == 1)
+		_, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		a.IsTrue(stat.ActiveRequests() == 0)
+	}
+
+	var m = stat.AsMap()
+	t.Log(m)
+	a.IsTrue(m.GetInt64("requests") == 3)
+	a.IsTrue(m.GetInt64("reusedRequests") == 2)
+	a.IsTrue(m.GetInt64("dials") == 1)
+	a.IsTrue(stat.Conns() == 1)
+	a.IsTrue(stat.IdleConns() == 1)
+
+	client.CloseIdleConnections()
+	a.IsTrue(stat.Conns() == 0)
+}
+
+func TestHTTPClient_Warm(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		// 让多个预热请求同时进行
+		time.Sleep(50 * time.Millisecond)
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var stat = NewHTTPClientStat(1, server.Listener.Addr().String())
+	var client = NewHTTPClient(newTestStatHTTPClient(stat), false)
+	client.SetStat(stat)
+	client.SetWarmTarget(server.URL, "example.com")
+
+	var pool = &configs.OriginWarmPoolConfig{
+		OriginIds:    []int64{1},
+		MinIdleConns: 4,
+	}
+	err := pool.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.Warm(pool)
+	a.IsTrue(stat.Conns() == 4)
+	a.IsTrue(stat.IdleConns() == 4)
+	a.IsTrue(stat.AsMap().GetInt64("warmRequests") == 4)
+	a.IsTrue(stat.AsMap().GetInt64("requests") == 0)
+
+	// 未到检查间隔时不再预热
+	client.Warm(pool)
+	a.IsTrue(stat.AsMap().GetInt64("warmRequests") == 4)
+
+	client.Close()
+	a.IsTrue(stat.Conns() == 0)
+}
+
+func TestHTTPClientStat_ClientStat(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		_, _ = writer.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	var stat = NewHTTPClientStat(1, server.Listener.Addr().String())
+	var clientStat1 = stat.NewClientStat()
+	var clientStat2 = stat.NewClientStat()
+	var client1 = newTestStatHTTPClient(clientStat1)
+	var client2 = newTestStatHTTPClient(clientStat2)
+	for _, client := range []*http.Client{client1, client2} {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	// 每个客户端单独计算空闲连接数，同时汇总到源站统计中
+	a.IsTrue(clientStat1.Conns() == 1)
+	a.IsTrue(clientStat1.IdleConns() == 1)
+	a.IsTrue(clientStat2.Conns() == 1)
+	a.IsTrue(stat.Conns() == 2)
+	a.IsTrue(stat.IdleConns() == 2)
+	a.IsTrue(stat.AsMap().GetInt64("requests") == 2)
+	a.IsTrue(clientStat1.AsMap().GetInt64("requests") == 0)
+
+	client1.CloseIdleConnections()
+	a.IsTrue(clientStat1.Conns() == 0)
+	a.IsTrue(stat.Conns() == 1)
+}
+
+func TestHTTPClient_Warm_HTTP2(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var server = httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		writer.WriteHeader(http.StatusOK)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	var stat = NewHTTPClientStat(1, server.Listener.Addr().String())
+	var rawClient = server.Client()
+	var transport = rawClient.Transport.(*http.Transport)
+	var dialer = &net.Dialer{}
+	transport.DialContext = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		stat.addConn()
+		return NewOriginStatConn(conn, stat), nil
+	}
+	rawClient.Transport = &HTTPClientTransport{
+		Transport: transport,
+		stat:      stat,
+	}
+
+	var client = NewHTTPClient(rawClient, false)
+	client.SetStat(stat)
+	client.SetWarmTarget(server.URL, "example.com")
+
+	var pool = &configs.OriginWarmPoolConfig{
+		OriginIds:    []int64{1},
+		MinIdleConns: 4,
+	}
+	err := pool.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.Warm(pool)
+	a.IsTrue(stat.IsHTTP2())
+	var warmRequests = stat.AsMap().GetInt64("warmRequests")
+
+	// 已经有HTTP/2连接时不再预热
+	client.lastWarmAt = 0
+	client.Warm(pool)
+	a.IsTrue(stat.AsMap().GetInt64("warmRequests") == warmRequests)
+
+	client.Close()
+}
@@ -10,10 +10,18 @@ const emptyHTTPLocation = "/$EmptyHTTPLocation$"
 
 type HTTPClientTransport struct {
 	*http.Transport
+
+	stat *HTTPClientStat
 }
 
 func (this *HTTPClientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	resp, err := this.Transport.RoundTrip(req)
+	var resp *http.Response
+	var err error
+	if this.stat != nil {
+		resp, err = this.stat.RoundTrip(req, this.Transport.RoundTrip)
+	} else {
+		resp, err = this.Transport.RoundTrip(req)
+	}
 	if err != nil {
 		return resp, err
 	}
@@ -10,6 +10,7 @@ import (
 	"github.com/TeaOSLab/EdgeCommon/pkg/nodeconfigs"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
 	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
+	"github.com/TeaOSLab/EdgeNode/internal/iplibrary"
 	"github.com/TeaOSLab/EdgeNode/internal/metrics"
 	"github.com/TeaOSLab/EdgeNode/internal/stats"
 	"github.com/TeaOSLab/EdgeNode/internal/utils"
@@ -72,17 +73,21 @@ type HTTPRequest struct {
 	filePath             string                            // 请求的文件名，仅在读取Root目录下的内容时不为空
 	origin               *serverconfigs.OriginConfig       // 源站
 	originAddr           string                            // 源站实际地址
+	originLocalAddr      string                            // 连接源站使用的本地IP
 	originStatus         int32                             // 源站响应代码
 	errors               []string                          // 错误信息
 	rewriteRule          *serverconfigs.HTTPRewriteRule    // 匹配到的重写规则
 	rewriteReplace       string                            // 重写规则的目标
 	rewriteIsExternalURL bool                              // 重写目标是否为外部URL
 	remoteAddr           string                            // 计算后的RemoteAddr
+	mmdbResult           *iplibrary.MMDBResult             // 从MMDB中查询到的IP信息
+	mmdbIsLookedUp       bool                              // 是否已经从MMDB中查询过
 
 	cacheRef         *serverconfigs.HTTPCacheRef // 缓存设置
 	cacheKey         string                      // 缓存使用的Key
 	isCached         bool                        // 是否已经被缓存
 	cacheCanTryStale bool                        // 是否可以尝试使用Stale缓存
+	sliceClient      *http.Client                // 切片回源使用的客户端
 
 	isAttack        bool   // 是否是攻击请求
 	requestBodyData []byte // 读取的Body内容
@@ -96,6 +101,7 @@ type HTTPRequest struct {
 	firewallRuleId      int64
 	firewallActions     []string
 	wafHasRequestBody   bool
+	wafMaskActions      []*waf.MaskAction // 需要对响应内容脱敏的动作
 
 	tags []string
 
@@ -143,6 +149,18 @@ func (this *HTTPRequest) init() {
 		"cache.policy.type": "",
 	}
 	this.logAttrs = map[string]string{}
+
+	// gRPC方法名
+	if this.isGRPCRequest() {
+		this.logAttrs["grpc.method"] = this.RawReq.URL.Path
+	}
+
+	// 通过PROXY Protocol接收的连接，记录负载均衡地址
+	var proxyProtocolPeerAddr = this.proxyProtocolVariable("peerAddr")
+	if len(proxyProtocolPeerAddr) > 0 {
+		this.logAttrs["proxyProtocol.peerAddr"] = proxyProtocolPeerAddr
+	}
+
 	this.requestFromTime = time.Now()
 	this.requestId = httpRequestNextId()
 }
@@ -336,7 +354,9 @@ func (this *HTTPRequest) doBegin() {
 		}
 
 		// 处理requestBody
+		// gRPC请求为流式调用，不能预先读取Body
 		if this.RawReq.ContentLength > 0 &&
+			!this.isGRPCRequest() &&
 			this.web.AccessLogRef != nil &&
 			this.web.AccessLogRef.IsOn &&
 			this.web.AccessLogRef.ContainsField(serverconfigs.HTTPAccessLogFieldRequestBody) {
@@ -991,6 +1011,8 @@ func (this *HTTPRequest) Format(source string) string {
 				switch suffix {
 				case "address", "addr":
 					return this.originAddr
+				case "localAddr":
+					return this.originLocalAddr
 				case "host":
 					addr := this.originAddr
 					index := strings.Index(addr, ":")
@@ -1091,10 +1113,41 @@ func (this *HTTPRequest) Format(source string) string {
 
 		// geo
 		if prefix == "geo" {
+			// 只在MMDB中存在的数据
+			switch suffix {
+			case "country.code":
+				var mmdbResult = this.lookupMMDB()
+				if mmdbResult != nil {
+					return mmdbResult.CountryCode
+				}
+				return ""
+			case "asn":
+				var mmdbResult = this.lookupMMDB()
+				if mmdbResult != nil {
+					return types.String(mmdbResult.ASN)
+				}
+				return "0"
+			case "asn.org":
+				var mmdbResult = this.lookupMMDB()
+				if mmdbResult != nil {
+					return mmdbResult.ASOrg
+				}
+				return ""
+			}
+
 			var result = iplib.LookupIP(this.requestRemoteAddr(true))
 
+			// 优先使用MMDB，或者在IP库中找不到时使用MMDB
+			var mmdbResult *iplibrary.MMDBResult
+			if result == nil || !result.IsOk() || iplibrary.SharedMMDBManager.IsOverride() {
+				mmdbResult = this.lookupMMDB()
+			}
+
 			switch suffix {
 			case "country.name":
+				if mmdbResult != nil && len(mmdbResult.CountryName) > 0 {
+					return mmdbResult.CountryName
+				}
 				if result != nil && result.IsOk() {
 					return result.CountryName()
 				}
@@ -1105,6 +1158,9 @@ func (this *HTTPRequest) Format(source string) string {
 				}
 				return "0"
 			case "province.name":
+				if mmdbResult != nil && len(mmdbResult.ProvinceName) > 0 {
+					return mmdbResult.ProvinceName
+				}
 				if result != nil && result.IsOk() {
 					return result.ProvinceName()
 				}
@@ -1115,6 +1171,9 @@ func (this *HTTPRequest) Format(source string) string {
 				}
 				return "0"
 			case "city.name":
+				if mmdbResult != nil && len(mmdbResult.CityName) > 0 {
+					return mmdbResult.CityName
+				}
 				if result != nil && result.IsOk() {
 					return result.CityName()
 				}
@@ -1155,6 +1214,22 @@ func (this *HTTPRequest) Format(source string) string {
 			return ""
 		}
 
+		// PROXY Protocol
+		if prefix == "proxyProtocol" {
+			return this.proxyProtocolVariable(suffix)
+		}
+
+		// gRPC
+		if prefix == "grpc" {
+			switch suffix {
+			case "method":
+				return this.grpcMethod()
+			case "service":
+				return this.grpcService()
+			}
+			return ""
+		}
+
 		// browser
 		if prefix == "browser" {
 			var result = stats.SharedUserAgentParser.Parse(this.RawReq.UserAgent())
@@ -1345,6 +1420,15 @@ func (this *HTTPRequest) requestRemoteAddrs() (result []string) {
 	return
 }
 
+// 从本地MMDB文件中查询客户端IP信息，同一个请求中只查询一次
+func (this *HTTPRequest) lookupMMDB() *iplibrary.MMDBResult {
+	if !this.mmdbIsLookedUp {
+		this.mmdbIsLookedUp = true
+		this.mmdbResult = iplibrary.SharedMMDBManager.Lookup(this.requestRemoteAddr(true))
+	}
+	return this.mmdbResult
+}
+
 // 请求内容长度
 func (this *HTTPRequest) requestLength() int64 {
 	return this.RawReq.ContentLength
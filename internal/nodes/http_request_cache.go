@@ -197,6 +197,12 @@ func (this *HTTPRequest) doCacheRead(useStale bool) (shouldStop bool) {
 			}
 		}
 
+		// 切片缓存
+		err := storage.Purge([]string{caches.SlicePrefix(key)}, "dir")
+		if err != nil {
+			remotelogs.ErrorServer("HTTP_REQUEST_CACHE", "purge slices failed: "+err.Error())
+		}
+
 		// 通过API节点清除别节点上的的Key
 		SharedHTTPCacheTaskManager.PushTaskKeys([]string{key})
 
@@ -209,6 +215,17 @@ func (this *HTTPRequest) doCacheRead(useStale bool) (shouldStop bool) {
 		return
 	}
 
+	// 切片缓存
+	if method == http.MethodGet {
+		var sliceSize = caches.ParseSliceSize(cachePolicy.Options)
+		if sliceSize > 0 {
+			sliceShouldStop, goNext := this.doSliceRead(storage, key, sliceSize, useStale, addStatusHeader)
+			if !goNext {
+				return sliceShouldStop
+			}
+		}
+	}
+
 	var reader caches.Reader
 	var err error
 
@@ -637,6 +654,13 @@ func (this *HTTPRequest) doCacheRead(useStale bool) (shouldStop bool) {
 			if err != nil {
 				this.varMapping["cache.status"] = "MISS"
 
+				// 缓存内容已损坏，此时响应已经开始发送，需要直接中断连接，避免客户端和下游缓存保存不完整的内容
+				if errors.Is(err, caches.ErrCacheCorrupted) {
+					remotelogs.WarnServer("HTTP_REQUEST_CACHE", this.URL()+": read from cache failed: cache file corrupted, connection aborted")
+					this.Close()
+					return true
+				}
+
 				if !this.canIgnore(err) {
 					remotelogs.WarnServer("HTTP_REQUEST_CACHE", this.URL()+": read from cache failed: read body failed: "+err.Error())
 				}
@@ -732,3 +756,49 @@ func (this *HTTPRequest) tryPartialReader(storage caches.StorageInterface, key s
 	isOk = true
 	return pReader, ranges, true
 }
+
+// 检查源站响应是否可以缓存，不能缓存时返回原因
+// contentSize 为完整内容的长度，未知时为-1
+func (this *HTTPRequest) checkCacheableResponse(statusCode int, header http.Header, contentSize int64) (reason string) {
+	var cachePolicy = this.ReqServer.HTTPCachePolicy
+	var cacheRef = this.cacheRef
+	if cachePolicy == nil || cacheRef == nil {
+		return "Policy"
+	}
+
+	// 尺寸
+	if contentSize >= 0 && ((cacheRef.MaxSizeBytes() > 0 && contentSize > cacheRef.MaxSizeBytes()) ||
+		(cachePolicy.MaxSizeBytes() > 0 && contentSize > cachePolicy.MaxSizeBytes()) || (cacheRef.MinSizeBytes() > contentSize)) {
+		return "Content-Length"
+	}
+
+	// 检查状态
+	if !cacheRef.MatchStatus(statusCode) {
+		return "Status: " + types.String(statusCode)
+	}
+
+	// Cache-Control
+	if len(cacheRef.SkipResponseCacheControlValues) > 0 {
+		var cacheControl = header.Get("Cache-Control")
+		if len(cacheControl) > 0 {
+			values := strings.Split(cacheControl, ",")
+			for _, value := range values {
+				if cacheRef.ContainsCacheControl(strings.TrimSpace(value)) {
+					return "Cache-Control: " + cacheControl
+				}
+			}
+		}
+	}
+
+	// Set-Cookie
+	if cacheRef.SkipResponseSetCookie && len(header.Get("Set-Cookie")) > 0 {
+		return "Set-Cookie"
+	}
+
+	// 校验其他条件
+	if cacheRef.Conds != nil && cacheRef.Conds.HasResponseConds() && !cacheRef.Conds.MatchResponse(this.Format) {
+		return "ResponseConds"
+	}
+
+	return ""
+}
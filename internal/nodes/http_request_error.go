@@ -70,6 +70,12 @@ func (this *HTTPRequest) write50x(err error, statusCode int, enMessage string, z
 		this.addError(err)
 	}
 
+	// gRPC客户端无法解析HTML页面
+	if this.isGRPCRequest() {
+		this.writeGRPCError(statusCode, enMessage)
+		return
+	}
+
 	// 尝试从缓存中恢复
 	if canTryStale &&
 		this.cacheCanTryStale &&
@@ -0,0 +1,120 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/iwind/TeaGo/types"
+	"net/http"
+	"strings"
+)
+
+// gRPC状态码
+// 参考：https://github.com/grpc/grpc/blob/master/doc/statuscodes.md
+const (
+	grpcStatusUnknown          = 2
+	grpcStatusPermissionDenied = 7
+	grpcStatusUnimplemented    = 12
+	grpcStatusInternal         = 13
+	grpcStatusUnavailable      = 14
+	grpcStatusUnauthenticated  = 16
+)
+
+// 是否为gRPC请求
+func (this *HTTPRequest) isGRPCRequest() bool {
+	return this.RawReq != nil &&
+		this.RawReq.ProtoMajor == 2 &&
+		isGRPCContentType(this.RawReq.Header.Get("Content-Type"))
+}
+
+// gRPC方法名，格式为：/package.Service/Method
+func (this *HTTPRequest) grpcMethod() string {
+	if !this.isGRPCRequest() {
+		return ""
+	}
+	return this.RawReq.URL.Path
+}
+
+// gRPC服务名，格式为：package.Service
+func (this *HTTPRequest) grpcService() string {
+	var method = strings.TrimPrefix(this.grpcMethod(), "/")
+	var slashIndex = strings.LastIndex(method, "/")
+	if slashIndex > 0 {
+		return method[:slashIndex]
+	}
+	return ""
+}
+
+// 以gRPC的方式返回错误
+// gRPC客户端只能识别Trailers-Only响应中的错误，所以HTTP状态码始终为200
+func (this *HTTPRequest) writeGRPCError(httpStatusCode int, message string) {
+	var header = this.writer.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", "application/grpc")
+	header.Set("Grpc-Status", types.String(grpcStatusFromHTTP(httpStatusCode)))
+	if len(message) > 0 {
+		header.Set("Grpc-Message", encodeGRPCMessage(message))
+	}
+	this.writer.WriteHeader(http.StatusOK)
+}
+
+// 判断是否为gRPC内容类型
+func isGRPCContentType(contentType string) bool {
+	if !strings.HasPrefix(contentType, "application/grpc") {
+		return false
+	}
+	if len(contentType) == len("application/grpc") {
+		return true
+	}
+	switch contentType[len("application/grpc")] {
+	case '+', ';':
+		return true
+	}
+	return false
+}
+
+// 将HTTP状态码转换为gRPC状态码
+// 参考：https://github.com/grpc/grpc/blob/master/doc/http-grpc-status-mapping.md
+func grpcStatusFromHTTP(httpStatusCode int) int {
+	switch httpStatusCode {
+	case http.StatusBadRequest:
+		return grpcStatusInternal
+	case http.StatusUnauthorized:
+		return grpcStatusUnauthenticated
+	case http.StatusForbidden:
+		return grpcStatusPermissionDenied
+	case http.StatusNotFound:
+		return grpcStatusUnimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return grpcStatusUnavailable
+	}
+	return grpcStatusUnknown
+}
+
+// 对grpc-message进行百分号编码
+func encodeGRPCMessage(message string) string {
+	var shouldEncode = false
+	for i := 0; i < len(message); i++ {
+		var c = message[i]
+		if c < ' ' || c > '~' || c == '%' {
+			shouldEncode = true
+			break
+		}
+	}
+	if !shouldEncode {
+		return message
+	}
+
+	const hexChars = "0123456789ABCDEF"
+	var builder strings.Builder
+	for i := 0; i < len(message); i++ {
+		var c = message[i]
+		if c < ' ' || c > '~' || c == '%' {
+			builder.WriteByte('%')
+			builder.WriteByte(hexChars[c>>4])
+			builder.WriteByte(hexChars[c&0xF])
+		} else {
+			builder.WriteByte(c)
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,49 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/iwind/TeaGo/assert"
+	"net/http"
+	"testing"
+)
+
+func TestHTTPRequest_isGRPCRequest(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	rawReq, err := http.NewRequest(http.MethodPost, "https://example.com/helloworld.Greeter/SayHello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawReq.Header.Set("Content-Type", "application/grpc+proto")
+
+	var req = &HTTPRequest{RawReq: rawReq}
+	a.IsFalse(req.isGRPCRequest()) // HTTP/1.1
+
+	rawReq.ProtoMajor = 2
+	a.IsTrue(req.isGRPCRequest())
+	a.IsTrue(req.grpcMethod() == "/helloworld.Greeter/SayHello")
+	a.IsTrue(req.grpcService() == "helloworld.Greeter")
+
+	rawReq.Header.Set("Content-Type", "application/grpc-web")
+	a.IsFalse(req.isGRPCRequest())
+	a.IsTrue(len(req.grpcService()) == 0)
+}
+
+func TestIsGRPCContentType(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	a.IsTrue(isGRPCContentType("application/grpc"))
+	a.IsTrue(isGRPCContentType("application/grpc+proto"))
+	a.IsTrue(isGRPCContentType("application/grpc;charset=utf-8"))
+	a.IsFalse(isGRPCContentType("application/grpc-web"))
+	a.IsFalse(isGRPCContentType("application/json"))
+}
+
+func TestEncodeGRPCMessage(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	a.IsTrue(encodeGRPCMessage("origin unavailable") == "origin unavailable")
+	a.IsTrue(encodeGRPCMessage("100% failed\n") == "100%25 failed%0A")
+	a.IsTrue(encodeGRPCMessage("源站") == "%E6%BA%90%E7%AB%99")
+	a.IsTrue(grpcStatusFromHTTP(http.StatusBadGateway) == grpcStatusUnavailable)
+	a.IsTrue(grpcStatusFromHTTP(http.StatusInternalServerError) == grpcStatusUnknown)
+}
@@ -0,0 +1,40 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import "net"
+
+// 读取通过PROXY Protocol接收的连接
+func (this *HTTPRequest) proxyProtocolConn() (proxyProtocolConn *ProxyProtocolConn, ok bool) {
+	if this.RawReq == nil {
+		return
+	}
+	var requestConn = this.RawReq.Context().Value(HTTPConnContextKey)
+	if requestConn == nil {
+		return
+	}
+	clientConn, isClientConn := requestConn.(ClientConnInterface)
+	if !isClientConn {
+		return
+	}
+	proxyProtocolConn, ok = clientConn.ProxyProtocolConn()
+	if ok && !proxyProtocolConn.IsProxied() {
+		return nil, false
+	}
+	return
+}
+
+// 读取PROXY Protocol相关变量
+func (this *HTTPRequest) proxyProtocolVariable(name string) string {
+	proxyProtocolConn, ok := this.proxyProtocolConn()
+	if !ok {
+		return ""
+	}
+
+	switch name {
+	case "peerAddr":
+		host, _, _ := net.SplitHostPort(proxyProtocolConn.PeerAddr().String())
+		return host
+	}
+	return proxyProtocolConn.Attr(name)
+}
@@ -14,7 +14,9 @@ import (
 	"github.com/iwind/TeaGo/lists"
 	"github.com/iwind/TeaGo/types"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"strconv"
 	"strings"
@@ -136,118 +138,12 @@ func (this *HTTPRequest) doOriginRequest(failedOriginIds []int64, failedLnNodeId
 		return
 	}
 
-	if isHTTPOrigin {
-		this.RawReq.URL.Scheme = origin.Addr.Protocol.Primary().Scheme()
-	}
-
-	// StripPrefix
-	if len(stripPrefix) > 0 {
-		if stripPrefix[0] != '/' {
-			stripPrefix = "/" + stripPrefix
-		}
-		this.uri = strings.TrimPrefix(this.uri, stripPrefix)
-		if len(this.uri) == 0 || this.uri[0] != '/' {
-			this.uri = "/" + this.uri
-		}
-	}
-
-	// RequestURI
-	if len(requestURI) > 0 {
-		if requestURIHasVariables {
-			this.uri = this.Format(requestURI)
-		} else {
-			this.uri = requestURI
-		}
-		if len(this.uri) == 0 || this.uri[0] != '/' {
-			this.uri = "/" + this.uri
-		}
-
-		// 处理RequestURI中的问号
-		var questionMark = strings.LastIndex(this.uri, "?")
-		if questionMark > 0 {
-			var path = this.uri[:questionMark]
-			if strings.Contains(path, "?") {
-				this.uri = path + "&" + this.uri[questionMark+1:]
-			}
-		}
-
-		// 去除多个/
-		this.uri = utils.CleanPath(this.uri)
-	}
-
-	var originAddr = ""
-	if isHTTPOrigin {
-		// 获取源站地址
-		originAddr = origin.Addr.PickAddress()
-		if origin.Addr.HostHasVariables() {
-			originAddr = this.Format(originAddr)
-		}
-
-		// 端口跟随
-		if origin.FollowPort {
-			var originHostIndex = strings.Index(originAddr, ":")
-			if originHostIndex < 0 {
-				var originErr = errors.New(this.URL() + ": Invalid origin address '" + originAddr + "', lacking port")
-				remotelogs.ErrorServer("HTTP_REQUEST_REVERSE_PROXY", originErr.Error())
-				this.write50x(originErr, http.StatusBadGateway, "No port in origin site address", "源站地址中没有配置端口", true)
-				return
-			}
-			originAddr = originAddr[:originHostIndex+1] + types.String(this.requestServerPort())
-		}
-		this.originAddr = originAddr
-
-		// RequestHost
-		if len(requestHost) > 0 {
-			if requestHostHasVariables {
-				this.RawReq.Host = this.Format(requestHost)
-			} else {
-				this.RawReq.Host = requestHost
-			}
-
-			// 是否移除端口
-			if this.reverseProxy.RequestHostExcludingPort {
-				this.RawReq.Host = utils.ParseAddrHost(this.RawReq.Host)
-			}
-
-			this.RawReq.URL.Host = this.RawReq.Host
-		} else if this.reverseProxy.RequestHostType == serverconfigs.RequestHostTypeOrigin {
-			// 源站主机名
-			var hostname = originAddr
-			if origin.Addr.Protocol.IsHTTPFamily() {
-				hostname = strings.TrimSuffix(hostname, ":80")
-			} else if origin.Addr.Protocol.IsHTTPSFamily() {
-				hostname = strings.TrimSuffix(hostname, ":443")
-			}
-
-			this.RawReq.Host = hostname
-
-			// 是否移除端口
-			if this.reverseProxy.RequestHostExcludingPort {
-				this.RawReq.Host = utils.ParseAddrHost(this.RawReq.Host)
-			}
-
-			this.RawReq.URL.Host = this.RawReq.Host
-		} else {
-			this.RawReq.URL.Host = this.ReqHost
-
-			// 是否移除端口
-			if this.reverseProxy.RequestHostExcludingPort {
-				this.RawReq.Host = utils.ParseAddrHost(this.RawReq.Host)
-				this.RawReq.URL.Host = utils.ParseAddrHost(this.RawReq.URL.Host)
-			}
-		}
-	}
-
-	// 重组请求URL
-	var questionMark = strings.Index(this.uri, "?")
-	if questionMark > -1 {
-		this.RawReq.URL.Path = this.uri[:questionMark]
-		this.RawReq.URL.RawQuery = this.uri[questionMark+1:]
-	} else {
-		this.RawReq.URL.Path = this.uri
-		this.RawReq.URL.RawQuery = ""
+	originAddr, err := this.prepareOriginRequest(origin, isHTTPOrigin, stripPrefix, requestURI, requestURIHasVariables, requestHost, requestHostHasVariables)
+	if err != nil {
+		remotelogs.ErrorServer("HTTP_REQUEST_REVERSE_PROXY", err.Error())
+		this.write50x(err, http.StatusBadGateway, "No port in origin site address", "源站地址中没有配置端口", true)
+		return
 	}
-	this.RawReq.RequestURI = ""
 
 	// 处理Header
 	this.setForwardHeaders(this.RawReq.Header)
@@ -310,7 +206,18 @@ func (this *HTTPRequest) doOriginRequest(failedOriginIds []int64, failedLnNodeId
 		}
 
 		// 开始请求
-		resp, requestErr = client.Do(this.RawReq)
+		var originReq = this.RawReq
+		if SharedOriginEgressManager.FindPool(origin.Id, this.ReqServer.Id) != nil {
+			// 使用出口IP时记录连接源站使用的本地地址
+			originReq = this.RawReq.WithContext(httptrace.WithClientTrace(this.RawReq.Context(), &httptrace.ClientTrace{
+				GotConn: func(info httptrace.GotConnInfo) {
+					if info.Conn != nil {
+						this.setOriginLocalAddr(info.Conn.LocalAddr())
+					}
+				},
+			}))
+		}
+		resp, requestErr = client.Do(originReq)
 
 		// recover Accept-Encoding
 		if acceptEncodingChanged {
@@ -351,12 +258,23 @@ func (this *HTTPRequest) doOriginRequest(failedOriginIds []int64, failedLnNodeId
 	}
 
 	if requestErr != nil {
+		// 源站证书校验失败
+		var tlsVerifyErr *OriginTLSVerifyError
+		if errors.As(requestErr, &tlsVerifyErr) {
+			SharedOriginStateManager.Fail(origin, this.ReqServer.Id, requestHost, this.reverseProxy, func() {
+				this.reverseProxy.ResetScheduling()
+			})
+			this.write50x(requestErr, http.StatusBadGateway, "Failed to verify origin site certificate (error code: "+tlsVerifyErr.Code+")", "源站证书校验失败（错误代号："+tlsVerifyErr.Code+"）", true)
+			remotelogs.WarnServer("HTTP_REQUEST_REVERSE_PROXY", this.URL()+": Request origin server failed: "+requestErr.Error())
+			return
+		}
+
 		// 客户端取消请求，则不提示
 		var httpErr *url.Error
 		var ok = errors.As(requestErr, &httpErr)
 		if !ok {
 			if isHTTPOrigin {
-				SharedOriginStateManager.Fail(origin, requestHost, this.reverseProxy, func() {
+				SharedOriginStateManager.Fail(origin, this.ReqServer.Id, requestHost, this.reverseProxy, func() {
 					this.reverseProxy.ResetScheduling()
 				})
 			}
@@ -369,7 +287,7 @@ func (this *HTTPRequest) doOriginRequest(failedOriginIds []int64, failedLnNodeId
 			remotelogs.WarnServer("HTTP_REQUEST_REVERSE_PROXY", this.RawReq.URL.String()+": Request origin server failed: "+requestErr.Error())
 		} else if !errors.Is(httpErr, context.Canceled) {
 			if isHTTPOrigin {
-				SharedOriginStateManager.Fail(origin, requestHost, this.reverseProxy, func() {
+				SharedOriginStateManager.Fail(origin, this.ReqServer.Id, requestHost, this.reverseProxy, func() {
 					this.reverseProxy.ResetScheduling()
 				})
 			}
@@ -470,6 +388,7 @@ func (this *HTTPRequest) doOriginRequest(failedOriginIds []int64, failedLnNodeId
 		if this.doWAFResponse(resp) {
 			return
 		}
+		this.doWAFMaskResponse(resp)
 	}
 
 	// 特殊页面
@@ -557,7 +476,7 @@ func (this *HTTPRequest) doOriginRequest(failedOriginIds []int64, failedLnNodeId
 	this.ProcessResponseHeaders(this.writer.Header(), resp.StatusCode)
 
 	// 是否需要刷新
-	var shouldAutoFlush = this.reverseProxy.AutoFlush || (resp.Header != nil && strings.Contains(resp.Header.Get("Content-Type"), "stream"))
+	var shouldAutoFlush = this.reverseProxy.AutoFlush || (resp.Header != nil && strings.Contains(resp.Header.Get("Content-Type"), "stream")) || this.isGRPCRequest()
 
 	// 设置当前连接为Persistence
 	if shouldAutoFlush && this.nodeConfig != nil && this.nodeConfig.HasConnTimeoutSettings() {
@@ -588,6 +507,9 @@ func (this *HTTPRequest) doOriginRequest(failedOriginIds []int64, failedLnNodeId
 		_ = resp.Body.Close()
 		respBodyIsClosed = true
 
+		// Trailer只有在读取完内容后才可用
+		this.writer.WriteTrailers(resp.Trailer)
+
 		this.writer.SetOk()
 		return
 	}
@@ -652,6 +574,9 @@ func (this *HTTPRequest) doOriginRequest(failedOriginIds []int64, failedLnNodeId
 		}
 	}
 
+	// 转发Trailer，比如gRPC的grpc-status、grpc-message
+	this.writer.WriteTrailers(resp.Trailer)
+
 	// 是否成功结束
 	if (err == nil || err == io.EOF) && (closeErr == nil || closeErr == io.EOF) {
 		this.writer.SetOk()
@@ -659,3 +584,130 @@ func (this *HTTPRequest) doOriginRequest(failedOriginIds []int64, failedLnNodeId
 
 	return
 }
+
+// 根据源站设置修改回源请求的Scheme、URI和Host，返回源站地址
+func (this *HTTPRequest) prepareOriginRequest(origin *serverconfigs.OriginConfig, isHTTPOrigin bool, stripPrefix string, requestURI string, requestURIHasVariables bool, requestHost string, requestHostHasVariables bool) (originAddr string, err error) {
+	if isHTTPOrigin {
+		this.RawReq.URL.Scheme = origin.Addr.Protocol.Primary().Scheme()
+	}
+
+	// StripPrefix
+	if len(stripPrefix) > 0 {
+		if stripPrefix[0] != '/' {
+			stripPrefix = "/" + stripPrefix
+		}
+		this.uri = strings.TrimPrefix(this.uri, stripPrefix)
+		if len(this.uri) == 0 || this.uri[0] != '/' {
+			this.uri = "/" + this.uri
+		}
+	}
+
+	// RequestURI
+	if len(requestURI) > 0 {
+		if requestURIHasVariables {
+			this.uri = this.Format(requestURI)
+		} else {
+			this.uri = requestURI
+		}
+		if len(this.uri) == 0 || this.uri[0] != '/' {
+			this.uri = "/" + this.uri
+		}
+
+		// 处理RequestURI中的问号
+		var questionMark = strings.LastIndex(this.uri, "?")
+		if questionMark > 0 {
+			var path = this.uri[:questionMark]
+			if strings.Contains(path, "?") {
+				this.uri = path + "&" + this.uri[questionMark+1:]
+			}
+		}
+
+		// 去除多个/
+		this.uri = utils.CleanPath(this.uri)
+	}
+
+	if isHTTPOrigin {
+		// 获取源站地址
+		originAddr = origin.Addr.PickAddress()
+		if origin.Addr.HostHasVariables() {
+			originAddr = this.Format(originAddr)
+		}
+
+		// 端口跟随
+		if origin.FollowPort {
+			var originHostIndex = strings.Index(originAddr, ":")
+			if originHostIndex < 0 {
+				return "", errors.New(this.URL() + ": Invalid origin address '" + originAddr + "', lacking port")
+			}
+			originAddr = originAddr[:originHostIndex+1] + types.String(this.requestServerPort())
+		}
+		this.originAddr = originAddr
+
+		// RequestHost
+		if len(requestHost) > 0 {
+			if requestHostHasVariables {
+				this.RawReq.Host = this.Format(requestHost)
+			} else {
+				this.RawReq.Host = requestHost
+			}
+
+			// 是否移除端口
+			if this.reverseProxy.RequestHostExcludingPort {
+				this.RawReq.Host = utils.ParseAddrHost(this.RawReq.Host)
+			}
+
+			this.RawReq.URL.Host = this.RawReq.Host
+		} else if this.reverseProxy.RequestHostType == serverconfigs.RequestHostTypeOrigin {
+			// 源站主机名
+			var hostname = originAddr
+			if origin.Addr.Protocol.IsHTTPFamily() {
+				hostname = strings.TrimSuffix(hostname, ":80")
+			} else if origin.Addr.Protocol.IsHTTPSFamily() {
+				hostname = strings.TrimSuffix(hostname, ":443")
+			}
+
+			this.RawReq.Host = hostname
+
+			// 是否移除端口
+			if this.reverseProxy.RequestHostExcludingPort {
+				this.RawReq.Host = utils.ParseAddrHost(this.RawReq.Host)
+			}
+
+			this.RawReq.URL.Host = this.RawReq.Host
+		} else {
+			this.RawReq.URL.Host = this.ReqHost
+
+			// 是否移除端口
+			if this.reverseProxy.RequestHostExcludingPort {
+				this.RawReq.Host = utils.ParseAddrHost(this.RawReq.Host)
+				this.RawReq.URL.Host = utils.ParseAddrHost(this.RawReq.URL.Host)
+			}
+		}
+	}
+
+	// 重组请求URL
+	var questionMark = strings.Index(this.uri, "?")
+	if questionMark > -1 {
+		this.RawReq.URL.Path = this.uri[:questionMark]
+		this.RawReq.URL.RawQuery = this.uri[questionMark+1:]
+	} else {
+		this.RawReq.URL.Path = this.uri
+		this.RawReq.URL.RawQuery = ""
+	}
+	this.RawReq.RequestURI = ""
+
+	return originAddr, nil
+}
+
+// 设置连接源站使用的本地IP，用于 ${origin.localAddr} 变量和访问日志
+func (this *HTTPRequest) setOriginLocalAddr(addr net.Addr) {
+	if addr == nil {
+		return
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return
+	}
+	this.originLocalAddr = host
+	this.logAttrs["origin.localAddr"] = host
+}
@@ -0,0 +1,623 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"bytes"
+	"errors"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/shared"
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/bytepool"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/fasttime"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/fnv"
+	rangeutils "github.com/TeaOSLab/EdgeNode/internal/utils/ranges"
+	"github.com/iwind/TeaGo/types"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errHTTPSliceMismatch = errors.New("slice validator mismatch")
+
+// 单个切片
+type httpSlice struct {
+	index     int64
+	start     int64 // 切片在完整内容中的开始位置
+	length    int64 // 切片长度
+	total     int64 // 完整内容长度
+	header    http.Header
+	validator string // ETag或Last-Modified，用来检查各个切片是否来自同一个版本
+
+	reader caches.Reader  // 从缓存中读取的切片
+	resp   *http.Response // 从源站读取的切片
+
+	passThrough bool // 源站没有返回切片，直接将响应转发给客户端
+}
+
+func (this *httpSlice) Close() {
+	if this.reader != nil {
+		_ = this.reader.Close()
+	}
+	if this.resp != nil {
+		_ = this.resp.Body.Close()
+	}
+}
+
+// 读取切片缓存
+// 只处理没有Range或者只有一个Range的GET请求，其余的返回goNext=true交给正常的缓存流程处理
+func (this *HTTPRequest) doSliceRead(storage caches.StorageInterface, key string, sliceSize int64, useStale bool, addStatusHeader bool) (shouldStop bool, goNext bool) {
+	goNext = true
+
+	// 切片直接请求源站，对象存储源站仍然使用正常的缓存流程
+	if this.reverseProxy == nil || httpSliceHasUnsupportedOrigins(this.reverseProxy) {
+		return
+	}
+
+	var requestRange = rangeutils.NewRange(0, -1)
+	var rangeHeader = this.RawReq.Header.Get("Range")
+	var isRangeRequest = len(rangeHeader) > 0
+	if isRangeRequest {
+		if len(this.RawReq.Header.Get("If-Range")) > 0 {
+			return
+		}
+		ranges, ok := httpRequestParseRangeHeader(rangeHeader)
+		if !ok || len(ranges) != 1 {
+			return
+		}
+		requestRange = ranges[0]
+	}
+	goNext = false
+
+	// 读取第一个切片，以便获得内容总长度
+	var firstIndex int64 = 0
+	if requestRange.Start() > 0 {
+		firstIndex = requestRange.Start() / sliceSize
+	}
+	firstSlice, err := this.openSlice(storage, key, firstIndex, sliceSize, useStale)
+	if err != nil {
+		if !this.canIgnore(err) {
+			remotelogs.WarnServer("HTTP_REQUEST_SLICE", this.URL()+": open slice failed: "+err.Error())
+		}
+		this.write50x(err, http.StatusBadGateway, "Failed to read origin site", "源站读取失败", false)
+		return true, false
+	}
+	defer func() {
+		if firstSlice != nil {
+			firstSlice.Close()
+		}
+	}()
+
+	var pool = this.bytePool(sliceSize)
+	var buf = pool.Get()
+	defer pool.Put(buf)
+
+	// 源站不支持Range或者返回了错误
+	if firstSlice.passThrough {
+		this.cacheRef = nil
+		this.varMapping["cache.status"] = "BYPASS"
+
+		var resp = firstSlice.resp
+		for k, v := range resp.Header {
+			if k == "X-Cache" {
+				continue
+			}
+			this.writer.Header()[k] = v
+		}
+		this.writer.WriteHeader(resp.StatusCode)
+		_, err = io.CopyBuffer(this.writer, resp.Body, buf.Bytes)
+		if err != nil && !this.canIgnore(err) {
+			remotelogs.WarnServer("HTTP_REQUEST_SLICE", this.URL()+": read origin response failed: "+err.Error())
+		}
+		this.writer.SetOk()
+		return true, false
+	}
+
+	var total = firstSlice.total
+	var validator = firstSlice.validator
+	var respHeader = this.writer.Header()
+	var isHit = firstSlice.reader != nil
+
+	r, ok := requestRange.Convert(total)
+	if !ok {
+		respHeader.Set("Content-Range", "bytes */"+types.String(total))
+		this.ProcessResponseHeaders(respHeader, http.StatusRequestedRangeNotSatisfiable)
+		this.writer.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		this.cacheRef = nil
+		return true, false
+	}
+
+	for k, v := range firstSlice.header {
+		if k == "Content-Range" || k == "Content-Length" || this.writer.shouldIgnoreHeader(k) {
+			continue
+		}
+		respHeader[k] = v
+	}
+
+	if isHit {
+		this.varMapping["cache.status"] = "HIT"
+		this.logAttrs["cache.status"] = "HIT"
+	} else {
+		this.varMapping["cache.status"] = "MISS"
+	}
+	if addStatusHeader {
+		if isHit {
+			respHeader.Set("X-Cache", "HIT, slice")
+		} else {
+			respHeader.Set("X-Cache", "MISS, slice")
+		}
+	} else {
+		respHeader.Del("X-Cache")
+	}
+
+	// 支持 If-None-Match
+	var eTag = respHeader.Get("ETag")
+	if !isRangeRequest && len(eTag) > 0 && this.requestHeader("If-None-Match") == eTag {
+		this.ProcessResponseHeaders(respHeader, http.StatusNotModified)
+		this.writer.WriteHeader(http.StatusNotModified)
+		this.isCached = isHit
+		this.cacheRef = nil
+		this.writer.SetOk()
+		return true, false
+	}
+
+	var statusCode = http.StatusOK
+	respHeader.Set("Accept-Ranges", "bytes")
+	respHeader.Set("Content-Length", types.String(r.Length()))
+	if isRangeRequest {
+		statusCode = http.StatusPartialContent
+		respHeader.Set("Content-Range", r.ComposeContentRangeHeader(types.String(total)))
+	}
+	this.ProcessResponseHeaders(respHeader, statusCode)
+	if firstSlice.reader != nil {
+		this.addExpiresHeader(firstSlice.reader.ExpiresAt())
+	}
+	this.writer.WriteHeader(statusCode)
+
+	// 依次输出各个切片
+	fromIndex, toIndex := caches.SliceIndexRange(r.Start(), r.End(), sliceSize)
+	for index := fromIndex; index <= toIndex; index++ {
+		var slice *httpSlice
+		if index == firstSlice.index {
+			slice = firstSlice
+			firstSlice = nil
+		} else {
+			slice, err = this.openSlice(storage, key, index, sliceSize, useStale)
+			if err == nil && (slice.passThrough || slice.total != total || slice.validator != validator) {
+				slice.Close()
+				err = errHTTPSliceMismatch
+			}
+			if err != nil {
+				this.abortSliceRead(storage, key, err)
+				return true, false
+			}
+		}
+
+		if slice.reader == nil {
+			isHit = false
+		}
+
+		// 当前切片中需要输出的区间
+		sliceFrom, sliceTo := httpSliceOverlap(r.Start(), r.End(), slice.start, slice.length)
+
+		err = this.writeSlice(storage, key, slice, sliceFrom, sliceTo, buf.Bytes)
+		slice.Close()
+		if err != nil {
+			this.abortSliceRead(storage, key, err)
+			return true, false
+		}
+	}
+
+	// 没有输出的第一个切片（比如 bytes=-100 这样的区间）仍然写入缓存
+	if firstSlice != nil && firstSlice.resp != nil {
+		_ = this.writeSlice(storage, key, firstSlice, 0, -1, buf.Bytes)
+	}
+
+	if !isHit && this.varMapping["cache.status"] != "BYPASS" {
+		this.varMapping["cache.status"] = "MISS"
+		this.logAttrs["cache.status"] = "MISS"
+	}
+	this.isCached = isHit
+	this.cacheRef = nil
+	this.writer.SetOk()
+
+	return true, false
+}
+
+// 打开切片，优先从缓存中读取，缓存中没有时从源站读取
+func (this *HTTPRequest) openSlice(storage caches.StorageInterface, key string, index int64, sliceSize int64, useStale bool) (*httpSlice, error) {
+	reader, err := storage.OpenReader(caches.SliceKey(key, index), useStale, false)
+	if err == nil {
+		header, headerErr := this.readSliceHeader(reader)
+		if headerErr == nil {
+			start, total := httpRequestParseContentRangeHeader(header.Get("Content-Range"))
+			if start == index*sliceSize && total > 0 && reader.BodySize() > 0 {
+				return &httpSlice{
+					index:     index,
+					start:     start,
+					length:    reader.BodySize(),
+					total:     total,
+					header:    header,
+					validator: httpSliceValidator(header),
+					reader:    reader,
+				}, nil
+			}
+		}
+
+		// 缓存内容不完整，重新从源站读取
+		_ = reader.Close()
+	}
+
+	resp, err := this.fetchSlice(index, sliceSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return httpSliceFromResponse(index, sliceSize, resp), nil
+}
+
+// 从源站读取切片
+func (this *HTTPRequest) fetchSlice(index int64, sliceSize int64) (*http.Response, error) {
+	client, err := this.prepareSliceClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var req = this.RawReq.Clone(this.RawReq.Context())
+	req.Body = http.NoBody
+	req.ContentLength = 0
+	for _, key := range []string{"If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+		req.Header.Del(key)
+	}
+
+	var start = index * sliceSize
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(start+sliceSize-1, 10))
+	req.Header.Set("Accept-Encoding", "identity")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 在当前请求的访问日志中记录回源的切片数
+	this.logAttrs["cache.sliceFetches"] = types.String(types.Int(this.logAttrs["cache.sliceFetches"]) + 1)
+	this.originStatus = int32(resp.StatusCode)
+
+	return resp, nil
+}
+
+// 准备切片回源使用的客户端
+// 和正常回源使用同样的源站设置，同一个请求中的所有切片都从同一个源站读取
+func (this *HTTPRequest) prepareSliceClient() (*http.Client, error) {
+	if this.sliceClient != nil {
+		return this.sliceClient, nil
+	}
+
+	var stripPrefix = this.reverseProxy.StripPrefix
+	var requestURI = this.reverseProxy.RequestURI
+	var requestURIHasVariables = this.reverseProxy.RequestURIHasVariables()
+
+	var requestHost = ""
+	if this.reverseProxy.RequestHostType == serverconfigs.RequestHostTypeCustomized {
+		requestHost = this.reverseProxy.RequestHost
+	}
+	var requestHostHasVariables = this.reverseProxy.RequestHostHasVariables()
+
+	// 二级节点
+	origin, _, _ := this.getLnOrigin(nil, fnv.HashString(this.URL()))
+	if origin != nil {
+		requestHost = this.ReqHost
+	} else {
+		var requestCall = shared.NewRequestCall()
+		requestCall.Request = this.RawReq
+		requestCall.Formatter = this.Format
+		requestCall.Domain = this.ReqHost
+
+		origin = this.reverseProxy.NextOrigin(requestCall)
+		requestCall.CallResponseCallbacks(this.writer)
+		if origin == nil {
+			return nil, errors.New(this.URL() + ": no available origin sites for reverse proxy")
+		}
+
+		if len(origin.StripPrefix) > 0 {
+			stripPrefix = origin.StripPrefix
+		}
+		if len(origin.RequestURI) > 0 {
+			requestURI = origin.RequestURI
+			requestURIHasVariables = origin.RequestURIHasVariables()
+		}
+	}
+	if origin.OSS != nil || origin.Addr == nil {
+		return nil, errors.New(this.URL() + ": origin '" + types.String(origin.Id) + "' does not support slice requests")
+	}
+
+	this.origin = origin // 设置全局变量是为了日志等处理
+
+	if len(origin.RequestHost) > 0 {
+		requestHost = origin.RequestHost
+		requestHostHasVariables = origin.RequestHostHasVariables()
+	}
+
+	originAddr, err := this.prepareOriginRequest(origin, true, stripPrefix, requestURI, requestURIHasVariables, requestHost, requestHostHasVariables)
+	if err != nil {
+		return nil, err
+	}
+
+	// 处理Header
+	this.setForwardHeaders(this.RawReq.Header)
+	this.processRequestHeaders(this.RawReq.Header)
+
+	// 修复空User-Agent问题
+	_, existsUserAgent := this.RawReq.Header["User-Agent"]
+	if !existsUserAgent {
+		this.RawReq.Header["User-Agent"] = []string{""}
+	}
+
+	client, err := SharedHTTPClientPool.Client(this, origin, originAddr, this.reverseProxy.ProxyProtocol, this.reverseProxy.FollowRedirects)
+	if err != nil {
+		return nil, err
+	}
+
+	// 尝试自动纠正源站地址中的scheme
+	if this.RawReq.URL.Scheme == "http" && strings.HasSuffix(originAddr, ":443") {
+		this.RawReq.URL.Scheme = "https"
+	} else if this.RawReq.URL.Scheme == "https" && strings.HasSuffix(originAddr, ":80") {
+		this.RawReq.URL.Scheme = "http"
+	}
+
+	this.sliceClient = client
+	return client, nil
+}
+
+// 输出切片中 [from, to] 区间的内容，从源站读取的切片同时写入缓存
+func (this *HTTPRequest) writeSlice(storage caches.StorageInterface, key string, slice *httpSlice, from int64, to int64, buf []byte) error {
+	// 从缓存中读取
+	if slice.reader != nil {
+		if from > to {
+			return nil
+		}
+		return slice.reader.ReadBodyRange(buf, from, to, func(n int) (goNext bool, readErr error) {
+			_, readErr = this.writer.Write(buf[:n])
+			if readErr != nil {
+				return false, errWritingToClient
+			}
+			return true, nil
+		})
+	}
+
+	var cacheWriter = this.openSliceWriter(storage, key, slice)
+
+	var offset int64 = 0
+	var clientErr error
+	for offset < slice.length {
+		var chunk = buf
+		if int64(len(chunk)) > slice.length-offset {
+			chunk = chunk[:slice.length-offset]
+		}
+		n, err := slice.resp.Body.Read(chunk)
+		if n > 0 {
+			if cacheWriter != nil {
+				_, writeErr := cacheWriter.Write(chunk[:n])
+				if writeErr != nil {
+					_ = cacheWriter.Discard()
+					cacheWriter = nil
+				}
+			}
+
+			// 输出和客户端请求区间重叠的部分
+			chunkFrom, chunkTo := httpSliceOverlap(from, to, offset, int64(n))
+			if clientErr == nil && chunkFrom <= chunkTo {
+				_, writeErr := this.writer.Write(chunk[chunkFrom : chunkTo+1])
+				if writeErr != nil {
+					clientErr = errWritingToClient
+				}
+			}
+
+			offset += int64(n)
+		}
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			if cacheWriter != nil {
+				_ = cacheWriter.Discard()
+			}
+			return err
+		}
+
+		// 客户端已经断开，并且不需要继续写入缓存
+		if clientErr != nil && cacheWriter == nil {
+			return clientErr
+		}
+	}
+
+	if cacheWriter != nil {
+		if offset == slice.length {
+			err := cacheWriter.Close()
+			if err != nil {
+				remotelogs.WarnServer("HTTP_REQUEST_SLICE", this.URL()+": write slice cache failed: "+err.Error())
+			}
+		} else {
+			_ = cacheWriter.Discard()
+		}
+	}
+
+	if clientErr != nil {
+		return clientErr
+	}
+	if offset < slice.length {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// 打开切片缓存写入器
+func (this *HTTPRequest) openSliceWriter(storage caches.StorageInterface, key string, slice *httpSlice) caches.Writer {
+	if this.cacheRef == nil {
+		return nil
+	}
+
+	// 和正常的缓存使用同样的检查，切片代表的是完整内容，所以按照200检查状态码，按照完整内容长度检查尺寸
+	var reason = this.checkCacheableResponse(http.StatusOK, slice.header, slice.total)
+	if len(reason) > 0 {
+		this.varMapping["cache.status"] = "BYPASS"
+		this.logAttrs["cache.status"] = "BYPASS"
+		this.logAttrs["cache.bypass"] = reason
+		return nil
+	}
+
+	var life = this.cacheRef.LifeSeconds()
+	if life <= 0 {
+		life = 60
+	}
+	var expiresAt = fasttime.Now().Unix() + life
+
+	var headerBuf = bytepool.Pool1k.Get()
+	defer bytepool.Pool1k.Put(headerBuf)
+
+	var headerData = headerBuf.Bytes[:0]
+	for k, v := range slice.header {
+		if k == "Content-Length" || this.writer.shouldIgnoreHeader(k) {
+			continue
+		}
+		for _, v1 := range v {
+			headerData = append(headerData, k+":"+v1+"\n"...)
+		}
+	}
+
+	cacheWriter, err := storage.OpenWriter(caches.SliceKey(key, slice.index), expiresAt, http.StatusPartialContent, len(headerData), slice.length, this.cacheRef.MaxSizeBytes(), false)
+	if err != nil {
+		if !caches.CanIgnoreErr(err) {
+			remotelogs.Error("HTTP_REQUEST_SLICE", "write slice cache failed: "+err.Error())
+		}
+		return nil
+	}
+
+	_, err = cacheWriter.WriteHeader(headerData)
+	if err != nil {
+		remotelogs.Error("HTTP_REQUEST_SLICE", "write slice cache failed: "+err.Error())
+		_ = cacheWriter.Discard()
+		return nil
+	}
+	return cacheWriter
+}
+
+// 读取切片缓存中的Header
+func (this *HTTPRequest) readSliceHeader(reader caches.Reader) (http.Header, error) {
+	var header = http.Header{}
+	var headerData = []byte{}
+	var headerBuf = bytepool.Pool1k.Get()
+	defer bytepool.Pool1k.Put(headerBuf)
+
+	err := reader.ReadHeader(headerBuf.Bytes, func(n int) (goNext bool, readErr error) {
+		headerData = append(headerData, headerBuf.Bytes[:n]...)
+		for {
+			var nIndex = bytes.IndexByte(headerData, '\n')
+			if nIndex < 0 {
+				break
+			}
+			var row = headerData[:nIndex]
+			var colonIndex = bytes.IndexByte(row, ':')
+			if colonIndex <= 0 {
+				return false, errors.New("invalid header '" + string(row) + "'")
+			}
+			header.Add(string(row[:colonIndex]), string(row[colonIndex+1:]))
+			headerData = headerData[nIndex+1:]
+		}
+		return true, nil
+	})
+	return header, err
+}
+
+// 中止切片输出，版本不一致时清除所有切片
+func (this *HTTPRequest) abortSliceRead(storage caches.StorageInterface, key string, err error) {
+	if errors.Is(err, errHTTPSliceMismatch) {
+		purgeErr := storage.Purge([]string{caches.SlicePrefix(key)}, "dir")
+		if purgeErr != nil {
+			remotelogs.ErrorServer("HTTP_REQUEST_SLICE", "purge slices failed: "+purgeErr.Error())
+		}
+	}
+	if !this.canIgnore(err) {
+		remotelogs.WarnServer("HTTP_REQUEST_SLICE", this.URL()+": read slice failed: "+err.Error())
+	}
+
+	// 已经输出了部分内容，输出的长度和Content-Length不一致时客户端连接会被关闭
+	this.varMapping["cache.status"] = "MISS"
+	this.cacheRef = nil
+	this.writer.SetOk()
+}
+
+// 检查是否有不支持切片回源的源站
+func httpSliceHasUnsupportedOrigins(reverseProxy *serverconfigs.ReverseProxyConfig) bool {
+	for _, origins := range [][]*serverconfigs.OriginConfig{reverseProxy.PrimaryOrigins, reverseProxy.BackupOrigins} {
+		for _, origin := range origins {
+			if origin != nil && origin.IsOn && origin.OSS != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 根据源站响应生成切片
+func httpSliceFromResponse(index int64, sliceSize int64, resp *http.Response) *httpSlice {
+	var slice = &httpSlice{
+		index:     index,
+		start:     index * sliceSize,
+		header:    resp.Header,
+		validator: httpSliceValidator(resp.Header),
+		resp:      resp,
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, total := httpRequestParseContentRangeHeader(resp.Header.Get("Content-Range"))
+		if start != slice.start || total <= 0 {
+			slice.passThrough = true
+			return slice
+		}
+		slice.total = total
+		slice.length = total - start
+		if slice.length > sliceSize {
+			slice.length = sliceSize
+		}
+	case http.StatusOK:
+		// 源站不支持Range，内容不超过一个切片时仍然可以作为第一个切片缓存
+		if index > 0 || resp.ContentLength <= 0 || resp.ContentLength > sliceSize {
+			slice.passThrough = true
+			return slice
+		}
+		slice.total = resp.ContentLength
+		slice.length = resp.ContentLength
+		resp.Header.Set("Content-Range", "bytes 0-"+types.String(resp.ContentLength-1)+"/"+types.String(resp.ContentLength))
+	default:
+		slice.passThrough = true
+	}
+
+	return slice
+}
+
+// 计算 [start, end] 区间和某段内容 [offset, offset+length) 重叠的部分
+// 返回的区间相对于这段内容的开始位置，from > to 表示没有重叠
+func httpSliceOverlap(start int64, end int64, offset int64, length int64) (from int64, to int64) {
+	from = start - offset
+	if from < 0 {
+		from = 0
+	}
+	to = end - offset
+	if to > length-1 {
+		to = length - 1
+	}
+	return
+}
+
+// 获取用来检查切片一致性的值
+func httpSliceValidator(header http.Header) string {
+	var eTag = header.Get("ETag")
+	if len(eTag) > 0 {
+		return eTag
+	}
+	return header.Get("Last-Modified")
+}
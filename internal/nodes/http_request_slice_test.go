@@ -0,0 +1,143 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"bytes"
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"github.com/iwind/TeaGo/assert"
+	"net/http"
+	"testing"
+)
+
+func TestHTTPRequest_httpSliceOverlap(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		from, to := httpSliceOverlap(0, 99, 0, 100)
+		a.IsTrue(from == 0 && to == 99)
+	}
+	{
+		from, to := httpSliceOverlap(150, 1000, 100, 100)
+		a.IsTrue(from == 50 && to == 99)
+	}
+	{
+		from, to := httpSliceOverlap(0, 150, 100, 100)
+		a.IsTrue(from == 0 && to == 50)
+	}
+	{
+		// 没有重叠
+		from, to := httpSliceOverlap(0, 99, 100, 100)
+		a.IsTrue(from > to)
+	}
+	{
+		from, to := httpSliceOverlap(300, 400, 100, 100)
+		a.IsTrue(from > to)
+	}
+}
+
+func TestHTTPRequest_httpSliceFromResponse(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		var resp = &http.Response{
+			StatusCode: http.StatusPartialContent,
+			Header:     http.Header{"Content-Range": []string{"bytes 200-299/1000"}, "Etag": []string{"\"abc\""}},
+		}
+		var slice = httpSliceFromResponse(2, 100, resp)
+		a.IsFalse(slice.passThrough)
+		a.IsTrue(slice.start == 200)
+		a.IsTrue(slice.length == 100)
+		a.IsTrue(slice.total == 1000)
+		a.IsTrue(slice.validator == "\"abc\"")
+	}
+	{
+		// 最后一个切片
+		var resp = &http.Response{
+			StatusCode: http.StatusPartialContent,
+			Header:     http.Header{"Content-Range": []string{"bytes 900-949/950"}},
+		}
+		var slice = httpSliceFromResponse(9, 100, resp)
+		a.IsFalse(slice.passThrough)
+		a.IsTrue(slice.length == 50)
+	}
+	{
+		// 源站返回的区间和切片不一致
+		var resp = &http.Response{
+			StatusCode: http.StatusPartialContent,
+			Header:     http.Header{"Content-Range": []string{"bytes 0-999/1000"}},
+		}
+		a.IsTrue(httpSliceFromResponse(2, 100, resp).passThrough)
+	}
+	{
+		// 源站不支持Range，但内容不超过一个切片
+		var resp = &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{},
+			ContentLength: 80,
+		}
+		var slice = httpSliceFromResponse(0, 100, resp)
+		a.IsFalse(slice.passThrough)
+		a.IsTrue(slice.total == 80)
+		a.IsTrue(resp.Header.Get("Content-Range") == "bytes 0-79/80")
+	}
+	{
+		var resp = &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{},
+			ContentLength: 1000,
+		}
+		a.IsTrue(httpSliceFromResponse(0, 100, resp).passThrough)
+	}
+	{
+		var resp = &http.Response{
+			StatusCode: http.StatusNotFound,
+			Header:     http.Header{},
+		}
+		a.IsTrue(httpSliceFromResponse(0, 100, resp).passThrough)
+	}
+}
+
+func TestHTTPRequest_SliceAssemble(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var content = make([]byte, 1000)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	const sliceSize = 256
+	const chunkSize = 100
+
+	// 按照切片和读取块组合出 [start, end] 区间的内容
+	var assemble = func(start int64, end int64) []byte {
+		var result = []byte{}
+		var total = int64(len(content))
+		fromIndex, toIndex := caches.SliceIndexRange(start, end, sliceSize)
+		for index := fromIndex; index <= toIndex; index++ {
+			var sliceStart = index * sliceSize
+			var sliceLength = int64(sliceSize)
+			if sliceStart+sliceLength > total {
+				sliceLength = total - sliceStart
+			}
+			var sliceData = content[sliceStart : sliceStart+sliceLength]
+
+			sliceFrom, sliceTo := httpSliceOverlap(start, end, sliceStart, sliceLength)
+			for offset := int64(0); offset < sliceLength; offset += chunkSize {
+				var n = int64(chunkSize)
+				if offset+n > sliceLength {
+					n = sliceLength - offset
+				}
+				chunkFrom, chunkTo := httpSliceOverlap(sliceFrom, sliceTo, offset, n)
+				if chunkFrom <= chunkTo {
+					result = append(result, sliceData[offset+chunkFrom:offset+chunkTo+1]...)
+				}
+			}
+		}
+		return result
+	}
+
+	for _, r := range [][2]int64{{0, 999}, {0, 0}, {255, 256}, {300, 800}, {512, 767}, {999, 999}, {100, 199}} {
+		a.IsTrue(bytes.Equal(assemble(r[0], r[1]), content[r[0]:r[1]+1]))
+	}
+}
@@ -9,9 +9,11 @@ import (
 	"github.com/TeaOSLab/EdgeNode/internal/stats"
 	"github.com/TeaOSLab/EdgeNode/internal/waf"
 	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/lists"
 	"github.com/iwind/TeaGo/types"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -466,7 +468,8 @@ func (this *HTTPRequest) WAFSetCacheBody(body []byte) {
 
 // WAFReadBody 读取Body
 func (this *HTTPRequest) WAFReadBody(max int64) (data []byte, err error) {
-	if this.RawReq.ContentLength > 0 {
+	// gRPC请求为流式调用，读取Body会阻塞请求
+	if this.RawReq.ContentLength > 0 && !this.isGRPCRequest() {
 		data, err = io.ReadAll(io.LimitReader(this.RawReq.Body, max))
 	}
 
@@ -505,10 +508,42 @@ func (this *HTTPRequest) WAFOnAction(action interface{}) (goNext bool) {
 	switch instance.Code() {
 	case waf.ActionTag:
 		this.tags = append(this.tags, action.(*waf.TagAction).Tags...)
+	case waf.ActionMask:
+		this.wafMaskActions = append(this.wafMaskActions, action.(*waf.MaskAction))
 	}
 	return true
 }
 
+// 对响应内容进行脱敏
+func (this *HTTPRequest) doWAFMaskResponse(resp *http.Response) {
+	if len(this.wafMaskActions) == 0 || resp.Body == nil || resp.ContentLength == 0 {
+		return
+	}
+
+	// 只处理文本内容
+	var contentType = resp.Header.Get("Content-Type")
+	var semiIndex = strings.Index(contentType, ";")
+	if semiIndex >= 0 {
+		contentType = contentType[:semiIndex]
+	}
+	if _, ok := textMimeMap[strings.TrimSpace(strings.ToLower(contentType))]; !ok {
+		return
+	}
+
+	for _, action := range this.wafMaskActions {
+		action.WrapResponse(resp, func(stat map[string]int) {
+			// 记录脱敏事件
+			this.forceLog = true
+			if !lists.ContainsString(this.tags, "wafMask") {
+				this.tags = append(this.tags, "wafMask")
+			}
+			for maskType, count := range stat {
+				this.logAttrs["waf.mask."+maskType] = types.String(types.Int(this.logAttrs["waf.mask."+maskType]) + count)
+			}
+		})
+	}
+}
+
 func (this *HTTPRequest) WAFFingerprint() []byte {
 	// 目前只有HTTPS请求才有指纹
 	if !this.IsHTTPS {
@@ -80,14 +80,14 @@ func (this *HTTPRequest) doWebsocket(requestHost string, isLastRetry bool) (shou
 	}
 
 	// 连接源站
-	originConn, _, err := OriginConnect(this.origin, this.requestServerPort(), this.RawReq.RemoteAddr, requestHost)
+	originConn, _, err := OriginConnect(this.origin, this.ReqServer.Id, this.requestServerPort(), this.RawReq.RemoteAddr, requestHost)
 	if err != nil {
 		if isLastRetry {
 			this.write50x(err, http.StatusBadGateway, "Failed to connect origin site", "源站连接失败", false)
 		}
 
 		// 增加失败次数
-		SharedOriginStateManager.Fail(this.origin, requestHost, this.reverseProxy, func() {
+		SharedOriginStateManager.Fail(this.origin, this.ReqServer.Id, requestHost, this.reverseProxy, func() {
 			this.reverseProxy.ResetScheduling()
 		})
 
@@ -105,6 +105,8 @@ func (this *HTTPRequest) doWebsocket(requestHost string, isLastRetry bool) (shou
 		_ = originConn.Close()
 	}()
 
+	this.setOriginLocalAddr(originConn.LocalAddr())
+
 	err = this.RawReq.Write(originConn)
 	if err != nil {
 		this.write50x(err, http.StatusBadGateway, "Failed to write request to origin site", "源站请求初始化失败", false)
@@ -208,55 +208,11 @@ func (this *HTTPWriter) PrepareCache(resp *http.Response, size int64) {
 			contentSize = totalSize
 		}
 	}
-	if contentSize >= 0 && ((cacheRef.MaxSizeBytes() > 0 && contentSize > cacheRef.MaxSizeBytes()) ||
-		(cachePolicy.MaxSizeBytes() > 0 && contentSize > cachePolicy.MaxSizeBytes()) || (cacheRef.MinSizeBytes() > contentSize)) {
+	var reason = this.req.checkCacheableResponse(this.StatusCode(), this.Header(), contentSize)
+	if len(reason) > 0 {
 		this.req.varMapping["cache.status"] = "BYPASS"
 		if addStatusHeader {
-			this.Header().Set("X-Cache", "BYPASS, Content-Length")
-		}
-		return
-	}
-
-	// 检查状态
-	if !cacheRef.MatchStatus(this.StatusCode()) {
-		this.req.varMapping["cache.status"] = "BYPASS"
-		if addStatusHeader {
-			this.Header().Set("X-Cache", "BYPASS, Status: "+types.String(this.StatusCode()))
-		}
-		return
-	}
-
-	// Cache-Control
-	if len(cacheRef.SkipResponseCacheControlValues) > 0 {
-		var cacheControl = this.GetHeader("Cache-Control")
-		if len(cacheControl) > 0 {
-			values := strings.Split(cacheControl, ",")
-			for _, value := range values {
-				if cacheRef.ContainsCacheControl(strings.TrimSpace(value)) {
-					this.req.varMapping["cache.status"] = "BYPASS"
-					if addStatusHeader {
-						this.Header().Set("X-Cache", "BYPASS, Cache-Control: "+cacheControl)
-					}
-					return
-				}
-			}
-		}
-	}
-
-	// Set-Cookie
-	if cacheRef.SkipResponseSetCookie && len(this.GetHeader("Set-Cookie")) > 0 {
-		this.req.varMapping["cache.status"] = "BYPASS"
-		if addStatusHeader {
-			this.Header().Set("X-Cache", "BYPASS, Set-Cookie")
-		}
-		return
-	}
-
-	// 校验其他条件
-	if cacheRef.Conds != nil && cacheRef.Conds.HasResponseConds() && !cacheRef.Conds.MatchResponse(this.req.Format) {
-		this.req.varMapping["cache.status"] = "BYPASS"
-		if addStatusHeader {
-			this.Header().Set("X-Cache", "BYPASS, ResponseConds")
+			this.Header().Set("X-Cache", "BYPASS, "+reason)
 		}
 		return
 	}
@@ -337,6 +293,14 @@ func (this *HTTPWriter) PrepareCache(resp *http.Response, size int64) {
 		_ = this.cacheWriter.Discard()
 	}
 
+	// 预热缓存时跳过准入检查
+	if this.req.RawReq.Header.Get("X-Edge-Cache-Action") == "fetch" && (strings.HasPrefix(this.req.RawReq.RemoteAddr, "127.") || strings.HasPrefix(this.req.RawReq.RemoteAddr, "[::1]")) {
+		fileStorage, ok := storage.(*caches.FileStorage)
+		if ok {
+			fileStorage.ForceAdmission(cacheKey)
+		}
+	}
+
 	cacheWriter, err := storage.OpenWriter(cacheKey, expiresAt, this.StatusCode(), this.calculateHeaderLength(), totalSize, cacheRef.MaxSizeBytes(), this.isPartial)
 	if err != nil {
 		if errors.Is(err, caches.ErrEntityTooLarge) && addStatusHeader {
@@ -594,6 +558,11 @@ func (this *HTTPWriter) PrepareCompression(resp *http.Response, size int64) {
 		return
 	}
 
+	// gRPC自行处理压缩
+	if this.req.isGRPCRequest() {
+		return
+	}
+
 	if this.StatusCode() == http.StatusNoContent {
 		return
 	}
@@ -803,6 +772,18 @@ func (this *HTTPWriter) AddHeaders(header http.Header) {
 	}
 }
 
+// WriteTrailers 写入Trailer
+// 需要在写完响应内容之后调用，主要用于转发gRPC的grpc-status和grpc-message
+func (this *HTTPWriter) WriteTrailers(trailer http.Header) {
+	if this.rawWriter == nil || len(trailer) == 0 {
+		return
+	}
+	var header = this.rawWriter.Header()
+	for key, values := range trailer {
+		header[http.TrailerPrefix+key] = values
+	}
+}
+
 // Write 写入数据
 func (this *HTTPWriter) Write(data []byte) (n int, err error) {
 	if this.webpIsEncoding {
@@ -10,6 +10,7 @@ import (
 	"golang.org/x/net/ipv4"
 	"golang.org/x/net/ipv6"
 	"net"
+	"os"
 	"strings"
 	"sync"
 )
@@ -18,6 +19,9 @@ type Listener struct {
 	group    *serverconfigs.ServerAddressGroup
 	listener ListenerInterface // 监听器
 
+	rawTCPListener *net.TCPListener        // 原始TCP监听器，用于平滑升级时传递给新进程
+	rawUDPConns    map[string]*net.UDPConn // network => conn，用于平滑升级时传递给新进程
+
 	locker sync.RWMutex
 }
 
@@ -62,10 +66,22 @@ func (this *Listener) listenTCP() error {
 	if err != nil {
 		return err
 	}
+
+	// 接收负载均衡发送的PROXY Protocol，只有配置了此地址时才需要解析
+	if SharedProxyProtocolManager.FindListener(this.group.FullAddr(), this.group.Addr()) != nil {
+		tcpListener = NewProxyProtocolListener(tcpListener, this.group.FullAddr(), this.group.Addr(), SharedProxyProtocolManager)
+	}
+
 	var netListener = NewClientListener(tcpListener, protocol.IsHTTPFamily() || protocol.IsHTTPSFamily())
 	events.OnKey(events.EventQuit, this, func() {
 		remotelogs.Println("LISTENER", "quit "+this.group.FullAddr())
 		_ = netListener.Close()
+
+		// 关闭空闲的keep-alive连接，以便尽快处理完已有连接
+		httpListener, ok := this.listener.(*HTTPListener)
+		if ok {
+			httpListener.DisableKeepAlives()
+		}
 	})
 
 	switch protocol {
@@ -196,35 +212,127 @@ func (this *Listener) Close() error {
 
 // 创建TCP监听器
 func (this *Listener) createTCPListener() (net.Listener, error) {
+	// 从升级前的进程中继承
+	var inheritedFile = sharedUpgradeHandoff.TakeFile(this.upgradeFileKey("tcp"))
+	if inheritedFile != nil {
+		listener, err := net.FileListener(inheritedFile)
+		_ = inheritedFile.Close()
+		if err == nil {
+			tcpListener, ok := listener.(*net.TCPListener)
+			if ok {
+				this.rawTCPListener = tcpListener
+				return tcpListener, nil
+			}
+			_ = listener.Close()
+		} else {
+			remotelogs.Error("LISTENER", "inherit listener '"+this.group.FullAddr()+"' failed: "+err.Error())
+		}
+	}
+
 	var listenConfig = net.ListenConfig{
 		Control:   nil,
 		KeepAlive: 0,
 	}
 
+	var network = "tcp"
 	switch this.group.Protocol() {
 	case serverconfigs.ProtocolHTTP4, serverconfigs.ProtocolHTTPS4, serverconfigs.ProtocolTLS4:
-		return listenConfig.Listen(context.Background(), "tcp4", this.group.Addr())
+		network = "tcp4"
 	case serverconfigs.ProtocolHTTP6, serverconfigs.ProtocolHTTPS6, serverconfigs.ProtocolTLS6:
-		return listenConfig.Listen(context.Background(), "tcp6", this.group.Addr())
+		network = "tcp6"
 	}
 
-	return listenConfig.Listen(context.Background(), "tcp", this.group.Addr())
+	listener, err := listenConfig.Listen(context.Background(), network, this.group.Addr())
+	if err != nil {
+		return nil, err
+	}
+	tcpListener, ok := listener.(*net.TCPListener)
+	if ok {
+		this.rawTCPListener = tcpListener
+	}
+	return listener, nil
 }
 
 // 创建UDP IPv4监听器
 func (this *Listener) createUDPIPv4Listener() (*net.UDPConn, error) {
-	addr, err := net.ResolveUDPAddr("udp", this.group.Addr())
-	if err != nil {
-		return nil, err
-	}
-	return net.ListenUDP("udp4", addr)
+	return this.createUDPListener("udp4")
 }
 
 // 创建UDP监听器
 func (this *Listener) createUDPIPv6Listener() (*net.UDPConn, error) {
-	addr, err := net.ResolveUDPAddr("udp", this.group.Addr())
-	if err != nil {
-		return nil, err
+	return this.createUDPListener("udp6")
+}
+
+func (this *Listener) createUDPListener(network string) (*net.UDPConn, error) {
+	var conn *net.UDPConn
+
+	// 从升级前的进程中继承
+	var inheritedFile = sharedUpgradeHandoff.TakeFile(this.upgradeFileKey(network))
+	if inheritedFile != nil {
+		packetConn, err := net.FilePacketConn(inheritedFile)
+		_ = inheritedFile.Close()
+		if err == nil {
+			udpConn, ok := packetConn.(*net.UDPConn)
+			if ok {
+				conn = udpConn
+			} else {
+				_ = packetConn.Close()
+			}
+		} else {
+			remotelogs.Error("LISTENER", "inherit listener '"+this.group.FullAddr()+"' failed: "+err.Error())
+		}
+	}
+
+	if conn == nil {
+		addr, err := net.ResolveUDPAddr("udp", this.group.Addr())
+		if err != nil {
+			return nil, err
+		}
+		conn, err = net.ListenUDP(network, addr)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return net.ListenUDP("udp6", addr)
+
+	this.locker.Lock()
+	if this.rawUDPConns == nil {
+		this.rawUDPConns = map[string]*net.UDPConn{}
+	}
+	this.rawUDPConns[network] = conn
+	this.locker.Unlock()
+
+	return conn, nil
+}
+
+// UpgradeFiles 获取需要在平滑升级时传递给新进程的文件
+// 返回的文件为复制的文件描述符，使用完后需要关闭
+func (this *Listener) UpgradeFiles() map[string]*os.File {
+	var result = map[string]*os.File{}
+
+	if this.rawTCPListener != nil {
+		file, err := this.rawTCPListener.File()
+		if err != nil {
+			remotelogs.Error("LISTENER", "get listener file '"+this.group.FullAddr()+"' failed: "+err.Error())
+		} else {
+			result[this.upgradeFileKey("tcp")] = file
+		}
+	}
+
+	this.locker.RLock()
+	for network, conn := range this.rawUDPConns {
+		file, err := conn.File()
+		if err != nil {
+			remotelogs.Error("LISTENER", "get listener file '"+this.group.FullAddr()+"' failed: "+err.Error())
+		} else {
+			result[this.upgradeFileKey(network)] = file
+		}
+	}
+	this.locker.RUnlock()
+
+	return result
+}
+
+// 平滑升级时传递文件使用的键值
+func (this *Listener) upgradeFileKey(network string) string {
+	return this.group.FullAddr() + "@" + network
 }
@@ -102,6 +102,13 @@ func (this *HTTPListener) Close() error {
 	return this.Listener.Close()
 }
 
+// DisableKeepAlives 禁用keep-alive，并关闭当前空闲的连接
+func (this *HTTPListener) DisableKeepAlives() {
+	if this.httpServer != nil {
+		this.httpServer.SetKeepAlivesEnabled(false)
+	}
+}
+
 func (this *HTTPListener) Reload(group *serverconfigs.ServerAddressGroup) {
 	this.Group = group
 
@@ -15,6 +15,7 @@ import (
 	"github.com/iwind/TeaGo/maps"
 	"github.com/iwind/TeaGo/types"
 	"net/url"
+	"os"
 	"regexp"
 	"runtime"
 	"sort"
@@ -163,6 +164,28 @@ func (this *ListenerManager) Start(nodeConfig *nodeconfigs.NodeConfig) error {
 	return nil
 }
 
+// UpgradeFiles 获取所有监听器需要在平滑升级时传递给新进程的文件
+func (this *ListenerManager) UpgradeFiles() map[string]*os.File {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	var result = map[string]*os.File{}
+	for _, listener := range this.listenersMap {
+		for key, file := range listener.UpgradeFiles() {
+			result[key] = file
+		}
+	}
+	return result
+}
+
+// IsReady 检查是否已经成功启动所有监听端口
+func (this *ListenerManager) IsReady() bool {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	return this.lastConfig != nil && len(this.retryListenerMap) == 0
+}
+
 // TotalActiveConnections 获取总的活跃连接数
 func (this *ListenerManager) TotalActiveConnections() int {
 	this.locker.Lock()
@@ -0,0 +1,251 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/pires/go-proxyproto"
+	"github.com/pires/go-proxyproto/tlvparse"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ProxyProtocolListener 接收PROXY Protocol v1/v2的监听器
+// PROXY Header在单独的goroutine中读取，避免慢连接阻塞Accept()
+type ProxyProtocolListener struct {
+	rawListener net.Listener
+	fullAddr    string
+	addr        string
+	manager     *ProxyProtocolManager
+
+	connChan  chan net.Conn
+	errChan   chan error
+	closeChan chan struct{}
+	closeOnce sync.Once
+}
+
+func NewProxyProtocolListener(rawListener net.Listener, fullAddr string, addr string, manager *ProxyProtocolManager) *ProxyProtocolListener {
+	var listener = &ProxyProtocolListener{
+		rawListener: rawListener,
+		fullAddr:    fullAddr,
+		addr:        addr,
+		manager:     manager,
+		connChan:    make(chan net.Conn),
+		errChan:     make(chan error),
+		closeChan:   make(chan struct{}),
+	}
+	go listener.loop()
+	return listener
+}
+
+func (this *ProxyProtocolListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-this.connChan:
+		return conn, nil
+	case err := <-this.errChan:
+		return nil, err
+	case <-this.closeChan:
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Addr: this.rawListener.Addr(), Err: net.ErrClosed}
+	}
+}
+
+func (this *ProxyProtocolListener) Close() error {
+	var err error
+	this.closeOnce.Do(func() {
+		close(this.closeChan)
+		err = this.rawListener.Close()
+	})
+	return err
+}
+
+func (this *ProxyProtocolListener) Addr() net.Addr {
+	return this.rawListener.Addr()
+}
+
+func (this *ProxyProtocolListener) loop() {
+	for {
+		conn, err := this.rawListener.Accept()
+		if err != nil {
+			select {
+			case this.errChan <- err:
+			case <-this.closeChan:
+				return
+			}
+
+			// 临时错误可以继续接收新连接
+			netErr, ok := err.(net.Error)
+			if ok && netErr.Timeout() {
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
+			return
+		}
+
+		// 只解析受信任来源发送的PROXY Header，防止客户端伪造IP
+		var config = this.manager.FindListener(this.fullAddr, this.addr)
+		if config == nil || !config.IsTrusted(this.connIP(conn)) {
+			this.push(conn)
+			continue
+		}
+
+		go this.handshake(conn, config)
+	}
+}
+
+// 读取PROXY Header
+func (this *ProxyProtocolListener) handshake(conn net.Conn, config *configs.ProxyProtocolListenerConfig) {
+	var reader = bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(config.ReadHeaderTimeoutDuration()))
+	header, err := proxyproto.Read(reader)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		// 非严格模式下允许不发送PROXY Header
+		if !config.IsStrict() && (errors.Is(err, proxyproto.ErrNoProxyProtocol) || os.IsTimeout(err)) {
+			this.push(NewProxyProtocolConn(conn, reader, nil))
+			return
+		}
+
+		_ = conn.Close()
+		return
+	}
+
+	this.push(NewProxyProtocolConn(conn, reader, header))
+}
+
+func (this *ProxyProtocolListener) push(conn net.Conn) {
+	select {
+	case this.connChan <- conn:
+	case <-this.closeChan:
+		_ = conn.Close()
+	}
+}
+
+func (this *ProxyProtocolListener) connIP(conn net.Conn) net.IP {
+	tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if ok {
+		return tcpAddr.IP
+	}
+	return nil
+}
+
+// ProxyProtocolConn 通过PROXY Protocol接收的连接
+type ProxyProtocolConn struct {
+	net.Conn
+
+	reader *bufio.Reader
+	header *proxyproto.Header
+
+	attrs map[string]string // 从TLV中解析的属性
+}
+
+func NewProxyProtocolConn(rawConn net.Conn, reader *bufio.Reader, header *proxyproto.Header) *ProxyProtocolConn {
+	var conn = &ProxyProtocolConn{
+		Conn:   rawConn,
+		reader: reader,
+	}
+
+	// LOCAL命令通常为负载均衡的健康检查，此时使用连接本身的地址
+	if header != nil && header.Command.IsProxy() && header.SourceAddr != nil && header.DestinationAddr != nil {
+		conn.header = header
+		conn.attrs = parseProxyProtocolTLVs(header)
+	}
+
+	return conn
+}
+
+func (this *ProxyProtocolConn) Read(b []byte) (n int, err error) {
+	// 先读取缓冲区中剩余的数据
+	if this.reader != nil {
+		if this.reader.Buffered() > 0 {
+			return this.reader.Read(b)
+		}
+		this.reader = nil
+	}
+	return this.Conn.Read(b)
+}
+
+// RemoteAddr 客户端地址
+func (this *ProxyProtocolConn) RemoteAddr() net.Addr {
+	if this.header != nil {
+		return this.header.SourceAddr
+	}
+	return this.Conn.RemoteAddr()
+}
+
+// LocalAddr 客户端连接的目标地址
+func (this *ProxyProtocolConn) LocalAddr() net.Addr {
+	if this.header != nil {
+		return this.header.DestinationAddr
+	}
+	return this.Conn.LocalAddr()
+}
+
+// PeerAddr 发送PROXY Header的负载均衡地址
+func (this *ProxyProtocolConn) PeerAddr() net.Addr {
+	return this.Conn.RemoteAddr()
+}
+
+// IsProxied 是否已从PROXY Header中读取到客户端地址
+func (this *ProxyProtocolConn) IsProxied() bool {
+	return this.header != nil
+}
+
+// Header 读取PROXY Header
+func (this *ProxyProtocolConn) Header() *proxyproto.Header {
+	return this.header
+}
+
+// Attr 读取从TLV中解析的属性
+func (this *ProxyProtocolConn) Attr(name string) string {
+	return this.attrs[name]
+}
+
+// TCPConn 转换为TCPConn
+func (this *ProxyProtocolConn) TCPConn() (tcpConn *net.TCPConn, ok bool) {
+	tcpConn, ok = this.Conn.(*net.TCPConn)
+	return
+}
+
+// 解析PROXY Protocol v2中的TLV
+func parseProxyProtocolTLVs(header *proxyproto.Header) map[string]string {
+	tlvs, err := header.TLVs()
+	if err != nil || len(tlvs) == 0 {
+		return nil
+	}
+
+	var attrs = map[string]string{}
+	for _, tlv := range tlvs {
+		switch tlv.Type {
+		case proxyproto.PP2_TYPE_ALPN:
+			attrs["alpn"] = string(tlv.Value)
+		case proxyproto.PP2_TYPE_AUTHORITY:
+			attrs["authority"] = string(tlv.Value)
+		case proxyproto.PP2_TYPE_UNIQUE_ID:
+			attrs["uniqueId"] = hex.EncodeToString(tlv.Value)
+		}
+	}
+
+	ssl, ok := tlvparse.FindSSL(tlvs)
+	if ok && ssl.ClientSSL() {
+		version, hasVersion := ssl.SSLVersion()
+		if hasVersion {
+			attrs["sslVersion"] = version
+		}
+		cn, hasCN := ssl.ClientCN()
+		if hasCN {
+			attrs["sslCN"] = cn
+		}
+	}
+
+	var vpceId = tlvparse.FindAWSVPCEndpointID(tlvs)
+	if len(vpceId) > 0 {
+		attrs["awsVPCEndpointId"] = vpceId
+	}
+
+	return attrs
+}
@@ -0,0 +1,207 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"github.com/pires/go-proxyproto"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestProxyProtocolListener(t *testing.T, mode configs.ProxyProtocolMode, trustedCIDRs []string) *ProxyProtocolListener {
+	var listenerConfig = &configs.ProxyProtocolListenerConfig{
+		IsOn:              true,
+		Addrs:             []string{":0"},
+		Mode:              mode,
+		TrustedCIDRs:      trustedCIDRs,
+		ReadHeaderTimeout: 1,
+	}
+	err := listenerConfig.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var manager = NewProxyProtocolManager()
+	manager.configFile.Update(&configs.ProxyProtocolConfig{
+		Listeners: []*configs.ProxyProtocolListenerConfig{listenerConfig},
+	})
+
+	rawListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var listener = NewProxyProtocolListener(rawListener, "tcp://:0", ":0", manager)
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	return listener
+}
+
+func dialTestProxyProtocolListener(t *testing.T, listener net.Listener, header *proxyproto.Header, body string) {
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	if header != nil {
+		_, err = header.WriteTo(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = conn.Write([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestProxyProtocolConn(t *testing.T, conn net.Conn, size int) string {
+	var buf = make([]byte, size)
+	_, err := io.ReadFull(conn, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+func TestProxyProtocolListener_V2(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var listener = newTestProxyProtocolListener(t, configs.ProxyProtocolModeStrict, []string{"127.0.0.1"})
+
+	var header = &proxyproto.Header{
+		Version:           2,
+		Command:           proxyproto.PROXY,
+		TransportProtocol: proxyproto.TCPv4,
+		SourceAddr:        &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 12345},
+		DestinationAddr:   &net.TCPAddr{IP: net.ParseIP("5.6.7.8"), Port: 443},
+	}
+	err := header.SetTLVs([]proxyproto.TLV{
+		{Type: proxyproto.PP2_TYPE_AUTHORITY, Value: []byte("example.com")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialTestProxyProtocolListener(t, listener, header, "GET / HTTP/1.1\r\n")
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	proxyProtocolConn, ok := conn.(*ProxyProtocolConn)
+	a.IsTrue(ok)
+	a.IsTrue(proxyProtocolConn.IsProxied())
+	a.IsTrue(conn.RemoteAddr().String() == "1.2.3.4:12345")
+	a.IsTrue(conn.LocalAddr().String() == "5.6.7.8:443")
+	a.IsTrue(proxyProtocolConn.PeerAddr().(*net.TCPAddr).IP.String() == "127.0.0.1")
+	a.IsTrue(proxyProtocolConn.Attr("authority") == "example.com")
+	a.IsTrue(readTestProxyProtocolConn(t, conn, 16) == "GET / HTTP/1.1\r\n")
+}
+
+func TestProxyProtocolListener_V1(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var listener = newTestProxyProtocolListener(t, configs.ProxyProtocolModeStrict, []string{"127.0.0.0/8"})
+	dialTestProxyProtocolListener(t, listener, &proxyproto.Header{
+		Version:           1,
+		Command:           proxyproto.PROXY,
+		TransportProtocol: proxyproto.TCPv6,
+		SourceAddr:        &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1000},
+		DestinationAddr:   &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 80},
+	}, "hello")
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	a.IsTrue(conn.RemoteAddr().String() == "[2001:db8::1]:1000")
+	a.IsTrue(readTestProxyProtocolConn(t, conn, 5) == "hello")
+}
+
+func TestProxyProtocolListener_Strict(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var listener = newTestProxyProtocolListener(t, configs.ProxyProtocolModeStrict, []string{"127.0.0.1"})
+
+	// 没有PROXY Header的连接会被关闭
+	dialTestProxyProtocolListener(t, listener, nil, "GET / HTTP/1.1\r\n")
+
+	var header = proxyproto.HeaderProxyFromAddrs(1, &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 1}, &net.TCPAddr{IP: net.ParseIP("5.6.7.8"), Port: 2})
+	dialTestProxyProtocolListener(t, listener, header, "ok")
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	a.IsTrue(conn.RemoteAddr().String() == "1.2.3.4:1")
+}
+
+func TestProxyProtocolListener_Optional(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var listener = newTestProxyProtocolListener(t, configs.ProxyProtocolModeOptional, []string{"127.0.0.1"})
+	dialTestProxyProtocolListener(t, listener, nil, "GET / HTTP/1.1\r\n")
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	a.IsFalse(conn.(*ProxyProtocolConn).IsProxied())
+	a.IsTrue(conn.RemoteAddr().(*net.TCPAddr).IP.String() == "127.0.0.1")
+	a.IsTrue(readTestProxyProtocolConn(t, conn, 16) == "GET / HTTP/1.1\r\n")
+}
+
+func TestProxyProtocolListener_Untrusted(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	// 不受信任的来源不会解析PROXY Header
+	var listener = newTestProxyProtocolListener(t, configs.ProxyProtocolModeStrict, []string{"10.0.0.0/8"})
+	var header = proxyproto.HeaderProxyFromAddrs(1, &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 1}, &net.TCPAddr{IP: net.ParseIP("5.6.7.8"), Port: 2})
+	dialTestProxyProtocolListener(t, listener, header, "")
+
+	var before = time.Now()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	_, isProxyProtocolConn := conn.(*ProxyProtocolConn)
+	a.IsFalse(isProxyProtocolConn)
+	a.IsTrue(conn.RemoteAddr().(*net.TCPAddr).IP.String() == "127.0.0.1")
+	a.IsTrue(time.Since(before) < 1*time.Second)
+}
+
+func TestProxyProtocolListener_Close(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var listener = newTestProxyProtocolListener(t, configs.ProxyProtocolModeStrict, []string{"127.0.0.1"})
+	_ = listener.Close()
+
+	_, err := listener.Accept()
+	a.IsNotNil(err)
+	opErr, ok := err.(*net.OpError)
+	a.IsTrue(ok && opErr.Op == "accept")
+}
@@ -5,15 +5,14 @@ import (
 	"errors"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/shared"
-	"github.com/TeaOSLab/EdgeNode/internal/goman"
 	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
 	"github.com/TeaOSLab/EdgeNode/internal/stats"
-	"github.com/TeaOSLab/EdgeNode/internal/utils/bytepool"
 	"github.com/iwind/TeaGo/types"
 	"github.com/pires/go-proxyproto"
 	"net"
 	"strings"
 	"sync/atomic"
+	"time"
 )
 
 type TCPListener struct {
@@ -26,8 +25,10 @@ type TCPListener struct {
 
 func (this *TCPListener) Serve() error {
 	var listener = this.Listener
-	if this.Group.IsTLS() {
-		listener = tls.NewListener(listener, this.buildTLSConfig())
+	var isTLS = this.Group.IsTLS()
+	var tlsConfig *tls.Config
+	if isTLS {
+		tlsConfig = this.buildTLSConfig()
 	}
 
 	// 获取分组端口
@@ -47,11 +48,24 @@ func (this *TCPListener) Serve() error {
 		atomic.AddInt64(&this.countActiveConnections, 1)
 
 		go func(conn net.Conn) {
-			var server = this.Group.FirstServer()
+			var server *serverconfigs.ServerConfig
+			var hello *TLSClientHello
+			if isTLS {
+				// 需要先读取ClientHello才能判断是否透传
+				tlsConn, tlsServer, tlsHello, acceptErr := this.acceptTLS(conn, tlsConfig)
+				if acceptErr != nil {
+					_ = conn.Close()
+					atomic.AddInt64(&this.countActiveConnections, -1)
+					return
+				}
+				conn, server, hello = tlsConn, tlsServer, tlsHello
+			} else {
+				server = this.Group.FirstServer()
+			}
 			if server == nil {
 				return
 			}
-			err = this.handleConn(server, conn)
+			err = this.handleConn(server, conn, hello)
 			if err != nil {
 				remotelogs.ServerError(server.Id, "TCP_LISTENER", err.Error(), "", nil)
 			}
@@ -67,7 +81,7 @@ func (this *TCPListener) Reload(group *serverconfigs.ServerAddressGroup) {
 	this.Reset()
 }
 
-func (this *TCPListener) handleConn(server *serverconfigs.ServerConfig, conn net.Conn) error {
+func (this *TCPListener) handleConn(server *serverconfigs.ServerConfig, conn net.Conn, hello *TLSClientHello) error {
 	if server == nil {
 		return errors.New("no server available")
 	}
@@ -93,6 +107,13 @@ func (this *TCPListener) handleConn(server *serverconfigs.ServerConfig, conn net
 		tlsConn, ok := conn.(*tls.Conn)
 		if ok {
 			var internalConn = tlsConn.NetConn()
+
+			// 读取过ClientHello的连接
+			replayConn, isReplay := internalConn.(*tlsReplayConn)
+			if isReplay {
+				internalConn = replayConn.NetConn()
+			}
+
 			if internalConn != nil {
 				clientConn, ok = internalConn.(ClientConnInterface)
 				if ok {
@@ -131,13 +152,15 @@ func (this *TCPListener) handleConn(server *serverconfigs.ServerConfig, conn net
 	tlsConn, ok := conn.(*tls.Conn)
 	var recordStat = false
 	var serverName = ""
-	if ok {
+	if hello != nil {
+		serverName = hello.ServerName
+	} else if ok {
 		serverName = tlsConn.ConnectionState().ServerName
-		if len(serverName) > 0 {
-			// 统计
-			stats.SharedTrafficStatManager.Add(server.UserId, server.Id, serverName, 0, 0, 1, 0, 0, 0, 0, server.ShouldCheckTrafficLimit(), server.PlanId())
-			recordStat = true
-		}
+	}
+	if len(serverName) > 0 {
+		// 统计
+		stats.SharedTrafficStatManager.Add(server.UserId, server.Id, serverName, 0, 0, 1, 0, 0, 0, 0, server.ShouldCheckTrafficLimit(), server.PlanId())
+		recordStat = true
 	}
 
 	// 统计
@@ -151,17 +174,18 @@ func (this *TCPListener) handleConn(server *serverconfigs.ServerConfig, conn net
 		stats.SharedDAUManager.AddIP(server.Id, clientIP)
 	}
 
-	originConn, err := this.connectOrigin(server.Id, serverName, server.ReverseProxy, conn.RemoteAddr().String())
+	var proxyConfig = SharedTCPProxyManager.FindServer(server.Id)
+	var connectedAt = time.Now()
+
+	originConn, origin, originAddr, err := this.connectOrigin(server.Id, serverName, server.ReverseProxy, conn.RemoteAddr().String())
 	if err != nil {
 		_ = conn.Close()
+		if proxyConfig != nil && proxyConfig.AccessLog {
+			this.log(server, conn, serverName, hello, origin, originAddr, nil, connectedAt, TCPRelayCloseReasonConnectOriginFailed, err)
+		}
 		return err
 	}
 
-	var closer = func() {
-		_ = conn.Close()
-		_ = originConn.Close()
-	}
-
 	// PROXY Protocol
 	if server.ReverseProxy != nil &&
 		server.ReverseProxy.ProxyProtocol != nil &&
@@ -181,64 +205,39 @@ func (this *TCPListener) handleConn(server *serverconfigs.ServerConfig, conn net
 		}
 		_, err = header.WriteTo(originConn)
 		if err != nil {
-			closer()
+			_ = conn.Close()
+			_ = originConn.Close()
 			return err
 		}
 	}
 
-	// 从源站读取
-	goman.New(func() {
-		var originBuf = bytepool.Pool16k.Get()
-		defer func() {
-			bytepool.Pool16k.Put(originBuf)
-		}()
-		for {
-			n, err := originConn.Read(originBuf.Bytes)
-			if n > 0 {
-				_, err = conn.Write(originBuf.Bytes[:n])
-				if err != nil {
-					closer()
-					break
-				}
-
-				// 记录流量
-				if server != nil {
-					stats.SharedTrafficStatManager.Add(server.UserId, server.Id, "", int64(n), 0, 0, 0, 0, 0, 0, server.ShouldCheckTrafficLimit(), server.PlanId())
-				}
-			}
-			if err != nil {
-				closer()
-				break
-			}
-		}
-	})
-
-	// 从客户端读取
-	var clientBuf = bytepool.Pool16k.Get()
-	defer func() {
-		bytepool.Pool16k.Put(clientBuf)
-	}()
-	for {
-		// 是否已达到流量限制
-		if this.reachedTrafficLimit() {
-			closer()
-			return nil
-		}
-
-		n, err := conn.Read(clientBuf.Bytes)
-		if n > 0 {
-			_, err = originConn.Write(clientBuf.Bytes[:n])
-			if err != nil {
-				break
-			}
-		}
+	// TLS透传时重放已经读取的ClientHello
+	if hello != nil && len(hello.Data) > 0 {
+		_, err = originConn.Write(hello.Data)
 		if err != nil {
-			break
+			_ = conn.Close()
+			_ = originConn.Close()
+			return err
 		}
 	}
 
-	// 关闭连接
-	closer()
+	// 转发数据
+	var relay = NewTCPRelay(conn, originConn)
+	relay.EnableSplice(SharedTCPProxyManager.IsSpliceEnabled())
+	if proxyConfig != nil {
+		relay.SetTimeouts(proxyConfig.IdleTimeoutDuration(), proxyConfig.MaxLifetimeDuration())
+	}
+	relay.OnSent(func(n int64) {
+		// 记录流量
+		stats.SharedTrafficStatManager.Add(server.UserId, server.Id, "", n, 0, 0, 0, 0, 0, 0, server.ShouldCheckTrafficLimit(), server.PlanId())
+	})
+	relay.ShouldStop(this.reachedTrafficLimit)
+	relay.Run()
+
+	// 访问日志
+	if proxyConfig != nil && proxyConfig.AccessLog {
+		this.log(server, conn, serverName, hello, origin, originAddr, relay, connectedAt, relay.CloseReason(), relay.CloseError())
+	}
 
 	return nil
 }
@@ -248,30 +247,30 @@ func (this *TCPListener) Close() error {
 }
 
 // 连接源站
-func (this *TCPListener) connectOrigin(serverId int64, requestHost string, reverseProxy *serverconfigs.ReverseProxyConfig, remoteAddr string) (conn net.Conn, err error) {
+func (this *TCPListener) connectOrigin(serverId int64, requestHost string, reverseProxy *serverconfigs.ReverseProxyConfig, remoteAddr string) (conn net.Conn, origin *serverconfigs.OriginConfig, addr string, err error) {
 	if reverseProxy == nil {
-		return nil, errors.New("no reverse proxy config")
+		return nil, nil, "", errors.New("no reverse proxy config")
 	}
 
 	var requestCall = shared.NewRequestCall()
 	requestCall.Domain = requestHost
 
 	var retries = 3
-	var addr string
 
 	var failedOriginIds []int64
 
 	for i := 0; i < retries; i++ {
-		var origin *serverconfigs.OriginConfig
+		var nextOrigin *serverconfigs.OriginConfig
 		if len(failedOriginIds) > 0 {
-			origin = reverseProxy.AnyOrigin(requestCall, failedOriginIds)
+			nextOrigin = reverseProxy.AnyOrigin(requestCall, failedOriginIds)
 		}
-		if origin == nil {
-			origin = reverseProxy.NextOrigin(requestCall)
+		if nextOrigin == nil {
+			nextOrigin = reverseProxy.NextOrigin(requestCall)
 		}
-		if origin == nil {
+		if nextOrigin == nil {
 			continue
 		}
+		origin = nextOrigin
 
 		// 回源主机名
 		if len(origin.RequestHost) > 0 {
@@ -280,13 +279,13 @@ func (this *TCPListener) connectOrigin(serverId int64, requestHost string, rever
 			requestHost = reverseProxy.RequestHost
 		}
 
-		conn, addr, err = OriginConnect(origin, this.port, remoteAddr, requestHost)
+		conn, addr, err = OriginConnect(origin, serverId, this.port, remoteAddr, requestHost)
 		if err != nil {
 			failedOriginIds = append(failedOriginIds, origin.Id)
 
 			remotelogs.ServerError(serverId, "TCP_LISTENER", "unable to connect origin server: "+addr+": "+err.Error(), "", nil)
 
-			SharedOriginStateManager.Fail(origin, requestHost, reverseProxy, func() {
+			SharedOriginStateManager.Fail(origin, serverId, requestHost, reverseProxy, func() {
 				reverseProxy.ResetScheduling()
 			})
 
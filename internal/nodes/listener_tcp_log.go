@@ -0,0 +1,107 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/iwind/TeaGo/types"
+	"net"
+	"strings"
+	"time"
+)
+
+// 记录单个连接的访问日志，和HTTP访问日志使用同一个队列上传
+func (this *TCPListener) log(server *serverconfigs.ServerConfig, conn net.Conn, serverName string, hello *TLSClientHello, origin *serverconfigs.OriginConfig, originAddr string, relay *TCPRelay, connectedAt time.Time, closeReason TCPRelayCloseReason, closeErr error) {
+	// 检查全局配置
+	if sharedNodeConfig == nil {
+		return
+	}
+	if sharedNodeConfig.GlobalServerConfig != nil && !sharedNodeConfig.GlobalServerConfig.HTTPAccessLog.IsOn {
+		return
+	}
+
+	var remoteAddr = conn.RemoteAddr().String()
+	var remoteIP, remotePort, _ = net.SplitHostPort(remoteAddr)
+
+	var scheme = "tcp"
+	if this.Group.IsTLS() {
+		scheme = "tls"
+	}
+
+	var receivedBytes int64
+	var sentBytes int64
+	var isSpliced bool
+	var duration = time.Since(connectedAt)
+	if relay != nil {
+		receivedBytes = relay.ReceivedBytes()
+		sentBytes = relay.SentBytes()
+		isSpliced = relay.IsSpliced()
+	}
+
+	var logErrors []string
+	if closeErr != nil {
+		logErrors = append(logErrors, closeErr.Error())
+	}
+
+	var spliceAttr = "0"
+	if isSpliced {
+		spliceAttr = "1"
+	}
+
+	var accessLog = &pb.HTTPAccessLog{
+		RequestId:      httpRequestNextId(),
+		NodeId:         sharedNodeConfig.Id,
+		ServerId:       server.Id,
+		RemoteAddr:     remoteIP,
+		RawRemoteAddr:  remoteIP,
+		RemotePort:     types.Int32(remotePort),
+		RequestLength:  receivedBytes,
+		RequestTime:    duration.Seconds(),
+		Scheme:         scheme,
+		Proto:          scheme,
+		BytesSent:      sentBytes,
+		BodyBytesSent:  sentBytes,
+		TimeISO8601:    connectedAt.Format("2006-01-02T15:04:05.000Z07:00"),
+		TimeLocal:      connectedAt.Format("2/Jan/2006:15:04:05 -0700"),
+		Msec:           float64(connectedAt.Unix()) + float64(connectedAt.Nanosecond())/1000000000,
+		Timestamp:      connectedAt.Unix(),
+		Host:           serverName,
+		Request:        scheme + " " + remoteAddr + " -> " + originAddr,
+		ServerName:     serverName,
+		ServerPort:     int32(this.port),
+		ServerProtocol: scheme,
+		Errors:         logErrors,
+		Hostname:       HOSTNAME,
+		Attrs: map[string]string{
+			"closeReason":   closeReason,
+			"duration":      types.String(duration.Milliseconds()),
+			"receivedBytes": types.String(receivedBytes),
+			"sentBytes":     types.String(sentBytes),
+			"splice":        spliceAttr,
+		},
+	}
+
+	// TLS透传
+	if hello != nil {
+		accessLog.Attrs["tlsPassthrough"] = "1"
+		if len(hello.ALPN) > 0 {
+			accessLog.Attrs["alpn"] = strings.Join(hello.ALPN, ",")
+		}
+	}
+
+	if origin != nil {
+		accessLog.OriginId = origin.Id
+		accessLog.OriginAddress = originAddr
+	}
+
+	// 连接源站使用的本地IP
+	if relay != nil && relay.originConn != nil && relay.originConn.LocalAddr() != nil {
+		originLocalIP, _, splitErr := net.SplitHostPort(relay.originConn.LocalAddr().String())
+		if splitErr == nil {
+			accessLog.Attrs["origin.localAddr"] = originLocalIP
+		}
+	}
+
+	sharedHTTPAccessLogQueue.Push(accessLog)
+}
@@ -0,0 +1,363 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/goman"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/bytepool"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TCPRelayCloseReason 连接关闭原因
+type TCPRelayCloseReason = string
+
+const (
+	TCPRelayCloseReasonClientClosed        TCPRelayCloseReason = "clientClosed"        // 客户端关闭连接
+	TCPRelayCloseReasonOriginClosed        TCPRelayCloseReason = "originClosed"        // 源站关闭连接
+	TCPRelayCloseReasonClientError         TCPRelayCloseReason = "clientError"         // 客户端连接读写错误
+	TCPRelayCloseReasonOriginError         TCPRelayCloseReason = "originError"         // 源站连接读写错误
+	TCPRelayCloseReasonIdleTimeout         TCPRelayCloseReason = "idleTimeout"         // 空闲超时
+	TCPRelayCloseReasonMaxLifetime         TCPRelayCloseReason = "maxLifetime"         // 超出最长存活时间
+	TCPRelayCloseReasonTrafficLimit        TCPRelayCloseReason = "trafficLimit"        // 达到流量限制
+	TCPRelayCloseReasonConnectOriginFailed TCPRelayCloseReason = "connectOriginFailed" // 无法连接源站
+)
+
+// splice每次最多转发的数据量，每次转发完成后记录流量并检查限制
+const tcpRelaySpliceChunkSize = 256 << 10
+
+// 没有设置空闲超时时间时，写入数据的超时时间
+const tcpRelayDefaultWriteTimeout = 2 * time.Minute
+
+// TCPRelay 在客户端和源站之间双向转发TCP数据
+// 在Linux上两端都是普通TCP连接时使用splice(2)零拷贝转发，否则使用缓冲区复制
+type TCPRelay struct {
+	clientConn net.Conn
+	originConn net.Conn
+
+	idleTimeout  time.Duration
+	maxLifetime  time.Duration
+	enableSplice bool
+
+	onSent     func(n int64) // 源站数据发送到客户端之后的回调
+	shouldStop func() bool   // 转发客户端数据之前检查是否需要停止
+
+	startedAt    time.Time
+	lastActiveAt int64 // 最后有数据的时间，UnixNano
+
+	receivedBytes int64 // 从客户端接收的数据
+	sentBytes     int64 // 发送到客户端的数据
+	isSpliced     int32
+
+	closeOnce   sync.Once
+	closeReason TCPRelayCloseReason
+	closeErr    error
+}
+
+func NewTCPRelay(clientConn net.Conn, originConn net.Conn) *TCPRelay {
+	return &TCPRelay{
+		clientConn: clientConn,
+		originConn: originConn,
+	}
+}
+
+// SetTimeouts 设置空闲超时时间和最长存活时间，0表示不限制
+func (this *TCPRelay) SetTimeouts(idleTimeout time.Duration, maxLifetime time.Duration) {
+	this.idleTimeout = idleTimeout
+	this.maxLifetime = maxLifetime
+}
+
+// EnableSplice 设置是否尝试使用splice转发
+func (this *TCPRelay) EnableSplice(enableSplice bool) {
+	this.enableSplice = enableSplice
+}
+
+// OnSent 设置数据发送到客户端之后的回调
+func (this *TCPRelay) OnSent(f func(n int64)) {
+	this.onSent = f
+}
+
+// ShouldStop 设置是否需要停止转发的检查函数
+func (this *TCPRelay) ShouldStop(f func() bool) {
+	this.shouldStop = f
+}
+
+// Run 开始转发，直到任意一端关闭连接后返回
+func (this *TCPRelay) Run() {
+	this.startedAt = time.Now()
+	this.touch()
+
+	if this.maxLifetime > 0 {
+		var timer = time.AfterFunc(this.maxLifetime, func() {
+			this.Close(TCPRelayCloseReasonMaxLifetime, nil)
+		})
+		defer timer.Stop()
+	}
+
+	// 从源站读取
+	var wg = &sync.WaitGroup{}
+	wg.Add(1)
+	goman.New(func() {
+		defer wg.Done()
+		this.pipe(this.clientConn, this.originConn, false)
+	})
+
+	// 从客户端读取
+	this.pipe(this.originConn, this.clientConn, true)
+
+	wg.Wait()
+}
+
+// Close 关闭两端连接，只记录第一次关闭的原因
+func (this *TCPRelay) Close(reason TCPRelayCloseReason, err error) {
+	this.closeOnce.Do(func() {
+		this.closeReason = reason
+		this.closeErr = err
+
+		_ = this.clientConn.Close()
+		_ = this.originConn.Close()
+	})
+}
+
+// CloseReason 关闭原因
+func (this *TCPRelay) CloseReason() TCPRelayCloseReason {
+	return this.closeReason
+}
+
+// CloseError 导致连接关闭的错误
+func (this *TCPRelay) CloseError() error {
+	return this.closeErr
+}
+
+// ReceivedBytes 从客户端接收的字节数
+func (this *TCPRelay) ReceivedBytes() int64 {
+	return atomic.LoadInt64(&this.receivedBytes)
+}
+
+// SentBytes 发送到客户端的字节数
+func (this *TCPRelay) SentBytes() int64 {
+	return atomic.LoadInt64(&this.sentBytes)
+}
+
+// IsSpliced 是否有数据通过splice转发
+func (this *TCPRelay) IsSpliced() bool {
+	return atomic.LoadInt32(&this.isSpliced) == 1
+}
+
+// StartedAt 开始时间
+func (this *TCPRelay) StartedAt() time.Time {
+	return this.startedAt
+}
+
+// Duration 持续时间
+func (this *TCPRelay) Duration() time.Duration {
+	return time.Since(this.startedAt)
+}
+
+// 单向转发数据
+func (this *TCPRelay) pipe(dst net.Conn, src net.Conn, isUpstream bool) {
+	if this.enableSplice && tcpRelaySpliceSupported {
+		var srcTCPConn = tcpRelayRawConn(src)
+		var dstTCPConn = tcpRelayRawConn(dst)
+		if srcTCPConn != nil && dstTCPConn != nil {
+			atomic.StoreInt32(&this.isSpliced, 1)
+			this.splice(dstTCPConn, srcTCPConn, dst, src, isUpstream)
+			return
+		}
+	}
+
+	this.copy(dst, src, isUpstream)
+}
+
+// 通过缓冲区复制数据
+func (this *TCPRelay) copy(dst net.Conn, src net.Conn, isUpstream bool) {
+	var buf = bytepool.Pool16k.Get()
+	defer func() {
+		bytepool.Pool16k.Put(buf)
+	}()
+
+	for {
+		if isUpstream && this.shouldStop != nil && this.shouldStop() {
+			this.Close(TCPRelayCloseReasonTrafficLimit, nil)
+			return
+		}
+
+		this.setIdleDeadline(src)
+		n, err := src.Read(buf.Bytes)
+		if n > 0 {
+			this.touch()
+			this.setWriteDeadline(dst)
+			_, writeErr := dst.Write(buf.Bytes[:n])
+			if writeErr != nil {
+				this.Close(this.errorReason(!isUpstream), writeErr)
+				return
+			}
+			this.addBytes(int64(n), isUpstream)
+		}
+		if err != nil {
+			if this.isIdle(err) {
+				continue
+			}
+			this.closeWithReadError(err, isUpstream)
+			return
+		}
+	}
+}
+
+// 通过splice转发数据
+// 数据不经过ClientConn.Read()和ClientConn.Write()，所以需要单独记录客户端连接的流量
+// 每次先等待源数据到达，然后只转发已经到达的数据，这样转发所用的时间中不包含等待数据的时间
+func (this *TCPRelay) splice(dstTCPConn *net.TCPConn, srcTCPConn *net.TCPConn, dst net.Conn, src net.Conn, isUpstream bool) {
+	for {
+		if isUpstream && this.shouldStop != nil && this.shouldStop() {
+			this.Close(TCPRelayCloseReasonTrafficLimit, nil)
+			return
+		}
+
+		this.setIdleDeadline(srcTCPConn)
+		available, err := tcpRelayWaitReadable(srcTCPConn)
+		if err != nil {
+			if this.isIdle(err) {
+				continue
+			}
+			this.closeWithReadError(err, isUpstream)
+			return
+		}
+
+		// 可读但没有数据说明对方已经关闭连接
+		if available <= 0 {
+			this.closeWithReadError(io.EOF, isUpstream)
+			return
+		}
+		if available > tcpRelaySpliceChunkSize {
+			available = tcpRelaySpliceChunkSize
+		}
+
+		// 目标连接无法及时写入时不能一直阻塞
+		this.setWriteDeadline(dstTCPConn)
+		var before = time.Now()
+		n, err := dstTCPConn.ReadFrom(&io.LimitedReader{
+			R: srcTCPConn,
+			N: int64(available),
+		})
+		if n > 0 {
+			this.touch()
+			this.addBytes(n, isUpstream)
+
+			if isUpstream {
+				clientConn, ok := src.(*ClientConn)
+				if ok {
+					clientConn.AddRelayTraffic(n, 0, 0)
+				}
+			} else {
+				clientConn, ok := dst.(*ClientConn)
+				if ok {
+					clientConn.AddRelayTraffic(0, n, time.Since(before))
+				}
+			}
+		}
+		if err != nil {
+			// 数据已经到达，超时只可能是因为无法写入目标连接
+			if os.IsTimeout(err) {
+				this.Close(this.errorReason(!isUpstream), err)
+				return
+			}
+			this.closeWithReadError(err, isUpstream)
+			return
+		}
+		if n == 0 {
+			this.closeWithReadError(io.EOF, isUpstream)
+			return
+		}
+	}
+}
+
+// 设置空闲超时时间
+func (this *TCPRelay) setIdleDeadline(conn net.Conn) {
+	if this.idleTimeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(this.idleTimeout))
+	}
+}
+
+// 设置写入数据的超时时间
+func (this *TCPRelay) setWriteDeadline(conn net.Conn) {
+	var timeout = this.idleTimeout
+	if timeout <= 0 {
+		timeout = tcpRelayDefaultWriteTimeout
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(timeout))
+}
+
+// 检查读超时是否因为空闲，如果另外一个方向还有数据，则继续等待
+func (this *TCPRelay) isIdle(err error) bool {
+	if this.idleTimeout <= 0 || !os.IsTimeout(err) {
+		return false
+	}
+	if time.Since(time.Unix(0, atomic.LoadInt64(&this.lastActiveAt))) < this.idleTimeout {
+		return true
+	}
+	this.Close(TCPRelayCloseReasonIdleTimeout, nil)
+	return false
+}
+
+// 读取出错时关闭连接
+func (this *TCPRelay) closeWithReadError(err error, isUpstream bool) {
+	if err == io.EOF {
+		if isUpstream {
+			this.Close(TCPRelayCloseReasonClientClosed, nil)
+		} else {
+			this.Close(TCPRelayCloseReasonOriginClosed, nil)
+		}
+		return
+	}
+
+	// 另外一个方向已经关闭连接
+	if errors.Is(err, net.ErrClosed) {
+		this.Close(this.errorReason(isUpstream), nil)
+		return
+	}
+
+	this.Close(this.errorReason(isUpstream), err)
+}
+
+// 错误对应的关闭原因
+func (this *TCPRelay) errorReason(isClientSide bool) TCPRelayCloseReason {
+	if isClientSide {
+		return TCPRelayCloseReasonClientError
+	}
+	return TCPRelayCloseReasonOriginError
+}
+
+func (this *TCPRelay) touch() {
+	atomic.StoreInt64(&this.lastActiveAt, time.Now().UnixNano())
+}
+
+func (this *TCPRelay) addBytes(n int64, isUpstream bool) {
+	if isUpstream {
+		atomic.AddInt64(&this.receivedBytes, n)
+	} else {
+		atomic.AddInt64(&this.sentBytes, n)
+		if this.onSent != nil {
+			this.onSent(n)
+		}
+	}
+}
+
+// 获取可以用于splice的原始TCP连接
+func tcpRelayRawConn(conn net.Conn) *net.TCPConn {
+	switch rawConn := conn.(type) {
+	case *net.TCPConn:
+		return rawConn
+	case *ClientConn:
+		tcpConn, ok := rawConn.TCPConn()
+		if ok {
+			return tcpConn
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+//go:build linux
+// +build linux
+
+package nodes
+
+import (
+	"golang.org/x/sys/unix"
+	"net"
+)
+
+// 是否支持通过splice(2)转发TCP数据
+// 两端都是*net.TCPConn时，TCPConn.ReadFrom()会自动使用splice，数据不需要复制到用户空间
+const tcpRelaySpliceSupported = true
+
+// 等待连接有数据可读，返回可以立即读取的字节数，返回0表示对方已经关闭连接
+// 等待时遵循连接的读超时时间
+func tcpRelayWaitReadable(conn *net.TCPConn) (available int, err error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var opErr error
+	err = rawConn.Read(func(fd uintptr) bool {
+		var buf [1]byte
+		n, _, recvErr := unix.Recvfrom(int(fd), buf[:], unix.MSG_PEEK|unix.MSG_DONTWAIT)
+		if recvErr == unix.EAGAIN {
+			return false
+		}
+		if recvErr != nil {
+			opErr = recvErr
+			return true
+		}
+		if n == 0 {
+			available = 0
+			return true
+		}
+		available, opErr = unix.IoctlGetInt(int(fd), unix.SIOCINQ)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if opErr != nil {
+		return 0, &net.OpError{Op: "read", Net: "tcp", Source: conn.LocalAddr(), Addr: conn.RemoteAddr(), Err: opErr}
+	}
+	return available, nil
+}
@@ -0,0 +1,18 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+//go:build !linux
+// +build !linux
+
+package nodes
+
+import (
+	"errors"
+	"net"
+)
+
+// 是否支持通过splice(2)转发TCP数据
+const tcpRelaySpliceSupported = false
+
+// 等待连接有数据可读，当前平台不会调用
+func tcpRelayWaitReadable(conn *net.TCPConn) (available int, err error) {
+	return 0, errors.New("not supported")
+}
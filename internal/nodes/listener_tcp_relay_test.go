@@ -0,0 +1,214 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"bytes"
+	"github.com/iwind/TeaGo/assert"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTCPRelay_Run(t *testing.T) {
+	for _, enableSplice := range []bool{false, true} {
+		var a = assert.NewAssertion(t)
+
+		var relay, clientConn = testTCPRelay(t, func(relay *TCPRelay) {
+			relay.EnableSplice(enableSplice)
+			relay.SetTimeouts(10*time.Second, 0)
+		})
+
+		var data = bytes.Repeat([]byte("0123456789"), 100<<10)
+		go func() {
+			_, _ = clientConn.Write(data)
+		}()
+
+		var result = make([]byte, len(data))
+		_, err := io.ReadFull(clientConn, result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(bytes.Equal(data, result))
+		_ = clientConn.Close()
+
+		var r = <-relay
+		a.IsTrue(r.CloseReason() == TCPRelayCloseReasonClientClosed)
+		a.IsTrue(r.ReceivedBytes() == int64(len(data)))
+		a.IsTrue(r.SentBytes() == int64(len(data)))
+		a.IsTrue(r.IsSpliced() == (enableSplice && tcpRelaySpliceSupported))
+		t.Log("splice:", r.IsSpliced(), "duration:", r.Duration())
+	}
+}
+
+func TestTCPRelay_IdleTimeout(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var relay, clientConn = testTCPRelay(t, func(relay *TCPRelay) {
+		relay.SetTimeouts(200*time.Millisecond, 0)
+	})
+	defer func() {
+		_ = clientConn.Close()
+	}()
+
+	var before = time.Now()
+	var r = <-relay
+	a.IsTrue(r.CloseReason() == TCPRelayCloseReasonIdleTimeout)
+	a.IsTrue(time.Since(before) < 2*time.Second)
+}
+
+func TestTCPRelay_MaxLifetime(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var relay, clientConn = testTCPRelay(t, func(relay *TCPRelay) {
+		relay.SetTimeouts(0, 200*time.Millisecond)
+	})
+	defer func() {
+		_ = clientConn.Close()
+	}()
+
+	var r = <-relay
+	a.IsTrue(r.CloseReason() == TCPRelayCloseReasonMaxLifetime)
+}
+
+func TestTCPRelay_WriteTimeout(t *testing.T) {
+	for _, enableSplice := range []bool{false, true} {
+		var a = assert.NewAssertion(t)
+
+		var relay, clientConn = testTCPRelay(t, func(relay *TCPRelay) {
+			relay.EnableSplice(enableSplice)
+			relay.SetTimeouts(300*time.Millisecond, 0)
+		})
+
+		// 客户端只发送不接收，转发的数据无法写入
+		go func() {
+			var data = bytes.Repeat([]byte("0123456789"), 10<<10)
+			for {
+				_, writeErr := clientConn.Write(data)
+				if writeErr != nil {
+					return
+				}
+			}
+		}()
+
+		var before = time.Now()
+		var r = <-relay
+		_ = clientConn.Close()
+		t.Log("splice:", r.IsSpliced(), "reason:", r.CloseReason(), "err:", r.CloseError())
+		a.IsTrue(r.CloseReason() == TCPRelayCloseReasonClientError || r.CloseReason() == TCPRelayCloseReasonOriginError)
+		a.IsTrue(os.IsTimeout(r.CloseError()))
+		a.IsTrue(time.Since(before) < 5*time.Second)
+	}
+}
+
+func TestTCPRelay_WaitReadable(t *testing.T) {
+	if !tcpRelaySpliceSupported {
+		return
+	}
+
+	var a = assert.NewAssertion(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	var serverConnChan = make(chan net.Conn, 1)
+	go func() {
+		conn, acceptErr := listener.Accept()
+		if acceptErr != nil {
+			return
+		}
+		serverConnChan <- conn
+	}()
+
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var serverConn = (<-serverConnChan).(*net.TCPConn)
+
+	// 没有数据时等待到超时
+	_ = serverConn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err = tcpRelayWaitReadable(serverConn)
+	a.IsTrue(os.IsTimeout(err))
+
+	_, err = clientConn.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = serverConn.SetReadDeadline(time.Now().Add(1 * time.Second))
+	available, err := tcpRelayWaitReadable(serverConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(available == 5)
+
+	// 数据没有被读取
+	var buf = make([]byte, 16)
+	n, err := serverConn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(string(buf[:n]) == "hello")
+
+	// 对方关闭连接
+	_ = clientConn.Close()
+	available, err = tcpRelayWaitReadable(serverConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(available == 0)
+	_ = serverConn.Close()
+}
+
+// 启动一个回显源站和一个转发服务，返回转发结束后的TCPRelay和客户端连接
+func testTCPRelay(t *testing.T, setup func(relay *TCPRelay)) (chan *TCPRelay, net.Conn) {
+	originListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, acceptErr := originListener.Accept()
+		_ = originListener.Close()
+		if acceptErr != nil {
+			return
+		}
+		_, _ = io.Copy(conn, conn)
+		_ = conn.Close()
+	}()
+
+	relayListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result = make(chan *TCPRelay, 1)
+	go func() {
+		conn, acceptErr := relayListener.Accept()
+		_ = relayListener.Close()
+		if acceptErr != nil {
+			return
+		}
+		originConn, dialErr := net.Dial("tcp", originListener.Addr().String())
+		if dialErr != nil {
+			_ = conn.Close()
+			return
+		}
+		var relay = NewTCPRelay(conn, originConn)
+		setup(relay)
+		relay.Run()
+		result <- relay
+	}()
+
+	clientConn, err := net.Dial("tcp", relayListener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result, clientConn
+}
@@ -0,0 +1,147 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"io"
+	"net"
+	"time"
+)
+
+// 读取ClientHello的超时时间
+const tlsClientHelloTimeout = 10 * time.Second
+
+// 读取ClientHello之后用来中断握手的错误
+var errTLSClientHelloPeeked = errors.New("tls client hello peeked")
+
+// TLSClientHello 在不终止TLS的情况下读取的ClientHello信息
+type TLSClientHello struct {
+	Info       *tls.ClientHelloInfo
+	ServerName string   // SNI
+	ALPN       []string // 客户端支持的应用层协议
+	Data       []byte   // 已经从客户端读取的原始数据，需要重放给源站
+}
+
+// PeekTLSClientHello 读取客户端发送的ClientHello
+// 读取过程中不会向客户端写入任何数据，读取的数据保存在 TLSClientHello.Data 中
+func PeekTLSClientHello(conn net.Conn, timeout time.Duration) (*TLSClientHello, error) {
+	var recordConn = &tlsRecordConn{Conn: conn}
+	var info *tls.ClientHelloInfo
+
+	if timeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	}
+	err := tls.Server(recordConn, &tls.Config{
+		GetConfigForClient: func(clientInfo *tls.ClientHelloInfo) (*tls.Config, error) {
+			info = clientInfo
+			return nil, errTLSClientHelloPeeked
+		},
+	}).Handshake()
+	if timeout > 0 {
+		_ = conn.SetReadDeadline(time.Time{})
+	}
+
+	if info == nil {
+		if err == nil {
+			err = errors.New("no tls client hello found")
+		}
+		return nil, err
+	}
+
+	return &TLSClientHello{
+		Info:       info,
+		ServerName: info.ServerName,
+		ALPN:       info.SupportedProtos,
+		Data:       recordConn.buf.Bytes(),
+	}, nil
+}
+
+// 接收TLS连接
+// 如果SNI对应的服务开启了透传，则返回原始连接和ClientHello，否则返回终止TLS的连接
+func (this *TCPListener) acceptTLS(conn net.Conn, tlsConfig *tls.Config) (resultConn net.Conn, server *serverconfigs.ServerConfig, hello *TLSClientHello, err error) {
+	if !this.hasTLSPassthrough() {
+		return tls.Server(conn, tlsConfig), this.Group.FirstServer(), nil, nil
+	}
+
+	hello, err = PeekTLSClientHello(conn, tlsClientHelloTimeout)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// 指纹信息
+	var fingerprint = this.calculateFingerprint(hello.Info)
+	if len(fingerprint) > 0 {
+		clientConn, ok := conn.(ClientConnInterface)
+		if ok {
+			clientConn.SetFingerprint(fingerprint)
+		}
+	}
+
+	// 根据SNI选择服务
+	for _, serverName := range this.helloServerNames(hello.Info) {
+		server, _ = this.findNamedServer(serverName, true)
+		if server != nil {
+			break
+		}
+	}
+	if server != nil && SharedTCPProxyManager.IsTLSPassthrough(server.Id) {
+		return conn, server, hello, nil
+	}
+
+	// 没有开启透传的服务仍然由节点终止TLS
+	return tls.Server(&tlsReplayConn{Conn: conn, data: hello.Data}, tlsConfig), this.Group.FirstServer(), nil, nil
+}
+
+// 检查当前分组中是否有需要透传TLS的服务
+func (this *TCPListener) hasTLSPassthrough() bool {
+	for _, server := range this.Group.Servers() {
+		if SharedTCPProxyManager.IsTLSPassthrough(server.Id) {
+			return true
+		}
+	}
+	return false
+}
+
+// 记录读取的数据，并丢弃所有写入的数据
+type tlsRecordConn struct {
+	net.Conn
+
+	buf bytes.Buffer
+}
+
+func (this *tlsRecordConn) Read(b []byte) (n int, err error) {
+	n, err = this.Conn.Read(b)
+	if n > 0 {
+		this.buf.Write(b[:n])
+	}
+	return
+}
+
+func (this *tlsRecordConn) Write(b []byte) (n int, err error) {
+	return 0, io.ErrClosedPipe
+}
+
+// 先返回已经读取的数据，再从原始连接中读取
+type tlsReplayConn struct {
+	net.Conn
+
+	data []byte
+}
+
+func (this *tlsReplayConn) Read(b []byte) (n int, err error) {
+	if len(this.data) > 0 {
+		n = copy(b, this.data)
+		this.data = this.data[n:]
+		return n, nil
+	}
+	return this.Conn.Read(b)
+}
+
+// NetConn 获取原始连接
+func (this *tlsReplayConn) NetConn() net.Conn {
+	return this.Conn
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"bufio"
+	"crypto/tls"
+	"github.com/iwind/TeaGo/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPeekTLSClientHello_Passthrough(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var origin = httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		_, _ = writer.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	var helloChan = make(chan *TLSClientHello, 1)
+	var frontAddr = testTLSFront(t, func(conn net.Conn) {
+		hello, err := PeekTLSClientHello(conn, tlsClientHelloTimeout)
+		if err != nil {
+			t.Log(err)
+			_ = conn.Close()
+			return
+		}
+		helloChan <- hello
+
+		originConn, err := net.Dial("tcp", origin.Listener.Addr().String())
+		if err != nil {
+			_ = conn.Close()
+			return
+		}
+		_, err = originConn.Write(hello.Data)
+		if err != nil {
+			_ = conn.Close()
+			_ = originConn.Close()
+			return
+		}
+		NewTCPRelay(conn, originConn).Run()
+	})
+
+	// 证书由源站提供
+	conn, err := tls.Dial("tcp", frontAddr, &tls.Config{
+		RootCAs:    origin.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs,
+		ServerName: "example.com",
+		NextProtos: []string{"http/1.1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	var hello = <-helloChan
+	a.IsTrue(hello.ServerName == "example.com")
+	a.IsTrue(len(hello.ALPN) == 1 && hello.ALPN[0] == "http/1.1")
+	a.IsTrue(len(hello.Data) > 0)
+
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(resp.StatusCode == http.StatusOK)
+	a.IsTrue(string(body) == "hello")
+}
+
+func TestPeekTLSClientHello_Terminate(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	// 只用来获取测试证书
+	var certServer = httptest.NewTLSServer(http.NotFoundHandler())
+	defer certServer.Close()
+
+	var frontAddr = testTLSFront(t, func(conn net.Conn) {
+		hello, err := PeekTLSClientHello(conn, tlsClientHelloTimeout)
+		if err != nil {
+			_ = conn.Close()
+			return
+		}
+
+		// 重放ClientHello后由节点完成握手
+		var tlsConn = tls.Server(&tlsReplayConn{Conn: conn, data: hello.Data}, &tls.Config{
+			Certificates: certServer.TLS.Certificates,
+		})
+		_, _ = io.Copy(tlsConn, tlsConn)
+		_ = tlsConn.Close()
+	})
+
+	conn, err := tls.Dial("tcp", frontAddr, &tls.Config{
+		RootCAs:    certServer.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs,
+		ServerName: "example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_, err = conn.Write([]byte("ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf = make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(string(buf) == "ping")
+}
+
+func TestPeekTLSClientHello_NotTLS(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var errChan = make(chan error, 1)
+	var frontAddr = testTLSFront(t, func(conn net.Conn) {
+		_, err := PeekTLSClientHello(conn, tlsClientHelloTimeout)
+		errChan <- err
+		_ = conn.Close()
+	})
+
+	conn, err := net.Dial("tcp", frontAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+
+	err = <-errChan
+	a.IsTrue(err != nil)
+	t.Log(err)
+
+	// 不会向客户端写入任何数据
+	n, _ := conn.Read(make([]byte, 1))
+	a.IsTrue(n == 0)
+	_ = conn.Close()
+}
+
+// 启动一个只接收一个连接的TCP服务
+func testTLSFront(t *testing.T, handle func(conn net.Conn)) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, acceptErr := listener.Accept()
+		_ = listener.Close()
+		if acceptErr != nil {
+			return
+		}
+		handle(conn)
+	}()
+	return listener.Addr().String()
+}
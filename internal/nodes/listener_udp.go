@@ -3,6 +3,7 @@ package nodes
 import (
 	"errors"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
 	"github.com/TeaOSLab/EdgeNode/internal/firewalls"
 	"github.com/TeaOSLab/EdgeNode/internal/goman"
 	"github.com/TeaOSLab/EdgeNode/internal/iplibrary"
@@ -17,6 +18,7 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -160,7 +162,7 @@ func (this *UDPListener) servePacketListener(listener UDPPacketListener) error {
 	}
 
 	this.connMap = map[string]*UDPConn{}
-	this.connTicker = utils.NewTicker(1 * time.Minute)
+	this.connTicker = utils.NewTicker(5 * time.Second)
 	goman.New(func() {
 		for this.connTicker.Next() {
 			this.gcConns()
@@ -197,24 +199,44 @@ func (this *UDPListener) servePacketListener(listener UDPPacketListener) error {
 		}
 
 		if n > 0 {
+			// 检查来源IP的数据包速率和带宽
+			var proxyConfig = SharedUDPProxyManager.FindServer(firstServer.Id)
+			if !SharedUDPProxyManager.AllowPacket(firstServer.Id, proxyConfig, clientIP, n) {
+				continue
+			}
+
 			this.connLocker.Lock()
 			conn, ok := this.connMap[clientAddr.String()]
 			this.connLocker.Unlock()
+
+			var excludedOriginIds []int64
 			if ok && !conn.IsOk() {
+				// 源站异常时切换到其他源站
+				if conn.IsOriginFailed() {
+					excludedOriginIds = append(excludedOriginIds, conn.OriginId())
+				}
 				_ = conn.Close()
 				ok = false
 			}
 			if !ok {
-				originConn, err := this.connectOrigin(firstServer.Id, this.reverseProxy, listener.LocalAddr(), clientAddr)
+				// 检查会话数
+				var stat = SharedUDPProxyManager.Stat(firstServer.Id)
+				if !stat.AcquireSession(proxyConfig.MaxSessions) {
+					continue
+				}
+
+				originConn, origin, err := this.connectOrigin(firstServer.Id, this.reverseProxy, listener.LocalAddr(), clientAddr, excludedOriginIds)
 				if err != nil {
+					stat.ReleaseSession()
 					remotelogs.Error("UDP_LISTENER", "unable to connect to origin server: "+err.Error())
 					continue
 				}
 				if originConn == nil {
+					stat.ReleaseSession()
 					remotelogs.Error("UDP_LISTENER", "unable to find a origin server")
 					continue
 				}
-				conn = NewUDPConn(firstServer, clientAddr, listener, cm, originConn.(*net.UDPConn))
+				conn = NewUDPConn(firstServer, clientAddr, listener, cm, originConn.(*net.UDPConn), origin, proxyConfig, stat)
 				this.connLocker.Lock()
 				this.connMap[clientAddr.String()] = conn
 				this.connLocker.Unlock()
@@ -272,18 +294,20 @@ func (this *UDPListener) Reload(group *serverconfigs.ServerAddressGroup) {
 	this.reverseProxy = firstServer.ReverseProxy
 }
 
-func (this *UDPListener) connectOrigin(serverId int64, reverseProxy *serverconfigs.ReverseProxyConfig, localAddr net.Addr, remoteAddr net.Addr) (conn net.Conn, err error) {
+// 连接源站
+// excludedOriginIds 为需要跳过的源站，比如当前会话中已经无响应的源站
+func (this *UDPListener) connectOrigin(serverId int64, reverseProxy *serverconfigs.ReverseProxyConfig, localAddr net.Addr, remoteAddr net.Addr, excludedOriginIds []int64) (conn net.Conn, origin *serverconfigs.OriginConfig, err error) {
 	if reverseProxy == nil {
-		return nil, errors.New("no reverse proxy config")
+		return nil, nil, errors.New("no reverse proxy config")
 	}
 
 	var retries = 3
 	var addr string
 
-	var failedOriginIds []int64
+	var failedOriginIds = excludedOriginIds
 
 	for i := 0; i < retries; i++ {
-		var origin *serverconfigs.OriginConfig
+		origin = nil
 		if len(failedOriginIds) > 0 {
 			origin = reverseProxy.AnyOrigin(nil, failedOriginIds)
 		}
@@ -294,13 +318,13 @@ func (this *UDPListener) connectOrigin(serverId int64, reverseProxy *serverconfi
 			continue
 		}
 
-		conn, addr, err = OriginConnect(origin, this.port, remoteAddr.String(), "")
+		conn, addr, err = OriginConnect(origin, serverId, this.port, remoteAddr.String(), "")
 		if err != nil {
 			failedOriginIds = append(failedOriginIds, origin.Id)
 
 			remotelogs.ServerError(serverId, "UDP_LISTENER", "unable to connect origin server: "+addr+": "+err.Error(), "", nil)
 
-			SharedOriginStateManager.Fail(origin, "", reverseProxy, func() {
+			SharedOriginStateManager.Fail(origin, serverId, "", reverseProxy, func() {
 				reverseProxy.ResetScheduling()
 			})
 
@@ -331,7 +355,7 @@ func (this *UDPListener) connectOrigin(serverId int64, reverseProxy *serverconfi
 				_, err = header.WriteTo(conn)
 				if err != nil {
 					_ = conn.Close()
-					return nil, err
+					return nil, nil, err
 				}
 			}
 
@@ -369,16 +393,27 @@ type UDPConn struct {
 	serverConn    net.Conn
 	activatedAt   int64
 	isOk          bool
-	isClosed      bool
+	isClosed      int32
+
+	server       *serverconfigs.ServerConfig
+	origin       *serverconfigs.OriginConfig
+	proxyConfig  *configs.UDPProxyServerConfig
+	stat         *UDPServerStat
+	waitingAt    int64 // 等待源站响应的开始时间
+	originFailed int32 // 源站是否异常
 }
 
-func NewUDPConn(server *serverconfigs.ServerConfig, clientAddr net.Addr, proxyListener UDPPacketListener, cm any, serverConn *net.UDPConn) *UDPConn {
+func NewUDPConn(server *serverconfigs.ServerConfig, clientAddr net.Addr, proxyListener UDPPacketListener, cm any, serverConn *net.UDPConn, origin *serverconfigs.OriginConfig, proxyConfig *configs.UDPProxyServerConfig, stat *UDPServerStat) *UDPConn {
 	var conn = &UDPConn{
 		addr:          clientAddr,
 		proxyListener: proxyListener,
 		serverConn:    serverConn,
 		activatedAt:   time.Now().Unix(),
 		isOk:          true,
+		server:        server,
+		origin:        origin,
+		proxyConfig:   proxyConfig,
+		stat:          stat,
 	}
 
 	// 统计
@@ -406,10 +441,23 @@ func NewUDPConn(server *serverconfigs.ServerConfig, clientAddr net.Addr, proxyLi
 			bytepool.Pool4k.Put(buf)
 		}()
 
+		var hasResponse = false
 		for {
 			n, err := serverConn.Read(buf.Bytes)
 			if n > 0 {
 				conn.activatedAt = time.Now().Unix()
+				atomic.StoreInt64(&conn.waitingAt, 0)
+
+				// 源站已经恢复
+				if !hasResponse {
+					hasResponse = true
+					if origin != nil && !origin.IsOk && server != nil && server.ReverseProxy != nil {
+						var reverseProxy = server.ReverseProxy
+						SharedOriginStateManager.Success(origin, func() {
+							reverseProxy.ResetScheduling()
+						})
+					}
+				}
 
 				_, writingErr := proxyListener.WriteTo(buf.Bytes[:n], cm, clientAddr)
 				if writingErr != nil {
@@ -417,6 +465,10 @@ func NewUDPConn(server *serverconfigs.ServerConfig, clientAddr net.Addr, proxyLi
 					break
 				}
 
+				if stat != nil {
+					stat.addOut(n)
+				}
+
 				// 记录流量和带宽
 				if server != nil {
 					// 流量
@@ -431,6 +483,10 @@ func NewUDPConn(server *serverconfigs.ServerConfig, clientAddr net.Addr, proxyLi
 				}
 			}
 			if err != nil {
+				// 不是主动关闭的连接，通常是源站返回了ICMP不可达
+				if atomic.LoadInt32(&conn.isClosed) == 0 {
+					conn.failOrigin()
+				}
 				conn.isOk = false
 				break
 			}
@@ -440,20 +496,27 @@ func NewUDPConn(server *serverconfigs.ServerConfig, clientAddr net.Addr, proxyLi
 }
 
 func (this *UDPConn) Write(b []byte) (n int, err error) {
-	this.activatedAt = time.Now().Unix()
+	var now = time.Now().Unix()
+	this.activatedAt = now
+	atomic.CompareAndSwapInt64(&this.waitingAt, 0, now)
+
 	n, err = this.serverConn.Write(b)
 	if err != nil {
 		this.isOk = false
+	} else if this.stat != nil {
+		this.stat.addIn(n)
 	}
 	return
 }
 
 func (this *UDPConn) Close() error {
 	this.isOk = false
-	if this.isClosed {
+	if !atomic.CompareAndSwapInt32(&this.isClosed, 0, 1) {
 		return nil
 	}
-	this.isClosed = true
+	if this.stat != nil {
+		this.stat.ReleaseSession()
+	}
 	return this.serverConn.Close()
 }
 
@@ -461,5 +524,53 @@ func (this *UDPConn) IsOk() bool {
 	if !this.isOk {
 		return false
 	}
-	return time.Now().Unix()-this.activatedAt < UDPConnLifeSeconds // 如果超过 N 秒没有活动我们认为是超时
+
+	var now = time.Now().Unix()
+
+	// 源站响应超时
+	if this.proxyConfig != nil && this.proxyConfig.OriginTimeout > 0 {
+		var waitingAt = atomic.LoadInt64(&this.waitingAt)
+		if waitingAt > 0 && now-waitingAt >= int64(this.proxyConfig.OriginTimeout) {
+			this.failOrigin()
+			return false
+		}
+	}
+
+	var lifeSeconds int64 = UDPConnLifeSeconds
+	if this.proxyConfig != nil && this.proxyConfig.IdleTimeout > 0 {
+		lifeSeconds = int64(this.proxyConfig.IdleTimeout)
+	}
+	return now-this.activatedAt < lifeSeconds // 如果超过 N 秒没有活动我们认为是超时
+}
+
+// IsOriginFailed 源站是否异常
+func (this *UDPConn) IsOriginFailed() bool {
+	return atomic.LoadInt32(&this.originFailed) == 1
+}
+
+// OriginId 当前会话使用的源站ID
+func (this *UDPConn) OriginId() int64 {
+	if this.origin == nil {
+		return 0
+	}
+	return this.origin.Id
+}
+
+// 标记源站异常，每个会话只标记一次
+func (this *UDPConn) failOrigin() {
+	if !atomic.CompareAndSwapInt32(&this.originFailed, 0, 1) {
+		return
+	}
+	this.isOk = false
+
+	if this.stat != nil {
+		this.stat.addOriginFail()
+	}
+
+	if this.origin != nil && this.server != nil && this.server.ReverseProxy != nil {
+		var reverseProxy = this.server.ReverseProxy
+		SharedOriginStateManager.Fail(this.origin, this.server.Id, "", reverseProxy, func() {
+			reverseProxy.ResetScheduling()
+		})
+	}
 }
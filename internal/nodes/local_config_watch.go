@@ -0,0 +1,23 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"time"
+)
+
+// 节点本地配置文件检查间隔
+const localConfigWatchInterval = 30 * time.Second
+
+// 检查节点本地配置文件变化并重新加载，加载失败时继续使用旧的配置
+func watchLocalConfigFile[T any, PT configs.LocalConfigPtr[T]](configFile *configs.LocalConfigFile[T, PT], logTag string) {
+	configFile.Watch(localConfigWatchInterval, func(config PT) {
+		if config != nil {
+			remotelogs.Println(logTag, "loaded config file '"+configFile.Filename()+"'")
+		}
+	}, func(err error) {
+		remotelogs.Error(logTag, err.Error())
+	})
+}
@@ -134,6 +134,20 @@ func (this *Node) Start() {
 		return
 	}
 
+	// 平滑升级时从升级前的进程中接收监听的端口
+	if sharedUpgradeHandoff.IsUpgrading() {
+		remotelogs.Println("NODE", "start from graceful upgrade")
+		err = sharedUpgradeHandoff.Receive()
+		if err != nil {
+			remotelogs.Error("NODE", "receive listeners from old process failed: "+err.Error())
+		}
+	}
+
+	// 检查升级后的状态，新版本无法正常工作时自动回滚
+	goman.New(func() {
+		sharedUpgradeManager.CheckHealth()
+	})
+
 	// 启动IP库
 	remotelogs.Println("NODE", "initializing ip library ...")
 	err = iplib.InitDefault()
@@ -218,7 +232,7 @@ func (this *Node) Start() {
 
 	// 连接API
 	goman.New(func() {
-		NewAPIStream().Start()
+		sharedAPIStream.Start()
 	})
 
 	// 统计
@@ -241,6 +255,12 @@ func (this *Node) Start() {
 		return
 	}
 
+	// 通知升级前的进程停止服务
+	err = sharedUpgradeHandoff.Ready()
+	if err != nil {
+		remotelogs.Error("NODE", "notify old process failed: "+err.Error())
+	}
+
 	// hold住进程
 	select {}
 }
@@ -628,20 +648,62 @@ func (this *Node) listenSock() error {
 				_ = cmd.ReplyOk()
 				_ = this.sock.Close()
 
-				events.Notify(events.EventQuit)
-				events.Notify(events.EventTerminated)
-
-				// 监控连接数，如果连接数为0，则退出进程
-				goman.New(func() {
-					for {
-						countActiveConnections := sharedListenerManager.TotalActiveConnections()
-						if countActiveConnections <= 0 {
-							utils.Exit()
+				this.quitAndWait(0)
+			case "upgrade":
+				var params = maps.NewMap(cmd.Params)
+				if params.GetBool("graceful") {
+					if sharedUpgradeManager.IsRestarting() {
+						_ = cmd.Reply(&gosock.Command{
+							Params: map[string]any{
+								"isOk":  false,
+								"error": "the node is restarting",
+							},
+						})
+						break
+					}
+
+					var drainTimeout = DefaultUpgradeDrainTimeout
+					var timeoutSeconds = params.GetInt("timeout")
+					if timeoutSeconds > 0 {
+						drainTimeout = time.Duration(timeoutSeconds) * time.Second
+					}
+
+					// 重启过程需要等待新进程启动，在后台执行，防止阻塞其他命令
+					goman.New(func() {
+						// 保存内存缓存快照，以便新进程启动后恢复
+						caches.SharedManager.SaveMemorySnapshots()
+
+						pid, err := sharedUpgradeManager.GracefulRestart(drainTimeout)
+						if err != nil {
+							remotelogs.Error("NODE", "graceful restart failed: "+err.Error())
 							return
 						}
-						time.Sleep(1 * time.Second)
+						remotelogs.Println("NODE", "started new process, pid: "+types.String(pid))
+					})
+					_ = cmd.Reply(&gosock.Command{
+						Params: map[string]any{
+							"isOk": true,
+						},
+					})
+				} else {
+					if sharedUpgradeManager.IsInstalling() {
+						_ = cmd.Reply(&gosock.Command{
+							Params: map[string]any{
+								"isOk":  false,
+								"error": "the node is upgrading",
+							},
+						})
+					} else {
+						goman.New(func() {
+							sharedUpgradeManager.Start()
+						})
+						_ = cmd.Reply(&gosock.Command{
+							Params: map[string]any{
+								"isOk": true,
+							},
+						})
 					}
-				})
+				}
 			case "trackers":
 				_ = cmd.Reply(&gosock.Command{
 					Params: map[string]interface{}{
@@ -732,8 +794,10 @@ func (this *Node) listenSock() error {
 
 				_ = cmd.Reply(&gosock.Command{
 					Params: map[string]interface{}{
-						"conns": connMaps,
-						"total": len(connMaps),
+						"conns":   connMaps,
+						"total":   len(connMaps),
+						"origins": SharedHTTPClientPool.Stats(),
+						"udp":     SharedUDPProxyManager.Stats(),
 					},
 				})
 			case "dropIP":
@@ -829,6 +893,10 @@ func (this *Node) listenSock() error {
 				_ = cmd.Reply(&gosock.Command{Params: maps.Map{
 					"stats": m,
 				}})
+			case "cache.get", "cache.list", "cache.delete", "cache.stat":
+				_ = cmd.Reply(this.execCacheCommand(cmd))
+			case "firewall.export", "firewall.restore":
+				_ = cmd.Reply(this.execFirewallCommand(cmd))
 			case "cache.garbage":
 				var shouldDelete = maps.NewMap(cmd.Params).GetBool("delete")
 
@@ -876,6 +944,36 @@ func (this *Node) listenSock() error {
 	return nil
 }
 
+// 停止接收新连接，并在已有连接处理完毕后退出进程
+// timeout 为最长等待时间，为0表示一直等待
+func (this *Node) quitAndWait(timeout time.Duration) {
+	events.Notify(events.EventQuit)
+	this.waitAndExit(timeout)
+}
+
+// 等待已有连接处理完毕后退出，需要在停止接收新连接之后调用
+func (this *Node) waitAndExit(timeout time.Duration) {
+	events.Notify(events.EventTerminated)
+
+	// 监控连接数，如果连接数为0，则退出进程
+	var deadline = time.Now().Add(timeout)
+	goman.New(func() {
+		for {
+			countActiveConnections := sharedListenerManager.TotalActiveConnections()
+			if countActiveConnections <= 0 {
+				utils.Exit()
+				return
+			}
+			if timeout > 0 && time.Now().After(deadline) {
+				remotelogs.Println("NODE", "wait for "+types.String(countActiveConnections)+" connections timeout, exit")
+				utils.Exit()
+				return
+			}
+			time.Sleep(1 * time.Second)
+		}
+	})
+}
+
 // 重载配置调用
 func (this *Node) onReload(config *nodeconfigs.NodeConfig, reloadAll bool) {
 	nodeconfigs.ResetNodeConfig(config)
@@ -0,0 +1,177 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"github.com/TeaOSLab/EdgeNode/internal/compressions"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/gosock/pkg/gosock"
+	"strings"
+)
+
+// 命令行中列出缓存时默认的最大数量
+const defaultCacheListSize = 100
+
+// 执行缓存相关的命令
+func (this *Node) execCacheCommand(cmd *gosock.Command) *gosock.Command {
+	var params = maps.NewMap(cmd.Params)
+	var result maps.Map
+	var err error
+	switch cmd.Code {
+	case "cache.get":
+		result, err = this.execCacheGet(params.GetString("key"))
+	case "cache.list":
+		result, err = this.execCacheList(params.GetString("prefix"), params.GetInt64("serverId"), params.GetInt("size"))
+	case "cache.delete":
+		result, err = this.execCacheDelete(params.GetString("key"))
+	case "cache.stat":
+		result, err = this.execCacheStat()
+	}
+	if err != nil {
+		return &gosock.Command{Params: maps.Map{
+			"isOk":  false,
+			"error": err.Error(),
+		}}
+	}
+	if result == nil {
+		result = maps.Map{}
+	}
+	result["isOk"] = true
+	return &gosock.Command{Params: result}
+}
+
+// 查看某个Key及其所有变体的缓存
+func (this *Node) execCacheGet(key string) (maps.Map, error) {
+	var items = []*caches.ItemInfo{}
+	for _, cacheKey := range cacheKeyWithSchemes(key) {
+		variantKeys, variantNames := cacheVariantKeys(cacheKey)
+		infos, err := caches.SharedManager.InspectKeys(variantKeys, true)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			info.Variant = variantNames[info.Key]
+		}
+		items = append(items, infos...)
+	}
+	return maps.Map{
+		"items": items,
+	}, nil
+}
+
+// 列出缓存
+func (this *Node) execCacheList(prefix string, serverId int64, size int) (maps.Map, error) {
+	if size <= 0 {
+		size = defaultCacheListSize
+	}
+	items, err := caches.SharedManager.ListItems(&caches.ItemQuery{
+		Prefix:   prefix,
+		ServerId: serverId,
+		Size:     size,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return maps.Map{
+		"items": items,
+	}, nil
+}
+
+// 删除某个Key及其所有变体的缓存
+func (this *Node) execCacheDelete(key string) (maps.Map, error) {
+	var count = 0
+	for _, cacheKey := range cacheKeyWithSchemes(key) {
+		variantKeys, _ := cacheVariantKeys(cacheKey)
+		infos, err := caches.SharedManager.InspectKeys(variantKeys, false)
+		if err != nil {
+			return nil, err
+		}
+		count += len(infos)
+
+		for _, storage := range caches.SharedManager.FindAllStorages() {
+			err = storage.Purge(variantKeys, "file")
+			if err != nil {
+				return nil, err
+			}
+
+			// 切片缓存
+			err = storage.Purge([]string{caches.SlicePrefix(cacheKey)}, "dir")
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return maps.Map{
+		"count": count,
+	}, nil
+}
+
+// 所有缓存策略的统计信息
+func (this *Node) execCacheStat() (maps.Map, error) {
+	var stats = []maps.Map{}
+	for _, storage := range caches.SharedManager.FindAllStorages() {
+		var policy = storage.Policy()
+		stat, err := storage.Stat()
+		if err != nil {
+			return nil, err
+		}
+		var disks []*caches.FileDirStat
+		fileStorage, ok := storage.(*caches.FileStorage)
+		if ok {
+			disks = fileStorage.DiskStats()
+		}
+		stats = append(stats, maps.Map{
+			"policyId":   policy.Id,
+			"name":       policy.Name,
+			"type":       policy.Type,
+			"count":      stat.Count,
+			"size":       stat.Size,
+			"valueSize":  stat.ValueSize,
+			"diskSize":   storage.TotalDiskSize(),
+			"memorySize": storage.TotalMemorySize(),
+			"admission":  stat.Admission,
+			"disks":      disks,
+		})
+	}
+	return maps.Map{
+		"stats":           stats,
+		"totalDiskSize":   caches.SharedManager.TotalDiskSize(),
+		"totalMemorySize": caches.SharedManager.TotalMemorySize(),
+	}, nil
+}
+
+// 同时查找http和https对应的Key
+func cacheKeyWithSchemes(key string) []string {
+	var cacheKeys = []string{key}
+	if strings.HasPrefix(key, "http://") {
+		cacheKeys = append(cacheKeys, strings.Replace(key, "http://", "https://", 1))
+	} else if strings.HasPrefix(key, "https://") {
+		cacheKeys = append(cacheKeys, strings.Replace(key, "https://", "http://", 1))
+	}
+	return cacheKeys
+}
+
+// 某个Key的所有变体，names中为变体Key => 变体名称
+func cacheVariantKeys(key string) (keys []string, names map[string]string) {
+	names = map[string]string{
+		key:                                "",
+		key + caches.SuffixMethod + "HEAD": "HEAD",
+		key + caches.SuffixWebP:            "webp",
+		key + caches.SuffixPartial:         "partial",
+	}
+	keys = []string{
+		key,
+		key + caches.SuffixMethod + "HEAD",
+		key + caches.SuffixWebP,
+		key + caches.SuffixPartial,
+	}
+	for _, encoding := range compressions.AllEncodings() {
+		var compressionKey = key + caches.SuffixCompression + encoding
+		var webPCompressionKey = key + caches.SuffixWebP + caches.SuffixCompression + encoding
+		keys = append(keys, compressionKey, webPCompressionKey)
+		names[compressionKey] = encoding
+		names[webPCompressionKey] = "webp+" + encoding
+	}
+	return
+}
@@ -0,0 +1,59 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/firewalls"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/gosock/pkg/gosock"
+)
+
+// 执行本地防火墙相关的命令
+func (this *Node) execFirewallCommand(cmd *gosock.Command) *gosock.Command {
+	var params = maps.NewMap(cmd.Params)
+	var result maps.Map
+	var err error
+	switch cmd.Code {
+	case "firewall.export":
+		result, err = this.execFirewallExport()
+	case "firewall.restore":
+		result, err = this.execFirewallRestore(params.Get("state"))
+	}
+	if err != nil {
+		return &gosock.Command{Params: maps.Map{
+			"isOk":  false,
+			"error": err.Error(),
+		}}
+	}
+	if result == nil {
+		result = maps.Map{}
+	}
+	result["isOk"] = true
+	return &gosock.Command{Params: result}
+}
+
+// 导出防火墙状态，由命令行写入到文件
+func (this *Node) execFirewallExport() (maps.Map, error) {
+	state, err := firewalls.ExportState()
+	if err != nil {
+		return nil, err
+	}
+	return maps.Map{
+		"state": state,
+	}, nil
+}
+
+// 恢复命令行从文件中读取的防火墙状态
+func (this *Node) execFirewallRestore(stateData any) (maps.Map, error) {
+	state, err := firewalls.DecodeFirewallState(stateData)
+	if err != nil {
+		return nil, err
+	}
+	countIPs, err := firewalls.RestoreState(state)
+	if err != nil {
+		return nil, err
+	}
+	return maps.Map{
+		"countIPs": countIPs,
+	}, nil
+}
@@ -43,6 +43,13 @@ type NodeStatusExecutor struct {
 	ticker *time.Ticker
 }
 
+// 附带源站连接统计的节点状态
+type nodeStatusWithOriginStats struct {
+	*nodeconfigs.NodeStatus
+
+	OriginStats []maps.Map `json:"originStats,omitempty"`
+}
+
 func NewNodeStatusExecutor() *NodeStatusExecutor {
 	return &NodeStatusExecutor{
 		ticker:      time.NewTicker(30 * time.Second),
@@ -137,7 +144,10 @@ func (this *NodeStatusExecutor) update() {
 	status.Timestamp = status.UpdatedAt
 
 	//  发送数据
-	jsonData, err := json.Marshal(status)
+	jsonData, err := json.Marshal(&nodeStatusWithOriginStats{
+		NodeStatus:  status,
+		OriginStats: SharedHTTPClientPool.Stats(),
+	})
 	if err != nil {
 		remotelogs.Error("NODE_STATUS", "serial NodeStatus fail: "+err.Error())
 		return
@@ -58,6 +58,9 @@ type OriginConn struct {
 	lastReadOk bool
 	lastReadAt int64
 	isClosed   bool
+
+	stat       *HTTPClientStat
+	statLocker sync.Mutex
 }
 
 // NewOriginConn create new origin connection
@@ -65,6 +68,11 @@ func NewOriginConn(rawConn net.Conn) net.Conn {
 	return &OriginConn{Conn: rawConn}
 }
 
+// NewOriginStatConn create new origin connection with statistics
+func NewOriginStatConn(rawConn net.Conn, stat *HTTPClientStat) net.Conn {
+	return &OriginConn{Conn: rawConn, stat: stat}
+}
+
 // Read implement Read() for net.Conn interface
 func (this *OriginConn) Read(b []byte) (n int, err error) {
 	n, err = this.Conn.Read(b)
@@ -77,6 +85,9 @@ func (this *OriginConn) Read(b []byte) (n int, err error) {
 
 // Close implement Close() for net.Conn interface
 func (this *OriginConn) Close() error {
+	// the connection is no longer used by client pool even if closing is delayed
+	this.removeStat()
+
 	if this.lastReadOk && fasttime.Now().Unix()-this.lastReadAt <= originConnCloseDelaySeconds {
 		closingOriginConnLocker.Lock()
 		closingOriginConnMap[this] = zero.Zero{}
@@ -94,9 +105,20 @@ func (this *OriginConn) ForceClose() error {
 	}
 
 	this.isClosed = true
+	this.removeStat()
 	return this.Conn.Close()
 }
 
 func (this *OriginConn) IsExpired() bool {
 	return fasttime.Now().Unix()-this.lastReadAt > originConnCloseDelaySeconds
 }
+
+// remove connection from statistics only once
+func (this *OriginConn) removeStat() {
+	this.statLocker.Lock()
+	if this.stat != nil {
+		this.stat.removeConn()
+		this.stat = nil
+	}
+	this.statLocker.Unlock()
+}
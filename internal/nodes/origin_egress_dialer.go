@@ -0,0 +1,254 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"net"
+	"strings"
+	"time"
+)
+
+// 依次连接多个地址时，每个地址最少的连接超时时间
+const originEgressMinDialTimeout = 2 * time.Second
+
+type originEgressDialResult struct {
+	conn      net.Conn
+	err       error
+	isPrimary bool
+}
+
+// 使用出口IP配置连接源站
+// localIPv4和localIPv6为空时使用系统默认的出口地址；源站同时有IPv4和IPv6地址时，
+// 先连接优先的IP版本，超过 fallbackDelay 还没有连接成功或者连接失败时，同时尝试另外一个版本；
+// 解析域名和连接所有地址共用 dialer.Timeout
+func dialOriginEgress(ctx context.Context, dialer *net.Dialer, network string, addr string, pool *configs.OriginEgressPoolConfig, localIPv4 net.IP, localIPv6 net.IP) (net.Conn, error) {
+	if dialer.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dialer.Timeout)
+		defer cancel()
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IP
+	var ip = net.ParseIP(host)
+	if ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		ipAddrs, lookupErr := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		for _, ipAddr := range ipAddrs {
+			ips = append(ips, ipAddr.IP)
+		}
+	}
+
+	// 按IP版本分组
+	var ipv4List []net.IP
+	var ipv6List []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			if !strings.HasSuffix(network, "6") {
+				ipv4List = append(ipv4List, ip)
+			}
+		} else if !strings.HasSuffix(network, "4") {
+			ipv6List = append(ipv6List, ip)
+		}
+	}
+	if len(ipv4List) == 0 && len(ipv6List) == 0 {
+		return nil, errors.New("no suitable address found for '" + host + "'")
+	}
+
+	var primaryList, fallbackList = ipv4List, ipv6List
+	var primaryLocalIP, fallbackLocalIP = localIPv4, localIPv6
+	var preferIPv6 bool
+	switch pool.IPVersion {
+	case configs.OriginEgressIPVersionIPv4:
+		preferIPv6 = false
+	case configs.OriginEgressIPVersionIPv6:
+		preferIPv6 = true
+	default:
+		preferIPv6 = len(ipv4List) == 0 || (len(ipv6List) > 0 && ips[0].To4() == nil)
+	}
+	if preferIPv6 {
+		primaryList, fallbackList = ipv6List, ipv4List
+		primaryLocalIP, fallbackLocalIP = localIPv6, localIPv4
+	}
+	if len(primaryList) == 0 {
+		primaryList, fallbackList = fallbackList, nil
+		primaryLocalIP = fallbackLocalIP
+	}
+
+	// UDP不需要握手，直接按顺序使用
+	if len(fallbackList) == 0 || strings.HasPrefix(network, "udp") {
+		conn, err := dialOriginEgressSerial(ctx, dialer, network, primaryList, port, primaryLocalIP)
+		if err != nil && len(fallbackList) > 0 {
+			return dialOriginEgressSerial(ctx, dialer, network, fallbackList, port, fallbackLocalIP)
+		}
+		return conn, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var resultChan = make(chan originEgressDialResult, 2)
+	var startDial = func(isPrimary bool, ipList []net.IP, localIP net.IP) {
+		go func() {
+			conn, err := dialOriginEgressSerial(ctx, dialer, network, ipList, port, localIP)
+			resultChan <- originEgressDialResult{
+				conn:      conn,
+				err:       err,
+				isPrimary: isPrimary,
+			}
+		}()
+	}
+
+	startDial(true, primaryList, primaryLocalIP)
+
+	var fallbackTimer = time.NewTimer(pool.FallbackDelayDuration())
+	defer fallbackTimer.Stop()
+
+	var pending = 1
+	var fallbackStarted = false
+	var primaryErr error
+	var fallbackErr error
+	for {
+		select {
+		case <-fallbackTimer.C:
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				startDial(false, fallbackList, fallbackLocalIP)
+			}
+		case result := <-resultChan:
+			pending--
+			if result.err == nil {
+				// 关闭另外一个稍后建立的连接
+				if pending > 0 {
+					go func() {
+						var other = <-resultChan
+						if other.conn != nil {
+							_ = other.conn.Close()
+						}
+					}()
+				}
+				return result.conn, nil
+			}
+
+			if result.isPrimary {
+				primaryErr = result.err
+			} else {
+				fallbackErr = result.err
+			}
+
+			if !fallbackStarted {
+				fallbackStarted = true
+				fallbackTimer.Stop()
+				pending++
+				startDial(false, fallbackList, fallbackLocalIP)
+				continue
+			}
+
+			if pending == 0 {
+				if primaryErr != nil {
+					return nil, primaryErr
+				}
+				return nil, fallbackErr
+			}
+		}
+	}
+}
+
+// 依次连接地址列表中的地址，直到成功为止
+// 和 net.Dialer 一样，剩余的超时时间平均分配给剩余的地址，避免第一个地址用完所有的时间
+func dialOriginEgressSerial(ctx context.Context, dialer *net.Dialer, network string, ipList []net.IP, port string, localIP net.IP) (net.Conn, error) {
+	var localDialer = *dialer
+	localDialer.Timeout = 0 // 通过ctx控制超时时间
+	if localIP != nil {
+		if strings.HasPrefix(network, "udp") {
+			localDialer.LocalAddr = &net.UDPAddr{IP: localIP}
+		} else {
+			localDialer.LocalAddr = &net.TCPAddr{IP: localIP}
+		}
+	}
+
+	var lastErr error
+	for index, ip := range ipList {
+		var dialCtx = ctx
+		var cancel context.CancelFunc
+		deadline, hasDeadline := ctx.Deadline()
+		if hasDeadline {
+			var remaining = time.Until(deadline)
+			var timeout = remaining / time.Duration(len(ipList)-index)
+			if timeout < originEgressMinDialTimeout {
+				timeout = originEgressMinDialTimeout
+				if timeout > remaining {
+					timeout = remaining
+				}
+			}
+			dialCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		conn, err := localDialer.DialContext(dialCtx, network, net.JoinHostPort(ip.String(), port))
+		if cancel != nil {
+			cancel()
+		}
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// 使用出口IP配置连接TLS源站
+// 解析域名、连接和TLS握手共用 dialer.Timeout
+func dialOriginEgressTLS(dialer *net.Dialer, addr string, pool *configs.OriginEgressPoolConfig, localIPv4 net.IP, localIPv6 net.IP, tlsConfig *tls.Config) (net.Conn, error) {
+	var ctx = context.Background()
+	if dialer.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dialer.Timeout)
+		defer cancel()
+	}
+
+	rawConn, err := dialOriginEgress(ctx, dialer, "tcp", addr, pool, localIPv4, localIPv6)
+	if err != nil {
+		return nil, err
+	}
+
+	// 和 tls.Dial() 一样，没有设置ServerName时使用连接的主机名
+	if len(tlsConfig.ServerName) == 0 {
+		host, _, splitErr := net.SplitHostPort(addr)
+		if splitErr == nil {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = host
+		}
+	}
+
+	var tlsConn = tls.Client(rawConn, tlsConfig)
+	err = tlsConn.HandshakeContext(ctx)
+	if err != nil {
+		_ = rawConn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// 从客户端地址中获取客户端IP，用于按客户端IP选择出口IP
+func originEgressClientIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
@@ -0,0 +1,180 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestOriginEgressPool(t *testing.T, pool *configs.OriginEgressPoolConfig) *configs.OriginEgressPoolConfig {
+	pool.IsOn = true
+	pool.OriginIds = []int64{1}
+	err := pool.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func TestDialOriginEgress_LocalAddr(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	var pool = newTestOriginEgressPool(t, &configs.OriginEgressPoolConfig{
+		LocalAddrs: []string{"127.0.0.1"},
+		IPVersion:  "ipv6", // 源站没有IPv6地址时直接使用IPv4
+	})
+	localIPv4, localIPv6 := pool.PickLocalAddrs("")
+	conn, err := dialOriginEgress(context.Background(), &net.Dialer{Timeout: 3 * time.Second}, "tcp", listener.Addr().String(), pool, localIPv4, localIPv6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	a.IsTrue(conn.LocalAddr().(*net.TCPAddr).IP.String() == "127.0.0.1")
+
+	// UDP
+	udpConn, err := dialOriginEgress(context.Background(), &net.Dialer{}, "udp", listener.Addr().String(), pool, localIPv4, localIPv6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = udpConn.Close()
+	}()
+	_, ok := udpConn.(*net.UDPConn)
+	a.IsTrue(ok)
+	a.IsTrue(udpConn.LocalAddr().(*net.UDPAddr).IP.String() == "127.0.0.1")
+
+	// 没有匹配的IP版本
+	_, err = dialOriginEgress(context.Background(), &net.Dialer{}, "tcp6", listener.Addr().String(), pool, localIPv4, localIPv6)
+	a.IsTrue(err != nil)
+}
+
+func TestDialOriginEgress_Fallback(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	ipAddrs, err := net.DefaultResolver.LookupIPAddr(context.Background(), "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hasIPv4, hasIPv6 bool
+	for _, ipAddr := range ipAddrs {
+		if ipAddr.IP.To4() != nil {
+			hasIPv4 = true
+		} else {
+			hasIPv6 = true
+		}
+	}
+	if !hasIPv4 || !hasIPv6 {
+		t.Log("'localhost' should have both IPv4 and IPv6 addresses, skip")
+		return
+	}
+
+	// 只监听IPv4，优先的IPv6连接失败后应该立即使用IPv4
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	var pool = newTestOriginEgressPool(t, &configs.OriginEgressPoolConfig{
+		IPVersion:     "ipv6",
+		FallbackDelay: 5000,
+	})
+	var before = time.Now()
+	conn, err := dialOriginEgress(context.Background(), &net.Dialer{Timeout: 3 * time.Second}, "tcp", "localhost:"+port, pool, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	a.IsTrue(time.Since(before) < 3*time.Second)
+	a.IsTrue(conn.RemoteAddr().(*net.TCPAddr).IP.To4() != nil)
+}
+
+func TestDialOriginEgressTLS_Timeout(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	// 接受连接但是不进行TLS握手
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	go func() {
+		for {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			go func() {
+				time.Sleep(5 * time.Second)
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	var pool = newTestOriginEgressPool(t, &configs.OriginEgressPoolConfig{
+		LocalAddrs: []string{"127.0.0.1"},
+	})
+	localIPv4, localIPv6 := pool.PickLocalAddrs("")
+	var before = time.Now()
+	_, err = dialOriginEgressTLS(&net.Dialer{Timeout: 500 * time.Millisecond}, listener.Addr().String(), pool, localIPv4, localIPv6, &tls.Config{})
+	a.IsTrue(err != nil)
+	a.IsTrue(time.Since(before) < 2*time.Second)
+	t.Log(err, time.Since(before))
+}
+
+func TestDialOriginEgressSerial_Deadline(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	// 已经超时的ctx不再尝试连接
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Millisecond)
+	defer cancel()
+	time.Sleep(5 * time.Millisecond)
+	_, err = dialOriginEgressSerial(ctx, &net.Dialer{Timeout: 10 * time.Second}, "tcp", []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.1")}, port, nil)
+	a.IsTrue(err != nil)
+
+	conn, err := dialOriginEgressSerial(context.Background(), &net.Dialer{Timeout: 10 * time.Second}, "tcp", []net.IP{net.ParseIP("127.0.0.1")}, port, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+}
+
+func TestOriginEgressClientIP(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	a.IsTrue(originEgressClientIP("192.168.1.100:1234") == "192.168.1.100")
+	a.IsTrue(originEgressClientIP("[::1]:1234") == "::1")
+	a.IsTrue(originEgressClientIP("192.168.1.100") == "192.168.1.100")
+	a.IsTrue(originEgressClientIP("") == "")
+}
@@ -0,0 +1,45 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
+	"github.com/TeaOSLab/EdgeNode/internal/events"
+)
+
+var SharedOriginEgressManager = NewOriginEgressManager()
+
+func init() {
+	if !teaconst.IsMain {
+		return
+	}
+
+	events.On(events.EventLoaded, func() {
+		watchLocalConfigFile(SharedOriginEgressManager.configFile, "ORIGIN_EGRESS_MANAGER")
+	})
+	events.OnClose(func() {
+		SharedOriginEgressManager.configFile.Stop()
+	})
+}
+
+// OriginEgressManager 连接源站的出口IP配置管理
+// 配置文件修改后自动重新加载，新的配置对新连接生效
+type OriginEgressManager struct {
+	configFile *configs.LocalConfigFile[configs.OriginEgressConfig, *configs.OriginEgressConfig]
+}
+
+func NewOriginEgressManager() *OriginEgressManager {
+	return &OriginEgressManager{
+		configFile: configs.NewLocalConfigFile[configs.OriginEgressConfig](configs.OriginEgressConfigFileName),
+	}
+}
+
+// FindPool 查找源站使用的出口配置，没有配置时返回nil，表示使用系统默认的出口地址
+func (this *OriginEgressManager) FindPool(originId int64, serverId int64) *configs.OriginEgressPoolConfig {
+	var config = this.configFile.Config()
+	if config == nil {
+		return nil
+	}
+	return config.FindPool(originId, serverId)
+}
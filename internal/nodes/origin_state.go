@@ -8,6 +8,7 @@ type OriginState struct {
 	CountFails   int64
 	UpdatedAt    int64
 	Config       *serverconfigs.OriginConfig
+	ServerId     int64 // 最近一次连接失败时所属的服务，用来查找出口IP配置
 	Addr         string
 	TLSHost      string
 	ReverseProxy *serverconfigs.ReverseProxyConfig
@@ -104,7 +104,8 @@ func (this *OriginStateManager) Loop() error {
 	for _, state := range currentStates {
 		go func(state *OriginState) {
 			defer wg.Done()
-			conn, _, err := OriginConnect(state.Config, 0, "", state.TLSHost)
+			// 使用和请求时相同的出口IP配置检查
+			conn, _, err := OriginConnect(state.Config, state.ServerId, 0, "", state.TLSHost)
 			if err == nil {
 				_ = conn.Close()
 
@@ -127,7 +128,7 @@ func (this *OriginStateManager) Loop() error {
 }
 
 // Fail 添加失败的源站
-func (this *OriginStateManager) Fail(origin *serverconfigs.OriginConfig, tlsHost string, reverseProxy *serverconfigs.ReverseProxyConfig, callback func()) {
+func (this *OriginStateManager) Fail(origin *serverconfigs.OriginConfig, serverId int64, tlsHost string, reverseProxy *serverconfigs.ReverseProxyConfig, callback func()) {
 	if origin == nil || origin.Id <= 0 {
 		return
 	}
@@ -144,6 +145,7 @@ func (this *OriginStateManager) Fail(origin *serverconfigs.OriginConfig, tlsHost
 		state.TLSHost = tlsHost
 		state.CountFails++
 		state.Config = origin
+		state.ServerId = serverId
 		state.ReverseProxy = reverseProxy
 		state.UpdatedAt = timestamp
 
@@ -162,6 +164,7 @@ func (this *OriginStateManager) Fail(origin *serverconfigs.OriginConfig, tlsHost
 			this.stateMap[origin.Id] = &OriginState{
 				CountFails:   1,
 				Config:       origin,
+				ServerId:     serverId,
 				TLSHost:      tlsHost,
 				ReverseProxy: reverseProxy,
 				UpdatedAt:    timestamp,
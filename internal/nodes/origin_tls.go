@@ -0,0 +1,199 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
+	"github.com/TeaOSLab/EdgeNode/internal/events"
+)
+
+// 源站证书校验错误代号
+const (
+	OriginTLSErrorCodeNoCert           = "ORIGIN_TLS_NO_CERT"
+	OriginTLSErrorCodeUntrusted        = "ORIGIN_TLS_UNTRUSTED"
+	OriginTLSErrorCodeExpired          = "ORIGIN_TLS_EXPIRED"
+	OriginTLSErrorCodeHostnameMismatch = "ORIGIN_TLS_HOSTNAME_MISMATCH"
+	OriginTLSErrorCodePinMismatch      = "ORIGIN_TLS_PIN_MISMATCH"
+)
+
+// OriginTLSVerifyError 源站证书校验错误
+type OriginTLSVerifyError struct {
+	Code string
+	Err  error
+}
+
+func (this *OriginTLSVerifyError) Error() string {
+	return "verify origin certificate failed (" + this.Code + "): " + this.Err.Error()
+}
+
+func (this *OriginTLSVerifyError) Unwrap() error {
+	return this.Err
+}
+
+// 没有配置时使用系统根证书校验，如果需要跳过校验，需要在配置文件中明确设置
+var originTLSDefaultPolicy = newOriginTLSPolicy(configs.OriginTLSVerifyModeSystem)
+
+func newOriginTLSPolicy(mode configs.OriginTLSVerifyMode) *configs.OriginTLSPolicy {
+	var policy = &configs.OriginTLSPolicy{
+		Mode: mode,
+	}
+	_ = policy.Init()
+	return policy
+}
+
+var SharedOriginTLSManager = NewOriginTLSManager()
+
+func init() {
+	if !teaconst.IsMain {
+		return
+	}
+
+	events.On(events.EventLoaded, func() {
+		watchLocalConfigFile(SharedOriginTLSManager.configFile, "ORIGIN_TLS_MANAGER")
+	})
+	events.OnClose(func() {
+		SharedOriginTLSManager.configFile.Stop()
+	})
+}
+
+// OriginTLSManager 源站TLS证书校验配置管理
+// 配置文件修改后自动重新加载
+type OriginTLSManager struct {
+	configFile *configs.LocalConfigFile[configs.OriginTLSConfig, *configs.OriginTLSConfig]
+}
+
+func NewOriginTLSManager() *OriginTLSManager {
+	return &OriginTLSManager{
+		configFile: configs.NewLocalConfigFile[configs.OriginTLSConfig](configs.OriginTLSConfigFileName),
+	}
+}
+
+// FindPolicy 查找源站使用的校验策略
+func (this *OriginTLSManager) FindPolicy(origin *serverconfigs.OriginConfig) *configs.OriginTLSPolicy {
+	var config = this.configFile.Config()
+	if config != nil {
+		var originId int64
+		if origin != nil {
+			originId = origin.Id
+		}
+		var policy = config.FindPolicy(originId)
+		if policy != nil {
+			return policy
+		}
+	}
+	return originTLSDefaultPolicy
+}
+
+// NewOriginTLSConfig 构造连接源站使用的TLS配置
+// serverName 为SNI，为空时使用连接地址中的主机名；verifyHost 为校验证书使用的主机名，为空时使用SNI
+func NewOriginTLSConfig(origin *serverconfigs.OriginConfig, policy *configs.OriginTLSPolicy, serverName string, verifyHost string) *tls.Config {
+	var tlsConfig = &tls.Config{
+		// 证书统一在VerifyConnection中校验，以便支持自定义CA、指纹和主机名
+		InsecureSkipVerify: true,
+	}
+
+	// 客户端证书
+	if origin != nil && origin.Cert != nil {
+		var obj = origin.Cert.CertObject()
+		if obj != nil {
+			tlsConfig.Certificates = []tls.Certificate{*obj}
+			if len(serverName) == 0 && len(origin.Cert.ServerName) > 0 {
+				serverName = origin.Cert.ServerName
+			}
+		}
+	}
+
+	if policy == nil {
+		policy = originTLSDefaultPolicy
+	}
+	if len(policy.ServerName) > 0 {
+		serverName = policy.ServerName
+	}
+	tlsConfig.ServerName = serverName
+
+	if policy.IsInsecure() {
+		return tlsConfig
+	}
+
+	tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+		var hostname = verifyHost
+		if len(hostname) == 0 {
+			hostname = state.ServerName
+		}
+		return VerifyOriginCertificates(policy, state.PeerCertificates, hostname)
+	}
+
+	return tlsConfig
+}
+
+// VerifyOriginCertificates 使用策略校验源站证书
+func VerifyOriginCertificates(policy *configs.OriginTLSPolicy, certs []*x509.Certificate, hostname string) error {
+	if policy == nil || policy.IsInsecure() {
+		return nil
+	}
+
+	if len(certs) == 0 {
+		return &OriginTLSVerifyError{
+			Code: OriginTLSErrorCodeNoCert,
+			Err:  errors.New("no certificates from origin"),
+		}
+	}
+
+	// 证书链和主机名
+	if policy.Mode != configs.OriginTLSVerifyModePin {
+		var intermediates = x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			DNSName:       hostname,
+			Roots:         policy.CAPool(), // 为nil时使用系统根证书
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			return &OriginTLSVerifyError{
+				Code: originTLSErrorCode(err),
+				Err:  err,
+			}
+		}
+	}
+
+	// 公钥指纹
+	var pinHashes = policy.PinHashes()
+	if len(pinHashes) > 0 {
+		for _, cert := range certs {
+			var hash = sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pinHash := range pinHashes {
+				if bytes.Equal(hash[:], pinHash) {
+					return nil
+				}
+			}
+		}
+		return &OriginTLSVerifyError{
+			Code: OriginTLSErrorCodePinMismatch,
+			Err:  errors.New("no certificate matches the configured pins"),
+		}
+	}
+
+	return nil
+}
+
+// 根据校验错误获取错误代号
+func originTLSErrorCode(err error) string {
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &hostnameErr) {
+		return OriginTLSErrorCodeHostnameMismatch
+	}
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired {
+		return OriginTLSErrorCodeExpired
+	}
+	return OriginTLSErrorCodeUntrusted
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestVerifyOriginCertificates(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	// 测试服务器的证书包含 example.com 和 127.0.0.1
+	var server = httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		_, _ = writer.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	var serverCert = server.Certificate()
+	var serverAddr = strings.TrimPrefix(server.URL, "https://")
+
+	var caFile = t.TempDir() + "/ca.pem"
+	err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverCert.Raw}), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pinHash = sha256.Sum256(serverCert.RawSubjectPublicKeyInfo)
+	var pin = "sha256/" + base64.StdEncoding.EncodeToString(pinHash[:])
+
+	var newPolicy = func(policy *configs.OriginTLSPolicy) *configs.OriginTLSPolicy {
+		err := policy.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return policy
+	}
+
+	for _, testCase := range []struct {
+		policy     *configs.OriginTLSPolicy
+		serverName string
+		errCode    string
+	}{
+		{policy: newPolicy(&configs.OriginTLSPolicy{Mode: configs.OriginTLSVerifyModeInsecure})},
+		{policy: newPolicy(&configs.OriginTLSPolicy{Mode: configs.OriginTLSVerifyModeSystem}), errCode: OriginTLSErrorCodeUntrusted},
+		{policy: newPolicy(&configs.OriginTLSPolicy{Mode: configs.OriginTLSVerifyModeCA, CAFile: caFile})},
+		{policy: newPolicy(&configs.OriginTLSPolicy{Mode: configs.OriginTLSVerifyModeCA, CAFile: caFile}), serverName: "example.com"},
+		{policy: newPolicy(&configs.OriginTLSPolicy{Mode: configs.OriginTLSVerifyModeCA, CAFile: caFile}), serverName: "other.com", errCode: OriginTLSErrorCodeHostnameMismatch},
+		{policy: newPolicy(&configs.OriginTLSPolicy{Mode: configs.OriginTLSVerifyModeCA, CAFile: caFile, ServerName: "other.com"}), errCode: OriginTLSErrorCodeHostnameMismatch},
+		{policy: newPolicy(&configs.OriginTLSPolicy{Mode: configs.OriginTLSVerifyModeCA, CAFile: caFile, Pins: []string{pin}})},
+		{policy: newPolicy(&configs.OriginTLSPolicy{Mode: configs.OriginTLSVerifyModePin, Pins: []string{pin}}), serverName: "other.com"},
+		{policy: newPolicy(&configs.OriginTLSPolicy{Mode: configs.OriginTLSVerifyModePin, Pins: []string{"sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}}), errCode: OriginTLSErrorCodePinMismatch},
+	} {
+		conn, err := tls.Dial("tcp", serverAddr, NewOriginTLSConfig(nil, testCase.policy, testCase.serverName, ""))
+		if conn != nil {
+			_ = conn.Close()
+		}
+		if len(testCase.errCode) == 0 {
+			if err != nil {
+				t.Fatal(testCase.policy.Mode, err)
+			}
+			continue
+		}
+
+		var verifyErr *OriginTLSVerifyError
+		a.IsTrue(errors.As(err, &verifyErr))
+		if verifyErr != nil {
+			t.Log(verifyErr.Error())
+			a.IsTrue(verifyErr.Code == testCase.errCode)
+		}
+	}
+
+	// 在HTTP客户端中使用
+	{
+		var client = &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: NewOriginTLSConfig(nil, newPolicy(&configs.OriginTLSPolicy{}), "", ""),
+			},
+		}
+		_, err = client.Get(server.URL)
+		var verifyErr *OriginTLSVerifyError
+		a.IsTrue(errors.As(err, &verifyErr))
+	}
+}
+
+func TestOriginTLSManager_FindPolicy(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	// 没有配置时默认校验证书
+	var manager = NewOriginTLSManager()
+	a.IsTrue(manager.FindPolicy(nil).Mode == configs.OriginTLSVerifyModeSystem)
+	a.IsTrue(NewOriginTLSConfig(nil, nil, "", "").VerifyConnection != nil)
+
+	var config = &configs.OriginTLSConfig{
+		Default: &configs.OriginTLSPolicy{
+			Mode: configs.OriginTLSVerifyModeInsecure,
+		},
+	}
+	err := config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.configFile.Update(config)
+	a.IsTrue(manager.FindPolicy(nil).IsInsecure())
+
+	manager.configFile.Update(nil)
+	a.IsTrue(manager.FindPolicy(nil).Mode == configs.OriginTLSVerifyModeSystem)
+}
@@ -1,6 +1,7 @@
 package nodes
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"github.com/TeaOSLab/EdgeCommon/pkg/configutils"
@@ -9,10 +10,12 @@ import (
 	"github.com/iwind/TeaGo/types"
 	"net"
 	"strconv"
+	"time"
 )
 
 // OriginConnect 连接源站
-func OriginConnect(origin *serverconfigs.OriginConfig, serverPort int, remoteAddr string, tlsHost string) (originConn net.Conn, originAddr string, err error) {
+// serverId 用来查找服务的出口IP配置，可以为0
+func OriginConnect(origin *serverconfigs.OriginConfig, serverId int64, serverPort int, remoteAddr string, tlsHost string) (originConn net.Conn, originAddr string, err error) {
 	if origin.Addr == nil {
 		return nil, "", errors.New("origin server address should not be empty")
 	}
@@ -51,25 +54,7 @@ func OriginConnect(origin *serverconfigs.OriginConfig, serverPort int, remoteAdd
 					case serverconfigs.ProtocolTLS, serverconfigs.ProtocolHTTPS:
 						// TODO 支持TCP4/TCP6
 						// TODO 支持指定特定网卡
-
-						var tlsConfig = &tls.Config{
-							InsecureSkipVerify: true,
-						}
-						if origin.Cert != nil {
-							var obj = origin.Cert.CertObject()
-							if obj != nil {
-								tlsConfig.InsecureSkipVerify = false
-								tlsConfig.Certificates = []tls.Certificate{*obj}
-								if len(origin.Cert.ServerName) > 0 {
-									tlsConfig.ServerName = origin.Cert.ServerName
-								}
-							}
-						}
-						if len(tlsHost) > 0 {
-							tlsConfig.ServerName = tlsHost
-						}
-
-						conn, err = tls.DialWithDialer(&dialer, "tcp", originAddr, tlsConfig)
+						conn, err = tls.DialWithDialer(&dialer, "tcp", originAddr, newOriginConnectTLSConfig(origin, tlsHost))
 					}
 
 					// TODO 需要在合适的时机删除TOA记录
@@ -88,6 +73,30 @@ func OriginConnect(origin *serverconfigs.OriginConfig, serverPort int, remoteAdd
 		originAddr = configutils.QuoteIP(origin.Addr.Host) + ":" + types.String(serverPort)
 	}
 
+	// 指定出口IP
+	var egressPool = SharedOriginEgressManager.FindPool(origin.Id, serverId)
+	if egressPool != nil {
+		localIPv4, localIPv6 := egressPool.PickLocalAddrs(originEgressClientIP(remoteAddr))
+		var connTimeout = origin.ConnTimeoutDuration()
+		if connTimeout <= 0 {
+			connTimeout = 15 * time.Second
+		}
+		var dialer = &net.Dialer{
+			Timeout: connTimeout,
+		}
+		switch origin.Addr.Protocol {
+		case "", serverconfigs.ProtocolTCP, serverconfigs.ProtocolHTTP:
+			originConn, err = dialOriginEgress(context.Background(), dialer, "tcp", originAddr, egressPool, localIPv4, localIPv6)
+			return originConn, originAddr, err
+		case serverconfigs.ProtocolTLS, serverconfigs.ProtocolHTTPS:
+			originConn, err = dialOriginEgressTLS(dialer, originAddr, egressPool, localIPv4, localIPv6, newOriginConnectTLSConfig(origin, tlsHost))
+			return originConn, originAddr, err
+		case serverconfigs.ProtocolUDP:
+			originConn, err = dialOriginEgress(context.Background(), dialer, "udp", originAddr, egressPool, localIPv4, localIPv6)
+			return originConn, originAddr, err
+		}
+	}
+
 	switch origin.Addr.Protocol {
 	case "", serverconfigs.ProtocolTCP, serverconfigs.ProtocolHTTP:
 		// TODO 支持TCP4/TCP6
@@ -97,25 +106,7 @@ func OriginConnect(origin *serverconfigs.OriginConfig, serverPort int, remoteAdd
 	case serverconfigs.ProtocolTLS, serverconfigs.ProtocolHTTPS:
 		// TODO 支持TCP4/TCP6
 		// TODO 支持指定特定网卡
-
-		var tlsConfig = &tls.Config{
-			InsecureSkipVerify: true,
-		}
-		if origin.Cert != nil {
-			var obj = origin.Cert.CertObject()
-			if obj != nil {
-				tlsConfig.InsecureSkipVerify = false
-				tlsConfig.Certificates = []tls.Certificate{*obj}
-				if len(origin.Cert.ServerName) > 0 {
-					tlsConfig.ServerName = origin.Cert.ServerName
-				}
-			}
-		}
-		if len(tlsHost) > 0 {
-			tlsConfig.ServerName = tlsHost
-		}
-
-		originConn, err = tls.Dial("tcp", originAddr, tlsConfig)
+		originConn, err = tls.Dial("tcp", originAddr, newOriginConnectTLSConfig(origin, tlsHost))
 		return originConn, originAddr, err
 	case serverconfigs.ProtocolUDP:
 		addr, err := net.ResolveUDPAddr("udp", originAddr)
@@ -130,3 +121,13 @@ func OriginConnect(origin *serverconfigs.OriginConfig, serverPort int, remoteAdd
 
 	return nil, originAddr, errors.New("invalid origin scheme '" + origin.Addr.Protocol.String() + "'")
 }
+
+// 构造连接TLS源站使用的TLS配置
+func newOriginConnectTLSConfig(origin *serverconfigs.OriginConfig, tlsHost string) *tls.Config {
+	var policy = SharedOriginTLSManager.FindPolicy(origin)
+	var verifyHost string
+	if policy.VerifyRequestHost {
+		verifyHost = tlsHost
+	}
+	return NewOriginTLSConfig(origin, policy, tlsHost, verifyHost)
+}
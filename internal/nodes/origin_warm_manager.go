@@ -0,0 +1,115 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeCommon/pkg/nodeconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
+	"github.com/TeaOSLab/EdgeNode/internal/events"
+	"github.com/TeaOSLab/EdgeNode/internal/goman"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"time"
+)
+
+var SharedOriginWarmManager = NewOriginWarmManager()
+
+func init() {
+	if !teaconst.IsMain {
+		return
+	}
+
+	events.On(events.EventLoaded, func() {
+		goman.New(func() {
+			SharedOriginWarmManager.Start()
+		})
+	})
+	events.OnClose(func() {
+		SharedOriginWarmManager.Stop()
+	})
+}
+
+// OriginWarmManager 源站连接预热管理
+// 定时检查配置文件变化，为匹配的源站预先创建客户端并补充空闲连接
+type OriginWarmManager struct {
+	configFile *configs.LocalConfigFile[configs.OriginWarmConfig, *configs.OriginWarmConfig]
+
+	preparedConfig     *configs.OriginWarmConfig // 已经预先创建客户端时使用的配置
+	preparedNodeConfig *nodeconfigs.NodeConfig   // 已经预先创建客户端时使用的节点配置
+
+	ticker *time.Ticker
+}
+
+func NewOriginWarmManager() *OriginWarmManager {
+	return &OriginWarmManager{
+		configFile: configs.NewLocalConfigFile[configs.OriginWarmConfig](configs.OriginWarmConfigFileName),
+	}
+}
+
+func (this *OriginWarmManager) Start() {
+	err := this.Reload()
+	if err != nil {
+		remotelogs.Error("ORIGIN_WARM_MANAGER", err.Error())
+	}
+	this.warm()
+
+	this.ticker = time.NewTicker(10 * time.Second)
+	for range this.ticker.C {
+		err = this.Reload()
+		if err != nil {
+			remotelogs.Error("ORIGIN_WARM_MANAGER", err.Error())
+		}
+		this.warm()
+	}
+}
+
+func (this *OriginWarmManager) Stop() {
+	if this.ticker != nil {
+		this.ticker.Stop()
+	}
+}
+
+// Reload 检查配置文件变化并重新加载
+// 加载失败时继续使用旧的配置
+func (this *OriginWarmManager) Reload() error {
+	changed, err := this.configFile.Reload()
+	if err != nil {
+		return err
+	}
+	if changed && this.configFile.Config() != nil {
+		remotelogs.Println("ORIGIN_WARM_MANAGER", "loaded config file '"+configs.OriginWarmConfigFileName+"'")
+	}
+	return nil
+}
+
+// UpdateConfig 修改配置
+func (this *OriginWarmManager) UpdateConfig(config *configs.OriginWarmConfig) {
+	this.configFile.Update(config)
+}
+
+// FindPool 查找源站对应的预热配置，没有配置则返回nil
+func (this *OriginWarmManager) FindPool(originId int64, addr string) *configs.OriginWarmPoolConfig {
+	var config = this.configFile.Config()
+	if config == nil {
+		return nil
+	}
+	return config.FindPool(originId, addr)
+}
+
+// 预热连接
+// 预热配置或节点配置变化后，先为匹配的源站预先创建客户端
+func (this *OriginWarmManager) warm() {
+	var config = this.configFile.Config()
+	if config == nil {
+		return
+	}
+
+	var nodeConfig = sharedNodeConfig
+	if nodeConfig != nil && (config != this.preparedConfig || nodeConfig != this.preparedNodeConfig) {
+		SharedHTTPClientPool.Prepare(nodeConfig.Servers, this.FindPool)
+		this.preparedConfig = config
+		this.preparedNodeConfig = nodeConfig
+	}
+
+	SharedHTTPClientPool.Warm(this.FindPool)
+}
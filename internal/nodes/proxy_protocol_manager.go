@@ -0,0 +1,47 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
+	"github.com/TeaOSLab/EdgeNode/internal/events"
+)
+
+var SharedProxyProtocolManager = NewProxyProtocolManager()
+
+func init() {
+	if !teaconst.IsMain {
+		return
+	}
+
+	events.On(events.EventLoaded, func() {
+		// 在启动端口之前加载配置，以便确定哪些端口需要接收PROXY Protocol
+		watchLocalConfigFile(SharedProxyProtocolManager.configFile, "PROXY_PROTOCOL_MANAGER")
+	})
+	events.OnClose(func() {
+		SharedProxyProtocolManager.configFile.Stop()
+	})
+}
+
+// ProxyProtocolManager 监听端口接收PROXY Protocol配置管理
+// 配置文件修改后自动重新加载，新的配置对新连接生效；
+// 只有启动时已经配置的端口才会解析PROXY Header，新增的端口需要重启节点后生效
+type ProxyProtocolManager struct {
+	configFile *configs.LocalConfigFile[configs.ProxyProtocolConfig, *configs.ProxyProtocolConfig]
+}
+
+func NewProxyProtocolManager() *ProxyProtocolManager {
+	return &ProxyProtocolManager{
+		configFile: configs.NewLocalConfigFile[configs.ProxyProtocolConfig](configs.ProxyProtocolConfigFileName),
+	}
+}
+
+// FindListener 查找监听地址对应的配置，没有配置则返回nil
+func (this *ProxyProtocolManager) FindListener(fullAddr string, addr string) *configs.ProxyProtocolListenerConfig {
+	var config = this.configFile.Config()
+	if config == nil {
+		return nil
+	}
+	return config.FindListener(fullAddr, addr)
+}
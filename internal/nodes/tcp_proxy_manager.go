@@ -0,0 +1,57 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
+	"github.com/TeaOSLab/EdgeNode/internal/events"
+)
+
+var SharedTCPProxyManager = NewTCPProxyManager()
+
+func init() {
+	if !teaconst.IsMain {
+		return
+	}
+
+	events.On(events.EventLoaded, func() {
+		watchLocalConfigFile(SharedTCPProxyManager.configFile, "TCP_PROXY_MANAGER")
+	})
+	events.OnClose(func() {
+		SharedTCPProxyManager.configFile.Stop()
+	})
+}
+
+// TCPProxyManager TCP/TLS四层转发配置管理
+// 配置文件修改后自动重新加载，新的配置对新连接生效
+type TCPProxyManager struct {
+	configFile *configs.LocalConfigFile[configs.TCPProxyConfig, *configs.TCPProxyConfig]
+}
+
+func NewTCPProxyManager() *TCPProxyManager {
+	return &TCPProxyManager{
+		configFile: configs.NewLocalConfigFile[configs.TCPProxyConfig](configs.TCPProxyConfigFileName),
+	}
+}
+
+// FindServer 查找服务对应的配置，没有配置则返回nil
+func (this *TCPProxyManager) FindServer(serverId int64) *configs.TCPProxyServerConfig {
+	var config = this.configFile.Config()
+	if config == nil {
+		return nil
+	}
+	return config.FindServer(serverId)
+}
+
+// IsSpliceEnabled 是否启用splice零拷贝转发
+func (this *TCPProxyManager) IsSpliceEnabled() bool {
+	var config = this.configFile.Config()
+	return config == nil || !config.DisableSplice
+}
+
+// IsTLSPassthrough 检查服务是否需要透传TLS
+func (this *TCPProxyManager) IsTLSPassthrough(serverId int64) bool {
+	var server = this.FindServer(serverId)
+	return server != nil && server.TLSPassthrough
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
+	"github.com/TeaOSLab/EdgeNode/internal/events"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/ratelimit"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/types"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var SharedUDPProxyManager = NewUDPProxyManager()
+
+func init() {
+	if !teaconst.IsMain {
+		return
+	}
+
+	events.On(events.EventLoaded, func() {
+		SharedUDPProxyManager.packetBuckets.WithGC()
+		SharedUDPProxyManager.bandwidthBuckets.WithGC()
+		watchLocalConfigFile(SharedUDPProxyManager.configFile, "UDP_PROXY_MANAGER")
+	})
+	events.OnClose(func() {
+		SharedUDPProxyManager.configFile.Stop()
+	})
+}
+
+// UDPProxyManager UDP四层转发配置和会话统计管理
+// 配置文件修改后自动重新加载，新的配置对新连接生效
+type UDPProxyManager struct {
+	configFile    *configs.LocalConfigFile[configs.UDPProxyConfig, *configs.UDPProxyConfig]
+	defaultConfig *configs.UDPProxyServerConfig
+
+	packetBuckets    *ratelimit.TokenBuckets // 来源IP的数据包速率
+	bandwidthBuckets *ratelimit.TokenBuckets // 来源IP的带宽
+
+	statMap    map[int64]*UDPServerStat // serverId => *UDPServerStat
+	statLocker sync.Mutex
+}
+
+func NewUDPProxyManager() *UDPProxyManager {
+	return &UDPProxyManager{
+		configFile:       configs.NewLocalConfigFile[configs.UDPProxyConfig](configs.UDPProxyConfigFileName),
+		defaultConfig:    configs.DefaultUDPProxyServerConfig(),
+		packetBuckets:    ratelimit.NewTokenBuckets(),
+		bandwidthBuckets: ratelimit.NewTokenBuckets(),
+		statMap:          map[int64]*UDPServerStat{},
+	}
+}
+
+// FindServer 查找服务对应的配置，没有配置文件时返回默认配置
+func (this *UDPProxyManager) FindServer(serverId int64) *configs.UDPProxyServerConfig {
+	var config = this.configFile.Config()
+	if config == nil {
+		return this.defaultConfig
+	}
+	return config.FindServer(serverId)
+}
+
+// AllowPacket 检查来源IP的数据包速率和带宽
+func (this *UDPProxyManager) AllowPacket(serverId int64, config *configs.UDPProxyServerConfig, clientIP string, size int) bool {
+	if config.PacketRate <= 0 && config.Bandwidth <= 0 {
+		return true
+	}
+
+	var key = types.String(serverId) + "@" + clientIP
+	if config.PacketRate > 0 && !this.packetBuckets.TakeKey(key, float64(config.PacketRate), config.PacketBurst, 0).OK {
+		atomic.AddInt64(&this.Stat(serverId).droppedByRate, 1)
+		return false
+	}
+	if config.Bandwidth > 0 && !this.bandwidthBuckets.TakeKeyN(key, size, float64(config.Bandwidth), int(config.Bandwidth), 0).OK {
+		atomic.AddInt64(&this.Stat(serverId).droppedByBandwidth, 1)
+		return false
+	}
+	return true
+}
+
+// Stat 获取服务的会话统计
+func (this *UDPProxyManager) Stat(serverId int64) *UDPServerStat {
+	this.statLocker.Lock()
+	defer this.statLocker.Unlock()
+
+	stat, ok := this.statMap[serverId]
+	if !ok {
+		stat = NewUDPServerStat(serverId)
+		this.statMap[serverId] = stat
+	}
+	return stat
+}
+
+// Stats 所有服务的会话统计
+func (this *UDPProxyManager) Stats() []maps.Map {
+	this.statLocker.Lock()
+	var stats = make([]*UDPServerStat, 0, len(this.statMap))
+	for _, stat := range this.statMap {
+		stats = append(stats, stat)
+	}
+	this.statLocker.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].ServerId() < stats[j].ServerId()
+	})
+
+	var result = make([]maps.Map, 0, len(stats))
+	for _, stat := range stats {
+		result = append(result, stat.AsMap())
+	}
+	return result
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"github.com/iwind/TeaGo/maps"
+	"testing"
+)
+
+func TestUDPProxyManager_AllowPacket(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var manager = NewUDPProxyManager()
+	var config = &configs.UDPProxyServerConfig{
+		PacketRate: 2,
+		Bandwidth:  100,
+	}
+	err := config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 数据包速率
+	a.IsTrue(manager.AllowPacket(1, config, "192.168.1.100", 10))
+	a.IsTrue(manager.AllowPacket(1, config, "192.168.1.100", 10))
+	a.IsFalse(manager.AllowPacket(1, config, "192.168.1.100", 10))
+	a.IsTrue(manager.AllowPacket(1, config, "192.168.1.101", 10))
+	a.IsTrue(manager.AllowPacket(2, config, "192.168.1.100", 10))
+
+	// 带宽
+	a.IsTrue(manager.AllowPacket(3, config, "192.168.1.100", 60))
+	a.IsFalse(manager.AllowPacket(3, config, "192.168.1.100", 60))
+
+	// 不限制
+	for i := 0; i < 100; i++ {
+		a.IsTrue(manager.AllowPacket(4, configs.DefaultUDPProxyServerConfig(), "192.168.1.100", 1500))
+	}
+
+	var statMaps = manager.Stats()
+	a.IsTrue(len(statMaps) == 2)
+	a.IsTrue(statMaps[0].GetInt64("serverId") == 1)
+	a.IsTrue(maps.NewMap(statMaps[0].Get("dropped")).GetInt64("rate") == 1)
+	a.IsTrue(statMaps[1].GetInt64("serverId") == 3)
+	a.IsTrue(maps.NewMap(statMaps[1].Get("dropped")).GetInt64("bandwidth") == 1)
+}
+
+func TestUDPServerStat_AcquireSession(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var stat = NewUDPServerStat(1)
+	a.IsTrue(stat.AcquireSession(2))
+	a.IsTrue(stat.AcquireSession(2))
+	a.IsFalse(stat.AcquireSession(2))
+	a.IsTrue(stat.Sessions() == 2)
+
+	stat.ReleaseSession()
+	a.IsTrue(stat.AcquireSession(2))
+	a.IsTrue(stat.AcquireSession(0))
+
+	var m = stat.AsMap()
+	a.IsTrue(m.GetInt64("sessions") == 3)
+	a.IsTrue(m.GetInt64("totalSessions") == 4)
+	a.IsTrue(maps.NewMap(m.Get("dropped")).GetInt64("sessions") == 1)
+}
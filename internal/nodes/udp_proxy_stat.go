@@ -0,0 +1,93 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/iwind/TeaGo/maps"
+	"sync/atomic"
+)
+
+// UDPServerStat 单个服务的UDP会话统计
+type UDPServerStat struct {
+	serverId int64
+
+	sessions      int64 // 当前会话数
+	totalSessions int64 // 创建的会话总数
+
+	packetsIn  int64 // 从客户端接收的数据包数
+	bytesIn    int64 // 从客户端接收的字节数
+	packetsOut int64 // 发送到客户端的数据包数
+	bytesOut   int64 // 发送到客户端的字节数
+
+	droppedByRate      int64 // 因为超出数据包速率丢弃的数据包数
+	droppedByBandwidth int64 // 因为超出带宽丢弃的数据包数
+	droppedBySessions  int64 // 因为超出会话数丢弃的数据包数
+
+	originFails int64 // 源站失败次数
+}
+
+func NewUDPServerStat(serverId int64) *UDPServerStat {
+	return &UDPServerStat{
+		serverId: serverId,
+	}
+}
+
+// ServerId 服务ID
+func (this *UDPServerStat) ServerId() int64 {
+	return this.serverId
+}
+
+// Sessions 当前会话数
+func (this *UDPServerStat) Sessions() int64 {
+	return atomic.LoadInt64(&this.sessions)
+}
+
+// AcquireSession 申请新的会话，超出最大会话数时返回false
+func (this *UDPServerStat) AcquireSession(maxSessions int) bool {
+	var sessions = atomic.AddInt64(&this.sessions, 1)
+	if maxSessions > 0 && sessions > int64(maxSessions) {
+		atomic.AddInt64(&this.sessions, -1)
+		atomic.AddInt64(&this.droppedBySessions, 1)
+		return false
+	}
+	atomic.AddInt64(&this.totalSessions, 1)
+	return true
+}
+
+// ReleaseSession 释放会话
+func (this *UDPServerStat) ReleaseSession() {
+	atomic.AddInt64(&this.sessions, -1)
+}
+
+func (this *UDPServerStat) addIn(n int) {
+	atomic.AddInt64(&this.packetsIn, 1)
+	atomic.AddInt64(&this.bytesIn, int64(n))
+}
+
+func (this *UDPServerStat) addOut(n int) {
+	atomic.AddInt64(&this.packetsOut, 1)
+	atomic.AddInt64(&this.bytesOut, int64(n))
+}
+
+func (this *UDPServerStat) addOriginFail() {
+	atomic.AddInt64(&this.originFails, 1)
+}
+
+// AsMap 转换为Map
+func (this *UDPServerStat) AsMap() maps.Map {
+	return maps.Map{
+		"serverId":      this.serverId,
+		"sessions":      this.Sessions(),
+		"totalSessions": atomic.LoadInt64(&this.totalSessions),
+		"packetsIn":     atomic.LoadInt64(&this.packetsIn),
+		"bytesIn":       atomic.LoadInt64(&this.bytesIn),
+		"packetsOut":    atomic.LoadInt64(&this.packetsOut),
+		"bytesOut":      atomic.LoadInt64(&this.bytesOut),
+		"dropped": maps.Map{
+			"rate":      atomic.LoadInt64(&this.droppedByRate),
+			"bandwidth": atomic.LoadInt64(&this.droppedByBandwidth),
+			"sessions":  atomic.LoadInt64(&this.droppedBySessions),
+		},
+		"originFails": atomic.LoadInt64(&this.originFails),
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 平滑升级时传递给新进程的环境变量，值为传递文件使用的unix sock路径
+const upgradeHandoffSockEnv = "EdgeUpgradeSock"
+
+const (
+	upgradeHandoffAck      = "ok"
+	upgradeHandoffReleased = "released"
+	upgradeHandoffReady    = "ready"
+)
+
+// 等待升级前的进程释放资源的最长时间，释放时需要保存内存缓存快照
+const upgradeHandoffReleaseTimeout = 2 * time.Minute
+
+var sharedUpgradeHandoff = NewUpgradeHandoff()
+
+// UpgradeHandoff 平滑升级时新进程从升级前的进程中接收监听的端口
+type UpgradeHandoff struct {
+	conn  *net.UnixConn
+	files map[string]*os.File // key => file
+
+	locker sync.Mutex
+}
+
+func NewUpgradeHandoff() *UpgradeHandoff {
+	return &UpgradeHandoff{}
+}
+
+// IsUpgrading 当前进程是否为平滑升级启动的进程
+func (this *UpgradeHandoff) IsUpgrading() bool {
+	return len(os.Getenv(upgradeHandoffSockEnv)) > 0
+}
+
+// Receive 接收升级前的进程传递的文件，并等待升级前的进程释放缓存和本地数据库
+// 如果当前进程不是平滑升级启动的，则直接返回
+func (this *UpgradeHandoff) Receive() error {
+	var sockPath = os.Getenv(upgradeHandoffSockEnv)
+	if len(sockPath) == 0 {
+		return nil
+	}
+
+	// 防止以后再次升级时启动的进程继承此变量
+	_ = os.Unsetenv(upgradeHandoffSockEnv)
+
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: sockPath, Net: "unix"})
+	if err != nil {
+		return errors.New("connect to '" + sockPath + "' failed: " + err.Error())
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+	files, err := receiveUpgradeFiles(conn)
+	_ = conn.SetDeadline(time.Time{})
+	if err != nil {
+		_ = conn.Close()
+		return errors.New("receive files failed: " + err.Error())
+	}
+
+	this.locker.Lock()
+	this.conn = conn
+	this.files = files
+	this.locker.Unlock()
+
+	// 缓存和本地数据库的文件被升级前的进程锁定，需要等到释放之后才能打开
+	_ = conn.SetDeadline(time.Now().Add(upgradeHandoffReleaseTimeout))
+	line, err := readUpgradeHandoffLine(conn)
+	_ = conn.SetDeadline(time.Time{})
+	if err == nil && line != upgradeHandoffReleased {
+		err = errors.New("unexpected reply '" + line + "'")
+	}
+	if err != nil {
+		return errors.New("wait for old process to release resources failed: " + err.Error())
+	}
+
+	return nil
+}
+
+// TakeFile 取出某个监听器对应的文件，取出后需要由调用者关闭
+func (this *UpgradeHandoff) TakeFile(key string) *os.File {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	file, ok := this.files[key]
+	if !ok {
+		return nil
+	}
+	delete(this.files, key)
+	return file
+}
+
+// Ready 通知升级前的进程当前进程已经开始服务
+// 新配置中已经不存在的监听器对应的文件会被关闭
+func (this *UpgradeHandoff) Ready() error {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	for _, file := range this.files {
+		_ = file.Close()
+	}
+	this.files = nil
+
+	if this.conn == nil {
+		return nil
+	}
+
+	_ = this.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := this.conn.Write([]byte(upgradeHandoffReady + "\n"))
+	_ = this.conn.Close()
+	this.conn = nil
+	return err
+}
+
+// 将监听的端口传递给新进程
+// 新进程接收完文件之后调用release，停止接收新连接并关闭缓存和本地数据库，然后通知新进程继续启动，最后等待新进程开始服务；
+// released 表示是否已经调用release，调用之后当前进程不能再恢复服务
+func handOffUpgradeFiles(conn *net.UnixConn, files map[string]*os.File, release func(), readyTimeout time.Duration) (released bool, err error) {
+	_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+	err = sendUpgradeFiles(conn, files)
+	if err != nil {
+		return false, errors.New("send files failed: " + err.Error())
+	}
+
+	release()
+	released = true
+
+	_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+	_, err = conn.Write([]byte(upgradeHandoffReleased + "\n"))
+	if err != nil {
+		return true, errors.New("notify new process failed: " + err.Error())
+	}
+
+	// 等待新进程开始服务，新进程启动时需要从API同步配置，所以这里等待的时间稍长
+	_ = conn.SetDeadline(time.Now().Add(readyTimeout))
+	reply, err := readUpgradeHandoffLine(conn)
+	if err == nil && reply != upgradeHandoffReady {
+		err = errors.New("unexpected reply '" + reply + "'")
+	}
+	if err != nil {
+		return true, errors.New("wait for new process ready failed: " + err.Error())
+	}
+	return true, nil
+}
+
+// 读取一行
+func readUpgradeHandoffLine(conn net.Conn) (string, error) {
+	var result = []byte{}
+	var buf = make([]byte, 1)
+	for len(result) < 64 {
+		_, err := conn.Read(buf)
+		if err != nil {
+			return "", err
+		}
+		if buf[0] == '\n' {
+			return strings.TrimSpace(string(result)), nil
+		}
+		result = append(result, buf[0])
+	}
+	return "", errors.New("line too long")
+}
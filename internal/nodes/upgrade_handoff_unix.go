@@ -0,0 +1,179 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+//go:build !windows
+
+package nodes
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"syscall"
+)
+
+// 每次传递的最多文件数，Linux中SCM_MAX_FD为253
+const maxUpgradeFilesPerMessage = 200
+
+// 单次传递的文件描述信息
+type upgradeFilesMessage struct {
+	Keys   []string `json:"keys"`
+	IsLast bool     `json:"isLast"`
+}
+
+// 发送文件给新进程
+// 每条消息格式为：4字节长度 + JSON，文件描述符通过SCM_RIGHTS附带在消息中，新进程收到后回复确认
+func sendUpgradeFiles(conn *net.UnixConn, files map[string]*os.File) error {
+	var keys = []string{}
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for {
+		var batchKeys = keys
+		if len(batchKeys) > maxUpgradeFilesPerMessage {
+			batchKeys = batchKeys[:maxUpgradeFilesPerMessage]
+		}
+		keys = keys[len(batchKeys):]
+
+		var fds = []int{}
+		for _, key := range batchKeys {
+			fds = append(fds, int(files[key].Fd()))
+		}
+
+		messageJSON, err := json.Marshal(&upgradeFilesMessage{
+			Keys:   batchKeys,
+			IsLast: len(keys) == 0,
+		})
+		if err != nil {
+			return err
+		}
+		var data = make([]byte, 4+len(messageJSON))
+		binary.BigEndian.PutUint32(data, uint32(len(messageJSON)))
+		copy(data[4:], messageJSON)
+
+		var oob []byte
+		if len(fds) > 0 {
+			oob = syscall.UnixRights(fds...)
+		}
+		_, _, err = conn.WriteMsgUnix(data, oob, nil)
+		if err != nil {
+			return err
+		}
+
+		// 等待确认
+		ack, err := readUpgradeHandoffLine(conn)
+		if err != nil {
+			return err
+		}
+		if ack != upgradeHandoffAck {
+			return errors.New("unexpected reply '" + ack + "'")
+		}
+
+		if len(keys) == 0 {
+			return nil
+		}
+	}
+}
+
+// 从升级前的进程中接收文件
+func receiveUpgradeFiles(conn *net.UnixConn) (map[string]*os.File, error) {
+	var files = map[string]*os.File{}
+	var closeFiles = func() {
+		for _, file := range files {
+			_ = file.Close()
+		}
+	}
+
+	var buf = make([]byte, 64<<10)
+	var oob = make([]byte, syscall.CmsgSpace(maxUpgradeFilesPerMessage*4))
+	for {
+		n, oobn, _, _, err := conn.ReadMsgUnix(buf[:4], oob)
+		if err != nil {
+			closeFiles()
+			return nil, err
+		}
+
+		// 文件描述符
+		var fds = []int{}
+		if oobn > 0 {
+			controlMessages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+			if err != nil {
+				closeFiles()
+				return nil, err
+			}
+			for _, controlMessage := range controlMessages {
+				messageFds, err := syscall.ParseUnixRights(&controlMessage)
+				if err != nil {
+					closeFiles()
+					return nil, err
+				}
+				fds = append(fds, messageFds...)
+			}
+		}
+		var closeFds = func() {
+			for _, fd := range fds {
+				_ = syscall.Close(fd)
+			}
+		}
+
+		// 消息内容
+		if n < 4 {
+			_, err = io.ReadFull(conn, buf[n:4])
+			if err != nil {
+				closeFds()
+				closeFiles()
+				return nil, err
+			}
+		}
+		var size = int(binary.BigEndian.Uint32(buf[:4]))
+		if size > len(buf) {
+			closeFds()
+			closeFiles()
+			return nil, errors.New("message too large")
+		}
+		_, err = io.ReadFull(conn, buf[:size])
+		if err != nil {
+			closeFds()
+			closeFiles()
+			return nil, err
+		}
+
+		var message = &upgradeFilesMessage{}
+		err = json.Unmarshal(buf[:size], message)
+		if err != nil {
+			closeFds()
+			closeFiles()
+			return nil, err
+		}
+		if len(message.Keys) != len(fds) {
+			closeFds()
+			closeFiles()
+			return nil, errors.New("the number of files does not match the number of keys")
+		}
+		for index, key := range message.Keys {
+			syscall.CloseOnExec(fds[index])
+			files[key] = os.NewFile(uintptr(fds[index]), key)
+		}
+
+		_, err = conn.Write([]byte(upgradeHandoffAck + "\n"))
+		if err != nil {
+			closeFiles()
+			return nil, err
+		}
+
+		if message.IsLast {
+			return files, nil
+		}
+	}
+}
+
+// 启动新进程时使用的属性
+func upgradeSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setsid: true,
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+//go:build !windows
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	fsutils "github.com/TeaOSLab/EdgeNode/internal/utils/fs"
+	"github.com/iwind/TeaGo/assert"
+	"github.com/iwind/TeaGo/types"
+	stringutil "github.com/iwind/TeaGo/utils/string"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUpgradeHandoff_SendAndReceive(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var sockPath = filepath.Join(t.TempDir(), "upgrade.sock")
+	unixListener, err := net.ListenUnix("unix", &net.UnixAddr{Name: sockPath, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = unixListener.Close()
+	}()
+
+	// 超过单次传递的文件数，以测试分批发送
+	var files = map[string]*os.File{}
+	var addrs = map[string]string{}
+	for i := 0; i < maxUpgradeFilesPerMessage+10; i++ {
+		tcpListener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := tcpListener.File()
+		_ = tcpListener.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var key = "tcp://127.0.0.1:" + types.String(i) + "@tcp"
+		files[key] = file
+		addrs[key] = tcpListener.Addr().String()
+	}
+	defer func() {
+		for _, file := range files {
+			_ = file.Close()
+		}
+	}()
+
+	var errChan = make(chan error, 1)
+	go func() {
+		conn, err := unixListener.AcceptUnix()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+		_, err = handOffUpgradeFiles(conn, files, func() {}, 10*time.Second)
+		errChan <- err
+	}()
+
+	t.Setenv(upgradeHandoffSockEnv, sockPath)
+	var handoff = NewUpgradeHandoff()
+	a.IsTrue(handoff.IsUpgrading())
+	err = handoff.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsFalse(handoff.IsUpgrading())
+
+	for key, addr := range addrs {
+		var file = handoff.TakeFile(key)
+		a.IsNotNil(file)
+		listener, err := net.FileListener(file)
+		_ = file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(listener.Addr().String() == addr)
+		_ = listener.Close()
+	}
+	a.IsNil(handoff.TakeFile("tcp://127.0.0.1:0@udp"))
+
+	err = handoff.Ready()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = <-errChan
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpgradeHandoff_KVFileCache(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var sockPath = filepath.Join(t.TempDir(), "upgrade.sock")
+	unixListener, err := net.ListenUnix("unix", &net.UnixAddr{Name: sockPath, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = unixListener.Close()
+	}()
+
+	tcpListener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := tcpListener.File()
+	_ = tcpListener.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var key = "tcp://127.0.0.1:0@tcp"
+	var files = map[string]*os.File{key: file}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	// 升级前的进程使用KV缓存列表
+	var cacheDir = filepath.Join(t.TempDir(), "p1")
+	var oldList = caches.NewKVFileList(cacheDir)
+	err = oldList.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hash = stringutil.Md5("https://example.com/index.html")
+	err = oldList.Add(hash, &caches.Item{
+		Type:      caches.ItemTypeFile,
+		Key:       "https://example.com/index.html",
+		ExpiresAt: time.Now().Unix() + 3600,
+		BodySize:  4096,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var isReleased = &atomic.Bool{}
+	var isLockedBeforeRelease = &atomic.Bool{}
+	var errChan = make(chan error, 1)
+	go func() {
+		conn, err := unixListener.AcceptUnix()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+		_, err = handOffUpgradeFiles(conn, files, func() {
+			// 释放之前其他进程无法打开同一个缓存列表
+			var locker = fsutils.NewLocker(filepath.Join(cacheDir, "db-0.store", ".fs"))
+			ok, _ := locker.TryLock()
+			isLockedBeforeRelease.Store(!ok)
+			_ = locker.Release()
+
+			_ = oldList.Close()
+			isReleased.Store(true)
+		}, 10*time.Second)
+		errChan <- err
+	}()
+
+	t.Setenv(upgradeHandoffSockEnv, sockPath)
+	var handoff = NewUpgradeHandoff()
+	err = handoff.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(isLockedBeforeRelease.Load())
+	a.IsTrue(isReleased.Load())
+
+	// 新进程在接收文件之后打开同一个缓存列表
+	var newList = caches.NewKVFileList(cacheDir)
+	var initErr = make(chan error, 1)
+	go func() {
+		initErr <- newList.Init()
+	}()
+	select {
+	case err = <-initErr:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("open kv file list timeout")
+	}
+	defer func() {
+		_ = newList.Close()
+	}()
+
+	exists, _, err := newList.Exist(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(exists)
+
+	var receivedFile = handoff.TakeFile(key)
+	a.IsNotNil(receivedFile)
+	_ = receivedFile.Close()
+
+	err = handoff.Ready()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = <-errChan
+	if err != nil {
+		t.Fatal(err)
+	}
+}
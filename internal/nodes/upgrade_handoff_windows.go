@@ -0,0 +1,23 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+//go:build windows
+
+package nodes
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+func sendUpgradeFiles(conn *net.UnixConn, files map[string]*os.File) error {
+	return errors.New("graceful upgrade is not supported on windows")
+}
+
+func receiveUpgradeFiles(conn *net.UnixConn) (map[string]*os.File, error) {
+	return nil, errors.New("graceful upgrade is not supported on windows")
+}
+
+func upgradeSysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
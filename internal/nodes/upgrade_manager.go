@@ -4,8 +4,11 @@ package nodes
 
 import (
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
 	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
 	"github.com/TeaOSLab/EdgeNode/internal/events"
 	"github.com/TeaOSLab/EdgeNode/internal/goman"
@@ -14,22 +17,31 @@ import (
 	"github.com/TeaOSLab/EdgeNode/internal/utils"
 	executils "github.com/TeaOSLab/EdgeNode/internal/utils/exec"
 	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/types"
 	stringutil "github.com/iwind/TeaGo/utils/string"
-	"github.com/iwind/gosock/pkg/gosock"
+	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sync/atomic"
 	"time"
 )
 
 var sharedUpgradeManager = NewUpgradeManager()
 
+// DefaultUpgradeDrainTimeout 平滑升级时等待已有连接处理完毕的默认时间
+const DefaultUpgradeDrainTimeout = 60 * time.Second
+
 // UpgradeManager 节点升级管理器
 // TODO 需要在集群中设置是否自动更新
 type UpgradeManager struct {
 	isInstalling bool
 	lastFile     string
+	lastVersion  string
 	exe          string
+
+	isRestarting int32
 }
 
 // NewUpgradeManager 获取新对象
@@ -83,12 +95,27 @@ func (this *UpgradeManager) IsInstalling() bool {
 	return this.isInstalling
 }
 
+// IsRestarting 检查是否正在平滑重启
+func (this *UpgradeManager) IsRestarting() bool {
+	return atomic.LoadInt32(&this.isRestarting) == 1
+}
+
 func (this *UpgradeManager) install() error {
+	config, err := configs.LoadUpgradeConfig()
+	if err != nil {
+		return errors.New("load config file '" + configs.UpgradeConfigFileName + "' failed: " + err.Error())
+	}
+
+	// 没有设置公钥时无法校验升级包的来源，拒绝安装
+	if !config.RequireSignature() {
+		return errors.New("'publicKey' is not set in '" + configs.UpgradeConfigFileName + "', refuse to install unsigned package")
+	}
+
 	// 检查是否有已下载但未安装成功的
 	if len(this.lastFile) > 0 {
-		_, err := os.Stat(this.lastFile)
+		_, err = os.Stat(this.lastFile)
 		if err == nil {
-			err = this.unzip(this.lastFile)
+			err = this.apply(this.lastFile, this.lastVersion, config.KeepVersions)
 			if err != nil {
 				return err
 			}
@@ -99,7 +126,7 @@ func (this *UpgradeManager) install() error {
 
 	// 创建临时文件
 	var dir = Tea.Root + "/tmp"
-	_, err := os.Stat(dir)
+	_, err = os.Stat(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
 			err = os.Mkdir(dir, 0777)
@@ -134,6 +161,7 @@ func (this *UpgradeManager) install() error {
 	var h = md5.New()
 	var sum = ""
 	var filename = ""
+	var version = ""
 	for {
 		resp, err := client.NodeRPC.DownloadNodeInstallationFile(client.Context(), &pb.DownloadNodeInstallationFileRequest{
 			Os:          runtime.GOOS,
@@ -148,9 +176,16 @@ func (this *UpgradeManager) install() error {
 		}
 		sum = resp.Sum
 		filename = resp.Filename
+		version = resp.Version
 		if stringutil.VersionCompare(resp.Version, teaconst.Version) <= 0 {
 			return nil
 		}
+
+		// 曾经升级失败并回滚的版本不再自动升级
+		if this.isRolledBackVersion(resp.Version) {
+			remotelogs.Debug("UPGRADE_MANAGER", "skip v"+resp.Version+" because it has been rolled back")
+			return nil
+		}
 		if len(resp.ChunkData) == 0 {
 			break
 		}
@@ -183,6 +218,14 @@ func (this *UpgradeManager) install() error {
 		return nil
 	}
 
+	// 校验签名
+	err = verifyUpgradeSignature(config, path, filename, version)
+	if err != nil {
+		_ = os.Remove(path)
+		return errors.New("verify signature of '" + filename + "' failed: " + err.Error())
+	}
+	remotelogs.Println("UPGRADE_MANAGER", "verify signature of '"+filename+"' successfully")
+
 	// 改成zip
 	zipPath := dir + "/" + filename
 	err = os.Rename(path, zipPath)
@@ -190,9 +233,10 @@ func (this *UpgradeManager) install() error {
 		return err
 	}
 	this.lastFile = zipPath
+	this.lastVersion = version
 
-	// 解压
-	err = this.unzip(zipPath)
+	// 安装
+	err = this.apply(zipPath, version, config.KeepVersions)
 	if err != nil {
 		return err
 	}
@@ -200,39 +244,52 @@ func (this *UpgradeManager) install() error {
 	return nil
 }
 
-// 解压
-func (this *UpgradeManager) unzip(zipPath string) error {
+// 安装升级包
+// 先解压到版本目录中，再覆盖当前文件，新版本启动后需要通过健康检查，否则自动回滚
+func (this *UpgradeManager) apply(zipPath string, version string, keepVersions int) error {
 	var isOk = false
 	defer func() {
 		if isOk {
-			// 只有解压并覆盖成功后才会删除
+			// 只有安装成功后才会删除
 			_ = os.Remove(zipPath)
 		}
 	}()
 
-	// 解压
-	var target = Tea.Root
-	if Tea.IsTesting() {
-		// 测试环境下只解压在tmp目录
-		target = Tea.Root + "/tmp"
+	// 解压到版本目录
+	stageDir, err := this.stage(zipPath, version)
+	if err != nil {
+		return errors.New("stage '" + zipPath + "' failed: " + err.Error())
 	}
 
-	// 先改先前的可执行文件
-	err := os.Rename(target+"/bin/"+teaconst.ProcessName, target+"/bin/."+teaconst.ProcessName+".dist")
-	var hasBackup = err == nil
-	defer func() {
-		if !isOk && hasBackup {
-			// 失败时还原
-			_ = os.Rename(target+"/bin/."+teaconst.ProcessName+".dist", target+"/bin/"+teaconst.ProcessName)
-		}
-	}()
+	// 备份当前版本
+	err = this.backupCurrent(stageDir)
+	if err != nil {
+		return errors.New("backup current version failed: " + err.Error())
+	}
 
-	var unzip = utils.NewUnzip(zipPath, target, "edge-node/")
-	err = unzip.Run()
+	// 覆盖当前文件
+	var target = upgradeRootDir()
+	err = copyUpgradeDir(stageDir, target)
 	if err != nil {
+		// 失败时还原
+		_ = copyUpgradeDir(upgradeVersionsDir()+"/"+teaconst.Version, target)
 		return err
 	}
 
+	// 记录升级状态，用于新版本启动后检查
+	var state = &UpgradeState{
+		FromVersion: teaconst.Version,
+		ToVersion:   version,
+		Status:      UpgradeStatusChecking,
+		CreatedAt:   time.Now().Unix(),
+	}
+	err = state.Save()
+	if err != nil {
+		return errors.New("save upgrade state failed: " + err.Error())
+	}
+
+	this.cleanVersions(keepVersions, version)
+
 	isOk = true
 
 	return nil
@@ -240,8 +297,21 @@ func (this *UpgradeManager) unzip(zipPath string) error {
 
 // 重启
 func (this *UpgradeManager) restart() error {
+	// 保存内存缓存快照，以便新进程启动后恢复
+	caches.SharedManager.SaveMemorySnapshots()
+
+	// 优先尝试平滑重启，不中断已有连接
+	// 失败时不需要恢复sock，因为接下来仍然会重启
+	_, err := this.gracefulRestart(DefaultUpgradeDrainTimeout, false)
+	if err == nil {
+		return nil
+	}
+	remotelogs.Warn("UPGRADE_MANAGER", "graceful restart failed, restart directly: "+err.Error())
+
 	// 关闭当前sock，防止无法重启
-	_ = gosock.NewTmpSock(teaconst.ProcessName).Close()
+	if nodeInstance != nil {
+		_ = nodeInstance.sock.Close()
+	}
 
 	// 重新启动
 	if DaemonIsOn && DaemonPid == os.Getppid() {
@@ -254,9 +324,8 @@ func (this *UpgradeManager) restart() error {
 		events.Notify(events.EventTerminated)
 
 		// 启动
-		var exe = filepath.Dir(this.exe) + "/" + teaconst.ProcessName
-		var cmd = executils.NewCmd(exe, "start")
-		err := cmd.Start()
+		var cmd = executils.NewCmd(this.newExe(), "start")
+		err = cmd.Start()
 		if err != nil {
 			return err
 		}
@@ -267,3 +336,129 @@ func (this *UpgradeManager) restart() error {
 	}
 	return nil
 }
+
+// GracefulRestart 平滑重启
+// 启动新进程并将当前监听的端口传递给新进程，新进程接收端口后当前进程停止接收新连接并关闭缓存和本地数据库，
+// 新进程打开这些文件并开始服务，当前进程在处理完已有连接或超时后退出
+func (this *UpgradeManager) GracefulRestart(drainTimeout time.Duration) (pid int, err error) {
+	return this.gracefulRestart(drainTimeout, true)
+}
+
+func (this *UpgradeManager) gracefulRestart(drainTimeout time.Duration, rollbackSock bool) (pid int, err error) {
+	if nodeInstance == nil {
+		return 0, errors.New("node has not been started")
+	}
+	if !atomic.CompareAndSwapInt32(&this.isRestarting, 0, 1) {
+		return 0, errors.New("the node is restarting")
+	}
+	var isOk = false
+	defer func() {
+		if !isOk {
+			atomic.StoreInt32(&this.isRestarting, 0)
+		}
+	}()
+
+	// 检查新的可执行文件
+	var exe = this.newExe()
+	_, err = os.Stat(exe)
+	if err != nil {
+		return 0, err
+	}
+
+	// 用来传递文件的sock
+	var sockPath = os.TempDir() + "/" + teaconst.ProcessName + "-upgrade-" + types.String(os.Getpid()) + ".sock"
+	_ = os.Remove(sockPath)
+	handoffListener, err := net.ListenUnix("unix", &net.UnixAddr{Name: sockPath, Net: "unix"})
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = handoffListener.Close()
+		_ = os.Remove(sockPath)
+	}()
+
+	var files = sharedListenerManager.UpgradeFiles()
+	defer func() {
+		for _, file := range files {
+			_ = file.Close()
+		}
+	}()
+
+	// 关闭当前sock，以便新进程可以监听
+	_ = nodeInstance.sock.Close()
+
+	// 启动新进程
+	var cmd = exec.Command(exe)
+	cmd.Env = append(os.Environ(), upgradeHandoffSockEnv+"="+sockPath, "EdgeBackground=on")
+	cmd.SysProcAttr = upgradeSysProcAttr()
+	err = cmd.Start()
+	if err != nil {
+		this.rollbackGracefulRestart(nil, rollbackSock)
+		return 0, err
+	}
+
+	// 传递文件
+	_ = handoffListener.SetDeadline(time.Now().Add(30 * time.Second))
+	conn, err := handoffListener.AcceptUnix()
+	if err != nil {
+		this.rollbackGracefulRestart(cmd, rollbackSock)
+		return 0, errors.New("wait for new process failed: " + err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// 新进程接收完文件之后，当前进程停止接收新连接，并关闭缓存和本地数据库，新进程才能打开这些被锁定的文件
+	released, err := handOffUpgradeFiles(conn, files, func() {
+		events.Notify(events.EventQuit)
+	}, 2*time.Minute)
+	if err != nil {
+		if !released {
+			this.rollbackGracefulRestart(cmd, rollbackSock)
+			return 0, err
+		}
+
+		// 已经释放资源之后不能再恢复服务，新进程继续启动，由新进程的健康检查决定是否回滚
+		remotelogs.Error("UPGRADE_MANAGER", err.Error())
+	}
+
+	isOk = true
+	pid = cmd.Process.Pid
+	_ = cmd.Process.Release()
+
+	remotelogs.Println("UPGRADE_MANAGER", "new process started, pid: "+types.String(pid)+", waiting for current connections to be closed ...")
+
+	// 等待已有连接处理完毕
+	nodeInstance.waitAndExit(drainTimeout)
+
+	return pid, nil
+}
+
+// 平滑重启失败时恢复
+func (this *UpgradeManager) rollbackGracefulRestart(cmd *exec.Cmd, rollbackSock bool) {
+	if cmd != nil && cmd.Process != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}
+
+	if !rollbackSock {
+		return
+	}
+
+	// 重新监听sock
+	goman.New(func() {
+		err := nodeInstance.sock.Listen()
+		if err != nil {
+			remotelogs.Error("UPGRADE_MANAGER", "listen sock failed: "+err.Error())
+		}
+	})
+}
+
+// 新的可执行文件路径
+func (this *UpgradeManager) newExe() string {
+	var exe = this.exe
+	if len(exe) == 0 {
+		exe, _ = os.Executable()
+	}
+	return filepath.Dir(exe) + "/" + teaconst.ProcessName
+}
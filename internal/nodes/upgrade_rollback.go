@@ -0,0 +1,395 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeNode/internal/utils"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/types"
+	stringutil "github.com/iwind/TeaGo/utils/string"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// UpgradeStatus 升级状态
+type UpgradeStatus = string
+
+const (
+	UpgradeStatusChecking   UpgradeStatus = "checking"   // 已安装，等待新版本通过健康检查
+	UpgradeStatusRolledBack UpgradeStatus = "rolledBack" // 新版本未通过健康检查，已回滚
+)
+
+// 新版本在健康检查期间最多启动的次数，超过后认为新版本无法正常启动
+const maxUpgradeStarts = 3
+
+var upgradeVersionReg = regexp.MustCompile(`^[\w.\-]+$`)
+
+// UpgradeState 最近一次升级的状态
+type UpgradeState struct {
+	FromVersion string        `json:"fromVersion"` // 升级前的版本
+	ToVersion   string        `json:"toVersion"`   // 升级后的版本
+	Status      UpgradeStatus `json:"status"`      // 状态
+	CountStarts int           `json:"countStarts"` // 新版本已启动次数
+	Reason      string        `json:"reason"`      // 回滚原因
+	IsReported  bool          `json:"isReported"`  // 回滚后是否已由旧版本重新上报
+	CreatedAt   int64         `json:"createdAt"`   // 安装时间
+}
+
+// 读取升级状态，没有升级记录时返回nil
+func loadUpgradeState() (*UpgradeState, error) {
+	data, err := os.ReadFile(upgradeStateFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var state = &UpgradeState{}
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Save 保存升级状态
+func (this *UpgradeState) Save() error {
+	data, err := json.Marshal(this)
+	if err != nil {
+		return err
+	}
+	var path = upgradeStateFile()
+	err = os.WriteFile(path+".tmp", data, 0666)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// CheckHealth 检查升级后的新版本是否正常工作
+// 新版本需要在指定时间内启动所有监听端口并连接到API节点，否则自动回滚到之前的版本
+func (this *UpgradeManager) CheckHealth() {
+	state, err := loadUpgradeState()
+	if err != nil {
+		remotelogs.Error("UPGRADE_MANAGER", "load upgrade state failed: "+err.Error())
+		return
+	}
+	if state == nil {
+		return
+	}
+
+	// 回滚后由之前的版本再次上报，因为失败的版本可能无法连接API节点
+	if state.Status == UpgradeStatusRolledBack {
+		if !state.IsReported && state.FromVersion == teaconst.Version {
+			this.waitForAPIConnected(24 * time.Hour)
+			remotelogs.Error("UPGRADE_MANAGER", "upgrade from v"+state.FromVersion+" to v"+state.ToVersion+" failed and rolled back: "+state.Reason)
+			state.IsReported = true
+			err = state.Save()
+			if err != nil {
+				remotelogs.Error("UPGRADE_MANAGER", "save upgrade state failed: "+err.Error())
+			}
+		}
+		return
+	}
+
+	// 当前运行的不是升级后的版本，比如已经手动替换了可执行文件
+	if state.Status != UpgradeStatusChecking || state.ToVersion != teaconst.Version {
+		return
+	}
+
+	state.CountStarts++
+	err = state.Save()
+	if err != nil {
+		remotelogs.Error("UPGRADE_MANAGER", "save upgrade state failed: "+err.Error())
+	}
+	if state.CountStarts > maxUpgradeStarts {
+		this.rollback(state, "the new version has been started "+types.String(state.CountStarts-1)+" times without passing health check")
+		return
+	}
+
+	config, err := configs.LoadUpgradeConfig()
+	if err != nil {
+		remotelogs.Error("UPGRADE_MANAGER", "load config file '"+configs.UpgradeConfigFileName+"' failed: "+err.Error())
+		config = configs.DefaultUpgradeConfig()
+	}
+
+	remotelogs.Println("UPGRADE_MANAGER", "checking health of v"+state.ToVersion+" ...")
+
+	var timeout = config.HealthTimeoutDuration()
+	var deadline = time.Now().Add(timeout)
+	var isListenersReady bool
+	var isAPIConnected bool
+	for time.Now().Before(deadline) {
+		isListenersReady = sharedListenerManager.IsReady()
+		isAPIConnected = sharedAPIStream.IsConnected()
+		if isListenersReady && isAPIConnected {
+			err = os.Remove(upgradeStateFile())
+			if err != nil && !os.IsNotExist(err) {
+				remotelogs.Error("UPGRADE_MANAGER", "remove upgrade state failed: "+err.Error())
+			}
+			remotelogs.Println("UPGRADE_MANAGER", "upgrade from v"+state.FromVersion+" to v"+state.ToVersion+" successfully")
+			return
+		}
+		time.Sleep(1 * time.Second)
+	}
+
+	var reason = "health check timeout after " + timeout.String() + ":"
+	if !isListenersReady {
+		reason += " listeners are not ready;"
+	}
+	if !isAPIConnected {
+		reason += " api stream is not connected;"
+	}
+	this.rollback(state, reason)
+}
+
+// 回滚到升级前的版本
+func (this *UpgradeManager) rollback(state *UpgradeState, reason string) {
+	remotelogs.Error("UPGRADE_MANAGER", "upgrade from v"+state.FromVersion+" to v"+state.ToVersion+" failed: "+reason+", rolling back ...")
+
+	var previousDir = upgradeVersionsDir() + "/" + state.FromVersion
+	_, err := os.Stat(previousDir + "/bin/" + teaconst.ProcessName)
+	if err != nil {
+		remotelogs.Error("UPGRADE_MANAGER", "rollback failed: can not find previous version: "+err.Error())
+		return
+	}
+
+	// 还原备份的所有文件
+	err = copyUpgradeDir(previousDir, upgradeRootDir())
+	if err != nil {
+		remotelogs.Error("UPGRADE_MANAGER", "rollback failed: "+err.Error())
+		return
+	}
+
+	state.Status = UpgradeStatusRolledBack
+	state.Reason = reason
+	err = state.Save()
+	if err != nil {
+		remotelogs.Error("UPGRADE_MANAGER", "save upgrade state failed: "+err.Error())
+	}
+
+	// 测试环境下不重启
+	if Tea.IsTesting() {
+		return
+	}
+
+	remotelogs.Println("UPGRADE_MANAGER", "restarting with v"+state.FromVersion+" ...")
+	err = this.restart()
+	if err != nil {
+		remotelogs.Error("UPGRADE_MANAGER", "restart failed: "+err.Error())
+	}
+}
+
+// 检查某个版本是否曾经升级失败
+func (this *UpgradeManager) isRolledBackVersion(version string) bool {
+	state, err := loadUpgradeState()
+	if err != nil || state == nil {
+		return false
+	}
+	return state.Status == UpgradeStatusRolledBack && state.ToVersion == version
+}
+
+// 等待API连接成功
+func (this *UpgradeManager) waitForAPIConnected(timeout time.Duration) {
+	var deadline = time.Now().Add(timeout)
+	for !sharedAPIStream.IsConnected() && time.Now().Before(deadline) {
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// 将升级包解压到版本目录中
+func (this *UpgradeManager) stage(zipPath string, version string) (stageDir string, err error) {
+	if !upgradeVersionReg.MatchString(version) {
+		return "", errors.New("invalid version '" + version + "'")
+	}
+
+	stageDir = upgradeVersionsDir() + "/" + version
+	err = os.RemoveAll(stageDir)
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(stageDir, 0777)
+	if err != nil {
+		return "", err
+	}
+
+	var unzip = utils.NewUnzip(zipPath, stageDir, "edge-node/")
+	err = unzip.Run()
+	if err != nil {
+		_ = os.RemoveAll(stageDir)
+		return "", err
+	}
+
+	_, err = os.Stat(stageDir + "/bin/" + teaconst.ProcessName)
+	if err != nil {
+		_ = os.RemoveAll(stageDir)
+		return "", errors.New("invalid package: " + err.Error())
+	}
+
+	return stageDir, nil
+}
+
+// 备份当前版本中会被升级包覆盖的所有文件，用于回滚
+func (this *UpgradeManager) backupCurrent(stageDir string) error {
+	var rootDir = upgradeRootDir()
+	var backupDir = upgradeVersionsDir() + "/" + teaconst.Version
+	return filepath.WalkDir(stageDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(stageDir, path)
+		if err != nil {
+			return err
+		}
+
+		// 已经备份过，比如当前版本也是通过升级安装的
+		var backupFile = filepath.Join(backupDir, relPath)
+		_, err = os.Stat(backupFile)
+		if err == nil {
+			return nil
+		}
+
+		// 升级包中新增的文件不需要备份
+		var currentFile = filepath.Join(rootDir, relPath)
+		_, err = os.Stat(currentFile)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		err = os.MkdirAll(filepath.Dir(backupFile), 0777)
+		if err != nil {
+			return err
+		}
+		return copyUpgradeFile(currentFile, backupFile)
+	})
+}
+
+// 清理多余的历史版本
+func (this *UpgradeManager) cleanVersions(keepVersions int, newVersion string) {
+	entries, err := os.ReadDir(upgradeVersionsDir())
+	if err != nil {
+		return
+	}
+
+	var versions = []string{}
+	for _, entry := range entries {
+		var version = entry.Name()
+		if entry.IsDir() && version != newVersion && version != teaconst.Version {
+			versions = append(versions, version)
+		}
+	}
+
+	// 当前版本总是保留，用于回滚
+	keepVersions--
+	if len(versions) <= keepVersions {
+		return
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return stringutil.VersionCompare(versions[i], versions[j]) > 0
+	})
+	if keepVersions < 0 {
+		keepVersions = 0
+	}
+	for _, version := range versions[keepVersions:] {
+		_ = os.RemoveAll(upgradeVersionsDir() + "/" + version)
+	}
+}
+
+// 升级安装的根目录
+func upgradeRootDir() string {
+	if Tea.IsTesting() {
+		// 测试环境下只安装在tmp目录
+		return Tea.Root + "/tmp"
+	}
+	return Tea.Root
+}
+
+// 版本目录
+func upgradeVersionsDir() string {
+	return upgradeRootDir() + "/versions"
+}
+
+// 升级状态文件
+func upgradeStateFile() string {
+	return upgradeVersionsDir() + "/upgrade.json"
+}
+
+// 复制目录中的所有文件
+func copyUpgradeDir(srcDir string, dstDir string) error {
+	return filepath.WalkDir(srcDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		var target = filepath.Join(dstDir, relPath)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0777)
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		return copyUpgradeFile(path, target)
+	})
+}
+
+// 复制文件
+// 先写入临时文件再替换，防止正在运行的可执行文件被破坏
+func copyUpgradeFile(src string, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = srcFile.Close()
+	}()
+
+	stat, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	var tmpPath = filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp")
+	dstFile, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, stat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dstFile, srcFile)
+	if err != nil {
+		_ = dstFile.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	err = dstFile.Close()
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	err = os.Rename(tmpPath, dst)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
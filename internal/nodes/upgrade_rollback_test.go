@@ -0,0 +1,222 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpgradeManager_CheckHealth_NoState(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	testUpgradeRoot(t)
+
+	NewUpgradeManager().CheckHealth()
+
+	state, err := loadUpgradeState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsNil(state)
+}
+
+func TestUpgradeManager_CheckHealth_OtherVersion(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	testUpgradeRoot(t)
+
+	var state = &UpgradeState{
+		FromVersion: "0.0.1",
+		ToVersion:   "0.0.2",
+		Status:      UpgradeStatusChecking,
+	}
+	err := state.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 当前运行的不是升级后的版本，不做任何处理
+	NewUpgradeManager().CheckHealth()
+
+	state, err = loadUpgradeState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(state.Status == UpgradeStatusChecking)
+	a.IsTrue(state.CountStarts == 0)
+}
+
+func TestUpgradeManager_CheckHealth_TooManyStarts(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	testUpgradeRoot(t)
+
+	testWriteUpgradeFile(t, upgradeVersionsDir()+"/0.0.1/bin/"+teaconst.ProcessName, "old exe")
+	testWriteUpgradeFile(t, upgradeRootDir()+"/bin/"+teaconst.ProcessName, "new exe")
+
+	var state = &UpgradeState{
+		FromVersion: "0.0.1",
+		ToVersion:   teaconst.Version,
+		Status:      UpgradeStatusChecking,
+		CountStarts: maxUpgradeStarts,
+	}
+	err := state.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	NewUpgradeManager().CheckHealth()
+
+	state, err = loadUpgradeState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(state.Status == UpgradeStatusRolledBack)
+	a.IsTrue(state.CountStarts == maxUpgradeStarts+1)
+	a.IsTrue(len(state.Reason) > 0)
+	a.IsTrue(testReadUpgradeFile(t, upgradeRootDir()+"/bin/"+teaconst.ProcessName) == "old exe")
+}
+
+func TestUpgradeManager_Rollback(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	testUpgradeRoot(t)
+
+	var manager = NewUpgradeManager()
+	var rootDir = upgradeRootDir()
+
+	// 当前版本
+	testWriteUpgradeFile(t, rootDir+"/bin/"+teaconst.ProcessName, "old exe")
+	testWriteUpgradeFile(t, rootDir+"/www/index.html", "old index")
+	testWriteUpgradeFile(t, rootDir+"/configs/api_node.yaml", "api config")
+
+	// 新版本
+	var stageDir = upgradeVersionsDir() + "/99.0.0"
+	testWriteUpgradeFile(t, stageDir+"/bin/"+teaconst.ProcessName, "new exe")
+	testWriteUpgradeFile(t, stageDir+"/www/index.html", "new index")
+	testWriteUpgradeFile(t, stageDir+"/www/new.html", "new file")
+
+	err := manager.backupCurrent(stageDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 只备份会被覆盖的文件
+	var backupDir = upgradeVersionsDir() + "/" + teaconst.Version
+	a.IsTrue(testReadUpgradeFile(t, backupDir+"/bin/"+teaconst.ProcessName) == "old exe")
+	a.IsTrue(testReadUpgradeFile(t, backupDir+"/www/index.html") == "old index")
+	_, err = os.Stat(backupDir + "/www/new.html")
+	a.IsTrue(os.IsNotExist(err))
+	_, err = os.Stat(backupDir + "/configs/api_node.yaml")
+	a.IsTrue(os.IsNotExist(err))
+
+	err = copyUpgradeDir(stageDir, rootDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(testReadUpgradeFile(t, rootDir+"/www/index.html") == "new index")
+
+	var state = &UpgradeState{
+		FromVersion: teaconst.Version,
+		ToVersion:   "99.0.0",
+		Status:      UpgradeStatusChecking,
+	}
+	manager.rollback(state, "test")
+
+	a.IsTrue(state.Status == UpgradeStatusRolledBack)
+	a.IsTrue(state.Reason == "test")
+	a.IsTrue(testReadUpgradeFile(t, rootDir+"/bin/"+teaconst.ProcessName) == "old exe")
+	a.IsTrue(testReadUpgradeFile(t, rootDir+"/www/index.html") == "old index")
+	a.IsTrue(testReadUpgradeFile(t, rootDir+"/configs/api_node.yaml") == "api config")
+	a.IsTrue(manager.isRolledBackVersion("99.0.0"))
+	a.IsFalse(manager.isRolledBackVersion(teaconst.Version))
+}
+
+func TestUpgradeManager_Rollback_MissingVersion(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	testUpgradeRoot(t)
+
+	testWriteUpgradeFile(t, upgradeRootDir()+"/bin/"+teaconst.ProcessName, "new exe")
+
+	var state = &UpgradeState{
+		FromVersion: "0.0.1",
+		ToVersion:   teaconst.Version,
+		Status:      UpgradeStatusChecking,
+	}
+	NewUpgradeManager().rollback(state, "test")
+
+	// 找不到之前的版本时保持不变
+	a.IsTrue(state.Status == UpgradeStatusChecking)
+	a.IsTrue(testReadUpgradeFile(t, upgradeRootDir()+"/bin/"+teaconst.ProcessName) == "new exe")
+}
+
+func TestUpgradeManager_CleanVersions(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	testUpgradeRoot(t)
+
+	for _, version := range []string{"0.0.1", "0.0.2", "0.0.10", teaconst.Version, "99.0.0"} {
+		err := os.MkdirAll(upgradeVersionsDir()+"/"+version, 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	testWriteUpgradeFile(t, upgradeStateFile(), "{}")
+
+	NewUpgradeManager().cleanVersions(2, "99.0.0")
+
+	entries, err := os.ReadDir(upgradeVersionsDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names = []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	t.Log(names)
+
+	// 保留新版本、当前版本以及一个最新的历史版本
+	for _, version := range []string{"0.0.10", teaconst.Version, "99.0.0"} {
+		_, err = os.Stat(upgradeVersionsDir() + "/" + version)
+		a.IsNil(err)
+	}
+	for _, version := range []string{"0.0.1", "0.0.2"} {
+		_, err = os.Stat(upgradeVersionsDir() + "/" + version)
+		a.IsTrue(os.IsNotExist(err))
+	}
+	_, err = os.Stat(upgradeStateFile())
+	a.IsNil(err)
+}
+
+// 使用临时目录作为安装目录
+func testUpgradeRoot(t *testing.T) {
+	var oldRoot = Tea.Root
+	Tea.UpdateRoot(t.TempDir())
+	t.Cleanup(func() {
+		Tea.UpdateRoot(oldRoot)
+	})
+
+	err := os.MkdirAll(upgradeVersionsDir(), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testWriteUpgradeFile(t *testing.T, path string, data string) {
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, []byte(data), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testReadUpgradeFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
+	"github.com/iwind/TeaGo/types"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+)
+
+// 签名文件最大尺寸
+const maxUpgradeSignatureSize = 4 << 10
+
+// 签名内容的第一行，用来区分签名格式
+const upgradeSignatureHeader = "edge-node-upgrade-v1"
+
+// 校验升级包签名
+// 没有设置公钥时不校验
+func verifyUpgradeSignature(config *configs.UpgradeConfig, zipPath string, filename string, version string) error {
+	if !config.RequireSignature() {
+		return nil
+	}
+
+	signature, err := downloadUpgradeSignature(config.ComposeSignatureURL(filename, version, runtime.GOOS, runtime.GOARCH))
+	if err != nil {
+		return errors.New("download signature failed: " + err.Error())
+	}
+
+	return verifyUpgradeSignatureFile(config.Ed25519PublicKey(), zipPath, version, runtime.GOOS, runtime.GOARCH, signature)
+}
+
+// 使用公钥校验文件签名
+// 签名的内容中包含版本号、系统、架构和升级包的SHA256，防止旧版本的升级包被标记为新版本安装
+func verifyUpgradeSignatureFile(publicKey ed25519.PublicKey, path string, version string, goos string, goarch string, signature []byte) error {
+	fp, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+
+	var hash = sha256.New()
+	_, err = io.Copy(hash, fp)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(publicKey, composeUpgradeSignatureMessage(version, goos, goarch, hash.Sum(nil)), signature) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// 构造需要签名的内容，发布升级包时使用私钥对此内容签名：
+//
+//	edge-node-upgrade-v1
+//	version: 1.3.0
+//	os: linux
+//	arch: amd64
+//	sha256: HEX格式的升级包SHA256
+func composeUpgradeSignatureMessage(version string, goos string, goarch string, sum []byte) []byte {
+	return []byte(upgradeSignatureHeader + "\n" +
+		"version: " + version + "\n" +
+		"os: " + goos + "\n" +
+		"arch: " + goarch + "\n" +
+		"sha256: " + hex.EncodeToString(sum) + "\n")
+}
+
+// 下载签名
+func downloadUpgradeSignature(signatureURL string) ([]byte, error) {
+	var client = &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	req, err := http.NewRequest(http.MethodGet, signatureURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", teaconst.ProcessName+"/"+teaconst.Version)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("invalid response status code '" + types.String(resp.StatusCode) + "'")
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxUpgradeSignatureSize))
+	if err != nil {
+		return nil, err
+	}
+	return decodeUpgradeSignature(data)
+}
+
+// 解析签名，支持原始数据、Base64和HEX格式
+func decodeUpgradeSignature(data []byte) ([]byte, error) {
+	if len(data) == ed25519.SignatureSize {
+		return data, nil
+	}
+
+	signature, err := configs.DecodeUpgradeKey(string(data))
+	if err != nil {
+		return nil, errors.New("invalid signature: " + err.Error())
+	}
+	if len(signature) != ed25519.SignatureSize {
+		return nil, errors.New("invalid signature: the size of ed25519 signature should be 64 bytes")
+	}
+	return signature, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/iwind/TeaGo/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpgradeSignature_Verify(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var path = filepath.Join(t.TempDir(), "edge-node.zip")
+	err = os.WriteFile(path, []byte("package data"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sum = sha256.Sum256([]byte("package data"))
+	var signature = ed25519.Sign(privateKey, composeUpgradeSignatureMessage("1.3.0", "linux", "amd64", sum[:]))
+	for _, data := range [][]byte{
+		signature,
+		[]byte(base64.StdEncoding.EncodeToString(signature) + "\n"),
+		[]byte(hex.EncodeToString(signature)),
+	} {
+		decodedSignature, err := decodeUpgradeSignature(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsNil(verifyUpgradeSignatureFile(publicKey, path, "1.3.0", "linux", "amd64", decodedSignature))
+	}
+
+	_, err = decodeUpgradeSignature([]byte("abc"))
+	a.IsNotNil(err)
+
+	// 版本号、系统或架构和签名内容不一致
+	a.IsTrue(verifyUpgradeSignatureFile(publicKey, path, "1.4.0", "linux", "amd64", signature) != nil)
+	a.IsTrue(verifyUpgradeSignatureFile(publicKey, path, "1.3.0", "darwin", "amd64", signature) != nil)
+	a.IsTrue(verifyUpgradeSignatureFile(publicKey, path, "1.3.0", "linux", "arm64", signature) != nil)
+
+	// 只对升级包签名的旧格式不再被接受
+	a.IsTrue(verifyUpgradeSignatureFile(publicKey, path, "1.3.0", "linux", "amd64", ed25519.Sign(privateKey, []byte("package data"))) != nil)
+
+	// 文件被修改
+	err = os.WriteFile(path, []byte("package data2"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(verifyUpgradeSignatureFile(publicKey, path, "1.3.0", "linux", "amd64", signature) != nil)
+}
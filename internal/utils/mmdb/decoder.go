@@ -0,0 +1,229 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package mmdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+)
+
+// 数据类型
+const (
+	dataTypeExtended  = 0
+	dataTypePointer   = 1
+	dataTypeString    = 2
+	dataTypeDouble    = 3
+	dataTypeBytes     = 4
+	dataTypeUint16    = 5
+	dataTypeUint32    = 6
+	dataTypeMap       = 7
+	dataTypeInt32     = 8
+	dataTypeUint64    = 9
+	dataTypeUint128   = 10
+	dataTypeArray     = 11
+	dataTypeContainer = 12
+	dataTypeEndMarker = 13
+	dataTypeBool      = 14
+	dataTypeFloat     = 15
+)
+
+// 防止恶意文件中的指针互相引用导致死循环
+const maxDecodeDepth = 64
+
+var errInvalidData = errors.New("invalid data in MaxMind DB file")
+
+// 数据区解码器
+// 解码后的数据类型：string、float64、float32、[]byte、uint64、int64、*big.Int、bool、map[string]any、[]any
+type decoder struct {
+	buffer []byte
+}
+
+// 解码某个位置的数据，返回数据和下一个数据的位置
+func (this *decoder) decode(offset uint) (value any, nextOffset uint, err error) {
+	return this.decodeDepth(offset, 0)
+}
+
+func (this *decoder) decodeDepth(offset uint, depth int) (value any, nextOffset uint, err error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, errInvalidData
+	}
+
+	dataType, size, offset, err := this.decodeControl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if dataType == dataTypePointer {
+		pointer, nextOffset, err := this.decodePointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err = this.decodeDepth(pointer, depth+1)
+		return value, nextOffset, err
+	}
+
+	return this.decodeValue(dataType, size, offset, depth)
+}
+
+// 解析控制字节，返回数据类型、尺寸和数据开始的位置
+func (this *decoder) decodeControl(offset uint) (dataType int, size uint, newOffset uint, err error) {
+	if offset >= uint(len(this.buffer)) {
+		return 0, 0, 0, errInvalidData
+	}
+	var ctrl = this.buffer[offset]
+	offset++
+
+	dataType = int(ctrl >> 5)
+	if dataType == dataTypeExtended {
+		if offset >= uint(len(this.buffer)) {
+			return 0, 0, 0, errInvalidData
+		}
+		dataType = int(this.buffer[offset]) + 7
+		offset++
+	}
+
+	size = uint(ctrl & 0x1F)
+
+	// 指针使用单独的尺寸格式
+	if dataType == dataTypePointer {
+		return dataType, size, offset, nil
+	}
+
+	if size >= 29 {
+		var bytesToRead = size - 28
+		if offset+bytesToRead > uint(len(this.buffer)) {
+			return 0, 0, 0, errInvalidData
+		}
+		var extra = this.readUint(this.buffer[offset : offset+bytesToRead])
+		offset += bytesToRead
+		switch size {
+		case 29:
+			size = 29 + uint(extra)
+		case 30:
+			size = 285 + uint(extra)
+		default:
+			size = 65821 + uint(extra)
+		}
+	}
+
+	return dataType, size, offset, nil
+}
+
+func (this *decoder) decodePointer(size uint, offset uint) (pointer uint, nextOffset uint, err error) {
+	var pointerSize = ((size >> 3) & 0x3) + 1
+	if offset+pointerSize > uint(len(this.buffer)) {
+		return 0, 0, errInvalidData
+	}
+	var b = this.buffer[offset : offset+pointerSize]
+	nextOffset = offset + pointerSize
+
+	switch pointerSize {
+	case 1:
+		pointer = (size&0x7)<<8 | uint(b[0])
+	case 2:
+		pointer = ((size&0x7)<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+	case 3:
+		pointer = ((size&0x7)<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+	default:
+		pointer = uint(binary.BigEndian.Uint32(b))
+	}
+	return pointer, nextOffset, nil
+}
+
+func (this *decoder) decodeValue(dataType int, size uint, offset uint, depth int) (value any, nextOffset uint, err error) {
+	var bufferLen = uint(len(this.buffer))
+
+	// 每个元素至少占用一个字节，防止错误的尺寸导致分配过多的内存
+	if (dataType == dataTypeMap || dataType == dataTypeArray) && (offset > bufferLen || size > bufferLen-offset) {
+		return nil, 0, errInvalidData
+	}
+
+	switch dataType {
+	case dataTypeMap:
+		var m = make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, keyOffset, err := this.decodeDepth(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, 0, errInvalidData
+			}
+			value, valueOffset, err := this.decodeDepth(keyOffset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[keyString] = value
+			offset = valueOffset
+		}
+		return m, offset, nil
+	case dataTypeArray:
+		var a = make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, valueOffset, err := this.decodeDepth(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = valueOffset
+		}
+		return a, offset, nil
+	case dataTypeBool:
+		return size != 0, offset, nil
+	case dataTypeContainer, dataTypeEndMarker:
+		return nil, offset, nil
+	}
+
+	if offset+size > bufferLen {
+		return nil, 0, errInvalidData
+	}
+	var b = this.buffer[offset : offset+size]
+	nextOffset = offset + size
+
+	switch dataType {
+	case dataTypeString:
+		return string(b), nextOffset, nil
+	case dataTypeDouble:
+		if size != 8 {
+			return nil, 0, errInvalidData
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nextOffset, nil
+	case dataTypeFloat:
+		if size != 4 {
+			return nil, 0, errInvalidData
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), nextOffset, nil
+	case dataTypeBytes:
+		var result = make([]byte, size)
+		copy(result, b)
+		return result, nextOffset, nil
+	case dataTypeUint16, dataTypeUint32, dataTypeUint64:
+		if size > 8 {
+			return nil, 0, errInvalidData
+		}
+		return this.readUint(b), nextOffset, nil
+	case dataTypeInt32:
+		if size > 4 {
+			return nil, 0, errInvalidData
+		}
+		return int64(int32(this.readUint(b))), nextOffset, nil
+	case dataTypeUint128:
+		if size > 16 {
+			return nil, 0, errInvalidData
+		}
+		return new(big.Int).SetBytes(b), nextOffset, nil
+	}
+
+	return nil, 0, errInvalidData
+}
+
+func (this *decoder) readUint(b []byte) uint64 {
+	var result uint64
+	for _, c := range b {
+		result = result<<8 | uint64(c)
+	}
+	return result
+}
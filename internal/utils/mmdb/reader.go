@@ -0,0 +1,252 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package mmdb
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+)
+
+// 元数据开始标记
+var metadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// 元数据最多在文件最后128KiB中
+const metadataMaxSize = 128 * 1024
+
+// 数据区和搜索树之间的分隔字节数
+const dataSectionSeparatorSize = 16
+
+var ErrInvalidDatabase = errors.New("invalid MaxMind DB file")
+
+// Metadata 数据库元数据
+type Metadata struct {
+	DatabaseType string
+	Description  map[string]string
+	Languages    []string
+	IPVersion    uint
+	NodeCount    uint
+	RecordSize   uint
+	BuildEpoch   uint64
+}
+
+// Reader MaxMind DB（MMDB）文件读取器
+// 文件格式参考：https://maxmind.github.io/MaxMind-DB/
+type Reader struct {
+	buffer   []byte
+	metadata *Metadata
+
+	treeSize        uint
+	decoder         *decoder
+	ipv4Start       uint
+	ipv4StartBitLen int
+}
+
+// Open 打开文件，文件内容会全部读取到内存中
+func Open(path string) (*Reader, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(data)
+}
+
+// NewReader 从内存中的数据创建读取器
+func NewReader(buffer []byte) (*Reader, error) {
+	var searchFrom = 0
+	if len(buffer) > metadataMaxSize {
+		searchFrom = len(buffer) - metadataMaxSize
+	}
+	var markerIndex = bytes.LastIndex(buffer[searchFrom:], metadataStartMarker)
+	if markerIndex < 0 {
+		return nil, ErrInvalidDatabase
+	}
+	var metadataStart = searchFrom + markerIndex + len(metadataStartMarker)
+
+	var metadataDecoder = &decoder{buffer: buffer[metadataStart:]}
+	metadataValue, _, err := metadataDecoder.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	metadataMap, ok := metadataValue.(map[string]any)
+	if !ok {
+		return nil, ErrInvalidDatabase
+	}
+	var metadata = parseMetadata(metadataMap)
+	if metadata.NodeCount == 0 {
+		return nil, ErrInvalidDatabase
+	}
+	switch metadata.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, errors.New("unsupported record size in MaxMind DB file")
+	}
+
+	var treeSize = metadata.NodeCount * metadata.RecordSize / 4
+	var dataStart = treeSize + dataSectionSeparatorSize
+	if dataStart > uint(metadataStart-len(metadataStartMarker)) {
+		return nil, ErrInvalidDatabase
+	}
+
+	var reader = &Reader{
+		buffer:   buffer,
+		metadata: metadata,
+		treeSize: treeSize,
+		decoder: &decoder{
+			buffer: buffer[dataStart : metadataStart-len(metadataStartMarker)],
+		},
+	}
+
+	// IPv4地址在IPv6数据库中位于 ::/96
+	if metadata.IPVersion == 6 {
+		var node uint
+		var i = 0
+		for ; i < 96 && node < metadata.NodeCount; i++ {
+			node, err = reader.readRecord(node, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+		reader.ipv4Start = node
+		reader.ipv4StartBitLen = i
+	}
+
+	return reader, nil
+}
+
+// Metadata 元数据
+func (this *Reader) Metadata() *Metadata {
+	return this.metadata
+}
+
+// Lookup 查找IP对应的数据，如果找不到则返回nil
+func (this *Reader) Lookup(ip net.IP) (map[string]any, error) {
+	value, err := this.LookupValue(ip)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	result, ok := value.(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// LookupValue 查找IP对应的原始数据，如果找不到则返回nil
+func (this *Reader) LookupValue(ip net.IP) (any, error) {
+	if ip == nil {
+		return nil, errors.New("invalid ip")
+	}
+
+	var ipv4 = ip.To4()
+	var node uint
+	var bitLen int
+	if ipv4 != nil {
+		ip = ipv4
+		if this.metadata.IPVersion == 6 {
+			node = this.ipv4Start
+		}
+		bitLen = 32
+	} else {
+		if this.metadata.IPVersion == 4 {
+			return nil, nil
+		}
+		ip = ip.To16()
+		bitLen = 128
+	}
+
+	var nodeCount = this.metadata.NodeCount
+	var err error
+	for i := 0; i < bitLen && node < nodeCount; i++ {
+		var bit = uint(ip[i>>3]>>(7-(i&7))) & 1
+		node, err = this.readRecord(node, bit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if node == nodeCount {
+		return nil, nil
+	}
+	if node < nodeCount {
+		return nil, ErrInvalidDatabase
+	}
+
+	var offset = node - nodeCount - dataSectionSeparatorSize
+	value, _, err := this.decoder.decode(offset)
+	return value, err
+}
+
+// 读取某个节点的左（0）或者右（1）记录
+func (this *Reader) readRecord(node uint, bit uint) (uint, error) {
+	var recordSize = this.metadata.RecordSize
+	var nodeBytes = recordSize / 4
+	var offset = node * nodeBytes
+	if offset+nodeBytes > this.treeSize {
+		return 0, ErrInvalidDatabase
+	}
+	var b = this.buffer[offset : offset+nodeBytes]
+
+	switch recordSize {
+	case 24:
+		if bit == 0 {
+			return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3])<<16 | uint(b[4])<<8 | uint(b[5]), nil
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6]), nil
+	default: // 32
+		if bit == 0 {
+			return uint(b[0])<<24 | uint(b[1])<<16 | uint(b[2])<<8 | uint(b[3]), nil
+		}
+		return uint(b[4])<<24 | uint(b[5])<<16 | uint(b[6])<<8 | uint(b[7]), nil
+	}
+}
+
+func parseMetadata(m map[string]any) *Metadata {
+	var metadata = &Metadata{
+		Description: map[string]string{},
+	}
+	metadata.DatabaseType, _ = m["database_type"].(string)
+	metadata.IPVersion = uint(toUint64(m["ip_version"]))
+	metadata.NodeCount = uint(toUint64(m["node_count"]))
+	metadata.RecordSize = uint(toUint64(m["record_size"]))
+	metadata.BuildEpoch = toUint64(m["build_epoch"])
+
+	languages, ok := m["languages"].([]any)
+	if ok {
+		for _, language := range languages {
+			languageString, ok := language.(string)
+			if ok {
+				metadata.Languages = append(metadata.Languages, languageString)
+			}
+		}
+	}
+
+	description, ok := m["description"].(map[string]any)
+	if ok {
+		for k, v := range description {
+			s, ok := v.(string)
+			if ok {
+				metadata.Description[k] = s
+			}
+		}
+	}
+	return metadata
+}
+
+func toUint64(v any) uint64 {
+	switch value := v.(type) {
+	case uint64:
+		return value
+	case int64:
+		if value > 0 {
+			return uint64(value)
+		}
+	}
+	return 0
+}
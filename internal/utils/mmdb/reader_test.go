@@ -0,0 +1,114 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package mmdb_test
+
+import (
+	"bytes"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/mmdb"
+	"github.com/iwind/TeaGo/assert"
+	"net"
+	"testing"
+)
+
+func TestReader_Lookup(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	reader, err := mmdb.NewReader(buildTestDatabase())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var metadata = reader.Metadata()
+	a.IsTrue(metadata.DatabaseType == "Test-ASN")
+	a.IsTrue(metadata.NodeCount == 2)
+	a.IsTrue(metadata.IPVersion == 4)
+	a.IsTrue(len(metadata.Languages) == 1 && metadata.Languages[0] == "en")
+
+	{
+		result, err := reader.Lookup(net.ParseIP("64.1.2.3"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsNotNil(result)
+		a.IsTrue(result["autonomous_system_number"] == uint64(13335))
+		a.IsTrue(result["autonomous_system_organization"] == "Cloudflare")
+		a.IsTrue(result["is_anycast"] == true)
+	}
+
+	for _, ip := range []string{"1.2.3.4", "128.0.0.1", "::1"} {
+		result, err := reader.Lookup(net.ParseIP(ip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsNil(result)
+	}
+}
+
+func TestReader_Invalid(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	_, err := mmdb.NewReader([]byte("hello, world"))
+	a.IsNotNil(err)
+
+	// 截断元数据
+	var data = buildTestDatabase()
+	_, err = mmdb.NewReader(data[:len(data)-1])
+	a.IsNotNil(err)
+
+	// 元素数量超过剩余的数据
+	for _, ctrl := range [][]byte{
+		{7<<5 | 31, 0xFF, 0xFF, 0xFF},  // map
+		{31, 11 - 7, 0xFF, 0xFF, 0xFF}, // array
+	} {
+		_, err = mmdb.NewReader(append([]byte("\xAB\xCD\xEFMaxMind.com"), ctrl...))
+		a.IsNotNil(err)
+	}
+}
+
+// 构造一个仅包含 64.0.0.0/2 的IPv4测试数据库
+func buildTestDatabase() []byte {
+	const nodeCount = 2
+
+	var buf = &bytes.Buffer{}
+
+	// 搜索树：node0 -> (node1, empty)，node1 -> (empty, data)
+	var dataRecord = nodeCount + 16 + len(encodeString("Cloudflare"))
+	for _, record := range []int{1, nodeCount, nodeCount, dataRecord} {
+		buf.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+	}
+	buf.Write(make([]byte, 16))
+
+	// 数据区：字符串 + 引用该字符串的map
+	buf.Write(encodeString("Cloudflare"))
+	buf.Write([]byte{7<<5 | 3})
+	buf.Write(encodeString("autonomous_system_number"))
+	buf.Write([]byte{6<<5 | 2, 0x34, 0x17})
+	buf.Write(encodeString("autonomous_system_organization"))
+	buf.Write([]byte{1 << 5, 0}) // pointer -> 0
+	buf.Write(encodeString("is_anycast"))
+	buf.Write([]byte{1, 14 - 7}) // bool true
+
+	// 元数据
+	buf.WriteString("\xAB\xCD\xEFMaxMind.com")
+	buf.Write([]byte{7<<5 | 5})
+	buf.Write(encodeString("database_type"))
+	buf.Write(encodeString("Test-ASN"))
+	buf.Write(encodeString("node_count"))
+	buf.Write([]byte{6<<5 | 1, nodeCount})
+	buf.Write(encodeString("record_size"))
+	buf.Write([]byte{5<<5 | 1, 24})
+	buf.Write(encodeString("ip_version"))
+	buf.Write([]byte{5<<5 | 1, 4})
+	buf.Write(encodeString("languages"))
+	buf.Write([]byte{1, 11 - 7}) // array
+	buf.Write(encodeString("en"))
+
+	return buf.Bytes()
+}
+
+func encodeString(s string) []byte {
+	if len(s) >= 29 {
+		return append([]byte{2<<5 | 29, byte(len(s) - 29)}, s...)
+	}
+	return append([]byte{byte(2<<5 | len(s))}, s...)
+}
@@ -0,0 +1,190 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package ratelimit
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/goman"
+	syncutils "github.com/TeaOSLab/EdgeNode/internal/utils/sync"
+	"github.com/cespare/xxhash/v2"
+	"math"
+	"sync"
+	"time"
+)
+
+const tokenBucketsMaxItemsPerGroup = 100_000
+
+// TokenBucketResult 获取令牌的结果
+type TokenBucketResult struct {
+	OK        bool          // 是否允许
+	Delay     time.Duration // 允许时需要延迟的时间，只有允许延迟时才会大于0
+	RetryIn   time.Duration // 不允许时，多久后可以重试
+	Remaining int           // 剩余令牌数
+	ResetIn   time.Duration // 多久后令牌桶会重新装满
+}
+
+type tokenBucket struct {
+	tokens    float64 // 剩余令牌数，允许延迟时可能为负值
+	updatedAt int64   // 纳秒
+	fullAt    int64   // 令牌桶装满的时间，纳秒
+}
+
+// TokenBuckets 按键值区分的令牌桶集合
+type TokenBuckets struct {
+	countMaps uint64
+	locker    *syncutils.RWMutex
+	itemMaps  []map[uint64]*tokenBucket
+
+	gcTicker *time.Ticker
+	gcIndex  int
+	gcLocker sync.Mutex
+}
+
+// NewTokenBuckets 获取新对象
+func NewTokenBuckets() *TokenBuckets {
+	const count = 64
+
+	var itemMaps = []map[uint64]*tokenBucket{}
+	for i := 0; i < count; i++ {
+		itemMaps = append(itemMaps, map[uint64]*tokenBucket{})
+	}
+
+	return &TokenBuckets{
+		countMaps: count,
+		locker:    syncutils.NewRWMutex(count),
+		itemMaps:  itemMaps,
+	}
+}
+
+// WithGC 自动清理已经装满的令牌桶
+func (this *TokenBuckets) WithGC() *TokenBuckets {
+	if this.gcTicker != nil {
+		return this
+	}
+	this.gcTicker = time.NewTicker(1 * time.Second)
+	goman.New(func() {
+		for range this.gcTicker.C {
+			this.GC()
+		}
+	})
+	return this
+}
+
+// Take 获取一个令牌
+// rate 每秒生成的令牌数；burst 令牌桶容量；maxDelay 允许的最大延迟时间，为0时表示不延迟，令牌不足时直接拒绝
+func (this *TokenBuckets) Take(key uint64, rate float64, burst int, maxDelay time.Duration) (result TokenBucketResult) {
+	return this.TakeN(key, 1, rate, burst, maxDelay)
+}
+
+// TakeN 一次获取多个令牌，比如按字节数限制带宽
+// 需要的令牌数超过令牌桶容量时，以需要的令牌数作为容量
+func (this *TokenBuckets) TakeN(key uint64, n int, rate float64, burst int, maxDelay time.Duration) (result TokenBucketResult) {
+	if rate <= 0 {
+		result.OK = true
+		return
+	}
+	if n <= 0 {
+		n = 1
+	}
+	if burst < n {
+		burst = n
+	}
+
+	var now = time.Now().UnixNano()
+	var index = int(key % this.countMaps)
+
+	this.locker.Lock(index)
+	var bucket = this.itemMaps[index][key]
+	if bucket == nil {
+		bucket = &tokenBucket{
+			tokens:    float64(burst),
+			updatedAt: now,
+		}
+		this.itemMaps[index][key] = bucket
+	} else if now > bucket.updatedAt {
+		bucket.tokens = math.Min(float64(burst), bucket.tokens+float64(now-bucket.updatedAt)/1e9*rate)
+		bucket.updatedAt = now
+	}
+
+	var tokens = float64(n)
+	if bucket.tokens >= tokens {
+		bucket.tokens -= tokens
+		result.OK = true
+	} else if maxDelay > 0 {
+		// 漏桶：排队等待下一个令牌
+		var delay = time.Duration((tokens - bucket.tokens) / rate * 1e9)
+		if delay <= maxDelay {
+			bucket.tokens -= tokens
+			result.OK = true
+			result.Delay = delay
+		} else {
+			result.RetryIn = delay - maxDelay
+		}
+	} else {
+		result.RetryIn = time.Duration((tokens - bucket.tokens) / rate * 1e9)
+	}
+
+	var remainingTokens = bucket.tokens
+	result.ResetIn = time.Duration((float64(burst) - remainingTokens) / rate * 1e9)
+	bucket.fullAt = now + int64(result.ResetIn)
+	this.locker.Unlock(index)
+
+	if remainingTokens > 0 {
+		result.Remaining = int(remainingTokens)
+	}
+	return
+}
+
+// TakeKey 使用字符串键值获取一个令牌
+func (this *TokenBuckets) TakeKey(key string, rate float64, burst int, maxDelay time.Duration) TokenBucketResult {
+	return this.Take(xxhash.Sum64String(key), rate, burst, maxDelay)
+}
+
+// TakeKeyN 使用字符串键值一次获取多个令牌
+func (this *TokenBuckets) TakeKeyN(key string, n int, rate float64, burst int, maxDelay time.Duration) TokenBucketResult {
+	return this.TakeN(xxhash.Sum64String(key), n, rate, burst, maxDelay)
+}
+
+// Len 令牌桶数量
+func (this *TokenBuckets) Len() int {
+	var total = 0
+	for i := 0; i < int(this.countMaps); i++ {
+		this.locker.RLock(i)
+		total += len(this.itemMaps[i])
+		this.locker.RUnlock(i)
+	}
+	return total
+}
+
+// GC 清理已经装满的令牌桶，每次只清理一个分组
+func (this *TokenBuckets) GC() {
+	this.gcLocker.Lock()
+	var gcIndex = this.gcIndex
+	this.gcIndex++
+	if this.gcIndex >= int(this.countMaps) {
+		this.gcIndex = 0
+	}
+	this.gcLocker.Unlock()
+
+	var now = time.Now().UnixNano()
+
+	this.locker.Lock(gcIndex)
+	var itemMap = this.itemMaps[gcIndex]
+	for key, bucket := range itemMap {
+		if bucket.fullAt <= now {
+			delete(itemMap, key)
+		}
+	}
+
+	// 防止数量过多
+	var count = len(itemMap) - tokenBucketsMaxItemsPerGroup
+	if count > 0 {
+		for key := range itemMap {
+			delete(itemMap, key)
+			count--
+			if count <= 0 {
+				break
+			}
+		}
+	}
+	this.locker.Unlock(gcIndex)
+}
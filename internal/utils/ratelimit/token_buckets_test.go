@@ -0,0 +1,121 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package ratelimit_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/utils/ratelimit"
+	"github.com/iwind/TeaGo/assert"
+	"github.com/iwind/TeaGo/types"
+	"testing"
+	"time"
+)
+
+func TestTokenBuckets_Take(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var buckets = ratelimit.NewTokenBuckets()
+
+	// burst
+	for i := 0; i < 5; i++ {
+		var result = buckets.TakeKey("a", 10, 5, 0)
+		a.IsTrue(result.OK)
+		a.IsTrue(result.Remaining == 4-i)
+	}
+
+	// reject
+	{
+		var result = buckets.TakeKey("a", 10, 5, 0)
+		t.Logf("%+v", result)
+		a.IsFalse(result.OK)
+		a.IsTrue(result.RetryIn > 0 && result.RetryIn <= 100*time.Millisecond)
+		a.IsTrue(result.ResetIn > 0 && result.ResetIn <= 500*time.Millisecond)
+	}
+
+	// other key
+	{
+		var result = buckets.TakeKey("b", 10, 5, 0)
+		a.IsTrue(result.OK)
+	}
+
+	// refill
+	time.Sleep(110 * time.Millisecond)
+	{
+		var result = buckets.TakeKey("a", 10, 5, 0)
+		a.IsTrue(result.OK)
+	}
+}
+
+func TestTokenBuckets_Take_Delay(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var buckets = ratelimit.NewTokenBuckets()
+	{
+		var result = buckets.TakeKey("a", 10, 1, 250*time.Millisecond)
+		a.IsTrue(result.OK)
+		a.IsTrue(result.Delay == 0)
+	}
+
+	// 排队
+	var lastDelay time.Duration
+	for i := 0; i < 2; i++ {
+		var result = buckets.TakeKey("a", 10, 1, 250*time.Millisecond)
+		t.Logf("%+v", result)
+		a.IsTrue(result.OK)
+		a.IsTrue(result.Delay > lastDelay)
+		lastDelay = result.Delay
+	}
+
+	// 超出最大延迟
+	{
+		var result = buckets.TakeKey("a", 10, 1, 250*time.Millisecond)
+		t.Logf("%+v", result)
+		a.IsFalse(result.OK)
+		a.IsTrue(result.RetryIn > 0)
+	}
+}
+
+func TestTokenBuckets_TakeN(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var buckets = ratelimit.NewTokenBuckets()
+
+	// 1000 bytes/s
+	a.IsTrue(buckets.TakeKeyN("a", 600, 1000, 1000, 0).OK)
+	a.IsTrue(buckets.TakeKeyN("a", 400, 1000, 1000, 0).OK)
+
+	var result = buckets.TakeKeyN("a", 100, 1000, 1000, 0)
+	a.IsFalse(result.OK)
+	a.IsTrue(result.RetryIn > 0 && result.RetryIn <= 100*time.Millisecond)
+
+	// larger than burst
+	a.IsTrue(buckets.TakeKeyN("b", 2000, 1000, 1000, 0).OK)
+	a.IsFalse(buckets.TakeKeyN("b", 1, 1000, 1000, 0).OK)
+}
+
+func TestTokenBuckets_GC(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var buckets = ratelimit.NewTokenBuckets()
+	for i := 0; i < 1000; i++ {
+		buckets.TakeKey(types.String(i), 1000, 1, 0)
+	}
+	a.IsTrue(buckets.Len() == 1000)
+
+	time.Sleep(5 * time.Millisecond)
+	for i := 0; i < 64; i++ {
+		buckets.GC()
+	}
+	a.IsTrue(buckets.Len() == 0)
+}
+
+func BenchmarkTokenBuckets_Take(b *testing.B) {
+	var buckets = ratelimit.NewTokenBuckets()
+
+	b.RunParallel(func(pb *testing.PB) {
+		var i uint64
+		for pb.Next() {
+			i++
+			buckets.Take(i%10000, 100, 10, 0)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package waf
+
+import (
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/compressions"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/maskutils"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/requests"
+	"net/http"
+)
+
+// MaskAction 对响应内容中的敏感数据进行脱敏，只能用于出站规则
+// 动作本身只做标记，由请求在输出响应内容时调用 WrapResponse() 进行流式替换
+type MaskAction struct {
+	BaseAction
+
+	Types    []maskutils.MaskType `yaml:"types" json:"types"`       // 内置数据类型：card、idCard、email
+	Patterns []string             `yaml:"patterns" json:"patterns"` // 自定义正则表达式
+	MaskChar string               `yaml:"maskChar" json:"maskChar"` // 替换用的字符，默认为星号（*）
+
+	masker    *maskutils.Masker
+	isInbound bool
+}
+
+func (this *MaskAction) Init(waf *WAF) error {
+	if this.isInbound {
+		return errors.New("mask action can only be used in outbound rules")
+	}
+
+	masker, err := maskutils.NewMasker(this.Types, this.Patterns, this.MaskChar)
+	if err != nil {
+		return err
+	}
+	this.masker = masker
+	return nil
+}
+
+func (this *MaskAction) Code() string {
+	return ActionMask
+}
+
+func (this *MaskAction) IsAttack() bool {
+	return false
+}
+
+// WillChange determine if the action will change the request
+func (this *MaskAction) WillChange() bool {
+	return false
+}
+
+// Perform the action
+func (this *MaskAction) Perform(waf *WAF, group *RuleGroup, set *RuleSet, request requests.Request, writer http.ResponseWriter) PerformResult {
+	return PerformResult{
+		ContinueRequest: true,
+	}
+}
+
+// WrapResponse 包装响应内容
+// 压缩过的内容会被解压，此时会删除Content-Encoding和Content-Length，由后续的压缩设置决定是否重新压缩；
+// onMask 在内容读取结束并且有替换时调用
+func (this *MaskAction) WrapResponse(resp *http.Response, onMask func(stat map[maskutils.MaskType]int)) bool {
+	if this.masker == nil || resp == nil || resp.Body == nil {
+		return false
+	}
+
+	var contentEncoding = resp.Header.Get("Content-Encoding")
+	if len(contentEncoding) > 0 {
+		if !compressions.SupportEncoding(contentEncoding) {
+			return false
+		}
+		reader, err := compressions.NewReader(resp.Body, contentEncoding)
+		if err != nil {
+			return false
+		}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Body = reader
+	}
+
+	resp.Body = maskutils.NewReader(resp.Body, this.masker, func(stat map[maskutils.MaskType]int) {
+		if len(stat) > 0 && onMask != nil {
+			onMask(stat)
+		}
+	})
+	return true
+}
@@ -0,0 +1,36 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package waf
+
+import (
+	"github.com/iwind/TeaGo/assert"
+	"github.com/iwind/TeaGo/maps"
+	"testing"
+)
+
+func TestMaskAction_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	for _, isInbound := range []bool{true, false} {
+		var set = NewRuleSet()
+		set.AddAction(ActionMask, maps.Map{
+			"types": []string{"email"},
+		})
+
+		var group = NewRuleGroup()
+		group.IsInbound = isInbound
+		group.AddRuleSet(set)
+
+		err := group.Init(NewWAF())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 入站规则中的脱敏动作会被忽略
+		if isInbound {
+			a.IsTrue(len(set.actionInstances) == 0)
+		} else {
+			a.IsTrue(len(set.actionInstances) == 1)
+		}
+	}
+}
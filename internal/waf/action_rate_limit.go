@@ -0,0 +1,147 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package waf
+
+import (
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/ratelimit"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/requests"
+	"github.com/iwind/TeaGo/types"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var rateLimitBuckets = ratelimit.NewTokenBuckets()
+var rateLimitGCOnce = sync.Once{}
+var rateLimitCounter RateLimitCounter = rateLimitBuckets
+
+// RateLimitCounter 限流计数器
+type RateLimitCounter interface {
+	// TakeKey 获取一个令牌
+	// rate 每秒生成的令牌数；burst 令牌桶容量；maxDelay 允许的最大延迟时间
+	TakeKey(key string, rate float64, burst int, maxDelay time.Duration) ratelimit.TokenBucketResult
+}
+
+// SetRateLimitCounter 设置限流计数器，为nil时恢复使用当前节点内存中的令牌桶
+// 当前版本中二级节点（Ln）转发尚未实现，所以默认只在当前节点计数；以后存在上级节点时，可以通过这里替换为经由上级节点共享计数的实现，使集群内计数一致
+// 需要在WAF策略初始化之前调用
+func SetRateLimitCounter(counter RateLimitCounter) {
+	if counter == nil {
+		rateLimitCounter = rateLimitBuckets
+		return
+	}
+	rateLimitCounter = counter
+}
+
+// RateLimitAction 基于令牌桶的限流动作
+// 默认在当前节点内存中计数，参考 SetRateLimitCounter()；二级节点（Ln）转发的请求不再执行WAF，所以同一个请求只会在边缘节点计数一次
+type RateLimitAction struct {
+	BaseAction
+
+	Keys       []string `yaml:"keys" json:"keys"`             // 区分用户的键值，支持变量，比如 ${remoteAddr}、${host}${requestPath}
+	Rate       float64  `yaml:"rate" json:"rate"`             // 每个周期内允许的请求数
+	Period     int      `yaml:"period" json:"period"`         // 周期，单位为秒，默认为1
+	Burst      int      `yaml:"burst" json:"burst"`           // 令牌桶容量，默认和每个周期内允许的请求数相同
+	MaxDelayMs int      `yaml:"maxDelayMs" json:"maxDelayMs"` // 超出速率时最多延迟的时间，单位为毫秒，为0时直接拒绝
+	StatusCode int      `yaml:"statusCode" json:"statusCode"` // 拒绝时的状态码，默认为429
+	Body       string   `yaml:"body" json:"body"`             // 拒绝时的提示内容
+
+	ratePerSecond float64
+	keyPrefix     string
+}
+
+func (this *RateLimitAction) Init(waf *WAF) error {
+	if this.Rate <= 0 {
+		return errors.New("rate should be greater than 0")
+	}
+	if this.Period <= 0 {
+		this.Period = 1
+	}
+	this.ratePerSecond = this.Rate / float64(this.Period)
+
+	if this.Burst <= 0 {
+		this.Burst = int(math.Ceil(this.Rate))
+	}
+	if this.StatusCode <= 0 {
+		this.StatusCode = http.StatusTooManyRequests
+	}
+	if len(this.Keys) == 0 {
+		this.Keys = []string{"${remoteAddr}"}
+	}
+
+	this.keyPrefix = "WAF-RL-" + types.String(waf.Id) + "-"
+
+	rateLimitGCOnce.Do(func() {
+		rateLimitBuckets.WithGC()
+	})
+
+	return nil
+}
+
+func (this *RateLimitAction) Code() string {
+	return ActionRateLimit
+}
+
+func (this *RateLimitAction) IsAttack() bool {
+	return false
+}
+
+// WillChange determine if the action will change the request
+func (this *RateLimitAction) WillChange() bool {
+	return true
+}
+
+// Perform the action
+func (this *RateLimitAction) Perform(waf *WAF, group *RuleGroup, set *RuleSet, request requests.Request, writer http.ResponseWriter) PerformResult {
+	var keyValues = make([]string, 0, len(this.Keys))
+	for _, key := range this.Keys {
+		keyValues = append(keyValues, request.Format(key))
+	}
+	var key = this.keyPrefix + types.String(set.Id) + "-" + strings.Join(keyValues, "@")
+
+	var result = rateLimitCounter.TakeKey(key, this.ratePerSecond, this.Burst, time.Duration(this.MaxDelayMs)*time.Millisecond)
+
+	if writer != nil {
+		var header = writer.Header()
+		header.Set("RateLimit-Limit", types.String(this.Burst))
+		header.Set("RateLimit-Remaining", types.String(result.Remaining))
+		header.Set("RateLimit-Reset", types.String(int64(math.Ceil(result.ResetIn.Seconds()))))
+	}
+
+	if result.OK {
+		// 漏桶模式下延迟处理
+		if result.Delay > 0 {
+			var timer = time.NewTimer(result.Delay)
+			select {
+			case <-timer.C:
+			case <-request.WAFRaw().Context().Done():
+				timer.Stop()
+			}
+		}
+
+		return PerformResult{
+			ContinueRequest: true,
+		}
+	}
+
+	if writer != nil {
+		var retryAfter = int64(math.Ceil(result.RetryIn.Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		writer.Header().Set("Retry-After", types.String(retryAfter))
+		request.ProcessResponseHeaders(writer.Header(), this.StatusCode)
+		writer.WriteHeader(this.StatusCode)
+
+		var body = this.Body
+		if len(body) == 0 {
+			body = "429 Too Many Requests"
+		}
+		_, _ = writer.Write([]byte(request.Format(body)))
+	}
+
+	return PerformResult{}
+}
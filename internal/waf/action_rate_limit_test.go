@@ -0,0 +1,127 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package waf_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/utils/ratelimit"
+	"github.com/TeaOSLab/EdgeNode/internal/waf"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/requests"
+	"github.com/iwind/TeaGo/assert"
+	"github.com/iwind/TeaGo/maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitAction_Perform(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var action = waf.FindActionInstance(waf.ActionRateLimit, maps.Map{
+		"keys":  []string{"${remoteAddr}"},
+		"rate":  2,
+		"burst": 2,
+	}).(*waf.RateLimitAction)
+	var w = waf.NewWAF()
+	err := action.Init(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawReq, err := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req = requests.NewTestRequest(rawReq)
+	var set = &waf.RuleSet{Id: 1}
+
+	for i := 0; i < 3; i++ {
+		var writer = httptest.NewRecorder()
+		var result = action.Perform(w, nil, set, req, writer)
+		t.Log(i, result.ContinueRequest, writer.Code, writer.Header())
+		if i < 2 {
+			a.IsTrue(result.ContinueRequest)
+		} else {
+			a.IsFalse(result.ContinueRequest)
+			a.IsTrue(writer.Code == http.StatusTooManyRequests)
+			a.IsTrue(writer.Header().Get("Retry-After") == "1")
+			a.IsTrue(writer.Header().Get("RateLimit-Remaining") == "0")
+		}
+	}
+}
+
+func TestRateLimitAction_Delay(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var action = waf.FindActionInstance(waf.ActionRateLimit, maps.Map{
+		"keys":       []string{"${remoteAddr}"},
+		"rate":       10,
+		"burst":      1,
+		"maxDelayMs": 1000,
+	}).(*waf.RateLimitAction)
+	var w = waf.NewWAF()
+	err := action.Init(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawReq, err := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req = requests.NewTestRequest(rawReq)
+	var set = &waf.RuleSet{Id: 2}
+
+	// 超出速率的请求被延迟处理而不是拒绝
+	var before = time.Now()
+	for i := 0; i < 3; i++ {
+		var writer = httptest.NewRecorder()
+		var result = action.Perform(w, nil, set, req, writer)
+		a.IsTrue(result.ContinueRequest)
+		a.IsTrue(writer.Code == http.StatusOK)
+	}
+	var cost = time.Since(before)
+	t.Log(cost)
+	a.IsTrue(cost >= 150*time.Millisecond)
+}
+
+type testRateLimitCounter struct {
+	keys []string
+}
+
+func (this *testRateLimitCounter) TakeKey(key string, rate float64, burst int, maxDelay time.Duration) ratelimit.TokenBucketResult {
+	this.keys = append(this.keys, key)
+	return ratelimit.TokenBucketResult{
+		OK:      false,
+		RetryIn: 3 * time.Second,
+	}
+}
+
+func TestRateLimitAction_Counter(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var counter = &testRateLimitCounter{}
+	waf.SetRateLimitCounter(counter)
+	defer waf.SetRateLimitCounter(nil)
+
+	var action = waf.FindActionInstance(waf.ActionRateLimit, maps.Map{
+		"keys": []string{"${remoteAddr}"},
+		"rate": 100,
+	}).(*waf.RateLimitAction)
+	var w = waf.NewWAF()
+	err := action.Init(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawReq, err := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var writer = httptest.NewRecorder()
+	var result = action.Perform(w, nil, &waf.RuleSet{Id: 3}, requests.NewTestRequest(rawReq), writer)
+	a.IsFalse(result.ContinueRequest)
+	a.IsTrue(len(counter.keys) == 1)
+	a.IsTrue(writer.Code == http.StatusTooManyRequests)
+	a.IsTrue(writer.Header().Get("Retry-After") == "3")
+}
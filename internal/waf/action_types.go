@@ -5,20 +5,22 @@ import "reflect"
 type ActionString = string
 
 const (
-	ActionLog              ActionString = "log"       // allow and log
-	ActionBlock            ActionString = "block"     // block
-	ActionCaptcha          ActionString = "captcha"   // block and show captcha
-	ActionJavascriptCookie ActionString = "js_cookie" // js cookie
-	ActionNotify           ActionString = "notify"    // 告警
-	ActionGet302           ActionString = "get_302"   // 针对GET的302重定向认证
-	ActionPost307          ActionString = "post_307"  // 针对POST的307重定向认证
-	ActionRecordIP         ActionString = "record_ip" // 记录IP
-	ActionTag              ActionString = "tag"       // 标签
-	ActionPage             ActionString = "page"      // 显示网页
-	ActionRedirect         ActionString = "redirect"  // 跳转
-	ActionAllow            ActionString = "allow"     // allow
-	ActionGoGroup          ActionString = "go_group"  // go to next rule group
-	ActionGoSet            ActionString = "go_set"    // go to next rule set
+	ActionLog              ActionString = "log"        // allow and log
+	ActionBlock            ActionString = "block"      // block
+	ActionCaptcha          ActionString = "captcha"    // block and show captcha
+	ActionJavascriptCookie ActionString = "js_cookie"  // js cookie
+	ActionNotify           ActionString = "notify"     // 告警
+	ActionGet302           ActionString = "get_302"    // 针对GET的302重定向认证
+	ActionPost307          ActionString = "post_307"   // 针对POST的307重定向认证
+	ActionRecordIP         ActionString = "record_ip"  // 记录IP
+	ActionTag              ActionString = "tag"        // 标签
+	ActionPage             ActionString = "page"       // 显示网页
+	ActionRedirect         ActionString = "redirect"   // 跳转
+	ActionMask             ActionString = "mask"       // 响应内容脱敏
+	ActionRateLimit        ActionString = "rate_limit" // 限流
+	ActionAllow            ActionString = "allow"      // allow
+	ActionGoGroup          ActionString = "go_group"   // go to next rule group
+	ActionGoSet            ActionString = "go_set"     // go to next rule set
 )
 
 var AllActions = []*ActionDefinition{
@@ -94,6 +96,18 @@ var AllActions = []*ActionDefinition{
 		Instance: new(RedirectAction),
 		Type:     reflect.TypeOf(new(RedirectAction)).Elem(),
 	},
+	{
+		Name:     "响应内容脱敏",
+		Code:     ActionMask,
+		Instance: new(MaskAction),
+		Type:     reflect.TypeOf(new(MaskAction)).Elem(),
+	},
+	{
+		Name:     "限流",
+		Code:     ActionRateLimit,
+		Instance: new(RateLimitAction),
+		Type:     reflect.TypeOf(new(RateLimitAction)).Elem(),
+	},
 	{
 		Name:     "跳到下一个规则分组",
 		Code:     ActionGoGroup,
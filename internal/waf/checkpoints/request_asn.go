@@ -0,0 +1,30 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package checkpoints
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/waf/requests"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/utils"
+	"github.com/iwind/TeaGo/maps"
+)
+
+type RequestASNCheckpoint struct {
+	Checkpoint
+}
+
+func (this *RequestASNCheckpoint) IsComposed() bool {
+	return false
+}
+
+func (this *RequestASNCheckpoint) RequestValue(req requests.Request, param string, options maps.Map, ruleId int64) (value any, hasRequestBody bool, sysErr error, userErr error) {
+	value = req.Format("${geo.asn}")
+	return
+}
+
+func (this *RequestASNCheckpoint) ResponseValue(req requests.Request, resp *requests.Response, param string, options maps.Map, ruleId int64) (value any, hasRequestBody bool, sysErr error, userErr error) {
+	return this.RequestValue(req, param, options, ruleId)
+}
+
+func (this *RequestASNCheckpoint) CacheLife() utils.CacheLife {
+	return utils.CacheLongLife
+}
@@ -0,0 +1,186 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package checkpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/graphqlutils"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/requests"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/utils"
+	"github.com/iwind/TeaGo/maps"
+	"net/http"
+	"strings"
+)
+
+// 单个GraphQL请求
+type graphQLRequest struct {
+	Query         string `json:"query"`
+	OperationName string `json:"operationName"`
+}
+
+// RequestGraphQLCheckpoint ${requestGraphQL.arg}
+type RequestGraphQLCheckpoint struct {
+	Checkpoint
+}
+
+func (this *RequestGraphQLCheckpoint) RequestValue(req requests.Request, param string, options maps.Map, ruleId int64) (value any, hasRequestBody bool, sysErr error, userErr error) {
+	value = this.defaultValue(param)
+
+	var graphQLRequests []*graphQLRequest
+
+	var rawReq = req.WAFRaw()
+	if rawReq.Method == http.MethodGet {
+		var query = rawReq.URL.Query()
+		graphQLRequests = append(graphQLRequests, &graphQLRequest{
+			Query:         query.Get("query"),
+			OperationName: query.Get("operationName"),
+		})
+	} else {
+		if this.RequestBodyIsEmpty(req) || rawReq.Body == nil {
+			return
+		}
+
+		hasRequestBody = true
+
+		var bodyData = req.WAFGetCacheBody()
+		if len(bodyData) == 0 {
+			data, err := req.WAFReadBody(req.WAFMaxRequestSize()) // read body
+			if err != nil {
+				return value, hasRequestBody, err, nil
+			}
+
+			bodyData = data
+			req.WAFSetCacheBody(data)
+			req.WAFRestoreBody(data)
+		}
+
+		var err error
+		graphQLRequests, err = this.parseBody(rawReq.Header.Get("Content-Type"), bodyData)
+		if err != nil {
+			return value, hasRequestBody, nil, err
+		}
+	}
+
+	// 分析每个请求，批量请求时深度取最大值，别名和字段数量取合计值
+	var operationNames = []string{}
+	var operationTypes = []string{}
+	var depth = 0
+	var aliases = 0
+	var fields = 0
+	var isIntrospected = false
+	for _, graphQLReq := range graphQLRequests {
+		if graphQLReq == nil || len(graphQLReq.Query) == 0 {
+			continue
+		}
+		info, err := graphqlutils.ParseQuery(graphQLReq.Query, graphQLReq.OperationName)
+		if info == nil {
+			userErr = err
+			continue
+		}
+		operationNames = append(operationNames, info.OperationName)
+		operationTypes = append(operationTypes, info.OperationType)
+		if info.Depth > depth {
+			depth = info.Depth
+		}
+		aliases += info.Aliases
+		fields += info.Fields
+		if info.IsIntrospected {
+			isIntrospected = true
+		}
+	}
+
+	switch param {
+	case "operationName":
+		value = this.joinValues(operationNames)
+	case "operationType":
+		value = this.joinValues(operationTypes)
+	case "depth":
+		value = depth
+	case "aliases":
+		value = aliases
+	case "fields":
+		value = fields
+	case "introspection":
+		if isIntrospected {
+			value = 1
+		}
+	case "batch":
+		value = len(graphQLRequests)
+	}
+
+	return
+}
+
+func (this *RequestGraphQLCheckpoint) ResponseValue(req requests.Request, resp *requests.Response, param string, options maps.Map, ruleId int64) (value any, hasRequestBody bool, sysErr error, userErr error) {
+	if this.IsRequest() {
+		return this.RequestValue(req, param, options, ruleId)
+	}
+	return
+}
+
+func (this *RequestGraphQLCheckpoint) ParamOptions() *ParamOptions {
+	option := NewParamOptions()
+	option.AddParam("操作名称", "operationName")
+	option.AddParam("操作类型(query、mutation、subscription)", "operationType")
+	option.AddParam("查询深度", "depth")
+	option.AddParam("别名数量", "aliases")
+	option.AddParam("字段数量", "fields")
+	option.AddParam("是否使用内省查询(1或0)", "introspection")
+	option.AddParam("批量请求数量", "batch")
+	return option
+}
+
+func (this *RequestGraphQLCheckpoint) CacheLife() utils.CacheLife {
+	return utils.CacheMiddleLife
+}
+
+// 解析请求体，支持 application/graphql 和 JSON（包括批量请求）格式
+func (this *RequestGraphQLCheckpoint) parseBody(contentType string, bodyData []byte) ([]*graphQLRequest, error) {
+	if strings.Contains(contentType, "graphql") {
+		return []*graphQLRequest{
+			{
+				Query: string(bodyData),
+			},
+		}, nil
+	}
+
+	var data = strings.TrimSpace(string(bodyData))
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	switch data[0] {
+	case '{':
+		var graphQLReq = &graphQLRequest{}
+		err := json.Unmarshal([]byte(data), graphQLReq)
+		if err != nil {
+			return nil, err
+		}
+		return []*graphQLRequest{graphQLReq}, nil
+	case '[':
+		var graphQLRequests = []*graphQLRequest{}
+		err := json.Unmarshal([]byte(data), &graphQLRequests)
+		if err != nil {
+			return nil, err
+		}
+		return graphQLRequests, nil
+	}
+
+	return nil, errors.New("invalid graphql request body")
+}
+
+func (this *RequestGraphQLCheckpoint) defaultValue(param string) any {
+	switch param {
+	case "depth", "aliases", "fields", "introspection", "batch":
+		return 0
+	}
+	return ""
+}
+
+func (this *RequestGraphQLCheckpoint) joinValues(values []string) any {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
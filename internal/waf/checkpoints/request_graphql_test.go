@@ -0,0 +1,116 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package checkpoints
+
+import (
+	"bytes"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/requests"
+	"github.com/iwind/TeaGo/assert"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestRequestGraphQLCheckpoint_RequestValue(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	rawReq, err := http.NewRequest(http.MethodPost, "http://teaos.cn/graphql", bytes.NewBuffer([]byte(`{
+	"query": "query GetUser { a: user(id: 1) { name friends { name } } b: user(id: 2) { name } }",
+	"operationName": "GetUser",
+	"variables": {}
+}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawReq.Header.Set("Content-Type", "application/json")
+
+	var req = requests.NewTestRequest(rawReq)
+	var checkpoint = new(RequestGraphQLCheckpoint)
+
+	for _, param := range []string{"operationName", "operationType", "depth", "aliases", "fields", "introspection", "batch"} {
+		value, _, sysErr, userErr := checkpoint.RequestValue(req, param, nil, 1)
+		a.IsNil(sysErr)
+		a.IsNil(userErr)
+		t.Log(param, ":", value)
+	}
+
+	{
+		value, _, _, _ := checkpoint.RequestValue(req, "operationName", nil, 1)
+		a.IsTrue(value == "GetUser")
+	}
+	{
+		value, _, _, _ := checkpoint.RequestValue(req, "depth", nil, 1)
+		a.IsTrue(value == 3)
+	}
+	{
+		value, _, _, _ := checkpoint.RequestValue(req, "aliases", nil, 1)
+		a.IsTrue(value == 2)
+	}
+	{
+		value, _, _, _ := checkpoint.RequestValue(req, "introspection", nil, 1)
+		a.IsTrue(value == 0)
+	}
+}
+
+func TestRequestGraphQLCheckpoint_RequestValue_Batch(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	rawReq, err := http.NewRequest(http.MethodPost, "http://teaos.cn/graphql", bytes.NewBuffer([]byte(`[
+	{ "query": "{ a }" },
+	{ "query": "mutation M { b { c { d } } }" },
+	{ "query": "query { __schema { types { name } } }" }
+]`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var req = requests.NewTestRequest(rawReq)
+	var checkpoint = new(RequestGraphQLCheckpoint)
+	{
+		value, _, _, _ := checkpoint.RequestValue(req, "batch", nil, 1)
+		a.IsTrue(value == 3)
+	}
+	{
+		value, _, _, _ := checkpoint.RequestValue(req, "depth", nil, 1)
+		a.IsTrue(value == 3)
+	}
+	{
+		value, _, _, _ := checkpoint.RequestValue(req, "introspection", nil, 1)
+		a.IsTrue(value == 1)
+	}
+	{
+		value, _, _, _ := checkpoint.RequestValue(req, "operationType", nil, 1)
+		t.Log(value)
+		a.IsTrue(len(value.([]string)) == 3)
+	}
+}
+
+func TestRequestGraphQLCheckpoint_RequestValue_Get(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	rawReq, err := http.NewRequest(http.MethodGet, "http://teaos.cn/graphql?query="+url.QueryEscape("{ user { name } }"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var req = requests.NewTestRequest(rawReq)
+	var checkpoint = new(RequestGraphQLCheckpoint)
+	value, hasRequestBody, _, _ := checkpoint.RequestValue(req, "depth", nil, 1)
+	a.IsFalse(hasRequestBody)
+	a.IsTrue(value == 2)
+}
+
+func TestRequestGraphQLCheckpoint_RequestValue_Raw(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	rawReq, err := http.NewRequest(http.MethodPost, "http://teaos.cn/graphql", bytes.NewBuffer([]byte(`subscription OnMessage { message { id } }`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawReq.Header.Set("Content-Type", "application/graphql")
+
+	var req = requests.NewTestRequest(rawReq)
+	var checkpoint = new(RequestGraphQLCheckpoint)
+	value, _, _, _ := checkpoint.RequestValue(req, "operationType", nil, 1)
+	a.IsTrue(value == "subscription")
+}
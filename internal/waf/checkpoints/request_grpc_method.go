@@ -0,0 +1,30 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package checkpoints
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/waf/requests"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/utils"
+	"github.com/iwind/TeaGo/maps"
+)
+
+type RequestGRPCMethodCheckpoint struct {
+	Checkpoint
+}
+
+func (this *RequestGRPCMethodCheckpoint) IsComposed() bool {
+	return false
+}
+
+func (this *RequestGRPCMethodCheckpoint) RequestValue(req requests.Request, param string, options maps.Map, ruleId int64) (value any, hasRequestBody bool, sysErr error, userErr error) {
+	value = req.Format("${grpc.method}")
+	return
+}
+
+func (this *RequestGRPCMethodCheckpoint) ResponseValue(req requests.Request, resp *requests.Response, param string, options maps.Map, ruleId int64) (value any, hasRequestBody bool, sysErr error, userErr error) {
+	return this.RequestValue(req, param, options, ruleId)
+}
+
+func (this *RequestGRPCMethodCheckpoint) CacheLife() utils.CacheLife {
+	return utils.CacheMiddleLife
+}
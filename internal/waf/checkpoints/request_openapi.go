@@ -0,0 +1,186 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package checkpoints
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/waf/openapi"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/requests"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/utils"
+	"github.com/cespare/xxhash/v2"
+	"github.com/iwind/TeaGo/maps"
+	"io"
+	"strings"
+	"sync"
+)
+
+// 已编译的文档
+type openAPIDocument struct {
+	hash uint64
+	doc  *openapi.Document
+	err  error
+}
+
+// RequestOpenAPICheckpoint ${requestOpenAPI.violation}
+// 根据OpenAPI 3.x文档校验请求，只允许文档中定义的路径、方法、参数和请求体
+type RequestOpenAPICheckpoint struct {
+	Checkpoint
+
+	documentMap    map[int64]*openAPIDocument // ruleId => document
+	documentLocker sync.RWMutex
+}
+
+func (this *RequestOpenAPICheckpoint) RequestValue(req requests.Request, param string, options maps.Map, ruleId int64) (value any, hasRequestBody bool, sysErr error, userErr error) {
+	value = ""
+
+	doc, err := this.compileDocument(ruleId, options.GetString("document"))
+	if err != nil {
+		return value, false, err, nil
+	}
+	if doc == nil {
+		return
+	}
+
+	var rawReq = req.WAFRaw()
+	var validateOptions = &openapi.ValidateOptions{
+		DenyUnknownQuery: options.GetBool("denyUnknownQuery"),
+	}
+
+	var bodyData []byte
+	if !this.RequestBodyIsEmpty(req) && rawReq.Body != nil {
+		hasRequestBody = true
+
+		var maxSize = req.WAFMaxRequestSize()
+		if rawReq.ContentLength > maxSize || strings.HasPrefix(rawReq.Header.Get("Content-Type"), "application/grpc") {
+			// 超出最大尺寸的请求体无法完整读取，gRPC为流式调用，都跳过校验
+			validateOptions.SkipBody = true
+		} else {
+			bodyData = req.WAFGetCacheBody()
+			if len(bodyData) == 0 {
+				if rawReq.ContentLength > 0 {
+					data, err := req.WAFReadBody(maxSize) // read body
+					if err != nil {
+						return value, hasRequestBody, err, nil
+					}
+
+					bodyData = data
+					req.WAFSetCacheBody(data)
+					req.WAFRestoreBody(data)
+				} else {
+					// 长度未知（比如chunked），最多读取 maxSize+1 个字节，超出时无法完整校验
+					data, err := io.ReadAll(io.LimitReader(rawReq.Body, maxSize+1))
+					if err != nil {
+						return value, hasRequestBody, err, nil
+					}
+					req.WAFRestoreBody(data)
+
+					if int64(len(data)) > maxSize {
+						validateOptions.SkipBody = true
+					} else {
+						bodyData = data
+						req.WAFSetCacheBody(data)
+					}
+				}
+			}
+		}
+	}
+
+	var violation = doc.ValidateRequest(rawReq, bodyData, validateOptions)
+	if violation == nil {
+		return
+	}
+
+	switch param {
+	case "message":
+		value = violation.Message
+	default:
+		value = violation.Code
+	}
+
+	return
+}
+
+func (this *RequestOpenAPICheckpoint) ResponseValue(req requests.Request, resp *requests.Response, param string, options maps.Map, ruleId int64) (value any, hasRequestBody bool, sysErr error, userErr error) {
+	if this.IsRequest() {
+		return this.RequestValue(req, param, options, ruleId)
+	}
+	return
+}
+
+func (this *RequestOpenAPICheckpoint) ParamOptions() *ParamOptions {
+	option := NewParamOptions()
+	option.AddParam("违规类型", "violation")
+	option.AddParam("违规描述", "message")
+	return option
+}
+
+func (this *RequestOpenAPICheckpoint) Options() []OptionInterface {
+	options := []OptionInterface{}
+
+	// document
+	{
+		option := NewFieldOption("OpenAPI文档", "document")
+		option.IsRequired = true
+		option.Comment = "OpenAPI 3.x文档内容，支持JSON和YAML格式"
+		options = append(options, option)
+	}
+
+	// deny unknown query
+	{
+		option := NewOptionsOption("未定义的查询参数", "denyUnknownQuery")
+		option.SetOptions([]maps.Map{
+			{
+				"name":  "允许",
+				"value": "0",
+			},
+			{
+				"name":  "禁止",
+				"value": "1",
+			},
+		})
+		options = append(options, option)
+	}
+
+	return options
+}
+
+// Stop 清除已编译的文档，在WAF被替换时调用
+func (this *RequestOpenAPICheckpoint) Stop() {
+	this.documentLocker.Lock()
+	this.documentMap = nil
+	this.documentLocker.Unlock()
+}
+
+func (this *RequestOpenAPICheckpoint) CacheLife() utils.CacheLife {
+	return utils.CacheMiddleLife
+}
+
+// 编译文档，并按规则缓存编译结果，文档内容变化时重新编译
+func (this *RequestOpenAPICheckpoint) compileDocument(ruleId int64, data string) (*openapi.Document, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var hash = xxhash.Sum64String(data)
+
+	this.documentLocker.RLock()
+	cachedDoc, ok := this.documentMap[ruleId]
+	this.documentLocker.RUnlock()
+	if ok && cachedDoc.hash == hash {
+		return cachedDoc.doc, cachedDoc.err
+	}
+
+	doc, err := openapi.ParseDocument([]byte(data))
+
+	this.documentLocker.Lock()
+	if this.documentMap == nil {
+		this.documentMap = map[int64]*openAPIDocument{}
+	}
+	this.documentMap[ruleId] = &openAPIDocument{
+		hash: hash,
+		doc:  doc,
+		err:  err,
+	}
+	this.documentLocker.Unlock()
+
+	return doc, err
+}
@@ -0,0 +1,157 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package checkpoints
+
+import (
+	"bytes"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/requests"
+	"github.com/iwind/TeaGo/assert"
+	"github.com/iwind/TeaGo/maps"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequestOpenAPICheckpoint_RequestValue(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var options = maps.Map{
+		"document": `{
+	"openapi": "3.0.0",
+	"paths": {
+		"/users": {
+			"post": {
+				"requestBody": {
+					"required": true,
+					"content": {
+						"application/json": {
+							"schema": {
+								"type": "object",
+								"required": ["name"],
+								"properties": {
+									"name": { "type": "string", "maxLength": 10 }
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}`,
+		"denyUnknownQuery": "1",
+	}
+
+	var checkpoint = new(RequestOpenAPICheckpoint)
+
+	var testRequest = func(method string, url string, body string) (violation any, message any) {
+		rawReq, err := http.NewRequest(method, url, bytes.NewBuffer([]byte(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rawReq.Header.Set("Content-Type", "application/json")
+		var req = requests.NewTestRequest(rawReq)
+
+		violation, _, sysErr, _ := checkpoint.RequestValue(req, "violation", options, 1)
+		if sysErr != nil {
+			t.Fatal(sysErr)
+		}
+		message, _, _, _ = checkpoint.RequestValue(req, "message", options, 1)
+		t.Log(method, url, body, "=>", violation, message)
+		return
+	}
+
+	{
+		violation, _ := testRequest(http.MethodPost, "https://example.com/users", `{"name": "Lily"}`)
+		a.IsTrue(violation == "")
+	}
+	{
+		violation, _ := testRequest(http.MethodPost, "https://example.com/users", `{"name": "Lily' or 1=1 -- comment"}`)
+		a.IsTrue(violation == "invalidBody")
+	}
+	{
+		violation, _ := testRequest(http.MethodPost, "https://example.com/users?debug=1", `{"name": "Lily"}`)
+		a.IsTrue(violation == "unknownParameter")
+	}
+	{
+		violation, _ := testRequest(http.MethodGet, "https://example.com/users", ``)
+		a.IsTrue(violation == "unknownMethod")
+	}
+	{
+		violation, message := testRequest(http.MethodGet, "https://example.com/admin", ``)
+		a.IsTrue(violation == "unknownPath")
+		a.IsTrue(message != "")
+	}
+}
+
+func TestRequestOpenAPICheckpoint_UnknownLength(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var options = maps.Map{
+		"document": `
+openapi: 3.0.0
+paths:
+  /users:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: object
+              properties:
+                age: { type: integer }
+`,
+	}
+
+	var checkpoint = new(RequestOpenAPICheckpoint)
+
+	for _, body := range []string{`{"age": 20}`, `{"age": "twenty"}`} {
+		// 没有Content-Length的请求，比如 Transfer-Encoding: chunked
+		rawReq, err := http.NewRequest(http.MethodPost, "https://example.com/users", io.NopCloser(strings.NewReader(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rawReq.ContentLength = -1
+		rawReq.Header.Set("Content-Type", "application/json")
+
+		var req = requests.NewTestRequest(rawReq)
+		violation, _, sysErr, _ := checkpoint.RequestValue(req, "violation", options, 1)
+		if sysErr != nil {
+			t.Fatal(sysErr)
+		}
+		t.Log(body, "=>", violation)
+		if body == `{"age": 20}` {
+			a.IsTrue(violation == "")
+		} else {
+			a.IsTrue(violation == "invalidBody")
+		}
+
+		// body should be restored
+		data, err := io.ReadAll(rawReq.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(string(data) == body)
+	}
+
+	a.IsTrue(len(checkpoint.documentMap) == 1)
+	checkpoint.Stop()
+	a.IsTrue(len(checkpoint.documentMap) == 0)
+}
+
+func TestRequestOpenAPICheckpoint_InvalidDocument(t *testing.T) {
+	rawReq, err := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var checkpoint = new(RequestOpenAPICheckpoint)
+	_, _, sysErr, _ := checkpoint.RequestValue(requests.NewTestRequest(rawReq), "violation", maps.Map{
+		"document": "swagger: '2.0'",
+	}, 1)
+	if sysErr == nil {
+		t.Fatal("should return error")
+	}
+	t.Log(sysErr)
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package checkpoints
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/requests"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/utils"
+	"github.com/iwind/TeaGo/maps"
+	"io"
+	"strings"
+)
+
+const (
+	xmlMaxDepth    = 64     // 最大嵌套深度
+	xmlMaxElements = 100000 // 最多解析的元素数量
+)
+
+var errXMLEntityNotAllowed = errors.New("xml: DOCTYPE and ENTITY declarations are not allowed")
+var errXMLTooDeep = errors.New("xml: too many nesting levels")
+var errXMLTooManyElements = errors.New("xml: too many elements")
+
+// RequestXMLArgCheckpoint ${requestXML.arg}
+type RequestXMLArgCheckpoint struct {
+	Checkpoint
+}
+
+func (this *RequestXMLArgCheckpoint) RequestValue(req requests.Request, param string, options maps.Map, ruleId int64) (value any, hasRequestBody bool, sysErr error, userErr error) {
+	value = ""
+
+	if this.RequestBodyIsEmpty(req) {
+		return
+	}
+
+	if req.WAFRaw().Body == nil {
+		return
+	}
+
+	hasRequestBody = true
+
+	var bodyData = req.WAFGetCacheBody()
+	if len(bodyData) == 0 {
+		data, err := req.WAFReadBody(req.WAFMaxRequestSize()) // read body
+		if err != nil {
+			return "", hasRequestBody, err, nil
+		}
+
+		bodyData = data
+		req.WAFSetCacheBody(data)
+		req.WAFRestoreBody(data)
+	}
+
+	valuesMap, allValues, directive, err := this.parseXML(bodyData)
+	if err != nil {
+		userErr = err
+		if err == errXMLEntityNotAllowed {
+			// 不管参数是什么，都返回原始的声明内容，以便于规则可以检测到XXE
+			value = directive
+			return
+		}
+	}
+
+	// 所有的值
+	if len(param) == 0 {
+		value = allValues
+		return
+	}
+
+	values, ok := valuesMap[param]
+	if ok {
+		if len(values) == 1 {
+			value = values[0]
+		} else {
+			value = values
+		}
+	}
+
+	return
+}
+
+func (this *RequestXMLArgCheckpoint) ResponseValue(req requests.Request, resp *requests.Response, param string, options maps.Map, ruleId int64) (value any, hasRequestBody bool, sysErr error, userErr error) {
+	if this.IsRequest() {
+		return this.RequestValue(req, param, options, ruleId)
+	}
+	return
+}
+
+func (this *RequestXMLArgCheckpoint) CacheLife() utils.CacheLife {
+	return utils.CacheMiddleLife
+}
+
+// 解析XML，返回 路径 => 值列表，路径使用点（.）连接元素名，属性也作为最后一级，比如 root.user.name、root.user.id
+// 不展开任何自定义实体，遇到 DOCTYPE 或者 ENTITY 声明时停止解析，同时返回原始的声明内容和错误，以防止XXE和实体扩展攻击
+func (this *RequestXMLArgCheckpoint) parseXML(data []byte) (valuesMap map[string][]string, allValues []string, directive string, err error) {
+	valuesMap = map[string][]string{}
+
+	var decoder = xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = true
+	decoder.Entity = nil
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		// 不转换字符集，按原样读取
+		return input, nil
+	}
+
+	var paths = []string{}
+	var texts = []*strings.Builder{}
+	var countElements = 0
+
+	var addValue = func(path string, value string) {
+		valuesMap[path] = append(valuesMap[path], value)
+		allValues = append(allValues, value)
+	}
+
+	for {
+		token, tokenErr := decoder.Token()
+		if tokenErr != nil {
+			if tokenErr != io.EOF {
+				err = tokenErr
+			}
+			return
+		}
+
+		switch t := token.(type) {
+		case xml.Directive:
+			var upperDirective = strings.ToUpper(string(t))
+			if strings.Contains(upperDirective, "DOCTYPE") || strings.Contains(upperDirective, "ENTITY") {
+				err = errXMLEntityNotAllowed
+				return nil, nil, "<!" + string(t) + ">", err
+			}
+		case xml.StartElement:
+			if len(paths) >= xmlMaxDepth {
+				err = errXMLTooDeep
+				return
+			}
+			countElements++
+			if countElements > xmlMaxElements {
+				err = errXMLTooManyElements
+				return
+			}
+
+			var path = t.Name.Local
+			if len(paths) > 0 {
+				path = paths[len(paths)-1] + "." + path
+			}
+			paths = append(paths, path)
+			texts = append(texts, &strings.Builder{})
+
+			for _, attr := range t.Attr {
+				addValue(path+"."+attr.Name.Local, attr.Value)
+			}
+		case xml.CharData:
+			if len(texts) > 0 {
+				texts[len(texts)-1].Write(t)
+			}
+		case xml.EndElement:
+			if len(paths) == 0 {
+				continue
+			}
+			var path = paths[len(paths)-1]
+			var text = strings.TrimSpace(texts[len(texts)-1].String())
+			paths = paths[:len(paths)-1]
+			texts = texts[:len(texts)-1]
+
+			if len(text) > 0 {
+				addValue(path, text)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package checkpoints
+
+import (
+	"bytes"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/requests"
+	"github.com/iwind/TeaGo/assert"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequestXMLArgCheckpoint_RequestValue(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	rawReq, err := http.NewRequest(http.MethodPost, "http://teaos.cn", bytes.NewBuffer([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<root>
+	<user id="1">
+		<name>lu</name>
+		<books>
+			<book>PHP</book>
+			<book>Golang</book>
+		</books>
+	</user>
+</root>
+`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var req = requests.NewTestRequest(rawReq)
+	var checkpoint = new(RequestXMLArgCheckpoint)
+
+	{
+		value, _, _, userErr := checkpoint.RequestValue(req, "root.user.name", nil, 1)
+		a.IsNil(userErr)
+		a.IsTrue(value == "lu")
+	}
+	{
+		value, _, _, _ := checkpoint.RequestValue(req, "root.user.id", nil, 1)
+		a.IsTrue(value == "1")
+	}
+	{
+		value, _, _, _ := checkpoint.RequestValue(req, "root.user.books.book", nil, 1)
+		values, ok := value.([]string)
+		a.IsTrue(ok)
+		a.IsTrue(len(values) == 2)
+	}
+	{
+		value, _, _, _ := checkpoint.RequestValue(req, "root.user.age", nil, 1)
+		a.IsTrue(value == "")
+	}
+	{
+		value, _, _, _ := checkpoint.RequestValue(req, "", nil, 1)
+		t.Log(value)
+		a.IsTrue(len(value.([]string)) == 4)
+	}
+
+	// body should be restored
+	body, err := io.ReadAll(req.WAFRaw().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(strings.Contains(string(body), "<name>lu</name>"))
+}
+
+func TestRequestXMLArgCheckpoint_RequestValue_Entity(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	rawReq, err := http.NewRequest(http.MethodPost, "http://teaos.cn", bytes.NewBuffer([]byte(`<?xml version="1.0"?>
+<!DOCTYPE root [<!ENTITY xxe SYSTEM "file:///etc/passwd">]>
+<root><name>&xxe;</name></root>`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var req = requests.NewTestRequest(rawReq)
+	var checkpoint = new(RequestXMLArgCheckpoint)
+	for _, param := range []string{"root.name", ""} {
+		value, _, _, userErr := checkpoint.RequestValue(req, param, nil, 1)
+		a.IsNotNil(userErr)
+		t.Log(value)
+		a.IsTrue(value == `<!DOCTYPE root [<!ENTITY xxe SYSTEM "file:///etc/passwd">]>`)
+	}
+}
+
+func TestRequestXMLArgCheckpoint_RequestValue_Depth(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	rawReq, err := http.NewRequest(http.MethodPost, "http://teaos.cn", bytes.NewBuffer([]byte(strings.Repeat("<a>", 1000)+strings.Repeat("</a>", 1000))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var req = requests.NewTestRequest(rawReq)
+	var checkpoint = new(RequestXMLArgCheckpoint)
+	_, _, _, userErr := checkpoint.RequestValue(req, "a", nil, 1)
+	a.IsNotNil(userErr)
+}
@@ -114,6 +114,30 @@ var AllCheckpoints = []*CheckpointDefinition{
 		Instance:    new(RequestJSONArgCheckpoint),
 		Priority:    5,
 	},
+	{
+		Name:        "请求XML参数",
+		Prefix:      "requestXML",
+		Description: "获取POST或者其他方法发送的XML，最大请求体限制32M，使用点（.）符号连接元素名和属性名，比如root.user.name；不允许DOCTYPE和ENTITY声明",
+		HasParams:   true,
+		Instance:    new(RequestXMLArgCheckpoint),
+		Priority:    5,
+	},
+	{
+		Name:        "GraphQL请求",
+		Prefix:      "requestGraphQL",
+		Description: "分析GraphQL请求中的操作名称、操作类型、查询深度、别名数量以及是否使用内省查询，最大请求体限制32M",
+		HasParams:   true,
+		Instance:    new(RequestGraphQLCheckpoint),
+		Priority:    5,
+	},
+	{
+		Name:        "OpenAPI校验",
+		Prefix:      "requestOpenAPI",
+		Description: "根据OpenAPI 3.x文档校验请求路径、方法、参数和请求体，不符合文档定义时返回违规类型（unknownPath、unknownMethod、missingParameter、invalidParameter、unknownParameter、unsupportedContentType、missingBody、invalidBody），符合时返回空字符串",
+		HasParams:   true,
+		Instance:    new(RequestOpenAPICheckpoint),
+		Priority:    5,
+	},
 	{
 		Name:        "请求方法",
 		Prefix:      "requestMethod",
@@ -282,6 +306,22 @@ var AllCheckpoints = []*CheckpointDefinition{
 		Instance:    new(RequestISPNameCheckpoint),
 		Priority:    90,
 	},
+	{
+		Name:        "ASN",
+		Prefix:      "asn",
+		Description: "客户端IP所属自治系统编号（AS Number），需要在节点上安装MMDB文件",
+		HasParams:   false,
+		Instance:    new(RequestASNCheckpoint),
+		Priority:    90,
+	},
+	{
+		Name:        "gRPC方法",
+		Prefix:      "grpcMethod",
+		Description: "gRPC请求调用的方法，格式为：/包名.服务名/方法名，非gRPC请求时为空",
+		HasParams:   false,
+		Instance:    new(RequestGRPCMethodCheckpoint),
+		Priority:    90,
+	},
 	{
 		Name:        "CC统计（旧）",
 		Prefix:      "cc",
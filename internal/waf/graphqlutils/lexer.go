@@ -0,0 +1,147 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package graphqlutils
+
+import (
+	"errors"
+	"strings"
+)
+
+type tokenKind = int8
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunctuator
+	tokenName
+	tokenNumber
+	tokenString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+// 词法分析器
+type lexer struct {
+	source string
+	offset int
+}
+
+func newLexer(source string) *lexer {
+	return &lexer{
+		source: source,
+	}
+}
+
+func (this *lexer) next() (token, error) {
+	this.skipIgnored()
+
+	var l = len(this.source)
+	if this.offset >= l {
+		return token{kind: tokenEOF}, nil
+	}
+
+	var c = this.source[this.offset]
+	switch {
+	case c == '.':
+		if strings.HasPrefix(this.source[this.offset:], "...") {
+			this.offset += 3
+			return token{kind: tokenPunctuator, value: "..."}, nil
+		}
+		return token{}, errors.New("unexpected character '.'")
+	case strings.IndexByte("!$&():=@[]{}|", c) >= 0:
+		this.offset++
+		return token{kind: tokenPunctuator, value: string(c)}, nil
+	case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		var start = this.offset
+		for this.offset < l && isNameChar(this.source[this.offset]) {
+			this.offset++
+		}
+		return token{kind: tokenName, value: this.source[start:this.offset]}, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		var start = this.offset
+		this.offset++
+		for this.offset < l {
+			var c1 = this.source[this.offset]
+			if (c1 >= '0' && c1 <= '9') || c1 == '.' || c1 == 'e' || c1 == 'E' || c1 == '+' || c1 == '-' {
+				this.offset++
+				continue
+			}
+			break
+		}
+		return token{kind: tokenNumber, value: this.source[start:this.offset]}, nil
+	case c == '"':
+		return this.readString()
+	}
+
+	return token{}, errors.New("unexpected character '" + string(c) + "'")
+}
+
+// 跳过空白、逗号、注释和BOM
+func (this *lexer) skipIgnored() {
+	var l = len(this.source)
+	for this.offset < l {
+		var c = this.source[this.offset]
+		switch c {
+		case ' ', '\t', '\r', '\n', ',':
+			this.offset++
+		case '#':
+			for this.offset < l && this.source[this.offset] != '\n' && this.source[this.offset] != '\r' {
+				this.offset++
+			}
+		case 0xEF:
+			if strings.HasPrefix(this.source[this.offset:], "\uFEFF") {
+				this.offset += 3
+			} else {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (this *lexer) readString() (token, error) {
+	var l = len(this.source)
+
+	// block string
+	if strings.HasPrefix(this.source[this.offset:], `"""`) {
+		var start = this.offset + 3
+		var i = start
+		for i < l {
+			if this.source[i] == '\\' && strings.HasPrefix(this.source[i:], `\"""`) {
+				i += 4
+				continue
+			}
+			if strings.HasPrefix(this.source[i:], `"""`) {
+				this.offset = i + 3
+				return token{kind: tokenString, value: this.source[start:i]}, nil
+			}
+			i++
+		}
+		return token{}, errors.New("unterminated string")
+	}
+
+	var start = this.offset + 1
+	var i = start
+	for i < l {
+		var c = this.source[i]
+		switch c {
+		case '\\':
+			i += 2
+			continue
+		case '"':
+			this.offset = i + 1
+			return token{kind: tokenString, value: this.source[start:i]}, nil
+		case '\n', '\r':
+			return token{}, errors.New("unterminated string")
+		}
+		i++
+	}
+	return token{}, errors.New("unterminated string")
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
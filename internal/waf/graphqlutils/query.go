@@ -0,0 +1,453 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package graphqlutils
+
+import (
+	"errors"
+)
+
+// MaxNestingLevel 最大解析的嵌套层级，超出此层级时停止解析，以防止恶意的深层嵌套
+const MaxNestingLevel = 256
+
+var ErrTooManyNestingLevels = errors.New("too many nesting levels")
+
+type OperationType = string
+
+const (
+	OperationTypeQuery        OperationType = "query"
+	OperationTypeMutation     OperationType = "mutation"
+	OperationTypeSubscription OperationType = "subscription"
+)
+
+// QueryInfo 查询语句分析结果
+type QueryInfo struct {
+	OperationName  string        // 当前执行的操作名称
+	OperationType  OperationType // 当前执行的操作类型
+	Depth          int           // 当前执行的操作的最大嵌套深度，包含展开的片段
+	Aliases        int           // 别名数量
+	Fields         int           // 字段数量
+	IsIntrospected bool          // 是否使用了内省查询（__schema、__type）
+}
+
+type selectionSet struct {
+	fields    []*selectionSet // 每个字段的子选择集，没有子选择集的字段为nil
+	fragments []string        // 引用的片段
+	inlines   []*selectionSet // 内联片段
+}
+
+type operation struct {
+	name          string
+	operationType OperationType
+	selectionSet  *selectionSet
+}
+
+type parser struct {
+	lexer   *lexer
+	current token
+
+	operations []*operation
+	fragments  map[string]*selectionSet
+
+	fragmentDepths map[string]int
+
+	aliases        int
+	fields         int
+	isIntrospected bool
+	level          int
+}
+
+// ParseQuery 分析查询语句
+// operationName 为请求中指定的操作名称，为空时使用第一个操作
+// 嵌套层级超出 MaxNestingLevel 时，同时返回深度为 MaxNestingLevel+1 的分析结果和 ErrTooManyNestingLevels 错误
+func ParseQuery(query string, operationName string) (*QueryInfo, error) {
+	var p = &parser{
+		lexer:          newLexer(query),
+		fragments:      map[string]*selectionSet{},
+		fragmentDepths: map[string]int{},
+	}
+	err := p.parseDocument()
+	if err != nil {
+		if err == ErrTooManyNestingLevels {
+			return &QueryInfo{
+				OperationType:  OperationTypeQuery,
+				Depth:          MaxNestingLevel + 1,
+				Aliases:        p.aliases,
+				Fields:         p.fields,
+				IsIntrospected: p.isIntrospected,
+			}, err
+		}
+		return nil, err
+	}
+
+	if len(p.operations) == 0 {
+		return nil, errors.New("no operation found")
+	}
+
+	var op = p.operations[0]
+	if len(operationName) > 0 {
+		var found = false
+		for _, op1 := range p.operations {
+			if op1.name == operationName {
+				op = op1
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New("operation '" + operationName + "' not found")
+		}
+	}
+
+	return &QueryInfo{
+		OperationName:  op.name,
+		OperationType:  op.operationType,
+		Depth:          p.depth(op.selectionSet, map[string]bool{}),
+		Aliases:        p.aliases,
+		Fields:         p.fields,
+		IsIntrospected: p.isIntrospected,
+	}, nil
+}
+
+func (this *parser) advance() error {
+	tok, err := this.lexer.next()
+	if err != nil {
+		return err
+	}
+	this.current = tok
+	return nil
+}
+
+func (this *parser) isPunctuator(value string) bool {
+	return this.current.kind == tokenPunctuator && this.current.value == value
+}
+
+func (this *parser) expectPunctuator(value string) error {
+	if !this.isPunctuator(value) {
+		return errors.New("expected '" + value + "', but got '" + this.current.value + "'")
+	}
+	return this.advance()
+}
+
+func (this *parser) expectName() (string, error) {
+	if this.current.kind != tokenName {
+		return "", errors.New("expected name, but got '" + this.current.value + "'")
+	}
+	var name = this.current.value
+	return name, this.advance()
+}
+
+func (this *parser) parseDocument() error {
+	err := this.advance()
+	if err != nil {
+		return err
+	}
+
+	for this.current.kind != tokenEOF {
+		if this.isPunctuator("{") {
+			set, err := this.parseSelectionSet()
+			if err != nil {
+				return err
+			}
+			this.operations = append(this.operations, &operation{
+				operationType: OperationTypeQuery,
+				selectionSet:  set,
+			})
+			continue
+		}
+
+		if this.current.kind != tokenName {
+			return errors.New("unexpected token '" + this.current.value + "'")
+		}
+
+		switch this.current.value {
+		case OperationTypeQuery, OperationTypeMutation, OperationTypeSubscription:
+			err = this.parseOperation()
+		case "fragment":
+			err = this.parseFragment()
+		default:
+			return errors.New("unsupported definition '" + this.current.value + "'")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *parser) parseOperation() error {
+	var op = &operation{
+		operationType: this.current.value,
+	}
+	err := this.advance()
+	if err != nil {
+		return err
+	}
+
+	if this.current.kind == tokenName {
+		op.name = this.current.value
+		err = this.advance()
+		if err != nil {
+			return err
+		}
+	}
+
+	// variable definitions
+	if this.isPunctuator("(") {
+		err = this.skipBalanced("(", ")")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = this.skipDirectives()
+	if err != nil {
+		return err
+	}
+
+	op.selectionSet, err = this.parseSelectionSet()
+	if err != nil {
+		return err
+	}
+	this.operations = append(this.operations, op)
+	return nil
+}
+
+func (this *parser) parseFragment() error {
+	err := this.advance()
+	if err != nil {
+		return err
+	}
+
+	name, err := this.expectName()
+	if err != nil {
+		return err
+	}
+
+	// on Type
+	if this.current.kind != tokenName || this.current.value != "on" {
+		return errors.New("expected 'on' in fragment '" + name + "'")
+	}
+	err = this.advance()
+	if err != nil {
+		return err
+	}
+	_, err = this.expectName()
+	if err != nil {
+		return err
+	}
+
+	err = this.skipDirectives()
+	if err != nil {
+		return err
+	}
+
+	set, err := this.parseSelectionSet()
+	if err != nil {
+		return err
+	}
+	this.fragments[name] = set
+	return nil
+}
+
+func (this *parser) parseSelectionSet() (*selectionSet, error) {
+	this.level++
+	defer func() {
+		this.level--
+	}()
+	if this.level > MaxNestingLevel {
+		return nil, ErrTooManyNestingLevels
+	}
+
+	err := this.expectPunctuator("{")
+	if err != nil {
+		return nil, err
+	}
+
+	var set = &selectionSet{}
+	for !this.isPunctuator("}") {
+		if this.current.kind == tokenEOF {
+			return nil, errors.New("unexpected end of query")
+		}
+
+		// fragment
+		if this.isPunctuator("...") {
+			err = this.advance()
+			if err != nil {
+				return nil, err
+			}
+
+			// fragment spread
+			if this.current.kind == tokenName && this.current.value != "on" {
+				set.fragments = append(set.fragments, this.current.value)
+				err = this.advance()
+				if err != nil {
+					return nil, err
+				}
+				err = this.skipDirectives()
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			// inline fragment
+			if this.current.kind == tokenName && this.current.value == "on" {
+				err = this.advance()
+				if err != nil {
+					return nil, err
+				}
+				_, err = this.expectName()
+				if err != nil {
+					return nil, err
+				}
+			}
+			err = this.skipDirectives()
+			if err != nil {
+				return nil, err
+			}
+			inlineSet, err := this.parseSelectionSet()
+			if err != nil {
+				return nil, err
+			}
+			set.inlines = append(set.inlines, inlineSet)
+			continue
+		}
+
+		// field
+		fieldName, err := this.expectName()
+		if err != nil {
+			return nil, err
+		}
+		this.fields++
+
+		// alias
+		if this.isPunctuator(":") {
+			this.aliases++
+			err = this.advance()
+			if err != nil {
+				return nil, err
+			}
+			fieldName, err = this.expectName()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if fieldName == "__schema" || fieldName == "__type" {
+			this.isIntrospected = true
+		}
+
+		// arguments
+		if this.isPunctuator("(") {
+			err = this.skipBalanced("(", ")")
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = this.skipDirectives()
+		if err != nil {
+			return nil, err
+		}
+
+		var subSet *selectionSet
+		if this.isPunctuator("{") {
+			subSet, err = this.parseSelectionSet()
+			if err != nil {
+				return nil, err
+			}
+		}
+		set.fields = append(set.fields, subSet)
+	}
+
+	return set, this.advance()
+}
+
+// 跳过指令：@name(args)
+func (this *parser) skipDirectives() error {
+	for this.isPunctuator("@") {
+		err := this.advance()
+		if err != nil {
+			return err
+		}
+		_, err = this.expectName()
+		if err != nil {
+			return err
+		}
+		if this.isPunctuator("(") {
+			err = this.skipBalanced("(", ")")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 跳过成对的括号及其中的内容
+func (this *parser) skipBalanced(open string, close string) error {
+	var depth = 0
+	for {
+		if this.current.kind == tokenEOF {
+			return errors.New("unexpected end of query")
+		}
+		if this.isPunctuator(open) {
+			depth++
+			if depth > MaxNestingLevel {
+				return ErrTooManyNestingLevels
+			}
+		} else if this.isPunctuator(close) {
+			depth--
+		}
+		err := this.advance()
+		if err != nil {
+			return err
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// 计算选择集深度，展开片段引用
+func (this *parser) depth(set *selectionSet, visitingFragments map[string]bool) int {
+	if set == nil {
+		return 0
+	}
+
+	var maxDepth = 0
+	for _, field := range set.fields {
+		var d = 1 + this.depth(field, visitingFragments)
+		if d > maxDepth {
+			maxDepth = d
+		}
+	}
+	for _, inline := range set.inlines {
+		var d = this.depth(inline, visitingFragments)
+		if d > maxDepth {
+			maxDepth = d
+		}
+	}
+	for _, fragmentName := range set.fragments {
+		// 防止循环引用
+		if visitingFragments[fragmentName] {
+			continue
+		}
+		fragmentSet, ok := this.fragments[fragmentName]
+		if !ok {
+			continue
+		}
+
+		d, ok := this.fragmentDepths[fragmentName]
+		if !ok {
+			visitingFragments[fragmentName] = true
+			d = this.depth(fragmentSet, visitingFragments)
+			delete(visitingFragments, fragmentName)
+			this.fragmentDepths[fragmentName] = d
+		}
+		if d > maxDepth {
+			maxDepth = d
+		}
+	}
+	return maxDepth
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package graphqlutils_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/waf/graphqlutils"
+	"github.com/iwind/TeaGo/assert"
+	"strings"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		info, err := graphqlutils.ParseQuery(`{ user(id: 1) { name } }`, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(info.OperationType == graphqlutils.OperationTypeQuery)
+		a.IsTrue(info.OperationName == "")
+		a.IsTrue(info.Depth == 2)
+		a.IsTrue(info.Aliases == 0)
+		a.IsFalse(info.IsIntrospected)
+	}
+
+	{
+		info, err := graphqlutils.ParseQuery(`
+# comment
+query GetUser($id: ID!, $filter: Filter = {a: 1, b: [1, 2]}) @cached(ttl: 60) {
+	a: user(id: $id) { name, friends { name } }
+	b: user(id: "2") { ...UserFields }
+}
+
+mutation UpdateUser {
+	updateUser(input: {name: "lily"}) { id }
+}
+
+fragment UserFields on User {
+	id
+	posts { comments { author { name } } }
+}
+`, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(info.OperationType == graphqlutils.OperationTypeQuery)
+		a.IsTrue(info.OperationName == "GetUser")
+		a.IsTrue(info.Depth == 5)
+		a.IsTrue(info.Aliases == 2)
+	}
+
+	{
+		info, err := graphqlutils.ParseQuery(`query A { a } mutation B { b { c } }`, "B")
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(info.OperationType == graphqlutils.OperationTypeMutation)
+		a.IsTrue(info.OperationName == "B")
+		a.IsTrue(info.Depth == 2)
+	}
+
+	{
+		_, err := graphqlutils.ParseQuery(`query A { a }`, "C")
+		a.IsNotNil(err)
+	}
+
+	{
+		info, err := graphqlutils.ParseQuery(`query IntrospectionQuery { __schema { types { name } } }`, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(info.IsIntrospected)
+	}
+
+	{
+		info, err := graphqlutils.ParseQuery(`{ search { ... on User { name } ... @include(if: true) { id } } __typename }`, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(info.Depth == 2)
+		a.IsFalse(info.IsIntrospected)
+	}
+
+	{
+		// recursive fragments
+		info, err := graphqlutils.ParseQuery(`{ ...A } fragment A on Query { a { ...B } } fragment B on Query { b { ...A } }`, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(info.Depth == 2)
+	}
+
+	{
+		_, err := graphqlutils.ParseQuery(`{ a `, "")
+		a.IsNotNil(err)
+	}
+
+	{
+		_, err := graphqlutils.ParseQuery(`not graphql`, "")
+		a.IsNotNil(err)
+	}
+}
+
+func TestParseQuery_TooDeep(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var query = strings.Repeat("{ a ", 1000) + strings.Repeat("}", 1000)
+	info, err := graphqlutils.ParseQuery(query, "")
+	a.IsTrue(err == graphqlutils.ErrTooManyNestingLevels)
+	a.IsNotNil(info)
+	a.IsTrue(info.Depth > graphqlutils.MaxNestingLevel)
+}
+
+func BenchmarkParseQuery(b *testing.B) {
+	var query = `query GetUser($id: ID!) { user(id: $id) { name friends(first: 10) { name avatar(size: 64) } } }`
+	for i := 0; i < b.N; i++ {
+		_, _ = graphqlutils.ParseQuery(query, "")
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package injectionutils
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/waf/utils"
+	"strings"
+)
+
+type shellCommandLevel = int8
+
+const (
+	shellCommandLevelNone   shellCommandLevel = 0
+	shellCommandLevelWeak   shellCommandLevel = 1 // 同时也是常见单词的命令，需要有参数特征才认为是命令
+	shellCommandLevelStrong shellCommandLevel = 2
+)
+
+// 常见的可被用来执行攻击的命令
+var shellCommandMap = map[string]shellCommandLevel{}
+
+func init() {
+	for _, command := range []string{
+		// unix
+		"awk", "base64", "bash", "busybox", "chmod", "chown", "crontab", "csh", "curl", "dash", "eval", "exec", "gcc", "grep", "hostname", "id", "ifconfig", "killall", "ksh", "ls", "lua", "lynx", "mkfifo", "mknod", "nc", "ncat", "netcat", "netstat", "nohup", "nslookup", "nmap", "openssl", "passwd", "perl", "php", "ping", "pkill", "printenv", "ps", "pwd", "python", "python2", "python3", "rm", "rmdir", "ruby", "scp", "sed", "sh", "socat", "ssh", "sudo", "tclsh", "telnet", "tftp", "uname", "useradd", "wget", "whoami", "xargs", "xterm", "zsh",
+
+		// windows
+		"certutil", "cmd", "cscript", "ipconfig", "mshta", "powershell", "pwsh", "regsvr32", "rundll32", "systeminfo", "taskkill", "tasklist", "wmic", "wscript",
+	} {
+		shellCommandMap[command] = shellCommandLevelStrong
+	}
+
+	for _, command := range []string{
+		"cat", "cc", "cp", "dd", "del", "diff", "dig", "dir", "echo", "env", "expr", "fetch", "find", "ftp", "groups", "head", "host", "ip", "kill", "less", "ln", "mail", "more", "mv", "net", "node", "reg", "sleep", "tail", "tar", "tee", "touch", "type", "ver", "who",
+	} {
+		shellCommandMap[command] = shellCommandLevelWeak
+	}
+}
+
+// DetectCommandInjectionCache detect os command injection in string with cache
+func DetectCommandInjectionCache(input string, isStrict bool, cacheLife utils.CacheLife) bool {
+	return detectCache("CMDI", input, isStrict, cacheLife, 128, DetectCommandInjection)
+}
+
+// DetectCommandInjection detect os command injection in string
+func DetectCommandInjection(input string, isStrict bool) bool {
+	if len(input) == 0 {
+		return false
+	}
+
+	for _, s := range decodeLevels(input) {
+		if detectCommandInjectionOne(s, isStrict) {
+			return true
+		}
+	}
+	return false
+}
+
+func detectCommandInjectionOne(input string, isStrict bool) bool {
+	var l = len(input)
+
+	// 严格模式下，以命令开头并带有参数也视为注入，比如 cat /etc/passwd
+	if isStrict {
+		command, end := readShellWord(input, 0)
+		if shellCommandMap[command] > shellCommandLevelNone && end < l && (input[end] == ' ' || input[end] == '\t') {
+			var argStart = skipShellSpaces(input, end)
+			if argStart < l && (input[argStart] == '-' || input[argStart] == '/' || input[argStart] == '$' || input[argStart] == '|' || input[argStart] == '>' || input[argStart] == '<') {
+				return true
+			}
+		}
+	}
+
+	for i := 0; i < l; i++ {
+		var c = input[i]
+		switch c {
+		case '\n', '\r':
+			// 非严格模式下，换行后的命令需要有Shell上下文，防止误判多行的普通文本
+			if matchShellCommandAt(input, i+1, isStrict) && (isStrict || hasShellContextInLine(input, i+1)) {
+				return true
+			}
+		case ';', '|', '&':
+			// 连续的分隔符：||、&&
+			var j = i + 1
+			for j < l && (input[j] == '|' || input[j] == '&') {
+				j++
+			}
+			if matchShellCommandAt(input, j, isStrict) {
+				return true
+			}
+			i = j - 1
+		case '`':
+			var end = strings.IndexByte(input[i+1:], '`')
+			if end < 0 {
+				if isStrict && matchShellCommandAt(input, i+1, isStrict) {
+					return true
+				}
+				continue
+			}
+			if matchShellCommandAt(input, i+1, isStrict) {
+				return true
+			}
+		case '$':
+			if i+1 >= l {
+				continue
+			}
+			switch input[i+1] {
+			case '(':
+				// $((1+1)) 为算术表达式
+				if i+2 < l && input[i+2] == '(' {
+					if isStrict {
+						return true
+					}
+					continue
+				}
+				if matchShellCommandAt(input, i+2, isStrict) {
+					return true
+				}
+			case '{':
+				// ${IFS}
+				if isStrict && strings.HasPrefix(input[i+2:], "IFS") {
+					return true
+				}
+			case 'I':
+				if isStrict && strings.HasPrefix(input[i+1:], "IFS") {
+					return true
+				}
+			}
+		case '>', '<':
+			// 重定向到敏感路径
+			if isStrict {
+				var j = i + 1
+				if j < l && (input[j] == '>' || input[j] == '&' || input[j] == '(') {
+					j++
+				}
+				j = skipShellSpaces(input, j)
+				if strings.HasPrefix(input[j:], "/dev/tcp/") || strings.HasPrefix(input[j:], "/dev/udp/") {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// 检查某个位置开始是否为命令
+func matchShellCommandAt(input string, start int, isStrict bool) bool {
+	var l = len(input)
+	start = skipShellSpaces(input, start)
+	if start >= l {
+		return false
+	}
+
+	// 跳过开头的引号、括号和转义符
+	for start < l {
+		var c = input[start]
+		if c == '(' || c == '{' || c == '\'' || c == '"' || c == '\\' {
+			start++
+			continue
+		}
+		break
+	}
+
+	var command, end = readShellWord(input, start)
+	if len(command) == 0 {
+		return false
+	}
+
+	// 命令之后必须为结束符，防止误判 a=1&id=2 之类的参数
+	if end < l && !isShellTerminator(input[end]) {
+		return false
+	}
+
+	switch shellCommandMap[command] {
+	case shellCommandLevelStrong:
+		return true
+	case shellCommandLevelWeak:
+		if isStrict {
+			return true
+		}
+
+		// 结尾，或者参数以 - / $ 等开头
+		var argStart = skipShellSpaces(input, end)
+		if argStart >= l {
+			return true
+		}
+		switch input[argStart] {
+		case '-', '/', '$', '~', '.', ';', '|', '&', '<', '>', '`':
+			return true
+		}
+		return false
+	}
+
+	// 严格模式下绝对路径命令，比如 /usr/local/bin/xxx
+	if isStrict && input[start] == '/' && strings.Count(input[start:end], "/") >= 2 {
+		return true
+	}
+
+	return false
+}
+
+// 检查某一行中命令之后是否有Shell上下文：参数以 - / $ ~ 开头，或者同一行中有Shell元字符
+func hasShellContextInLine(input string, start int) bool {
+	var lineEnd = strings.IndexAny(input[start:], "\r\n")
+	if lineEnd < 0 {
+		lineEnd = len(input)
+	} else {
+		lineEnd += start
+	}
+	var line = input[start:lineEnd]
+	if strings.ContainsAny(line, ";|&`$<>") {
+		return true
+	}
+
+	var _, end = readShellWord(line, skipShellSpaces(line, 0))
+	var argStart = skipShellSpaces(line, end)
+	if argStart >= len(line) {
+		return false
+	}
+	switch line[argStart] {
+	case '-', '/', '~':
+		return true
+	}
+	return false
+}
+
+// 读取一个单词，去除其中用来混淆的引号和反斜杠，并返回小写的命令名
+func readShellWord(input string, start int) (word string, end int) {
+	var l = len(input)
+	var builder = strings.Builder{}
+	var i = start
+	for ; i < l; i++ {
+		var c = input[i]
+		if c == '\'' || c == '"' || c == '\\' {
+			// 引号后紧跟结束符时，引号不属于单词
+			if c != '\\' && (i+1 >= l || isShellTerminator(input[i+1])) {
+				break
+			}
+			continue
+		}
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '.' || c == '/' || c == '-' {
+			builder.WriteByte(c)
+			continue
+		}
+		break
+	}
+
+	word = strings.ToLower(builder.String())
+
+	// 去除路径
+	var slashIndex = strings.LastIndexByte(word, '/')
+	if slashIndex >= 0 {
+		word = word[slashIndex+1:]
+	}
+
+	// 去除Windows扩展名
+	word = strings.TrimSuffix(word, ".exe")
+
+	return word, i
+}
+
+func skipShellSpaces(input string, start int) int {
+	for start < len(input) && (input[start] == ' ' || input[start] == '\t') {
+		start++
+	}
+	return start
+}
+
+func isShellTerminator(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\r', ';', '|', '&', '<', '>', '`', ')', '}', '$', '\'', '"', '#':
+		return true
+	}
+	return false
+}
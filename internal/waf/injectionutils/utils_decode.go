@@ -0,0 +1,133 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package injectionutils
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/utils/fasttime"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/utils"
+	"github.com/cespare/xxhash/v2"
+	"strconv"
+	"strings"
+)
+
+// 最多解码层级
+const maxDecodeLevels = 3
+
+// 使用缓存检测
+func detectCache(prefix string, input string, isStrict bool, cacheLife utils.CacheLife, minCacheSize int, detectFunc func(input string, isStrict bool) bool) bool {
+	var l = len(input)
+
+	if l == 0 {
+		return false
+	}
+
+	if cacheLife <= 0 || l < minCacheSize || l > utils.MaxCacheDataSize {
+		return detectFunc(input, isStrict)
+	}
+
+	var hash = xxhash.Sum64String(input)
+	var key = "WAF@" + prefix + "@" + strconv.FormatUint(hash, 10)
+	if isStrict {
+		key += "@1"
+	}
+	var item = utils.SharedCache.Read(key)
+	if item != nil {
+		return item.Value == 1
+	}
+
+	var result = detectFunc(input, isStrict)
+	if result {
+		utils.SharedCache.Write(key, 1, fasttime.Now().Unix()+cacheLife)
+	} else {
+		utils.SharedCache.Write(key, 0, fasttime.Now().Unix()+cacheLife)
+	}
+	return result
+}
+
+// 多层解码，返回原始字符串及每一层解码后不同的结果
+func decodeLevels(input string) []string {
+	var result = []string{input}
+	var s = input
+	for i := 0; i < maxDecodeLevels; i++ {
+		var decoded = percentDecode(s)
+		if decoded == s {
+			break
+		}
+		result = append(result, decoded)
+		s = decoded
+	}
+	return result
+}
+
+// 宽松的URL解码，同时支持%uXXXX和常见的UTF-8超长编码，无法解码的部分保持原样
+func percentDecode(s string) string {
+	if strings.IndexByte(s, '%') < 0 && strings.IndexByte(s, '+') < 0 {
+		return s
+	}
+
+	var builder = strings.Builder{}
+	builder.Grow(len(s))
+
+	var l = len(s)
+	for i := 0; i < l; i++ {
+		var c = s[i]
+		switch c {
+		case '+':
+			builder.WriteByte(' ')
+		case '%':
+			// %uXXXX
+			if i+5 < l && (s[i+1] == 'u' || s[i+1] == 'U') {
+				v, ok := parseHexBytes(s[i+2 : i+6])
+				if ok && v < 0x80 {
+					builder.WriteByte(byte(v))
+					i += 5
+					continue
+				}
+			}
+
+			// %XX
+			if i+2 < l {
+				v, ok := parseHexBytes(s[i+1 : i+3])
+				if ok {
+					// 超长编码：%c0%ae => '.', %c0%af => '/', %c1%9c => '\'
+					if (v == 0xc0 || v == 0xc1) && i+5 < l && s[i+3] == '%' {
+						v2, ok2 := parseHexBytes(s[i+4 : i+6])
+						if ok2 && v2&0xc0 == 0x80 {
+							builder.WriteByte(byte((v&0x1f)<<6 | (v2 & 0x3f)))
+							i += 5
+							continue
+						}
+					}
+
+					builder.WriteByte(byte(v))
+					i += 2
+					continue
+				}
+			}
+			builder.WriteByte(c)
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	return builder.String()
+}
+
+func parseHexBytes(s string) (v int, ok bool) {
+	if len(s) == 0 {
+		return 0, false
+	}
+	for i := 0; i < len(s); i++ {
+		var c = s[i]
+		switch {
+		case c >= '0' && c <= '9':
+			v = v<<4 | int(c-'0')
+		case c >= 'a' && c <= 'f':
+			v = v<<4 | int(c-'a'+10)
+		case c >= 'A' && c <= 'F':
+			v = v<<4 | int(c-'A'+10)
+		default:
+			return 0, false
+		}
+	}
+	return v, true
+}
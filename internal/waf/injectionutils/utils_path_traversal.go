@@ -0,0 +1,142 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package injectionutils
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/waf/utils"
+	"strings"
+)
+
+// 常见的敏感文件和目录
+var sensitivePathList = []string{
+	"/etc/passwd",
+	"/etc/shadow",
+	"/etc/group",
+	"/etc/hosts",
+	"/etc/issue",
+	"/etc/crontab",
+	"/etc/sudoers",
+	"/proc/self/",
+	"/proc/version",
+	"/.ssh/",
+	"/.git/",
+	"/.svn/",
+	"/.env",
+	"/.htaccess",
+	"/.htpasswd",
+	"/web-inf/",
+	"/meta-inf/",
+	"/boot.ini",
+	"/win.ini",
+	"/system.ini",
+	"/windows/system32/",
+	"/winnt/system32/",
+}
+
+// DetectPathTraversalCache detect path traversal in string with cache
+func DetectPathTraversalCache(input string, isStrict bool, cacheLife utils.CacheLife) bool {
+	return detectCache("PATH", input, isStrict, cacheLife, 128, DetectPathTraversal)
+}
+
+// DetectPathTraversal detect path traversal in string
+func DetectPathTraversal(input string, isStrict bool) bool {
+	if len(input) == 0 {
+		return false
+	}
+
+	var rawClimbs = 0
+	for index, s := range decodeLevels(input) {
+		s = strings.ToLower(strings.ReplaceAll(s, "\\", "/"))
+
+		var climbs = countPathClimbs(s)
+		if index == 0 {
+			rawClimbs = climbs
+		}
+
+		if climbs > 0 {
+			if isStrict || climbs >= 2 {
+				return true
+			}
+
+			// 经过编码的 ../
+			if index > 0 && rawClimbs == 0 {
+				return true
+			}
+
+			if containsSensitivePath(s) {
+				return true
+			}
+
+			// 空字节截断
+			if strings.IndexByte(s, 0) >= 0 {
+				return true
+			}
+		}
+
+		// 严格模式下直接访问敏感文件
+		if isStrict && containsSensitivePath(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 计算 ../ 层级数
+func countPathClimbs(s string) int {
+	var count = 0
+	var l = len(s)
+	for i := 0; i+1 < l; i++ {
+		if s[i] != '.' || s[i+1] != '.' {
+			continue
+		}
+
+		// 允许 ... 等多个点
+		var start = i
+		var end = i + 2
+		for end < l && s[end] == '.' {
+			end++
+		}
+		i = end - 1
+
+		// 前面必须为开头或者分隔符
+		if start > 0 && !isPathBoundary(s[start-1]) {
+			continue
+		}
+
+		// 后面必须为 / 或者结尾，同时兼容 ..;/ 和 ../\0
+		if end == l {
+			// 单独的 .. 不是路径
+			if start > 0 && s[start-1] == '/' {
+				count++
+			}
+			continue
+		}
+		switch s[end] {
+		case '/', 0:
+			count++
+		case ';':
+			if end+1 < l && s[end+1] == '/' {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func isPathBoundary(c byte) bool {
+	switch c {
+	case '/', '=', '?', '&', ':', ';', '\'', '"', ' ', '\t', ',', '(', '[', '{', '<', '>', '|':
+		return true
+	}
+	return false
+}
+
+func containsSensitivePath(s string) bool {
+	for _, path := range sensitivePathList {
+		if strings.Contains(s, path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package injectionutils_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/waf/injectionutils"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/utils"
+	"github.com/iwind/TeaGo/assert"
+	"runtime"
+	"testing"
+)
+
+func TestDetectPathTraversal(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	for _, isStrict := range []bool{true, false} {
+		a.IsFalse(injectionutils.DetectPathTraversal("", isStrict))
+		a.IsFalse(injectionutils.DetectPathTraversal("/hello/world.html", isStrict))
+		a.IsFalse(injectionutils.DetectPathTraversal("wait...", isStrict))
+		a.IsFalse(injectionutils.DetectPathTraversal("a..b/c", isStrict))
+		a.IsFalse(injectionutils.DetectPathTraversal("version=1.2..3", isStrict))
+		a.IsTrue(injectionutils.DetectPathTraversal("../../etc/passwd", isStrict))
+		a.IsTrue(injectionutils.DetectPathTraversal("file=../../../../windows/win.ini", isStrict))
+		a.IsTrue(injectionutils.DetectPathTraversal("..\\..\\boot.ini", isStrict))
+		a.IsTrue(injectionutils.DetectPathTraversal("../etc/passwd", isStrict))
+		a.IsTrue(injectionutils.DetectPathTraversal("%2e%2e%2fconfig.php", isStrict))
+		a.IsTrue(injectionutils.DetectPathTraversal("%252e%252e%252fconfig.php", isStrict))
+		a.IsTrue(injectionutils.DetectPathTraversal("%25252e%25252e%25252fconfig.php", isStrict))
+		a.IsTrue(injectionutils.DetectPathTraversal("%c0%ae%c0%ae%c0%afconfig.php", isStrict))
+		a.IsTrue(injectionutils.DetectPathTraversal("%u002e%u002e%u002fconfig.php", isStrict))
+		a.IsTrue(injectionutils.DetectPathTraversal("/app/..;/..;/manager/html", isStrict))
+		a.IsTrue(injectionutils.DetectPathTraversal("../config.php%00.png", isStrict))
+	}
+}
+
+func TestDetectPathTraversal_Strict(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	a.IsFalse(injectionutils.DetectPathTraversal("../images/logo.png", false))
+	a.IsTrue(injectionutils.DetectPathTraversal("../images/logo.png", true))
+	a.IsFalse(injectionutils.DetectPathTraversal("/etc/passwd", false))
+	a.IsTrue(injectionutils.DetectPathTraversal("/etc/passwd", true))
+	a.IsFalse(injectionutils.DetectPathTraversal("file=/proc/self/environ", false))
+	a.IsTrue(injectionutils.DetectPathTraversal("file=/proc/self/environ", true))
+}
+
+func BenchmarkDetectPathTraversal(b *testing.B) {
+	runtime.GOMAXPROCS(4)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = injectionutils.DetectPathTraversal("%252e%252e%252f%252e%252e%252fetc/passwd", false)
+		}
+	})
+}
+
+func BenchmarkDetectPathTraversal_Normal(b *testing.B) {
+	runtime.GOMAXPROCS(4)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = injectionutils.DetectPathTraversal("/static/js/app.min.js?v=1.2.3", false)
+		}
+	})
+}
+
+func BenchmarkDetectPathTraversal_Cache(b *testing.B) {
+	runtime.GOMAXPROCS(4)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = injectionutils.DetectPathTraversalCache("/static/js/app.min.js?v=1.2.3", false, utils.CacheMiddleLife)
+		}
+	})
+}
@@ -0,0 +1,316 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package injectionutils
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/waf/utils"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// 内网、本地、链路本地及元数据服务地址
+var ssrfIPNets = []*net.IPNet{}
+
+// 常见的指向内网的域名
+var ssrfHostnames = []string{
+	"localhost",
+	"localhost.localdomain",
+	"metadata",
+	"metadata.google.internal",
+	"metadata.azure.com",
+	"instance-data",
+	"instance-data.ec2.internal",
+}
+
+// 可将IP编码在域名中的泛解析服务
+var ssrfWildcardDomains = []string{
+	".localhost",
+	".nip.io",
+	".xip.io",
+	".sslip.io",
+	".localtest.me",
+	".lvh.me",
+}
+
+// 危险的协议
+var ssrfDangerousSchemes = map[string]bool{
+	"gopher": true,
+	"dict":   true,
+	"ldap":   true,
+	"tftp":   true,
+	"jar":    true,
+	"netdoc": true,
+}
+
+func init() {
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10", // 运营商级NAT，同时包含阿里云元数据地址 100.100.100.200
+		"127.0.0.0/8",
+		"169.254.0.0/16", // 链路本地，包含元数据地址 169.254.169.254
+		"172.16.0.0/12",
+		"192.0.0.0/24",
+		"192.168.0.0/16",
+		"198.18.0.0/15",
+		"::/128",
+		"::1/128",
+		"fc00::/7",
+		"fe80::/10",
+	} {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err == nil {
+			ssrfIPNets = append(ssrfIPNets, ipNet)
+		}
+	}
+}
+
+// DetectSSRFCache detect ssrf targets in string with cache
+func DetectSSRFCache(input string, isStrict bool, cacheLife utils.CacheLife) bool {
+	return detectCache("SSRF", input, isStrict, cacheLife, 64, DetectSSRF)
+}
+
+// DetectSSRF detect ssrf targets in string
+// 非严格模式下只检查带协议的URL，严格模式下同时检查单独的主机地址
+func DetectSSRF(input string, isStrict bool) bool {
+	if len(input) == 0 {
+		return false
+	}
+
+	for _, s := range decodeLevels(input) {
+		if detectSSRFOne(s, isStrict) {
+			return true
+		}
+	}
+	return false
+}
+
+func detectSSRFOne(input string, isStrict bool) bool {
+	var hasURL = false
+
+	// 查找所有的 scheme://
+	var offset = 0
+	for {
+		var index = strings.Index(input[offset:], "://")
+		if index < 0 {
+			break
+		}
+		index += offset
+		offset = index + 3
+		hasURL = true
+
+		// scheme
+		var schemeStart = index
+		for schemeStart > 0 && isSchemeChar(input[schemeStart-1]) {
+			schemeStart--
+		}
+		var scheme = strings.ToLower(input[schemeStart:index])
+		if ssrfDangerousSchemes[scheme] {
+			return true
+		}
+		if isStrict && scheme == "file" {
+			return true
+		}
+
+		// authority
+		var authority = input[offset:]
+		var end = strings.IndexAny(authority, "/?#\\ \t\r\n\"'<>")
+		if end >= 0 {
+			authority = authority[:end]
+		}
+		if isSSRFHost(authority, isStrict) {
+			return true
+		}
+	}
+
+	// 协议相对地址：//127.0.0.1/
+	if !hasURL && strings.HasPrefix(input, "//") {
+		var authority = input[2:]
+		var end = strings.IndexAny(authority, "/?#\\")
+		if end >= 0 {
+			authority = authority[:end]
+		}
+		if isSSRFHost(authority, isStrict) {
+			return true
+		}
+	}
+
+	// 单独的主机地址
+	if !hasURL && isStrict && len(input) <= 256 && strings.IndexAny(input, " \t\r\n/?#") < 0 && !isPlainNumber(input) {
+		return isSSRFHost(input, isStrict)
+	}
+
+	return false
+}
+
+// 检查 [userinfo@]host[:port] 是否指向内部地址
+func isSSRFHost(authority string, isStrict bool) bool {
+	// 去除userinfo，使用最后一个@，防止 http://example.com@127.0.0.1/ 之类的绕过
+	var atIndex = strings.LastIndexByte(authority, '@')
+	if atIndex >= 0 {
+		authority = authority[atIndex+1:]
+	}
+	if len(authority) == 0 {
+		return false
+	}
+
+	var host = authority
+
+	// IPv6
+	if host[0] == '[' {
+		var end = strings.IndexByte(host, ']')
+		if end < 0 {
+			return false
+		}
+		host = host[1:end]
+
+		// zone
+		var zoneIndex = strings.IndexByte(host, '%')
+		if zoneIndex >= 0 {
+			host = host[:zoneIndex]
+		}
+
+		var ip = net.ParseIP(host)
+		return ip != nil && isSSRFIP(ip)
+	}
+
+	// 不带括号的IPv6
+	if strings.Count(host, ":") >= 2 {
+		var ip = net.ParseIP(host)
+		return ip != nil && isSSRFIP(ip)
+	}
+
+	// port
+	var colonIndex = strings.LastIndexByte(host, ':')
+	if colonIndex >= 0 {
+		host = host[:colonIndex]
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if len(host) == 0 {
+		return false
+	}
+
+	var ip = parseLooseIPv4(host)
+	if ip != nil {
+		return isSSRFIP(ip)
+	}
+
+	for _, hostname := range ssrfHostnames {
+		if host == hostname {
+			return true
+		}
+	}
+
+	if isStrict {
+		for _, domain := range ssrfWildcardDomains {
+			if strings.HasSuffix(host, domain) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isSSRFIP(ip net.IP) bool {
+	var ipv4 = ip.To4()
+	if ipv4 != nil {
+		ip = ipv4
+	}
+	for _, ipNet := range ssrfIPNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 按照 inet_aton 的规则解析IPv4，支持 2130706433、0x7f000001、0177.0.0.1、127.1 等写法
+func parseLooseIPv4(host string) net.IP {
+	if len(host) == 0 {
+		return nil
+	}
+
+	// 必须以数字开头
+	if host[0] < '0' || host[0] > '9' {
+		return nil
+	}
+
+	var pieces = strings.Split(host, ".")
+	if len(pieces) > 4 {
+		return nil
+	}
+
+	var values = make([]uint64, 0, 4)
+	for _, piece := range pieces {
+		if len(piece) == 0 {
+			return nil
+		}
+
+		var base = 10
+		var digits = piece
+		if len(piece) > 2 && (piece[:2] == "0x" || piece[:2] == "0X") {
+			base = 16
+			digits = piece[2:]
+		} else if len(piece) > 1 && piece[0] == '0' {
+			base = 8
+			digits = piece[1:]
+		}
+
+		v, err := strconv.ParseUint(digits, base, 32)
+		if err != nil {
+			return nil
+		}
+		values = append(values, v)
+	}
+
+	// 最后一部分填充剩余的字节
+	var result uint64
+	var count = len(values)
+	for i, v := range values {
+		if i < count-1 {
+			if v > 0xff {
+				return nil
+			}
+			result |= v << (8 * uint(3-i))
+		} else {
+			var maxValue uint64 = 1<<(8*uint(4-i)) - 1
+			if v > maxValue {
+				return nil
+			}
+			result |= v
+		}
+	}
+
+	return net.IPv4(byte(result>>24), byte(result>>16), byte(result>>8), byte(result))
+}
+
+func isSchemeChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '+' || c == '-' || c == '.'
+}
+
+// 判断是否为普通的数字，比如 123、12.5，用来排除单独主机地址检查中的误判
+// 大于等于 2^24 的整数仍然可能是十进制形式的IP
+func isPlainNumber(s string) bool {
+	var dots = 0
+	for i := 0; i < len(s); i++ {
+		var c = s[i]
+		if c == '.' {
+			dots++
+			continue
+		}
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	switch dots {
+	case 0:
+		v, err := strconv.ParseUint(s, 10, 64)
+		return err != nil || v < 1<<24
+	case 1:
+		return true
+	}
+	return false
+}
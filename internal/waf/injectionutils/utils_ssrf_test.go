@@ -0,0 +1,94 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package injectionutils_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/waf/injectionutils"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/utils"
+	"github.com/iwind/TeaGo/assert"
+	"runtime"
+	"testing"
+)
+
+func TestDetectSSRF(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	for _, isStrict := range []bool{true, false} {
+		a.IsFalse(injectionutils.DetectSSRF("", isStrict))
+		a.IsFalse(injectionutils.DetectSSRF("hello", isStrict))
+		a.IsFalse(injectionutils.DetectSSRF("12345", isStrict))
+		a.IsFalse(injectionutils.DetectSSRF("3.14", isStrict))
+		a.IsFalse(injectionutils.DetectSSRF("https://example.com/a.png", isStrict))
+		a.IsFalse(injectionutils.DetectSSRF("https://8.8.8.8/", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://127.0.0.1/admin", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://localhost:8080/", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://169.254.169.254/latest/meta-data/", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://metadata.google.internal/computeMetadata/v1/", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://100.100.100.200/latest/meta-data/", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://10.0.0.1", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://172.16.0.1", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://192.168.1.1", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://2130706433/", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://0x7f000001/", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://0177.0.0.1/", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://0x7f.0.0.1/", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://127.1/", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://0/", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://[::1]/", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://[::ffff:127.0.0.1]/", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://[fe80::1%25eth0]/", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://[fd00:ec2::254]/", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("http://example.com@127.0.0.1/", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("url=http%3A%2F%2F127.0.0.1%2F", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("gopher://example.com:6379/_INFO", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("dict://example.com:11211/stats", isStrict))
+		a.IsTrue(injectionutils.DetectSSRF("//127.0.0.1/", isStrict))
+	}
+}
+
+func TestDetectSSRF_Strict(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	a.IsFalse(injectionutils.DetectSSRF("127.0.0.1", false))
+	a.IsTrue(injectionutils.DetectSSRF("127.0.0.1", true))
+	a.IsFalse(injectionutils.DetectSSRF("127.0.0.1:6379", false))
+	a.IsTrue(injectionutils.DetectSSRF("127.0.0.1:6379", true))
+	a.IsFalse(injectionutils.DetectSSRF("2130706433", false))
+	a.IsTrue(injectionutils.DetectSSRF("2130706433", true))
+	a.IsFalse(injectionutils.DetectSSRF("::1", false))
+	a.IsTrue(injectionutils.DetectSSRF("::1", true))
+	a.IsFalse(injectionutils.DetectSSRF("http://127.0.0.1.nip.io/", false))
+	a.IsTrue(injectionutils.DetectSSRF("http://127.0.0.1.nip.io/", true))
+	a.IsFalse(injectionutils.DetectSSRF("file:///etc/passwd", false))
+	a.IsTrue(injectionutils.DetectSSRF("file:///etc/passwd", true))
+	a.IsFalse(injectionutils.DetectSSRF("8.8.8.8", true))
+	a.IsFalse(injectionutils.DetectSSRF("example.com", true))
+}
+
+func BenchmarkDetectSSRF(b *testing.B) {
+	runtime.GOMAXPROCS(4)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = injectionutils.DetectSSRF("http://example.com@0x7f000001/admin", false)
+		}
+	})
+}
+
+func BenchmarkDetectSSRF_Normal(b *testing.B) {
+	runtime.GOMAXPROCS(4)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = injectionutils.DetectSSRF("https://example.com/images/logo.png", false)
+		}
+	})
+}
+
+func BenchmarkDetectSSRF_Cache(b *testing.B) {
+	runtime.GOMAXPROCS(4)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = injectionutils.DetectSSRFCache("https://example.com/images/logo.png", false, utils.CacheMiddleLife)
+		}
+	})
+}
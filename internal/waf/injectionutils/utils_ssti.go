@@ -0,0 +1,188 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package injectionutils
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/waf/utils"
+	"strings"
+)
+
+// 模板表达式的开始和结束标记
+var templateDelimiters = [][2]string{
+	{"{{", "}}"},  // jinja2, twig, handlebars, go template
+	{"{%", "%}"},  // jinja2, twig statements
+	{"${", "}"},   // freemarker, velocity, spring el, thymeleaf
+	{"#{", "}"},   // jsf el, ruby
+	{"*{", "}"},   // thymeleaf
+	{"@{", "}"},   // thymeleaf
+	{"<%", "%>"},  // erb, jsp, ejs
+	{"<#", ">"},   // freemarker directives
+	{"{php}", ""}, // smarty
+}
+
+// 模板表达式中的危险关键词
+var templateDangerousKeywords = []string{
+	"__class__",
+	"__mro__",
+	"__base__",
+	"__bases__",
+	"__subclasses__",
+	"__globals__",
+	"__builtins__",
+	"__import__",
+	"__init__",
+	"__getattribute__",
+	"request.application",
+	"config.items",
+	"self._",
+	"lipsum.",
+	"cycler.",
+	"joiner.",
+	"namespace.",
+	"getclass",
+	"forname",
+	"classloader",
+	"java.lang",
+	"runtime",
+	"processbuilder",
+	"freemarker.template",
+	"utility.execute",
+	"objectconstructor",
+	"new(",
+	"constructor",
+	"eval(",
+	"exec(",
+	"system(",
+	"popen",
+	"subprocess",
+	"require(",
+	"process.",
+	"child_process",
+	"file_get_contents",
+	"passthru",
+	"shell_exec",
+	"_self.env",
+	"registerundefinedfiltercallback",
+	"getfilter",
+	"#set",
+	"#foreach",
+	"assign ",
+}
+
+// DetectTemplateInjectionCache detect server-side template injection in string with cache
+func DetectTemplateInjectionCache(input string, isStrict bool, cacheLife utils.CacheLife) bool {
+	return detectCache("SSTI", input, isStrict, cacheLife, 128, DetectTemplateInjection)
+}
+
+// DetectTemplateInjection detect server-side template injection in string
+func DetectTemplateInjection(input string, isStrict bool) bool {
+	if len(input) == 0 {
+		return false
+	}
+
+	for _, s := range decodeLevels(input) {
+		if detectTemplateInjectionOne(s, isStrict) {
+			return true
+		}
+	}
+	return false
+}
+
+func detectTemplateInjectionOne(input string, isStrict bool) bool {
+	// 快速检查
+	if strings.IndexAny(input, "{<#") < 0 {
+		return false
+	}
+
+	for _, delimiter := range templateDelimiters {
+		var offset = 0
+		for {
+			var index = strings.Index(input[offset:], delimiter[0])
+			if index < 0 {
+				break
+			}
+			index += offset
+			offset = index + len(delimiter[0])
+
+			// 只要出现开始标记即可
+			if len(delimiter[1]) == 0 {
+				return true
+			}
+
+			var expr string
+			var end = strings.Index(input[offset:], delimiter[1])
+			if end < 0 {
+				// 没有结束标记时，严格模式下仍然检查剩余的部分
+				if !isStrict {
+					break
+				}
+				expr = input[offset:]
+			} else {
+				expr = input[offset : offset+end]
+			}
+
+			if detectTemplateExpr(expr, isStrict) {
+				return true
+			}
+		}
+	}
+
+	// velocity
+	if isStrict && (strings.Contains(input, "#set(") || strings.Contains(input, "#foreach(")) {
+		return true
+	}
+
+	return false
+}
+
+// 检查模板表达式的内容
+func detectTemplateExpr(expr string, isStrict bool) bool {
+	// <%= ... %>、<%- ... %>
+	expr = strings.TrimSpace(strings.TrimLeft(expr, "=-"))
+	if len(expr) == 0 {
+		return false
+	}
+
+	// 算术表达式探测，比如 {{7*7}}、${7*'7'}
+	if isArithmeticProbe(expr) {
+		return true
+	}
+
+	var lowerExpr = strings.ToLower(expr)
+	for _, keyword := range templateDangerousKeywords {
+		if strings.Contains(lowerExpr, keyword) {
+			return true
+		}
+	}
+
+	if isStrict {
+		// 函数调用、属性访问、下标访问、过滤器等
+		for i := 0; i < len(expr); i++ {
+			switch expr[i] {
+			case '(', '[', '|', '.', '+', '*', '/', '=', '\'', '"':
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// 判断是否为只包含数字和运算符的表达式
+func isArithmeticProbe(expr string) bool {
+	var hasDigit = false
+	var hasOperator = false
+	for i := 0; i < len(expr); i++ {
+		var c = expr[i]
+		switch {
+		case c >= '0' && c <= '9':
+			hasDigit = true
+		case c == '*' || c == '+' || c == '-' || c == '/' || c == '%':
+			hasOperator = true
+		case c == ' ' || c == '\'' || c == '"' || c == '(' || c == ')':
+		default:
+			return false
+		}
+	}
+	return hasDigit && hasOperator
+}
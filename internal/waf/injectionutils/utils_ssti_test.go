@@ -0,0 +1,77 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package injectionutils_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/waf/injectionutils"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/utils"
+	"github.com/iwind/TeaGo/assert"
+	"runtime"
+	"testing"
+)
+
+func TestDetectTemplateInjection(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	for _, isStrict := range []bool{true, false} {
+		a.IsFalse(injectionutils.DetectTemplateInjection("", isStrict))
+		a.IsFalse(injectionutils.DetectTemplateInjection("hello world", isStrict))
+		a.IsFalse(injectionutils.DetectTemplateInjection(`{"name":"lily","tags":{"a":1}}`, isStrict))
+		a.IsFalse(injectionutils.DetectTemplateInjection("{{name}}", isStrict))
+		a.IsTrue(injectionutils.DetectTemplateInjection("{{7*7}}", isStrict))
+		a.IsTrue(injectionutils.DetectTemplateInjection("${7*7}", isStrict))
+		a.IsTrue(injectionutils.DetectTemplateInjection("#{7*7}", isStrict))
+		a.IsTrue(injectionutils.DetectTemplateInjection("<%= 7*7 %>", isStrict))
+		a.IsTrue(injectionutils.DetectTemplateInjection("{{7*'7'}}", isStrict))
+		a.IsTrue(injectionutils.DetectTemplateInjection("{{ ''.__class__.__mro__[1].__subclasses__() }}", isStrict))
+		a.IsTrue(injectionutils.DetectTemplateInjection("{{ config.items() }}", isStrict))
+		a.IsTrue(injectionutils.DetectTemplateInjection("{{ lipsum.__globals__['os'].popen('id').read() }}", isStrict))
+		a.IsTrue(injectionutils.DetectTemplateInjection("${T(java.lang.Runtime).getRuntime().exec('id')}", isStrict))
+		a.IsTrue(injectionutils.DetectTemplateInjection(`<#assign ex="freemarker.template.utility.Execute"?new()>${ex("id")}`, isStrict))
+		a.IsTrue(injectionutils.DetectTemplateInjection("{{constructor.constructor('alert(1)')()}}", isStrict))
+		a.IsTrue(injectionutils.DetectTemplateInjection("{php}echo `id`;{/php}", isStrict))
+		a.IsTrue(injectionutils.DetectTemplateInjection("name=%7B%7B7*7%7D%7D", isStrict))
+		a.IsTrue(injectionutils.DetectTemplateInjection("name=%257B%257B7*7%257D%257D", isStrict))
+	}
+}
+
+func TestDetectTemplateInjection_Strict(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	a.IsFalse(injectionutils.DetectTemplateInjection("{{ user.name }}", false))
+	a.IsTrue(injectionutils.DetectTemplateInjection("{{ user.name }}", true))
+	a.IsFalse(injectionutils.DetectTemplateInjection("{{ name|upper }}", false))
+	a.IsTrue(injectionutils.DetectTemplateInjection("{{ name|upper }}", true))
+	a.IsFalse(injectionutils.DetectTemplateInjection("#set($x = 1)", false))
+	a.IsTrue(injectionutils.DetectTemplateInjection("#set($x = 1)", true))
+	a.IsFalse(injectionutils.DetectTemplateInjection("{{ 'abc'", false))
+	a.IsTrue(injectionutils.DetectTemplateInjection("{{ 'abc'", true))
+}
+
+func BenchmarkDetectTemplateInjection(b *testing.B) {
+	runtime.GOMAXPROCS(4)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = injectionutils.DetectTemplateInjection("{{ ''.__class__.__mro__[1].__subclasses__() }}", false)
+		}
+	})
+}
+
+func BenchmarkDetectTemplateInjection_Normal(b *testing.B) {
+	runtime.GOMAXPROCS(4)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = injectionutils.DetectTemplateInjection(`{"name":"lily","age":20,"tags":["a","b"]}`, false)
+		}
+	})
+}
+
+func BenchmarkDetectTemplateInjection_Cache(b *testing.B) {
+	runtime.GOMAXPROCS(4)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = injectionutils.DetectTemplateInjectionCache(`{"name":"lily","age":20,"tags":["a","b"]}`, false, utils.CacheMiddleLife)
+		}
+	})
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/iwind/TeaGo/maps"
 	"github.com/iwind/TeaGo/types"
 	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
 )
@@ -36,6 +37,9 @@ func init() {
 		return
 	}
 
+	// 用来检查本地防火墙中的黑名单是否完整
+	firewalls.SetDeniedIPsFunc(SharedIPBlackList.FirewallIPs)
+
 	var cacheFile = Tea.Root + "/data/waf_white_list.cache"
 
 	// save
@@ -59,6 +63,8 @@ type IPList struct {
 	idMap      map[uint64]string // id => ip info
 	listType   IPListType
 
+	firewallMap map[uint64]int64 // id => 在本地防火墙中的过期时间
+
 	id     uint64
 	locker sync.RWMutex
 
@@ -69,9 +75,10 @@ type IPList struct {
 // NewIPList 获取新对象
 func NewIPList(listType IPListType) *IPList {
 	var list = &IPList{
-		ipMap:    map[string]uint64{},
-		idMap:    map[uint64]string{},
-		listType: listType,
+		ipMap:       map[string]uint64{},
+		idMap:       map[uint64]string{},
+		listType:    listType,
+		firewallMap: map[uint64]int64{},
 	}
 
 	var e = expires.NewList()
@@ -86,6 +93,11 @@ func NewIPList(listType IPListType) *IPList {
 
 // Add 添加IP
 func (this *IPList) Add(ipType string, scope firewallconfigs.FirewallScope, serverId int64, ip string, expiresAt int64) {
+	this.add(ipType, scope, serverId, ip, expiresAt)
+}
+
+// 添加IP并返回新的ID
+func (this *IPList) add(ipType string, scope firewallconfigs.FirewallScope, serverId int64, ip string, expiresAt int64) uint64 {
 	switch scope {
 	case firewallconfigs.FirewallScopeGlobal:
 		ip = "*@" + ip + "@" + ipType
@@ -104,11 +116,20 @@ func (this *IPList) Add(ipType string, scope firewallconfigs.FirewallScope, serv
 	if ok {
 		delete(this.idMap, oldId)
 		this.expireList.Remove(oldId)
+
+		// 本地防火墙中的状态不变
+		firewallExpiresAt, ok := this.firewallMap[oldId]
+		if ok {
+			delete(this.firewallMap, oldId)
+			this.firewallMap[id] = firewallExpiresAt
+		}
 	}
 
 	this.ipMap[ip] = id
 	this.idMap[id] = ip
 	this.locker.Unlock()
+
+	return id
 }
 
 // RecordIP 记录IP
@@ -122,7 +143,7 @@ func (this *IPList) RecordIP(ipType string,
 	groupId int64,
 	setId int64,
 	reason string) {
-	this.Add(ipType, scope, serverId, ip, expiresAt)
+	var id = this.add(ipType, scope, serverId, ip, expiresAt)
 
 	if this.listType == IPListTypeDeny {
 		// 作用域
@@ -154,6 +175,13 @@ func (this *IPList) RecordIP(ipType string,
 			// 使用本地防火墙
 			if useLocalFirewall {
 				firewalls.DropTemporaryTo(ip, expiresAt)
+
+				this.locker.Lock()
+				_, ok := this.idMap[id]
+				if ok {
+					this.firewallMap[id] = firewalls.TemporaryExpiresAt(expiresAt)
+				}
+				this.locker.Unlock()
 			}
 		}
 
@@ -209,6 +237,7 @@ func (this *IPList) RemoveIP(ip string, serverId int64, shouldExecute bool) {
 		if ok {
 			delete(this.ipMap, key)
 			delete(this.idMap, id)
+			delete(this.firewallMap, id)
 
 			this.expireList.Remove(id)
 		}
@@ -220,6 +249,7 @@ func (this *IPList) RemoveIP(ip string, serverId int64, shouldExecute bool) {
 		if ok {
 			delete(this.ipMap, key)
 			delete(this.idMap, id)
+			delete(this.firewallMap, id)
 
 			this.expireList.Remove(id)
 		}
@@ -312,6 +342,40 @@ func (this *IPList) IdMap() map[uint64]string {
 	return this.idMap
 }
 
+// FirewallIPs 已经加入到本地防火墙中的IP：ip => 在本地防火墙中的过期时间
+func (this *IPList) FirewallIPs() map[string]int64 {
+	var now = fasttime.Now().Unix()
+	var result = map[string]int64{}
+
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	for id, expiresAt := range this.firewallMap {
+		if expiresAt <= now {
+			delete(this.firewallMap, id)
+			continue
+		}
+
+		ipInfo, ok := this.idMap[id]
+		if !ok {
+			delete(this.firewallMap, id)
+			continue
+		}
+
+		// ip info: scope@ip@type
+		var pieces = strings.Split(ipInfo, "@")
+		if len(pieces) != 3 {
+			continue
+		}
+		var ip = pieces[1]
+		if expiresAt > result[ip] {
+			result[ip] = expiresAt
+		}
+	}
+
+	return result
+}
+
 func (this *IPList) remove(id uint64) {
 	this.locker.Lock()
 	ip, ok := this.idMap[id]
@@ -322,6 +386,7 @@ func (this *IPList) remove(id uint64) {
 		}
 		delete(this.idMap, id)
 	}
+	delete(this.firewallMap, id)
 	this.locker.Unlock()
 }
 
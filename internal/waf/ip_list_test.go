@@ -133,3 +133,28 @@ func BenchmarkIPList_Has(b *testing.B) {
 		list.Contains(waf.IPTypeAll, firewallconfigs.FirewallScopeGlobal, 1, "192.168.1.100")
 	}
 }
+
+func TestIPList_FirewallIPs(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var list = waf.NewIPList(waf.IPListTypeDeny)
+	var expiresAt = time.Now().Unix() + 60
+	list.RecordIP(waf.IPTypeAll, firewallconfigs.FirewallScopeGlobal, 0, "192.0.2.1", expiresAt, 0, true, 0, 0, "")
+	list.RecordIP(waf.IPTypeAll, firewallconfigs.FirewallScopeGlobal, 0, "192.0.2.2", time.Now().Unix()+7200, 0, true, 0, 0, "")
+	list.RecordIP(waf.IPTypeAll, firewallconfigs.FirewallScopeGlobal, 0, "192.0.2.3", expiresAt, 0, false, 0, 0, "")
+
+	var ipMap = list.FirewallIPs()
+	a.IsTrue(len(ipMap) == 2)
+	a.IsTrue(ipMap["192.0.2.1"] == expiresAt)
+	a.IsTrue(ipMap["192.0.2.2"] <= time.Now().Unix()+3600) // 本地防火墙中最长一个小时
+
+	// 重新添加后仍然在本地防火墙中
+	list.Add(waf.IPTypeAll, firewallconfigs.FirewallScopeGlobal, 0, "192.0.2.1", expiresAt+10)
+	a.IsTrue(list.FirewallIPs()["192.0.2.1"] == expiresAt)
+
+	list.RemoveIP("192.0.2.1", 0, false)
+	ipMap = list.FirewallIPs()
+	a.IsTrue(len(ipMap) == 1)
+	_, ok := ipMap["192.0.2.1"]
+	a.IsFalse(ok)
+}
@@ -0,0 +1,268 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package maskutils
+
+import (
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/re"
+)
+
+type MaskType = string
+
+const (
+	MaskTypeCard   MaskType = "card"   // 银行卡号，使用Luhn算法校验
+	MaskTypeIDCard MaskType = "idCard" // 身份证号，包括中国居民身份证号和美国SSN
+	MaskTypeEmail  MaskType = "email"  // 邮箱
+	MaskTypeCustom MaskType = "custom" // 自定义正则表达式
+)
+
+// MaxMatchLength 单个匹配的最大长度，流式处理时保留这么多数据用来匹配跨越分块的内容
+const MaxMatchLength = 256
+
+const defaultMaskChar = '*'
+
+var (
+	cardRegexp   = re.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	idCardRegexp = re.MustCompile(`\b[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`)
+	ssnRegexp    = re.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)
+	emailRegexp  = re.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)
+)
+
+// 单个脱敏规则
+type maskRule struct {
+	maskType MaskType
+	reg      *re.Regexp
+	validate func(match []byte) bool           // 校验匹配的内容，为nil时不校验
+	mask     func(match []byte, maskChar byte) // 替换匹配的内容，必须保持长度不变
+}
+
+// Masker 敏感数据脱敏器
+// 所有替换都按字节进行并保持内容长度不变，所以不需要修改未压缩内容的Content-Length
+type Masker struct {
+	rules    []*maskRule
+	maskChar byte
+}
+
+// NewMasker 获取新对象
+// maskTypes 内置的数据类型；patterns 自定义正则表达式；maskChar 替换用的字符，为空时使用星号（*）
+func NewMasker(maskTypes []MaskType, patterns []string, maskChar string) (*Masker, error) {
+	var masker = &Masker{
+		maskChar: defaultMaskChar,
+	}
+
+	if len(maskChar) > 0 {
+		if len(maskChar) != 1 || maskChar[0] < 0x20 || maskChar[0] > 0x7e {
+			return nil, errors.New("mask char should be a printable ASCII character")
+		}
+		masker.maskChar = maskChar[0]
+	}
+
+	for _, maskType := range maskTypes {
+		switch maskType {
+		case MaskTypeCard:
+			masker.rules = append(masker.rules, &maskRule{
+				maskType: MaskTypeCard,
+				reg:      cardRegexp,
+				validate: validateCard,
+				mask:     maskDigitsKeepLast4,
+			})
+		case MaskTypeIDCard:
+			masker.rules = append(masker.rules, &maskRule{
+				maskType: MaskTypeIDCard,
+				reg:      idCardRegexp,
+				validate: validateChineseIDCard,
+				mask:     maskDigitsKeepLast4,
+			}, &maskRule{
+				maskType: MaskTypeIDCard,
+				reg:      ssnRegexp,
+				validate: validateSSN,
+				mask:     maskDigitsKeepLast4,
+			})
+		case MaskTypeEmail:
+			masker.rules = append(masker.rules, &maskRule{
+				maskType: MaskTypeEmail,
+				reg:      emailRegexp,
+				mask:     maskEmail,
+			})
+		default:
+			return nil, errors.New("unknown mask type '" + maskType + "'")
+		}
+	}
+
+	for _, pattern := range patterns {
+		if len(pattern) == 0 {
+			continue
+		}
+		reg, err := re.Compile(pattern)
+		if err != nil {
+			return nil, errors.New("compile pattern '" + pattern + "' failed: " + err.Error())
+		}
+		masker.rules = append(masker.rules, &maskRule{
+			maskType: MaskTypeCustom,
+			reg:      reg,
+			mask:     maskAll,
+		})
+	}
+
+	if len(masker.rules) == 0 {
+		return nil, errors.New("no mask types or patterns")
+	}
+
+	return masker, nil
+}
+
+// Mask 对数据进行脱敏，直接修改传入的数据，返回每种类型的替换次数
+func (this *Masker) Mask(data []byte) (stat map[MaskType]int) {
+	_, stat = this.mask(data, true)
+	return
+}
+
+// 对数据进行脱敏
+// 如果 isEOF 为false，则只处理可以确定完整的部分，返回已处理的长度
+func (this *Masker) mask(data []byte, isEOF bool) (safeLength int, stat map[MaskType]int) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	// 找出所有匹配
+	var matchesList = make([][][]int, len(this.rules))
+	for index, rule := range this.rules {
+		matchesList[index] = rule.reg.Raw().FindAllIndex(data, -1)
+	}
+
+	safeLength = len(data)
+	if !isEOF {
+		safeLength -= MaxMatchLength
+		if safeLength <= 0 {
+			return 0, nil
+		}
+
+		// 跨越边界的匹配留到下一次处理
+		for {
+			var changed = false
+			for _, matches := range matchesList {
+				for _, match := range matches {
+					if match[0] < safeLength && match[1] > safeLength {
+						safeLength = match[0]
+						changed = true
+					}
+				}
+			}
+			if !changed {
+				break
+			}
+		}
+		if safeLength <= 0 {
+			return 0, nil
+		}
+	}
+
+	for index, rule := range this.rules {
+		for _, match := range matchesList[index] {
+			if match[1] > safeLength {
+				continue
+			}
+			var matchData = data[match[0]:match[1]]
+			if rule.validate != nil && !rule.validate(matchData) {
+				continue
+			}
+			rule.mask(matchData, this.maskChar)
+			if stat == nil {
+				stat = map[MaskType]int{}
+			}
+			stat[rule.maskType]++
+		}
+	}
+
+	return
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Luhn算法校验银行卡号
+func validateCard(match []byte) bool {
+	var sum = 0
+	var countDigits = 0
+	var double = false
+	for i := len(match) - 1; i >= 0; i-- {
+		var c = match[i]
+		if !isDigit(c) {
+			continue
+		}
+		countDigits++
+		var d = int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return countDigits >= 13 && countDigits <= 19 && sum%10 == 0
+}
+
+// 校验中国居民身份证号的校验位
+func validateChineseIDCard(match []byte) bool {
+	if len(match) != 18 {
+		return false
+	}
+	var weights = []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	var checkCodes = "10X98765432"
+	var sum = 0
+	for i := 0; i < 17; i++ {
+		sum += int(match[i]-'0') * weights[i]
+	}
+	var last = match[17]
+	if last == 'x' {
+		last = 'X'
+	}
+	return checkCodes[sum%11] == last
+}
+
+// 校验美国SSN：区号不能为000、666和9xx，组号不能为00，序号不能为0000
+func validateSSN(match []byte) bool {
+	if len(match) != 11 {
+		return false
+	}
+	var area = string(match[:3])
+	var group = string(match[4:6])
+	var serial = string(match[7:])
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// 替换数字，保留最后4位
+func maskDigitsKeepLast4(match []byte, maskChar byte) {
+	var kept = 0
+	for i := len(match) - 1; i >= 0; i-- {
+		var c = match[i]
+		if !isDigit(c) && c != 'X' && c != 'x' {
+			continue
+		}
+		if kept < 4 {
+			kept++
+			continue
+		}
+		match[i] = maskChar
+	}
+}
+
+// 替换邮箱用户名，保留第一个字符
+func maskEmail(match []byte, maskChar byte) {
+	for i := 1; i < len(match); i++ {
+		if match[i] == '@' {
+			break
+		}
+		match[i] = maskChar
+	}
+}
+
+// 替换所有字符
+func maskAll(match []byte, maskChar byte) {
+	for i := range match {
+		match[i] = maskChar
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package maskutils_test
+
+import (
+	"bytes"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/maskutils"
+	"github.com/iwind/TeaGo/assert"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMasker_Mask(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	masker, err := maskutils.NewMasker([]maskutils.MaskType{maskutils.MaskTypeCard, maskutils.MaskTypeIDCard, maskutils.MaskTypeEmail}, []string{`secret-[a-z0-9]{8}`}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testCase := range []struct {
+		data   string
+		result string
+	}{
+		{"card: 4111111111111111", "card: ************1111"},
+		{"card: 4111 1111 1111 1111.", "card: **** **** **** 1111."},
+		{"card: 4111-1111-1111-1112", "card: 4111-1111-1111-1112"}, // 没有通过Luhn校验
+		{"order: 1234567890123", "order: 1234567890123"},
+		{"id: 11010519491231002X", "id: **************002X"},
+		{"id: 110105194912310021", "id: 110105194912310021"}, // 校验位错误
+		{"ssn: 123-45-6789", "ssn: ***-**-6789"},
+		{"ssn: 000-45-6789", "ssn: 000-45-6789"},
+		{"date: 2024-01-1234", "date: 2024-01-1234"},
+		{`{"email":"lily@example.com"}`, `{"email":"l***@example.com"}`},
+		{"token=secret-abcd1234;", "token=***************;"},
+		{"hello, world", "hello, world"},
+	} {
+		var data = []byte(testCase.data)
+		var stat = masker.Mask(data)
+		t.Log(testCase.data, "=>", string(data), stat)
+		a.IsTrue(string(data) == testCase.result)
+		a.IsTrue(len(data) == len(testCase.data))
+	}
+}
+
+func TestNewMasker(t *testing.T) {
+	{
+		_, err := maskutils.NewMasker(nil, nil, "")
+		if err == nil {
+			t.Fatal("should fail without rules")
+		}
+	}
+	{
+		_, err := maskutils.NewMasker([]maskutils.MaskType{"phone"}, nil, "")
+		if err == nil {
+			t.Fatal("should fail with unknown type")
+		}
+	}
+	{
+		_, err := maskutils.NewMasker(nil, []string{"(abc"}, "")
+		if err == nil {
+			t.Fatal("should fail with invalid pattern")
+		}
+	}
+	{
+		_, err := maskutils.NewMasker([]maskutils.MaskType{maskutils.MaskTypeEmail}, nil, "##")
+		if err == nil {
+			t.Fatal("should fail with invalid mask char")
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	masker, err := maskutils.NewMasker([]maskutils.MaskType{maskutils.MaskTypeCard, maskutils.MaskTypeEmail}, nil, "#")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 构造跨越多个分块的数据
+	var source = &bytes.Buffer{}
+	var expected = &bytes.Buffer{}
+	for i := 0; i < 10000; i++ {
+		source.WriteString("<li>user" + strings.Repeat("x", i%7) + "@example.com 4111111111111111</li>\n")
+		expected.WriteString("<li>u" + strings.Repeat("#", 3+i%7) + "@example.com ############1111</li>\n")
+	}
+
+	var stat map[maskutils.MaskType]int
+	var reader = maskutils.NewReader(io.NopCloser(&limitedChunkReader{reader: bytes.NewReader(source.Bytes()), size: 1000}), masker, func(s map[maskutils.MaskType]int) {
+		stat = s
+	})
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = reader.Close()
+
+	a.IsTrue(len(data) == source.Len())
+	a.IsTrue(bytes.Equal(data, expected.Bytes()))
+	a.IsTrue(stat[maskutils.MaskTypeCard] == 10000)
+	a.IsTrue(stat[maskutils.MaskTypeEmail] == 10000)
+	t.Log(stat)
+}
+
+// 每次只读取少量数据的Reader
+type limitedChunkReader struct {
+	reader io.Reader
+	size   int
+}
+
+func (this *limitedChunkReader) Read(p []byte) (n int, err error) {
+	if len(p) > this.size {
+		p = p[:this.size]
+	}
+	return this.reader.Read(p)
+}
+
+func BenchmarkMasker_Mask(b *testing.B) {
+	masker, err := maskutils.NewMasker([]maskutils.MaskType{maskutils.MaskTypeCard, maskutils.MaskTypeIDCard, maskutils.MaskTypeEmail}, nil, "")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var data = []byte(strings.Repeat(`{"name":"Lily","email":"lily@example.com","card":"4111111111111111","address":"Beijing"}`, 100))
+	var buf = make([]byte, len(data))
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		copy(buf, data)
+		_ = masker.Mask(buf)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package maskutils
+
+import (
+	"io"
+)
+
+const (
+	readerChunkSize  = 32 << 10 // 每次从源读取的数据尺寸
+	readerMaxPending = 1 << 20  // 最多暂存的数据尺寸，超出后强制处理，防止无法确定边界时占用过多内存
+)
+
+// Reader 对数据流进行脱敏的Reader
+type Reader struct {
+	rawReader io.ReadCloser
+	masker    *Masker
+
+	pending []byte // 尚未处理的数据
+	output  []byte // 已处理、尚未读取的数据
+	isEOF   bool
+	readErr error
+
+	stat    map[MaskType]int
+	onClose func(stat map[MaskType]int)
+}
+
+// NewReader 获取新对象
+// onClose 在关闭时调用，参数为每种类型的替换次数
+func NewReader(rawReader io.ReadCloser, masker *Masker, onClose func(stat map[MaskType]int)) *Reader {
+	return &Reader{
+		rawReader: rawReader,
+		masker:    masker,
+		onClose:   onClose,
+	}
+}
+
+func (this *Reader) Read(p []byte) (n int, err error) {
+	for len(this.output) == 0 {
+		if this.isEOF {
+			return 0, this.readErr
+		}
+		this.fill()
+	}
+
+	n = copy(p, this.output)
+	this.output = this.output[n:]
+	return
+}
+
+func (this *Reader) Close() error {
+	if this.onClose != nil {
+		var onClose = this.onClose
+		this.onClose = nil
+		onClose(this.stat)
+	}
+	return this.rawReader.Close()
+}
+
+// Stat 替换统计
+func (this *Reader) Stat() map[MaskType]int {
+	return this.stat
+}
+
+// 从源读取数据并处理
+func (this *Reader) fill() {
+	var offset = len(this.pending)
+	if cap(this.pending)-offset < readerChunkSize {
+		var newPending = make([]byte, offset, offset+readerChunkSize+MaxMatchLength)
+		copy(newPending, this.pending)
+		this.pending = newPending
+	}
+
+	n, err := this.rawReader.Read(this.pending[offset : offset+readerChunkSize])
+	this.pending = this.pending[:offset+n]
+	if err != nil {
+		this.isEOF = true
+		this.readErr = err
+	}
+
+	var isEOF = this.isEOF || len(this.pending) >= readerMaxPending
+	safeLength, stat := this.masker.mask(this.pending, isEOF)
+	for maskType, count := range stat {
+		if this.stat == nil {
+			this.stat = map[MaskType]int{}
+		}
+		this.stat[maskType] += count
+	}
+	if safeLength <= 0 {
+		return
+	}
+
+	// 输出的数据需要独立的内存，以便于继续复用pending
+	this.output = append(this.output[:0], this.pending[:safeLength]...)
+	this.pending = append(this.pending[:0], this.pending[safeLength:]...)
+}
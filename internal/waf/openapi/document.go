@@ -0,0 +1,440 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/re"
+	"github.com/iwind/TeaGo/types"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var pathParamRegexp = regexp.MustCompile(`{([^{}/]+)}`)
+
+type ParameterLocation = string
+
+const (
+	ParameterLocationPath   ParameterLocation = "path"
+	ParameterLocationQuery  ParameterLocation = "query"
+	ParameterLocationHeader ParameterLocation = "header"
+	ParameterLocationCookie ParameterLocation = "cookie"
+)
+
+// Parameter 参数定义
+type Parameter struct {
+	Name     string
+	In       ParameterLocation
+	Required bool
+	Explode  bool
+	Schema   *Schema
+}
+
+// RequestBody 请求体定义
+type RequestBody struct {
+	Required bool
+	Content  map[string]*Schema // content type => schema，schema可能为nil
+}
+
+// Operation 操作定义
+type Operation struct {
+	Parameters  []*Parameter
+	RequestBody *RequestBody
+}
+
+type pathSegment struct {
+	literal    string
+	paramNames []string
+	reg        *re.Regexp // 包含参数的片段
+}
+
+// PathItem 路径定义
+type PathItem struct {
+	Template   string
+	Operations map[string]*Operation // method => operation
+
+	segments      []*pathSegment
+	countLiterals int
+}
+
+// Document OpenAPI 3.x 文档
+type Document struct {
+	basePaths []string
+	paths     []*PathItem
+}
+
+// ParseDocument 解析JSON或YAML格式的OpenAPI 3.x文档
+func ParseDocument(data []byte) (*Document, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("empty document")
+	}
+
+	var root = map[string]any{}
+	var err error
+	if data[0] == '{' {
+		err = json.Unmarshal(data, &root)
+	} else {
+		err = yaml.Unmarshal(data, &root)
+	}
+	if err != nil {
+		return nil, errors.New("decode document failed: " + err.Error())
+	}
+
+	// 统一为JSON数据类型，方便后续处理
+	root, err = normalizeRoot(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var version = types.String(root["openapi"])
+	if !strings.HasPrefix(version, "3.") {
+		return nil, errors.New("unsupported document version '" + version + "', only OpenAPI 3.x is supported")
+	}
+
+	var doc = &Document{}
+	var compiler = newSchemaCompiler(root)
+
+	// servers
+	servers, ok := root["servers"].([]any)
+	if ok {
+		for _, server := range servers {
+			serverMap, ok := server.(map[string]any)
+			if !ok {
+				continue
+			}
+			var basePath = serverBasePath(types.String(serverMap["url"]))
+			if len(basePath) > 0 {
+				doc.basePaths = append(doc.basePaths, basePath)
+			}
+		}
+	}
+
+	// paths
+	paths, ok := root["paths"].(map[string]any)
+	if !ok {
+		return nil, errors.New("'paths' should not be empty")
+	}
+	for template, rawPathItem := range paths {
+		pathItemMap, ok := rawPathItem.(map[string]any)
+		if !ok {
+			continue
+		}
+		pathItem, err := doc.compilePathItem(compiler, template, pathItemMap)
+		if err != nil {
+			return nil, errors.New("compile path '" + template + "' failed: " + err.Error())
+		}
+		doc.paths = append(doc.paths, pathItem)
+	}
+
+	// 字面量多的路径优先匹配
+	sort.SliceStable(doc.paths, func(i, j int) bool {
+		if doc.paths[i].countLiterals != doc.paths[j].countLiterals {
+			return doc.paths[i].countLiterals > doc.paths[j].countLiterals
+		}
+		return doc.paths[i].Template < doc.paths[j].Template
+	})
+
+	return doc, nil
+}
+
+// MatchPath 匹配路径，返回路径定义及路径参数
+func (this *Document) MatchPath(path string) (pathItem *PathItem, params map[string]string) {
+	var candidates = []string{path}
+	for _, basePath := range this.basePaths {
+		if path == basePath {
+			candidates = append(candidates, "/")
+		} else if strings.HasPrefix(path, basePath+"/") {
+			candidates = append(candidates, path[len(basePath):])
+		}
+	}
+
+	for _, candidate := range candidates {
+		var pieces = strings.Split(strings.TrimPrefix(candidate, "/"), "/")
+		for _, item := range this.paths {
+			params, ok := item.match(pieces)
+			if ok {
+				return item, params
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (this *Document) compilePathItem(compiler *schemaCompiler, template string, m map[string]any) (*PathItem, error) {
+	var pathItem = &PathItem{
+		Template:   template,
+		Operations: map[string]*Operation{},
+	}
+
+	// $ref
+	ref, ok := m["$ref"].(string)
+	if ok {
+		target, err := resolvePointer(compiler.root, ref)
+		if err != nil {
+			return nil, err
+		}
+		targetMap, ok := target.(map[string]any)
+		if ok {
+			m = targetMap
+		}
+	}
+
+	// segments
+	for _, piece := range strings.Split(strings.TrimPrefix(template, "/"), "/") {
+		var segment = &pathSegment{}
+		var matches = pathParamRegexp.FindAllStringSubmatchIndex(piece, -1)
+		if len(matches) == 0 {
+			segment.literal = piece
+			pathItem.countLiterals++
+		} else {
+			var expr = "^"
+			var lastIndex = 0
+			for _, match := range matches {
+				expr += regexp.QuoteMeta(piece[lastIndex:match[0]]) + "([^/]+?)"
+				segment.paramNames = append(segment.paramNames, piece[match[2]:match[3]])
+				lastIndex = match[1]
+			}
+			expr += regexp.QuoteMeta(piece[lastIndex:]) + "$"
+			reg, err := re.Compile(expr)
+			if err != nil {
+				return nil, err
+			}
+			segment.reg = reg
+		}
+		pathItem.segments = append(pathItem.segments, segment)
+	}
+
+	// path level parameters
+	pathParameters, err := this.compileParameters(compiler, m["parameters"])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete, http.MethodOptions, http.MethodHead, http.MethodPatch, http.MethodTrace} {
+		operationMap, ok := m[strings.ToLower(method)].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		var operation = &Operation{}
+
+		operationParameters, err := this.compileParameters(compiler, operationMap["parameters"])
+		if err != nil {
+			return nil, err
+		}
+
+		// 操作中的参数覆盖路径中的同名参数
+		var parameterMap = map[string]bool{}
+		for _, param := range operationParameters {
+			parameterMap[param.In+"@"+param.Name] = true
+		}
+		operation.Parameters = operationParameters
+		for _, param := range pathParameters {
+			if !parameterMap[param.In+"@"+param.Name] {
+				operation.Parameters = append(operation.Parameters, param)
+			}
+		}
+
+		// request body
+		rawRequestBody, ok := operationMap["requestBody"].(map[string]any)
+		if ok {
+			operation.RequestBody, err = this.compileRequestBody(compiler, rawRequestBody)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		pathItem.Operations[method] = operation
+	}
+
+	return pathItem, nil
+}
+
+func (this *Document) compileParameters(compiler *schemaCompiler, raw any) ([]*Parameter, error) {
+	var result = []*Parameter{}
+	list, ok := raw.([]any)
+	if !ok {
+		return result, nil
+	}
+
+	for _, rawParam := range list {
+		paramMap, ok := rawParam.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		ref, ok := paramMap["$ref"].(string)
+		if ok {
+			target, err := resolvePointer(compiler.root, ref)
+			if err != nil {
+				return nil, err
+			}
+			paramMap, ok = target.(map[string]any)
+			if !ok {
+				continue
+			}
+		}
+
+		var param = &Parameter{
+			Name:     types.String(paramMap["name"]),
+			In:       types.String(paramMap["in"]),
+			Required: types.Bool(paramMap["required"]),
+			Explode:  true,
+		}
+		if param.In == ParameterLocationPath {
+			param.Required = true
+		}
+		if paramMap["explode"] != nil {
+			param.Explode = types.Bool(paramMap["explode"])
+		}
+
+		// 参数名不区分大小写
+		if param.In == ParameterLocationHeader {
+			param.Name = http.CanonicalHeaderKey(param.Name)
+		}
+
+		if paramMap["schema"] != nil {
+			schema, err := compiler.compile(paramMap["schema"])
+			if err != nil {
+				return nil, err
+			}
+			param.Schema = schema
+		}
+
+		result = append(result, param)
+	}
+	return result, nil
+}
+
+func (this *Document) compileRequestBody(compiler *schemaCompiler, m map[string]any) (*RequestBody, error) {
+	ref, ok := m["$ref"].(string)
+	if ok {
+		target, err := resolvePointer(compiler.root, ref)
+		if err != nil {
+			return nil, err
+		}
+		targetMap, ok := target.(map[string]any)
+		if ok {
+			m = targetMap
+		}
+	}
+
+	var requestBody = &RequestBody{
+		Required: types.Bool(m["required"]),
+		Content:  map[string]*Schema{},
+	}
+
+	content, ok := m["content"].(map[string]any)
+	if ok {
+		for contentType, rawMediaType := range content {
+			contentType = strings.ToLower(contentType)
+			requestBody.Content[contentType] = nil
+
+			mediaTypeMap, ok := rawMediaType.(map[string]any)
+			if !ok || mediaTypeMap["schema"] == nil {
+				continue
+			}
+			schema, err := compiler.compile(mediaTypeMap["schema"])
+			if err != nil {
+				return nil, err
+			}
+			requestBody.Content[contentType] = schema
+		}
+	}
+
+	return requestBody, nil
+}
+
+func (this *PathItem) match(pieces []string) (params map[string]string, ok bool) {
+	if len(pieces) != len(this.segments) {
+		return nil, false
+	}
+
+	for index, segment := range this.segments {
+		var piece = pieces[index]
+		if segment.reg == nil {
+			if piece != segment.literal {
+				return nil, false
+			}
+			continue
+		}
+
+		var matches = segment.reg.FindStringSubmatch(piece)
+		if len(matches) != len(segment.paramNames)+1 {
+			return nil, false
+		}
+		if params == nil {
+			params = map[string]string{}
+		}
+		for paramIndex, paramName := range segment.paramNames {
+			value, err := url.PathUnescape(matches[paramIndex+1])
+			if err != nil {
+				value = matches[paramIndex+1]
+			}
+			params[paramName] = value
+		}
+	}
+
+	return params, true
+}
+
+// 从服务地址中读取基础路径，比如 https://example.com/v1 => /v1
+func serverBasePath(serverURL string) string {
+	// 去除变量
+	serverURL = pathParamRegexp.ReplaceAllString(serverURL, "x")
+
+	var path = serverURL
+	if strings.Contains(serverURL, "://") {
+		u, err := url.Parse(serverURL)
+		if err != nil {
+			return ""
+		}
+		path = u.Path
+	}
+
+	path = strings.TrimSuffix(path, "/")
+	if len(path) > 0 && path[0] != '/' {
+		return ""
+	}
+	return path
+}
+
+// 将YAML解析后的数据转换为JSON数据类型
+func normalizeRoot(root map[string]any) (map[string]any, error) {
+	data, err := json.Marshal(normalizeValue(root))
+	if err != nil {
+		return nil, errors.New("decode document failed: " + err.Error())
+	}
+	var result = map[string]any{}
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
+
+func normalizeValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for k, v1 := range v {
+			v[k] = normalizeValue(v1)
+		}
+		return v
+	case map[any]any:
+		var m = map[string]any{}
+		for k, v1 := range v {
+			m[types.String(k)] = normalizeValue(v1)
+		}
+		return m
+	case []any:
+		for i, v1 := range v {
+			v[i] = normalizeValue(v1)
+		}
+		return v
+	}
+	return value
+}
@@ -0,0 +1,587 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"github.com/TeaOSLab/EdgeNode/internal/re"
+	"github.com/iwind/TeaGo/types"
+	"math"
+	"net"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 最大校验深度，防止过深的数据或者循环引用
+const maxValidateDepth = 128
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+var emailRegexp = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// Schema 数据结构定义，只实现校验请求需要的部分
+type Schema struct {
+	ref *Schema // $ref指向的对象
+
+	Types    []string
+	Nullable bool
+	Format   string
+	Enum     []any
+
+	Minimum          *float64
+	Maximum          *float64
+	ExclusiveMinimum bool
+	ExclusiveMaximum bool
+	MultipleOf       float64
+
+	MinLength int
+	MaxLength int // -1表示不限制
+	Pattern   *re.Regexp
+
+	Items    *Schema
+	MinItems int
+	MaxItems int // -1表示不限制
+
+	Properties                  map[string]*Schema
+	Required                    []string
+	AdditionalProperties        *Schema
+	AdditionalPropertiesAllowed bool
+
+	AllOf []*Schema
+	AnyOf []*Schema
+	OneOf []*Schema
+	Not   *Schema
+}
+
+func newSchema() *Schema {
+	return &Schema{
+		MaxLength:                   -1,
+		MaxItems:                    -1,
+		AdditionalPropertiesAllowed: true,
+	}
+}
+
+// Resolve 获取$ref指向的最终对象
+func (this *Schema) Resolve() *Schema {
+	var schema = this
+	for i := 0; i < maxValidateDepth && schema.ref != nil; i++ {
+		schema = schema.ref
+	}
+	return schema
+}
+
+// PrimaryType 主要类型，用来转换参数值
+func (this *Schema) PrimaryType() string {
+	var schema = this.Resolve()
+	for _, t := range schema.Types {
+		if t != "null" {
+			return t
+		}
+	}
+	if len(schema.AllOf) > 0 {
+		return schema.AllOf[0].PrimaryType()
+	}
+	return ""
+}
+
+// Validate 校验数据
+func (this *Schema) Validate(value any) error {
+	return this.validate(value, "", 0)
+}
+
+func (this *Schema) validate(value any, path string, depth int) error {
+	if depth > maxValidateDepth {
+		return errors.New(this.fieldName(path) + "too many nesting levels")
+	}
+
+	var schema = this.Resolve()
+
+	// null
+	if value == nil {
+		if schema.Nullable || schema.hasType("null") || len(schema.Types) == 0 {
+			return nil
+		}
+		return errors.New(this.fieldName(path) + "should not be null")
+	}
+
+	// enum
+	if len(schema.Enum) > 0 {
+		var found = false
+		for _, enumValue := range schema.Enum {
+			if schema.equalValues(enumValue, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New(this.fieldName(path) + "value is not in enum list")
+		}
+	}
+
+	// type
+	if len(schema.Types) > 0 {
+		var matchedType = false
+		for _, t := range schema.Types {
+			if schema.matchType(t, value) {
+				matchedType = true
+				break
+			}
+		}
+		if !matchedType {
+			return errors.New(this.fieldName(path) + "expected type '" + strings.Join(schema.Types, "|") + "'")
+		}
+	}
+
+	var err error
+	switch v := value.(type) {
+	case string:
+		err = schema.validateString(v, path)
+	case float64:
+		err = schema.validateNumber(v, path)
+	case []any:
+		err = schema.validateArray(v, path, depth)
+	case map[string]any:
+		err = schema.validateObject(v, path, depth)
+	}
+	if err != nil {
+		return err
+	}
+
+	// composition
+	for _, subSchema := range schema.AllOf {
+		err = subSchema.validate(value, path, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+	if len(schema.AnyOf) > 0 {
+		var matched = false
+		for _, subSchema := range schema.AnyOf {
+			if subSchema.validate(value, path, depth+1) == nil {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return errors.New(this.fieldName(path) + "value does not match any schema in 'anyOf'")
+		}
+	}
+	if len(schema.OneOf) > 0 {
+		var countMatched = 0
+		for _, subSchema := range schema.OneOf {
+			if subSchema.validate(value, path, depth+1) == nil {
+				countMatched++
+			}
+		}
+		if countMatched != 1 {
+			return errors.New(this.fieldName(path) + "value should match exactly one schema in 'oneOf'")
+		}
+	}
+	if schema.Not != nil && schema.Not.validate(value, path, depth+1) == nil {
+		return errors.New(this.fieldName(path) + "value should not match schema in 'not'")
+	}
+
+	return nil
+}
+
+func (this *Schema) validateString(s string, path string) error {
+	var length = utf8.RuneCountInString(s)
+	if length < this.MinLength {
+		return errors.New(this.fieldName(path) + "length should not be less than " + types.String(this.MinLength))
+	}
+	if this.MaxLength >= 0 && length > this.MaxLength {
+		return errors.New(this.fieldName(path) + "length should not be greater than " + types.String(this.MaxLength))
+	}
+	if this.Pattern != nil && !this.Pattern.MatchString(s) {
+		return errors.New(this.fieldName(path) + "value does not match pattern")
+	}
+
+	var ok = true
+	switch this.Format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, s)
+		ok = err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", s)
+		ok = err == nil
+	case "uuid":
+		ok = uuidRegexp.MatchString(s)
+	case "email":
+		ok = emailRegexp.MatchString(s)
+	case "ipv4":
+		var ip = net.ParseIP(s)
+		ok = ip != nil && ip.To4() != nil && strings.Contains(s, ".")
+	case "ipv6":
+		var ip = net.ParseIP(s)
+		ok = ip != nil && strings.Contains(s, ":")
+	}
+	if !ok {
+		return errors.New(this.fieldName(path) + "value is not a valid '" + this.Format + "'")
+	}
+	return nil
+}
+
+func (this *Schema) validateNumber(f float64, path string) error {
+	if this.Minimum != nil {
+		if (this.ExclusiveMinimum && f <= *this.Minimum) || f < *this.Minimum {
+			return errors.New(this.fieldName(path) + "value is too small")
+		}
+	}
+	if this.Maximum != nil {
+		if (this.ExclusiveMaximum && f >= *this.Maximum) || f > *this.Maximum {
+			return errors.New(this.fieldName(path) + "value is too large")
+		}
+	}
+	if this.MultipleOf > 0 {
+		var q = f / this.MultipleOf
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			return errors.New(this.fieldName(path) + "value should be multiple of " + types.String(this.MultipleOf))
+		}
+	}
+
+	switch this.Format {
+	case "int32":
+		if f < math.MinInt32 || f > math.MaxInt32 {
+			return errors.New(this.fieldName(path) + "value is out of int32 range")
+		}
+	}
+	return nil
+}
+
+func (this *Schema) validateArray(list []any, path string, depth int) error {
+	if len(list) < this.MinItems {
+		return errors.New(this.fieldName(path) + "items should not be less than " + types.String(this.MinItems))
+	}
+	if this.MaxItems >= 0 && len(list) > this.MaxItems {
+		return errors.New(this.fieldName(path) + "items should not be greater than " + types.String(this.MaxItems))
+	}
+	if this.Items != nil {
+		for index, item := range list {
+			err := this.Items.validate(item, path+"["+types.String(index)+"]", depth+1)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (this *Schema) validateObject(m map[string]any, path string, depth int) error {
+	for _, requiredKey := range this.Required {
+		_, ok := m[requiredKey]
+		if !ok {
+			return errors.New(this.fieldName(this.joinPath(path, requiredKey)) + "is required")
+		}
+	}
+
+	for key, value := range m {
+		propertySchema, ok := this.Properties[key]
+		if ok {
+			err := propertySchema.validate(value, this.joinPath(path, key), depth+1)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if this.AdditionalProperties != nil {
+			err := this.AdditionalProperties.validate(value, this.joinPath(path, key), depth+1)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !this.AdditionalPropertiesAllowed {
+			return errors.New(this.fieldName(this.joinPath(path, key)) + "is not allowed")
+		}
+	}
+	return nil
+}
+
+func (this *Schema) hasType(t string) bool {
+	for _, t1 := range this.Types {
+		if t1 == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *Schema) matchType(t string, value any) bool {
+	switch t {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f) && !math.IsInf(f, 0)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+func (this *Schema) equalValues(v1 any, v2 any) bool {
+	// 数字统一使用float64比较
+	if types.IsNumber(v1) && types.IsNumber(v2) {
+		return types.Float64(v1) == types.Float64(v2)
+	}
+	return reflect.DeepEqual(v1, v2)
+}
+
+func (this *Schema) joinPath(path string, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
+
+func (this *Schema) fieldName(path string) string {
+	if len(path) == 0 {
+		return ""
+	}
+	return "'" + path + "': "
+}
+
+// 编译Schema
+type schemaCompiler struct {
+	root map[string]any
+	refs map[string]*Schema
+}
+
+func newSchemaCompiler(root map[string]any) *schemaCompiler {
+	return &schemaCompiler{
+		root: root,
+		refs: map[string]*Schema{},
+	}
+}
+
+func (this *schemaCompiler) compile(raw any) (*Schema, error) {
+	m, ok := raw.(map[string]any)
+	if !ok {
+		// true 或者空定义均表示不限制
+		return newSchema(), nil
+	}
+
+	var schema = newSchema()
+
+	// $ref
+	ref, ok := m["$ref"].(string)
+	if ok {
+		refSchema, err := this.compileRef(ref)
+		if err != nil {
+			return nil, err
+		}
+		schema.ref = refSchema
+		return schema, nil
+	}
+
+	return schema, this.compileInto(schema, m)
+}
+
+func (this *schemaCompiler) compileRef(ref string) (*Schema, error) {
+	refSchema, ok := this.refs[ref]
+	if ok {
+		return refSchema, nil
+	}
+
+	target, err := resolvePointer(this.root, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先放入占位对象，以支持循环引用
+	refSchema = newSchema()
+	this.refs[ref] = refSchema
+
+	targetMap, ok := target.(map[string]any)
+	if !ok {
+		return refSchema, nil
+	}
+
+	nextRef, ok := targetMap["$ref"].(string)
+	if ok {
+		refSchema.ref, err = this.compileRef(nextRef)
+		return refSchema, err
+	}
+
+	return refSchema, this.compileInto(refSchema, targetMap)
+}
+
+func (this *schemaCompiler) compileInto(schema *Schema, m map[string]any) error {
+	var err error
+
+	// type
+	switch t := m["type"].(type) {
+	case string:
+		schema.Types = []string{t}
+	case []any:
+		for _, t1 := range t {
+			schema.Types = append(schema.Types, types.String(t1))
+		}
+	}
+
+	schema.Nullable = types.Bool(m["nullable"])
+	schema.Format, _ = m["format"].(string)
+
+	enumList, ok := m["enum"].([]any)
+	if ok {
+		schema.Enum = enumList
+	}
+
+	// number
+	if m["minimum"] != nil {
+		var minimum = types.Float64(m["minimum"])
+		schema.Minimum = &minimum
+	}
+	if m["maximum"] != nil {
+		var maximum = types.Float64(m["maximum"])
+		schema.Maximum = &maximum
+	}
+	switch v := m["exclusiveMinimum"].(type) {
+	case bool: // 3.0
+		schema.ExclusiveMinimum = v
+	case nil:
+	default: // 3.1
+		var minimum = types.Float64(v)
+		schema.Minimum = &minimum
+		schema.ExclusiveMinimum = true
+	}
+	switch v := m["exclusiveMaximum"].(type) {
+	case bool: // 3.0
+		schema.ExclusiveMaximum = v
+	case nil:
+	default: // 3.1
+		var maximum = types.Float64(v)
+		schema.Maximum = &maximum
+		schema.ExclusiveMaximum = true
+	}
+	if m["multipleOf"] != nil {
+		schema.MultipleOf = types.Float64(m["multipleOf"])
+	}
+
+	// string
+	if m["minLength"] != nil {
+		schema.MinLength = types.Int(m["minLength"])
+	}
+	if m["maxLength"] != nil {
+		schema.MaxLength = types.Int(m["maxLength"])
+	}
+	pattern, ok := m["pattern"].(string)
+	if ok && len(pattern) > 0 {
+		schema.Pattern, err = re.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("compile pattern '%s' failed: %w", pattern, err)
+		}
+	}
+
+	// array
+	if m["items"] != nil {
+		schema.Items, err = this.compile(m["items"])
+		if err != nil {
+			return err
+		}
+	}
+	if m["minItems"] != nil {
+		schema.MinItems = types.Int(m["minItems"])
+	}
+	if m["maxItems"] != nil {
+		schema.MaxItems = types.Int(m["maxItems"])
+	}
+
+	// object
+	properties, ok := m["properties"].(map[string]any)
+	if ok {
+		schema.Properties = map[string]*Schema{}
+		for name, rawProperty := range properties {
+			schema.Properties[name], err = this.compile(rawProperty)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	requiredList, ok := m["required"].([]any)
+	if ok {
+		for _, requiredKey := range requiredList {
+			schema.Required = append(schema.Required, types.String(requiredKey))
+		}
+	}
+	switch v := m["additionalProperties"].(type) {
+	case bool:
+		schema.AdditionalPropertiesAllowed = v
+	case map[string]any:
+		schema.AdditionalProperties, err = this.compile(v)
+		if err != nil {
+			return err
+		}
+	}
+
+	// composition
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		list, ok := m[key].([]any)
+		if !ok {
+			continue
+		}
+		var subSchemas = []*Schema{}
+		for _, rawSubSchema := range list {
+			subSchema, err := this.compile(rawSubSchema)
+			if err != nil {
+				return err
+			}
+			subSchemas = append(subSchemas, subSchema)
+		}
+		switch key {
+		case "allOf":
+			schema.AllOf = subSchemas
+		case "anyOf":
+			schema.AnyOf = subSchemas
+		case "oneOf":
+			schema.OneOf = subSchemas
+		}
+	}
+	if m["not"] != nil {
+		schema.Not, err = this.compile(m["not"])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 解析文档内部的JSON Pointer，比如 #/components/schemas/User
+func resolvePointer(root map[string]any, ref string) (any, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, errors.New("unsupported $ref '" + ref + "', only local references are supported")
+	}
+
+	var current any = root
+	for _, piece := range strings.Split(ref[2:], "/") {
+		piece = strings.ReplaceAll(strings.ReplaceAll(piece, "~1", "/"), "~0", "~")
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, errors.New("invalid $ref '" + ref + "'")
+		}
+		current, ok = m[piece]
+		if !ok {
+			return nil, errors.New("invalid $ref '" + ref + "'")
+		}
+	}
+	return current, nil
+}
@@ -0,0 +1,274 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package openapi
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type ViolationCode = string
+
+const (
+	ViolationCodeUnknownPath            ViolationCode = "unknownPath"
+	ViolationCodeUnknownMethod          ViolationCode = "unknownMethod"
+	ViolationCodeMissingParameter       ViolationCode = "missingParameter"
+	ViolationCodeInvalidParameter       ViolationCode = "invalidParameter"
+	ViolationCodeUnknownParameter       ViolationCode = "unknownParameter"
+	ViolationCodeUnsupportedContentType ViolationCode = "unsupportedContentType"
+	ViolationCodeMissingBody            ViolationCode = "missingBody"
+	ViolationCodeInvalidBody            ViolationCode = "invalidBody"
+)
+
+// Violation 违反文档定义的情况
+type Violation struct {
+	Code    ViolationCode
+	Message string
+}
+
+func newViolation(code ViolationCode, message string) *Violation {
+	return &Violation{
+		Code:    code,
+		Message: message,
+	}
+}
+
+// ValidateOptions 校验选项
+type ValidateOptions struct {
+	DenyUnknownQuery bool // 是否禁止文档中未定义的查询参数
+	SkipBody         bool // 是否跳过请求体校验
+}
+
+// ValidateRequest 校验请求，如果符合文档定义则返回nil
+func (this *Document) ValidateRequest(req *http.Request, body []byte, options *ValidateOptions) *Violation {
+	if options == nil {
+		options = &ValidateOptions{}
+	}
+
+	pathItem, pathParams := this.MatchPath(req.URL.Path)
+	if pathItem == nil {
+		return newViolation(ViolationCodeUnknownPath, "path '"+req.URL.Path+"' is not defined")
+	}
+
+	var method = strings.ToUpper(req.Method)
+	operation, ok := pathItem.Operations[method]
+	if !ok && method == http.MethodHead {
+		operation, ok = pathItem.Operations[http.MethodGet]
+	}
+	if !ok {
+		return newViolation(ViolationCodeUnknownMethod, "method '"+method+"' is not allowed on path '"+pathItem.Template+"'")
+	}
+
+	// parameters
+	var query = req.URL.Query()
+	var knownQueryNames = map[string]bool{}
+	for _, param := range operation.Parameters {
+		var values []string
+		var found bool
+		switch param.In {
+		case ParameterLocationPath:
+			value, ok := pathParams[param.Name]
+			if ok {
+				values, found = []string{value}, true
+			}
+		case ParameterLocationQuery:
+			knownQueryNames[param.Name] = true
+			values, found = query[param.Name]
+		case ParameterLocationHeader:
+			values, found = req.Header[param.Name]
+		case ParameterLocationCookie:
+			cookie, err := req.Cookie(param.Name)
+			if err == nil {
+				values, found = []string{cookie.Value}, true
+			}
+		default:
+			continue
+		}
+
+		if !found {
+			if param.Required {
+				return newViolation(ViolationCodeMissingParameter, param.In+" parameter '"+param.Name+"' is required")
+			}
+			continue
+		}
+
+		if param.Schema == nil {
+			continue
+		}
+		err := param.Schema.Validate(this.convertParameter(param, values))
+		if err != nil {
+			return newViolation(ViolationCodeInvalidParameter, param.In+" parameter '"+param.Name+"': "+err.Error())
+		}
+	}
+
+	if options.DenyUnknownQuery {
+		for name := range query {
+			if !knownQueryNames[name] {
+				return newViolation(ViolationCodeUnknownParameter, "query parameter '"+name+"' is not defined")
+			}
+		}
+	}
+
+	// request body
+	if options.SkipBody {
+		return nil
+	}
+	return this.validateBody(req, body, operation.RequestBody)
+}
+
+func (this *Document) validateBody(req *http.Request, body []byte, requestBody *RequestBody) *Violation {
+	var hasBody = len(body) > 0 || req.ContentLength > 0
+	if requestBody == nil {
+		return nil
+	}
+	if !hasBody {
+		if requestBody.Required {
+			return newViolation(ViolationCodeMissingBody, "request body is required")
+		}
+		return nil
+	}
+
+	if len(requestBody.Content) == 0 {
+		return nil
+	}
+
+	var contentType = strings.ToLower(req.Header.Get("Content-Type"))
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+
+	schema, ok := this.matchContentType(requestBody.Content, mediaType)
+	if !ok {
+		return newViolation(ViolationCodeUnsupportedContentType, "content type '"+mediaType+"' is not supported")
+	}
+	if schema == nil {
+		return nil
+	}
+
+	var value any
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		err = json.Unmarshal(body, &value)
+		if err != nil {
+			return newViolation(ViolationCodeInvalidBody, "decode json body failed: "+err.Error())
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return newViolation(ViolationCodeInvalidBody, "decode form body failed: "+err.Error())
+		}
+		value = this.convertForm(schema, form)
+	default:
+		// 其他类型的数据不做校验
+		return nil
+	}
+
+	err = schema.Validate(value)
+	if err != nil {
+		return newViolation(ViolationCodeInvalidBody, err.Error())
+	}
+	return nil
+}
+
+// 匹配内容类型，支持 type/* 和 */* 通配符
+func (this *Document) matchContentType(content map[string]*Schema, mediaType string) (schema *Schema, ok bool) {
+	schema, ok = content[mediaType]
+	if ok {
+		return
+	}
+
+	var slashIndex = strings.Index(mediaType, "/")
+	if slashIndex > 0 {
+		schema, ok = content[mediaType[:slashIndex]+"/*"]
+		if ok {
+			return
+		}
+	}
+
+	schema, ok = content["*/*"]
+	return
+}
+
+// 将参数字符串值转换为Schema中定义的类型
+func (this *Document) convertParameter(param *Parameter, values []string) any {
+	var schema = param.Schema
+	if schema.PrimaryType() == "array" {
+		if !param.Explode || len(values) == 1 {
+			var pieces = []string{}
+			for _, value := range values {
+				if len(value) > 0 {
+					pieces = append(pieces, strings.Split(value, ",")...)
+				}
+			}
+			values = pieces
+		}
+
+		var itemType = ""
+		var items = schema.Resolve().Items
+		if items != nil {
+			itemType = items.PrimaryType()
+		}
+		var result = []any{}
+		for _, value := range values {
+			result = append(result, convertString(itemType, value))
+		}
+		return result
+	}
+
+	if len(values) == 0 {
+		return ""
+	}
+	return convertString(schema.PrimaryType(), values[0])
+}
+
+// 将表单数据转换为对象
+func (this *Document) convertForm(schema *Schema, form url.Values) map[string]any {
+	var properties = schema.Resolve().Properties
+	var result = map[string]any{}
+	for name, values := range form {
+		var propertySchema = properties[name]
+		if propertySchema == nil {
+			if len(values) == 1 {
+				result[name] = values[0]
+			} else {
+				var list = []any{}
+				for _, value := range values {
+					list = append(list, value)
+				}
+				result[name] = list
+			}
+			continue
+		}
+
+		result[name] = this.convertParameter(&Parameter{
+			Name:    name,
+			Explode: true,
+			Schema:  propertySchema,
+		}, values)
+	}
+	return result
+}
+
+// 转换字符串，转换失败时返回原始字符串，由校验过程报告类型错误
+func convertString(t string, value string) any {
+	switch t {
+	case "integer", "number":
+		f, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			return f
+		}
+	case "boolean":
+		switch value {
+		case "true":
+			return true
+		case "false":
+			return false
+		}
+	}
+	return value
+}
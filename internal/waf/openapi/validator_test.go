@@ -0,0 +1,251 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package openapi_test
+
+import (
+	"bytes"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/openapi"
+	"github.com/iwind/TeaGo/assert"
+	"net/http"
+	"testing"
+)
+
+var testDocument = `
+openapi: 3.0.3
+info:
+  title: Pets
+  version: "1.0"
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /pets:
+    get:
+      parameters:
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            minimum: 1
+            maximum: 100
+        - name: tags
+          in: query
+          schema:
+            type: array
+            items:
+              type: string
+              enum: [cat, dog]
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+          application/x-www-form-urlencoded:
+            schema:
+              $ref: '#/components/schemas/Pet'
+  /pets/mine:
+    get: {}
+  /pets/{petId}:
+    parameters:
+      - $ref: '#/components/parameters/PetId'
+    get:
+      parameters:
+        - name: X-Request-Id
+          in: header
+          required: true
+          schema:
+            type: string
+            format: uuid
+    delete: {}
+  /files/{name}.{ext}:
+    get:
+      parameters:
+        - name: ext
+          in: path
+          schema:
+            type: string
+            enum: [png, jpg]
+components:
+  parameters:
+    PetId:
+      name: petId
+      in: path
+      required: true
+      schema:
+        type: integer
+        format: int32
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+      additionalProperties: false
+      properties:
+        name:
+          type: string
+          minLength: 1
+          maxLength: 32
+        age:
+          type: integer
+          minimum: 0
+        owner:
+          $ref: '#/components/schemas/Owner'
+    Owner:
+      type: object
+      properties:
+        email:
+          type: string
+          format: email
+        pets:
+          type: array
+          items:
+            $ref: '#/components/schemas/Pet'
+`
+
+func testValidateRequest(t *testing.T, doc *openapi.Document, method string, url string, contentType string, body string, headers map[string]string) *openapi.Violation {
+	req, err := http.NewRequest(method, url, bytes.NewReader([]byte(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	var violation = doc.ValidateRequest(req, []byte(body), &openapi.ValidateOptions{
+		DenyUnknownQuery: true,
+	})
+	if violation != nil {
+		t.Log(method, url, "=>", violation.Code+": "+violation.Message)
+	} else {
+		t.Log(method, url, "=> ok")
+	}
+	return violation
+}
+
+func TestParseDocument(t *testing.T) {
+	{
+		_, err := openapi.ParseDocument([]byte(testDocument))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	{
+		_, err := openapi.ParseDocument([]byte(`{"swagger": "2.0", "paths": {}}`))
+		if err == nil {
+			t.Fatal("should fail on swagger 2.0")
+		}
+		t.Log(err)
+	}
+	{
+		_, err := openapi.ParseDocument([]byte(`{"openapi": "3.1.0", "paths": {"/a": {"get": {"parameters": [{"$ref": "#/components/parameters/None"}]}}}}`))
+		if err == nil {
+			t.Fatal("should fail on invalid $ref")
+		}
+		t.Log(err)
+	}
+}
+
+func TestDocument_MatchPath(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	doc, err := openapi.ParseDocument([]byte(testDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	{
+		pathItem, _ := doc.MatchPath("/pets/mine")
+		a.IsTrue(pathItem != nil && pathItem.Template == "/pets/mine")
+	}
+	{
+		pathItem, params := doc.MatchPath("/v1/pets/123")
+		a.IsTrue(pathItem != nil && pathItem.Template == "/pets/{petId}")
+		a.IsTrue(params["petId"] == "123")
+	}
+	{
+		pathItem, params := doc.MatchPath("/files/logo.png")
+		a.IsTrue(pathItem != nil)
+		a.IsTrue(params["name"] == "logo")
+		a.IsTrue(params["ext"] == "png")
+	}
+	{
+		pathItem, _ := doc.MatchPath("/pets/1/2")
+		a.IsNil(pathItem)
+	}
+}
+
+func TestDocument_ValidateRequest(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	doc, err := openapi.ParseDocument([]byte(testDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var codeOf = func(violation *openapi.Violation) string {
+		if violation == nil {
+			return ""
+		}
+		return violation.Code
+	}
+
+	// paths & methods
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodGet, "https://api.example.com/v1/pets", "", "", nil)) == "")
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodGet, "https://api.example.com/pets", "", "", nil)) == "")
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodGet, "https://api.example.com/users", "", "", nil)) == openapi.ViolationCodeUnknownPath)
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodPut, "https://api.example.com/pets", "", "", nil)) == openapi.ViolationCodeUnknownMethod)
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodHead, "https://api.example.com/pets/mine", "", "", nil)) == "")
+
+	// query
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodGet, "https://api.example.com/pets?limit=10&tags=cat,dog", "", "", nil)) == "")
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodGet, "https://api.example.com/pets?tags=cat&tags=dog", "", "", nil)) == "")
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodGet, "https://api.example.com/pets?limit=1000", "", "", nil)) == openapi.ViolationCodeInvalidParameter)
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodGet, "https://api.example.com/pets?limit=abc", "", "", nil)) == openapi.ViolationCodeInvalidParameter)
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodGet, "https://api.example.com/pets?tags=cat,bird", "", "", nil)) == openapi.ViolationCodeInvalidParameter)
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodGet, "https://api.example.com/pets?id=1%20or%201=1", "", "", nil)) == openapi.ViolationCodeUnknownParameter)
+
+	// path & header
+	var headers = map[string]string{"X-Request-Id": "0f8fad5b-d9cb-469f-a165-70867728950e"}
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodGet, "https://api.example.com/pets/123", "", "", headers)) == "")
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodGet, "https://api.example.com/pets/123", "", "", nil)) == openapi.ViolationCodeMissingParameter)
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodGet, "https://api.example.com/pets/123", "", "", map[string]string{"X-Request-Id": "abc"})) == openapi.ViolationCodeInvalidParameter)
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodGet, "https://api.example.com/pets/1'", "", "", headers)) == openapi.ViolationCodeInvalidParameter)
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodDelete, "https://api.example.com/pets/99999999999", "", "", nil)) == openapi.ViolationCodeInvalidParameter)
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodGet, "https://api.example.com/files/a.png", "", "", nil)) == "")
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodGet, "https://api.example.com/files/a.php", "", "", nil)) == openapi.ViolationCodeInvalidParameter)
+
+	// body
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodPost, "https://api.example.com/pets", "application/json", `{"name": "Tom", "age": 3, "owner": {"email": "a@example.com", "pets": [{"name": "Jerry"}]}}`, nil)) == "")
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodPost, "https://api.example.com/pets", "application/json; charset=utf-8", `{"name": "Tom"}`, nil)) == "")
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodPost, "https://api.example.com/pets", "application/json", ``, nil)) == openapi.ViolationCodeMissingBody)
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodPost, "https://api.example.com/pets", "application/xml", `<pet/>`, nil)) == openapi.ViolationCodeUnsupportedContentType)
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodPost, "https://api.example.com/pets", "application/json", `{"name": "Tom"`, nil)) == openapi.ViolationCodeInvalidBody)
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodPost, "https://api.example.com/pets", "application/json", `{"age": 3}`, nil)) == openapi.ViolationCodeInvalidBody)
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodPost, "https://api.example.com/pets", "application/json", `{"name": "Tom", "isAdmin": true}`, nil)) == openapi.ViolationCodeInvalidBody)
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodPost, "https://api.example.com/pets", "application/json", `{"name": "Tom", "age": -1}`, nil)) == openapi.ViolationCodeInvalidBody)
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodPost, "https://api.example.com/pets", "application/json", `{"name": "Tom", "owner": {"pets": [{"age": 1}]}}`, nil)) == openapi.ViolationCodeInvalidBody)
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodPost, "https://api.example.com/pets", "application/x-www-form-urlencoded", `name=Tom&age=3`, nil)) == "")
+	a.IsTrue(codeOf(testValidateRequest(t, doc, http.MethodPost, "https://api.example.com/pets", "application/x-www-form-urlencoded", `name=Tom&age=old`, nil)) == openapi.ViolationCodeInvalidBody)
+}
+
+func BenchmarkDocument_ValidateRequest(b *testing.B) {
+	doc, err := openapi.ParseDocument([]byte(testDocument))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var body = []byte(`{"name": "Tom", "age": 3, "owner": {"email": "a@example.com"}}`)
+	req, err := http.NewRequest(http.MethodPost, "https://api.example.com/v1/pets", bytes.NewReader(body))
+	if err != nil {
+		b.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = doc.ValidateRequest(req, body, nil)
+	}
+}
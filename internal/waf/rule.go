@@ -579,51 +579,35 @@ func (this *Rule) Test(value any) bool {
 	case RuleOperatorNotContainsAnyWord:
 		return !runes.ContainsAnyWordRunes(this.stringifyValue(value), this.stringValueRunes, this.IsCaseInsensitive)
 	case RuleOperatorContainsSQLInjection, RuleOperatorContainsSQLInjectionStrictly:
-		if value == nil {
-			return false
-		}
 		var isStrict = this.Operator == RuleOperatorContainsSQLInjectionStrictly
-		switch xValue := value.(type) {
-		case []string:
-			for _, v := range xValue {
-				if injectionutils.DetectSQLInjectionCache(v, isStrict, this.cacheLife) {
-					return true
-				}
-			}
-			return false
-		case [][]byte:
-			for _, v := range xValue {
-				if injectionutils.DetectSQLInjectionCache(string(v), isStrict, this.cacheLife) {
-					return true
-				}
-			}
-			return false
-		default:
-			return injectionutils.DetectSQLInjectionCache(this.stringifyValue(value), isStrict, this.cacheLife)
-		}
+		return this.testEachString(value, func(s string) bool {
+			return injectionutils.DetectSQLInjectionCache(s, isStrict, this.cacheLife)
+		})
 	case RuleOperatorContainsXSS, RuleOperatorContainsXSSStrictly:
-		if value == nil {
-			return false
-		}
 		var isStrict = this.Operator == RuleOperatorContainsXSSStrictly
-		switch xValue := value.(type) {
-		case []string:
-			for _, v := range xValue {
-				if injectionutils.DetectXSSCache(v, isStrict, this.cacheLife) {
-					return true
-				}
-			}
-			return false
-		case [][]byte:
-			for _, v := range xValue {
-				if injectionutils.DetectXSSCache(string(v), isStrict, this.cacheLife) {
-					return true
-				}
-			}
-			return false
-		default:
-			return injectionutils.DetectXSSCache(this.stringifyValue(value), isStrict, this.cacheLife)
-		}
+		return this.testEachString(value, func(s string) bool {
+			return injectionutils.DetectXSSCache(s, isStrict, this.cacheLife)
+		})
+	case RuleOperatorContainsCmdInjection, RuleOperatorContainsCmdInjectionStrictly:
+		var isStrict = this.Operator == RuleOperatorContainsCmdInjectionStrictly
+		return this.testEachString(value, func(s string) bool {
+			return injectionutils.DetectCommandInjectionCache(s, isStrict, this.cacheLife)
+		})
+	case RuleOperatorContainsPathTraversal, RuleOperatorContainsPathTraversalStrictly:
+		var isStrict = this.Operator == RuleOperatorContainsPathTraversalStrictly
+		return this.testEachString(value, func(s string) bool {
+			return injectionutils.DetectPathTraversalCache(s, isStrict, this.cacheLife)
+		})
+	case RuleOperatorContainsSSRF, RuleOperatorContainsSSRFStrictly:
+		var isStrict = this.Operator == RuleOperatorContainsSSRFStrictly
+		return this.testEachString(value, func(s string) bool {
+			return injectionutils.DetectSSRFCache(s, isStrict, this.cacheLife)
+		})
+	case RuleOperatorContainsSSTI, RuleOperatorContainsSSTIStrictly:
+		var isStrict = this.Operator == RuleOperatorContainsSSTIStrictly
+		return this.testEachString(value, func(s string) bool {
+			return injectionutils.DetectTemplateInjectionCache(s, isStrict, this.cacheLife)
+		})
 	case RuleOperatorContainsBinary:
 		data, _ := base64.StdEncoding.DecodeString(this.stringifyValue(this.Value))
 		if this.IsCaseInsensitive {
@@ -838,6 +822,31 @@ func (this *Rule) execFilter(value any) any {
 	return value
 }
 
+// 对值中的每个字符串执行检测，只要有一个符合即返回true
+func (this *Rule) testEachString(value any, testFunc func(s string) bool) bool {
+	if value == nil {
+		return false
+	}
+	switch xValue := value.(type) {
+	case []string:
+		for _, v := range xValue {
+			if testFunc(v) {
+				return true
+			}
+		}
+		return false
+	case [][]byte:
+		for _, v := range xValue {
+			if testFunc(string(v)) {
+				return true
+			}
+		}
+		return false
+	default:
+		return testFunc(this.stringifyValue(value))
+	}
+}
+
 func (this *Rule) stringifyValue(value any) string {
 	if value == nil {
 		return ""
@@ -29,6 +29,7 @@ func (this *RuleGroup) Init(waf *WAF) error {
 
 	if this.hasRuleSets {
 		for _, set := range this.RuleSets {
+			set.isInbound = this.IsInbound
 			err := set.Init(waf)
 			if err != nil {
 				return fmt.Errorf("init set '%d' failed: %w", set.Id, err)
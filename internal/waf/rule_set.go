@@ -37,7 +37,8 @@ type RuleSet struct {
 	hasAllowActions bool
 	allowScope      string
 
-	hasRules bool
+	hasRules  bool
+	isInbound bool // 是否属于入站规则分组
 }
 
 func NewRuleSet() *RuleSet {
@@ -86,6 +87,12 @@ func (this *RuleSet) Init(waf *WAF) error {
 			continue
 		}
 
+		// 脱敏动作只能用于出站规则
+		maskAction, isMaskAction := instance.(*MaskAction)
+		if isMaskAction {
+			maskAction.isInbound = this.isInbound
+		}
+
 		err := instance.Init(waf)
 		if err != nil {
 			remotelogs.Error("WAF_RULE_SET", "init action '"+action.Code+"' failed: "+err.Error())
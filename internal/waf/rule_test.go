@@ -521,6 +521,48 @@ func TestRule_Test(t *testing.T) {
 		a.IsFalse(rule.Test("id=123"))
 		a.IsFalse(rule.Test("id=abc123 hello world '"))
 	}
+	{
+		var rule = NewRule()
+		rule.Operator = RuleOperatorContainsCmdInjection
+		err := rule.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(rule.Test("127.0.0.1; cat /etc/passwd"))
+		a.IsTrue(rule.Test([]string{"abc", "`whoami`"}))
+		a.IsFalse(rule.Test("a=1&id=2"))
+	}
+	{
+		var rule = NewRule()
+		rule.Operator = RuleOperatorContainsPathTraversal
+		err := rule.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(rule.Test("../../etc/passwd"))
+		a.IsTrue(rule.Test([][]byte{[]byte("abc"), []byte("%2e%2e%2fconfig.php")}))
+		a.IsFalse(rule.Test("/static/app.js"))
+	}
+	{
+		var rule = NewRule()
+		rule.Operator = RuleOperatorContainsSSRF
+		err := rule.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(rule.Test("http://169.254.169.254/latest/meta-data/"))
+		a.IsFalse(rule.Test("https://example.com/"))
+	}
+	{
+		var rule = NewRule()
+		rule.Operator = RuleOperatorContainsSSTI
+		err := rule.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(rule.Test("{{7*7}}"))
+		a.IsFalse(rule.Test("{{name}}"))
+	}
 }
 
 func TestRule_MatchStar(t *testing.T) {
@@ -39,7 +39,13 @@ func (this *WAFManager) UpdatePolicies(policies []*firewallconfigs.HTTPFirewallP
 			continue
 		}
 	}
+	var oldMapping = this.mapping
 	this.mapping = m
+
+	// 释放旧的WAF中缓存的数据
+	for _, oldWAF := range oldMapping {
+		oldWAF.Stop()
+	}
 }
 
 // FindWAF 查找WAF